@@ -0,0 +1,424 @@
+// Package main is the entry point for the Food Delivery API server.
+// Architecture: Modular Monolith following Clean Architecture principles.
+// Layers: Handlers (Delivery) -> Usecases -> Repositories
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/handlers"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+	"fooddelivery/pkg/database"
+	"fooddelivery/pkg/logger"
+	"fooddelivery/pkg/redis"
+)
+
+func main() {
+	// Initialize Logger
+	logger.Init()
+	log := logger.NewLogger()
+	log.Info("Starting Food Delivery API Server...")
+
+	// Load configuration from environment variables
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration", "error", err)
+	}
+	log.Info("Configuration loaded", "port", cfg.Port)
+
+	// Initialize PostgreSQL connection pool with auto-reconnect
+	// Using singleton pattern to ensure single connection pool across the app
+	dbPool, err := database.NewPostgresPool(context.Background(), cfg.DatabaseURL, log)
+	if err != nil {
+		log.Fatal("Failed to connect to PostgreSQL", "error", err)
+	}
+	defer dbPool.Close()
+
+	// Initialize Redis client for caching and session management
+	redisClient, err := redis.NewClient(cfg.RedisURL, log)
+	if err != nil {
+		log.Fatal("Failed to connect to Redis", "error", err)
+	}
+	defer redisClient.Close()
+
+	// Initialize repositories (Data Access Layer)
+	userRepo := repository.NewUserRepository(dbPool)
+	menuRepo := repository.NewMenuRepository(dbPool)
+	orderRepo := repository.NewOrderRepository(dbPool)
+	tableRepo := repository.NewTableRepository(dbPool)
+	billRepo := repository.NewBillRepository(dbPool)
+	refundRepo := repository.NewRefundRepository(dbPool)
+	groupCartRepo := repository.NewGroupCartRepository(dbPool)
+	orderModificationRepo := repository.NewOrderModificationRepository(dbPool)
+	reviewRepo := repository.NewReviewRepository(dbPool)
+	cateringRepo := repository.NewCateringRepository(dbPool)
+	subscriptionRepo := repository.NewSubscriptionRepository(dbPool)
+	outboxRepo := repository.NewOutboxRepository(dbPool)
+	notificationRepo := repository.NewNotificationRepository(dbPool)
+	analyticsRepo := repository.NewAnalyticsRepository(dbPool)
+	exportRepo := repository.NewExportRepository(dbPool)
+	settlementRepo := repository.NewSettlementRepository(dbPool)
+	integrityRepo := repository.NewIntegrityRepository(dbPool)
+	stockRepo := repository.NewStockRepository(dbPool)
+
+	// Initialize usecases (Business Logic Layer)
+	menuUsecase := usecase.NewMenuUsecase(menuRepo, redisClient, log)
+	paymentUsecase := usecase.NewPaymentUsecase(orderRepo, menuRepo, cfg.Razorpay, log)
+	paymentUsecase.SetRedisClient(redisClient) // Set redis for idempotency
+	paymentUsecase.SetOrderConfig(cfg.Order)
+	paymentUsecase.SetRefundRepository(refundRepo)
+	orderUsecase := usecase.NewOrderUsecase(orderRepo, menuRepo, paymentUsecase, cfg.Location, log)
+	userUsecase := usecase.NewUserUsecase(userRepo, log)
+	kitchenUsecase := usecase.NewKitchenUsecase(orderRepo, tableRepo, cfg.Location, log)
+	tableUsecase := usecase.NewTableUsecase(tableRepo, orderRepo, billRepo, paymentUsecase, cfg.TableQRSecret, log)
+	tableUsecase.SetRedisClient(redisClient)
+	paymentUsecase.RegisterPaymentTarget(tableUsecase) // Webhooks for table tab payments
+	billUsecase := usecase.NewBillUsecase(billRepo, refundRepo, tableRepo, orderRepo, paymentUsecase, log)
+	paymentUsecase.RegisterPaymentTarget(billUsecase) // Webhooks for split bill shares
+	groupCartUsecase := usecase.NewGroupCartUsecase(groupCartRepo, userRepo, orderRepo, paymentUsecase, log)
+	cartUsecase := usecase.NewCartUsecase(paymentUsecase, redisClient, log)
+	orderModificationUsecase := usecase.NewOrderModificationUsecase(orderModificationRepo, orderRepo, refundRepo, paymentUsecase, log)
+	paymentUsecase.RegisterPaymentTarget(orderModificationUsecase) // Webhooks for order edit differences
+	reviewUsecase := usecase.NewReviewUsecase(reviewRepo, orderRepo, menuUsecase, log)
+	cateringUsecase := usecase.NewCateringUsecase(cateringRepo, orderRepo, menuRepo, paymentUsecase, cfg.Location, log)
+	subscriptionUsecase := usecase.NewSubscriptionUsecase(subscriptionRepo, menuRepo, refundRepo, paymentUsecase, cfg.Subscription, cfg.Location, log)
+	paymentUsecase.RegisterPaymentTarget(subscriptionUsecase) // Webhooks for subscription periods
+	outboxUsecase := usecase.NewOutboxUsecase(outboxRepo, redisClient, cfg.Outbox, log)
+	analyticsUsecase := usecase.NewAnalyticsUsecase(analyticsRepo, cfg.Location, log)
+	exportUsecase := usecase.NewExportUsecase(exportRepo, cfg.Export, cfg.Location, log)
+	tallyLedgers, err := usecase.ParseTallyLedgers(cfg.Tally.Ledgers)
+	if err != nil {
+		log.Fatal("Failed to parse tally ledgers", "error", err)
+	}
+	accountingUsecase := usecase.NewAccountingUsecase(orderRepo, refundRepo, tallyLedgers, cfg.Tally.Company, cfg.Order.TaxRate, cfg.Location, log)
+	settlementUsecase := usecase.NewSettlementUsecase(settlementRepo, cfg.Location, log)
+	integrityUsecase := usecase.NewIntegrityUsecase(integrityRepo, cfg.Integrity, cfg.Location, log)
+	stockUsecase := usecase.NewStockUsecase(stockRepo, cfg.Stock, cfg.Location, log)
+
+	// Notifications: providers and per-event channels come from configuration
+	notificationSenders, err := usecase.NewNotificationSenders(cfg.Notification)
+	if err != nil {
+		log.Fatal("Failed to set up notification providers", "error", err)
+	}
+	notificationRules, err := usecase.ParseNotificationRules(cfg.Notification.Rules)
+	if err != nil {
+		log.Fatal("Failed to parse notification rules", "error", err)
+	}
+	notificationUsecase := usecase.NewNotificationUsecase(notificationRepo, userRepo, orderRepo, notificationSenders, notificationRules, cfg.Notification.MaxAttempts, cfg.Location, log)
+	userUsecase.SetNotifications(notificationUsecase)    // Login codes by SMS
+	subscriptionUsecase.SetNotifier(notificationUsecase) // Renewal reminders
+	outboxUsecase.Subscribe("notifications", notificationUsecase.HandleEvent,
+		domain.EventOrderPaid, domain.EventOrderStatusChanged, domain.EventRefundIssued)
+	outboxUsecase.Subscribe("menu-cache", menuUsecase.HandleEvent, domain.EventMenuAvailabilityChanged)
+	outboxUsecase.Subscribe("bill-refunds", billUsecase.HandleEvent, domain.EventOrderPaid)
+
+	// Set JWT configuration for user usecase
+	userUsecase.SetJWTConfig(cfg.JWTSecret, cfg.JWTExpiration)
+
+	// Initialize Fiber with optimized settings for low-latency
+	app := fiber.New(fiber.Config{
+		// Prefork enables multiple Go processes to handle requests
+		// Disabled for easier debugging; enable in production for max throughput
+		Prefork: false,
+
+		// Strict routing distinguishes between /foo and /foo/
+		StrictRouting: true,
+
+		// Case sensitive routing
+		CaseSensitive: true,
+
+		// Read timeout prevents slow client attacks
+		ReadTimeout: 10 * time.Second,
+
+		// Write timeout for response
+		WriteTimeout: 10 * time.Second,
+
+		// Idle timeout for keep-alive connections
+		IdleTimeout: 120 * time.Second,
+
+		// Custom error handler with structured logging
+		ErrorHandler: handlers.CustomErrorHandler(log),
+	})
+
+	// Global middleware stack
+	// Order matters: Recovery -> CORS -> Request Logging -> Routes
+
+	// Recovery middleware catches panics and converts to 500 errors
+	// Prevents server crash from unhandled panics
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace: true,
+	}))
+
+	// CORS middleware for Flutter web/mobile clients
+	allowCredentials := cfg.AllowedOrigins != "*"
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.AllowedOrigins,
+		AllowMethods:     "GET,POST,PUT,DELETE,PATCH",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Request-ID",
+		AllowCredentials: allowCredentials,
+		MaxAge:           3600,
+	}))
+
+	// Custom request logging middleware with Request-ID generation
+	app.Use(logger.FiberMiddleware(log))
+
+	// Setup routes
+	setupRoutes(app, handlers.NewHandlers(
+		menuUsecase,
+		orderUsecase,
+		paymentUsecase,
+		userUsecase,
+		kitchenUsecase,
+		tableUsecase,
+		billUsecase,
+		groupCartUsecase,
+		cartUsecase,
+		orderModificationUsecase,
+		reviewUsecase,
+		cateringUsecase,
+		subscriptionUsecase,
+		notificationUsecase,
+		analyticsUsecase,
+		exportUsecase,
+		accountingUsecase,
+		settlementUsecase,
+		integrityUsecase,
+		stockUsecase,
+		log,
+	))
+
+	// Place daily tiffin orders, relay domain events, send notifications, write exports, run the nightly integrity checks and release and reset menu stock in the background until shutdown
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	go subscriptionUsecase.RunScheduler(schedulerCtx)
+	go outboxUsecase.RunRelay(schedulerCtx)
+	go notificationUsecase.RunWorker(schedulerCtx)
+	go exportUsecase.RunWorker(schedulerCtx)
+	go integrityUsecase.RunScheduler(schedulerCtx)
+	go stockUsecase.RunScheduler(schedulerCtx)
+
+	// Graceful shutdown handling
+	// Captures SIGINT/SIGTERM and cleanly closes connections
+	shutdownChan := make(chan os.Signal, 1)
+	signal.Notify(shutdownChan, os.Interrupt, syscall.SIGTERM)
+
+	// Start server in goroutine
+	go func() {
+		addr := fmt.Sprintf(":%d", cfg.Port)
+		log.Info("Server listening", "address", addr)
+		if err := app.Listen(addr); err != nil {
+			log.Fatal("Server failed to start", "error", err)
+		}
+	}()
+
+	// Wait for shutdown signal
+	<-shutdownChan
+	log.Info("Shutdown signal received, gracefully stopping server...")
+	stopScheduler()
+
+	// Graceful shutdown with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		log.Error("Server forced to shutdown", "error", err)
+	}
+
+	log.Info("Server stopped gracefully")
+}
+
+// setupRoutes configures all API routes following RESTful conventions
+func setupRoutes(app *fiber.App, h *handlers.Handlers) {
+	// Health check endpoint for load balancer/k8s probes
+	app.Get("/health", h.HealthCheck)
+
+	// API v1 routes
+	api := app.Group("/api/v1")
+
+	// Authentication routes (no auth required)
+	auth := api.Group("/auth")
+	auth.Post("/register", h.Register)      // Email/password registration
+	auth.Post("/login/email", h.EmailLogin) // Email/password login
+	auth.Post("/login/phone", h.SendOTP)    // Phone-based OTP login (send OTP)
+	auth.Post("/verify-otp", h.VerifyOTP)   // Verify OTP and get token
+
+	// Menu routes (public read, admin write)
+	// Register directly on API group without creating a subgroup
+	api.Get("/menu", h.GetMenu)
+	api.Get("/menu/:id", h.GetMenuItem)
+	api.Get("/menu/:id/reviews", h.GetMenuItemReviews)
+	api.Get("/subscription-plans", h.GetMealPlans)
+	api.Get("/subscription-plans/:id", h.GetMealPlan)
+
+	// Protected routes (require authentication)
+	// Using JWT middleware for authentication
+	// Use specific paths instead of "/" to avoid catching public routes
+	// Server-side cart shared by all of a user's devices
+	cart := api.Group("/cart", h.AuthMiddleware)
+	cart.Get("/", h.GetCart)
+	cart.Delete("/", h.ClearCart)
+	cart.Post("/items", h.AddCartItem)
+	cart.Put("/items/:id", h.UpdateCartItem)
+	cart.Delete("/items/:id", h.RemoveCartItem)
+	cart.Get("/quote", h.GetCartQuote)
+	cart.Post("/checkout", h.CheckoutCart)
+
+	orders := api.Group("/orders", h.AuthMiddleware)
+	orders.Post("/create", h.CreateOrder)
+	orders.Get("/", h.GetUserOrders)
+	orders.Get("/:id", h.GetOrder)
+	orders.Post("/:id/reorder", h.ReorderOrder)
+	orders.Post("/:id/modify", h.ModifyOrder)
+	orders.Post("/:id/modify/verify", h.VerifyOrderModification)
+	orders.Get("/:id/revisions", h.GetOrderRevisions)
+	orders.Post("/:id/review", h.SubmitReview)
+	orders.Get("/:id/review", h.GetOrderReview)
+	orders.Post("/verify", h.VerifyPayment)
+
+	// Dine-in: guests scan the table QR and order rounds onto a shared tab
+	tables := api.Group("/tables", h.AuthMiddleware)
+	tables.Post("/join", h.JoinTable)
+	tables.Get("/sessions/:id", h.GetTableSession)
+	tables.Post("/sessions/:id/orders", h.PlaceTableOrder)
+	tables.Post("/sessions/:id/request-bill", h.RequestTableBill)
+	tables.Post("/sessions/:id/pay", h.PayTableSession)
+	tables.Post("/sessions/:id/verify", h.VerifyTablePayment)
+
+	// Split bills: a tab or unpaid order paid in shares by several guests
+	bills := api.Group("/bills", h.AuthMiddleware)
+	bills.Post("/", h.CreateBill)
+	bills.Get("/", h.GetActiveBill)
+	bills.Get("/:id", h.GetBill)
+	bills.Post("/:id/shares/:shareId/pay", h.PayBillShare)
+	bills.Post("/:id/shares/:shareId/verify", h.VerifyBillShare)
+	bills.Post("/:id/void", h.VoidBill)
+
+	// Group carts: members add their own items, the host locks and checks out
+	groupCarts := api.Group("/group-carts", h.AuthMiddleware)
+	groupCarts.Post("/", h.CreateGroupCart)
+	groupCarts.Post("/join", h.JoinGroupCart)
+	groupCarts.Get("/:id", h.GetGroupCart)
+	groupCarts.Post("/:id/items", h.AddGroupCartItem)
+	groupCarts.Put("/:id/items/:itemId", h.UpdateGroupCartItem)
+	groupCarts.Delete("/:id/items/:itemId", h.RemoveGroupCartItem)
+	groupCarts.Post("/:id/lock", h.LockGroupCart)
+	groupCarts.Post("/:id/unlock", h.UnlockGroupCart)
+	groupCarts.Post("/:id/cancel", h.CancelGroupCart)
+	groupCarts.Post("/:id/checkout", h.CheckoutGroupCart)
+
+	// Catering: event orders quoted by hand, paid as an advance and a balance
+	catering := api.Group("/catering", h.AuthMiddleware)
+	catering.Post("/", h.SubmitCateringRequest)
+	catering.Get("/", h.GetUserCateringRequests)
+	catering.Get("/:id", h.GetCateringRequest)
+	catering.Post("/:id/accept", h.AcceptCateringQuote)
+	catering.Post("/:id/decline", h.DeclineCateringQuote)
+	catering.Post("/:id/cancel", h.CancelCateringRequest)
+	catering.Post("/:id/pay", h.PayCateringRequest)
+
+	// Tiffin subscriptions: prepaid meal plans delivered daily by the scheduler
+	subscriptions := api.Group("/subscriptions", h.AuthMiddleware)
+	subscriptions.Post("/", h.Subscribe)
+	subscriptions.Get("/", h.GetUserSubscriptions)
+	subscriptions.Get("/:id", h.GetSubscription)
+	subscriptions.Put("/:id", h.UpdateSubscription)
+	subscriptions.Post("/:id/renew", h.RenewSubscription)
+	subscriptions.Post("/:id/verify", h.VerifySubscriptionPayment)
+	subscriptions.Post("/:id/pause", h.PauseSubscription)
+	subscriptions.Post("/:id/resume", h.ResumeSubscription)
+	subscriptions.Post("/:id/skips", h.SkipSubscriptionDay)
+	subscriptions.Delete("/:id/skips/:date", h.UnskipSubscriptionDay)
+	subscriptions.Post("/:id/cancel", h.CancelSubscription)
+
+	// Push notification devices
+	devices := api.Group("/devices", h.AuthMiddleware)
+	devices.Post("/", h.RegisterDevice)
+	devices.Delete("/:token", h.UnregisterDevice)
+
+	// Notification settings and the consent log of the signed-in user
+	users := api.Group("/users", h.AuthMiddleware)
+	users.Get("/me/notification-preferences", h.GetMyNotificationPreferences)
+	users.Put("/me/notification-preferences", h.UpdateMyNotificationPreferences)
+	users.Get("/me/consents", h.GetMyConsentChanges)
+
+	// Admin routes (require admin role)
+	admin := api.Group("/admin", h.AuthMiddleware, h.AdminMiddleware)
+	admin.Post("/menu", h.CreateMenuItem)
+	admin.Put("/menu/:id", h.UpdateMenuItem)
+	admin.Delete("/menu/:id", h.DeleteMenuItem)
+	admin.Post("/menu/:id/variants", h.CreateMenuVariant)
+	admin.Put("/menu/:id/variants/:variantId", h.UpdateMenuVariant)
+	admin.Delete("/menu/:id/variants/:variantId", h.DeleteMenuVariant)
+	admin.Post("/menu/:id/modifier-groups", h.CreateModifierGroup)
+	admin.Put("/menu/:id/modifier-groups/:groupId", h.UpdateModifierGroup)
+	admin.Delete("/menu/:id/modifier-groups/:groupId", h.DeleteModifierGroup)
+	admin.Post("/menu/:id/bundle-slots", h.CreateBundleSlot)
+	admin.Put("/menu/:id/bundle-slots/:slotId", h.UpdateBundleSlot)
+	admin.Delete("/menu/:id/bundle-slots/:slotId", h.DeleteBundleSlot)
+	admin.Put("/menu/:id/stock", h.SetMenuStock)
+	admin.Delete("/menu/:id/stock", h.DeleteMenuStock)
+	admin.Get("/stock", h.GetStock)
+	admin.Post("/menu/invalidate-cache", h.InvalidateMenuCache)
+	admin.Get("/orders", h.GetAllOrders)
+	admin.Put("/orders/:id/status", h.UpdateOrderStatus)
+	admin.Get("/orders/:id/ticket", h.GetKitchenTicket)
+	admin.Get("/orders/pickup/:code", h.GetPickupOrder)
+	admin.Post("/orders/pickup/:code/collect", h.CollectPickupOrder)
+	admin.Get("/kitchen/orders", h.GetKitchenQueue)
+	admin.Get("/tables", h.GetTables)
+	admin.Post("/tables", h.CreateTable)
+	admin.Put("/tables/:id", h.UpdateTable)
+	admin.Post("/tables/:id/rotate-qr", h.RotateTableQR)
+	admin.Get("/table-sessions", h.GetTableSessions)
+	admin.Post("/table-sessions/:id/settle", h.SettleTableSession)
+	admin.Get("/reviews", h.GetReviews)
+	admin.Put("/reviews/:id/status", h.ModerateReview)
+	admin.Put("/reviews/:id/items/:itemId/status", h.ModerateItemReview)
+	admin.Get("/catering", h.GetCateringRequests)
+	admin.Get("/catering/:id", h.GetCateringRequest)
+	admin.Post("/catering/:id/quote", h.QuoteCateringRequest)
+	admin.Post("/catering/:id/cancel", h.CancelCateringRequest)
+	admin.Get("/subscription-plans", h.GetMealPlans)
+	admin.Post("/subscription-plans", h.CreateMealPlan)
+	admin.Put("/subscription-plans/:id", h.UpdateMealPlan)
+	admin.Get("/subscriptions", h.GetSubscriptions)
+	admin.Post("/subscriptions/materialize", h.MaterializeSubscriptions)
+	admin.Get("/subscriptions/:id", h.GetSubscription)
+	admin.Post("/subscriptions/:id/cancel", h.CancelSubscription)
+	admin.Get("/notifications", h.GetNotifications)
+	admin.Post("/notifications/promotions", h.SendPromotion)
+	admin.Get("/users/:id/notification-preferences", h.GetUserNotificationPreferences)
+	admin.Put("/users/:id/notification-preferences", h.UpdateUserNotificationPreferences)
+	admin.Get("/users/:id/consents", h.GetUserConsentChanges)
+	admin.Get("/analytics/summary", h.GetSalesSummary)
+	admin.Get("/analytics/revenue", h.GetRevenueReport)
+	admin.Get("/analytics/top-items", h.GetTopItems)
+	admin.Get("/analytics/top-categories", h.GetTopCategories)
+	admin.Get("/analytics/peak-hours", h.GetPeakHours)
+	admin.Get("/exports/tally", h.ExportTally)
+	admin.Get("/exports/jobs", h.GetExportJobs)
+	admin.Get("/exports/jobs/:id", h.GetExportJob)
+	admin.Get("/exports/jobs/:id/download", h.DownloadExport)
+	admin.Get("/exports/:kind", h.ExportReport)
+	admin.Post("/settlements/import", h.ImportSettlements)
+	admin.Get("/settlements/reconciliation", h.GetSettlementReconciliation)
+	admin.Get("/integrity/findings", h.GetIntegrityFindings)
+	admin.Get("/integrity/runs", h.GetIntegrityRuns)
+	admin.Post("/integrity/run", h.RunIntegrityChecks)
+
+	// Webhook routes (Razorpay callbacks)
+	// These bypass normal auth but use signature verification
+	webhooks := app.Group("/webhooks")
+	webhooks.Post("/razorpay", h.RazorpayWebhook)
+}
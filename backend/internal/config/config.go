@@ -5,7 +5,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // Config holds all application configuration
@@ -15,6 +17,10 @@ type Config struct {
 	Environment    string
 	AllowedOrigins string
 
+	// Location is the business timezone used for day boundaries and
+	// human-facing times (kitchen tickets, reports)
+	Location *time.Location
+
 	// Database
 	DatabaseURL string
 
@@ -27,6 +33,107 @@ type Config struct {
 	// JWT settings
 	JWTSecret     string
 	JWTExpiration int // hours
+
+	// Order settings
+	Order OrderConfig
+
+	// TableQRSecret signs the QR codes on dining tables
+	TableQRSecret string
+
+	// Tiffin subscription scheduling
+	Subscription SubscriptionConfig
+
+	// Domain event delivery
+	Outbox OutboxConfig
+
+	// SMS, email and push notifications
+	Notification NotificationConfig
+
+	// CSV and XLSX report exports
+	Export ExportConfig
+
+	// Tally accounting exports
+	Tally TallyConfig
+
+	// Nightly order and payment consistency checks
+	Integrity IntegrityConfig
+
+	// Daily stock counts of menu items
+	Stock StockConfig
+}
+
+// StockConfig holds when daily stock counts are reset and how long an unpaid
+// order holds the stock it reserved
+type StockConfig struct {
+	ResetHour int           // Hour of the business day stock counts go back to their daily stock
+	Hold      time.Duration // Stock of an order still unpaid after this is released
+}
+
+// IntegrityConfig holds when the nightly consistency checks run and how far
+// back they look
+type IntegrityConfig struct {
+	CheckHour int           // Hour of the business day the nightly run starts
+	Lookback  time.Duration // Orders and webhooks older than this are not checked
+}
+
+// TallyConfig maps the accounts of sales, refunds and gateway fees to the
+// ledgers of the company books in Tally
+type TallyConfig struct {
+	Company string // Company to import into; empty uses the one open in Tally
+	Ledgers string // Overrides of the ledger per role, e.g. "sales=Food Sales;party=Razorpay Clearing"
+}
+
+// ExportConfig holds where background exports are written and when exports
+// run in the background instead of streaming
+type ExportConfig struct {
+	Dir         string        // Finished files; must be shared storage when running several instances
+	SyncMaxRows int64         // Larger exports run as background jobs
+	Retention   time.Duration // Finished files are deleted after this
+}
+
+// NotificationConfig selects and configures the notification providers.
+// Each channel uses "dev" (write to DevOutput), its live provider, or "none".
+type NotificationConfig struct {
+	SMSProvider   string // dev, twilio or none
+	EmailProvider string // dev, smtp or none
+	PushProvider  string // dev, fcm or none
+	DevOutput     string // File the dev provider appends to, or stdout
+
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFrom       string // Sender number or messaging service SID
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	FCMCredentialsFile string // Service account key JSON
+
+	Rules       string // Overrides of the channels per event, e.g. "delivered=push;refund=sms,email"
+	MaxAttempts int    // Attempts per message before giving up
+}
+
+// OutboxConfig holds how domain events are relayed from the outbox table
+type OutboxConfig struct {
+	PollInterval time.Duration // How often the relay looks for new events
+	BatchSize    int           // Events delivered per consumer and poll
+	StreamMaxLen int64         // Approximate length the Redis stream is trimmed to; 0 disables the stream
+	Retention    time.Duration // Events older than this are deleted once every consumer has handled them
+	MaxAttempts  int           // Failures before a subscriber skips an event as a dead letter
+}
+
+// SubscriptionConfig holds when the day's tiffin orders are placed
+type SubscriptionConfig struct {
+	KitchenCutoff time.Duration // Time of day the kitchen needs the day's tiffins by
+	OrderLead     time.Duration // Orders are materialised this long before the cutoff; changes close then
+}
+
+// OrderConfig holds order pricing settings
+type OrderConfig struct {
+	DeliveryFee int64 // Flat delivery fee in paisa, not charged for pickup
+	TaxRate     int64 // GST included in menu prices, in basis points (500 = 5%)
 }
 
 // RazorpayConfig holds Razorpay API credentials
@@ -46,6 +153,12 @@ func Load() (*Config, error) {
 	cfg.Environment = getEnv("ENVIRONMENT", "development")
 	cfg.AllowedOrigins = getEnv("ALLOWED_ORIGINS", "*")
 
+	location, err := time.LoadLocation(getEnv("TIMEZONE", "Asia/Kolkata"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIMEZONE: %w", err)
+	}
+	cfg.Location = location
+
 	// Database - required
 	cfg.DatabaseURL = os.Getenv("DATABASE_URL")
 	if cfg.DatabaseURL == "" {
@@ -74,9 +187,94 @@ func Load() (*Config, error) {
 	}
 	cfg.JWTExpiration = getEnvInt("JWT_EXPIRATION_HOURS", 24)
 
+	cfg.Order.DeliveryFee = int64(getEnvInt("DELIVERY_FEE", 0))
+	if cfg.Order.DeliveryFee < 0 {
+		return nil, fmt.Errorf("DELIVERY_FEE must not be negative")
+	}
+	cfg.Order.TaxRate = int64(getEnvInt("TAX_RATE_BPS", 500))
+	if cfg.Order.TaxRate < 0 || cfg.Order.TaxRate > 10000 {
+		return nil, fmt.Errorf("TAX_RATE_BPS must be between 0 and 10000")
+	}
+
+	// Defaults to the JWT secret; set separately so QR codes survive JWT key rotation
+	cfg.TableQRSecret = getEnv("TABLE_QR_SECRET", cfg.JWTSecret)
+
+	cutoff, err := parseTimeOfDay(getEnv("SUBSCRIPTION_KITCHEN_CUTOFF", "10:00"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SUBSCRIPTION_KITCHEN_CUTOFF: %w", err)
+	}
+	cfg.Subscription.KitchenCutoff = cutoff
+	cfg.Subscription.OrderLead = time.Duration(getEnvInt("SUBSCRIPTION_ORDER_LEAD_MINUTES", 60)) * time.Minute
+	if cfg.Subscription.OrderLead < 0 || cfg.Subscription.OrderLead > cutoff {
+		return nil, fmt.Errorf("SUBSCRIPTION_ORDER_LEAD_MINUTES must be between 0 and the kitchen cutoff")
+	}
+
+	cfg.Outbox.PollInterval = time.Duration(getEnvInt("OUTBOX_POLL_INTERVAL_MS", 1000)) * time.Millisecond
+	cfg.Outbox.BatchSize = getEnvInt("OUTBOX_BATCH_SIZE", 100)
+	cfg.Outbox.StreamMaxLen = int64(getEnvInt("OUTBOX_STREAM_MAXLEN", 100000))
+	cfg.Outbox.Retention = time.Duration(getEnvInt("OUTBOX_RETENTION_HOURS", 168)) * time.Hour
+	cfg.Outbox.MaxAttempts = getEnvInt("OUTBOX_MAX_ATTEMPTS", 20)
+	if cfg.Outbox.PollInterval <= 0 || cfg.Outbox.BatchSize <= 0 || cfg.Outbox.StreamMaxLen < 0 || cfg.Outbox.Retention <= 0 || cfg.Outbox.MaxAttempts <= 0 {
+		return nil, fmt.Errorf("OUTBOX_POLL_INTERVAL_MS, OUTBOX_BATCH_SIZE, OUTBOX_RETENTION_HOURS and OUTBOX_MAX_ATTEMPTS must be positive, OUTBOX_STREAM_MAXLEN not negative")
+	}
+
+	cfg.Notification = NotificationConfig{
+		SMSProvider:        getEnv("NOTIFY_SMS_PROVIDER", "dev"),
+		EmailProvider:      getEnv("NOTIFY_EMAIL_PROVIDER", "dev"),
+		PushProvider:       getEnv("NOTIFY_PUSH_PROVIDER", "dev"),
+		DevOutput:          getEnv("NOTIFY_DEV_OUTPUT", "stdout"),
+		TwilioAccountSID:   os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:    os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioFrom:         os.Getenv("TWILIO_FROM"),
+		SMTPHost:           os.Getenv("SMTP_HOST"),
+		SMTPPort:           getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:           os.Getenv("SMTP_FROM"),
+		FCMCredentialsFile: os.Getenv("FCM_CREDENTIALS_FILE"),
+		Rules:              os.Getenv("NOTIFY_RULES"),
+		MaxAttempts:        getEnvInt("NOTIFY_MAX_ATTEMPTS", 6),
+	}
+	if cfg.Notification.MaxAttempts < 1 {
+		return nil, fmt.Errorf("NOTIFY_MAX_ATTEMPTS must be at least 1")
+	}
+
+	cfg.Export.Dir = getEnv("EXPORT_DIR", filepath.Join(os.TempDir(), "fooddelivery-exports"))
+	cfg.Export.SyncMaxRows = int64(getEnvInt("EXPORT_SYNC_MAX_ROWS", 20000))
+	cfg.Export.Retention = time.Duration(getEnvInt("EXPORT_RETENTION_HOURS", 24)) * time.Hour
+	if cfg.Export.SyncMaxRows < 0 || cfg.Export.Retention <= 0 {
+		return nil, fmt.Errorf("EXPORT_SYNC_MAX_ROWS must not be negative and EXPORT_RETENTION_HOURS must be positive")
+	}
+
+	cfg.Tally = TallyConfig{
+		Company: os.Getenv("TALLY_COMPANY"),
+		Ledgers: os.Getenv("TALLY_LEDGERS"),
+	}
+
+	cfg.Integrity.CheckHour = getEnvInt("INTEGRITY_CHECK_HOUR", 3)
+	cfg.Integrity.Lookback = time.Duration(getEnvInt("INTEGRITY_LOOKBACK_DAYS", 30)) * 24 * time.Hour
+	if cfg.Integrity.CheckHour < 0 || cfg.Integrity.CheckHour > 23 || cfg.Integrity.Lookback <= 0 {
+		return nil, fmt.Errorf("INTEGRITY_CHECK_HOUR must be between 0 and 23 and INTEGRITY_LOOKBACK_DAYS must be positive")
+	}
+
+	cfg.Stock.ResetHour = getEnvInt("STOCK_RESET_HOUR", 5)
+	cfg.Stock.Hold = time.Duration(getEnvInt("STOCK_HOLD_MINUTES", 15)) * time.Minute
+	if cfg.Stock.ResetHour < 0 || cfg.Stock.ResetHour > 23 || cfg.Stock.Hold <= 0 {
+		return nil, fmt.Errorf("STOCK_RESET_HOUR must be between 0 and 23 and STOCK_HOLD_MINUTES must be positive")
+	}
+
 	return cfg, nil
 }
 
+// parseTimeOfDay parses HH:MM into the time since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
 // getEnv returns environment variable value or default
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
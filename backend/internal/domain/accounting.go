@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// LedgerRole is what a Tally ledger is used for in accounting exports
+type LedgerRole string
+
+const (
+	LedgerParty       LedgerRole = "party"        // Where customer payments land, e.g. the Razorpay account
+	LedgerSales       LedgerRole = "sales"        // Food sales, net of GST
+	LedgerDelivery    LedgerRole = "delivery"     // Delivery charges, net of GST; empty books them as sales
+	LedgerCGST        LedgerRole = "cgst"         // Output CGST
+	LedgerSGST        LedgerRole = "sgst"         // Output SGST
+	LedgerGatewayFees LedgerRole = "gateway_fees" // Payment gateway charges, net of GST
+	LedgerGatewayTax  LedgerRole = "gateway_tax"  // GST charged on gateway fees (input credit)
+)
+
+// DailyAmount totals one kind of money movement over one day in the
+// business timezone. Amounts are in paisa.
+type DailyAmount struct {
+	Day    time.Time // Local midnight
+	Count  int64     // Orders, refunds or payments
+	Amount int64
+	Fees   int64 // Delivery fees of sales
+	Tax    int64 // GST the gateway charged on its fees
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsInterval is the bucket size of a revenue series
+type AnalyticsInterval string
+
+const (
+	IntervalDay   AnalyticsInterval = "day"
+	IntervalWeek  AnalyticsInterval = "week" // Weeks start on Monday
+	IntervalMonth AnalyticsInterval = "month"
+)
+
+// IsValid checks if the interval is a known value
+func (i AnalyticsInterval) IsValid() bool {
+	return i == IntervalDay || i == IntervalWeek || i == IntervalMonth
+}
+
+// SalesSummary sums up a date range for the admin dashboard.
+// Amounts are in paisa; rates are fractions between 0 and 1.
+type SalesSummary struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"` // Exclusive
+
+	// Orders placed in the range, by current status
+	Orders       int64                 `json:"orders"`
+	StatusCounts map[OrderStatus]int64 `json:"status_counts"`
+
+	// Orders paid in the range
+	PaidOrders        int64 `json:"paid_orders"`
+	Revenue           int64 `json:"revenue"`
+	Refunds           int64 `json:"refunds"` // Refunds of paid sales processed in the range
+	NetRevenue        int64 `json:"net_revenue"`
+	AverageOrderValue int64 `json:"average_order_value"`
+
+	// Customers with a paid order in the range; repeat customers have at
+	// least one other paid order up to the end of the range
+	Customers          int64   `json:"customers"`
+	RepeatCustomers    int64   `json:"repeat_customers"`
+	RepeatCustomerRate float64 `json:"repeat_customer_rate"`
+
+	// Gateway payment attempts in the range, from Razorpay webhooks
+	PaymentsCaptured   int64   `json:"payments_captured"`
+	PaymentsFailed     int64   `json:"payments_failed"`
+	PaymentFailureRate float64 `json:"payment_failure_rate"`
+}
+
+// RevenuePoint is one bucket of a revenue series
+type RevenuePoint struct {
+	Start             time.Time `json:"start"` // Midnight starting the bucket, in the business timezone
+	Orders            int64     `json:"orders"`
+	Revenue           int64     `json:"revenue"`
+	Refunds           int64     `json:"refunds"`
+	NetRevenue        int64     `json:"net_revenue"`
+	AverageOrderValue int64     `json:"average_order_value"`
+}
+
+// ItemSales is what one menu item sold in paid orders
+type ItemSales struct {
+	MenuItemID uuid.UUID `json:"menu_item_id"`
+	Name       string    `json:"name"`
+	Category   string    `json:"category"`
+	Quantity   int64     `json:"quantity"`
+	Revenue    int64     `json:"revenue"`
+	Orders     int64     `json:"orders"`
+}
+
+// CategorySales is what one menu category sold in paid orders
+type CategorySales struct {
+	Category string `json:"category"`
+	Quantity int64  `json:"quantity"`
+	Revenue  int64  `json:"revenue"`
+	Orders   int64  `json:"orders"`
+}
+
+// HeatmapCell counts paid orders placed in one hour of one weekday
+type HeatmapCell struct {
+	Weekday int   `json:"weekday"` // 1 = Monday ... 7 = Sunday
+	Hour    int   `json:"hour"`    // 0-23, in the business timezone
+	Orders  int64 `json:"orders"`
+	Revenue int64 `json:"revenue"`
+}
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BillSourceType is what a split bill settles
+type BillSourceType string
+
+const (
+	BillSourceTableSession BillSourceType = "table_session"
+	BillSourceOrder        BillSourceType = "order"
+)
+
+// SplitMode is how a bill is divided between guests
+type SplitMode string
+
+const (
+	SplitEqual   SplitMode = "equal"  // N equal shares, remainder paisa on the first shares
+	SplitByItems SplitMode = "items"  // Each share pays for the items assigned to it
+	SplitCustom  SplitMode = "custom" // Amounts chosen by the guests, must add up to the total
+)
+
+// BillStatus is the state of a split bill.
+// State transitions: OPEN -> PAID, or OPEN -> VOIDED (paid shares are refunded)
+type BillStatus string
+
+const (
+	BillOpen   BillStatus = "OPEN"
+	BillPaid   BillStatus = "PAID"
+	BillVoided BillStatus = "VOIDED"
+)
+
+// BillShareStatus is the state of one share of a split bill
+type BillShareStatus string
+
+const (
+	ShareStatusPending       BillShareStatus = "PENDING"
+	ShareStatusPaid          BillShareStatus = "PAID"
+	ShareStatusFailed        BillShareStatus = "FAILED" // Last attempt failed, can be paid again
+	ShareStatusRefundPending BillShareStatus = "REFUND_PENDING"
+	ShareStatusRefunded      BillShareStatus = "REFUNDED"
+	ShareStatusCancelled     BillShareStatus = "CANCELLED" // Bill voided before this share was paid
+)
+
+// MaxBillShares caps how many ways a bill can be split
+const MaxBillShares = 20
+
+// Bill is one logical bill settled in several separately paid shares.
+// The underlying tab or order is only marked paid once every share is captured.
+type Bill struct {
+	ID          uuid.UUID      `json:"id"`
+	SourceType  BillSourceType `json:"source_type"`
+	SourceID    uuid.UUID      `json:"source_id"`
+	Mode        SplitMode      `json:"mode"`
+	TotalAmount int64          `json:"total_amount"` // Paisa
+	Status      BillStatus     `json:"status"`
+	CreatedBy   uuid.UUID      `json:"created_by"`
+	Version     int            `json:"version"`
+	Shares      []BillShare    `json:"shares"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	PaidAt      *time.Time     `json:"paid_at,omitempty"`
+	VoidedAt    *time.Time     `json:"voided_at,omitempty"`
+}
+
+// BillShare is one guest's part of a split bill
+type BillShare struct {
+	ID                uuid.UUID       `json:"id"`
+	BillID            uuid.UUID       `json:"bill_id"`
+	Position          int             `json:"position"`
+	Label             string          `json:"label,omitempty"` // e.g. guest name
+	Amount            int64           `json:"amount"`          // Paisa
+	Status            BillShareStatus `json:"status"`
+	RazorpayOrderID   string          `json:"razorpay_order_id,omitempty"`
+	RazorpayPaymentID string          `json:"razorpay_payment_id,omitempty"`
+	Items             []BillShareItem `json:"items,omitempty"` // Split by items only
+	PaidAt            *time.Time      `json:"paid_at,omitempty"`
+	RefundedAt        *time.Time      `json:"refunded_at,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// IsSettled reports whether the share no longer needs a payment
+func (s *BillShare) IsSettled() bool {
+	return s.Status != ShareStatusPending && s.Status != ShareStatusFailed
+}
+
+// BillShareItem is (part of) an order line paid for by a share
+type BillShareItem struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Name        string    `json:"name"`
+	Quantity    int       `json:"quantity"`
+	Amount      int64     `json:"amount"` // Paisa
+}
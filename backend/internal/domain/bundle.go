@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BundleSlot is one part of a bundle menu item, such as "Starter" or
+// "Drink". A slot with a single option is fixed; with several the customer
+// chooses one of them.
+type BundleSlot struct {
+	ID        uuid.UUID          `json:"id"`
+	BundleID  uuid.UUID          `json:"bundle_id"`
+	Name      string             `json:"name"`
+	Quantity  int                `json:"quantity"` // Units of the chosen item per bundle
+	SortOrder int                `json:"sort_order"`
+	Options   []BundleSlotOption `json:"options"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// IsFixed reports whether the slot needs no choice
+func (s *BundleSlot) IsFixed() bool {
+	return len(s.Options) == 1
+}
+
+// Option returns the option of the slot with the given ID, or nil
+func (s *BundleSlot) Option(id uuid.UUID) *BundleSlotOption {
+	for i := range s.Options {
+		if s.Options[i].ID == id {
+			return &s.Options[i]
+		}
+	}
+	return nil
+}
+
+// BundleSlotOption is a menu item, optionally at one of its variants, that
+// can fill a bundle slot. Name and IsAvailable reflect the current menu.
+type BundleSlotOption struct {
+	ID          uuid.UUID  `json:"id"`
+	SlotID      uuid.UUID  `json:"slot_id"`
+	MenuItemID  uuid.UUID  `json:"menu_item_id"`
+	VariantID   *uuid.UUID `json:"variant_id,omitempty"`
+	Name        string     `json:"name"` // Item name with the variant, e.g. "Chicken Biryani (Full)"
+	IsAvailable bool       `json:"is_available"`
+	SortOrder   int        `json:"sort_order"`
+}
+
+// OrderItemComponent is an item that went into a bundle order line,
+// snapshotted at time of order
+type OrderItemComponent struct {
+	SlotID     uuid.UUID  `json:"slot_id"`
+	Slot       string     `json:"slot"`
+	OptionID   uuid.UUID  `json:"option_id"`
+	MenuItemID uuid.UUID  `json:"menu_item_id"`
+	VariantID  *uuid.UUID `json:"variant_id,omitempty"`
+	Name       string     `json:"name"`
+	Quantity   int        `json:"quantity"` // Units per bundle
+}
+
+// Bundle limits
+const (
+	MaxBundleSlotNameLength = 50
+	MaxBundleSlots          = 10 // Slots per bundle
+	MaxBundleSlotOptions    = 20 // Options per slot
+	MaxBundleSlotQuantity   = 10
+)
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CateringStatus is the state of a catering request.
+// State transitions: REQUESTED -> QUOTED (admin, may quote again) -> ACCEPTED
+// (customer); the customer can decline a quote, and a request can be
+// cancelled until a quote is accepted. Payments are tracked on the linked
+// advance and balance orders.
+type CateringStatus string
+
+const (
+	CateringRequested CateringStatus = "REQUESTED"
+	CateringQuoted    CateringStatus = "QUOTED"
+	CateringAccepted  CateringStatus = "ACCEPTED"
+	CateringDeclined  CateringStatus = "DECLINED"
+	CateringCancelled CateringStatus = "CANCELLED"
+)
+
+// IsValid checks if the catering status is a known value
+func (s CateringStatus) IsValid() bool {
+	switch s {
+	case CateringRequested, CateringQuoted, CateringAccepted, CateringDeclined, CateringCancelled:
+		return true
+	}
+	return false
+}
+
+// CateringPayment summarises what has been paid on an accepted request
+type CateringPayment string
+
+const (
+	CateringUnpaid      CateringPayment = "UNPAID"
+	CateringAdvancePaid CateringPayment = "ADVANCE_PAID"
+	CateringFullyPaid   CateringPayment = "PAID"
+)
+
+// Catering limits
+const (
+	MinCateringHeadcount   = 20
+	MaxCateringHeadcount   = 5000
+	MaxCateringQuantity    = 10000              // Per line
+	CateringLeadDays       = 2                  // Earliest event date, in days from today
+	CateringQuoteValidity  = 7 * 24 * time.Hour // Default validity of a quote
+	DefaultCateringAdvance = 50                 // Percent
+)
+
+// CateringRequest is an event order quoted by hand instead of going through the cart
+type CateringRequest struct {
+	ID        uuid.UUID      `json:"id"`
+	UserID    uuid.UUID      `json:"user_id"`
+	EventDate string         `json:"event_date"` // YYYY-MM-DD in the business timezone
+	Headcount int            `json:"headcount"`
+	Venue     string         `json:"venue"`
+	Notes     string         `json:"notes,omitempty"`
+	Items     []OrderItem    `json:"items"` // Requested, at menu prices
+	Status    CateringStatus `json:"status"`
+
+	QuoteLines      []OrderItem `json:"quote_lines,omitempty"` // Quoted, prices may be overridden
+	QuoteTotal      int64       `json:"quote_total,omitempty"` // Paisa
+	AdvancePercent  int         `json:"advance_percent,omitempty"`
+	AdvanceAmount   int64       `json:"advance_amount,omitempty"` // Paisa, due on acceptance
+	QuoteNote       string      `json:"quote_note,omitempty"`
+	QuoteValidUntil *time.Time  `json:"quote_valid_until,omitempty"`
+	QuotedBy        *uuid.UUID  `json:"quoted_by,omitempty"`
+	QuotedAt        *time.Time  `json:"quoted_at,omitempty"`
+	AcceptedAt      *time.Time  `json:"accepted_at,omitempty"`
+
+	AdvanceOrderID *uuid.UUID      `json:"advance_order_id,omitempty"`
+	BalanceOrderID *uuid.UUID      `json:"balance_order_id,omitempty"`
+	Payment        CateringPayment `json:"payment,omitempty"` // Accepted requests only
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BalanceAmount is what remains due after the advance
+func (r *CateringRequest) BalanceAmount() int64 {
+	return r.QuoteTotal - r.AdvanceAmount
+}
+
+// AdvanceFor returns the advance for a quote total, rounded up to the paisa
+func AdvanceFor(total int64, percent int) int64 {
+	return (total*int64(percent) + 99) / 100
+}
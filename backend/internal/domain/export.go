@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportKind is which report an export contains
+type ExportKind string
+
+const (
+	ExportOrders   ExportKind = "orders"   // One row per order line, with payment IDs
+	ExportItems    ExportKind = "items"    // Item-wise sales per day
+	ExportPayments ExportKind = "payments" // Razorpay webhook and payment log
+)
+
+// IsValid checks if the kind is a known report
+func (k ExportKind) IsValid() bool {
+	return k == ExportOrders || k == ExportItems || k == ExportPayments
+}
+
+// ExportJobStatus is the state of a background export
+type ExportJobStatus string
+
+const (
+	ExportPending ExportJobStatus = "PENDING"
+	ExportRunning ExportJobStatus = "RUNNING"
+	ExportDone    ExportJobStatus = "DONE"
+	ExportFailed  ExportJobStatus = "FAILED"
+)
+
+// ExportJob is a report too large to stream in the request, written to a
+// file in the background and downloaded when done
+type ExportJob struct {
+	ID          uuid.UUID       `json:"id"`
+	RequestedBy uuid.UUID       `json:"requested_by"`
+	Kind        ExportKind      `json:"kind"`
+	Format      string          `json:"format"` // csv or xlsx
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"` // Exclusive
+	Status      ExportJobStatus `json:"status"`
+	Rows        int64           `json:"rows"`
+	Size        int64           `json:"size"` // Bytes
+	Error       string          `json:"error,omitempty"`
+	FileName    string          `json:"file_name"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"` // The file is deleted after this
+	FilePath    string          `json:"-"`
+}
+
+// OrderExportLine is one order line of the orders export. Orders without
+// items, such as catering payments, have one line with an empty item.
+type OrderExportLine struct {
+	OrderID           uuid.UUID
+	CreatedAt         time.Time
+	PaidAt            *time.Time
+	Status            OrderStatus
+	FulfillmentType   FulfillmentType
+	CustomerName      string
+	CustomerPhone     string
+	CustomerEmail     string
+	RazorpayOrderID   string
+	RazorpayPaymentID string
+	TotalAmount       int64
+	DeliveryFee       int64
+	ItemName          string
+	Quantity          int64
+	UnitPrice         int64
+}
+
+// ItemSalesExportRow is what one menu item sold on one day
+type ItemSalesExportRow struct {
+	Day        time.Time // Local midnight
+	MenuItemID uuid.UUID
+	Name       string
+	Category   string
+	Quantity   int64
+	Revenue    int64
+	Orders     int64
+}
+
+// PaymentLogExportRow is one logged payment webhook
+type PaymentLogExportRow struct {
+	ReceivedAt        time.Time
+	Source            string
+	EventType         string
+	RazorpayPaymentID string
+	RazorpayOrderID   string
+	Amount            int64
+	Method            string
+	PaymentStatus     string
+	ErrorCode         string
+	ErrorDescription  string
+	SignatureValid    bool
+	Processed         bool
+	ProcessingError   string
+	OrderID           *uuid.UUID
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GroupCartStatus is the state of a shared group cart.
+// State transitions: OPEN <-> LOCKED -> CHECKED_OUT, or OPEN/LOCKED -> CANCELLED
+type GroupCartStatus string
+
+const (
+	GroupCartOpen       GroupCartStatus = "OPEN"        // Members can add items
+	GroupCartLocked     GroupCartStatus = "LOCKED"      // Host is reviewing, no more changes
+	GroupCartCheckedOut GroupCartStatus = "CHECKED_OUT" // Order placed
+	GroupCartCancelled  GroupCartStatus = "CANCELLED"
+)
+
+// Group cart limits
+const (
+	MaxGroupCartMembers = 25
+	MaxGroupCartLines   = 100
+	GroupCartTTL        = 24 * time.Hour
+)
+
+// GroupCart is a cart shared through an invite link. Members add their own
+// items; the host locks the cart and checks out on behalf of everyone.
+type GroupCart struct {
+	ID         uuid.UUID         `json:"id"`
+	HostID     uuid.UUID         `json:"host_id"`
+	InviteCode string            `json:"invite_code"`
+	Status     GroupCartStatus   `json:"status"`
+	Notes      string            `json:"notes,omitempty"`
+	OrderID    *uuid.UUID        `json:"order_id,omitempty"`
+	Version    int               `json:"version"`
+	Members    []GroupCartMember `json:"members"`
+	Items      []GroupCartItem   `json:"items"`
+	Breakdown  []MemberBreakdown `json:"breakdown"` // Per member, at current prices until checked out
+	Subtotal   int64             `json:"subtotal"`  // Paisa
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	LockedAt   *time.Time        `json:"locked_at,omitempty"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+}
+
+// IsMember reports whether the user has joined the cart
+func (c *GroupCart) IsMember(userID uuid.UUID) bool {
+	for _, member := range c.Members {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupCartMember is a user who joined a group cart
+type GroupCartMember struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Name     string    `json:"name"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// GroupCartItem is a cart line added by one member.
+// Name, Price, Modifiers and IsAvailable reflect the current menu.
+type GroupCartItem struct {
+	ID            uuid.UUID               `json:"id"`
+	UserID        uuid.UUID               `json:"user_id"`
+	MenuItemID    uuid.UUID               `json:"menu_item_id"`
+	Name          string                  `json:"name"`
+	VariantID     *uuid.UUID              `json:"variant_id,omitempty"`
+	VariantName   string                  `json:"variant_name,omitempty"`
+	ModifierIDs   []uuid.UUID             `json:"modifier_ids,omitempty"`
+	Modifiers     []string                `json:"modifiers,omitempty"`      // Names of the chosen modifier options
+	BundleChoices map[uuid.UUID]uuid.UUID `json:"bundle_choices,omitempty"` // Option chosen per bundle slot, checked at checkout
+	Price         int64                   `json:"price"`                    // Paisa, of the variant if one was chosen, with modifiers
+	IsAvailable   bool                    `json:"is_available"`
+	Quantity      int                     `json:"quantity"`
+	Notes         string                  `json:"notes,omitempty"`
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
+}
+
+// MemberBreakdown is what one member of a group order added
+type MemberBreakdown struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name,omitempty"`
+	ItemCount int       `json:"item_count"` // Total quantity across lines
+	Subtotal  int64     `json:"subtotal"`   // Paisa, before delivery fee
+}
+
+// BreakdownByMember totals order lines per member who added them, in order of
+// first appearance. Lines without a member are ignored.
+func BreakdownByMember(items []OrderItem) []MemberBreakdown {
+	var breakdown []MemberBreakdown
+	index := make(map[uuid.UUID]int)
+
+	for i := range items {
+		if items[i].AddedBy == nil {
+			continue
+		}
+		userID := *items[i].AddedBy
+
+		j, ok := index[userID]
+		if !ok {
+			j = len(breakdown)
+			index[userID] = j
+			breakdown = append(breakdown, MemberBreakdown{UserID: userID})
+		}
+		breakdown[j].ItemCount += items[i].Quantity
+		breakdown[j].Subtotal += items[i].Subtotal()
+	}
+
+	return breakdown
+}
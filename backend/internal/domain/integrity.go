@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IntegrityCheck is an invariant the consistency checker verifies
+type IntegrityCheck string
+
+const (
+	// Order total differs from its items plus delivery fee
+	CheckOrderTotal IntegrityCheck = "order_total"
+	// Paid order paid through the gateway with no captured-payment webhook
+	CheckPaidWithoutCapture IntegrityCheck = "paid_without_capture"
+	// Order status disagrees with its payment fields
+	CheckStatusPayment IntegrityCheck = "status_payment"
+	// Captured-payment webhook that belongs to nothing we sell
+	CheckOrphanedWebhook IntegrityCheck = "orphaned_webhook"
+	// Order in the same state for longer than it should be
+	CheckStuckOrder IntegrityCheck = "stuck_order"
+)
+
+// IntegrityChecks lists every check in the order they run
+var IntegrityChecks = []IntegrityCheck{
+	CheckOrderTotal,
+	CheckPaidWithoutCapture,
+	CheckStatusPayment,
+	CheckOrphanedWebhook,
+	CheckStuckOrder,
+}
+
+// IsValid checks if the check is a known value
+func (c IntegrityCheck) IsValid() bool {
+	for _, check := range IntegrityChecks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
+
+// IntegrityFinding is one violation of a check. A finding seen again by a
+// later run is the same finding; one no longer seen is resolved.
+type IntegrityFinding struct {
+	ID          uuid.UUID      `json:"id"`
+	Check       IntegrityCheck `json:"check"`
+	Subject     string         `json:"subject"` // Order ID, or payment ID for webhooks
+	OrderID     *uuid.UUID     `json:"order_id,omitempty"`
+	OrderURL    string         `json:"order_url,omitempty"`
+	Details     string         `json:"details"`
+	FirstSeenAt time.Time      `json:"first_seen_at"`
+	LastSeenAt  time.Time      `json:"last_seen_at"`
+	ResolvedAt  *time.Time     `json:"resolved_at,omitempty"`
+}
+
+// IntegrityRun is one run of the consistency checker
+type IntegrityRun struct {
+	ID         uuid.UUID  `json:"id"`
+	Scheduled  bool       `json:"scheduled"` // Nightly run, not started by an admin
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Findings   int64      `json:"findings"` // Open after the run
+	New        int64      `json:"new"`
+	Resolved   int64      `json:"resolved"`
+	Error      string     `json:"error,omitempty"` // Checks that failed
+}
@@ -9,7 +9,10 @@ import (
 )
 
 // OrderStatus represents the state machine for order lifecycle.
-// State transitions: PENDING -> AWAITING_PAYMENT -> PAID/PAYMENT_FAILED -> ACCEPTED -> DELIVERED
+// State transitions: PENDING -> AWAITING_PAYMENT -> PAID/PAYMENT_FAILED -> ACCEPTED -> (OUT_FOR_DELIVERY ->) DELIVERED
+// Pickup orders finish with ACCEPTED -> READY_FOR_PICKUP -> COLLECTED instead.
+// Dine-in rounds skip payment: ON_TAB -> ACCEPTED -> DELIVERED, and are paid
+// together when the table tab is settled.
 type OrderStatus string
 
 const (
@@ -18,9 +21,42 @@ const (
 	OrderStatusPaymentFailed  OrderStatus = "PAYMENT_FAILED"
 	OrderStatusPaid           OrderStatus = "PAID"
 	OrderStatusAccepted       OrderStatus = "ACCEPTED"
+	OrderStatusOutForDelivery OrderStatus = "OUT_FOR_DELIVERY"
 	OrderStatusDelivered      OrderStatus = "DELIVERED"
+	OrderStatusReadyForPickup OrderStatus = "READY_FOR_PICKUP"
+	OrderStatusCollected      OrderStatus = "COLLECTED"
+	OrderStatusOnTab          OrderStatus = "ON_TAB" // Dine-in round, paid when the tab is settled
 )
 
+// IsPaid reports whether the order has been paid for (payment captured,
+// whatever happened to it afterwards)
+func (s OrderStatus) IsPaid() bool {
+	switch s {
+	case OrderStatusPaid, OrderStatusAccepted, OrderStatusOutForDelivery, OrderStatusDelivered,
+		OrderStatusReadyForPickup, OrderStatusCollected:
+		return true
+	}
+	return false
+}
+
+// FulfillmentType is how an order reaches the customer
+type FulfillmentType string
+
+const (
+	FulfillmentDelivery FulfillmentType = "delivery"
+	FulfillmentPickup   FulfillmentType = "pickup" // Customer collects at the counter with a pickup code
+	FulfillmentDineIn   FulfillmentType = "dine_in"
+)
+
+// IsValid reports whether the fulfillment type is known
+func (f FulfillmentType) IsValid() bool {
+	switch f {
+	case FulfillmentDelivery, FulfillmentPickup, FulfillmentDineIn:
+		return true
+	}
+	return false
+}
+
 // User represents a registered user in the system
 type User struct {
 	ID            uuid.UUID  `json:"id"`
@@ -30,6 +66,7 @@ type User struct {
 	PasswordHash  string     `json:"-"` // Never expose password hash in JSON
 	EmailVerified bool       `json:"email_verified"`
 	IsAdmin       bool       `json:"is_admin"`
+	Language      Language   `json:"language"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
@@ -84,8 +121,26 @@ type MenuItem struct {
 	Category    string    `json:"category"`
 	ImageURL    string    `json:"image_url,omitempty"`
 	IsAvailable bool      `json:"is_available"`
+	Rating      float64   `json:"rating"`       // Average item rating, one decimal; 0 when unrated
+	RatingCount int       `json:"rating_count"` // Number of ratings counted in Rating
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Sizes or portions; when there are any, one must be chosen and its
+	// price is charged instead of Price
+	Variants []MenuVariant `json:"variants,omitempty"`
+
+	// Add-ons and choices offered with the item, in display order
+	ModifierGroups []ModifierGroup `json:"modifier_groups,omitempty"`
+
+	// Slots of a bundle, in display order; an item with slots is a combo
+	// sold at Price with one option of every slot
+	BundleSlots []BundleSlot `json:"bundle_slots,omitempty"`
+}
+
+// IsBundle reports whether the item is a combo of other items
+func (m *MenuItem) IsBundle() bool {
+	return len(m.BundleSlots) > 0
 }
 
 // PriceInRupees returns the price formatted in rupees for display
@@ -93,19 +148,61 @@ func (m *MenuItem) PriceInRupees() float64 {
 	return float64(m.Price) / 100.0
 }
 
+// Variant returns the item's variant with the given ID, or nil
+func (m *MenuItem) Variant(id uuid.UUID) *MenuVariant {
+	for i := range m.Variants {
+		if m.Variants[i].ID == id {
+			return &m.Variants[i]
+		}
+	}
+	return nil
+}
+
+// MenuVariant is a size or portion of a menu item, such as a half or full
+// plate, with its own price and availability
+type MenuVariant struct {
+	ID          uuid.UUID `json:"id"`
+	MenuItemID  uuid.UUID `json:"menu_item_id"`
+	Name        string    `json:"name"`  // e.g. "Half", "Full", "500 ml"
+	Price       int64     `json:"price"` // Paisa
+	IsAvailable bool      `json:"is_available"`
+	SortOrder   int       `json:"sort_order"` // Position among the item's variants
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MaxVariantNameLength caps variant names (in characters)
+const MaxVariantNameLength = 50
+
 // Order represents a customer order with payment tracking.
 // Version field enables optimistic locking to prevent race conditions.
 type Order struct {
-	ID                uuid.UUID   `json:"id"`
-	UserID            uuid.UUID   `json:"user_id"`
-	Status            OrderStatus `json:"status"`
-	TotalAmount       int64       `json:"total_amount"` // Amount in paisa
-	RazorpayOrderID   string      `json:"razorpay_order_id,omitempty"`
-	RazorpayPaymentID string      `json:"razorpay_payment_id,omitempty"`
-	Version           int         `json:"version"` // For optimistic locking
-	Items             []OrderItem `json:"items"`
-	CreatedAt         time.Time   `json:"created_at"`
-	UpdatedAt         time.Time   `json:"updated_at"`
+	ID                uuid.UUID       `json:"id"`
+	UserID            uuid.UUID       `json:"user_id"`
+	Status            OrderStatus     `json:"status"`
+	TotalAmount       int64           `json:"total_amount"` // Amount in paisa, including DeliveryFee
+	FulfillmentType   FulfillmentType `json:"fulfillment_type"`
+	DeliveryAddress   string          `json:"delivery_address,omitempty"`
+	DeliveryFee       int64           `json:"delivery_fee"`          // Paisa, 0 for pickup and dine-in
+	PickupCode        string          `json:"pickup_code,omitempty"` // Shown to the customer for pickup orders
+	RazorpayOrderID   string          `json:"razorpay_order_id,omitempty"`
+	RazorpayPaymentID string          `json:"razorpay_payment_id,omitempty"`
+	TableSessionID    *uuid.UUID      `json:"table_session_id,omitempty"` // Dine-in tab this round belongs to
+	CateringRequestID *uuid.UUID      `json:"catering_request_id,omitempty"`
+	SubscriptionID    *uuid.UUID      `json:"subscription_id,omitempty"` // Tiffin meal, prepaid by the subscription
+	Notes             string          `json:"notes,omitempty"`           // Special instructions for the whole order
+	Version           int             `json:"version"`                   // For optimistic locking
+	PaidAt            *time.Time      `json:"paid_at,omitempty"`
+	Items             []OrderItem     `json:"items"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+
+	// Orders placed from a group cart: what each member added
+	MemberBreakdown []MemberBreakdown `json:"member_breakdown,omitempty"`
+
+	// Summary listings carry these instead of Items
+	ItemCount   int    `json:"item_count,omitempty"`   // Total quantity across lines
+	ItemPreview string `json:"item_preview,omitempty"` // e.g. "2 x Idli, 1 x Tea"
 }
 
 // TotalInRupees returns the total amount formatted in rupees
@@ -115,13 +212,19 @@ func (o *Order) TotalInRupees() float64 {
 
 // OrderItem represents a line item in an order
 type OrderItem struct {
-	ID         uuid.UUID `json:"id"`
-	OrderID    uuid.UUID `json:"order_id"`
-	MenuItemID uuid.UUID `json:"menu_item_id"`
-	Name       string    `json:"name"`
-	Price      int64     `json:"price"`    // Price at time of order (in paisa)
-	Quantity   int       `json:"quantity"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID          uuid.UUID            `json:"id"`
+	OrderID     uuid.UUID            `json:"order_id"`
+	MenuItemID  uuid.UUID            `json:"menu_item_id"`
+	Name        string               `json:"name"`
+	VariantID   *uuid.UUID           `json:"variant_id,omitempty"`
+	VariantName string               `json:"variant_name,omitempty"` // Variant chosen, at time of order
+	Price       int64                `json:"price"`                  // Unit price at time of order (in paisa): the item's or variant's plus Modifiers
+	Quantity    int                  `json:"quantity"`
+	Modifiers   []OrderItemModifier  `json:"modifiers,omitempty"`  // Add-ons and choices, for the kitchen
+	Components  []OrderItemComponent `json:"components,omitempty"` // Items that make up a bundle, for the kitchen
+	Notes       string               `json:"notes,omitempty"`      // Special instructions for this line
+	AddedBy     *uuid.UUID           `json:"added_by,omitempty"`   // Group cart member who added the line
+	CreatedAt   time.Time            `json:"created_at"`
 }
 
 // Subtotal returns the line item subtotal in paisa
@@ -129,14 +232,49 @@ func (oi *OrderItem) Subtotal() int64 {
 	return oi.Price * int64(oi.Quantity)
 }
 
-// CartItem represents an item in the user's cart (before order creation)
+// DisplayName returns the item name with the chosen variant, e.g.
+// "Chicken Biryani (Half)"
+func (oi *OrderItem) DisplayName() string {
+	if oi.VariantName == "" {
+		return oi.Name
+	}
+	return oi.Name + " (" + oi.VariantName + ")"
+}
+
+// Limits for free-text special instructions and addresses (in characters)
+const (
+	MaxOrderNotesLength      = 500
+	MaxItemNotesLength       = 200
+	MaxDeliveryAddressLength = 500
+)
+
+// CartItem represents an item in the user's cart (before order creation).
+// The same menu item may appear on several lines with different notes.
 type CartItem struct {
-	MenuItemID uuid.UUID `json:"menu_item_id"`
-	Quantity   int       `json:"quantity"`
+	MenuItemID    uuid.UUID               `json:"menu_item_id"`
+	VariantID     *uuid.UUID              `json:"variant_id,omitempty"`     // Required when the item has variants
+	ModifierIDs   []uuid.UUID             `json:"modifier_ids,omitempty"`   // Modifier options chosen
+	BundleChoices map[uuid.UUID]uuid.UUID `json:"bundle_choices,omitempty"` // Option chosen per bundle slot; fixed slots may be left out
+	Quantity      int                     `json:"quantity"`
+	Notes         string                  `json:"notes,omitempty"` // e.g. "less spicy, no onion"
+	AddedBy       *uuid.UUID              `json:"-"`               // Set server-side for group cart lines
 }
 
-// Cart represents the user's shopping cart
+// Cart represents the user's shopping cart, stored server-side so every
+// device the user is signed in on sees the same cart
 type Cart struct {
-	UserID uuid.UUID  `json:"user_id"`
-	Items  []CartItem `json:"items"`
-}
\ No newline at end of file
+	UserID    uuid.UUID  `json:"user_id"`
+	Items     []CartLine `json:"items"`
+	Version   int        `json:"version"` // Bumped on every change
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// CartLine is a stored cart item with a stable ID for updates and removal
+type CartLine struct {
+	ID uuid.UUID `json:"id"`
+	CartItem
+	Name string `json:"name"` // Menu name when added, for display if the item goes off the menu
+}
+
+// MaxCartLines caps how many lines a stored cart can hold
+const MaxCartLines = 50
\ No newline at end of file
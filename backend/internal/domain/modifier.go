@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ModifierGroup is a set of add-ons or choices offered with a menu item,
+// such as "Extras" or "Choice of bread". Customers pick between MinSelect
+// and MaxSelect of its options; a group with a minimum is required.
+type ModifierGroup struct {
+	ID         uuid.UUID        `json:"id"`
+	MenuItemID uuid.UUID        `json:"menu_item_id"`
+	Name       string           `json:"name"`
+	MinSelect  int              `json:"min_select"`
+	MaxSelect  int              `json:"max_select"`
+	Required   bool             `json:"required"` // MinSelect > 0
+	SortOrder  int              `json:"sort_order"`
+	Options    []ModifierOption `json:"options"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// ModifierOption is one choice in a modifier group, such as "Extra raita".
+// Its price is added to the item's for every unit ordered.
+type ModifierOption struct {
+	ID          uuid.UUID `json:"id"`
+	GroupID     uuid.UUID `json:"group_id"`
+	Name        string    `json:"name"`
+	Price       int64     `json:"price"` // Paisa, 0 for a free choice
+	IsAvailable bool      `json:"is_available"`
+	SortOrder   int       `json:"sort_order"`
+}
+
+// OrderItemModifier is a modifier option chosen for an order line,
+// snapshotted at time of order
+type OrderItemModifier struct {
+	OptionID uuid.UUID `json:"option_id"`
+	Group    string    `json:"group"`
+	Name     string    `json:"name"`
+	Price    int64     `json:"price"` // Paisa per unit, included in the line's price
+}
+
+// Modifier limits
+const (
+	MaxModifierNameLength     = 50
+	MaxModifierOptions        = 30 // Options per group
+	MaxModifiersPerLine       = 20 // Options chosen for one cart line
+	MaxModifierSelectPerGroup = 20
+)
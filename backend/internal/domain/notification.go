@@ -0,0 +1,201 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Language is the language a user receives notifications in
+type Language string
+
+const (
+	LanguageEnglish Language = "en"
+	LanguageTelugu  Language = "te"
+)
+
+// IsValid checks if the language is supported by the notification templates
+func (l Language) IsValid() bool {
+	return l == LanguageEnglish || l == LanguageTelugu
+}
+
+// NotificationChannel is how a notification reaches the user
+type NotificationChannel string
+
+const (
+	ChannelSMS   NotificationChannel = "sms"
+	ChannelEmail NotificationChannel = "email"
+	ChannelPush  NotificationChannel = "push"
+)
+
+// NotificationChannels lists every channel, in the order providers are set up
+var NotificationChannels = []NotificationChannel{ChannelSMS, ChannelEmail, ChannelPush}
+
+// NotificationEvent is what a notification is about; rules map each event to
+// the channels it is sent on
+type NotificationEvent string
+
+const (
+	NotifyOTP                 NotificationEvent = "otp"
+	NotifyOrderPaid           NotificationEvent = "order_paid"
+	NotifyOutForDelivery      NotificationEvent = "out_for_delivery"
+	NotifyDelivered           NotificationEvent = "delivered"
+	NotifyRefund              NotificationEvent = "refund"
+	NotifySubscriptionRenewal NotificationEvent = "subscription_renewal"
+	NotifySubscriptionExpired NotificationEvent = "subscription_expired"
+	NotifyPromotion           NotificationEvent = "promotion"
+)
+
+// NotificationCategory groups events for the user's notification preferences
+type NotificationCategory string
+
+const (
+	CategoryAccount      NotificationCategory = "account" // Login codes; always sent
+	CategoryOrderUpdates NotificationCategory = "order_updates"
+	CategoryPromotions   NotificationCategory = "promotions" // Marketing; needs the user's opt-in
+)
+
+// Category returns the preference category an event belongs to
+func (e NotificationEvent) Category() NotificationCategory {
+	switch e {
+	case NotifyOTP:
+		return CategoryAccount
+	case NotifyPromotion:
+		return CategoryPromotions
+	}
+	return CategoryOrderUpdates
+}
+
+// NotificationStatus is the delivery state of a notification
+type NotificationStatus string
+
+const (
+	NotificationPending NotificationStatus = "PENDING" // Waiting for its first or next attempt
+	NotificationSent    NotificationStatus = "SENT"
+	NotificationFailed  NotificationStatus = "FAILED" // Gave up: out of attempts, expired or rejected by the provider
+)
+
+// Notification is one message to one recipient on one channel. Failed
+// attempts are retried with backoff until the message is sent, expires or
+// runs out of attempts.
+type Notification struct {
+	ID            uuid.UUID           `json:"id"`
+	UserID        *uuid.UUID          `json:"user_id,omitempty"`
+	Event         NotificationEvent   `json:"event"`
+	Channel       NotificationChannel `json:"channel"`
+	Recipient     string              `json:"recipient"` // Phone number, email address or device token
+	Subject       string              `json:"subject,omitempty"`
+	Body          string              `json:"body"`
+	Data          map[string]string   `json:"data,omitempty"` // Push payload, e.g. the order to open
+	Status        NotificationStatus  `json:"status"`
+	Attempts      int                 `json:"attempts"`
+	LastError     string              `json:"last_error,omitempty"`
+	NextAttemptAt time.Time           `json:"next_attempt_at"`
+	ExpiresAt     *time.Time          `json:"expires_at,omitempty"` // Not worth sending after this, e.g. an expired OTP
+	SentAt        *time.Time          `json:"sent_at,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+
+	// DedupKey makes queueing idempotent, so an event delivered twice is
+	// still notified once
+	DedupKey string `json:"-"`
+}
+
+// QuietHours is a daily window, in the business timezone, in which SMS and
+// push notifications that can wait are held back until it ends. Start after
+// End spans midnight, e.g. 22:00-07:00.
+type QuietHours struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start,omitempty"` // HH:MM
+	End     string `json:"end,omitempty"`   // HH:MM
+}
+
+// NotificationPreferences are a user's choices of what reaches them and how
+type NotificationPreferences struct {
+	Language       Language                                       `json:"language"`
+	MarketingOptIn bool                                           `json:"marketing_opt_in"`
+	Channels       map[NotificationCategory][]NotificationChannel `json:"channels"` // Order updates and promotions
+	QuietHours     QuietHours                                     `json:"quiet_hours"`
+}
+
+// DefaultNotificationChannels are used for a category the user has not chosen
+// channels for. Promotional SMS must be chosen explicitly.
+var DefaultNotificationChannels = map[NotificationCategory][]NotificationChannel{
+	CategoryOrderUpdates: {ChannelSMS, ChannelEmail, ChannelPush},
+	CategoryPromotions:   {ChannelEmail, ChannelPush},
+}
+
+// ChannelsFor returns the channels the user receives a category on
+func (p *NotificationPreferences) ChannelsFor(category NotificationCategory) []NotificationChannel {
+	if channels, ok := p.Channels[category]; ok {
+		return channels
+	}
+	return DefaultNotificationChannels[category]
+}
+
+// Allows checks if the user wants an event on a channel. Account messages
+// always go out; promotions only with the marketing opt-in.
+func (p *NotificationPreferences) Allows(event NotificationEvent, channel NotificationChannel) bool {
+	category := event.Category()
+	if category == CategoryAccount {
+		return true
+	}
+	if category == CategoryPromotions && !p.MarketingOptIn {
+		return false
+	}
+	for _, c := range p.ChannelsFor(category) {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsentSource is where a consent change was made
+type ConsentSource string
+
+const (
+	ConsentSourceApp   ConsentSource = "app"
+	ConsentSourceAdmin ConsentSource = "admin" // Support acting on the customer's request
+)
+
+// ConsentChange records one change to a user's notification preferences.
+// Changes are append-only, so they show what the user agreed to and when.
+type ConsentChange struct {
+	ID        uuid.UUID     `json:"id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	Setting   string        `json:"setting"` // e.g. marketing_opt_in, channels.promotions
+	OldValue  string        `json:"old_value"`
+	NewValue  string        `json:"new_value"`
+	Source    ConsentSource `json:"source"`
+	ChangedBy uuid.UUID     `json:"changed_by"`
+	IPAddress string        `json:"ip_address,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// DevicePlatform is the platform of a push notification device
+type DevicePlatform string
+
+const (
+	PlatformAndroid DevicePlatform = "android"
+	PlatformIOS     DevicePlatform = "ios"
+	PlatformWeb     DevicePlatform = "web"
+)
+
+// IsValid checks if the platform is a known value
+func (p DevicePlatform) IsValid() bool {
+	switch p {
+	case PlatformAndroid, PlatformIOS, PlatformWeb:
+		return true
+	}
+	return false
+}
+
+// Device is an app install registered for push notifications
+type Device struct {
+	Token     string         `json:"token"` // FCM registration token
+	UserID    uuid.UUID      `json:"user_id"`
+	Platform  DevicePlatform `json:"platform"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
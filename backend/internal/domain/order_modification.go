@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrderModificationStatus is the state of an edit to a paid order.
+// State transitions: PENDING_PAYMENT -> APPLIED, CANCELLED (superseded) or
+// REJECTED (order changed before the difference was paid; it is refunded).
+// Edits that cost the same or less are APPLIED straight away.
+type OrderModificationStatus string
+
+const (
+	ModificationPendingPayment OrderModificationStatus = "PENDING_PAYMENT"
+	ModificationApplied        OrderModificationStatus = "APPLIED"
+	ModificationCancelled      OrderModificationStatus = "CANCELLED"
+	ModificationRejected       OrderModificationStatus = "REJECTED"
+)
+
+// RefundSourceOrderModification refunds the surplus of an edit, or the
+// difference paid for an edit that could not be applied
+const RefundSourceOrderModification = "order_modification"
+
+// OrderModification is one edit of a paid order's contents
+type OrderModification struct {
+	ID                uuid.UUID               `json:"id"`
+	OrderID           uuid.UUID               `json:"order_id"`
+	BaseVersion       int                     `json:"base_version"` // orders.version the edit was made against
+	Status            OrderModificationStatus `json:"status"`
+	Items             []OrderItem             `json:"items"`
+	OldTotal          int64                   `json:"old_total"` // Paisa
+	NewTotal          int64                   `json:"new_total"` // Paisa
+	RazorpayOrderID   string                  `json:"razorpay_order_id,omitempty"`
+	RazorpayPaymentID string                  `json:"razorpay_payment_id,omitempty"`
+	CreatedBy         uuid.UUID               `json:"created_by"`
+	CreatedAt         time.Time               `json:"created_at"`
+	UpdatedAt         time.Time               `json:"updated_at"`
+	AppliedAt         *time.Time              `json:"applied_at,omitempty"`
+}
+
+// Delta is what the customer owes (positive) or gets back (negative)
+func (m *OrderModification) Delta() int64 {
+	return m.NewTotal - m.OldTotal
+}
+
+// OrderRevision is a snapshot of an order's contents. Revision 1 is what
+// was originally ordered; every applied edit adds the next revision.
+type OrderRevision struct {
+	OrderID        uuid.UUID   `json:"order_id"`
+	Revision       int         `json:"revision"`
+	Items          []OrderItem `json:"items"`
+	TotalAmount    int64       `json:"total_amount"` // Paisa
+	ModificationID *uuid.UUID  `json:"modification_id,omitempty"`
+	CreatedBy      uuid.UUID   `json:"created_by"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
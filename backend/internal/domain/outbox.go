@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names a domain event relayed from the outbox
+type EventType string
+
+const (
+	EventOrderCreated       EventType = "OrderCreated"
+	EventOrderPaid          EventType = "OrderPaid"          // Money for the order was received, online or at the counter
+	EventOrderStatusChanged EventType = "OrderStatusChanged" // Every status transition, including to PAID
+	EventRefundIssued       EventType = "RefundIssued"       // The gateway accepted a refund
+
+	EventMenuAvailabilityChanged EventType = "MenuAvailabilityChanged" // Stock running out or coming back switched an item off or on
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// it describes. Events are delivered at least once, so consumers must tolerate
+// seeing the same ID twice.
+type OutboxEvent struct {
+	ID          int64           `json:"id"`
+	Type        EventType       `json:"type"`
+	AggregateID uuid.UUID       `json:"aggregate_id"` // Order, refund or menu item ID
+	Payload     json.RawMessage `json:"payload"`      // One of the *Event structs below
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// OrderCreatedEvent is the payload of OrderCreated
+type OrderCreatedEvent struct {
+	OrderID           uuid.UUID       `json:"order_id"`
+	UserID            uuid.UUID       `json:"user_id"`
+	Status            OrderStatus     `json:"status"`
+	TotalAmount       int64           `json:"total_amount"` // Paisa
+	FulfillmentType   FulfillmentType `json:"fulfillment_type"`
+	TableSessionID    *uuid.UUID      `json:"table_session_id,omitempty"`
+	CateringRequestID *uuid.UUID      `json:"catering_request_id,omitempty"`
+	SubscriptionID    *uuid.UUID      `json:"subscription_id,omitempty"`
+}
+
+// OrderPaidEvent is the payload of OrderPaid
+type OrderPaidEvent struct {
+	OrderID           uuid.UUID  `json:"order_id"`
+	UserID            uuid.UUID  `json:"user_id"`
+	Amount            int64      `json:"amount"`                        // Paisa
+	RazorpayPaymentID string     `json:"razorpay_payment_id,omitempty"` // Empty for split bills, counter and prepaid payments
+	PaidAt            time.Time  `json:"paid_at"`
+	TableSessionID    *uuid.UUID `json:"table_session_id,omitempty"` // Set for table rounds paid with their tab
+}
+
+// OrderStatusChangedEvent is the payload of OrderStatusChanged
+type OrderStatusChangedEvent struct {
+	OrderID uuid.UUID   `json:"order_id"`
+	UserID  uuid.UUID   `json:"user_id"`
+	From    OrderStatus `json:"from"`
+	To      OrderStatus `json:"to"`
+}
+
+// RefundIssuedEvent is the payload of RefundIssued
+type RefundIssuedEvent struct {
+	RefundID          uuid.UUID  `json:"refund_id"`
+	OrderID           *uuid.UUID `json:"order_id,omitempty"`
+	UserID            *uuid.UUID `json:"user_id,omitempty"` // Set for order and subscription refunds
+	Source            string     `json:"source"`
+	SourceID          uuid.UUID  `json:"source_id"`
+	Amount            int64      `json:"amount"` // Paisa
+	RazorpayPaymentID string     `json:"razorpay_payment_id"`
+	RazorpayRefundID  string     `json:"razorpay_refund_id"`
+}
+
+// MenuAvailabilityChangedEvent is the payload of MenuAvailabilityChanged
+type MenuAvailabilityChangedEvent struct {
+	MenuItemID  uuid.UUID `json:"menu_item_id"`
+	IsAvailable bool      `json:"is_available"`
+	Remaining   int       `json:"remaining"`
+}
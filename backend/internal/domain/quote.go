@@ -0,0 +1,33 @@
+package domain
+
+import "github.com/google/uuid"
+
+// Quote is a price preview of a cart at current menu prices. Nothing is
+// reserved; checkout prices the cart again.
+type Quote struct {
+	FulfillmentType FulfillmentType `json:"fulfillment_type"`
+	Lines           []QuoteLine     `json:"lines"`
+	Subtotal        int64           `json:"subtotal"`     // Paisa, available lines only
+	DeliveryFee     int64           `json:"delivery_fee"` // Paisa
+	Discount        int64           `json:"discount"`     // Paisa taken off; always 0, there are no coupons or promotions yet
+	Total           int64           `json:"total"`        // Paisa, what checkout would charge
+	TaxIncluded     int64           `json:"tax_included"` // Paisa of GST contained in Total
+	TaxRate         int64           `json:"tax_rate"`     // Basis points (500 = 5%)
+	Available       bool            `json:"available"`    // Every line can be ordered right now
+}
+
+// QuoteLine is one priced cart line
+type QuoteLine struct {
+	ID          uuid.UUID            `json:"id"` // Cart line ID
+	MenuItemID  uuid.UUID            `json:"menu_item_id"`
+	Name        string               `json:"name"`
+	VariantID   *uuid.UUID           `json:"variant_id,omitempty"`
+	VariantName string               `json:"variant_name,omitempty"`
+	Modifiers   []OrderItemModifier  `json:"modifiers,omitempty"`
+	Components  []OrderItemComponent `json:"components,omitempty"`
+	Price       int64                `json:"price"` // Paisa, current menu price of the item or its variant and its modifiers
+	Quantity    int                  `json:"quantity"`
+	Notes       string               `json:"notes,omitempty"`
+	Subtotal    int64                `json:"subtotal"` // Paisa, 0 when unavailable
+	Available   bool                 `json:"available"`
+}
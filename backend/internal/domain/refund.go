@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefundStatus is the state of a gateway refund
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "PENDING"
+	RefundProcessed RefundStatus = "PROCESSED"
+	RefundFailed    RefundStatus = "FAILED" // Gateway call failed, retried later
+)
+
+// Refund sources: what caused money to be returned
+const (
+	RefundSourceBillShare = "bill_share"
+)
+
+// Refund is money returned to the customer through the gateway
+type Refund struct {
+	ID                uuid.UUID    `json:"id"`
+	OrderID           *uuid.UUID   `json:"order_id,omitempty"`
+	Source            string       `json:"source"`
+	SourceID          uuid.UUID    `json:"source_id"`
+	RazorpayPaymentID string       `json:"razorpay_payment_id"`
+	RazorpayRefundID  string       `json:"razorpay_refund_id,omitempty"`
+	Amount            int64        `json:"amount"` // Paisa
+	Status            RefundStatus `json:"status"`
+	Reason            string       `json:"reason,omitempty"`
+	LastError         string       `json:"last_error,omitempty"`
+	Attempts          int          `json:"attempts"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	ProcessedAt       *time.Time   `json:"processed_at,omitempty"`
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReviewStatus is the moderation state of a review.
+// HIDDEN reviews are neither shown nor counted in menu ratings; FLAGGED
+// reviews stay visible until an admin decides.
+type ReviewStatus string
+
+const (
+	ReviewVisible ReviewStatus = "VISIBLE"
+	ReviewFlagged ReviewStatus = "FLAGGED"
+	ReviewHidden  ReviewStatus = "HIDDEN"
+)
+
+// IsValid checks if the review status is a known value
+func (s ReviewStatus) IsValid() bool {
+	switch s {
+	case ReviewVisible, ReviewFlagged, ReviewHidden:
+		return true
+	}
+	return false
+}
+
+// Review limits
+const (
+	MinRating              = 1
+	MaxRating              = 5
+	MaxReviewCommentLength = 1000
+	MaxReviewPhotos        = 5
+	MaxReviewPhotoURL      = 500
+)
+
+// OrderReview is a customer's rating of a delivered order and its items
+type OrderReview struct {
+	ID             uuid.UUID    `json:"id"`
+	OrderID        uuid.UUID    `json:"order_id"`
+	UserID         uuid.UUID    `json:"user_id"`
+	FoodRating     int          `json:"food_rating"`
+	DeliveryRating *int         `json:"delivery_rating,omitempty"` // Delivery orders only
+	Comment        string       `json:"comment,omitempty"`
+	PhotoURLs      []string     `json:"photo_urls"`
+	Status         ReviewStatus `json:"status"`
+	ModerationNote string       `json:"moderation_note,omitempty"`
+	ModeratedBy    *uuid.UUID   `json:"moderated_by,omitempty"`
+	ModeratedAt    *time.Time   `json:"moderated_at,omitempty"`
+	Items          []ItemReview `json:"items"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// ItemReview is a customer's rating of one order line
+type ItemReview struct {
+	ID             uuid.UUID    `json:"id"`
+	ReviewID       uuid.UUID    `json:"review_id"`
+	OrderItemID    uuid.UUID    `json:"order_item_id"`
+	MenuItemID     uuid.UUID    `json:"menu_item_id"`
+	Rating         int          `json:"rating"`
+	Comment        string       `json:"comment,omitempty"`
+	PhotoURLs      []string     `json:"photo_urls"`
+	Status         ReviewStatus `json:"status,omitempty"`
+	ModerationNote string       `json:"moderation_note,omitempty"`
+	ModeratedBy    *uuid.UUID   `json:"moderated_by,omitempty"`
+	ModeratedAt    *time.Time   `json:"moderated_at,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+
+	// Public listings show who wrote the review
+	ReviewerName string `json:"reviewer_name,omitempty"`
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Settlement line types in the gateway's settlement report
+const (
+	SettlementPayment    = "payment"
+	SettlementRefund     = "refund"
+	SettlementAdjustment = "adjustment"
+)
+
+// SettlementLine is one line of the gateway's settlement report: a payment,
+// refund or adjustment and what was paid out for it. Amounts are in paisa.
+type SettlementLine struct {
+	EntityID        string    `json:"entity_id"` // pay_..., rfnd_..., adj_...
+	Type            string    `json:"type"`
+	PaymentID       string    `json:"payment_id,omitempty"` // The payment the line belongs to
+	RazorpayOrderID string    `json:"razorpay_order_id,omitempty"`
+	Amount          int64     `json:"amount"` // Gross amount
+	Fee             int64     `json:"fee"`    // Gateway fee, including Tax
+	Tax             int64     `json:"tax"`    // GST on the fee
+	Net             int64     `json:"net"`    // Paid out (negative when deducted from a payout)
+	SettlementID    string    `json:"settlement_id"`
+	SettlementUTR   string    `json:"settlement_utr,omitempty"` // Bank reference of the payout
+	SettledAt       time.Time `json:"settled_at"`
+}
+
+// SettlementImport records one imported settlement report
+type SettlementImport struct {
+	ID          uuid.UUID `json:"id"`
+	FileName    string    `json:"file_name"`
+	ImportedBy  uuid.UUID `json:"imported_by"`
+	Lines       int64     `json:"lines"`
+	New         int64     `json:"new"`     // Lines not seen in an earlier import
+	Skipped     int64     `json:"skipped"` // Lines not settled yet, e.g. on hold
+	Payments    int64     `json:"payments"`
+	Refunds     int64     `json:"refunds"`
+	Adjustments int64     `json:"adjustments"`
+	Amount      int64     `json:"amount"` // Gross of the payments
+	Fees        int64     `json:"fees"`
+	Tax         int64     `json:"tax"`
+	Net         int64     `json:"net"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReconciliationReport compares settled payments with paid orders. Orders
+// are those paid in the range; settlement lines those settled in it.
+type ReconciliationReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"` // Exclusive
+
+	// Payment lines settled in the range and what the gateway deducted
+	SettledPayments int64 `json:"settled_payments"`
+	SettledAmount   int64 `json:"settled_amount"`
+	Fees            int64 `json:"fees"`
+	Tax             int64 `json:"tax"`
+	Refunds         int64 `json:"refunds"`     // Deducted for refunds
+	Adjustments     int64 `json:"adjustments"` // Net of adjustments
+	Net             int64 `json:"net"`         // Paid out to the bank
+
+	// Orders paid in the range with a gateway payment
+	PaidOrders     int64 `json:"paid_orders"`
+	SettledOrders  int64 `json:"settled_orders"`
+	PendingOrders  int64 `json:"pending_orders"` // Not settled yet but still within the grace period
+	MissingCount   int64 `json:"missing_count"`
+	MismatchCount  int64 `json:"mismatch_count"`
+	UnmatchedCount int64 `json:"unmatched_count"`
+	// Settled payments of table tabs, split bills, order edits and tiffin
+	// plans, which are not orders
+	OtherPayments int64 `json:"other_payments"`
+
+	MissingSettlements []UnsettledOrder     `json:"missing_settlements"`
+	AmountMismatches   []SettlementMismatch `json:"amount_mismatches"`
+	UnmatchedPayments  []SettlementLine     `json:"unmatched_payments"`
+}
+
+// UnsettledOrder is a paid order with no settlement past the grace period
+type UnsettledOrder struct {
+	OrderID           uuid.UUID `json:"order_id"`
+	RazorpayPaymentID string    `json:"razorpay_payment_id"`
+	TotalAmount       int64     `json:"total_amount"`
+	PaidAt            time.Time `json:"paid_at"`
+}
+
+// SettlementMismatch is an order settled for a different amount than it was
+// paid for
+type SettlementMismatch struct {
+	OrderID           uuid.UUID `json:"order_id"`
+	RazorpayPaymentID string    `json:"razorpay_payment_id"`
+	OrderAmount       int64     `json:"order_amount"` // Captured at checkout, before any edit
+	SettledAmount     int64     `json:"settled_amount"`
+	Difference        int64     `json:"difference"` // Settled minus order amount
+	Fee               int64     `json:"fee"`
+	Tax               int64     `json:"tax"`
+	SettlementID      string    `json:"settlement_id"`
+	SettledAt         time.Time `json:"settled_at"`
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StockReservationStatus is what became of the stock an order took
+type StockReservationStatus string
+
+const (
+	StockReserved  StockReservationStatus = "RESERVED"  // Held for an order awaiting payment
+	StockCommitted StockReservationStatus = "COMMITTED" // Sold: the order was paid or is a dine-in round
+	StockReleased  StockReservationStatus = "RELEASED"  // Given back after a failed or abandoned payment
+)
+
+// RefundSourceOutOfStock refunds a payment that arrived after the stock its
+// order had given back was sold; the source is the order
+const RefundSourceOutOfStock = "out_of_stock"
+
+// MenuItemStock is the daily stock count of a menu item. Items without one
+// are limited by IsAvailable alone.
+type MenuItemStock struct {
+	MenuItemID  uuid.UUID `json:"menu_item_id"`
+	Name        string    `json:"name"`
+	DailyStock  int       `json:"daily_stock"` // Plates available each day
+	Remaining   int       `json:"remaining"`   // Plates left to order today
+	Reserved    int       `json:"reserved"`    // Plates held by orders awaiting payment, not in Remaining
+	SoldOut     bool      `json:"sold_out"`    // Made unavailable by running out
+	IsAvailable bool      `json:"is_available"`
+	ResetAt     time.Time `json:"reset_at"` // Last daily reset
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// StockQuantities is how many plates of each menu item a set of order lines
+// takes. A bundle takes one of itself and its components from stock.
+func StockQuantities(items []OrderItem) map[uuid.UUID]int {
+	quantities := make(map[uuid.UUID]int, len(items))
+	for _, item := range items {
+		quantities[item.MenuItemID] += item.Quantity
+		for _, component := range item.Components {
+			quantities[component.MenuItemID] += item.Quantity * component.Quantity
+		}
+	}
+	return quantities
+}
@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MealPlan is a tiffin plan: a menu per weekday and a prepaid number of meals.
+// Changes to meals and price apply from the next billing period.
+type MealPlan struct {
+	ID          uuid.UUID     `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Meals       int           `json:"meals"` // Meals per billing period
+	Price       int64         `json:"price"` // Paisa per billing period
+	IsActive    bool          `json:"is_active"`
+	Days        []MealPlanDay `json:"days"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// MealPlanDay is the tiffin served on one weekday
+type MealPlanDay struct {
+	Weekday time.Weekday   `json:"weekday"` // 0 = Sunday
+	Items   []MealPlanItem `json:"items"`
+}
+
+// MealPlanItem is one dish of a tiffin
+type MealPlanItem struct {
+	MenuItemID uuid.UUID `json:"menu_item_id"`
+	Name       string    `json:"name"`
+	Quantity   int       `json:"quantity"`
+}
+
+// Day returns the menu served on a weekday, or nil if the plan skips it
+func (p *MealPlan) Day(weekday time.Weekday) *MealPlanDay {
+	for i := range p.Days {
+		if p.Days[i].Weekday == weekday {
+			return &p.Days[i]
+		}
+	}
+	return nil
+}
+
+// SubscriptionStatus is the state of a tiffin subscription.
+// State transitions: PENDING_PAYMENT -> ACTIVE (first period paid);
+// ACTIVE -> EXPIRED when the last paid meal is used, and back to ACTIVE when
+// a renewal is paid; any state -> CANCELLED. Pauses do not change the status.
+type SubscriptionStatus string
+
+const (
+	SubscriptionPendingPayment SubscriptionStatus = "PENDING_PAYMENT"
+	SubscriptionActive         SubscriptionStatus = "ACTIVE"
+	SubscriptionExpired        SubscriptionStatus = "EXPIRED"
+	SubscriptionCancelled      SubscriptionStatus = "CANCELLED"
+)
+
+// IsValid checks if the subscription status is a known value
+func (s SubscriptionStatus) IsValid() bool {
+	switch s {
+	case SubscriptionPendingPayment, SubscriptionActive, SubscriptionExpired, SubscriptionCancelled:
+		return true
+	}
+	return false
+}
+
+// PeriodStatus is the payment state of a billing period
+type PeriodStatus string
+
+const (
+	PeriodPending   PeriodStatus = "PENDING"
+	PeriodPaid      PeriodStatus = "PAID"
+	PeriodCancelled PeriodStatus = "CANCELLED"
+)
+
+// Subscription limits
+const (
+	MaxPlanMeals         = 100
+	MaxScheduleAheadDays = 90 // Furthest start, skip or pause date
+	RenewalReminderMeals = 3  // Remind to renew when this many paid meals are left
+)
+
+// RefundSourceSubscriptionPeriod refunds the unused meals of a period when a
+// subscription is cancelled, or a period paid after cancellation
+const RefundSourceSubscriptionPeriod = "subscription_period"
+
+// Subscription is a customer's recurring tiffin delivery
+type Subscription struct {
+	ID              uuid.UUID          `json:"id"`
+	UserID          uuid.UUID          `json:"user_id"`
+	PlanID          uuid.UUID          `json:"plan_id"`
+	PlanName        string             `json:"plan_name"`
+	Status          SubscriptionStatus `json:"status"`
+	StartDate       string             `json:"start_date"`             // YYYY-MM-DD
+	PausedFrom      *string            `json:"paused_from,omitempty"`  // YYYY-MM-DD
+	PausedUntil     *string            `json:"paused_until,omitempty"` // Inclusive; open-ended if nil
+	DeliveryAddress string             `json:"delivery_address"`
+	Notes           string             `json:"notes,omitempty"`
+	MealsLeft       int                `json:"meals_left"` // Paid meals not yet delivered
+	Version         int                `json:"version"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+	CancelledAt     *time.Time         `json:"cancelled_at,omitempty"`
+
+	// Detail views only
+	Periods []SubscriptionPeriod `json:"periods,omitempty"`
+	Skips   []string             `json:"skips,omitempty"` // Upcoming skipped days
+}
+
+// SubscriptionPeriod is one prepaid billing period of meal credits
+type SubscriptionPeriod struct {
+	ID                uuid.UUID    `json:"id"`
+	SubscriptionID    uuid.UUID    `json:"subscription_id"`
+	Number            int          `json:"number"`
+	Status            PeriodStatus `json:"status"`
+	Amount            int64        `json:"amount"` // Paisa
+	Meals             int          `json:"meals"`
+	MealsUsed         int          `json:"meals_used"`
+	RazorpayOrderID   string       `json:"razorpay_order_id,omitempty"`
+	RazorpayPaymentID string       `json:"razorpay_payment_id,omitempty"`
+	PaidAt            *time.Time   `json:"paid_at,omitempty"`
+	CreatedAt         time.Time    `json:"created_at"`
+}
+
+// MealPrice is the share of the period amount charged for meal n (1-based).
+// The paisa that do not divide evenly are charged on the last meal.
+func (p *SubscriptionPeriod) MealPrice(n int) int64 {
+	price := p.Amount / int64(p.Meals)
+	if n == p.Meals {
+		price += p.Amount % int64(p.Meals)
+	}
+	return price
+}
+
+// Unused is the part of the amount not yet spent on delivered meals
+func (p *SubscriptionPeriod) Unused() int64 {
+	if p.MealsUsed == p.Meals {
+		return 0
+	}
+	return p.Amount - p.Amount/int64(p.Meals)*int64(p.MealsUsed)
+}
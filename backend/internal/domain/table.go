@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DiningTable is a restaurant table guests order from by scanning its QR code
+type DiningTable struct {
+	ID        uuid.UUID `json:"id"`
+	Number    int       `json:"number"`
+	Label     string    `json:"label"`
+	QRVersion int       `json:"qr_version"` // Bumped to invalidate printed QR codes
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableSessionStatus is the state of a table tab.
+// State transitions: OPEN -> BILL_REQUESTED -> SETTLED
+type TableSessionStatus string
+
+const (
+	TableSessionOpen          TableSessionStatus = "OPEN"
+	TableSessionBillRequested TableSessionStatus = "BILL_REQUESTED"
+	TableSessionSettled       TableSessionStatus = "SETTLED"
+)
+
+// SettlementMethod is how a table tab was paid
+type SettlementMethod string
+
+const (
+	SettlementGateway SettlementMethod = "gateway" // Paid online via Razorpay
+	SettlementCounter SettlementMethod = "counter" // Paid at the till, marked by staff
+	SettlementSplit   SettlementMethod = "split"   // Paid in shares through a split bill
+)
+
+// TableSession is a running tab that groups every dine-in order of one seating
+type TableSession struct {
+	ID                uuid.UUID          `json:"id"`
+	TableID           uuid.UUID          `json:"table_id"`
+	TableNumber       int                `json:"table_number"`
+	Status            TableSessionStatus `json:"status"`
+	BillAmount        int64              `json:"bill_amount"` // Paisa, fixed once payment starts
+	SettlementMethod  SettlementMethod   `json:"settlement_method,omitempty"`
+	RazorpayOrderID   string             `json:"razorpay_order_id,omitempty"`
+	RazorpayPaymentID string             `json:"razorpay_payment_id,omitempty"`
+	SettledBy         *uuid.UUID         `json:"settled_by,omitempty"`
+	Version           int                `json:"version"`
+	OpenedAt          time.Time          `json:"opened_at"`
+	BillRequestedAt   *time.Time         `json:"bill_requested_at,omitempty"`
+	SettledAt         *time.Time         `json:"settled_at,omitempty"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+
+	// Loaded on demand
+	Orders      []Order `json:"orders,omitempty"`
+	TotalAmount int64   `json:"total_amount"` // Running total of all rounds (paisa)
+}
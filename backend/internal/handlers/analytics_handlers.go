@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/usecase"
+)
+
+// analyticsRange reads the from/to query parameters shared by every report
+func analyticsRange(c *fiber.Ctx) usecase.AnalyticsRange {
+	return usecase.AnalyticsRange{From: c.Query("from"), To: c.Query("to")}
+}
+
+// respondAnalytics writes a report or maps the error
+func (h *Handlers) respondAnalytics(c *fiber.Ctx, data interface{}, err error, report string) error {
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidFilter) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		h.log.Error("Failed to build "+report, "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build "+report)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// GetSalesSummary handles GET /admin/analytics/summary
+// Query: from, to (YYYY-MM-DD in the business timezone, to inclusive; default the last 30 days)
+func (h *Handlers) GetSalesSummary(c *fiber.Ctx) error {
+	summary, err := h.analyticsUsecase.GetSummary(c.Context(), analyticsRange(c))
+	return h.respondAnalytics(c, summary, err, "sales summary")
+}
+
+// GetRevenueReport handles GET /admin/analytics/revenue
+// Query: from, to, interval (day, week or month; default day)
+func (h *Handlers) GetRevenueReport(c *fiber.Ctx) error {
+	interval := domain.AnalyticsInterval(c.Query("interval"))
+	series, err := h.analyticsUsecase.GetRevenue(c.Context(), analyticsRange(c), interval)
+	return h.respondAnalytics(c, series, err, "revenue report")
+}
+
+// GetTopItems handles GET /admin/analytics/top-items
+// Query: from, to, sort (quantity or revenue), limit (default 10, max 100)
+func (h *Handlers) GetTopItems(c *fiber.Ctx) error {
+	items, err := h.analyticsUsecase.GetTopItems(c.Context(), analyticsRange(c), c.Query("sort"), c.QueryInt("limit", 10))
+	return h.respondAnalytics(c, items, err, "top items report")
+}
+
+// GetTopCategories handles GET /admin/analytics/top-categories
+// Query: from, to
+func (h *Handlers) GetTopCategories(c *fiber.Ctx) error {
+	categories, err := h.analyticsUsecase.GetTopCategories(c.Context(), analyticsRange(c))
+	return h.respondAnalytics(c, categories, err, "category report")
+}
+
+// GetPeakHours handles GET /admin/analytics/peak-hours
+// Query: from, to. Returns all 168 weekday/hour cells.
+func (h *Handlers) GetPeakHours(c *fiber.Ctx) error {
+	cells, err := h.analyticsUsecase.GetPeakHours(c.Context(), analyticsRange(c))
+	return h.respondAnalytics(c, cells, err, "peak hours report")
+}
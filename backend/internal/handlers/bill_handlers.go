@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// billError maps split bill errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func billError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, usecase.ErrShareNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Bill not found")
+	case errors.Is(err, usecase.ErrInvalidSplit):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrInvalidBillSource):
+		return fiber.NewError(fiber.StatusBadRequest, "Only table tabs and unpaid orders can be split")
+	case errors.Is(err, usecase.ErrTabEmpty):
+		return fiber.NewError(fiber.StatusBadRequest, "Nothing has been ordered yet")
+	case errors.Is(err, usecase.ErrOrderAccessDenied):
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	case errors.Is(err, repository.ErrNotTableMember):
+		return fiber.NewError(fiber.StatusForbidden, "Scan the table's QR code to join this tab first")
+	case errors.Is(err, usecase.ErrBillAccessDenied):
+		return fiber.NewError(fiber.StatusForbidden, "Only the guest who split the bill can void it")
+	case errors.Is(err, repository.ErrActiveBillExists):
+		return fiber.NewError(fiber.StatusConflict, "This bill has already been split")
+	case errors.Is(err, repository.ErrBillSourcePaid):
+		return fiber.NewError(fiber.StatusConflict, "This bill has already been paid")
+	case errors.Is(err, repository.ErrTabPaymentOpen):
+		return fiber.NewError(fiber.StatusConflict, "Payment for the whole tab has already started, pay it or settle at the counter")
+	case errors.Is(err, repository.ErrBillTotalChanged):
+		return fiber.NewError(fiber.StatusConflict, "The bill changed while it was being split, please retry")
+	case errors.Is(err, repository.ErrBillNotOpen):
+		return fiber.NewError(fiber.StatusConflict, "This bill is no longer open")
+	case errors.Is(err, usecase.ErrShareAlreadyPaid):
+		return fiber.NewError(fiber.StatusConflict, "This share has already been paid")
+	case errors.Is(err, usecase.ErrSharePaymentMismatch):
+		return fiber.NewError(fiber.StatusBadRequest, "Payment does not belong to this share")
+	case errors.Is(err, usecase.ErrInvalidSignature):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid payment signature")
+	}
+	return nil
+}
+
+// parseBillShareIDs parses the :id and :shareId route params
+func parseBillShareIDs(c *fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	billID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Invalid bill ID")
+	}
+	shareID, err := uuid.Parse(c.Params("shareId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Invalid share ID")
+	}
+	return billID, shareID, nil
+}
+
+// CreateBill handles POST /bills
+func (h *Handlers) CreateBill(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.CreateBillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.UserID = userID
+
+	bill, err := h.billUsecase.CreateBill(c.Context(), req)
+	if err != nil {
+		if fiberErr := billError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to split bill", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to split bill")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    bill,
+	})
+}
+
+// GetActiveBill handles GET /bills?source_type=table_session&source_id=...
+func (h *Handlers) GetActiveBill(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sourceID, err := uuid.Parse(c.Query("source_id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid source ID")
+	}
+
+	bill, err := h.billUsecase.GetActiveBill(c.Context(), domain.BillSourceType(c.Query("source_type")), sourceID, userID)
+	if err != nil {
+		if fiberErr := billError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch bill", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch bill")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    bill,
+	})
+}
+
+// GetBill handles GET /bills/:id
+func (h *Handlers) GetBill(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	billID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid bill ID")
+	}
+
+	bill, err := h.billUsecase.GetBill(c.Context(), billID, userID)
+	if err != nil {
+		if fiberErr := billError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch bill", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch bill")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    bill,
+	})
+}
+
+// PayBillShare handles POST /bills/:id/shares/:shareId/pay
+func (h *Handlers) PayBillShare(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	billID, shareID, err := parseBillShareIDs(c)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.billUsecase.PayShare(c.Context(), billID, shareID, userID)
+	if err != nil {
+		if fiberErr := billError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to start share payment", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start payment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// VerifyBillShare handles POST /bills/:id/shares/:shareId/verify
+func (h *Handlers) VerifyBillShare(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	billID, shareID, err := parseBillShareIDs(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.VerifyPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	bill, err := h.billUsecase.VerifyShare(c.Context(), billID, shareID, userID, req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
+	if err != nil {
+		if fiberErr := billError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to verify share payment", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify payment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    bill,
+		Message: "Payment verified",
+	})
+}
+
+// VoidBill handles POST /bills/:id/void
+func (h *Handlers) VoidBill(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	billID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid bill ID")
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	bill, err := h.billUsecase.VoidBill(c.Context(), billID, userID, isAdmin)
+	if err != nil {
+		if fiberErr := billError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to void bill", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to void bill")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    bill,
+		Message: "Bill voided",
+	})
+}
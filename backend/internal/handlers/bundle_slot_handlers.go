@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// BundleSlotRequest is the body for creating or updating a bundle slot.
+// A slot with one option is fixed; with several the customer chooses one.
+// On update, options with an id are changed, options without one are added
+// and the slot's other options are removed.
+type BundleSlotRequest struct {
+	Name      string                    `json:"name"`
+	Quantity  int                       `json:"quantity"` // Units per bundle, defaults to 1
+	SortOrder int                       `json:"sort_order"`
+	Options   []BundleSlotOptionRequest `json:"options"`
+}
+
+// BundleSlotOptionRequest is one option of a bundle slot request
+type BundleSlotOptionRequest struct {
+	ID         *uuid.UUID `json:"id,omitempty"`
+	MenuItemID uuid.UUID  `json:"menu_item_id"`
+	VariantID  *uuid.UUID `json:"variant_id,omitempty"` // Optional, the size or portion served
+	SortOrder  int        `json:"sort_order"`
+}
+
+// bundleSlotError maps bundle slot errors to HTTP errors
+func (h *Handlers) bundleSlotError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidBundleSlot):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrNestedBundle):
+		return fiber.NewError(fiber.StatusBadRequest, "Bundles cannot contain bundles")
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Menu item, variant, bundle slot or option not found")
+	case errors.Is(err, repository.ErrDuplicateKey):
+		return fiber.NewError(fiber.StatusConflict, "The bundle already has a slot with this name")
+	}
+	h.log.Error("Failed to save bundle slot", "error", err)
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to save bundle slot")
+}
+
+// parseBundleSlot reads the menu item and slot IDs and the body of a bundle
+// slot request
+func parseBundleSlot(c *fiber.Ctx, withSlotID bool) (*domain.BundleSlot, error) {
+	bundleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+
+	var req BundleSlotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	slot := &domain.BundleSlot{
+		BundleID:  bundleID,
+		Name:      req.Name,
+		Quantity:  req.Quantity,
+		SortOrder: req.SortOrder,
+		Options:   make([]domain.BundleSlotOption, len(req.Options)),
+	}
+	for i, o := range req.Options {
+		slot.Options[i] = domain.BundleSlotOption{
+			MenuItemID: o.MenuItemID,
+			VariantID:  o.VariantID,
+			SortOrder:  o.SortOrder,
+		}
+		if o.ID != nil && withSlotID {
+			slot.Options[i].ID = *o.ID
+		}
+	}
+
+	if withSlotID {
+		if slot.ID, err = uuid.Parse(c.Params("slotId")); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid bundle slot ID")
+		}
+	}
+
+	return slot, nil
+}
+
+// CreateBundleSlot handles POST /admin/menu/:id/bundle-slots
+func (h *Handlers) CreateBundleSlot(c *fiber.Ctx) error {
+	slot, err := parseBundleSlot(c, false)
+	if err != nil {
+		return err
+	}
+
+	if err := h.menuUsecase.CreateBundleSlot(c.Context(), slot); err != nil {
+		return h.bundleSlotError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    slot,
+	})
+}
+
+// UpdateBundleSlot handles PUT /admin/menu/:id/bundle-slots/:slotId
+func (h *Handlers) UpdateBundleSlot(c *fiber.Ctx) error {
+	slot, err := parseBundleSlot(c, true)
+	if err != nil {
+		return err
+	}
+
+	if err := h.menuUsecase.UpdateBundleSlot(c.Context(), slot); err != nil {
+		return h.bundleSlotError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    slot,
+	})
+}
+
+// DeleteBundleSlot handles DELETE /admin/menu/:id/bundle-slots/:slotId
+func (h *Handlers) DeleteBundleSlot(c *fiber.Ctx) error {
+	bundleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+	slotID, err := uuid.Parse(c.Params("slotId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid bundle slot ID")
+	}
+
+	if err := h.menuUsecase.DeleteBundleSlot(c.Context(), bundleID, slotID); err != nil {
+		return h.bundleSlotError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Bundle slot deleted",
+	})
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+	"fooddelivery/pkg/redis"
+)
+
+// cartError maps cart errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func cartError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrCartLineNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Cart item not found")
+	case errors.Is(err, usecase.ErrCartFull):
+		return fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("Cart can hold at most %d different items", domain.MaxCartLines))
+	case errors.Is(err, usecase.ErrCartEmpty):
+		return fiber.NewError(fiber.StatusBadRequest, "Cart is empty")
+	case errors.Is(err, usecase.ErrInvalidSelection):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrInvalidCart):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cart")
+	case errors.Is(err, usecase.ErrItemNotAvailable):
+		return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
+	case errors.Is(err, usecase.ErrNotesTooLong):
+		return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+	case errors.Is(err, repository.ErrVersionConflict), errors.Is(err, redis.ErrConcurrentUpdate):
+		return fiber.NewError(fiber.StatusConflict, "Cart was changed on another device, please review it again")
+	}
+	return fulfillmentError(err)
+}
+
+// GetCart handles GET /cart
+func (h *Handlers) GetCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.cartUsecase.GetCart(c.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch cart", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch cart")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// AddCartItem handles POST /cart/items
+func (h *Handlers) AddCartItem(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var item domain.CartItem
+	if err := c.BodyParser(&item); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	cart, err := h.cartUsecase.AddItem(c.Context(), userID, item)
+	if err != nil {
+		if fiberErr := cartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to add cart item", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update cart")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// UpdateCartItemRequest changes the quantity and notes of a cart line
+type UpdateCartItemRequest struct {
+	Quantity int    `json:"quantity"`
+	Notes    string `json:"notes"`
+}
+
+// UpdateCartItem handles PUT /cart/items/:id
+func (h *Handlers) UpdateCartItem(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	lineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cart item ID")
+	}
+
+	var req UpdateCartItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	cart, err := h.cartUsecase.UpdateItem(c.Context(), userID, lineID, req.Quantity, req.Notes)
+	if err != nil {
+		if fiberErr := cartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to update cart item", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update cart")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// RemoveCartItem handles DELETE /cart/items/:id
+func (h *Handlers) RemoveCartItem(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	lineID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cart item ID")
+	}
+
+	cart, err := h.cartUsecase.RemoveItem(c.Context(), userID, lineID)
+	if err != nil {
+		if fiberErr := cartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to remove cart item", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update cart")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// ClearCart handles DELETE /cart
+func (h *Handlers) ClearCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.cartUsecase.Clear(c.Context(), userID)
+	if err != nil {
+		if fiberErr := cartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to clear cart", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to clear cart")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// GetCartQuote handles GET /cart/quote
+// Query: fulfillment_type (delivery or pickup, default delivery)
+func (h *Handlers) GetCartQuote(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	quote, err := h.cartUsecase.Quote(c.Context(), userID, domain.FulfillmentType(c.Query("fulfillment_type")))
+	if err != nil {
+		if fiberErr := cartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to quote cart", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to price cart")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    quote,
+	})
+}
+
+// CheckoutCart handles POST /cart/checkout
+func (h *Handlers) CheckoutCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.CartCheckoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	req.UserID = userID
+
+	resp, err := h.cartUsecase.Checkout(c.Context(), req)
+	if err != nil {
+		if fiberErr := cartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to check out cart", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create order")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    resp,
+	})
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// cateringError maps catering errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func cateringError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Catering request not found")
+	case errors.Is(err, usecase.ErrCateringAccessDenied):
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	case errors.Is(err, usecase.ErrInvalidCateringRequest), errors.Is(err, usecase.ErrInvalidQuote),
+		errors.Is(err, usecase.ErrInvalidFilter), errors.Is(err, usecase.ErrQuoteVersionRequired):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrInvalidSelection):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrInvalidCart):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid items")
+	case errors.Is(err, usecase.ErrItemNotAvailable):
+		return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
+	case errors.Is(err, usecase.ErrNotesTooLong):
+		return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+	case errors.Is(err, repository.ErrVersionConflict):
+		return fiber.NewError(fiber.StatusConflict, "Catering request was updated, please review it again")
+	case errors.Is(err, repository.ErrCateringClosed):
+		return fiber.NewError(fiber.StatusConflict, "This catering request can no longer be changed")
+	case errors.Is(err, repository.ErrQuoteExpired):
+		return fiber.NewError(fiber.StatusConflict, "This quote has expired, please ask for a new one")
+	case errors.Is(err, repository.ErrNothingToCollect), errors.Is(err, usecase.ErrOrderAlreadyPaid):
+		return fiber.NewError(fiber.StatusConflict, "Nothing is due on this catering request")
+	}
+	return nil
+}
+
+// cateringActionRequest carries the request version the caller last saw
+type cateringActionRequest struct {
+	Version int `json:"version"`
+}
+
+// parseCateringAction reads the request ID and the optional version body
+func parseCateringAction(c *fiber.Ctx) (uuid.UUID, int, error) {
+	requestID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid catering request ID")
+	}
+
+	var req cateringActionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return uuid.Nil, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	return requestID, req.Version, nil
+}
+
+// SubmitCateringRequest handles POST /catering
+func (h *Handlers) SubmitCateringRequest(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.SubmitCateringRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.UserID = userID
+
+	request, err := h.cateringUsecase.SubmitRequest(c.Context(), req)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to submit catering request", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to submit catering request")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    request,
+		Message: "We'll send you a quote shortly",
+	})
+}
+
+// GetUserCateringRequests handles GET /catering
+func (h *Handlers) GetUserCateringRequests(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requests, err := h.cateringUsecase.GetUserRequests(c.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch catering requests", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch catering requests")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    requests,
+	})
+}
+
+// GetCateringRequest handles GET /catering/:id and GET /admin/catering/:id
+func (h *Handlers) GetCateringRequest(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid catering request ID")
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	request, err := h.cateringUsecase.GetRequest(c.Context(), userID, requestID, isAdmin)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch catering request", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch catering request")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    request,
+	})
+}
+
+// AcceptCateringQuote handles POST /catering/:id/accept
+// Body: {"version": n} - the version the quote was read at
+func (h *Handlers) AcceptCateringQuote(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, version, err := parseCateringAction(c)
+	if err != nil {
+		return err
+	}
+
+	request, err := h.cateringUsecase.AcceptQuote(c.Context(), userID, requestID, version)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to accept catering quote", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to accept quote")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    request,
+		Message: "Quote accepted, please pay the advance to confirm",
+	})
+}
+
+// DeclineCateringQuote handles POST /catering/:id/decline
+func (h *Handlers) DeclineCateringQuote(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, version, err := parseCateringAction(c)
+	if err != nil {
+		return err
+	}
+
+	request, err := h.cateringUsecase.DeclineQuote(c.Context(), userID, requestID, version)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to decline catering quote", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to decline quote")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    request,
+		Message: "Quote declined",
+	})
+}
+
+// CancelCateringRequest handles POST /catering/:id/cancel and
+// POST /admin/catering/:id/cancel
+func (h *Handlers) CancelCateringRequest(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, version, err := parseCateringAction(c)
+	if err != nil {
+		return err
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	request, err := h.cateringUsecase.CancelRequest(c.Context(), userID, requestID, version, isAdmin)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to cancel catering request", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to cancel catering request")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    request,
+		Message: "Catering request cancelled",
+	})
+}
+
+// PayCateringRequest handles POST /catering/:id/pay
+// Returns the payment for the advance, or for the balance once the advance
+// is paid. Verify it with POST /orders/verify.
+func (h *Handlers) PayCateringRequest(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid catering request ID")
+	}
+
+	payment, err := h.cateringUsecase.Pay(c.Context(), userID, requestID)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to start catering payment", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start payment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    payment,
+	})
+}
+
+// GetCateringRequests handles GET /admin/catering
+// Query: status (comma-separated; defaults to REQUESTED, QUOTED, ACCEPTED)
+func (h *Handlers) GetCateringRequests(c *fiber.Ctx) error {
+	requests, err := h.cateringUsecase.ListRequests(c.Context(), queryList(c, "status"))
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch catering requests", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch catering requests")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    requests,
+	})
+}
+
+// QuoteCateringRequest handles POST /admin/catering/:id/quote
+func (h *Handlers) QuoteCateringRequest(c *fiber.Ctx) error {
+	adminID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	requestID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid catering request ID")
+	}
+
+	var req usecase.QuoteCateringRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	request, err := h.cateringUsecase.QuoteRequest(c.Context(), adminID, requestID, req)
+	if err != nil {
+		if fiberErr := cateringError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to quote catering request", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to quote catering request")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    request,
+		Message: "Quote sent",
+	})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+	"fooddelivery/pkg/export"
+)
+
+// exportStreamTimeout bounds a report streamed in the response. The handler
+// has returned by the time the body is written, so the request context
+// cannot be used.
+const exportStreamTimeout = 5 * time.Minute
+
+// exportError maps export errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func exportError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidExport), errors.Is(err, usecase.ErrInvalidFilter):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrExportNotReady):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Export not found")
+	}
+	return nil
+}
+
+// ExportReport handles GET /admin/exports/:kind
+// kind: orders, items or payments
+// Query: format (csv or xlsx; default csv), from, to (as for analytics), async
+// Small reports download directly; large ones, or any with async=true, are
+// queued and answered with 202 and the job to poll.
+func (h *Handlers) ExportReport(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	req := usecase.ExportRequest{
+		Kind:   domain.ExportKind(c.Params("kind")),
+		Format: export.Format(c.Query("format")),
+		Range:  analyticsRange(c),
+		Async:  c.QueryBool("async"),
+	}
+
+	stream, job, err := h.exportUsecase.Export(c.Context(), req, userID)
+	if err != nil {
+		if fiberErr := exportError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to export report", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to export report")
+	}
+
+	if job != nil {
+		return c.Status(fiber.StatusAccepted).JSON(SuccessResponse{
+			Success: true,
+			Data:    job,
+			Message: "Export queued",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, stream.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, stream.FileName))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), exportStreamTimeout)
+		defer cancel()
+
+		// The status is already sent, so a failure can only cut the file short
+		if _, err := stream.WriteTo(ctx, w); err != nil {
+			h.log.Error("Failed to stream export", "error", err, "file", stream.FileName)
+		}
+	})
+
+	return nil
+}
+
+// ExportTally handles GET /admin/exports/tally
+// Query: from, to (as for analytics)
+// Returns a Tally XML import file of daily sales, refund and gateway fee vouchers
+func (h *Handlers) ExportTally(c *fiber.Ctx) error {
+	var buf bytes.Buffer
+	fileName, err := h.accountingUsecase.ExportTally(c.Context(), analyticsRange(c), &buf)
+	if err != nil {
+		if fiberErr := exportError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to export tally vouchers", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to export tally vouchers")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	return c.Send(buf.Bytes())
+}
+
+// GetExportJobs handles GET /admin/exports/jobs
+// Query: limit (default 20, max 100)
+func (h *Handlers) GetExportJobs(c *fiber.Ctx) error {
+	jobs, err := h.exportUsecase.ListJobs(c.Context(), c.QueryInt("limit", 20))
+	if err != nil {
+		h.log.Error("Failed to fetch export jobs", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch export jobs")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    jobs,
+	})
+}
+
+// GetExportJob handles GET /admin/exports/jobs/:id
+func (h *Handlers) GetExportJob(c *fiber.Ctx) error {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid export ID")
+	}
+
+	job, err := h.exportUsecase.GetJob(c.Context(), jobID)
+	if err != nil {
+		if fiberErr := exportError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch export job", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch export job")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// DownloadExport handles GET /admin/exports/jobs/:id/download
+// 409 until the job is done
+func (h *Handlers) DownloadExport(c *fiber.Ctx) error {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid export ID")
+	}
+
+	job, err := h.exportUsecase.GetDownload(c.Context(), jobID)
+	if err != nil {
+		if fiberErr := exportError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to download export", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to download export")
+	}
+
+	c.Set(fiber.HeaderContentType, export.Format(job.Format).ContentType())
+	return c.Download(job.FilePath, job.FileName)
+}
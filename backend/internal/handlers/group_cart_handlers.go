@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// groupCartError maps group cart errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func groupCartError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Group cart or item not found")
+	case errors.Is(err, repository.ErrNotGroupMember):
+		return fiber.NewError(fiber.StatusForbidden, "Join the group cart first")
+	case errors.Is(err, usecase.ErrNotGroupHost):
+		return fiber.NewError(fiber.StatusForbidden, "Only the host can do this")
+	case errors.Is(err, repository.ErrGroupCartClosed):
+		return fiber.NewError(fiber.StatusConflict, "This group cart is no longer open")
+	case errors.Is(err, repository.ErrGroupCartFull):
+		return fiber.NewError(fiber.StatusConflict, "This group cart is full")
+	case errors.Is(err, usecase.ErrGroupCartNotLocked):
+		return fiber.NewError(fiber.StatusConflict, "Lock the group cart before checking out")
+	case errors.Is(err, repository.ErrVersionConflict):
+		return fiber.NewError(fiber.StatusConflict, "The group cart changed, please review it again")
+	case errors.Is(err, usecase.ErrInvalidSelection):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrInvalidCart):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cart")
+	case errors.Is(err, usecase.ErrItemNotAvailable):
+		return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
+	case errors.Is(err, usecase.ErrNotesTooLong):
+		return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+	}
+	return fulfillmentError(err)
+}
+
+// parseGroupCartID parses the :id route param of a group cart
+func parseGroupCartID(c *fiber.Ctx) (uuid.UUID, error) {
+	cartID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Invalid group cart ID")
+	}
+	return cartID, nil
+}
+
+// groupCartResponse writes a group cart or maps the error of the action that produced it
+func (h *Handlers) groupCartResponse(c *fiber.Ctx, cart *domain.GroupCart, err error, action string) error {
+	if err != nil {
+		if fiberErr := groupCartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to "+action, "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to "+action)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// CreateGroupCartRequest opens a group cart
+type CreateGroupCartRequest struct {
+	Notes string `json:"notes"`
+}
+
+// CreateGroupCart handles POST /group-carts
+func (h *Handlers) CreateGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req CreateGroupCartRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	cart, err := h.groupCartUsecase.CreateGroupCart(c.Context(), userID, req.Notes)
+	if err != nil {
+		return h.groupCartResponse(c, nil, err, "create group cart")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    cart,
+	})
+}
+
+// JoinGroupCartRequest carries the code from an invite link
+type JoinGroupCartRequest struct {
+	InviteCode string `json:"invite_code"`
+}
+
+// JoinGroupCart handles POST /group-carts/join
+func (h *Handlers) JoinGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req JoinGroupCartRequest
+	if err := c.BodyParser(&req); err != nil || req.InviteCode == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Invite code is required")
+	}
+
+	cart, err := h.groupCartUsecase.JoinGroupCart(c.Context(), userID, req.InviteCode)
+	return h.groupCartResponse(c, cart, err, "join group cart")
+}
+
+// GetGroupCart handles GET /group-carts/:id
+func (h *Handlers) GetGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.groupCartUsecase.GetGroupCart(c.Context(), cartID, userID)
+	return h.groupCartResponse(c, cart, err, "fetch group cart")
+}
+
+// AddGroupCartItem handles POST /group-carts/:id/items
+func (h *Handlers) AddGroupCartItem(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	var item domain.CartItem
+	if err := c.BodyParser(&item); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	cart, err := h.groupCartUsecase.AddItem(c.Context(), cartID, userID, item)
+	return h.groupCartResponse(c, cart, err, "add item")
+}
+
+// UpdateGroupCartItemRequest changes one of the member's lines
+type UpdateGroupCartItemRequest struct {
+	Quantity int    `json:"quantity"`
+	Notes    string `json:"notes"`
+}
+
+// UpdateGroupCartItem handles PUT /group-carts/:id/items/:itemId
+func (h *Handlers) UpdateGroupCartItem(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	itemID, err := uuid.Parse(c.Params("itemId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid item ID")
+	}
+
+	var req UpdateGroupCartItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	cart, err := h.groupCartUsecase.UpdateItem(c.Context(), cartID, itemID, userID, req.Quantity, req.Notes)
+	return h.groupCartResponse(c, cart, err, "update item")
+}
+
+// RemoveGroupCartItem handles DELETE /group-carts/:id/items/:itemId
+func (h *Handlers) RemoveGroupCartItem(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	itemID, err := uuid.Parse(c.Params("itemId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid item ID")
+	}
+
+	cart, err := h.groupCartUsecase.RemoveItem(c.Context(), cartID, itemID, userID)
+	return h.groupCartResponse(c, cart, err, "remove item")
+}
+
+// LockGroupCartRequest carries the cart version the host reviewed
+type LockGroupCartRequest struct {
+	Version int `json:"version"`
+}
+
+// LockGroupCart handles POST /group-carts/:id/lock
+func (h *Handlers) LockGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	var req LockGroupCartRequest
+	if err := c.BodyParser(&req); err != nil || req.Version <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Cart version is required")
+	}
+
+	cart, err := h.groupCartUsecase.Lock(c.Context(), cartID, userID, req.Version)
+	return h.groupCartResponse(c, cart, err, "lock group cart")
+}
+
+// UnlockGroupCart handles POST /group-carts/:id/unlock
+func (h *Handlers) UnlockGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.groupCartUsecase.Unlock(c.Context(), cartID, userID)
+	return h.groupCartResponse(c, cart, err, "unlock group cart")
+}
+
+// CancelGroupCart handles POST /group-carts/:id/cancel
+func (h *Handlers) CancelGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	cart, err := h.groupCartUsecase.Cancel(c.Context(), cartID, userID)
+	return h.groupCartResponse(c, cart, err, "cancel group cart")
+}
+
+// CheckoutGroupCart handles POST /group-carts/:id/checkout
+func (h *Handlers) CheckoutGroupCart(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	cartID, err := parseGroupCartID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.GroupCheckoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	req.CartID = cartID
+	req.HostID = userID
+
+	resp, err := h.groupCartUsecase.Checkout(c.Context(), req)
+	if err != nil {
+		if fiberErr := groupCartError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to check out group cart", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create order")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    resp,
+	})
+}
@@ -4,6 +4,8 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,11 +20,27 @@ import (
 
 // Handlers aggregates all HTTP handlers
 type Handlers struct {
-	menuUsecase    *usecase.MenuUsecase
-	orderUsecase   *usecase.OrderUsecase
-	paymentUsecase *usecase.PaymentUsecase
-	userUsecase    *usecase.UserUsecase
-	log            *logger.Logger
+	menuUsecase              *usecase.MenuUsecase
+	orderUsecase             *usecase.OrderUsecase
+	paymentUsecase           *usecase.PaymentUsecase
+	userUsecase              *usecase.UserUsecase
+	kitchenUsecase           *usecase.KitchenUsecase
+	tableUsecase             *usecase.TableUsecase
+	billUsecase              *usecase.BillUsecase
+	groupCartUsecase         *usecase.GroupCartUsecase
+	cartUsecase              *usecase.CartUsecase
+	orderModificationUsecase *usecase.OrderModificationUsecase
+	reviewUsecase            *usecase.ReviewUsecase
+	cateringUsecase          *usecase.CateringUsecase
+	subscriptionUsecase      *usecase.SubscriptionUsecase
+	notificationUsecase      *usecase.NotificationUsecase
+	analyticsUsecase         *usecase.AnalyticsUsecase
+	exportUsecase            *usecase.ExportUsecase
+	accountingUsecase        *usecase.AccountingUsecase
+	settlementUsecase        *usecase.SettlementUsecase
+	integrityUsecase         *usecase.IntegrityUsecase
+	stockUsecase             *usecase.StockUsecase
+	log                      *logger.Logger
 }
 
 // NewHandlers creates a new handlers instance
@@ -31,17 +49,55 @@ func NewHandlers(
 	orderUsecase *usecase.OrderUsecase,
 	paymentUsecase *usecase.PaymentUsecase,
 	userUsecase *usecase.UserUsecase,
+	kitchenUsecase *usecase.KitchenUsecase,
+	tableUsecase *usecase.TableUsecase,
+	billUsecase *usecase.BillUsecase,
+	groupCartUsecase *usecase.GroupCartUsecase,
+	cartUsecase *usecase.CartUsecase,
+	orderModificationUsecase *usecase.OrderModificationUsecase,
+	reviewUsecase *usecase.ReviewUsecase,
+	cateringUsecase *usecase.CateringUsecase,
+	subscriptionUsecase *usecase.SubscriptionUsecase,
+	notificationUsecase *usecase.NotificationUsecase,
+	analyticsUsecase *usecase.AnalyticsUsecase,
+	exportUsecase *usecase.ExportUsecase,
+	accountingUsecase *usecase.AccountingUsecase,
+	settlementUsecase *usecase.SettlementUsecase,
+	integrityUsecase *usecase.IntegrityUsecase,
+	stockUsecase *usecase.StockUsecase,
 	log *logger.Logger,
 ) *Handlers {
 	return &Handlers{
-		menuUsecase:    menuUsecase,
-		orderUsecase:   orderUsecase,
-		paymentUsecase: paymentUsecase,
-		userUsecase:    userUsecase,
-		log:            log,
+		menuUsecase:              menuUsecase,
+		orderUsecase:             orderUsecase,
+		paymentUsecase:           paymentUsecase,
+		userUsecase:              userUsecase,
+		kitchenUsecase:           kitchenUsecase,
+		tableUsecase:             tableUsecase,
+		billUsecase:              billUsecase,
+		groupCartUsecase:         groupCartUsecase,
+		cartUsecase:              cartUsecase,
+		orderModificationUsecase: orderModificationUsecase,
+		reviewUsecase:            reviewUsecase,
+		cateringUsecase:          cateringUsecase,
+		subscriptionUsecase:      subscriptionUsecase,
+		notificationUsecase:      notificationUsecase,
+		analyticsUsecase:         analyticsUsecase,
+		exportUsecase:            exportUsecase,
+		accountingUsecase:        accountingUsecase,
+		settlementUsecase:        settlementUsecase,
+		integrityUsecase:         integrityUsecase,
+		stockUsecase:             stockUsecase,
+		log:                      log,
 	}
 }
 
+// notesTooLongMessage is returned when special instructions exceed the limits
+var notesTooLongMessage = fmt.Sprintf(
+	"Special instructions are too long (max %d characters per order, %d per item)",
+	domain.MaxOrderNotesLength, domain.MaxItemNotesLength,
+)
+
 // ContextKeyUserID is the key for storing user ID in Fiber context
 const ContextKeyUserID = "user_id"
 const ContextKeyIsAdmin = "is_admin"
@@ -153,6 +209,9 @@ func (h *Handlers) Register(c *fiber.Ctx) error {
 		if errors.Is(err, usecase.ErrWeakPassword) {
 			return fiber.NewError(fiber.StatusBadRequest, "Password must be at least 8 characters")
 		}
+		if errors.Is(err, usecase.ErrInvalidLanguage) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 		h.log.Error("Registration failed", "error", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Registration failed")
 	}
@@ -371,7 +430,10 @@ func (h *Handlers) InvalidateMenuCache(c *fiber.Ctx) error {
 
 // CreateOrderRequest for order creation
 type CreateOrderRequest struct {
-	Items []domain.CartItem `json:"items"`
+	Items           []domain.CartItem      `json:"items"`
+	Notes           string                 `json:"notes"`
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"` // delivery (default) or pickup
+	DeliveryAddress string                 `json:"delivery_address"`
 }
 
 // CreateOrder handles POST /orders/create
@@ -391,18 +453,30 @@ func (h *Handlers) CreateOrder(c *fiber.Ctx) error {
 	}
 
 	paymentReq := usecase.InitiateOrderRequest{
-		UserID: userID,
-		Items:  req.Items,
+		UserID:          userID,
+		Items:           req.Items,
+		Notes:           req.Notes,
+		FulfillmentType: req.FulfillmentType,
+		DeliveryAddress: req.DeliveryAddress,
 	}
 
 	resp, err := h.paymentUsecase.InitiateOrder(c.Context(), paymentReq)
 	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidSelection) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 		if errors.Is(err, usecase.ErrInvalidCart) {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid cart")
 		}
 		if errors.Is(err, usecase.ErrItemNotAvailable) {
 			return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
 		}
+		if errors.Is(err, usecase.ErrNotesTooLong) {
+			return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+		}
+		if fiberErr := fulfillmentError(err); fiberErr != nil {
+			return fiberErr
+		}
 		h.log.Error("Failed to create order", "error", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create order")
 	}
@@ -413,21 +487,64 @@ func (h *Handlers) CreateOrder(c *fiber.Ctx) error {
 	})
 }
 
+// fulfillmentError maps fulfillment validation errors to client errors.
+// Returns nil for any other error.
+func fulfillmentError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidFulfillment):
+		return fiber.NewError(fiber.StatusBadRequest, "Fulfillment type must be delivery or pickup")
+	case errors.Is(err, usecase.ErrAddressTooLong):
+		return fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("Delivery address must be at most %d characters", domain.MaxDeliveryAddressLength))
+	}
+	return nil
+}
+
+// legacyOrderHistoryLimit is how many orders GET /orders lists for app
+// versions that do not paginate
+const legacyOrderHistoryLimit = 100
+
 // GetUserOrders handles GET /orders
+// Query: status (comma-separated), cursor, limit, view=summary
+// With cursor or limit the response is a page; without, a plain list of the
+// latest orders as older app versions expect
 func (h *Handlers) GetUserOrders(c *fiber.Ctx) error {
 	userID, err := getUserID(c)
 	if err != nil {
 		return err
 	}
 
-	orders, err := h.orderUsecase.GetUserOrders(c.Context(), userID)
+	paginated := c.Query("cursor") != "" || c.Query("limit") != ""
+
+	query := usecase.OrderHistoryQuery{
+		Statuses: queryList(c, "status"),
+		Cursor:   c.Query("cursor"),
+		Limit:    c.QueryInt("limit", 20),
+		Summary:  c.Query("view") == "summary",
+	}
+	if !paginated {
+		query.Limit = legacyOrderHistoryLimit
+	}
+
+	page, err := h.orderUsecase.GetUserOrders(c.Context(), userID, query)
 	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidFilter) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		h.log.Error("Failed to fetch user orders", "error", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch orders")
 	}
 
+	if !paginated {
+		return c.JSON(SuccessResponse{
+			Success: true,
+			Data:    page.Orders,
+		})
+	}
+
 	return c.JSON(SuccessResponse{
 		Success: true,
-		Data:    orders,
+		Data:    page,
 	})
 }
 
@@ -463,6 +580,69 @@ func (h *Handlers) GetOrder(c *fiber.Ctx) error {
 	})
 }
 
+// ReorderOrder handles POST /orders/:id/reorder
+func (h *Handlers) ReorderOrder(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	// Body is optional - an empty body returns a preview
+	var req usecase.ReorderRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	resp, err := h.orderUsecase.Reorder(c.Context(), userID, orderID, req)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Order not found")
+		}
+		if errors.Is(err, usecase.ErrOrderAccessDenied) {
+			return fiber.NewError(fiber.StatusForbidden, "Access denied")
+		}
+		if errors.Is(err, usecase.ErrNothingToReorder) {
+			return c.Status(fiber.StatusConflict).JSON(SuccessResponse{
+				Success: false,
+				Data:    resp,
+				Message: "None of the items in this order are available",
+			})
+		}
+		if errors.Is(err, usecase.ErrPartialReorder) {
+			return c.Status(fiber.StatusConflict).JSON(SuccessResponse{
+				Success: false,
+				Data:    resp,
+				Message: "Some items in this order are no longer available, confirm with allow_partial to order the rest",
+			})
+		}
+		if errors.Is(err, usecase.ErrItemNotAvailable) {
+			return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
+		}
+		if fiberErr := fulfillmentError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to reorder", "error", err, "order_id", orderID.String())
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to reorder")
+	}
+
+	status := fiber.StatusOK
+	if resp.Order != nil {
+		status = fiber.StatusCreated
+	}
+
+	return c.Status(status).JSON(SuccessResponse{
+		Success: true,
+		Data:    resp,
+	})
+}
+
 // VerifyPayment handles POST /orders/verify
 func (h *Handlers) VerifyPayment(c *fiber.Ctx) error {
 	var req usecase.VerifyPaymentRequest
@@ -475,6 +655,12 @@ func (h *Handlers) VerifyPayment(c *fiber.Ctx) error {
 		if errors.Is(err, usecase.ErrInvalidSignature) {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid payment signature")
 		}
+		if errors.Is(err, usecase.ErrPaymentMismatch) {
+			return fiber.NewError(fiber.StatusBadRequest, "Payment does not belong to this order")
+		}
+		if errors.Is(err, usecase.ErrSoldOutRefunded) {
+			return fiber.NewError(fiber.StatusConflict, "Sorry, an item sold out before your payment arrived. Your payment will be refunded.")
+		}
 		if errors.Is(err, repository.ErrNotFound) {
 			return fiber.NewError(fiber.StatusNotFound, "Order not found")
 		}
@@ -488,18 +674,158 @@ func (h *Handlers) VerifyPayment(c *fiber.Ctx) error {
 }
 
 // GetAllOrders handles GET /admin/orders
+// Filters: status (comma-separated or repeated), from, to, phone, email,
+// min_amount, max_amount, payment_id, razorpay_order_id.
+// Paging: sort (created_at|updated_at), order (desc|asc), cursor, limit.
 func (h *Handlers) GetAllOrders(c *fiber.Ctx) error {
-	limit := c.QueryInt("limit", 50)
-	offset := c.QueryInt("offset", 0)
+	query := usecase.OrderSearchQuery{
+		From:            c.Query("from"),
+		To:              c.Query("to"),
+		UserPhone:       c.Query("phone"),
+		UserEmail:       c.Query("email"),
+		PaymentID:       c.Query("payment_id"),
+		RazorpayOrderID: c.Query("razorpay_order_id"),
+		SortBy:          c.Query("sort"),
+		Order:           c.Query("order"),
+		Cursor:          c.Query("cursor"),
+		Limit:           c.QueryInt("limit", 50),
+	}
+
+	query.Statuses = queryList(c, "status")
+
+	var err error
+	if query.MinAmount, err = queryInt64(c, "min_amount"); err != nil {
+		return err
+	}
+	if query.MaxAmount, err = queryInt64(c, "max_amount"); err != nil {
+		return err
+	}
 
-	orders, err := h.orderUsecase.GetAllOrders(c.Context(), limit, offset)
+	page, err := h.orderUsecase.GetAllOrders(c.Context(), query)
 	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidFilter) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		h.log.Error("Failed to search orders", "error", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch orders")
 	}
 
 	return c.JSON(SuccessResponse{
 		Success: true,
-		Data:    orders,
+		Data:    page,
+	})
+}
+
+// queryList collects a list query parameter given either comma-separated
+// (?status=PAID,ACCEPTED) or repeated (?status=PAID&status=ACCEPTED)
+func queryList(c *fiber.Ctx, key string) []string {
+	var values []string
+	for _, raw := range c.Context().QueryArgs().PeekMulti(key) {
+		for _, value := range strings.Split(string(raw), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// queryInt64 parses an optional integer query parameter
+func queryInt64(c *fiber.Ctx, key string) (*int64, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid "+key)
+	}
+	return &value, nil
+}
+
+// GetKitchenQueue handles GET /admin/kitchen/orders
+func (h *Handlers) GetKitchenQueue(c *fiber.Ctx) error {
+	tickets, err := h.kitchenUsecase.GetQueue(c.Context())
+	if err != nil {
+		h.log.Error("Failed to fetch kitchen queue", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch kitchen queue")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    tickets,
+	})
+}
+
+// GetKitchenTicket handles GET /admin/orders/:id/ticket
+// Use ?format=text for a plain-text ticket ready for a thermal printer.
+func (h *Handlers) GetKitchenTicket(c *fiber.Ctx) error {
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	ticket, err := h.kitchenUsecase.GetTicket(c.Context(), orderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Order not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch order")
+	}
+
+	if c.Query("format") == "text" {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(ticket.Text)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    ticket,
+	})
+}
+
+// GetPickupOrder handles GET /admin/orders/pickup/:code
+func (h *Handlers) GetPickupOrder(c *fiber.Ctx) error {
+	order, err := h.orderUsecase.GetOrderByPickupCode(c.Context(), c.Params("code"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "No active pickup order with this code")
+		}
+		h.log.Error("Failed to look up pickup order", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch order")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    order,
+	})
+}
+
+// CollectPickupOrder handles POST /admin/orders/pickup/:code/collect
+func (h *Handlers) CollectPickupOrder(c *fiber.Ctx) error {
+	order, err := h.orderUsecase.CollectPickup(c.Context(), c.Params("code"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "No active pickup order with this code")
+		}
+		if errors.Is(err, usecase.ErrNotReadyToCollect) {
+			return c.Status(fiber.StatusConflict).JSON(SuccessResponse{
+				Success: false,
+				Data:    order,
+				Message: "Order is not ready for pickup yet",
+			})
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return fiber.NewError(fiber.StatusConflict, "Order was updated concurrently, please retry")
+		}
+		h.log.Error("Failed to collect pickup order", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update order")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    order,
+		Message: "Order collected",
 	})
 }
 
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetIntegrityFindings handles GET /admin/integrity/findings
+// Query: status (open, resolved or all; default open), check, order_id,
+// limit (default 100, max 1000)
+func (h *Handlers) GetIntegrityFindings(c *fiber.Ctx) error {
+	var orderID *uuid.UUID
+	if value := c.Query("order_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+		}
+		orderID = &id
+	}
+
+	findings, err := h.integrityUsecase.GetFindings(c.Context(), c.Query("status"), c.Query("check"), orderID, c.QueryInt("limit", 100))
+	return h.respondAnalytics(c, findings, err, "integrity findings")
+}
+
+// GetIntegrityRuns handles GET /admin/integrity/runs
+// Query: limit (default and max 100)
+func (h *Handlers) GetIntegrityRuns(c *fiber.Ctx) error {
+	runs, err := h.integrityUsecase.GetRuns(c.Context(), c.QueryInt("limit", 100))
+	return h.respondAnalytics(c, runs, err, "integrity runs")
+}
+
+// RunIntegrityChecks handles POST /admin/integrity/run
+// Runs every check now, outside the nightly schedule
+func (h *Handlers) RunIntegrityChecks(c *fiber.Ctx) error {
+	run, err := h.integrityUsecase.Run(c.Context())
+	if err != nil {
+		h.log.Error("Failed to run integrity checks", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to run integrity checks")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    run,
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// MenuVariantRequest is the body for creating or updating a menu variant
+type MenuVariantRequest struct {
+	Name        string `json:"name"`
+	Price       int64  `json:"price"`        // Paisa
+	IsAvailable *bool  `json:"is_available"` // Defaults to true
+	SortOrder   int    `json:"sort_order"`
+}
+
+// menuVariantError maps menu variant errors to HTTP errors
+func (h *Handlers) menuVariantError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidVariant):
+		return fiber.NewError(fiber.StatusBadRequest, "Variant needs a name of at most 50 characters and a positive price")
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Menu item or variant not found")
+	case errors.Is(err, repository.ErrDuplicateKey):
+		return fiber.NewError(fiber.StatusConflict, "The item already has a variant with this name")
+	}
+	h.log.Error("Failed to save menu variant", "error", err)
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to save menu variant")
+}
+
+// parseMenuVariant reads the menu item and variant IDs and the body of a
+// variant request
+func parseMenuVariant(c *fiber.Ctx, withVariantID bool) (*domain.MenuVariant, error) {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+
+	var req MenuVariantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	v := &domain.MenuVariant{
+		MenuItemID:  menuItemID,
+		Name:        req.Name,
+		Price:       req.Price,
+		IsAvailable: req.IsAvailable == nil || *req.IsAvailable,
+		SortOrder:   req.SortOrder,
+	}
+
+	if withVariantID {
+		if v.ID, err = uuid.Parse(c.Params("variantId")); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid variant ID")
+		}
+	}
+
+	return v, nil
+}
+
+// CreateMenuVariant handles POST /admin/menu/:id/variants
+func (h *Handlers) CreateMenuVariant(c *fiber.Ctx) error {
+	v, err := parseMenuVariant(c, false)
+	if err != nil {
+		return err
+	}
+
+	if err := h.menuUsecase.CreateVariant(c.Context(), v); err != nil {
+		return h.menuVariantError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    v,
+	})
+}
+
+// UpdateMenuVariant handles PUT /admin/menu/:id/variants/:variantId
+func (h *Handlers) UpdateMenuVariant(c *fiber.Ctx) error {
+	v, err := parseMenuVariant(c, true)
+	if err != nil {
+		return err
+	}
+
+	if err := h.menuUsecase.UpdateVariant(c.Context(), v); err != nil {
+		return h.menuVariantError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    v,
+	})
+}
+
+// DeleteMenuVariant handles DELETE /admin/menu/:id/variants/:variantId
+func (h *Handlers) DeleteMenuVariant(c *fiber.Ctx) error {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+	variantID, err := uuid.Parse(c.Params("variantId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid variant ID")
+	}
+
+	if err := h.menuUsecase.DeleteVariant(c.Context(), menuItemID, variantID); err != nil {
+		return h.menuVariantError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Menu variant deleted",
+	})
+}
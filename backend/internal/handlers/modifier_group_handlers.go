@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// ModifierGroupRequest is the body for creating or updating a modifier group.
+// On update, options with an id are changed, options without one are added
+// and the group's other options are removed.
+type ModifierGroupRequest struct {
+	Name      string                  `json:"name"`
+	MinSelect int                     `json:"min_select"` // 0 for an optional group
+	MaxSelect int                     `json:"max_select"`
+	SortOrder int                     `json:"sort_order"`
+	Options   []ModifierOptionRequest `json:"options"`
+}
+
+// ModifierOptionRequest is one option of a modifier group request
+type ModifierOptionRequest struct {
+	ID          *uuid.UUID `json:"id,omitempty"`
+	Name        string     `json:"name"`
+	Price       int64      `json:"price"`        // Paisa
+	IsAvailable *bool      `json:"is_available"` // Defaults to true
+	SortOrder   int        `json:"sort_order"`
+}
+
+// modifierGroupError maps modifier group errors to HTTP errors
+func (h *Handlers) modifierGroupError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidModifierGroup):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Menu item, modifier group or option not found")
+	case errors.Is(err, repository.ErrDuplicateKey):
+		return fiber.NewError(fiber.StatusConflict, "The item already has a modifier group with this name")
+	}
+	h.log.Error("Failed to save modifier group", "error", err)
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to save modifier group")
+}
+
+// parseModifierGroup reads the menu item and group IDs and the body of a
+// modifier group request
+func parseModifierGroup(c *fiber.Ctx, withGroupID bool) (*domain.ModifierGroup, error) {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+
+	var req ModifierGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	g := &domain.ModifierGroup{
+		MenuItemID: menuItemID,
+		Name:       req.Name,
+		MinSelect:  req.MinSelect,
+		MaxSelect:  req.MaxSelect,
+		SortOrder:  req.SortOrder,
+		Options:    make([]domain.ModifierOption, len(req.Options)),
+	}
+	for i, o := range req.Options {
+		g.Options[i] = domain.ModifierOption{
+			Name:        o.Name,
+			Price:       o.Price,
+			IsAvailable: o.IsAvailable == nil || *o.IsAvailable,
+			SortOrder:   o.SortOrder,
+		}
+		if o.ID != nil && withGroupID {
+			g.Options[i].ID = *o.ID
+		}
+	}
+
+	if withGroupID {
+		if g.ID, err = uuid.Parse(c.Params("groupId")); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid modifier group ID")
+		}
+	}
+
+	return g, nil
+}
+
+// CreateModifierGroup handles POST /admin/menu/:id/modifier-groups
+func (h *Handlers) CreateModifierGroup(c *fiber.Ctx) error {
+	g, err := parseModifierGroup(c, false)
+	if err != nil {
+		return err
+	}
+
+	if err := h.menuUsecase.CreateModifierGroup(c.Context(), g); err != nil {
+		return h.modifierGroupError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    g,
+	})
+}
+
+// UpdateModifierGroup handles PUT /admin/menu/:id/modifier-groups/:groupId
+func (h *Handlers) UpdateModifierGroup(c *fiber.Ctx) error {
+	g, err := parseModifierGroup(c, true)
+	if err != nil {
+		return err
+	}
+
+	if err := h.menuUsecase.UpdateModifierGroup(c.Context(), g); err != nil {
+		return h.modifierGroupError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    g,
+	})
+}
+
+// DeleteModifierGroup handles DELETE /admin/menu/:id/modifier-groups/:groupId
+func (h *Handlers) DeleteModifierGroup(c *fiber.Ctx) error {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+	groupID, err := uuid.Parse(c.Params("groupId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid modifier group ID")
+	}
+
+	if err := h.menuUsecase.DeleteModifierGroup(c.Context(), menuItemID, groupID); err != nil {
+		return h.modifierGroupError(err)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Modifier group deleted",
+	})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// notificationError maps notification errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func notificationError(err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidDevice), errors.Is(err, usecase.ErrInvalidFilter),
+		errors.Is(err, usecase.ErrInvalidPreferences), errors.Is(err, usecase.ErrInvalidPromotion):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// RegisterDevice handles POST /devices
+// Registers the app install's FCM token for push notifications. Calling it
+// again with the same token is safe, e.g. on every app start.
+func (h *Handlers) RegisterDevice(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.RegisterDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	device, err := h.notificationUsecase.RegisterDevice(c.Context(), userID, req)
+	if err != nil {
+		if fiberErr := notificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to register device", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to register device")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    device,
+	})
+}
+
+// UnregisterDevice handles DELETE /devices/:token
+func (h *Handlers) UnregisterDevice(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationUsecase.UnregisterDevice(c.Context(), userID, c.Params("token")); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Device not found")
+		}
+		if fiberErr := notificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to unregister device", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to unregister device")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Device unregistered",
+	})
+}
+
+// GetNotifications handles GET /admin/notifications
+// Query: status (comma-separated), user_id, limit (default 50, max 200)
+func (h *Handlers) GetNotifications(c *fiber.Ctx) error {
+	var userID *uuid.UUID
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+		}
+		userID = &id
+	}
+
+	notifications, err := h.notificationUsecase.GetNotifications(c.Context(), queryList(c, "status"), userID, c.QueryInt("limit", 50))
+	if err != nil {
+		if fiberErr := notificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch notifications", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch notifications")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    notifications,
+	})
+}
+
+// respondPreferences writes notification preferences or maps the error
+func (h *Handlers) respondPreferences(c *fiber.Ctx, data interface{}, err error, action string) error {
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "User not found")
+		}
+		if fiberErr := notificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to "+action, "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to "+action)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// updatePreferences applies a preferences update on behalf of the caller
+func (h *Handlers) updatePreferences(c *fiber.Ctx, userID uuid.UUID, source domain.ConsentSource) error {
+	actorID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.UpdatePreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	actor := usecase.ConsentActor{
+		UserID:    actorID,
+		Source:    source,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+
+	prefs, err := h.notificationUsecase.UpdatePreferences(c.Context(), userID, req, actor)
+	return h.respondPreferences(c, prefs, err, "update notification preferences")
+}
+
+// GetMyNotificationPreferences handles GET /users/me/notification-preferences
+func (h *Handlers) GetMyNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	prefs, err := h.notificationUsecase.GetPreferences(c.Context(), userID)
+	return h.respondPreferences(c, prefs, err, "fetch notification preferences")
+}
+
+// UpdateMyNotificationPreferences handles PUT /users/me/notification-preferences
+// Body: any of language, marketing_opt_in, channels (per category), quiet_hours
+func (h *Handlers) UpdateMyNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return h.updatePreferences(c, userID, domain.ConsentSourceApp)
+}
+
+// GetMyConsentChanges handles GET /users/me/consents
+func (h *Handlers) GetMyConsentChanges(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	changes, err := h.notificationUsecase.GetConsentChanges(c.Context(), userID, c.QueryInt("limit", 50))
+	return h.respondPreferences(c, changes, err, "fetch consent changes")
+}
+
+// GetUserNotificationPreferences handles GET /admin/users/:id/notification-preferences
+func (h *Handlers) GetUserNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	prefs, err := h.notificationUsecase.GetPreferences(c.Context(), userID)
+	return h.respondPreferences(c, prefs, err, "fetch notification preferences")
+}
+
+// UpdateUserNotificationPreferences handles PUT /admin/users/:id/notification-preferences
+// For support acting on a customer's request, e.g. to stop SMS; logged with
+// the admin as the one who made the change
+func (h *Handlers) UpdateUserNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	return h.updatePreferences(c, userID, domain.ConsentSourceAdmin)
+}
+
+// GetUserConsentChanges handles GET /admin/users/:id/consents
+func (h *Handlers) GetUserConsentChanges(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	changes, err := h.notificationUsecase.GetConsentChanges(c.Context(), userID, c.QueryInt("limit", 50))
+	return h.respondPreferences(c, changes, err, "fetch consent changes")
+}
+
+// SendPromotion handles POST /admin/notifications/promotions
+// Queues the message for every user who opted in to marketing
+func (h *Handlers) SendPromotion(c *fiber.Ctx) error {
+	var req usecase.PromotionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	users, err := h.notificationUsecase.SendPromotion(c.Context(), req)
+	if err != nil {
+		if fiberErr := notificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to send promotion", "error", err, "users_queued", users)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to send promotion")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(SuccessResponse{
+		Success: true,
+		Data:    fiber.Map{"users": users},
+		Message: "Promotion queued",
+	})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// orderModificationError maps order edit errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func orderModificationError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Order not found")
+	case errors.Is(err, usecase.ErrModificationNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Order change not found")
+	case errors.Is(err, usecase.ErrOrderAccessDenied):
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	case errors.Is(err, repository.ErrOrderNotEditable):
+		return fiber.NewError(fiber.StatusConflict, "This order can no longer be changed")
+	case errors.Is(err, repository.ErrVersionConflict):
+		return fiber.NewError(fiber.StatusConflict, "Order was updated, please review it again")
+	case errors.Is(err, usecase.ErrNoOrderChange):
+		return fiber.NewError(fiber.StatusBadRequest, "Nothing was changed")
+	case errors.Is(err, usecase.ErrModificationPaymentMismatch):
+		return fiber.NewError(fiber.StatusBadRequest, "Payment does not belong to this order change")
+	case errors.Is(err, usecase.ErrInvalidSignature):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid payment signature")
+	case errors.Is(err, usecase.ErrInvalidSelection):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrInvalidCart):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cart")
+	case errors.Is(err, usecase.ErrItemNotAvailable):
+		return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
+	case errors.Is(err, usecase.ErrNotesTooLong):
+		return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+	}
+	return nil
+}
+
+// ModifyOrder handles POST /orders/:id/modify
+// Body: the complete new list of items and the order version being edited.
+// If the change costs more, the response carries a payment for the difference.
+func (h *Handlers) ModifyOrder(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	var req usecase.ModifyOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.UserID = userID
+	req.OrderID = orderID
+
+	resp, err := h.orderModificationUsecase.ModifyOrder(c.Context(), req)
+	if err != nil {
+		if fiberErr := orderModificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to modify order", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to change order")
+	}
+
+	message := "Order updated"
+	if resp.Payment != nil {
+		message = "Pay the difference to confirm the changes"
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    resp,
+		Message: message,
+	})
+}
+
+// VerifyOrderModification handles POST /orders/:id/modify/verify
+func (h *Handlers) VerifyOrderModification(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	var req usecase.VerifyPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	mod, err := h.orderModificationUsecase.VerifyModification(c.Context(), userID, orderID, req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
+	if err != nil {
+		if fiberErr := orderModificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to verify order modification payment", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify payment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    mod,
+		Message: "Payment verified",
+	})
+}
+
+// GetOrderRevisions handles GET /orders/:id/revisions
+func (h *Handlers) GetOrderRevisions(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	revisions, err := h.orderModificationUsecase.GetRevisions(c.Context(), userID, orderID, isAdmin)
+	if err != nil {
+		if fiberErr := orderModificationError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch order revisions", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch order history")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    revisions,
+	})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// reviewError maps review errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func reviewError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Review not found")
+	case errors.Is(err, usecase.ErrInvalidReview), errors.Is(err, usecase.ErrInvalidFilter):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrOrderNotReviewable):
+		return fiber.NewError(fiber.StatusConflict, "Orders can be reviewed once they are delivered")
+	case errors.Is(err, repository.ErrAlreadyReviewed):
+		return fiber.NewError(fiber.StatusConflict, "You have already reviewed this order")
+	case errors.Is(err, usecase.ErrOrderAccessDenied):
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	return nil
+}
+
+// SubmitReview handles POST /orders/:id/review
+func (h *Handlers) SubmitReview(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	var req usecase.SubmitReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.UserID = userID
+	req.OrderID = orderID
+
+	review, err := h.reviewUsecase.SubmitReview(c.Context(), req)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Order not found")
+		}
+		if fiberErr := reviewError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to submit review", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to submit review")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    review,
+		Message: "Thanks for your review",
+	})
+}
+
+// GetOrderReview handles GET /orders/:id/review
+func (h *Handlers) GetOrderReview(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid order ID")
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	review, err := h.reviewUsecase.GetOrderReview(c.Context(), userID, orderID, isAdmin)
+	if err != nil {
+		if fiberErr := reviewError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch review", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch review")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    review,
+	})
+}
+
+// GetMenuItemReviews handles GET /menu/:id/reviews
+// Query: limit (max 50), cursor (from next_cursor)
+func (h *Handlers) GetMenuItemReviews(c *fiber.Ctx) error {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+
+	page, err := h.reviewUsecase.GetMenuItemReviews(c.Context(), menuItemID, c.Query("cursor"), c.QueryInt("limit", 20))
+	if err != nil {
+		if fiberErr := reviewError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch menu item reviews", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch reviews")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// GetReviews handles GET /admin/reviews
+// Query: status (comma-separated VISIBLE, FLAGGED, HIDDEN), limit (max 50), cursor
+func (h *Handlers) GetReviews(c *fiber.Ctx) error {
+	page, err := h.reviewUsecase.ListReviews(c.Context(), queryList(c, "status"), c.Query("cursor"), c.QueryInt("limit", 20))
+	if err != nil {
+		if fiberErr := reviewError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch reviews", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch reviews")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// ModerateReview handles PUT /admin/reviews/:id/status
+func (h *Handlers) ModerateReview(c *fiber.Ctx) error {
+	adminID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	reviewID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid review ID")
+	}
+
+	var req usecase.ModerateReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	review, err := h.reviewUsecase.ModerateReview(c.Context(), adminID, reviewID, req)
+	if err != nil {
+		if fiberErr := reviewError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to moderate review", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to moderate review")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    review,
+		Message: "Review updated",
+	})
+}
+
+// ModerateItemReview handles PUT /admin/reviews/:id/items/:itemId/status
+func (h *Handlers) ModerateItemReview(c *fiber.Ctx) error {
+	adminID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	reviewID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid review ID")
+	}
+	itemReviewID, err := uuid.Parse(c.Params("itemId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid item review ID")
+	}
+
+	var req usecase.ModerateReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	review, err := h.reviewUsecase.ModerateItemReview(c.Context(), adminID, reviewID, itemReviewID, req)
+	if err != nil {
+		if fiberErr := reviewError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to moderate item review", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to moderate review")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    review,
+		Message: "Review updated",
+	})
+}
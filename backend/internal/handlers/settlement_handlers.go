@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+
+	"fooddelivery/internal/usecase"
+)
+
+// ImportSettlements handles POST /admin/settlements/import
+// Body: the settlement report CSV, either as the multipart field "file" or as
+// the raw request body (Content-Type text/csv, name in the file_name query)
+func (h *Handlers) ImportSettlements(c *fiber.Ctx) error {
+	adminID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var report io.Reader
+	fileName := c.Query("file_name")
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot read uploaded file")
+		}
+		defer f.Close()
+		report, fileName = f, file.Filename
+	} else {
+		if len(c.Body()) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Settlement report file is required")
+		}
+		report = bytes.NewReader(c.Body())
+	}
+
+	imp, err := h.settlementUsecase.Import(c.Context(), fileName, report, adminID)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidSettlementReport) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		h.log.Error("Failed to import settlement report", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to import settlement report")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    imp,
+	})
+}
+
+// GetSettlementReconciliation handles GET /admin/settlements/reconciliation
+// Query: from, to (as for analytics), grace_days (default 3), limit (entries
+// per list, default 200, max 1000)
+func (h *Handlers) GetSettlementReconciliation(c *fiber.Ctx) error {
+	report, err := h.settlementUsecase.GetReconciliation(c.Context(), analyticsRange(c), c.QueryInt("grace_days", 3), c.QueryInt("limit", 200))
+	return h.respondAnalytics(c, report, err, "reconciliation report")
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// MenuStockRequest is the body for setting a menu item's daily stock
+type MenuStockRequest struct {
+	DailyStock int  `json:"daily_stock"`
+	Remaining  *int `json:"remaining"` // Today's count; defaults to full for a new count
+}
+
+// GetStock handles GET /admin/stock
+func (h *Handlers) GetStock(c *fiber.Ctx) error {
+	stocks, err := h.stockUsecase.ListStock(c.Context())
+	if err != nil {
+		h.log.Error("Failed to list stock", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to list stock")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    stocks,
+	})
+}
+
+// SetMenuStock handles PUT /admin/menu/:id/stock
+func (h *Handlers) SetMenuStock(c *fiber.Ctx) error {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+
+	var req MenuStockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	stock, err := h.stockUsecase.SetStock(c.Context(), menuItemID, req.DailyStock, req.Remaining)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidStock) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Menu item not found")
+		}
+		h.log.Error("Failed to set stock", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to set stock")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    stock,
+	})
+}
+
+// DeleteMenuStock handles DELETE /admin/menu/:id/stock
+func (h *Handlers) DeleteMenuStock(c *fiber.Ctx) error {
+	menuItemID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid menu item ID")
+	}
+
+	if err := h.stockUsecase.DeleteStock(c.Context(), menuItemID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Menu item has no stock count")
+		}
+		h.log.Error("Failed to delete stock", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete stock")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Message: "Stock count removed",
+	})
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// subscriptionError maps meal plan and subscription errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func subscriptionError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	case errors.Is(err, usecase.ErrSubscriptionAccessDenied):
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	case errors.Is(err, usecase.ErrInvalidPlan), errors.Is(err, usecase.ErrInvalidSubscription),
+		errors.Is(err, usecase.ErrInvalidFilter):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrNotesTooLong):
+		return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+	case errors.Is(err, usecase.ErrPlanUnavailable):
+		return fiber.NewError(fiber.StatusConflict, "This meal plan is not open for subscription")
+	case errors.Is(err, usecase.ErrSubscriptionPaymentMismatch):
+		return fiber.NewError(fiber.StatusBadRequest, "Payment does not belong to this subscription")
+	case errors.Is(err, usecase.ErrInvalidSignature):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid payment signature")
+	case errors.Is(err, repository.ErrSubscriptionClosed), errors.Is(err, usecase.ErrSubscriptionNotRenewable):
+		return fiber.NewError(fiber.StatusConflict, "This subscription has been cancelled")
+	case errors.Is(err, usecase.ErrSubscriptionNotPaused):
+		return fiber.NewError(fiber.StatusConflict, "This subscription is not paused")
+	case errors.Is(err, repository.ErrVersionConflict):
+		return fiber.NewError(fiber.StatusConflict, "Subscription was updated, please review it again")
+	}
+	return nil
+}
+
+// subscriptionActionRequest carries the subscription version the caller last saw
+type subscriptionActionRequest struct {
+	Version int `json:"version"`
+}
+
+// parseSubscriptionAction reads the subscription ID and the optional version body
+func parseSubscriptionAction(c *fiber.Ctx) (uuid.UUID, int, error) {
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	var req subscriptionActionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return uuid.Nil, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	return subscriptionID, req.Version, nil
+}
+
+// respondSubscription writes a subscription result or maps its error
+func (h *Handlers) respondSubscription(c *fiber.Ctx, data interface{}, err error, action, message string) error {
+	if err != nil {
+		if fiberErr := subscriptionError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to "+action, "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to "+action)
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    data,
+		Message: message,
+	})
+}
+
+// GetMealPlans handles GET /subscription-plans and GET /admin/subscription-plans
+// Admins see inactive plans too.
+func (h *Handlers) GetMealPlans(c *fiber.Ctx) error {
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	plans, err := h.subscriptionUsecase.GetPlans(c.Context(), isAdmin)
+	return h.respondSubscription(c, plans, err, "fetch meal plans", "")
+}
+
+// GetMealPlan handles GET /subscription-plans/:id
+func (h *Handlers) GetMealPlan(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid meal plan ID")
+	}
+
+	plan, err := h.subscriptionUsecase.GetPlan(c.Context(), planID)
+	return h.respondSubscription(c, plan, err, "fetch meal plan", "")
+}
+
+// CreateMealPlan handles POST /admin/subscription-plans
+func (h *Handlers) CreateMealPlan(c *fiber.Ctx) error {
+	var req usecase.MealPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	plan, err := h.subscriptionUsecase.CreatePlan(c.Context(), req)
+	if err != nil {
+		return h.respondSubscription(c, nil, err, "create meal plan", "")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    plan,
+		Message: "Meal plan created",
+	})
+}
+
+// UpdateMealPlan handles PUT /admin/subscription-plans/:id
+func (h *Handlers) UpdateMealPlan(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid meal plan ID")
+	}
+
+	var req usecase.MealPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	plan, err := h.subscriptionUsecase.UpdatePlan(c.Context(), planID, req)
+	return h.respondSubscription(c, plan, err, "update meal plan", "Meal plan updated")
+}
+
+// Subscribe handles POST /subscriptions
+// Returns the subscription and the Razorpay order for its first billing period.
+func (h *Handlers) Subscribe(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.SubscribeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	req.UserID = userID
+
+	resp, err := h.subscriptionUsecase.Subscribe(c.Context(), req)
+	if err != nil {
+		return h.respondSubscription(c, nil, err, "create subscription", "")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    resp,
+		Message: "Pay to start your tiffins",
+	})
+}
+
+// GetUserSubscriptions handles GET /subscriptions
+func (h *Handlers) GetUserSubscriptions(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subs, err := h.subscriptionUsecase.GetUserSubscriptions(c.Context(), userID)
+	return h.respondSubscription(c, subs, err, "fetch subscriptions", "")
+}
+
+// GetSubscription handles GET /subscriptions/:id and GET /admin/subscriptions/:id
+func (h *Handlers) GetSubscription(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	sub, err := h.subscriptionUsecase.GetSubscription(c.Context(), userID, subscriptionID, isAdmin)
+	return h.respondSubscription(c, sub, err, "fetch subscription", "")
+}
+
+// UpdateSubscription handles PUT /subscriptions/:id
+func (h *Handlers) UpdateSubscription(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	var req usecase.UpdateSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	sub, err := h.subscriptionUsecase.UpdateSubscription(c.Context(), userID, subscriptionID, req)
+	return h.respondSubscription(c, sub, err, "update subscription", "Subscription updated")
+}
+
+// RenewSubscription handles POST /subscriptions/:id/renew
+func (h *Handlers) RenewSubscription(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	resp, err := h.subscriptionUsecase.Renew(c.Context(), userID, subscriptionID)
+	return h.respondSubscription(c, resp, err, "renew subscription", "")
+}
+
+// VerifySubscriptionPayment handles POST /subscriptions/:id/verify
+func (h *Handlers) VerifySubscriptionPayment(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	var req usecase.VerifyPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	sub, err := h.subscriptionUsecase.VerifyPayment(c.Context(), userID, subscriptionID,
+		req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
+	return h.respondSubscription(c, sub, err, "verify payment", "Payment verified")
+}
+
+// PauseSubscription handles POST /subscriptions/:id/pause
+// Body: from, until (YYYY-MM-DD, both optional), version
+func (h *Handlers) PauseSubscription(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	var req usecase.PauseRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	sub, err := h.subscriptionUsecase.Pause(c.Context(), userID, subscriptionID, req)
+	return h.respondSubscription(c, sub, err, "pause subscription", "Subscription paused")
+}
+
+// ResumeSubscription handles POST /subscriptions/:id/resume
+func (h *Handlers) ResumeSubscription(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, version, err := parseSubscriptionAction(c)
+	if err != nil {
+		return err
+	}
+
+	sub, err := h.subscriptionUsecase.Resume(c.Context(), userID, subscriptionID, version)
+	return h.respondSubscription(c, sub, err, "resume subscription", "Subscription resumed")
+}
+
+// SkipSubscriptionDay handles POST /subscriptions/:id/skips
+// Body: {"date": "YYYY-MM-DD"}
+func (h *Handlers) SkipSubscriptionDay(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	var req struct {
+		Date string `json:"date"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	sub, err := h.subscriptionUsecase.SkipDay(c.Context(), userID, subscriptionID, req.Date)
+	return h.respondSubscription(c, sub, err, "skip day", "Day skipped")
+}
+
+// UnskipSubscriptionDay handles DELETE /subscriptions/:id/skips/:date
+func (h *Handlers) UnskipSubscriptionDay(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	sub, err := h.subscriptionUsecase.UnskipDay(c.Context(), userID, subscriptionID, c.Params("date"))
+	if errors.Is(err, repository.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "That day is not skipped")
+	}
+	return h.respondSubscription(c, sub, err, "restore day", "Day restored")
+}
+
+// CancelSubscription handles POST /subscriptions/:id/cancel and
+// POST /admin/subscriptions/:id/cancel
+func (h *Handlers) CancelSubscription(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	subscriptionID, version, err := parseSubscriptionAction(c)
+	if err != nil {
+		return err
+	}
+
+	isAdmin, _ := c.Locals(ContextKeyIsAdmin).(bool)
+
+	sub, err := h.subscriptionUsecase.Cancel(c.Context(), userID, subscriptionID, version, isAdmin)
+	return h.respondSubscription(c, sub, err, "cancel subscription", "Subscription cancelled")
+}
+
+// GetSubscriptions handles GET /admin/subscriptions
+// Query: status (comma-separated; defaults to ACTIVE)
+func (h *Handlers) GetSubscriptions(c *fiber.Ctx) error {
+	subs, err := h.subscriptionUsecase.ListSubscriptions(c.Context(), queryList(c, "status"))
+	return h.respondSubscription(c, subs, err, "fetch subscriptions", "")
+}
+
+// MaterializeSubscriptions handles POST /admin/subscriptions/materialize
+// Places today's tiffin orders now instead of waiting for the scheduler;
+// nothing is placed before today's lock time.
+func (h *Handlers) MaterializeSubscriptions(c *fiber.Ctx) error {
+	placed, err := h.subscriptionUsecase.MaterializeDue(c.Context(), time.Now())
+	return h.respondSubscription(c, fiber.Map{"placed": placed}, err, "place tiffin orders", "")
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/internal/usecase"
+)
+
+// tableError maps table and tab errors to HTTP errors.
+// Returns nil for unexpected errors, which the caller logs as 500.
+func tableError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Table or tab not found")
+	case errors.Is(err, usecase.ErrInvalidTableToken):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid or expired table QR code")
+	case errors.Is(err, usecase.ErrTableInactive):
+		return fiber.NewError(fiber.StatusConflict, "This table is not taking orders")
+	case errors.Is(err, repository.ErrNotTableMember):
+		return fiber.NewError(fiber.StatusForbidden, "Scan the table's QR code to join this tab first")
+	case errors.Is(err, repository.ErrTabClosed):
+		return fiber.NewError(fiber.StatusConflict, "The bill for this table has been requested, no more orders can be added")
+	case errors.Is(err, usecase.ErrTabSettled):
+		return fiber.NewError(fiber.StatusConflict, "This table tab is already settled")
+	case errors.Is(err, usecase.ErrBillInProgress):
+		return fiber.NewError(fiber.StatusConflict, "This tab is being paid as a split bill, void the split first")
+	case errors.Is(err, usecase.ErrTabEmpty):
+		return fiber.NewError(fiber.StatusBadRequest, "Nothing has been ordered on this tab")
+	case errors.Is(err, usecase.ErrTabPaymentMismatch):
+		return fiber.NewError(fiber.StatusBadRequest, "Payment does not belong to this tab")
+	case errors.Is(err, usecase.ErrInvalidSignature):
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid payment signature")
+	case errors.Is(err, repository.ErrVersionConflict):
+		return fiber.NewError(fiber.StatusConflict, "Tab was updated concurrently, please retry")
+	case errors.Is(err, usecase.ErrInvalidTableNumber):
+		return fiber.NewError(fiber.StatusBadRequest, "Table number must be positive")
+	case errors.Is(err, repository.ErrDuplicateKey):
+		return fiber.NewError(fiber.StatusConflict, "A table with this number already exists")
+	case errors.Is(err, usecase.ErrInvalidFilter):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// parseSessionID parses the :id route param of a table session
+func parseSessionID(c *fiber.Ctx) (uuid.UUID, error) {
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Invalid table session ID")
+	}
+	return sessionID, nil
+}
+
+// JoinTableRequest carries the token from a scanned table QR code
+type JoinTableRequest struct {
+	Token string `json:"token"`
+}
+
+// JoinTable handles POST /tables/join
+func (h *Handlers) JoinTable(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req JoinTableRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "QR token is required")
+	}
+
+	session, err := h.tableUsecase.JoinTable(c.Context(), req.Token, userID)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to join table", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open table tab")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    session,
+	})
+}
+
+// GetTableSession handles GET /tables/sessions/:id
+func (h *Handlers) GetTableSession(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := parseSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := h.tableUsecase.GetSession(c.Context(), sessionID, userID)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch table tab", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch table tab")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    session,
+	})
+}
+
+// PlaceTableOrder handles POST /tables/sessions/:id/orders
+func (h *Handlers) PlaceTableOrder(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := parseSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	var req CreateOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if len(req.Items) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Cart is empty")
+	}
+
+	order, err := h.tableUsecase.PlaceRound(c.Context(), usecase.PlaceRoundRequest{
+		UserID:    userID,
+		SessionID: sessionID,
+		Items:     req.Items,
+		Notes:     req.Notes,
+	})
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidSelection) {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, usecase.ErrInvalidCart) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid cart")
+		}
+		if errors.Is(err, usecase.ErrItemNotAvailable) {
+			return fiber.NewError(fiber.StatusBadRequest, "One or more items are not available")
+		}
+		if errors.Is(err, usecase.ErrNotesTooLong) {
+			return fiber.NewError(fiber.StatusBadRequest, notesTooLongMessage)
+		}
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to place table order", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to place order")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    order,
+	})
+}
+
+// RequestTableBill handles POST /tables/sessions/:id/request-bill
+func (h *Handlers) RequestTableBill(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := parseSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := h.tableUsecase.RequestBill(c.Context(), sessionID, userID)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to request bill", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to request bill")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    session,
+		Message: "Bill requested",
+	})
+}
+
+// PayTableSession handles POST /tables/sessions/:id/pay
+func (h *Handlers) PayTableSession(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := parseSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.tableUsecase.StartPayment(c.Context(), sessionID, userID)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to start tab payment", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to start payment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    resp,
+	})
+}
+
+// VerifyTablePayment handles POST /tables/sessions/:id/verify
+func (h *Handlers) VerifyTablePayment(c *fiber.Ctx) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := parseSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	var req usecase.VerifyPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	session, err := h.tableUsecase.VerifyPayment(c.Context(), sessionID, userID, req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to verify tab payment", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to verify payment")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    session,
+		Message: "Payment verified",
+	})
+}
+
+// GetTables handles GET /admin/tables
+func (h *Handlers) GetTables(c *fiber.Ctx) error {
+	tables, err := h.tableUsecase.ListTables(c.Context())
+	if err != nil {
+		h.log.Error("Failed to fetch tables", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch tables")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    tables,
+	})
+}
+
+// TableRequest for creating or updating a table
+type TableRequest struct {
+	Number   int    `json:"number"`
+	Label    string `json:"label"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// CreateTable handles POST /admin/tables
+func (h *Handlers) CreateTable(c *fiber.Ctx) error {
+	var req TableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	table, err := h.tableUsecase.CreateTable(c.Context(), req.Number, req.Label)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to create table", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create table")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(SuccessResponse{
+		Success: true,
+		Data:    table,
+	})
+}
+
+// UpdateTable handles PUT /admin/tables/:id
+func (h *Handlers) UpdateTable(c *fiber.Ctx) error {
+	tableID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid table ID")
+	}
+
+	var req TableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	table, err := h.tableUsecase.UpdateTable(c.Context(), tableID, req.Label, isActive)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to update table", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update table")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    table,
+	})
+}
+
+// RotateTableQR handles POST /admin/tables/:id/rotate-qr
+func (h *Handlers) RotateTableQR(c *fiber.Ctx) error {
+	tableID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid table ID")
+	}
+
+	table, err := h.tableUsecase.RotateQR(c.Context(), tableID)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to rotate table QR", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to rotate QR code")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    table,
+		Message: "Old QR code no longer works, print the new one",
+	})
+}
+
+// GetTableSessions handles GET /admin/table-sessions
+// Query: status (comma-separated, default OPEN,BILL_REQUESTED)
+func (h *Handlers) GetTableSessions(c *fiber.Ctx) error {
+	statuses := queryList(c, "status")
+	if len(statuses) == 0 {
+		statuses = []string{string(domain.TableSessionOpen), string(domain.TableSessionBillRequested)}
+	}
+
+	sessions, err := h.tableUsecase.ListSessions(c.Context(), statuses)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to fetch table tabs", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch table tabs")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    sessions,
+	})
+}
+
+// SettleTableSession handles POST /admin/table-sessions/:id/settle
+// Marks the whole tab as paid at the counter.
+func (h *Handlers) SettleTableSession(c *fiber.Ctx) error {
+	staffID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := parseSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := h.tableUsecase.SettleAtCounter(c.Context(), sessionID, staffID)
+	if err != nil {
+		if fiberErr := tableError(err); fiberErr != nil {
+			return fiberErr
+		}
+		h.log.Error("Failed to settle table tab", "error", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to settle tab")
+	}
+
+	return c.JSON(SuccessResponse{
+		Success: true,
+		Data:    session,
+		Message: "Tab settled",
+	})
+}
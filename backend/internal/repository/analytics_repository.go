@@ -0,0 +1,277 @@
+// Package repository implements the sales aggregates behind the admin dashboard
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// AnalyticsRepository runs read-only aggregate queries over orders. Ranges
+// are [from, to); timezone is the IANA name day, week and hour boundaries
+// are taken in.
+type AnalyticsRepository struct {
+	db *database.Pool
+}
+
+// NewAnalyticsRepository creates a new analytics repository
+func NewAnalyticsRepository(db *database.Pool) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// ItemSalesSort is what top-selling items are ranked by
+type ItemSalesSort string
+
+const (
+	ItemSalesByQuantity ItemSalesSort = "quantity"
+	ItemSalesByRevenue  ItemSalesSort = "revenue"
+)
+
+// GetSummary aggregates orders, revenue, repeat customers and payment
+// failures for a range
+func (r *AnalyticsRepository) GetSummary(ctx context.Context, from, to time.Time) (*domain.SalesSummary, error) {
+	summary := &domain.SalesSummary{
+		From:         from,
+		To:           to,
+		StatusCounts: make(map[domain.OrderStatus]int64),
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT status, COUNT(*)
+		FROM orders
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY status
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count orders by status: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status domain.OrderStatus
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan status count: %w", err)
+		}
+		summary.StatusCounts[status] = count
+		summary.Orders += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating status counts: %w", err)
+	}
+
+	// Revenue is recognised at an order's final total when it is paid;
+	// refunds of that revenue when processed
+	err = r.db.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM orders WHERE paid_at >= $1 AND paid_at < $2),
+			(SELECT COALESCE(SUM(total_amount), 0) FROM orders WHERE paid_at >= $1 AND paid_at < $2),
+			(SELECT COALESCE(SUM(amount), 0) FROM refunds
+				WHERE `+bookedRefundsSQL+` AND processed_at >= $1 AND processed_at < $2)
+	`, from, to).Scan(&summary.PaidOrders, &summary.Revenue, &summary.Refunds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum revenue: %w", err)
+	}
+
+	// Customers paying in the range, and how many had another paid order
+	// before the end of it
+	err = r.db.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE paid_orders > 1)
+		FROM (
+			SELECT user_id, COUNT(*) AS paid_orders
+			FROM orders
+			WHERE paid_at IS NOT NULL AND paid_at < $2
+			GROUP BY user_id
+			HAVING MAX(paid_at) >= $1
+		) customers
+	`, from, to).Scan(&summary.Customers, &summary.RepeatCustomers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count repeat customers: %w", err)
+	}
+
+	// Razorpay retries webhooks, so attempts are counted by payment ID
+	err = r.db.QueryRow(ctx, `
+		SELECT
+			COUNT(DISTINCT payload->'payload'->'payment'->'entity'->>'id') FILTER (WHERE event_type = 'payment.captured'),
+			COUNT(DISTINCT payload->'payload'->'payment'->'entity'->>'id') FILTER (WHERE event_type = 'payment.failed')
+		FROM webhook_logs
+		WHERE source = 'razorpay' AND signature_valid
+			AND event_type IN ('payment.captured', 'payment.failed')
+			AND created_at >= $1 AND created_at < $2
+	`, from, to).Scan(&summary.PaymentsCaptured, &summary.PaymentsFailed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count payment attempts: %w", err)
+	}
+
+	return summary, nil
+}
+
+// GetRevenueSeries sums paid orders and processed refunds of them per bucket. Buckets
+// without sales are missing; Start is the bucket's local midnight expressed
+// as a wall-clock time in UTC.
+func (r *AnalyticsRepository) GetRevenueSeries(ctx context.Context, from, to time.Time, interval domain.AnalyticsInterval, timezone string) ([]domain.RevenuePoint, error) {
+	query := `
+		WITH sales AS (
+			SELECT date_trunc($3, paid_at AT TIME ZONE $4) AS bucket, COUNT(*) AS orders, SUM(total_amount) AS revenue
+			FROM orders
+			WHERE paid_at >= $1 AND paid_at < $2
+			GROUP BY 1
+		),
+		refunded AS (
+			SELECT date_trunc($3, processed_at AT TIME ZONE $4) AS bucket, SUM(amount) AS refunds
+			FROM refunds
+			WHERE ` + bookedRefundsSQL + ` AND processed_at >= $1 AND processed_at < $2
+			GROUP BY 1
+		)
+		SELECT COALESCE(s.bucket, f.bucket), COALESCE(s.orders, 0), COALESCE(s.revenue, 0), COALESCE(f.refunds, 0)
+		FROM sales s
+		FULL OUTER JOIN refunded f ON f.bucket = s.bucket
+		ORDER BY 1
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, string(interval), timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revenue series: %w", err)
+	}
+	defer rows.Close()
+
+	var points []domain.RevenuePoint
+	for rows.Next() {
+		var p domain.RevenuePoint
+		if err := rows.Scan(&p.Start, &p.Orders, &p.Revenue, &p.Refunds); err != nil {
+			return nil, fmt.Errorf("failed to scan revenue point: %w", err)
+		}
+		points = append(points, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revenue series: %w", err)
+	}
+
+	return points, nil
+}
+
+// GetTopItems ranks menu items sold in orders paid in the range. Names and
+// categories are the menu's current ones.
+func (r *AnalyticsRepository) GetTopItems(ctx context.Context, from, to time.Time, sortBy ItemSalesSort, limit int) ([]domain.ItemSales, error) {
+	orderBy := "quantity DESC, revenue DESC"
+	if sortBy == ItemSalesByRevenue {
+		orderBy = "revenue DESC, quantity DESC"
+	}
+
+	query := `
+		SELECT m.id, m.name, m.category,
+			SUM(oi.quantity) AS quantity,
+			SUM(oi.price::BIGINT * oi.quantity) AS revenue,
+			COUNT(DISTINCT oi.order_id)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN menu_items m ON m.id = oi.menu_item_id
+		WHERE o.paid_at >= $1 AND o.paid_at < $2
+		GROUP BY m.id
+		ORDER BY ` + orderBy + `, m.name
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []domain.ItemSales
+	for rows.Next() {
+		var item domain.ItemSales
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.Category, &item.Quantity, &item.Revenue, &item.Orders); err != nil {
+			return nil, fmt.Errorf("failed to scan item sales: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating item sales: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetCategorySales sums what each menu category sold in orders paid in the
+// range, best-selling by revenue first
+func (r *AnalyticsRepository) GetCategorySales(ctx context.Context, from, to time.Time) ([]domain.CategorySales, error) {
+	query := `
+		SELECT m.category,
+			SUM(oi.quantity),
+			SUM(oi.price::BIGINT * oi.quantity) AS revenue,
+			COUNT(DISTINCT oi.order_id)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN menu_items m ON m.id = oi.menu_item_id
+		WHERE o.paid_at >= $1 AND o.paid_at < $2
+		GROUP BY m.category
+		ORDER BY revenue DESC, m.category
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query category sales: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []domain.CategorySales
+	for rows.Next() {
+		var c domain.CategorySales
+		if err := rows.Scan(&c.Category, &c.Quantity, &c.Revenue, &c.Orders); err != nil {
+			return nil, fmt.Errorf("failed to scan category sales: %w", err)
+		}
+		categories = append(categories, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating category sales: %w", err)
+	}
+
+	return categories, nil
+}
+
+// GetOrderHeatmap counts paid orders by the weekday and hour they were
+// placed. Tiffin and catering orders are left out: the scheduler and
+// payment plans place them, not customers choosing when to eat.
+func (r *AnalyticsRepository) GetOrderHeatmap(ctx context.Context, from, to time.Time, timezone string) ([]domain.HeatmapCell, error) {
+	query := `
+		SELECT
+			EXTRACT(ISODOW FROM created_at AT TIME ZONE $3)::INT,
+			EXTRACT(HOUR FROM created_at AT TIME ZONE $3)::INT,
+			COUNT(*),
+			SUM(total_amount)
+		FROM orders
+		WHERE created_at >= $1 AND created_at < $2
+			AND paid_at IS NOT NULL
+			AND subscription_id IS NULL
+			AND catering_request_id IS NULL
+		GROUP BY 1, 2
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order heatmap: %w", err)
+	}
+	defer rows.Close()
+
+	var cells []domain.HeatmapCell
+	for rows.Next() {
+		var c domain.HeatmapCell
+		if err := rows.Scan(&c.Weekday, &c.Hour, &c.Orders, &c.Revenue); err != nil {
+			return nil, fmt.Errorf("failed to scan heatmap cell: %w", err)
+		}
+		cells = append(cells, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order heatmap: %w", err)
+	}
+
+	return cells, nil
+}
@@ -0,0 +1,724 @@
+// Package repository implements split bill data access
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// Split bill errors
+var (
+	ErrActiveBillExists = errors.New("a split bill is already in progress")
+	ErrBillSourcePaid   = errors.New("the tab or order has already been paid")
+	ErrBillTotalChanged = errors.New("the total changed while the bill was being split")
+	ErrBillNotOpen      = errors.New("bill is no longer open")
+	ErrTabPaymentOpen   = errors.New("the whole tab is already being paid through the gateway")
+)
+
+// BillRepository handles split bills and their shares
+type BillRepository struct {
+	db *database.Pool
+}
+
+// NewBillRepository creates a new bill repository
+func NewBillRepository(db *database.Pool) *BillRepository {
+	return &BillRepository{db: db}
+}
+
+// billColumns is the column list scanned by scanBill
+const billColumns = `id, source_type, source_id, split_mode, total_amount, status, created_by, version,
+	created_at, updated_at, paid_at, voided_at`
+
+// shareColumns is the column list scanned by scanShare
+const shareColumns = `id, bill_id, position, label, amount, status, razorpay_order_id, razorpay_payment_id,
+	paid_at, refunded_at, created_at, updated_at`
+
+// CaptureResult describes what a captured share payment did to its bill
+type CaptureResult struct {
+	BillID           uuid.UUID
+	AlreadyProcessed bool           // Payment was recorded before (webhook and client both reported it)
+	BillPaid         bool           // This was the last share; the tab or order is now paid
+	SourceSettled    bool           // The tab or order was paid some other way while the bill was open
+	SoldOut          bool           // The order sold out before its last share; the bill was voided
+	Refund           *domain.Refund // Set when the captured money has to be returned
+}
+
+// Create inserts a bill with its shares. The tab or order is locked and its
+// total re-checked so the split always covers exactly what is owed; a tab
+// stops taking new rounds once a split bill exists.
+func (r *BillRepository) Create(ctx context.Context, bill *domain.Bill) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		total, err := lockBillSource(ctx, tx, bill.SourceType, bill.SourceID)
+		if err != nil {
+			return err
+		}
+		if total != bill.TotalAmount {
+			return ErrBillTotalChanged
+		}
+
+		if bill.SourceType == domain.BillSourceTableSession {
+			// The version moves even if the bill was already requested, so a
+			// whole-tab payment started from an older read is refused
+			requestBill := `
+				UPDATE table_sessions
+				SET status = 'BILL_REQUESTED', bill_requested_at = COALESCE(bill_requested_at, NOW()), version = version + 1
+				WHERE id = $1
+			`
+			if _, err := tx.Exec(ctx, requestBill, bill.SourceID); err != nil {
+				return fmt.Errorf("failed to close tab for splitting: %w", err)
+			}
+		}
+
+		now := time.Now()
+		bill.ID = uuid.New()
+		bill.Status = domain.BillOpen
+		bill.Version = 1
+		bill.CreatedAt = now
+		bill.UpdatedAt = now
+
+		billQuery := `
+			INSERT INTO bills (id, source_type, source_id, split_mode, total_amount, status, created_by, version, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		_, err = tx.Exec(ctx, billQuery,
+			bill.ID,
+			bill.SourceType,
+			bill.SourceID,
+			bill.Mode,
+			bill.TotalAmount,
+			bill.Status,
+			bill.CreatedBy,
+			bill.Version,
+			bill.CreatedAt,
+			bill.UpdatedAt,
+		)
+		if err != nil {
+			if isDuplicateKeyError(err) {
+				return ErrActiveBillExists
+			}
+			return fmt.Errorf("failed to insert bill: %w", err)
+		}
+
+		shareQuery := `
+			INSERT INTO bill_shares (id, bill_id, position, label, amount, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+		itemQuery := `
+			INSERT INTO bill_share_items (share_id, order_item_id, quantity, amount)
+			VALUES ($1, $2, $3, $4)
+		`
+
+		for i := range bill.Shares {
+			share := &bill.Shares[i]
+			share.ID = uuid.New()
+			share.BillID = bill.ID
+			share.Position = i + 1
+			share.Status = domain.ShareStatusPending
+			share.CreatedAt = now
+			share.UpdatedAt = now
+
+			_, err := tx.Exec(ctx, shareQuery,
+				share.ID,
+				share.BillID,
+				share.Position,
+				share.Label,
+				share.Amount,
+				share.Status,
+				share.CreatedAt,
+				share.UpdatedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to insert bill share: %w", err)
+			}
+
+			for _, item := range share.Items {
+				if _, err := tx.Exec(ctx, itemQuery, share.ID, item.OrderItemID, item.Quantity, item.Amount); err != nil {
+					return fmt.Errorf("failed to insert bill share item: %w", err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// lockBillSource locks the tab or order being split and returns what is owed.
+// Fails if it has been paid already.
+func lockBillSource(ctx context.Context, tx pgx.Tx, sourceType domain.BillSourceType, sourceID uuid.UUID) (int64, error) {
+	switch sourceType {
+	case domain.BillSourceTableSession:
+		var status domain.TableSessionStatus
+		var razorpayOrderID *string
+		err := tx.QueryRow(ctx, `SELECT status, razorpay_order_id FROM table_sessions WHERE id = $1 FOR UPDATE`, sourceID).Scan(&status, &razorpayOrderID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, ErrNotFound
+			}
+			return 0, fmt.Errorf("failed to lock table session: %w", err)
+		}
+		if status == domain.TableSessionSettled {
+			return 0, ErrBillSourcePaid
+		}
+		// A gateway order for the whole tab may still be paid; splitting too
+		// would collect the tab twice
+		if razorpayOrderID != nil {
+			return 0, ErrTabPaymentOpen
+		}
+
+		var total int64
+		err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(total_amount), 0) FROM orders WHERE table_session_id = $1`, sourceID).Scan(&total)
+		if err != nil {
+			return 0, fmt.Errorf("failed to total table session: %w", err)
+		}
+		return total, nil
+
+	case domain.BillSourceOrder:
+		var status domain.OrderStatus
+		var total int64
+		err := tx.QueryRow(ctx, `SELECT status, total_amount FROM orders WHERE id = $1 FOR UPDATE`, sourceID).Scan(&status, &total)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, ErrNotFound
+			}
+			return 0, fmt.Errorf("failed to lock order: %w", err)
+		}
+		if status.IsPaid() {
+			return 0, ErrBillSourcePaid
+		}
+		return total, nil
+	}
+
+	return 0, fmt.Errorf("unknown bill source type %q", sourceType)
+}
+
+// GetByID retrieves a bill with its shares and share items
+func (r *BillRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Bill, error) {
+	query := `
+		SELECT ` + billColumns + `
+		FROM bills
+		WHERE id = $1
+	`
+
+	bill, err := scanBill(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get bill: %w", err)
+	}
+
+	if err := r.loadShares(ctx, bill); err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+// GetActiveBySource retrieves the open or paid bill of a tab or order
+func (r *BillRepository) GetActiveBySource(ctx context.Context, sourceType domain.BillSourceType, sourceID uuid.UUID) (*domain.Bill, error) {
+	query := `
+		SELECT ` + billColumns + `
+		FROM bills
+		WHERE source_type = $1 AND source_id = $2 AND status <> 'VOIDED'
+	`
+
+	bill, err := scanBill(r.db.QueryRow(ctx, query, sourceType, sourceID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get active bill: %w", err)
+	}
+
+	if err := r.loadShares(ctx, bill); err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+// GetShareByRazorpayOrderID retrieves the share paid with the given gateway order
+func (r *BillRepository) GetShareByRazorpayOrderID(ctx context.Context, razorpayOrderID string) (*domain.BillShare, error) {
+	query := `
+		SELECT ` + shareColumns + `
+		FROM bill_shares
+		WHERE razorpay_order_id = $1
+	`
+
+	share, err := scanShare(r.db.QueryRow(ctx, query, razorpayOrderID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get bill share: %w", err)
+	}
+
+	return share, nil
+}
+
+// SetShareGatewayOrder records the gateway order a share is paid with.
+// Returns ErrVersionConflict if the share already has one or is no longer payable.
+func (r *BillRepository) SetShareGatewayOrder(ctx context.Context, shareID uuid.UUID, razorpayOrderID string) error {
+	query := `
+		UPDATE bill_shares
+		SET razorpay_order_id = $2
+		WHERE id = $1 AND razorpay_order_id IS NULL AND status IN ('PENDING', 'FAILED')
+	`
+
+	result, err := r.db.Exec(ctx, query, shareID, razorpayOrderID)
+	if err != nil {
+		return fmt.Errorf("failed to set share gateway order: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// MarkShareFailed records a failed payment attempt; the share can be paid again
+func (r *BillRepository) MarkShareFailed(ctx context.Context, shareID uuid.UUID) error {
+	query := `
+		UPDATE bill_shares
+		SET status = 'FAILED'
+		WHERE id = $1 AND status = 'PENDING'
+	`
+
+	if _, err := r.db.Exec(ctx, query, shareID); err != nil {
+		return fmt.Errorf("failed to mark share failed: %w", err)
+	}
+
+	return nil
+}
+
+// CaptureShare records a captured share payment. When it is the last share,
+// the bill is marked paid and the tab or order settled in the same
+// transaction. Money captured for a voided bill, or for a tab or order that
+// was paid some other way, is queued for refund instead.
+func (r *BillRepository) CaptureShare(ctx context.Context, shareID uuid.UUID, paymentID string) (*CaptureResult, error) {
+	result := &CaptureResult{}
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		var billStatus domain.BillStatus
+		var shareStatus domain.BillShareStatus
+		var sourceType domain.BillSourceType
+		var sourceID uuid.UUID
+		var totalAmount, shareAmount int64
+
+		lockQuery := `
+			SELECT b.id, b.status, b.source_type, b.source_id, b.total_amount, s.status, s.amount
+			FROM bill_shares s
+			JOIN bills b ON b.id = s.bill_id
+			WHERE s.id = $1
+			FOR UPDATE
+		`
+		err := tx.QueryRow(ctx, lockQuery, shareID).
+			Scan(&result.BillID, &billStatus, &sourceType, &sourceID, &totalAmount, &shareStatus, &shareAmount)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock bill share: %w", err)
+		}
+
+		switch shareStatus {
+		case domain.ShareStatusPaid, domain.ShareStatusRefundPending, domain.ShareStatusRefunded:
+			result.AlreadyProcessed = true
+			return nil
+		}
+
+		refundReason := "bill voided"
+		if billStatus == domain.BillOpen {
+			if _, err := lockBillSource(ctx, tx, sourceType, sourceID); err != nil {
+				if !errors.Is(err, ErrBillSourcePaid) {
+					return err
+				}
+				result.SourceSettled = true
+				refundReason = "already paid"
+			}
+		}
+
+		if billStatus != domain.BillOpen || result.SourceSettled {
+			refundShare := `
+				UPDATE bill_shares
+				SET status = 'REFUND_PENDING', razorpay_payment_id = $2, paid_at = NOW()
+				WHERE id = $1
+			`
+			if _, err := tx.Exec(ctx, refundShare, shareID, paymentID); err != nil {
+				return fmt.Errorf("failed to record share payment: %w", err)
+			}
+
+			result.Refund = &domain.Refund{
+				OrderID:           billOrderID(sourceType, sourceID),
+				Source:            domain.RefundSourceBillShare,
+				SourceID:          shareID,
+				RazorpayPaymentID: paymentID,
+				Amount:            shareAmount,
+				Reason:            refundReason,
+			}
+			return insertRefund(ctx, tx, result.Refund)
+		}
+
+		payShare := `
+			UPDATE bill_shares
+			SET status = 'PAID', razorpay_payment_id = $2, paid_at = NOW()
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, payShare, shareID, paymentID); err != nil {
+			return fmt.Errorf("failed to record share payment: %w", err)
+		}
+
+		var unpaid int
+		err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM bill_shares WHERE bill_id = $1 AND status <> 'PAID'`, result.BillID).Scan(&unpaid)
+		if err != nil {
+			return fmt.Errorf("failed to count unpaid shares: %w", err)
+		}
+		if unpaid > 0 {
+			return nil
+		}
+
+		// Last share captured: the whole bill is paid
+		if err := settleBillSource(ctx, tx, sourceType, sourceID, totalAmount); err != nil {
+			if !errors.Is(err, ErrOutOfStock) {
+				return err
+			}
+			// The order's stock sold out while its shares were being paid:
+			// refuse it and refund every share
+			if err := refuseOrderPayment(ctx, tx, sourceID, ""); err != nil {
+				return err
+			}
+			result.SoldOut = true
+			return voidBill(ctx, tx, result.BillID, sourceType, sourceID, "sold out")
+		}
+
+		payBill := `
+			UPDATE bills
+			SET status = 'PAID', paid_at = NOW(), version = version + 1
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, payBill, result.BillID); err != nil {
+			return fmt.Errorf("failed to mark bill paid: %w", err)
+		}
+
+		result.BillPaid = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// settleBillSource marks the tab or order paid once every share is captured
+func settleBillSource(ctx context.Context, tx pgx.Tx, sourceType domain.BillSourceType, sourceID uuid.UUID, amount int64) error {
+	switch sourceType {
+	case domain.BillSourceTableSession:
+		return settleTableSession(ctx, tx, sourceID, domain.SettlementSplit, amount, "", nil)
+
+	case domain.BillSourceOrder:
+		_, err := markOrderPaid(ctx, tx, sourceID, domain.OrderStatusPaid, "")
+		return err
+	}
+
+	return fmt.Errorf("unknown bill source type %q", sourceType)
+}
+
+// billOrderID is the order a refund relates to, if the bill settles an order
+func billOrderID(sourceType domain.BillSourceType, sourceID uuid.UUID) *uuid.UUID {
+	if sourceType != domain.BillSourceOrder {
+		return nil
+	}
+	return &sourceID
+}
+
+// Void cancels an open bill: unpaid shares are cancelled and paid shares are
+// queued for refund. Voiding an already voided bill is a no-op so refunds can
+// be retried; a fully paid bill cannot be voided.
+func (r *BillRepository) Void(ctx context.Context, billID uuid.UUID) error {
+	return r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		var status domain.BillStatus
+		var sourceType domain.BillSourceType
+		var sourceID uuid.UUID
+
+		err := tx.QueryRow(ctx, `SELECT status, source_type, source_id FROM bills WHERE id = $1 FOR UPDATE`, billID).
+			Scan(&status, &sourceType, &sourceID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock bill: %w", err)
+		}
+
+		switch status {
+		case domain.BillVoided:
+			return nil
+		case domain.BillPaid:
+			return ErrBillNotOpen
+		}
+
+		return voidBill(ctx, tx, billID, sourceType, sourceID, "bill voided")
+	})
+}
+
+// voidBill cancels the unpaid shares of an open bill and queues refunds for
+// the paid ones, inside the caller's transaction
+func voidBill(ctx context.Context, q database.Querier, billID uuid.UUID, sourceType domain.BillSourceType, sourceID uuid.UUID, reason string) error {
+	voidQuery := `
+		UPDATE bills
+		SET status = 'VOIDED', voided_at = NOW(), version = version + 1
+		WHERE id = $1
+	`
+	if _, err := q.Exec(ctx, voidQuery, billID); err != nil {
+		return fmt.Errorf("failed to void bill: %w", err)
+	}
+
+	cancelShares := `
+		UPDATE bill_shares
+		SET status = 'CANCELLED'
+		WHERE bill_id = $1 AND status IN ('PENDING', 'FAILED')
+	`
+	if _, err := q.Exec(ctx, cancelShares, billID); err != nil {
+		return fmt.Errorf("failed to cancel bill shares: %w", err)
+	}
+
+	rows, err := q.Query(ctx, `
+		UPDATE bill_shares
+		SET status = 'REFUND_PENDING'
+		WHERE bill_id = $1 AND status = 'PAID'
+		RETURNING id, razorpay_payment_id, amount
+	`, billID)
+	if err != nil {
+		return fmt.Errorf("failed to queue share refunds: %w", err)
+	}
+
+	var refunds []domain.Refund
+	for rows.Next() {
+		refund := domain.Refund{
+			OrderID: billOrderID(sourceType, sourceID),
+			Source:  domain.RefundSourceBillShare,
+			Reason:  reason,
+		}
+		if err := rows.Scan(&refund.SourceID, &refund.RazorpayPaymentID, &refund.Amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan paid share: %w", err)
+		}
+		refunds = append(refunds, refund)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating paid shares: %w", err)
+	}
+
+	for i := range refunds {
+		if err := insertRefund(ctx, q, &refunds[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// voidOpenBill voids the open split bill of a tab or order that was paid
+// some other way, so the shares already paid are refunded
+func voidOpenBill(ctx context.Context, q database.Querier, sourceType domain.BillSourceType, sourceID uuid.UUID) error {
+	var billID uuid.UUID
+	err := q.QueryRow(ctx, `
+		SELECT id FROM bills
+		WHERE source_type = $1 AND source_id = $2 AND status = 'OPEN'
+		FOR UPDATE
+	`, sourceType, sourceID).Scan(&billID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to lock open bill: %w", err)
+	}
+
+	return voidBill(ctx, q, billID, sourceType, sourceID, "already paid")
+}
+
+// GetWithPendingRefunds returns the IDs of a tab's or order's bills that
+// have share refunds still to be sent to the gateway
+func (r *BillRepository) GetWithPendingRefunds(ctx context.Context, sourceType domain.BillSourceType, sourceID uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+		SELECT b.id
+		FROM bills b
+		WHERE b.source_type = $1 AND b.source_id = $2
+			AND EXISTS (SELECT 1 FROM bill_shares s WHERE s.bill_id = b.id AND s.status = 'REFUND_PENDING')
+		ORDER BY b.created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, sourceType, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bills with pending refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var billIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan bill ID: %w", err)
+		}
+		billIDs = append(billIDs, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bills: %w", err)
+	}
+
+	return billIDs, nil
+}
+
+// CompleteShareRefund records a processed share refund and marks the share refunded
+func (r *BillRepository) CompleteShareRefund(ctx context.Context, refundID, shareID uuid.UUID, razorpayRefundID string) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if err := completeRefund(ctx, tx, refundID, razorpayRefundID); err != nil {
+			return err
+		}
+
+		shareQuery := `
+			UPDATE bill_shares
+			SET status = 'REFUNDED', refunded_at = NOW()
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, shareQuery, shareID); err != nil {
+			return fmt.Errorf("failed to mark share refunded: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// loadShares loads the shares of a bill and the items each share pays for
+func (r *BillRepository) loadShares(ctx context.Context, bill *domain.Bill) error {
+	query := `
+		SELECT ` + shareColumns + `
+		FROM bill_shares
+		WHERE bill_id = $1
+		ORDER BY position
+	`
+
+	rows, err := r.db.Query(ctx, query, bill.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query bill shares: %w", err)
+	}
+
+	bill.Shares = []domain.BillShare{}
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan bill share: %w", err)
+		}
+		index[share.ID] = len(bill.Shares)
+		bill.Shares = append(bill.Shares, *share)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating bill shares: %w", err)
+	}
+
+	if bill.Mode != domain.SplitByItems || len(bill.Shares) == 0 {
+		return nil
+	}
+
+	itemQuery := `
+		SELECT si.share_id, si.order_item_id, ` + orderItemNameSQL + `, si.quantity, si.amount
+		FROM bill_share_items si
+		JOIN bill_shares s ON s.id = si.share_id
+		JOIN order_items oi ON oi.id = si.order_item_id
+		WHERE s.bill_id = $1
+		ORDER BY oi.created_at, oi.id
+	`
+
+	itemRows, err := r.db.Query(ctx, itemQuery, bill.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query bill share items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var shareID uuid.UUID
+		var item domain.BillShareItem
+		if err := itemRows.Scan(&shareID, &item.OrderItemID, &item.Name, &item.Quantity, &item.Amount); err != nil {
+			return fmt.Errorf("failed to scan bill share item: %w", err)
+		}
+		if i, ok := index[shareID]; ok {
+			bill.Shares[i].Items = append(bill.Shares[i].Items, item)
+		}
+	}
+
+	if err := itemRows.Err(); err != nil {
+		return fmt.Errorf("error iterating bill share items: %w", err)
+	}
+
+	return nil
+}
+
+// scanBill scans a row selected with billColumns
+func scanBill(row pgx.Row) (*domain.Bill, error) {
+	bill := &domain.Bill{}
+	err := row.Scan(
+		&bill.ID,
+		&bill.SourceType,
+		&bill.SourceID,
+		&bill.Mode,
+		&bill.TotalAmount,
+		&bill.Status,
+		&bill.CreatedBy,
+		&bill.Version,
+		&bill.CreatedAt,
+		&bill.UpdatedAt,
+		&bill.PaidAt,
+		&bill.VoidedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return bill, nil
+}
+
+// scanShare scans a row selected with shareColumns
+func scanShare(row pgx.Row) (*domain.BillShare, error) {
+	share := &domain.BillShare{}
+	var razorpayOrderID, razorpayPaymentID *string
+
+	err := row.Scan(
+		&share.ID,
+		&share.BillID,
+		&share.Position,
+		&share.Label,
+		&share.Amount,
+		&share.Status,
+		&razorpayOrderID,
+		&razorpayPaymentID,
+		&share.PaidAt,
+		&share.RefundedAt,
+		&share.CreatedAt,
+		&share.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if razorpayOrderID != nil {
+		share.RazorpayOrderID = *razorpayOrderID
+	}
+	if razorpayPaymentID != nil {
+		share.RazorpayPaymentID = *razorpayPaymentID
+	}
+
+	return share, nil
+}
@@ -0,0 +1,384 @@
+// Package repository implements catering request data access
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// Catering errors
+var (
+	ErrCateringClosed   = errors.New("catering request can no longer be changed")
+	ErrQuoteExpired     = errors.New("catering quote has expired")
+	ErrAdvanceNotPaid   = errors.New("catering advance has not been paid")
+	ErrNothingToCollect = errors.New("nothing left to pay on this catering request")
+)
+
+// CateringRepository handles catering requests and their linked payment orders
+type CateringRepository struct {
+	db *database.Pool
+}
+
+// NewCateringRepository creates a new catering repository
+func NewCateringRepository(db *database.Pool) *CateringRepository {
+	return &CateringRepository{db: db}
+}
+
+// cateringColumns is the column list scanned by scanCateringRequest; the
+// statuses of the linked orders give the payment progress
+const cateringColumns = `c.id, c.user_id, c.event_date, c.headcount, c.venue, c.notes, c.items, c.status,
+	c.quote_lines, c.quote_total, c.advance_percent, c.advance_amount, c.quote_note, c.quote_valid_until,
+	c.quoted_by, c.quoted_at, c.accepted_at, c.advance_order_id, c.balance_order_id, c.version, c.created_at, c.updated_at,
+	ao.status, bo.status`
+
+// cateringFrom joins the advance and balance orders for cateringColumns
+const cateringFrom = `
+	FROM catering_requests c
+	LEFT JOIN orders ao ON ao.id = c.advance_order_id
+	LEFT JOIN orders bo ON bo.id = c.balance_order_id
+`
+
+// Create inserts a new catering request
+func (r *CateringRepository) Create(ctx context.Context, req *domain.CateringRequest, eventDate time.Time) error {
+	items, err := json.Marshal(req.Items)
+	if err != nil {
+		return fmt.Errorf("failed to encode catering items: %w", err)
+	}
+
+	query := `
+		INSERT INTO catering_requests (id, user_id, event_date, headcount, venue, notes, items, status,
+			version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	now := time.Now()
+	req.ID = uuid.New()
+	req.Status = domain.CateringRequested
+	req.Version = 1
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	_, err = r.db.Exec(ctx, query,
+		req.ID,
+		req.UserID,
+		eventDate,
+		req.Headcount,
+		req.Venue,
+		req.Notes,
+		items,
+		req.Status,
+		req.Version,
+		req.CreatedAt,
+		req.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert catering request: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a catering request
+func (r *CateringRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.CateringRequest, error) {
+	query := `SELECT ` + cateringColumns + cateringFrom + `WHERE c.id = $1`
+
+	req, err := scanCateringRequest(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get catering request: %w", err)
+	}
+
+	return req, nil
+}
+
+// GetByUserID retrieves a customer's catering requests, newest first
+func (r *CateringRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.CateringRequest, error) {
+	query := `SELECT ` + cateringColumns + cateringFrom + `
+		WHERE c.user_id = $1
+		ORDER BY c.created_at DESC
+		LIMIT 100
+	`
+
+	return r.list(ctx, query, userID)
+}
+
+// GetByStatuses retrieves catering requests in any of the given statuses,
+// soonest event first (admin)
+func (r *CateringRepository) GetByStatuses(ctx context.Context, statuses []domain.CateringStatus) ([]domain.CateringRequest, error) {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	query := `SELECT ` + cateringColumns + cateringFrom + `
+		WHERE c.status = ANY($1::text[]::catering_status[])
+		ORDER BY c.event_date, c.created_at
+		LIMIT 200
+	`
+
+	return r.list(ctx, query, names)
+}
+
+func (r *CateringRepository) list(ctx context.Context, query string, arg interface{}) ([]domain.CateringRequest, error) {
+	rows, err := r.db.Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query catering requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []domain.CateringRequest{}
+	for rows.Next() {
+		req, err := scanCateringRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan catering request: %w", err)
+		}
+		requests = append(requests, *req)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating catering requests: %w", err)
+	}
+
+	return requests, nil
+}
+
+// lockCateringRequest locks a request and checks it is at the expected
+// version and in one of the allowed statuses
+func lockCateringRequest(ctx context.Context, tx pgx.Tx, id uuid.UUID, expectedVersion int, allowed ...domain.CateringStatus) (*domain.CateringRequest, error) {
+	query := `SELECT ` + cateringColumns + cateringFrom + `WHERE c.id = $1 FOR UPDATE OF c`
+
+	req, err := scanCateringRequest(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to lock catering request: %w", err)
+	}
+
+	if expectedVersion != 0 && req.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+	for _, status := range allowed {
+		if req.Status == status {
+			return req, nil
+		}
+	}
+	return nil, ErrCateringClosed
+}
+
+// Quote records (or replaces) the admin's quote of an open request
+func (r *CateringRepository) Quote(ctx context.Context, quote *domain.CateringRequest, expectedVersion int) error {
+	lines, err := json.Marshal(quote.QuoteLines)
+	if err != nil {
+		return fmt.Errorf("failed to encode quote lines: %w", err)
+	}
+
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockCateringRequest(ctx, tx, quote.ID, expectedVersion, domain.CateringRequested, domain.CateringQuoted); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE catering_requests
+			SET status = 'QUOTED', quote_lines = $2, quote_total = $3, advance_percent = $4, advance_amount = $5,
+				quote_note = $6, quote_valid_until = $7, quoted_by = $8, quoted_at = NOW(), version = version + 1
+			WHERE id = $1
+		`
+		_, err := tx.Exec(ctx, query,
+			quote.ID,
+			lines,
+			quote.QuoteTotal,
+			quote.AdvancePercent,
+			quote.AdvanceAmount,
+			quote.QuoteNote,
+			quote.QuoteValidUntil,
+			quote.QuotedBy,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record catering quote: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Accept accepts a quote that is still valid and creates the advance order
+// with it, so an accepted request always has an advance to pay
+func (r *CateringRepository) Accept(ctx context.Context, id uuid.UUID, expectedVersion int, advance *domain.Order) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		req, err := lockCateringRequest(ctx, tx, id, expectedVersion, domain.CateringQuoted)
+		if err != nil {
+			return err
+		}
+
+		if req.QuoteValidUntil != nil && time.Now().After(*req.QuoteValidUntil) {
+			return ErrQuoteExpired
+		}
+		if advance.TotalAmount != req.AdvanceAmount {
+			// Quote changed after the caller read it
+			return ErrVersionConflict
+		}
+
+		// Payment orders carry no lines, so they take no daily stock: the
+		// event's food is cooked for its date, outside the daily counts
+		advance.CateringRequestID = &id
+		if err := insertOrder(ctx, tx, advance); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE catering_requests
+			SET status = 'ACCEPTED', accepted_at = NOW(), advance_order_id = $2, version = version + 1
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, id, advance.ID); err != nil {
+			return fmt.Errorf("failed to accept catering quote: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// CreateBalanceOrder creates the order collecting the balance once the
+// advance has been paid
+func (r *CateringRepository) CreateBalanceOrder(ctx context.Context, id uuid.UUID, balance *domain.Order) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		req, err := lockCateringRequest(ctx, tx, id, 0, domain.CateringAccepted)
+		if err != nil {
+			return err
+		}
+
+		if req.Payment == domain.CateringUnpaid {
+			return ErrAdvanceNotPaid
+		}
+		if req.BalanceOrderID != nil || req.BalanceAmount() <= 0 {
+			return ErrNothingToCollect
+		}
+		if balance.TotalAmount != req.BalanceAmount() {
+			return ErrVersionConflict
+		}
+
+		// No lines and no stock, like the advance
+		balance.CateringRequestID = &id
+		if err := insertOrder(ctx, tx, balance); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE catering_requests
+			SET balance_order_id = $2, version = version + 1
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, id, balance.ID); err != nil {
+			return fmt.Errorf("failed to link balance order: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Close declines or cancels a request that has not been accepted
+func (r *CateringRepository) Close(ctx context.Context, id uuid.UUID, expectedVersion int, to domain.CateringStatus) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		allowed := []domain.CateringStatus{domain.CateringQuoted}
+		if to == domain.CateringCancelled {
+			allowed = append(allowed, domain.CateringRequested)
+		}
+		if _, err := lockCateringRequest(ctx, tx, id, expectedVersion, allowed...); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE catering_requests
+			SET status = $2, version = version + 1
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, id, to); err != nil {
+			return fmt.Errorf("failed to close catering request: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// scanCateringRequest scans a row selected with cateringColumns
+func scanCateringRequest(row pgx.Row) (*domain.CateringRequest, error) {
+	req := &domain.CateringRequest{}
+	var eventDate time.Time
+	var items, quoteLines []byte
+	var quoteTotal, advanceAmount *int64
+	var advancePercent *int
+	var advanceStatus, balanceStatus *domain.OrderStatus
+
+	err := row.Scan(
+		&req.ID,
+		&req.UserID,
+		&eventDate,
+		&req.Headcount,
+		&req.Venue,
+		&req.Notes,
+		&items,
+		&req.Status,
+		&quoteLines,
+		&quoteTotal,
+		&advancePercent,
+		&advanceAmount,
+		&req.QuoteNote,
+		&req.QuoteValidUntil,
+		&req.QuotedBy,
+		&req.QuotedAt,
+		&req.AcceptedAt,
+		&req.AdvanceOrderID,
+		&req.BalanceOrderID,
+		&req.Version,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+		&advanceStatus,
+		&balanceStatus,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	req.EventDate = eventDate.Format("2006-01-02")
+	if err := json.Unmarshal(items, &req.Items); err != nil {
+		return nil, fmt.Errorf("failed to decode catering items: %w", err)
+	}
+	if quoteLines != nil {
+		if err := json.Unmarshal(quoteLines, &req.QuoteLines); err != nil {
+			return nil, fmt.Errorf("failed to decode quote lines: %w", err)
+		}
+	}
+	if quoteTotal != nil {
+		req.QuoteTotal = *quoteTotal
+	}
+	if advancePercent != nil {
+		req.AdvancePercent = *advancePercent
+	}
+	if advanceAmount != nil {
+		req.AdvanceAmount = *advanceAmount
+	}
+
+	if req.Status == domain.CateringAccepted {
+		req.Payment = domain.CateringUnpaid
+		if advanceStatus != nil && advanceStatus.IsPaid() {
+			req.Payment = domain.CateringAdvancePaid
+			if req.BalanceAmount() <= 0 || (balanceStatus != nil && balanceStatus.IsPaid()) {
+				req.Payment = domain.CateringFullyPaid
+			}
+		}
+	}
+
+	return req, nil
+}
@@ -0,0 +1,399 @@
+// Package repository implements report exports and their background jobs
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// ExportRepository streams report rows and stores background export jobs.
+// Report rows are handed to a callback as they arrive from the database, so
+// no export is held in memory.
+type ExportRepository struct {
+	db *database.Pool
+}
+
+// NewExportRepository creates a new export repository
+func NewExportRepository(db *database.Pool) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+// Report queries; every range is [from, to)
+const (
+	orderLinesFrom = `
+		FROM orders o
+		JOIN users u ON u.id = o.user_id
+		LEFT JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.created_at >= $1 AND o.created_at < $2
+	`
+
+	itemSalesQuery = `
+		SELECT date_trunc('day', o.paid_at AT TIME ZONE $3) AS day, m.id, m.name, m.category,
+			SUM(oi.quantity), SUM(oi.price::BIGINT * oi.quantity), COUNT(DISTINCT oi.order_id)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		JOIN menu_items m ON m.id = oi.menu_item_id
+		WHERE o.paid_at >= $1 AND o.paid_at < $2
+		GROUP BY 1, m.id
+	`
+
+	paymentLogsFrom = `
+		FROM webhook_logs w
+		CROSS JOIN LATERAL (SELECT w.payload->'payload'->'payment'->'entity' AS p) e
+		WHERE w.created_at >= $1 AND w.created_at < $2
+	`
+)
+
+// CountRows counts the rows an export of a range would have
+func (r *ExportRepository) CountRows(ctx context.Context, kind domain.ExportKind, from, to time.Time, timezone string) (int64, error) {
+	var query string
+	args := []interface{}{from, to}
+
+	switch kind {
+	case domain.ExportOrders:
+		query = `SELECT COUNT(*) ` + orderLinesFrom
+	case domain.ExportItems:
+		query = `SELECT COUNT(*) FROM (` + itemSalesQuery + `) sales`
+		args = append(args, timezone)
+	case domain.ExportPayments:
+		query = `SELECT COUNT(*) ` + paymentLogsFrom
+	default:
+		return 0, fmt.Errorf("unknown export kind %q", kind)
+	}
+
+	var count int64
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count %s export rows: %w", kind, err)
+	}
+
+	return count, nil
+}
+
+// StreamOrderLines reads every order line of orders placed in the range,
+// oldest order first
+func (r *ExportRepository) StreamOrderLines(ctx context.Context, from, to time.Time, each func(*domain.OrderExportLine) error) error {
+	query := `
+		SELECT o.id, o.created_at, o.paid_at, o.status, o.fulfillment_type,
+			u.name, u.phone_number, COALESCE(u.email, ''),
+			COALESCE(o.razorpay_order_id, ''), COALESCE(o.razorpay_payment_id, ''),
+			o.total_amount, o.delivery_fee,
+			COALESCE(` + orderItemNameSQL + `, ''), COALESCE(oi.quantity, 0), COALESCE(oi.price, 0)
+	` + orderLinesFrom + `
+		ORDER BY o.created_at, o.id, oi.created_at, oi.id
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to query order lines: %w", err)
+	}
+	defer rows.Close()
+
+	var line domain.OrderExportLine
+	for rows.Next() {
+		err := rows.Scan(
+			&line.OrderID,
+			&line.CreatedAt,
+			&line.PaidAt,
+			&line.Status,
+			&line.FulfillmentType,
+			&line.CustomerName,
+			&line.CustomerPhone,
+			&line.CustomerEmail,
+			&line.RazorpayOrderID,
+			&line.RazorpayPaymentID,
+			&line.TotalAmount,
+			&line.DeliveryFee,
+			&line.ItemName,
+			&line.Quantity,
+			&line.UnitPrice,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan order line: %w", err)
+		}
+		if err := each(&line); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating order lines: %w", err)
+	}
+
+	return nil
+}
+
+// StreamItemSales reads what each menu item sold per day (in timezone) in
+// orders paid in the range, by day and item name
+func (r *ExportRepository) StreamItemSales(ctx context.Context, from, to time.Time, timezone string, each func(*domain.ItemSalesExportRow) error) error {
+	rows, err := r.db.Query(ctx, itemSalesQuery+` ORDER BY 1, m.name, m.id`, from, to, timezone)
+	if err != nil {
+		return fmt.Errorf("failed to query item sales: %w", err)
+	}
+	defer rows.Close()
+
+	var row domain.ItemSalesExportRow
+	for rows.Next() {
+		if err := rows.Scan(&row.Day, &row.MenuItemID, &row.Name, &row.Category, &row.Quantity, &row.Revenue, &row.Orders); err != nil {
+			return fmt.Errorf("failed to scan item sales: %w", err)
+		}
+		if err := each(&row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating item sales: %w", err)
+	}
+
+	return nil
+}
+
+// StreamPaymentLogs reads the webhooks logged in the range with the payment
+// fields pulled out of their payloads, oldest first
+func (r *ExportRepository) StreamPaymentLogs(ctx context.Context, from, to time.Time, each func(*domain.PaymentLogExportRow) error) error {
+	query := `
+		SELECT w.created_at, w.source, w.event_type,
+			COALESCE(e.p->>'id', ''), COALESCE(e.p->>'order_id', ''),
+			COALESCE(CASE WHEN jsonb_typeof(e.p->'amount') = 'number' THEN (e.p->>'amount')::BIGINT END, 0),
+			COALESCE(e.p->>'method', ''), COALESCE(e.p->>'status', ''),
+			COALESCE(e.p->>'error_code', ''), COALESCE(e.p->>'error_description', ''),
+			w.signature_valid, w.processed, COALESCE(w.processing_error, ''), w.order_id
+	` + paymentLogsFrom + `
+		ORDER BY w.created_at, w.id
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to query payment logs: %w", err)
+	}
+	defer rows.Close()
+
+	var row domain.PaymentLogExportRow
+	for rows.Next() {
+		err := rows.Scan(
+			&row.ReceivedAt,
+			&row.Source,
+			&row.EventType,
+			&row.RazorpayPaymentID,
+			&row.RazorpayOrderID,
+			&row.Amount,
+			&row.Method,
+			&row.PaymentStatus,
+			&row.ErrorCode,
+			&row.ErrorDescription,
+			&row.SignatureValid,
+			&row.Processed,
+			&row.ProcessingError,
+			&row.OrderID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan payment log: %w", err)
+		}
+		if err := each(&row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating payment logs: %w", err)
+	}
+
+	return nil
+}
+
+// ============================================================================
+// BACKGROUND JOBS
+// ============================================================================
+
+const exportJobColumns = `id, requested_by, kind, format, range_from, range_to, status, rows_written, size_bytes,
+	error, file_path, created_at, started_at, finished_at, expires_at`
+
+// CreateJob queues a background export
+func (r *ExportRepository) CreateJob(ctx context.Context, job *domain.ExportJob) error {
+	query := `
+		INSERT INTO export_jobs (id, requested_by, kind, format, range_from, range_to, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	job.ID = uuid.New()
+	job.Status = domain.ExportPending
+	job.CreatedAt = time.Now()
+
+	_, err := r.db.Exec(ctx, query, job.ID, job.RequestedBy, job.Kind, job.Format, job.From, job.To, job.Status, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create export job: %w", err)
+	}
+
+	return nil
+}
+
+// GetJob retrieves an export job
+func (r *ExportRepository) GetJob(ctx context.Context, id uuid.UUID) (*domain.ExportJob, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+exportJobColumns+` FROM export_jobs WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query export job: %w", err)
+	}
+
+	jobs, err := collectExportJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &jobs[0], nil
+}
+
+// ListJobs retrieves the newest export jobs
+func (r *ExportRepository) ListJobs(ctx context.Context, limit int) ([]domain.ExportJob, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+exportJobColumns+` FROM export_jobs ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query export jobs: %w", err)
+	}
+
+	return collectExportJobs(rows)
+}
+
+// ClaimJob takes the oldest pending job, or a running one whose worker has
+// not finished within staleAfter (it is assumed to have died). Returns nil
+// if there is nothing to run.
+func (r *ExportRepository) ClaimJob(ctx context.Context, staleAfter time.Duration) (*domain.ExportJob, error) {
+	query := `
+		UPDATE export_jobs
+		SET status = 'RUNNING', started_at = NOW()
+		WHERE id = (
+			SELECT id FROM export_jobs
+			WHERE status = 'PENDING'
+				OR (status = 'RUNNING' AND started_at < NOW() - $1 * INTERVAL '1 second')
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportJobColumns
+
+	rows, err := r.db.Query(ctx, query, int(staleAfter.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim export job: %w", err)
+	}
+
+	jobs, err := collectExportJobs(rows)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+
+	return &jobs[0], nil
+}
+
+// CompleteJob records a finished export file. Returns ErrNotFound if the job
+// is no longer running under this claim, e.g. it was taken over as stale.
+func (r *ExportRepository) CompleteJob(ctx context.Context, job *domain.ExportJob) error {
+	query := `
+		UPDATE export_jobs
+		SET status = 'DONE', rows_written = $3, size_bytes = $4, file_path = $5,
+			finished_at = NOW(), expires_at = $6, error = ''
+		WHERE id = $1 AND status = 'RUNNING' AND started_at = $2
+	`
+
+	result, err := r.db.Exec(ctx, query, job.ID, job.StartedAt, job.Rows, job.Size, job.FilePath, job.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to complete export job: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// FailJob records why an export could not be written
+func (r *ExportRepository) FailJob(ctx context.Context, job *domain.ExportJob, reason string) error {
+	query := `
+		UPDATE export_jobs
+		SET status = 'FAILED', error = $3, finished_at = NOW()
+		WHERE id = $1 AND status = 'RUNNING' AND started_at = $2
+	`
+
+	if _, err := r.db.Exec(ctx, query, job.ID, job.StartedAt, reason); err != nil {
+		return fmt.Errorf("failed to fail export job: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredJobs deletes finished jobs past their expiry, and failed jobs
+// older than before. Returns the files of the deleted jobs.
+func (r *ExportRepository) DeleteExpiredJobs(ctx context.Context, before time.Time) ([]string, error) {
+	query := `
+		DELETE FROM export_jobs
+		WHERE (status = 'DONE' AND expires_at < NOW())
+			OR (status = 'FAILED' AND finished_at < $1)
+		RETURNING file_path
+	`
+
+	rows, err := r.db.Query(ctx, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired export jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan export file: %w", err)
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating expired export jobs: %w", err)
+	}
+
+	return paths, nil
+}
+
+func collectExportJobs(rows pgx.Rows) ([]domain.ExportJob, error) {
+	defer rows.Close()
+
+	var jobs []domain.ExportJob
+	for rows.Next() {
+		var job domain.ExportJob
+		err := rows.Scan(
+			&job.ID,
+			&job.RequestedBy,
+			&job.Kind,
+			&job.Format,
+			&job.From,
+			&job.To,
+			&job.Status,
+			&job.Rows,
+			&job.Size,
+			&job.Error,
+			&job.FilePath,
+			&job.CreatedAt,
+			&job.StartedAt,
+			&job.FinishedAt,
+			&job.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan export job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating export jobs: %w", err)
+	}
+
+	return jobs, nil
+}
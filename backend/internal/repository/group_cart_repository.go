@@ -0,0 +1,479 @@
+// Package repository implements group cart data access
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// Group cart errors
+var (
+	ErrGroupCartClosed = errors.New("group cart is not open for changes")
+	ErrGroupCartFull   = errors.New("group cart is full")
+	ErrNotGroupMember  = errors.New("user has not joined this group cart")
+)
+
+// GroupCartRepository handles shared group carts, their members and items
+type GroupCartRepository struct {
+	db *database.Pool
+}
+
+// NewGroupCartRepository creates a new group cart repository
+func NewGroupCartRepository(db *database.Pool) *GroupCartRepository {
+	return &GroupCartRepository{db: db}
+}
+
+// groupCartColumns is the column list scanned by GetByID
+const groupCartColumns = `id, host_id, invite_code, status, notes, order_id, version,
+	created_at, updated_at, locked_at, expires_at`
+
+// Create inserts a group cart with its host as the first member.
+// Returns ErrDuplicateKey if the invite code is taken.
+func (r *GroupCartRepository) Create(ctx context.Context, cart *domain.GroupCart, hostName string) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now()
+		cart.ID = uuid.New()
+		cart.Status = domain.GroupCartOpen
+		cart.Version = 1
+		cart.CreatedAt = now
+		cart.UpdatedAt = now
+		cart.ExpiresAt = now.Add(domain.GroupCartTTL)
+
+		query := `
+			INSERT INTO group_carts (id, host_id, invite_code, status, notes, version, created_at, updated_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`
+		_, err := tx.Exec(ctx, query,
+			cart.ID,
+			cart.HostID,
+			cart.InviteCode,
+			cart.Status,
+			cart.Notes,
+			cart.Version,
+			cart.CreatedAt,
+			cart.UpdatedAt,
+			cart.ExpiresAt,
+		)
+		if err != nil {
+			if isDuplicateKeyError(err) {
+				return ErrDuplicateKey
+			}
+			return fmt.Errorf("failed to insert group cart: %w", err)
+		}
+
+		memberQuery := `
+			INSERT INTO group_cart_members (cart_id, user_id, name, joined_at)
+			VALUES ($1, $2, $3, $4)
+		`
+		if _, err := tx.Exec(ctx, memberQuery, cart.ID, cart.HostID, hostName, now); err != nil {
+			return fmt.Errorf("failed to add group cart host: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetByID retrieves a group cart with its members and items.
+// Items carry the current menu name, price and availability.
+func (r *GroupCartRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.GroupCart, error) {
+	query := `
+		SELECT ` + groupCartColumns + `
+		FROM group_carts
+		WHERE id = $1
+	`
+
+	cart := &domain.GroupCart{}
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&cart.ID,
+		&cart.HostID,
+		&cart.InviteCode,
+		&cart.Status,
+		&cart.Notes,
+		&cart.OrderID,
+		&cart.Version,
+		&cart.CreatedAt,
+		&cart.UpdatedAt,
+		&cart.LockedAt,
+		&cart.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get group cart: %w", err)
+	}
+
+	if err := r.loadMembers(ctx, cart); err != nil {
+		return nil, err
+	}
+	if err := r.loadItems(ctx, cart); err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// GetIDByInviteCode resolves an invite code to its group cart
+func (r *GroupCartRepository) GetIDByInviteCode(ctx context.Context, code string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRow(ctx, `SELECT id FROM group_carts WHERE invite_code = $1`, code).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to get group cart by invite code: %w", err)
+	}
+	return id, nil
+}
+
+// lockOpenCart locks a cart that is still taking changes
+func lockOpenCart(ctx context.Context, tx pgx.Tx, cartID uuid.UUID) error {
+	var status domain.GroupCartStatus
+	var expiresAt time.Time
+
+	err := tx.QueryRow(ctx, `SELECT status, expires_at FROM group_carts WHERE id = $1 FOR UPDATE`, cartID).
+		Scan(&status, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to lock group cart: %w", err)
+	}
+
+	if status != domain.GroupCartOpen || time.Now().After(expiresAt) {
+		return ErrGroupCartClosed
+	}
+	return nil
+}
+
+// touchCart bumps the cart version so the host locks exactly what they reviewed
+func touchCart(ctx context.Context, tx pgx.Tx, cartID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `UPDATE group_carts SET version = version + 1 WHERE id = $1`, cartID); err != nil {
+		return fmt.Errorf("failed to update group cart version: %w", err)
+	}
+	return nil
+}
+
+// checkMember returns ErrNotGroupMember unless the user joined the cart
+func checkMember(ctx context.Context, tx pgx.Tx, cartID, userID uuid.UUID) error {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM group_cart_members WHERE cart_id = $1 AND user_id = $2)`
+	if err := tx.QueryRow(ctx, query, cartID, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check group cart membership: %w", err)
+	}
+	if !exists {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+// AddMember joins a user to an open cart. Joining twice is a no-op.
+func (r *GroupCartRepository) AddMember(ctx context.Context, cartID, userID uuid.UUID, name string) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if err := lockOpenCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+
+		if err := checkMember(ctx, tx, cartID, userID); err == nil {
+			return nil
+		} else if !errors.Is(err, ErrNotGroupMember) {
+			return err
+		}
+
+		var members int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM group_cart_members WHERE cart_id = $1`, cartID).Scan(&members); err != nil {
+			return fmt.Errorf("failed to count group cart members: %w", err)
+		}
+		if members >= domain.MaxGroupCartMembers {
+			return ErrGroupCartFull
+		}
+
+		query := `
+			INSERT INTO group_cart_members (cart_id, user_id, name)
+			VALUES ($1, $2, $3)
+		`
+		if _, err := tx.Exec(ctx, query, cartID, userID, name); err != nil {
+			return fmt.Errorf("failed to add group cart member: %w", err)
+		}
+
+		return touchCart(ctx, tx, cartID)
+	})
+}
+
+// AddItem adds a member's line to an open cart
+func (r *GroupCartRepository) AddItem(ctx context.Context, cartID uuid.UUID, item *domain.GroupCartItem) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if err := lockOpenCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+		if err := checkMember(ctx, tx, cartID, item.UserID); err != nil {
+			return err
+		}
+
+		var lines int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM group_cart_items WHERE cart_id = $1`, cartID).Scan(&lines); err != nil {
+			return fmt.Errorf("failed to count group cart items: %w", err)
+		}
+		if lines >= domain.MaxGroupCartLines {
+			return ErrGroupCartFull
+		}
+
+		now := time.Now()
+		item.ID = uuid.New()
+		item.CreatedAt = now
+		item.UpdatedAt = now
+
+		query := `
+			INSERT INTO group_cart_items (id, cart_id, user_id, menu_item_id, variant_id, modifier_option_ids, bundle_choices, quantity, notes, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`
+		modifierIDs := item.ModifierIDs
+		if modifierIDs == nil {
+			modifierIDs = []uuid.UUID{}
+		}
+		bundleChoices := item.BundleChoices
+		if bundleChoices == nil {
+			bundleChoices = map[uuid.UUID]uuid.UUID{}
+		}
+		bundleChoicesJSON, err := json.Marshal(bundleChoices)
+		if err != nil {
+			return fmt.Errorf("failed to encode bundle choices: %w", err)
+		}
+		_, err = tx.Exec(ctx, query,
+			item.ID,
+			cartID,
+			item.UserID,
+			item.MenuItemID,
+			item.VariantID,
+			modifierIDs,
+			bundleChoicesJSON,
+			item.Quantity,
+			item.Notes,
+			item.CreatedAt,
+			item.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert group cart item: %w", err)
+		}
+
+		return touchCart(ctx, tx, cartID)
+	})
+}
+
+// UpdateItem changes the quantity and notes of a member's own line
+func (r *GroupCartRepository) UpdateItem(ctx context.Context, cartID, itemID, userID uuid.UUID, quantity int, notes string) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if err := lockOpenCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE group_cart_items
+			SET quantity = $4, notes = $5
+			WHERE id = $1 AND cart_id = $2 AND user_id = $3
+		`
+		result, err := tx.Exec(ctx, query, itemID, cartID, userID, quantity, notes)
+		if err != nil {
+			return fmt.Errorf("failed to update group cart item: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		return touchCart(ctx, tx, cartID)
+	})
+}
+
+// RemoveItem deletes a line. Members remove their own lines; the host
+// (anyMember) can remove anyone's.
+func (r *GroupCartRepository) RemoveItem(ctx context.Context, cartID, itemID, userID uuid.UUID, anyMember bool) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if err := lockOpenCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+
+		query := `
+			DELETE FROM group_cart_items
+			WHERE id = $1 AND cart_id = $2 AND ($4 OR user_id = $3)
+		`
+		result, err := tx.Exec(ctx, query, itemID, cartID, userID, anyMember)
+		if err != nil {
+			return fmt.Errorf("failed to remove group cart item: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		return touchCart(ctx, tx, cartID)
+	})
+}
+
+// UpdateStatus moves a cart from one of the given statuses to another.
+// A non-zero expectedVersion must match, so the host locks exactly the
+// contents they reviewed. Returns ErrVersionConflict when the contents
+// changed and ErrGroupCartClosed when the cart is in another status.
+func (r *GroupCartRepository) UpdateStatus(ctx context.Context, cartID uuid.UUID, from []domain.GroupCartStatus, to domain.GroupCartStatus, expectedVersion int) error {
+	fromStatuses := make([]string, len(from))
+	for i, s := range from {
+		fromStatuses[i] = string(s)
+	}
+
+	query := `
+		UPDATE group_carts
+		SET status = $3,
+			locked_at = CASE WHEN $3 = 'LOCKED' THEN NOW() ELSE locked_at END,
+			version = version + 1
+		WHERE id = $1
+			AND status = ANY($2::text[]::group_cart_status[])
+			AND ($4 = 0 OR version = $4)
+	`
+
+	result, err := r.db.Exec(ctx, query, cartID, fromStatuses, to, expectedVersion)
+	if err != nil {
+		return fmt.Errorf("failed to update group cart status: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	var current domain.GroupCartStatus
+	if err := r.db.QueryRow(ctx, `SELECT status FROM group_carts WHERE id = $1`, cartID).Scan(&current); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to get group cart status: %w", err)
+	}
+	for _, s := range from {
+		if s == current {
+			return ErrVersionConflict
+		}
+	}
+	return ErrGroupCartClosed
+}
+
+// MarkCheckedOut links the order placed from a locked cart
+func (r *GroupCartRepository) MarkCheckedOut(ctx context.Context, cartID, orderID uuid.UUID) error {
+	query := `
+		UPDATE group_carts
+		SET status = 'CHECKED_OUT', order_id = $2, version = version + 1
+		WHERE id = $1 AND status = 'LOCKED'
+	`
+
+	result, err := r.db.Exec(ctx, query, cartID, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to check out group cart: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrGroupCartClosed
+	}
+
+	return nil
+}
+
+// loadMembers fills the members of a cart in joining order
+func (r *GroupCartRepository) loadMembers(ctx context.Context, cart *domain.GroupCart) error {
+	query := `
+		SELECT user_id, name, joined_at
+		FROM group_cart_members
+		WHERE cart_id = $1
+		ORDER BY joined_at, user_id
+	`
+
+	rows, err := r.db.Query(ctx, query, cart.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query group cart members: %w", err)
+	}
+	defer rows.Close()
+
+	cart.Members = []domain.GroupCartMember{}
+	for rows.Next() {
+		var member domain.GroupCartMember
+		if err := rows.Scan(&member.UserID, &member.Name, &member.JoinedAt); err != nil {
+			return fmt.Errorf("failed to scan group cart member: %w", err)
+		}
+		cart.Members = append(cart.Members, member)
+	}
+
+	return rows.Err()
+}
+
+// loadItems fills the items of a cart with current menu details, priced
+// at the chosen variant plus the chosen modifiers. A line whose modifier
+// options were removed is unavailable.
+func (r *GroupCartRepository) loadItems(ctx context.Context, cart *domain.GroupCart) error {
+	query := `
+		SELECT i.id, i.user_id, i.menu_item_id, m.name, i.variant_id, COALESCE(v.name, ''),
+			i.modifier_option_ids, mo.names, i.bundle_choices,
+			COALESCE(v.price, m.price) + mo.price,
+			m.is_available AND COALESCE(v.is_available, TRUE) AND mo.available
+				AND mo.found = CARDINALITY(i.modifier_option_ids),
+			i.quantity, i.notes, i.created_at, i.updated_at
+		FROM group_cart_items i
+		JOIN menu_items m ON m.id = i.menu_item_id
+		LEFT JOIN menu_item_variants v ON v.id = i.variant_id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(o.price), 0) AS price,
+				COALESCE(BOOL_AND(o.is_available), TRUE) AS available,
+				COUNT(*) AS found,
+				COALESCE(ARRAY_AGG(o.name ORDER BY g.sort_order, g.name, o.sort_order, o.name), '{}') AS names
+			FROM modifier_options o
+			JOIN modifier_groups g ON g.id = o.group_id
+			WHERE o.id = ANY(i.modifier_option_ids) AND g.menu_item_id = i.menu_item_id
+		) mo
+		WHERE i.cart_id = $1
+		ORDER BY i.created_at, i.id
+	`
+
+	rows, err := r.db.Query(ctx, query, cart.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query group cart items: %w", err)
+	}
+	defer rows.Close()
+
+	cart.Items = []domain.GroupCartItem{}
+	for rows.Next() {
+		var item domain.GroupCartItem
+		var bundleChoices []byte
+		err := rows.Scan(
+			&item.ID,
+			&item.UserID,
+			&item.MenuItemID,
+			&item.Name,
+			&item.VariantID,
+			&item.VariantName,
+			&item.ModifierIDs,
+			&item.Modifiers,
+			&bundleChoices,
+			&item.Price,
+			&item.IsAvailable,
+			&item.Quantity,
+			&item.Notes,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan group cart item: %w", err)
+		}
+		if len(item.ModifierIDs) == 0 {
+			item.ModifierIDs, item.Modifiers = nil, nil
+		}
+		if err := json.Unmarshal(bundleChoices, &item.BundleChoices); err != nil {
+			return fmt.Errorf("failed to decode bundle choices: %w", err)
+		}
+		if len(item.BundleChoices) == 0 {
+			item.BundleChoices = nil
+		}
+		cart.Items = append(cart.Items, item)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,373 @@
+// Package repository implements the order and payment consistency checks
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// IntegrityRepository runs consistency checks over orders and payments and
+// stores their findings. Checks look at orders created, and webhooks
+// received, after since; each returns at most limit findings.
+type IntegrityRepository struct {
+	db *database.Pool
+}
+
+// NewIntegrityRepository creates a new integrity repository
+func NewIntegrityRepository(db *database.Pool) *IntegrityRepository {
+	return &IntegrityRepository{db: db}
+}
+
+// Order statuses as SQL lists
+const (
+	paidStatusesSQL   = `('PAID', 'ACCEPTED', 'OUT_FOR_DELIVERY', 'DELIVERED', 'READY_FOR_PICKUP', 'COLLECTED')`
+	unpaidStatusesSQL = `('PENDING', 'AWAITING_PAYMENT', 'PAYMENT_FAILED')`
+)
+
+// capturedPaymentSQL is the payment ID of a webhook log row w
+const capturedPaymentSQL = `w.payload->'payload'->'payment'->'entity'->>'id'`
+
+// FindOrderTotalMismatches finds orders whose total is not their items plus
+// delivery fee. Tiffin and catering orders are priced by their plan or quote,
+// not their items, and are left out.
+func (r *IntegrityRepository) FindOrderTotalMismatches(ctx context.Context, since time.Time, limit int) ([]domain.IntegrityFinding, error) {
+	return r.find(ctx, `
+		SELECT o.id::TEXT, o.id,
+			format('total_amount is %s paisa but items sum to %s plus delivery fee %s',
+				o.total_amount, COALESCE(SUM(oi.price::BIGINT * oi.quantity), 0), o.delivery_fee)
+		FROM orders o
+		LEFT JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.created_at >= $1 AND o.subscription_id IS NULL AND o.catering_request_id IS NULL
+		GROUP BY o.id
+		HAVING o.total_amount <> COALESCE(SUM(oi.price::BIGINT * oi.quantity), 0) + o.delivery_fee
+		ORDER BY o.created_at
+		LIMIT $2
+	`, since, limit)
+}
+
+// FindPaidWithoutCapture finds paid orders with a gateway payment that has no
+// valid payment.captured webhook, ignoring orders paid after webhookBy since
+// their webhook may still be on its way
+func (r *IntegrityRepository) FindPaidWithoutCapture(ctx context.Context, since, webhookBy time.Time, limit int) ([]domain.IntegrityFinding, error) {
+	return r.find(ctx, `
+		SELECT o.id::TEXT, o.id,
+			format('%s order paid with %s at %s has no payment.captured webhook',
+				o.status, o.razorpay_payment_id, o.paid_at)
+		FROM orders o
+		WHERE o.created_at >= $1 AND o.status IN `+paidStatusesSQL+`
+			AND o.razorpay_payment_id IS NOT NULL AND o.paid_at < $3
+			AND NOT EXISTS (
+				SELECT 1 FROM webhook_logs w
+				WHERE w.event_type = 'payment.captured' AND w.source = 'razorpay' AND w.signature_valid
+					AND `+capturedPaymentSQL+` = o.razorpay_payment_id
+			)
+		ORDER BY o.created_at
+		LIMIT $2
+	`, since, limit, webhookBy)
+}
+
+// FindStatusPaymentMismatches finds orders whose status disagrees with their
+// payment: paid statuses without paid_at, unpaid statuses with a payment, and
+// paid gateway checkouts with no payment ID that no split bill paid. Table
+// rounds the kitchen works on before the tab is settled have no paid_at yet
+// and are left out.
+func (r *IntegrityRepository) FindStatusPaymentMismatches(ctx context.Context, since time.Time, limit int) ([]domain.IntegrityFinding, error) {
+	return r.find(ctx, `
+		SELECT o.id::TEXT, o.id,
+			CASE
+				WHEN o.status IN `+paidStatusesSQL+` AND o.paid_at IS NULL
+					THEN format('status is %s but paid_at is not set', o.status)
+				WHEN o.status IN `+unpaidStatusesSQL+` AND o.paid_at IS NOT NULL
+					THEN format('status is %s but the order was paid at %s', o.status, o.paid_at)
+				WHEN o.status IN `+unpaidStatusesSQL+`
+					THEN format('status is %s but it has payment %s', o.status, o.razorpay_payment_id)
+				ELSE format('status is %s with gateway order %s but no payment ID and no paid split bill',
+					o.status, o.razorpay_order_id)
+			END
+		FROM orders o
+		WHERE o.created_at >= $1 AND (
+			(o.status IN `+paidStatusesSQL+` AND o.paid_at IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM table_sessions ts WHERE ts.id = o.table_session_id AND ts.status <> 'SETTLED'
+				))
+			OR (o.status IN `+unpaidStatusesSQL+` AND (o.paid_at IS NOT NULL OR o.razorpay_payment_id IS NOT NULL))
+			OR (o.status IN `+paidStatusesSQL+` AND o.razorpay_order_id IS NOT NULL AND o.razorpay_payment_id IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM bills b WHERE b.source_type = 'order' AND b.source_id = o.id AND b.status = 'PAID'
+				))
+		)
+		ORDER BY o.created_at
+		LIMIT $2
+	`, since, limit)
+}
+
+// FindOrphanedWebhooks finds captured payments that are recorded on no order
+// and on nothing else customers pay for. When the gateway order belongs to
+// one of our orders, that order is linked. Webhooks received after
+// webhookBy are left for the payment flow to finish first.
+func (r *IntegrityRepository) FindOrphanedWebhooks(ctx context.Context, since, webhookBy time.Time, limit int) ([]domain.IntegrityFinding, error) {
+	return r.find(ctx, `
+		SELECT payment_id, order_id, details
+		FROM (
+			SELECT DISTINCT ON (e.payment_id) e.payment_id, ro.id AS order_id, w.created_at,
+				format('payment %s (gateway order %s) captured at %s is not recorded on any order or other payment',
+					e.payment_id, COALESCE(e.gateway_order_id, 'unknown'), w.created_at) AS details
+			FROM webhook_logs w
+			CROSS JOIN LATERAL (
+				SELECT `+capturedPaymentSQL+` AS payment_id,
+					w.payload->'payload'->'payment'->'entity'->>'order_id' AS gateway_order_id
+			) e
+			LEFT JOIN orders ro ON ro.razorpay_order_id = e.gateway_order_id
+			WHERE w.source = 'razorpay' AND w.event_type = 'payment.captured' AND w.signature_valid
+				AND w.created_at >= $1 AND w.created_at < $3 AND e.payment_id IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.razorpay_payment_id = e.payment_id)
+				AND NOT `+otherPaymentExists("e.payment_id")+`
+			ORDER BY e.payment_id, w.created_at
+		) orphans
+		ORDER BY created_at
+		LIMIT $2
+	`, since, limit, webhookBy)
+}
+
+// FindStuckOrders finds orders that have been in a status longer than its
+// limit. Catering orders are scheduled days ahead and are left out.
+func (r *IntegrityRepository) FindStuckOrders(ctx context.Context, since time.Time, limits map[domain.OrderStatus]time.Duration, limit int) ([]domain.IntegrityFinding, error) {
+	statuses := make([]string, 0, len(limits))
+	seconds := make([]int64, 0, len(limits))
+	for status, d := range limits {
+		statuses = append(statuses, string(status))
+		seconds = append(seconds, int64(d.Seconds()))
+	}
+
+	return r.find(ctx, `
+		SELECT o.id::TEXT, o.id, format('%s since %s', o.status, o.updated_at)
+		FROM orders o
+		JOIN unnest($3::TEXT[], $4::BIGINT[]) AS l(status, seconds) ON l.status = o.status::TEXT
+		WHERE o.created_at >= $1 AND o.catering_request_id IS NULL
+			AND o.updated_at < NOW() - l.seconds * INTERVAL '1 second'
+		ORDER BY o.updated_at
+		LIMIT $2
+	`, since, limit, statuses, seconds)
+}
+
+// find runs a check query selecting subject, order ID and details
+func (r *IntegrityRepository) find(ctx context.Context, query string, args ...interface{}) ([]domain.IntegrityFinding, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var findings []domain.IntegrityFinding
+	for rows.Next() {
+		var f domain.IntegrityFinding
+		if err := rows.Scan(&f.Subject, &f.OrderID, &f.Details); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity finding: %w", err)
+		}
+		findings = append(findings, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating integrity findings: %w", err)
+	}
+
+	return findings, nil
+}
+
+// ============================================================================
+// RUNS AND FINDINGS
+// ============================================================================
+
+// StartRun records the start of a run. A nightly run is for a business day
+// and returns ErrNotFound if another instance already started that day's run.
+func (r *IntegrityRepository) StartRun(ctx context.Context, day *time.Time) (*domain.IntegrityRun, error) {
+	run := &domain.IntegrityRun{ID: uuid.New(), Scheduled: day != nil}
+
+	var runDate interface{}
+	if day != nil {
+		runDate = day.Format("2006-01-02")
+	}
+
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO integrity_runs (id, run_date)
+		VALUES ($1, $2::DATE)
+		ON CONFLICT (run_date) DO NOTHING
+		RETURNING started_at
+	`, run.ID, runDate).Scan(&run.StartedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start integrity run: %w", err)
+	}
+
+	return run, nil
+}
+
+// RecordFindings stores what one check found in a run. Findings seen before
+// keep their first sighting and are reopened if they had been resolved; the
+// check's open findings not seen in this run are resolved, unless resolve is
+// false because the check did not see everything. Returns the new and
+// resolved counts.
+func (r *IntegrityRepository) RecordFindings(ctx context.Context, run *domain.IntegrityRun, check domain.IntegrityCheck, findings []domain.IntegrityFinding, resolve bool) (int64, int64, error) {
+	var created, resolved int64
+
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		created, resolved = 0, 0
+
+		for _, f := range findings {
+			var inserted bool
+			err := tx.QueryRow(ctx, `
+				INSERT INTO integrity_findings (id, check_name, subject, order_id, details, first_seen_at, last_seen_at, last_run_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $6, $7)
+				ON CONFLICT (check_name, subject) DO UPDATE SET
+					order_id = EXCLUDED.order_id,
+					details = EXCLUDED.details,
+					last_seen_at = EXCLUDED.last_seen_at,
+					last_run_id = EXCLUDED.last_run_id,
+					resolved_at = NULL
+				RETURNING xmax = 0
+			`, uuid.New(), check, f.Subject, f.OrderID, f.Details, run.StartedAt, run.ID).Scan(&inserted)
+			if err != nil {
+				return fmt.Errorf("failed to store integrity finding: %w", err)
+			}
+			if inserted {
+				created++
+			}
+		}
+
+		if !resolve {
+			return nil
+		}
+
+		result, err := tx.Exec(ctx, `
+			UPDATE integrity_findings
+			SET resolved_at = NOW()
+			WHERE check_name = $1 AND resolved_at IS NULL AND last_seen_at < $2
+		`, check, run.StartedAt)
+		if err != nil {
+			return fmt.Errorf("failed to resolve integrity findings: %w", err)
+		}
+		resolved = result.RowsAffected()
+
+		return nil
+	})
+
+	return created, resolved, err
+}
+
+// FinishRun records the outcome of a run and counts the open findings
+func (r *IntegrityRepository) FinishRun(ctx context.Context, run *domain.IntegrityRun) error {
+	err := r.db.QueryRow(ctx, `
+		UPDATE integrity_runs
+		SET finished_at = NOW(),
+			findings = (SELECT COUNT(*) FROM integrity_findings WHERE resolved_at IS NULL),
+			new_findings = $2, resolved_findings = $3, error = $4
+		WHERE id = $1
+		RETURNING finished_at, findings
+	`, run.ID, run.New, run.Resolved, run.Error).Scan(&run.FinishedAt, &run.Findings)
+	if err != nil {
+		return fmt.Errorf("failed to finish integrity run: %w", err)
+	}
+
+	return nil
+}
+
+// ListRuns retrieves the newest runs
+func (r *IntegrityRepository) ListRuns(ctx context.Context, limit int) ([]domain.IntegrityRun, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, run_date IS NOT NULL, started_at, finished_at, findings, new_findings, resolved_findings, error
+		FROM integrity_runs
+		ORDER BY started_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query integrity runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []domain.IntegrityRun
+	for rows.Next() {
+		var run domain.IntegrityRun
+		err := rows.Scan(
+			&run.ID,
+			&run.Scheduled,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.Findings,
+			&run.New,
+			&run.Resolved,
+			&run.Error,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan integrity run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating integrity runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// IntegrityFindingFilter selects findings; zero values mean "no filter"
+type IntegrityFindingFilter struct {
+	Check   domain.IntegrityCheck
+	Open    *bool // Unresolved (true) or resolved (false) findings
+	OrderID *uuid.UUID
+	Limit   int
+}
+
+// ListFindings retrieves findings, most recently seen first
+func (r *IntegrityRepository) ListFindings(ctx context.Context, filter IntegrityFindingFilter) ([]domain.IntegrityFinding, error) {
+	query := `
+		SELECT id, check_name, subject, order_id, details, first_seen_at, last_seen_at, resolved_at
+		FROM integrity_findings
+		WHERE ($1 = '' OR check_name = $1)
+			AND ($2::BOOLEAN IS NULL OR (resolved_at IS NULL) = $2)
+			AND ($3::UUID IS NULL OR order_id = $3)
+		ORDER BY last_seen_at DESC, check_name, subject
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(ctx, query, string(filter.Check), filter.Open, filter.OrderID, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query integrity findings: %w", err)
+	}
+	defer rows.Close()
+
+	var findings []domain.IntegrityFinding
+	for rows.Next() {
+		var f domain.IntegrityFinding
+		err := rows.Scan(
+			&f.ID,
+			&f.Check,
+			&f.Subject,
+			&f.OrderID,
+			&f.Details,
+			&f.FirstSeenAt,
+			&f.LastSeenAt,
+			&f.ResolvedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan integrity finding: %w", err)
+		}
+		findings = append(findings, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating integrity findings: %w", err)
+	}
+
+	return findings, nil
+}
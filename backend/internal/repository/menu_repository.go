@@ -18,6 +18,33 @@ type MenuRepository struct {
 	db *database.Pool
 }
 
+// menuRatingColumns selects the average rating (one decimal) and rating count
+// kept up to date by ReviewRepository
+const menuRatingColumns = `CASE WHEN rating_count > 0 THEN ROUND(rating_sum::numeric / rating_count, 1) ELSE 0 END::float8, rating_count`
+
+// menuOrderableSQL holds for a menu item with at least one variant that can
+// be ordered, or with no variants at all, and, for a bundle, with an option
+// that can be ordered in every slot
+const menuOrderableSQL = `(
+	NOT EXISTS (SELECT 1 FROM menu_item_variants v WHERE v.menu_item_id = menu_items.id)
+	OR EXISTS (SELECT 1 FROM menu_item_variants v WHERE v.menu_item_id = menu_items.id AND v.is_available)
+) AND NOT EXISTS (
+	SELECT 1 FROM bundle_slots s
+	WHERE s.bundle_id = menu_items.id AND NOT EXISTS (
+		SELECT 1 FROM bundle_slot_options o
+		JOIN menu_items c ON c.id = o.menu_item_id
+		LEFT JOIN menu_item_variants cv ON cv.id = o.variant_id
+		WHERE o.slot_id = s.id AND c.is_available AND COALESCE(cv.is_available, TRUE)
+	)
+)`
+
+// bundleOptionNameSQL is the display name of a bundle slot option for the
+// menu item c and variant cv, matching OrderItem.DisplayName
+const bundleOptionNameSQL = `(c.name || CASE WHEN cv.name IS NOT NULL THEN ' (' || cv.name || ')' ELSE '' END)`
+
+// ErrNestedBundle is returned when a bundle would contain itself or another bundle
+var ErrNestedBundle = errors.New("bundles cannot contain bundles")
+
 // NewMenuRepository creates a new menu repository
 func NewMenuRepository(db *database.Pool) *MenuRepository {
 	return &MenuRepository{db: db}
@@ -26,9 +53,10 @@ func NewMenuRepository(db *database.Pool) *MenuRepository {
 // GetAll retrieves all available menu items
 func (r *MenuRepository) GetAll(ctx context.Context) ([]domain.MenuItem, error) {
 	query := `
-		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at
+		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at,
+			` + menuRatingColumns + `
 		FROM menu_items
-		WHERE is_available = TRUE
+		WHERE is_available = TRUE AND ` + menuOrderableSQL + `
 		ORDER BY category, name
 	`
 
@@ -53,6 +81,8 @@ func (r *MenuRepository) GetAll(ctx context.Context) ([]domain.MenuItem, error)
 			&item.IsAvailable,
 			&item.CreatedAt,
 			&item.UpdatedAt,
+			&item.Rating,
+			&item.RatingCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan menu item: %w", err)
@@ -69,13 +99,18 @@ func (r *MenuRepository) GetAll(ctx context.Context) ([]domain.MenuItem, error)
 		return nil, fmt.Errorf("error iterating menu items: %w", err)
 	}
 
+	if err := r.loadChoices(ctx, items, true); err != nil {
+		return nil, err
+	}
+
 	return items, nil
 }
 
 // GetAllIncludingUnavailable retrieves all menu items (admin view)
 func (r *MenuRepository) GetAllIncludingUnavailable(ctx context.Context) ([]domain.MenuItem, error) {
 	query := `
-		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at
+		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at,
+			` + menuRatingColumns + `
 		FROM menu_items
 		ORDER BY category, name
 	`
@@ -101,6 +136,8 @@ func (r *MenuRepository) GetAllIncludingUnavailable(ctx context.Context) ([]doma
 			&item.IsAvailable,
 			&item.CreatedAt,
 			&item.UpdatedAt,
+			&item.Rating,
+			&item.RatingCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan menu item: %w", err)
@@ -113,13 +150,18 @@ func (r *MenuRepository) GetAllIncludingUnavailable(ctx context.Context) ([]doma
 		items = append(items, item)
 	}
 
+	if err := r.loadChoices(ctx, items, false); err != nil {
+		return nil, err
+	}
+
 	return items, nil
 }
 
 // GetByID retrieves a menu item by UUID
 func (r *MenuRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.MenuItem, error) {
 	query := `
-		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at
+		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at,
+			` + menuRatingColumns + `
 		FROM menu_items
 		WHERE id = $1
 	`
@@ -137,6 +179,8 @@ func (r *MenuRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Men
 		&item.IsAvailable,
 		&item.CreatedAt,
 		&item.UpdatedAt,
+		&item.Rating,
+		&item.RatingCount,
 	)
 
 	if err != nil {
@@ -150,7 +194,12 @@ func (r *MenuRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Men
 		item.ImageURL = *imageURL
 	}
 
-	return item, nil
+	items := []domain.MenuItem{*item}
+	if err := r.loadChoices(ctx, items, false); err != nil {
+		return nil, err
+	}
+
+	return &items[0], nil
 }
 
 // GetByIDs retrieves multiple menu items by their UUIDs
@@ -161,7 +210,8 @@ func (r *MenuRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domai
 	}
 
 	query := `
-		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at
+		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at,
+			` + menuRatingColumns + `
 		FROM menu_items
 		WHERE id = ANY($1) AND is_available = TRUE
 	`
@@ -187,6 +237,8 @@ func (r *MenuRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domai
 			&item.IsAvailable,
 			&item.CreatedAt,
 			&item.UpdatedAt,
+			&item.Rating,
+			&item.RatingCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan menu item: %w", err)
@@ -199,6 +251,10 @@ func (r *MenuRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domai
 		items = append(items, item)
 	}
 
+	if err := r.loadChoices(ctx, items, false); err != nil {
+		return nil, err
+	}
+
 	return items, nil
 }
 
@@ -282,9 +338,10 @@ func (r *MenuRepository) Delete(ctx context.Context, id uuid.UUID) error {
 // GetByCategory retrieves menu items by category
 func (r *MenuRepository) GetByCategory(ctx context.Context, category string) ([]domain.MenuItem, error) {
 	query := `
-		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at
+		SELECT id, name, description, price, category, image_url, is_available, created_at, updated_at,
+			` + menuRatingColumns + `
 		FROM menu_items
-		WHERE category = $1 AND is_available = TRUE
+		WHERE category = $1 AND is_available = TRUE AND ` + menuOrderableSQL + `
 		ORDER BY name
 	`
 
@@ -309,6 +366,8 @@ func (r *MenuRepository) GetByCategory(ctx context.Context, category string) ([]
 			&item.IsAvailable,
 			&item.CreatedAt,
 			&item.UpdatedAt,
+			&item.Rating,
+			&item.RatingCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan menu item: %w", err)
@@ -321,5 +380,603 @@ func (r *MenuRepository) GetByCategory(ctx context.Context, category string) ([]
 		items = append(items, item)
 	}
 
+	if err := r.loadChoices(ctx, items, true); err != nil {
+		return nil, err
+	}
+
 	return items, nil
 }
+
+// menuVariantColumns is the column list of every variant query, in scanMenuVariant order
+const menuVariantColumns = `id, menu_item_id, name, price, is_available, sort_order, created_at, updated_at`
+
+// scanMenuVariant scans a row selected with menuVariantColumns
+func scanMenuVariant(row pgx.Row) (*domain.MenuVariant, error) {
+	v := &domain.MenuVariant{}
+	err := row.Scan(
+		&v.ID,
+		&v.MenuItemID,
+		&v.Name,
+		&v.Price,
+		&v.IsAvailable,
+		&v.SortOrder,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan menu variant: %w", err)
+	}
+	return v, nil
+}
+
+// loadChoices fills in the variants, modifier groups and bundle slots of menu
+// items. With availableOnly, variants and options that cannot be ordered are
+// left out.
+func (r *MenuRepository) loadChoices(ctx context.Context, items []domain.MenuItem, availableOnly bool) error {
+	if err := r.loadVariants(ctx, items, availableOnly); err != nil {
+		return err
+	}
+	if err := r.loadModifierGroups(ctx, items, availableOnly); err != nil {
+		return err
+	}
+	return r.loadBundleSlots(ctx, items, availableOnly)
+}
+
+// loadVariants fills in the variants of menu items, in display order.
+// With availableOnly, variants that cannot be ordered are left out.
+func (r *MenuRepository) loadVariants(ctx context.Context, items []domain.MenuItem, availableOnly bool) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	index := make(map[uuid.UUID]int, len(items))
+	ids := make([]uuid.UUID, len(items))
+	for i := range items {
+		index[items[i].ID] = i
+		ids[i] = items[i].ID
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+menuVariantColumns+`
+		FROM menu_item_variants
+		WHERE menu_item_id = ANY($1) AND (is_available OR NOT $2)
+		ORDER BY menu_item_id, sort_order, price, name
+	`, ids, availableOnly)
+	if err != nil {
+		return fmt.Errorf("failed to query menu variants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanMenuVariant(rows)
+		if err != nil {
+			return err
+		}
+		i := index[v.MenuItemID]
+		items[i].Variants = append(items[i].Variants, *v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating menu variants: %w", err)
+	}
+
+	return nil
+}
+
+// CreateVariant adds a variant to a menu item. Returns ErrNotFound if the
+// item does not exist and ErrDuplicateKey if it already has a variant with
+// the same name.
+func (r *MenuRepository) CreateVariant(ctx context.Context, v *domain.MenuVariant) error {
+	v.ID = uuid.New()
+
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO menu_item_variants (id, menu_item_id, name, price, is_available, sort_order)
+		SELECT $1, id, $3, $4, $5, $6 FROM menu_items WHERE id = $2
+		RETURNING created_at, updated_at
+	`, v.ID, v.MenuItemID, v.Name, v.Price, v.IsAvailable, v.SortOrder).Scan(&v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if isDuplicateKeyError(err) {
+			return ErrDuplicateKey
+		}
+		return fmt.Errorf("failed to create menu variant: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateVariant modifies a variant of a menu item
+func (r *MenuRepository) UpdateVariant(ctx context.Context, v *domain.MenuVariant) error {
+	err := r.db.QueryRow(ctx, `
+		UPDATE menu_item_variants
+		SET name = $3, price = $4, is_available = $5, sort_order = $6
+		WHERE id = $1 AND menu_item_id = $2
+		RETURNING created_at, updated_at
+	`, v.ID, v.MenuItemID, v.Name, v.Price, v.IsAvailable, v.SortOrder).Scan(&v.CreatedAt, &v.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if isDuplicateKeyError(err) {
+			return ErrDuplicateKey
+		}
+		return fmt.Errorf("failed to update menu variant: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteVariant removes a variant of a menu item. Past orders keep the
+// variant name and price they were placed with.
+func (r *MenuRepository) DeleteVariant(ctx context.Context, menuItemID, variantID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM menu_item_variants WHERE id = $1 AND menu_item_id = $2
+	`, variantID, menuItemID)
+	if err != nil {
+		return fmt.Errorf("failed to delete menu variant: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// loadModifierGroups fills in the modifier groups of menu items with their
+// options, in display order
+func (r *MenuRepository) loadModifierGroups(ctx context.Context, items []domain.MenuItem, availableOnly bool) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	index := make(map[uuid.UUID]int, len(items))
+	ids := make([]uuid.UUID, len(items))
+	for i := range items {
+		index[items[i].ID] = i
+		ids[i] = items[i].ID
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT g.id, g.menu_item_id, g.name, g.min_select, g.max_select, g.sort_order, g.created_at, g.updated_at,
+			o.id, o.name, o.price, o.is_available, o.sort_order
+		FROM modifier_groups g
+		LEFT JOIN modifier_options o ON o.group_id = g.id AND (o.is_available OR NOT $2)
+		WHERE g.menu_item_id = ANY($1)
+		ORDER BY g.menu_item_id, g.sort_order, g.name, o.sort_order, o.name
+	`, ids, availableOnly)
+	if err != nil {
+		return fmt.Errorf("failed to query modifier groups: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g domain.ModifierGroup
+		var optionID *uuid.UUID
+		var option domain.ModifierOption
+		var optionName *string
+		var optionPrice *int64
+		var optionAvailable *bool
+		var optionSort *int
+
+		err := rows.Scan(
+			&g.ID,
+			&g.MenuItemID,
+			&g.Name,
+			&g.MinSelect,
+			&g.MaxSelect,
+			&g.SortOrder,
+			&g.CreatedAt,
+			&g.UpdatedAt,
+			&optionID,
+			&optionName,
+			&optionPrice,
+			&optionAvailable,
+			&optionSort,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan modifier group: %w", err)
+		}
+
+		item := &items[index[g.MenuItemID]]
+		if n := len(item.ModifierGroups); n == 0 || item.ModifierGroups[n-1].ID != g.ID {
+			g.Required = g.MinSelect > 0
+			g.Options = []domain.ModifierOption{}
+			item.ModifierGroups = append(item.ModifierGroups, g)
+		}
+
+		if optionID != nil {
+			option = domain.ModifierOption{
+				ID:          *optionID,
+				GroupID:     g.ID,
+				Name:        *optionName,
+				Price:       *optionPrice,
+				IsAvailable: *optionAvailable,
+				SortOrder:   *optionSort,
+			}
+			group := &item.ModifierGroups[len(item.ModifierGroups)-1]
+			group.Options = append(group.Options, option)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating modifier groups: %w", err)
+	}
+
+	return nil
+}
+
+// CreateModifierGroup adds a modifier group with its options to a menu item.
+// Returns ErrNotFound if the item does not exist and ErrDuplicateKey if a
+// group or option name is taken.
+func (r *MenuRepository) CreateModifierGroup(ctx context.Context, g *domain.ModifierGroup) error {
+	g.ID = uuid.New()
+
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO modifier_groups (id, menu_item_id, name, min_select, max_select, sort_order)
+			SELECT $1, id, $3, $4, $5, $6 FROM menu_items WHERE id = $2
+			RETURNING created_at, updated_at
+		`, g.ID, g.MenuItemID, g.Name, g.MinSelect, g.MaxSelect, g.SortOrder).Scan(&g.CreatedAt, &g.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		return saveModifierOptions(ctx, tx, g)
+	})
+
+	return modifierGroupError(err, "create")
+}
+
+// UpdateModifierGroup changes a modifier group and replaces its options.
+// Options with an ID are updated, those without are added, and the group's
+// other options are removed, so option IDs in carts stay valid while kept.
+func (r *MenuRepository) UpdateModifierGroup(ctx context.Context, g *domain.ModifierGroup) error {
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE modifier_groups
+			SET name = $3, min_select = $4, max_select = $5, sort_order = $6
+			WHERE id = $1 AND menu_item_id = $2
+			RETURNING created_at, updated_at
+		`, g.ID, g.MenuItemID, g.Name, g.MinSelect, g.MaxSelect, g.SortOrder).Scan(&g.CreatedAt, &g.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		kept := make([]uuid.UUID, 0, len(g.Options))
+		for _, o := range g.Options {
+			if o.ID != uuid.Nil {
+				kept = append(kept, o.ID)
+			}
+		}
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM modifier_options WHERE group_id = $1 AND NOT (id = ANY($2))
+		`, g.ID, kept); err != nil {
+			return err
+		}
+
+		return saveModifierOptions(ctx, tx, g)
+	})
+
+	return modifierGroupError(err, "update")
+}
+
+// saveModifierOptions inserts the new options of a group and updates the
+// others, filling in IDs
+func saveModifierOptions(ctx context.Context, tx pgx.Tx, g *domain.ModifierGroup) error {
+	for i := range g.Options {
+		o := &g.Options[i]
+		o.GroupID = g.ID
+
+		if o.ID == uuid.Nil {
+			o.ID = uuid.New()
+			_, err := tx.Exec(ctx, `
+				INSERT INTO modifier_options (id, group_id, name, price, is_available, sort_order)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, o.ID, o.GroupID, o.Name, o.Price, o.IsAvailable, o.SortOrder)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, err := tx.Exec(ctx, `
+			UPDATE modifier_options
+			SET name = $3, price = $4, is_available = $5, sort_order = $6
+			WHERE id = $1 AND group_id = $2
+		`, o.ID, o.GroupID, o.Name, o.Price, o.IsAvailable, o.SortOrder)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+// modifierGroupError maps errors from saving a modifier group
+func modifierGroupError(err error, action string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound):
+		return ErrNotFound
+	case isDuplicateKeyError(err):
+		return ErrDuplicateKey
+	}
+	return fmt.Errorf("failed to %s modifier group: %w", action, err)
+}
+
+// DeleteModifierGroup removes a modifier group and its options from a menu
+// item. Past orders keep the modifiers they were placed with.
+func (r *MenuRepository) DeleteModifierGroup(ctx context.Context, menuItemID, groupID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM modifier_groups WHERE id = $1 AND menu_item_id = $2
+	`, groupID, menuItemID)
+	if err != nil {
+		return fmt.Errorf("failed to delete modifier group: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// loadBundleSlots fills in the slots of bundle menu items with their
+// options, in display order
+func (r *MenuRepository) loadBundleSlots(ctx context.Context, items []domain.MenuItem, availableOnly bool) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	index := make(map[uuid.UUID]int, len(items))
+	ids := make([]uuid.UUID, len(items))
+	for i := range items {
+		index[items[i].ID] = i
+		ids[i] = items[i].ID
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT s.id, s.bundle_id, s.name, s.quantity, s.sort_order, s.created_at, s.updated_at,
+			o.id, o.menu_item_id, o.variant_id, `+bundleOptionNameSQL+`,
+			c.is_available AND COALESCE(cv.is_available, TRUE), o.sort_order
+		FROM bundle_slots s
+		LEFT JOIN (
+			bundle_slot_options o
+			JOIN menu_items c ON c.id = o.menu_item_id
+			LEFT JOIN menu_item_variants cv ON cv.id = o.variant_id
+		) ON o.slot_id = s.id AND (NOT $2 OR (c.is_available AND COALESCE(cv.is_available, TRUE)))
+		WHERE s.bundle_id = ANY($1)
+		ORDER BY s.bundle_id, s.sort_order, s.name, o.sort_order, c.name, cv.name
+	`, ids, availableOnly)
+	if err != nil {
+		return fmt.Errorf("failed to query bundle slots: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slot domain.BundleSlot
+		var optionID, optionItemID *uuid.UUID
+		var optionVariantID *uuid.UUID
+		var optionName *string
+		var optionAvailable *bool
+		var optionSort *int
+
+		err := rows.Scan(
+			&slot.ID,
+			&slot.BundleID,
+			&slot.Name,
+			&slot.Quantity,
+			&slot.SortOrder,
+			&slot.CreatedAt,
+			&slot.UpdatedAt,
+			&optionID,
+			&optionItemID,
+			&optionVariantID,
+			&optionName,
+			&optionAvailable,
+			&optionSort,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan bundle slot: %w", err)
+		}
+
+		item := &items[index[slot.BundleID]]
+		if n := len(item.BundleSlots); n == 0 || item.BundleSlots[n-1].ID != slot.ID {
+			slot.Options = []domain.BundleSlotOption{}
+			item.BundleSlots = append(item.BundleSlots, slot)
+		}
+
+		if optionID != nil {
+			current := &item.BundleSlots[len(item.BundleSlots)-1]
+			current.Options = append(current.Options, domain.BundleSlotOption{
+				ID:          *optionID,
+				SlotID:      slot.ID,
+				MenuItemID:  *optionItemID,
+				VariantID:   optionVariantID,
+				Name:        *optionName,
+				IsAvailable: *optionAvailable,
+				SortOrder:   *optionSort,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating bundle slots: %w", err)
+	}
+
+	return nil
+}
+
+// CreateBundleSlot adds a slot with its options to a menu item, making it a
+// bundle. Returns ErrNotFound if the item or an option's item or variant does
+// not exist, ErrNestedBundle if the item is part of a bundle or an option is
+// a bundle, and ErrDuplicateKey if the slot name is taken.
+func (r *MenuRepository) CreateBundleSlot(ctx context.Context, slot *domain.BundleSlot) error {
+	slot.ID = uuid.New()
+
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		var isComponent bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM bundle_slot_options WHERE menu_item_id = $1)
+		`, slot.BundleID).Scan(&isComponent)
+		if err != nil {
+			return err
+		}
+		if isComponent {
+			return ErrNestedBundle
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO bundle_slots (id, bundle_id, name, quantity, sort_order)
+			SELECT $1, id, $3, $4, $5 FROM menu_items WHERE id = $2
+			RETURNING created_at, updated_at
+		`, slot.ID, slot.BundleID, slot.Name, slot.Quantity, slot.SortOrder).Scan(&slot.CreatedAt, &slot.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		return saveBundleSlotOptions(ctx, tx, slot)
+	})
+
+	return bundleSlotError(err, "create")
+}
+
+// UpdateBundleSlot changes a bundle slot and replaces its options. Options
+// with an ID are updated, those without are added, and the slot's other
+// options are removed.
+func (r *MenuRepository) UpdateBundleSlot(ctx context.Context, slot *domain.BundleSlot) error {
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE bundle_slots
+			SET name = $3, quantity = $4, sort_order = $5
+			WHERE id = $1 AND bundle_id = $2
+			RETURNING created_at, updated_at
+		`, slot.ID, slot.BundleID, slot.Name, slot.Quantity, slot.SortOrder).Scan(&slot.CreatedAt, &slot.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		kept := make([]uuid.UUID, 0, len(slot.Options))
+		for _, o := range slot.Options {
+			if o.ID != uuid.Nil {
+				kept = append(kept, o.ID)
+			}
+		}
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM bundle_slot_options WHERE slot_id = $1 AND NOT (id = ANY($2))
+		`, slot.ID, kept); err != nil {
+			return err
+		}
+
+		return saveBundleSlotOptions(ctx, tx, slot)
+	})
+
+	return bundleSlotError(err, "update")
+}
+
+// saveBundleSlotOptions inserts the new options of a slot and updates the
+// others, filling in IDs and the current names and availability of their items
+func saveBundleSlotOptions(ctx context.Context, tx pgx.Tx, slot *domain.BundleSlot) error {
+	for i := range slot.Options {
+		o := &slot.Options[i]
+		o.SlotID = slot.ID
+
+		if o.MenuItemID == slot.BundleID {
+			return ErrNestedBundle
+		}
+
+		var isBundle bool
+		err := tx.QueryRow(ctx, `
+			SELECT `+bundleOptionNameSQL+`, c.is_available AND COALESCE(cv.is_available, TRUE),
+				EXISTS (SELECT 1 FROM bundle_slots s WHERE s.bundle_id = c.id)
+			FROM menu_items c
+			LEFT JOIN menu_item_variants cv ON cv.id = $2 AND cv.menu_item_id = c.id
+			WHERE c.id = $1 AND ($2::uuid IS NULL OR cv.id IS NOT NULL)
+		`, o.MenuItemID, o.VariantID).Scan(&o.Name, &o.IsAvailable, &isBundle)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if isBundle {
+			return ErrNestedBundle
+		}
+
+		if o.ID == uuid.Nil {
+			o.ID = uuid.New()
+			_, err := tx.Exec(ctx, `
+				INSERT INTO bundle_slot_options (id, slot_id, menu_item_id, variant_id, sort_order)
+				VALUES ($1, $2, $3, $4, $5)
+			`, o.ID, o.SlotID, o.MenuItemID, o.VariantID, o.SortOrder)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, err := tx.Exec(ctx, `
+			UPDATE bundle_slot_options
+			SET menu_item_id = $3, variant_id = $4, sort_order = $5
+			WHERE id = $1 AND slot_id = $2
+		`, o.ID, o.SlotID, o.MenuItemID, o.VariantID, o.SortOrder)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+// bundleSlotError maps errors from saving a bundle slot
+func bundleSlotError(err error, action string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNestedBundle):
+		return err
+	case isDuplicateKeyError(err):
+		return ErrDuplicateKey
+	}
+	return fmt.Errorf("failed to %s bundle slot: %w", action, err)
+}
+
+// DeleteBundleSlot removes a slot from a bundle. A bundle without slots is
+// sold as a plain item again. Past orders keep the components they were
+// placed with.
+func (r *MenuRepository) DeleteBundleSlot(ctx context.Context, bundleID, slotID uuid.UUID) error {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM bundle_slots WHERE id = $1 AND bundle_id = $2
+	`, slotID, bundleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete bundle slot: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
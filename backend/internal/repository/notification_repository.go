@@ -0,0 +1,505 @@
+// Package repository implements the notification queue and push devices
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// NotificationRepository handles queued notifications and push devices
+type NotificationRepository struct {
+	db *database.Pool
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *database.Pool) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// notificationColumns is the column list scanned by collectNotifications
+const notificationColumns = `id, user_id, event, channel, recipient, subject, body, data, status, attempts,
+	last_error, next_attempt_at, expires_at, sent_at, created_at`
+
+// Enqueue queues notifications for sending. Notifications whose dedup key is
+// already queued are skipped; returns the ones actually queued.
+func (r *NotificationRepository) Enqueue(ctx context.Context, notifications []domain.Notification) ([]domain.Notification, error) {
+	query := `
+		INSERT INTO notifications (id, user_id, event, channel, recipient, subject, body, data, next_attempt_at, expires_at, dedup_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (dedup_key) DO NOTHING
+	`
+
+	var queued []domain.Notification
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now()
+		for _, n := range notifications {
+			n.ID = uuid.New()
+			n.Status = domain.NotificationPending
+			n.NextAttemptAt = now
+			n.CreatedAt = now
+
+			data, err := json.Marshal(n.Data)
+			if err != nil {
+				return fmt.Errorf("failed to encode notification data: %w", err)
+			}
+			if n.Data == nil {
+				data = []byte("{}")
+			}
+
+			result, err := tx.Exec(ctx, query,
+				n.ID,
+				n.UserID,
+				n.Event,
+				n.Channel,
+				n.Recipient,
+				n.Subject,
+				n.Body,
+				data,
+				n.NextAttemptAt,
+				n.ExpiresAt,
+				n.DedupKey,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to queue notification: %w", err)
+			}
+			if result.RowsAffected() > 0 {
+				queued = append(queued, n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return queued, nil
+}
+
+// ClaimDue takes up to limit pending notifications whose next attempt is due
+// and counts the attempt. Claimed notifications are not due again until the
+// lease has passed, so instances never send the same message concurrently and
+// a crash mid-send is retried.
+func (r *NotificationRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.Notification, error) {
+	query := `
+		UPDATE notifications
+		SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = 'PENDING' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + notificationColumns
+
+	rows, err := r.db.Query(ctx, query, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim notifications: %w", err)
+	}
+
+	return collectNotifications(rows)
+}
+
+// Hold postpones a claimed notification without using up an attempt, e.g.
+// until the user's quiet hours end
+func (r *NotificationRepository) Hold(ctx context.Context, id uuid.UUID, until time.Time) error {
+	query := `
+		UPDATE notifications
+		SET attempts = attempts - 1, next_attempt_at = $2
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, until); err != nil {
+		return fmt.Errorf("failed to hold notification: %w", err)
+	}
+
+	return nil
+}
+
+// MarkSent records a successful delivery
+func (r *NotificationRepository) MarkSent(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE notifications
+		SET status = 'SENT', sent_at = NOW(), last_error = ''
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark notification sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkRetry records a failed attempt and when to try again
+func (r *NotificationRepository) MarkRetry(ctx context.Context, id uuid.UUID, lastError string, next time.Time) error {
+	query := `
+		UPDATE notifications
+		SET last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, lastError, next); err != nil {
+		return fmt.Errorf("failed to reschedule notification: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed gives up on a notification
+func (r *NotificationRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	query := `
+		UPDATE notifications
+		SET status = 'FAILED', last_error = $2
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, id, lastError); err != nil {
+		return fmt.Errorf("failed to mark notification failed: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecent retrieves the newest notifications, optionally of some statuses
+// only, for support and debugging
+func (r *NotificationRepository) GetRecent(ctx context.Context, statuses []domain.NotificationStatus, userID *uuid.UUID, limit int) ([]domain.Notification, error) {
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE (cardinality($1::text[]) = 0 OR status = ANY($1::text[]::notification_status[]))
+			AND ($2::uuid IS NULL OR user_id = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	names := make([]string, len(statuses))
+	for i, s := range statuses {
+		names[i] = string(s)
+	}
+
+	rows, err := r.db.Query(ctx, query, names, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+
+	return collectNotifications(rows)
+}
+
+func collectNotifications(rows pgx.Rows) ([]domain.Notification, error) {
+	defer rows.Close()
+
+	var notifications []domain.Notification
+	for rows.Next() {
+		var n domain.Notification
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Event,
+			&n.Channel,
+			&n.Recipient,
+			&n.Subject,
+			&n.Body,
+			&n.Data,
+			&n.Status,
+			&n.Attempts,
+			&n.LastError,
+			&n.NextAttemptAt,
+			&n.ExpiresAt,
+			&n.SentAt,
+			&n.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// ============================================================================
+// PUSH DEVICES
+// ============================================================================
+
+// SaveDevice registers a push token for a user. A token already registered
+// moves to this user, since it identifies the app install, not the person.
+func (r *NotificationRepository) SaveDevice(ctx context.Context, device *domain.Device) error {
+	query := `
+		INSERT INTO devices (token, user_id, platform)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query, device.Token, device.UserID, device.Platform).Scan(&device.CreatedAt, &device.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDevice unregisters a user's push token, e.g. on sign-out
+func (r *NotificationRepository) DeleteDevice(ctx context.Context, userID uuid.UUID, token string) error {
+	result, err := r.db.Exec(ctx, `DELETE FROM devices WHERE token = $1 AND user_id = $2`, token, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteDeviceToken forgets a token the push provider no longer accepts
+func (r *NotificationRepository) DeleteDeviceToken(ctx context.Context, token string) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM devices WHERE token = $1`, token); err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+
+	return nil
+}
+
+// GetDevices retrieves a user's push devices, most recently registered first
+func (r *NotificationRepository) GetDevices(ctx context.Context, userID uuid.UUID) ([]domain.Device, error) {
+	query := `
+		SELECT token, user_id, platform, created_at, updated_at
+		FROM devices
+		WHERE user_id = $1
+		ORDER BY updated_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []domain.Device
+	for rows.Next() {
+		var d domain.Device
+		if err := rows.Scan(&d.Token, &d.UserID, &d.Platform, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// ============================================================================
+// PREFERENCES AND CONSENT
+// ============================================================================
+
+// preferencesQuery reads a user's notification preferences; quiet hours are
+// empty strings when off
+const preferencesQuery = `
+	SELECT language, marketing_opt_in, notification_channels,
+		COALESCE(to_char(quiet_hours_start, 'HH24:MI'), ''), COALESCE(to_char(quiet_hours_end, 'HH24:MI'), '')
+	FROM users
+	WHERE id = $1
+`
+
+// GetPreferences retrieves a user's notification preferences as stored;
+// categories without a choice are missing from Channels
+func (r *NotificationRepository) GetPreferences(ctx context.Context, userID uuid.UUID) (*domain.NotificationPreferences, error) {
+	return getPreferences(ctx, r.db, preferencesQuery, userID)
+}
+
+func getPreferences(ctx context.Context, q database.Querier, query string, userID uuid.UUID) (*domain.NotificationPreferences, error) {
+	var prefs domain.NotificationPreferences
+	var start, end string
+	err := q.QueryRow(ctx, query, userID).Scan(
+		&prefs.Language,
+		&prefs.MarketingOptIn,
+		&prefs.Channels,
+		&start,
+		&end,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	if start != "" {
+		prefs.QuietHours = domain.QuietHours{Enabled: true, Start: start, End: end}
+	}
+
+	return &prefs, nil
+}
+
+// UpdatePreferences changes a user's notification preferences. apply edits
+// the current preferences and returns the changes it made, which are logged
+// in the same transaction; concurrent updates of one user are serialized.
+func (r *NotificationRepository) UpdatePreferences(
+	ctx context.Context,
+	userID uuid.UUID,
+	apply func(prefs *domain.NotificationPreferences) ([]domain.ConsentChange, error),
+) (*domain.NotificationPreferences, error) {
+	update := `
+		UPDATE users
+		SET language = $2, marketing_opt_in = $3, notification_channels = $4,
+			quiet_hours_start = NULLIF($5, '')::time, quiet_hours_end = NULLIF($6, '')::time, updated_at = NOW()
+		WHERE id = $1
+	`
+	insert := `
+		INSERT INTO consent_changes (id, user_id, setting, old_value, new_value, source, changed_by, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	var prefs *domain.NotificationPreferences
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		prefs, err = getPreferences(ctx, tx, preferencesQuery+" FOR UPDATE", userID)
+		if err != nil {
+			return err
+		}
+
+		changes, err := apply(prefs)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		channels, err := json.Marshal(prefs.Channels)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification channels: %w", err)
+		}
+		if prefs.Channels == nil {
+			channels = []byte("{}")
+		}
+
+		var start, end string
+		if prefs.QuietHours.Enabled {
+			start, end = prefs.QuietHours.Start, prefs.QuietHours.End
+		}
+
+		if _, err := tx.Exec(ctx, update, userID, prefs.Language, prefs.MarketingOptIn, channels, start, end); err != nil {
+			return fmt.Errorf("failed to update notification preferences: %w", err)
+		}
+
+		now := time.Now()
+		for i := range changes {
+			change := &changes[i]
+			change.ID = uuid.New()
+			change.UserID = userID
+			change.CreatedAt = now
+
+			_, err := tx.Exec(ctx, insert,
+				change.ID,
+				change.UserID,
+				change.Setting,
+				change.OldValue,
+				change.NewValue,
+				change.Source,
+				change.ChangedBy,
+				change.IPAddress,
+				change.UserAgent,
+				change.CreatedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to record consent change: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// GetConsentChanges retrieves a user's consent log, newest first
+func (r *NotificationRepository) GetConsentChanges(ctx context.Context, userID uuid.UUID, limit int) ([]domain.ConsentChange, error) {
+	query := `
+		SELECT id, user_id, setting, old_value, new_value, source, changed_by, ip_address, user_agent, created_at
+		FROM consent_changes
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query consent changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []domain.ConsentChange
+	for rows.Next() {
+		var c domain.ConsentChange
+		err := rows.Scan(
+			&c.ID,
+			&c.UserID,
+			&c.Setting,
+			&c.OldValue,
+			&c.NewValue,
+			&c.Source,
+			&c.ChangedBy,
+			&c.IPAddress,
+			&c.UserAgent,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan consent change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating consent changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// GetMarketingAudience pages through the users who opted in to promotions,
+// in ID order after the given ID
+func (r *NotificationRepository) GetMarketingAudience(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(ctx, `SELECT id FROM users WHERE marketing_opt_in AND id > $1 ORDER BY id LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query marketing audience: %w", err)
+	}
+
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan marketing audience: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating marketing audience: %w", err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,581 @@
+// Package repository implements order modification data access
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// ErrOrderNotEditable is returned when an order's contents can no longer change
+var ErrOrderNotEditable = errors.New("order can no longer be changed")
+
+// OrderModificationRepository handles edits of paid orders and their content history
+type OrderModificationRepository struct {
+	db *database.Pool
+}
+
+// NewOrderModificationRepository creates a new order modification repository
+func NewOrderModificationRepository(db *database.Pool) *OrderModificationRepository {
+	return &OrderModificationRepository{db: db}
+}
+
+// modificationColumns is the column list scanned by scanModification
+const modificationColumns = `id, order_id, base_version, status, items, old_total, new_total,
+	razorpay_order_id, razorpay_payment_id, created_by, created_at, updated_at, applied_at`
+
+// ModificationCaptureResult describes what a captured difference payment did
+type ModificationCaptureResult struct {
+	AlreadyProcessed bool           // Payment was recorded before (webhook and client both reported it)
+	Applied          bool           // The edit is now the order's contents
+	Refund           *domain.Refund // Set when the edit could not be applied and the payment is returned
+}
+
+// CreatePending records an edit that waits for the difference to be paid.
+// Any earlier edit of the same order still waiting for payment is cancelled.
+func (r *OrderModificationRepository) CreatePending(ctx context.Context, mod *domain.OrderModification) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		cancelQuery := `
+			UPDATE order_modifications
+			SET status = 'CANCELLED'
+			WHERE order_id = $1 AND status = 'PENDING_PAYMENT'
+		`
+		if _, err := tx.Exec(ctx, cancelQuery, mod.OrderID); err != nil {
+			return fmt.Errorf("failed to cancel pending modification: %w", err)
+		}
+
+		mod.Status = domain.ModificationPendingPayment
+		return insertModification(ctx, tx, mod)
+	})
+}
+
+// Apply records an edit that costs the same or less and makes it the order's
+// contents in one transaction. The surplus of a cheaper edit is queued for
+// refund across the order's payments; the queued refunds are returned.
+func (r *OrderModificationRepository) Apply(ctx context.Context, mod *domain.OrderModification) ([]domain.Refund, error) {
+	var refunds []domain.Refund
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		cancelQuery := `
+			UPDATE order_modifications
+			SET status = 'CANCELLED'
+			WHERE order_id = $1 AND status = 'PENDING_PAYMENT'
+		`
+		if _, err := tx.Exec(ctx, cancelQuery, mod.OrderID); err != nil {
+			return fmt.Errorf("failed to cancel pending modification: %w", err)
+		}
+
+		mod.Status = domain.ModificationApplied
+		if err := insertModification(ctx, tx, mod); err != nil {
+			return err
+		}
+
+		if err := applyOrderContents(ctx, tx, mod); err != nil {
+			return err
+		}
+
+		if mod.Delta() == 0 {
+			return nil
+		}
+		var err error
+		refunds, err = queueSurplusRefunds(ctx, tx, mod)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// queueSurplusRefunds queues the refund of a cheaper edit's surplus, taken
+// from the order's payments newest first: the differences paid for earlier
+// edits, then the checkout payment, each only up to what earlier refunds
+// left of it
+func queueSurplusRefunds(ctx context.Context, tx pgx.Tx, mod *domain.OrderModification) ([]domain.Refund, error) {
+	type payment struct {
+		id     string
+		amount int64
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT razorpay_payment_id, new_total - old_total
+		FROM order_modifications
+		WHERE order_id = $1 AND status = 'APPLIED' AND razorpay_payment_id IS NOT NULL
+		ORDER BY applied_at DESC
+	`, mod.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query modification payments: %w", err)
+	}
+	var payments []payment
+	for rows.Next() {
+		var p payment
+		if err := rows.Scan(&p.id, &p.amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan modification payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating modification payments: %w", err)
+	}
+
+	// The checkout payment captured the contents before the first edit
+	var checkout payment
+	err = tx.QueryRow(ctx, `
+		SELECT o.razorpay_payment_id, r.total_amount
+		FROM orders o
+		JOIN order_revisions r ON r.order_id = o.id AND r.revision = 1
+		WHERE o.id = $1
+	`, mod.OrderID).Scan(&checkout.id, &checkout.amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order payment: %w", err)
+	}
+	payments = append(payments, checkout)
+
+	ids := make([]string, len(payments))
+	for i, p := range payments {
+		ids[i] = p.id
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT razorpay_payment_id, SUM(amount) FROM refunds
+		WHERE razorpay_payment_id = ANY($1)
+		GROUP BY razorpay_payment_id
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payment refunds: %w", err)
+	}
+	refunded := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var amount int64
+		if err := rows.Scan(&id, &amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan payment refunds: %w", err)
+		}
+		refunded[id] = amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating payment refunds: %w", err)
+	}
+
+	surplus := -mod.Delta()
+	var refunds []domain.Refund
+	for _, p := range payments {
+		left := p.amount - refunded[p.id]
+		if surplus == 0 {
+			break
+		}
+		if left <= 0 {
+			continue
+		}
+
+		refund := domain.Refund{
+			OrderID:           &mod.OrderID,
+			Source:            domain.RefundSourceOrderModification,
+			SourceID:          mod.ID,
+			RazorpayPaymentID: p.id,
+			Amount:            min(left, surplus),
+			Reason:            "items removed from order",
+		}
+		if err := insertRefund(ctx, tx, &refund); err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+		surplus -= refund.Amount
+	}
+	if surplus > 0 {
+		return nil, fmt.Errorf("edit surplus exceeds what is left of the order's payments by %d", surplus)
+	}
+
+	return refunds, nil
+}
+
+func insertModification(ctx context.Context, tx pgx.Tx, mod *domain.OrderModification) error {
+	items, err := json.Marshal(mod.Items)
+	if err != nil {
+		return fmt.Errorf("failed to encode modification items: %w", err)
+	}
+
+	now := time.Now()
+	mod.ID = uuid.New()
+	mod.CreatedAt = now
+	mod.UpdatedAt = now
+
+	query := `
+		INSERT INTO order_modifications (id, order_id, base_version, status, items, old_total, new_total,
+			created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.Exec(ctx, query,
+		mod.ID,
+		mod.OrderID,
+		mod.BaseVersion,
+		mod.Status,
+		items,
+		mod.OldTotal,
+		mod.NewTotal,
+		mod.CreatedBy,
+		mod.CreatedAt,
+		mod.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert order modification: %w", err)
+	}
+
+	return nil
+}
+
+// applyOrderContents replaces the lines and total of an order with an edit.
+// The order must still be PAID at the version the edit was made against, so
+// an order the kitchen accepted meanwhile is never changed. The stock sold to
+// the order follows its new lines; ErrOutOfStock is returned if an added item
+// does not have enough left. The first edit also records the original
+// contents as revision 1.
+func applyOrderContents(ctx context.Context, tx pgx.Tx, mod *domain.OrderModification) error {
+	var status domain.OrderStatus
+	var version int
+	var userID uuid.UUID
+	var total int64
+	var createdAt time.Time
+	var paymentID *string
+	var tableSessionID, cateringRequestID *uuid.UUID
+
+	lockQuery := `
+		SELECT status, version, user_id, total_amount, created_at, razorpay_payment_id, table_session_id, catering_request_id
+		FROM orders
+		WHERE id = $1
+		FOR UPDATE
+	`
+	err := tx.QueryRow(ctx, lockQuery, mod.OrderID).Scan(&status, &version, &userID, &total, &createdAt, &paymentID, &tableSessionID, &cateringRequestID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	// Only regular orders paid in one go through the gateway: the surplus of
+	// an edit is refunded against that payment
+	if status != domain.OrderStatusPaid || paymentID == nil || tableSessionID != nil || cateringRequestID != nil {
+		return ErrOrderNotEditable
+	}
+	if version != mod.BaseVersion {
+		return ErrVersionConflict
+	}
+
+	// Split bills refer to the order's lines
+	var billed bool
+	billQuery := `SELECT EXISTS (SELECT 1 FROM bills WHERE source_type = 'order' AND source_id = $1)`
+	if err := tx.QueryRow(ctx, billQuery, mod.OrderID).Scan(&billed); err != nil {
+		return fmt.Errorf("failed to check order bills: %w", err)
+	}
+	if billed {
+		return ErrOrderNotEditable
+	}
+
+	// Before any change, so an edit refused for stock leaves the order as it was
+	if err := adjustStock(ctx, tx, mod.OrderID, mod.Items); err != nil {
+		return err
+	}
+
+	var revision int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(revision), 0) FROM order_revisions WHERE order_id = $1`, mod.OrderID).Scan(&revision); err != nil {
+		return fmt.Errorf("failed to get order revision: %w", err)
+	}
+
+	if revision == 0 {
+		// First edit: keep what was originally ordered
+		rows, err := tx.Query(ctx, `SELECT `+orderItemColumns+` FROM order_items WHERE order_id = $1 ORDER BY created_at, id`, mod.OrderID)
+		if err != nil {
+			return fmt.Errorf("failed to query order items: %w", err)
+		}
+		var original []domain.OrderItem
+		for rows.Next() {
+			item, err := scanOrderItem(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			original = append(original, *item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating order items: %w", err)
+		}
+
+		revision = 1
+		if err := insertRevision(ctx, tx, mod.OrderID, revision, original, total, nil, userID, createdAt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM order_items WHERE order_id = $1`, mod.OrderID); err != nil {
+		return fmt.Errorf("failed to remove order items: %w", err)
+	}
+
+	now := time.Now()
+	if err := insertOrderItems(ctx, tx, mod.OrderID, mod.Items, now); err != nil {
+		return err
+	}
+
+	updateQuery := `
+		UPDATE orders
+		SET total_amount = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, updateQuery, mod.OrderID, mod.NewTotal); err != nil {
+		return fmt.Errorf("failed to update order total: %w", err)
+	}
+
+	appliedQuery := `
+		UPDATE order_modifications
+		SET status = 'APPLIED', applied_at = $2
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, appliedQuery, mod.ID, now); err != nil {
+		return fmt.Errorf("failed to mark modification applied: %w", err)
+	}
+	mod.Status = domain.ModificationApplied
+	mod.AppliedAt = &now
+
+	return insertRevision(ctx, tx, mod.OrderID, revision+1, mod.Items, mod.NewTotal, &mod.ID, mod.CreatedBy, now)
+}
+
+func insertRevision(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, revision int, items []domain.OrderItem, total int64, modificationID *uuid.UUID, createdBy uuid.UUID, createdAt time.Time) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("failed to encode revision items: %w", err)
+	}
+
+	query := `
+		INSERT INTO order_revisions (order_id, revision, items, total_amount, modification_id, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	if _, err := tx.Exec(ctx, query, orderID, revision, data, total, modificationID, createdBy, createdAt); err != nil {
+		return fmt.Errorf("failed to insert order revision: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an order modification
+func (r *OrderModificationRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.OrderModification, error) {
+	query := `
+		SELECT ` + modificationColumns + `
+		FROM order_modifications
+		WHERE id = $1
+	`
+
+	mod, err := scanModification(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get order modification: %w", err)
+	}
+
+	return mod, nil
+}
+
+// GetByRazorpayOrderID retrieves the modification paid with the given gateway order
+func (r *OrderModificationRepository) GetByRazorpayOrderID(ctx context.Context, razorpayOrderID string) (*domain.OrderModification, error) {
+	query := `
+		SELECT ` + modificationColumns + `
+		FROM order_modifications
+		WHERE razorpay_order_id = $1
+	`
+
+	mod, err := scanModification(r.db.QueryRow(ctx, query, razorpayOrderID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get order modification: %w", err)
+	}
+
+	return mod, nil
+}
+
+// SetGatewayOrder records the gateway order collecting the difference
+func (r *OrderModificationRepository) SetGatewayOrder(ctx context.Context, id uuid.UUID, razorpayOrderID string) error {
+	query := `
+		UPDATE order_modifications
+		SET razorpay_order_id = $2
+		WHERE id = $1 AND status = 'PENDING_PAYMENT'
+	`
+
+	result, err := r.db.Exec(ctx, query, id, razorpayOrderID)
+	if err != nil {
+		return fmt.Errorf("failed to set modification gateway order: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrOrderNotEditable
+	}
+
+	return nil
+}
+
+// CapturePayment records the paid difference and applies the edit. If the
+// edit was superseded, the order changed in the meantime (e.g. the kitchen
+// accepted it) or an added item sold out, the edit is rejected and the
+// payment queued for refund.
+func (r *OrderModificationRepository) CapturePayment(ctx context.Context, id uuid.UUID, paymentID string) (*ModificationCaptureResult, error) {
+	result := &ModificationCaptureResult{}
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		query := `
+			SELECT ` + modificationColumns + `
+			FROM order_modifications
+			WHERE id = $1
+			FOR UPDATE
+		`
+		mod, err := scanModification(tx.QueryRow(ctx, query, id))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock order modification: %w", err)
+		}
+
+		if mod.RazorpayPaymentID != "" {
+			result.AlreadyProcessed = true
+			return nil
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE order_modifications SET razorpay_payment_id = $2 WHERE id = $1`, id, paymentID); err != nil {
+			return fmt.Errorf("failed to record modification payment: %w", err)
+		}
+
+		applyErr := ErrOrderNotEditable
+		if mod.Status == domain.ModificationPendingPayment {
+			applyErr = applyOrderContents(ctx, tx, mod)
+		}
+		if applyErr == nil {
+			result.Applied = true
+			return nil
+		}
+		if !errors.Is(applyErr, ErrOrderNotEditable) && !errors.Is(applyErr, ErrVersionConflict) && !errors.Is(applyErr, ErrOutOfStock) {
+			return applyErr
+		}
+
+		// Too late: return what was paid for the edit
+		reason := "order changed before the edit was paid"
+		if errors.Is(applyErr, ErrOutOfStock) {
+			reason = "added item sold out before the edit was paid"
+		}
+		if mod.Status == domain.ModificationPendingPayment {
+			if _, err := tx.Exec(ctx, `UPDATE order_modifications SET status = 'REJECTED' WHERE id = $1`, id); err != nil {
+				return fmt.Errorf("failed to reject modification: %w", err)
+			}
+		}
+
+		result.Refund = &domain.Refund{
+			OrderID:           &mod.OrderID,
+			Source:            domain.RefundSourceOrderModification,
+			SourceID:          mod.ID,
+			RazorpayPaymentID: paymentID,
+			Amount:            mod.Delta(),
+			Reason:            reason,
+		}
+		return insertRefund(ctx, tx, result.Refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListRevisions retrieves the content history of an order, oldest first
+func (r *OrderModificationRepository) ListRevisions(ctx context.Context, orderID uuid.UUID) ([]domain.OrderRevision, error) {
+	query := `
+		SELECT order_id, revision, items, total_amount, modification_id, created_by, created_at
+		FROM order_revisions
+		WHERE order_id = $1
+		ORDER BY revision
+	`
+
+	rows, err := r.db.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []domain.OrderRevision{}
+	for rows.Next() {
+		var revision domain.OrderRevision
+		var items []byte
+
+		err := rows.Scan(
+			&revision.OrderID,
+			&revision.Revision,
+			&items,
+			&revision.TotalAmount,
+			&revision.ModificationID,
+			&revision.CreatedBy,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order revision: %w", err)
+		}
+		if err := json.Unmarshal(items, &revision.Items); err != nil {
+			return nil, fmt.Errorf("failed to decode revision items: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// scanModification scans a row selected with modificationColumns
+func scanModification(row pgx.Row) (*domain.OrderModification, error) {
+	mod := &domain.OrderModification{}
+	var items []byte
+	var razorpayOrderID, razorpayPaymentID *string
+
+	err := row.Scan(
+		&mod.ID,
+		&mod.OrderID,
+		&mod.BaseVersion,
+		&mod.Status,
+		&items,
+		&mod.OldTotal,
+		&mod.NewTotal,
+		&razorpayOrderID,
+		&razorpayPaymentID,
+		&mod.CreatedBy,
+		&mod.CreatedAt,
+		&mod.UpdatedAt,
+		&mod.AppliedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(items, &mod.Items); err != nil {
+		return nil, fmt.Errorf("failed to decode modification items: %w", err)
+	}
+	if razorpayOrderID != nil {
+		mod.RazorpayOrderID = *razorpayOrderID
+	}
+	if razorpayPaymentID != nil {
+		mod.RazorpayPaymentID = *razorpayPaymentID
+	}
+
+	return mod, nil
+}
@@ -3,8 +3,11 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,87 +27,126 @@ func NewOrderRepository(db *database.Pool) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
-// Create inserts a new order with its items in a transaction
+// Create inserts a new order with its items in a transaction and reserves
+// the stock of counted items until it is paid. Returns ErrOutOfStock if an
+// item does not have enough left.
 func (r *OrderRepository) Create(ctx context.Context, order *domain.Order) error {
-	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
-		// Insert order
-		orderQuery := `
-			INSERT INTO orders (id, user_id, status, total_amount, razorpay_order_id, version, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
+	return r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		if err := insertOrder(ctx, tx, order); err != nil {
+			return err
+		}
+		return reserveStock(ctx, tx, order.ID, order.Items, domain.StockReserved)
+	})
+}
 
-		order.ID = uuid.New()
-		order.Version = 1
-		now := time.Now()
-		order.CreatedAt = now
-		order.UpdatedAt = now
-
-		_, err := tx.Exec(ctx, orderQuery,
-			order.ID,
-			order.UserID,
-			order.Status,
-			order.TotalAmount,
-			order.RazorpayOrderID,
-			order.Version,
-			order.CreatedAt,
-			order.UpdatedAt,
-		)
+// insertOrder inserts an order and its items using the caller's transaction,
+// so other repositories can create orders atomically with their own rows
+func insertOrder(ctx context.Context, q database.Querier, order *domain.Order) error {
+	// Insert order
+	orderQuery := `
+		INSERT INTO orders (id, user_id, status, total_amount, fulfillment_type, delivery_address, delivery_fee, pickup_code,
+			table_session_id, catering_request_id, subscription_id, razorpay_order_id, notes, version, paid_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+
+	order.ID = uuid.New()
+	order.Version = 1
+	now := time.Now()
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	_, err := q.Exec(ctx, orderQuery,
+		order.ID,
+		order.UserID,
+		order.Status,
+		order.TotalAmount,
+		order.FulfillmentType,
+		order.DeliveryAddress,
+		order.DeliveryFee,
+		nullableString(order.PickupCode),
+		order.TableSessionID,
+		order.CateringRequestID,
+		order.SubscriptionID,
+		// NULL until the gateway order exists - '' would collide on the unique constraint
+		nullableString(order.RazorpayOrderID),
+		order.Notes,
+		order.Version,
+		order.PaidAt, // Set for prepaid orders only
+		order.CreatedAt,
+		order.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert order: %w", err)
+	}
+
+	if err := insertOrderItems(ctx, q, order.ID, order.Items, now); err != nil {
+		return err
+	}
+
+	return insertOrderCreated(ctx, q, order)
+}
+
+// insertOrderItems inserts the lines of an order, filling in their IDs
+func insertOrderItems(ctx context.Context, q database.Querier, orderID uuid.UUID, items []domain.OrderItem, now time.Time) error {
+	itemQuery := `
+		INSERT INTO order_items (id, order_id, menu_item_id, name, variant_id, variant_name, price, quantity, modifiers, components, notes, added_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+
+	for i := range items {
+		items[i].ID = uuid.New()
+		items[i].OrderID = orderID
+		items[i].CreatedAt = now
+
+		modifiers := items[i].Modifiers
+		if modifiers == nil {
+			modifiers = []domain.OrderItemModifier{}
+		}
+		modifiersJSON, err := json.Marshal(modifiers)
 		if err != nil {
-			return fmt.Errorf("failed to insert order: %w", err)
+			return fmt.Errorf("failed to encode order item modifiers: %w", err)
+		}
+		components := items[i].Components
+		if components == nil {
+			components = []domain.OrderItemComponent{}
+		}
+		componentsJSON, err := json.Marshal(components)
+		if err != nil {
+			return fmt.Errorf("failed to encode order item components: %w", err)
 		}
 
-		// Insert order items
-		itemQuery := `
-			INSERT INTO order_items (id, order_id, menu_item_id, name, price, quantity, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-		`
-
-		for i := range order.Items {
-			order.Items[i].ID = uuid.New()
-			order.Items[i].OrderID = order.ID
-			order.Items[i].CreatedAt = now
-
-			_, err := tx.Exec(ctx, itemQuery,
-				order.Items[i].ID,
-				order.Items[i].OrderID,
-				order.Items[i].MenuItemID,
-				order.Items[i].Name,
-				order.Items[i].Price,
-				order.Items[i].Quantity,
-				order.Items[i].CreatedAt,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to insert order item: %w", err)
-			}
+		_, err = q.Exec(ctx, itemQuery,
+			items[i].ID,
+			items[i].OrderID,
+			items[i].MenuItemID,
+			items[i].Name,
+			items[i].VariantID,
+			items[i].VariantName,
+			items[i].Price,
+			items[i].Quantity,
+			modifiersJSON,
+			componentsJSON,
+			items[i].Notes,
+			items[i].AddedBy,
+			items[i].CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert order item: %w", err)
 		}
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // GetByID retrieves an order with its items
 func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
-	orderQuery := `
-		SELECT id, user_id, status, total_amount, razorpay_order_id, razorpay_payment_id, version, created_at, updated_at
+	query := `
+		SELECT ` + orderColumns + `
 		FROM orders
 		WHERE id = $1
 	`
 
-	order := &domain.Order{}
-	var razorpayOrderID, razorpayPaymentID *string
-
-	err := r.db.QueryRow(ctx, orderQuery, id).Scan(
-		&order.ID,
-		&order.UserID,
-		&order.Status,
-		&order.TotalAmount,
-		&razorpayOrderID,
-		&razorpayPaymentID,
-		&order.Version,
-		&order.CreatedAt,
-		&order.UpdatedAt,
-	)
-
+	order, err := scanOrder(r.db.QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNotFound
@@ -112,13 +154,6 @@ func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Or
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	if razorpayOrderID != nil {
-		order.RazorpayOrderID = *razorpayOrderID
-	}
-	if razorpayPaymentID != nil {
-		order.RazorpayPaymentID = *razorpayPaymentID
-	}
-
 	// Fetch order items
 	items, err := r.getOrderItems(ctx, order.ID)
 	if err != nil {
@@ -132,27 +167,13 @@ func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Or
 // GetByRazorpayOrderID retrieves an order by Razorpay order ID
 // Used by webhook handler to find the order for payment updates
 func (r *OrderRepository) GetByRazorpayOrderID(ctx context.Context, razorpayOrderID string) (*domain.Order, error) {
-	orderQuery := `
-		SELECT id, user_id, status, total_amount, razorpay_order_id, razorpay_payment_id, version, created_at, updated_at
+	query := `
+		SELECT ` + orderColumns + `
 		FROM orders
 		WHERE razorpay_order_id = $1
 	`
 
-	order := &domain.Order{}
-	var rpOrderID, rpPaymentID *string
-
-	err := r.db.QueryRow(ctx, orderQuery, razorpayOrderID).Scan(
-		&order.ID,
-		&order.UserID,
-		&order.Status,
-		&order.TotalAmount,
-		&rpOrderID,
-		&rpPaymentID,
-		&order.Version,
-		&order.CreatedAt,
-		&order.UpdatedAt,
-	)
-
+	order, err := scanOrder(r.db.QueryRow(ctx, query, razorpayOrderID))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNotFound
@@ -160,59 +181,114 @@ func (r *OrderRepository) GetByRazorpayOrderID(ctx context.Context, razorpayOrde
 		return nil, fmt.Errorf("failed to get order by razorpay ID: %w", err)
 	}
 
-	if rpOrderID != nil {
-		order.RazorpayOrderID = *rpOrderID
+	return order, nil
+}
+
+// GetByUserID retrieves a page of a user's orders.
+// Full listings load items with one batched query; summary listings only
+// load item counts and a short preview for list screens.
+func (r *OrderRepository) GetByUserID(ctx context.Context, userID uuid.UUID, filter OrderFilter, summary bool) (*OrderPage, error) {
+	filter.UserID = &userID
+
+	page, err := r.searchOrders(ctx, filter)
+	if err != nil {
+		return nil, err
 	}
-	if rpPaymentID != nil {
-		order.RazorpayPaymentID = *rpPaymentID
+
+	if summary {
+		err = r.loadItemSummaries(ctx, page.Orders)
+	} else {
+		err = r.loadItems(ctx, page.Orders)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return order, nil
+	return page, nil
 }
 
-// GetByUserID retrieves all orders for a user
-func (r *OrderRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Order, error) {
+// GetByPickupCode retrieves the active pickup order with the given code.
+// Collected and unpaid orders are ignored so codes can be reused over time.
+func (r *OrderRepository) GetByPickupCode(ctx context.Context, code string) (*domain.Order, error) {
 	query := `
-		SELECT id, user_id, status, total_amount, razorpay_order_id, razorpay_payment_id, version, created_at, updated_at
+		SELECT ` + orderColumns + `
 		FROM orders
-		WHERE user_id = $1
+		WHERE pickup_code = $1 AND status IN ('PAID', 'ACCEPTED', 'READY_FOR_PICKUP')
 		ORDER BY created_at DESC
+		LIMIT 1
 	`
 
-	rows, err := r.db.Query(ctx, query, userID)
+	order, err := scanOrder(r.db.QueryRow(ctx, query, code))
 	if err != nil {
-		return nil, fmt.Errorf("failed to query user orders: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get order by pickup code: %w", err)
 	}
-	defer rows.Close()
 
-	var orders []domain.Order
-	for rows.Next() {
-		var order domain.Order
-		var razorpayOrderID, razorpayPaymentID *string
-
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Status,
-			&order.TotalAmount,
-			&razorpayOrderID,
-			&razorpayPaymentID,
-			&order.Version,
-			&order.CreatedAt,
-			&order.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
-		}
+	items, err := r.getOrderItems(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items
 
-		if razorpayOrderID != nil {
-			order.RazorpayOrderID = *razorpayOrderID
-		}
-		if razorpayPaymentID != nil {
-			order.RazorpayPaymentID = *razorpayPaymentID
-		}
+	return order, nil
+}
+
+// GetByStatuses retrieves orders in any of the given statuses with their items,
+// oldest first. Used to build the kitchen queue, so catering payments (the
+// food is prepared from the catering request) are left out.
+func (r *OrderRepository) GetByStatuses(ctx context.Context, statuses []domain.OrderStatus) ([]domain.Order, error) {
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders
+		WHERE status = ANY($1::text[]::order_status[]) AND catering_request_id IS NULL
+		ORDER BY created_at ASC
+	`
+
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	rows, err := r.db.Query(ctx, query, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders by status: %w", err)
+	}
+
+	orders, err := collectOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadItems(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// GetByTableSession retrieves the rounds of a table tab with items, oldest first
+func (r *OrderRepository) GetByTableSession(ctx context.Context, sessionID uuid.UUID) ([]domain.Order, error) {
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders
+		WHERE table_session_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(ctx, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table session orders: %w", err)
+	}
 
-		orders = append(orders, order)
+	orders, err := collectOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadItems(ctx, orders); err != nil {
+		return nil, err
 	}
 
 	return orders, nil
@@ -225,34 +301,51 @@ func (r *OrderRepository) UpdateStatus(ctx context.Context, orderID uuid.UUID, n
 	// This prevents race conditions where two concurrent requests try to update the same order
 	// If version doesn't match, another request already modified the order
 	query := `
-		UPDATE orders
-		SET status = $2, version = version + 1, updated_at = NOW()
-		WHERE id = $1 AND version = $3
+		UPDATE orders o
+		SET status = $2, version = o.version + 1, updated_at = NOW()
+		FROM (SELECT id, status FROM orders WHERE id = $1 FOR UPDATE) old
+		WHERE o.id = old.id AND o.version = $3
+		RETURNING old.status, o.user_id
 	`
 
-	result, err := r.db.Exec(ctx, query, orderID, newStatus, expectedVersion)
-	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
-	}
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		var oldStatus domain.OrderStatus
+		var userID uuid.UUID
+		err := tx.QueryRow(ctx, query, orderID, newStatus, expectedVersion).Scan(&oldStatus, &userID)
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("failed to update order status: %w", err)
+			}
+
+			// No row updated: either order doesn't exist or version mismatch
+			if _, err := r.GetByID(ctx, orderID); errors.Is(err, ErrNotFound) {
+				return ErrNotFound
+			}
+			// Order exists but version mismatch - concurrent modification
+			return ErrVersionConflict
+		}
 
-	// If no rows affected, either order doesn't exist or version mismatch
-	if result.RowsAffected() == 0 {
-		// Check if order exists
-		_, err := r.GetByID(ctx, orderID)
-		if errors.Is(err, ErrNotFound) {
-			return ErrNotFound
+		// A failed payment gives back the stock the order held
+		if newStatus == domain.OrderStatusPaymentFailed {
+			if err := releaseStock(ctx, tx, orderID); err != nil {
+				return err
+			}
 		}
-		// Order exists but version mismatch - concurrent modification
-		return ErrVersionConflict
-	}
 
-	return nil
+		// Written in the same transaction so the change is never lost to subscribers
+		return insertStatusChanged(ctx, tx, orderID, userID, oldStatus, newStatus)
+	})
 }
 
 // UpdatePaymentStatus updates order with payment information atomically
-// Uses SERIALIZABLE isolation to ensure payment is recorded exactly once
+// Uses SERIALIZABLE isolation to ensure payment is recorded exactly once.
+// Returns ErrOutOfStock once the payment has been refused and queued for a
+// refund because the order's stock sold out before it arrived.
 func (r *OrderRepository) UpdatePaymentStatus(ctx context.Context, orderID uuid.UUID, status domain.OrderStatus, paymentID string, expectedVersion int) error {
-	return r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+	refused := false
+	err := r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		refused = false
+
 		// First, check current status to prevent double processing
 		var currentStatus domain.OrderStatus
 		var currentVersion int
@@ -274,53 +367,57 @@ func (r *OrderRepository) UpdatePaymentStatus(ctx context.Context, orderID uuid.
 		}
 
 		// Prevent processing if already in a terminal state
-		if currentStatus == domain.OrderStatusPaid || currentStatus == domain.OrderStatusDelivered {
+		if currentStatus.IsPaid() {
 			// Already processed, idempotent success
 			return nil
 		}
 
-		// Update order with payment ID
-		updateQuery := `
-			UPDATE orders
-			SET status = $2, razorpay_payment_id = $3, version = version + 1, updated_at = NOW()
-			WHERE id = $1
-		`
-
-		_, err = tx.Exec(ctx, updateQuery, orderID, status, paymentID)
-		if err != nil {
-			return fmt.Errorf("failed to update payment status: %w", err)
+		// Update order with payment ID and write OrderPaid with it
+		_, err = markOrderPaid(ctx, tx, orderID, status, paymentID)
+		if errors.Is(err, ErrOutOfStock) {
+			refused = true
+			return refuseOrderPayment(ctx, tx, orderID, paymentID)
 		}
-
-		return nil
+		return err
 	})
+	if err == nil && refused {
+		return ErrOutOfStock
+	}
+	return err
 }
 
 // SetRazorpayOrderID updates the Razorpay order ID for an order
 func (r *OrderRepository) SetRazorpayOrderID(ctx context.Context, orderID uuid.UUID, razorpayOrderID string, expectedVersion int) error {
 	query := `
-		UPDATE orders
-		SET razorpay_order_id = $2, status = $3, version = version + 1, updated_at = NOW()
-		WHERE id = $1 AND version = $4
+		UPDATE orders o
+		SET razorpay_order_id = $2, status = $3, version = o.version + 1, updated_at = NOW()
+		FROM (SELECT id, status FROM orders WHERE id = $1 FOR UPDATE) old
+		WHERE o.id = old.id AND o.version = $4
+		RETURNING old.status, o.user_id
 	`
 
-	result, err := r.db.Exec(ctx, query, orderID, razorpayOrderID, domain.OrderStatusAwaitingPayment, expectedVersion)
-	if err != nil {
-		return fmt.Errorf("failed to set razorpay order ID: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return ErrVersionConflict
-	}
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		var oldStatus domain.OrderStatus
+		var userID uuid.UUID
+		err := tx.QueryRow(ctx, query, orderID, razorpayOrderID, domain.OrderStatusAwaitingPayment, expectedVersion).Scan(&oldStatus, &userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrVersionConflict
+			}
+			return fmt.Errorf("failed to set razorpay order ID: %w", err)
+		}
 
-	return nil
+		return insertStatusChanged(ctx, tx, orderID, userID, oldStatus, domain.OrderStatusAwaitingPayment)
+	})
 }
 
 // getOrderItems retrieves all items for an order
 func (r *OrderRepository) getOrderItems(ctx context.Context, orderID uuid.UUID) ([]domain.OrderItem, error) {
 	query := `
-		SELECT id, order_id, menu_item_id, name, price, quantity, created_at
+		SELECT ` + orderItemColumns + `
 		FROM order_items
 		WHERE order_id = $1
+		ORDER BY created_at, id
 	`
 
 	rows, err := r.db.Query(ctx, query, orderID)
@@ -331,71 +428,377 @@ func (r *OrderRepository) getOrderItems(ctx context.Context, orderID uuid.UUID)
 
 	var items []domain.OrderItem
 	for rows.Next() {
-		var item domain.OrderItem
-		err := rows.Scan(
-			&item.ID,
-			&item.OrderID,
-			&item.MenuItemID,
-			&item.Name,
-			&item.Price,
-			&item.Quantity,
-			&item.CreatedAt,
-		)
+		item, err := scanOrderItem(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order item: %w", err)
+			return nil, err
 		}
-		items = append(items, item)
+		items = append(items, *item)
 	}
 
 	return items, nil
 }
 
-// GetAllOrders retrieves all orders (admin only)
-func (r *OrderRepository) GetAllOrders(ctx context.Context, limit, offset int) ([]domain.Order, error) {
+// loadItems fills Items for a batch of orders with a single query
+// instead of one round trip per order
+func (r *OrderRepository) loadItems(ctx context.Context, orders []domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(orders))
+	index := make(map[uuid.UUID]int, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		index[orders[i].ID] = i
+		orders[i].Items = []domain.OrderItem{}
+	}
+
 	query := `
-		SELECT id, user_id, status, total_amount, razorpay_order_id, razorpay_payment_id, version, created_at, updated_at
-		FROM orders
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		SELECT ` + orderItemColumns + `
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY created_at, id
 	`
 
-	rows, err := r.db.Query(ctx, query, limit, offset)
+	rows, err := r.db.Query(ctx, query, ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query all orders: %w", err)
+		return fmt.Errorf("failed to query order items: %w", err)
 	}
 	defer rows.Close()
 
-	var orders []domain.Order
 	for rows.Next() {
-		var order domain.Order
-		var razorpayOrderID, razorpayPaymentID *string
-
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Status,
-			&order.TotalAmount,
-			&razorpayOrderID,
-			&razorpayPaymentID,
-			&order.Version,
-			&order.CreatedAt,
-			&order.UpdatedAt,
-		)
+		item, err := scanOrderItem(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return err
 		}
+		i := index[item.OrderID]
+		orders[i].Items = append(orders[i].Items, *item)
+	}
+
+	return rows.Err()
+}
+
+// OrderSortField is a timestamp column order listings can be sorted by
+type OrderSortField string
 
-		if razorpayOrderID != nil {
-			order.RazorpayOrderID = *razorpayOrderID
+const (
+	OrderSortCreatedAt OrderSortField = "created_at"
+	OrderSortUpdatedAt OrderSortField = "updated_at"
+)
+
+// OrderFilter describes an order search. Zero values mean "no filter".
+type OrderFilter struct {
+	Statuses        []domain.OrderStatus
+	CreatedFrom     *time.Time // Inclusive
+	CreatedTo       *time.Time // Exclusive
+	UserID          *uuid.UUID
+	UserPhone       string
+	UserEmail       string // Case-insensitive
+	MinAmount       *int64 // Paisa, inclusive
+	MaxAmount       *int64 // Paisa, inclusive
+	PaymentID       string
+	RazorpayOrderID string
+
+	SortBy    OrderSortField // Defaults to created_at
+	Ascending bool           // Defaults to newest first
+	Cursor    *OrderCursor   // Position after which the page starts
+	Limit     int
+}
+
+// OrderCursor is a keyset position in an order listing: the sort column value
+// and order ID of the last row of the previous page. It stays stable while new
+// orders are inserted, unlike offsets.
+type OrderCursor struct {
+	SortBy    OrderSortField
+	Ascending bool
+	Value     time.Time
+	ID        uuid.UUID
+}
+
+// Encode serialises the cursor into an opaque URL-safe token
+func (c OrderCursor) Encode() string {
+	direction := "desc"
+	if c.Ascending {
+		direction = "asc"
+	}
+	raw := strings.Join([]string{string(c.SortBy), direction, c.Value.UTC().Format(time.RFC3339Nano), c.ID.String()}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeOrderCursor parses a token produced by OrderCursor.Encode
+func DecodeOrderCursor(token string) (*OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return nil, ErrInvalidCursor
+	}
+
+	sortBy := OrderSortField(parts[0])
+	if sortBy != OrderSortCreatedAt && sortBy != OrderSortUpdatedAt {
+		return nil, ErrInvalidCursor
+	}
+	if parts[1] != "asc" && parts[1] != "desc" {
+		return nil, ErrInvalidCursor
+	}
+
+	value, err := time.Parse(time.RFC3339Nano, parts[2])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &OrderCursor{
+		SortBy:    sortBy,
+		Ascending: parts[1] == "asc",
+		Value:     value,
+		ID:        id,
+	}, nil
+}
+
+// OrderPage is one page of an order search
+type OrderPage struct {
+	Orders     []domain.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Empty on the last page
+	// TotalCount is the number of orders matching the whole filter
+	TotalCount int64 `json:"total_count"`
+	// StatusCounts counts orders per status for the filter without its
+	// status set, so clients can show a count on every status tab
+	StatusCounts map[domain.OrderStatus]int64 `json:"status_counts"`
+}
+
+// orderConditions builds the WHERE clause for a filter. Cursor and status set
+// are optional so the same conditions can drive the page and the counts.
+func orderConditions(f OrderFilter, withStatuses, withCursor bool) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if withStatuses && len(f.Statuses) > 0 {
+		names := make([]string, len(f.Statuses))
+		for i, status := range f.Statuses {
+			names[i] = string(status)
 		}
-		if razorpayPaymentID != nil {
-			order.RazorpayPaymentID = *razorpayPaymentID
+		conds = append(conds, "o.status = ANY("+arg(names)+"::text[]::order_status[])")
+	}
+	if f.CreatedFrom != nil {
+		conds = append(conds, "o.created_at >= "+arg(*f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		conds = append(conds, "o.created_at < "+arg(*f.CreatedTo))
+	}
+	if f.UserID != nil {
+		conds = append(conds, "o.user_id = "+arg(*f.UserID))
+	}
+	if f.UserPhone != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM users u WHERE u.id = o.user_id AND u.phone_number = "+arg(f.UserPhone)+")")
+	}
+	if f.UserEmail != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM users u WHERE u.id = o.user_id AND LOWER(u.email) = LOWER("+arg(f.UserEmail)+"))")
+	}
+	if f.MinAmount != nil {
+		conds = append(conds, "o.total_amount >= "+arg(*f.MinAmount))
+	}
+	if f.MaxAmount != nil {
+		conds = append(conds, "o.total_amount <= "+arg(*f.MaxAmount))
+	}
+	if f.PaymentID != "" {
+		conds = append(conds, "o.razorpay_payment_id = "+arg(f.PaymentID))
+	}
+	if f.RazorpayOrderID != "" {
+		conds = append(conds, "o.razorpay_order_id = "+arg(f.RazorpayOrderID))
+	}
+	if withCursor && f.Cursor != nil {
+		// Row comparison walks the (sort column, id) index without gaps or repeats
+		op := "<"
+		if f.Ascending {
+			op = ">"
 		}
+		conds = append(conds, fmt.Sprintf("(o.%s, o.id) %s (%s, %s)", f.SortBy, op, arg(f.Cursor.Value), arg(f.Cursor.ID)))
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// loadItemSummaries fills ItemCount and ItemPreview for a batch of orders
+// with a single aggregate query
+func (r *OrderRepository) loadItemSummaries(ctx context.Context, orders []domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
 
-		orders = append(orders, order)
+	ids := make([]uuid.UUID, len(orders))
+	index := make(map[uuid.UUID]int, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		index[orders[i].ID] = i
 	}
 
-	return orders, nil
+	query := `
+		SELECT oi.order_id, SUM(oi.quantity), STRING_AGG(oi.quantity || ' x ' || ` + orderItemNameSQL + `, ', ' ORDER BY oi.created_at, oi.id)
+		FROM order_items oi
+		WHERE oi.order_id = ANY($1)
+		GROUP BY oi.order_id
+	`
+
+	rows, err := r.db.Query(ctx, query, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query order item summaries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID uuid.UUID
+		var count int
+		var preview string
+		if err := rows.Scan(&orderID, &count, &preview); err != nil {
+			return fmt.Errorf("failed to scan order item summary: %w", err)
+		}
+		i := index[orderID]
+		orders[i].ItemCount = count
+		orders[i].ItemPreview = preview
+	}
+
+	return rows.Err()
+}
+
+// GetAllOrders searches orders with their items (admin only).
+// Pages with keyset cursors instead of offsets so pages stay stable while
+// new orders arrive.
+func (r *OrderRepository) GetAllOrders(ctx context.Context, filter OrderFilter) (*OrderPage, error) {
+	page, err := r.searchOrders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadItems(ctx, page.Orders); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// searchOrders runs a filtered keyset-paginated order query with status
+// counts. Items are left for the caller to load.
+func (r *OrderRepository) searchOrders(ctx context.Context, filter OrderFilter) (*OrderPage, error) {
+	if filter.SortBy == "" {
+		filter.SortBy = OrderSortCreatedAt
+	}
+	if filter.Cursor != nil && (filter.Cursor.SortBy != filter.SortBy || filter.Cursor.Ascending != filter.Ascending) {
+		return nil, ErrInvalidCursor
+	}
+
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
+
+	where, args := orderConditions(filter, true, true)
+	args = append(args, filter.Limit+1) // One extra row tells us whether there is a next page
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM orders o
+		%s
+		ORDER BY o.%s %s, o.id %s
+		LIMIT $%d
+	`, prefixColumns("o", orderColumns), where, filter.SortBy, direction, direction, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+
+	orders, err := collectOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > filter.Limit {
+		page.Orders = orders[:filter.Limit]
+		last := page.Orders[len(page.Orders)-1]
+		cursor := OrderCursor{SortBy: filter.SortBy, Ascending: filter.Ascending, ID: last.ID, Value: last.CreatedAt}
+		if filter.SortBy == OrderSortUpdatedAt {
+			cursor.Value = last.UpdatedAt
+		}
+		page.NextCursor = cursor.Encode()
+	}
+	if page.Orders == nil {
+		page.Orders = []domain.Order{}
+	}
+
+	page.StatusCounts, err = r.countByStatus(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for status, count := range page.StatusCounts {
+		if len(filter.Statuses) == 0 || containsStatus(filter.Statuses, status) {
+			page.TotalCount += count
+		}
+	}
+
+	return page, nil
+}
+
+// countByStatus counts orders per status for a filter, ignoring its status set and cursor
+func (r *OrderRepository) countByStatus(ctx context.Context, filter OrderFilter) (map[domain.OrderStatus]int64, error) {
+	where, args := orderConditions(filter, false, false)
+	query := `
+		SELECT o.status, COUNT(*)
+		FROM orders o
+		` + where + `
+		GROUP BY o.status
+	`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count orders by status: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[domain.OrderStatus]int64)
+	for rows.Next() {
+		var status domain.OrderStatus
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan status count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// containsStatus reports whether status is in statuses
+func containsStatus(statuses []domain.OrderStatus, status domain.OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixColumns qualifies a comma-separated column list with a table alias
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
 }
 
 // LogWebhook stores webhook attempt for audit trail
@@ -425,3 +828,197 @@ func (r *OrderRepository) LogWebhook(ctx context.Context, source, eventType stri
 
 	return nil
 }
+
+// GetDailySales totals the orders paid in the range per day in timezone
+func (r *OrderRepository) GetDailySales(ctx context.Context, from, to time.Time, timezone string) ([]domain.DailyAmount, error) {
+	query := `
+		SELECT date_trunc('day', paid_at AT TIME ZONE $3), COUNT(*), SUM(total_amount), SUM(delivery_fee)
+		FROM orders
+		WHERE paid_at >= $1 AND paid_at < $2
+		GROUP BY 1
+		ORDER BY 1
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily sales: %w", err)
+	}
+	defer rows.Close()
+
+	var days []domain.DailyAmount
+	for rows.Next() {
+		var d domain.DailyAmount
+		if err := rows.Scan(&d.Day, &d.Count, &d.Amount, &d.Fees); err != nil {
+			return nil, fmt.Errorf("failed to scan daily sales: %w", err)
+		}
+		days = append(days, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily sales: %w", err)
+	}
+
+	return days, nil
+}
+
+// GetDailyGatewayFees totals the fees Razorpay charged per day in timezone,
+// from the captured-payment webhooks logged in the range. Razorpay retries
+// webhooks, so each payment is counted once.
+func (r *OrderRepository) GetDailyGatewayFees(ctx context.Context, from, to time.Time, timezone string) ([]domain.DailyAmount, error) {
+	query := `
+		SELECT date_trunc('day', created_at AT TIME ZONE $3), COUNT(*), SUM(fee), SUM(tax)
+		FROM (
+			SELECT DISTINCT ON (p->>'id') created_at,
+				CASE WHEN jsonb_typeof(p->'fee') = 'number' THEN (p->>'fee')::BIGINT ELSE 0 END AS fee,
+				CASE WHEN jsonb_typeof(p->'tax') = 'number' THEN (p->>'tax')::BIGINT ELSE 0 END AS tax
+			FROM webhook_logs
+			CROSS JOIN LATERAL (SELECT payload->'payload'->'payment'->'entity' AS p) e
+			WHERE source = 'razorpay' AND signature_valid AND event_type = 'payment.captured'
+				AND created_at >= $1 AND created_at < $2
+			ORDER BY p->>'id', created_at
+		) payments
+		WHERE fee > 0
+		GROUP BY 1
+		ORDER BY 1
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily gateway fees: %w", err)
+	}
+	defer rows.Close()
+
+	var days []domain.DailyAmount
+	for rows.Next() {
+		var d domain.DailyAmount
+		if err := rows.Scan(&d.Day, &d.Count, &d.Amount, &d.Tax); err != nil {
+			return nil, fmt.Errorf("failed to scan daily gateway fees: %w", err)
+		}
+		days = append(days, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily gateway fees: %w", err)
+	}
+
+	return days, nil
+}
+
+// orderColumns is the column list shared by every order query, in scanOrder order
+const orderColumns = `id, user_id, status, total_amount, fulfillment_type, delivery_address, delivery_fee, pickup_code,
+	table_session_id, catering_request_id, subscription_id, razorpay_order_id, razorpay_payment_id, notes, version, paid_at,
+	created_at, updated_at`
+
+// orderItemNameSQL is the display name of order item oi, with the variant
+// chosen as in OrderItem.DisplayName
+const orderItemNameSQL = `(oi.name || CASE WHEN oi.variant_name <> '' THEN ' (' || oi.variant_name || ')' ELSE '' END)`
+
+// orderItemColumns is the column list shared by every order item query, in scanOrderItem order
+const orderItemColumns = `id, order_id, menu_item_id, name, variant_id, variant_name, price, quantity, modifiers, components, notes, added_by, created_at`
+
+// scanOrder scans a row selected with orderColumns
+func scanOrder(row pgx.Row) (*domain.Order, error) {
+	order := &domain.Order{}
+	var pickupCode, razorpayOrderID, razorpayPaymentID *string
+
+	err := row.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Status,
+		&order.TotalAmount,
+		&order.FulfillmentType,
+		&order.DeliveryAddress,
+		&order.DeliveryFee,
+		&pickupCode,
+		&order.TableSessionID,
+		&order.CateringRequestID,
+		&order.SubscriptionID,
+		&razorpayOrderID,
+		&razorpayPaymentID,
+		&order.Notes,
+		&order.Version,
+		&order.PaidAt,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if pickupCode != nil {
+		order.PickupCode = *pickupCode
+	}
+	if razorpayOrderID != nil {
+		order.RazorpayOrderID = *razorpayOrderID
+	}
+	if razorpayPaymentID != nil {
+		order.RazorpayPaymentID = *razorpayPaymentID
+	}
+
+	return order, nil
+}
+
+// nullableString maps empty strings to NULL for optional unique columns
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// collectOrders scans and closes a result set selected with orderColumns
+func collectOrders(rows pgx.Rows) ([]domain.Order, error) {
+	defer rows.Close()
+
+	var orders []domain.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// scanOrderItem scans a row selected with orderItemColumns
+func scanOrderItem(row pgx.Row) (*domain.OrderItem, error) {
+	item := &domain.OrderItem{}
+	var modifiers, components []byte
+	err := row.Scan(
+		&item.ID,
+		&item.OrderID,
+		&item.MenuItemID,
+		&item.Name,
+		&item.VariantID,
+		&item.VariantName,
+		&item.Price,
+		&item.Quantity,
+		&modifiers,
+		&components,
+		&item.Notes,
+		&item.AddedBy,
+		&item.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan order item: %w", err)
+	}
+	if err := json.Unmarshal(modifiers, &item.Modifiers); err != nil {
+		return nil, fmt.Errorf("failed to decode order item modifiers: %w", err)
+	}
+	if len(item.Modifiers) == 0 {
+		item.Modifiers = nil
+	}
+	if err := json.Unmarshal(components, &item.Components); err != nil {
+		return nil, fmt.Errorf("failed to decode order item components: %w", err)
+	}
+	if len(item.Components) == 0 {
+		item.Components = nil
+	}
+	return item, nil
+}
@@ -0,0 +1,361 @@
+// Package repository implements the transactional outbox of domain events
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// ErrConsumerBusy is returned when another instance is delivering to a consumer
+var ErrConsumerBusy = errors.New("outbox consumer is busy")
+
+// OutboxRepository reads the outbox for the relay and tracks consumer offsets
+type OutboxRepository struct {
+	db *database.Pool
+}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository(db *database.Pool) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// insertEvent writes a domain event inside the caller's transaction, so the
+// event is published if and only if the change it describes is committed
+func insertEvent(ctx context.Context, q database.Querier, eventType domain.EventType, aggregateID uuid.UUID, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	query := `INSERT INTO outbox_events (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`
+	if _, err := q.Exec(ctx, query, eventType, aggregateID, data); err != nil {
+		return fmt.Errorf("failed to insert %s event: %w", eventType, err)
+	}
+
+	return nil
+}
+
+// insertOrderCreated writes OrderCreated for a new order, and OrderPaid if it
+// was prepaid
+func insertOrderCreated(ctx context.Context, q database.Querier, order *domain.Order) error {
+	err := insertEvent(ctx, q, domain.EventOrderCreated, order.ID, domain.OrderCreatedEvent{
+		OrderID:           order.ID,
+		UserID:            order.UserID,
+		Status:            order.Status,
+		TotalAmount:       order.TotalAmount,
+		FulfillmentType:   order.FulfillmentType,
+		TableSessionID:    order.TableSessionID,
+		CateringRequestID: order.CateringRequestID,
+		SubscriptionID:    order.SubscriptionID,
+	})
+	if err != nil || order.PaidAt == nil {
+		return err
+	}
+
+	return insertEvent(ctx, q, domain.EventOrderPaid, order.ID, domain.OrderPaidEvent{
+		OrderID: order.ID,
+		UserID:  order.UserID,
+		Amount:  order.TotalAmount,
+		PaidAt:  *order.PaidAt,
+	})
+}
+
+// insertStatusChanged writes OrderStatusChanged unless the status stayed the same
+func insertStatusChanged(ctx context.Context, q database.Querier, orderID, userID uuid.UUID, from, to domain.OrderStatus) error {
+	if from == to {
+		return nil
+	}
+
+	return insertEvent(ctx, q, domain.EventOrderStatusChanged, orderID, domain.OrderStatusChangedEvent{
+		OrderID: orderID,
+		UserID:  userID,
+		From:    from,
+		To:      to,
+	})
+}
+
+// markOrderPaid records the payment of an order that is not paid yet, sells
+// the stock it holds, voids its open split bill and writes its events.
+// Returns false if the order was already paid. Returns ErrOutOfStock without
+// changing anything if the stock the order gave back has been sold, or its
+// payment was refused for that before; the caller then refuses the payment
+// with refuseOrderPayment.
+func markOrderPaid(ctx context.Context, q database.Querier, orderID uuid.UUID, status domain.OrderStatus, paymentID string) (bool, error) {
+	var paid, refused bool
+	err := q.QueryRow(ctx, `
+		SELECT paid_at IS NOT NULL,
+			EXISTS (SELECT 1 FROM refunds WHERE source = $2 AND source_id = $1)
+		FROM orders WHERE id = $1
+		FOR UPDATE
+	`, orderID, domain.RefundSourceOutOfStock).Scan(&paid, &refused)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to lock order: %w", err)
+	}
+	if paid {
+		return false, nil
+	}
+	if refused {
+		return false, ErrOutOfStock
+	}
+
+	// Before the order changes, so a sold out order is left as it was
+	if err := commitStock(ctx, q, orderID); err != nil {
+		return false, err
+	}
+
+	query := `
+		UPDATE orders o
+		SET status = $2, razorpay_payment_id = COALESCE($3, o.razorpay_payment_id), paid_at = NOW(),
+			version = o.version + 1, updated_at = NOW()
+		FROM (SELECT id, status FROM orders WHERE id = $1 FOR UPDATE) old
+		WHERE o.id = old.id AND o.paid_at IS NULL
+		RETURNING old.status, o.user_id, o.total_amount, o.paid_at
+	`
+
+	var from domain.OrderStatus
+	event := domain.OrderPaidEvent{OrderID: orderID, RazorpayPaymentID: paymentID}
+	err = q.QueryRow(ctx, query, orderID, status, nullableString(paymentID)).Scan(&from, &event.UserID, &event.Amount, &event.PaidAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to mark order paid: %w", err)
+	}
+
+	if err := insertEvent(ctx, q, domain.EventOrderPaid, orderID, event); err != nil {
+		return false, err
+	}
+	if err := insertStatusChanged(ctx, q, orderID, event.UserID, from, status); err != nil {
+		return false, err
+	}
+	if err := voidOpenBill(ctx, q, domain.BillSourceOrder, orderID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// completeRefund marks a refund processed and writes RefundIssued, inside the
+// caller's transaction
+func completeRefund(ctx context.Context, q database.Querier, refundID uuid.UUID, razorpayRefundID string) error {
+	query := `
+		UPDATE refunds r
+		SET status = 'PROCESSED', razorpay_refund_id = $2, last_error = '',
+			attempts = attempts + 1, processed_at = NOW()
+		WHERE id = $1
+		RETURNING r.order_id, r.source, r.source_id, r.amount, r.razorpay_payment_id,
+			COALESCE(
+				(SELECT o.user_id FROM orders o WHERE o.id = r.order_id),
+				(SELECT s.user_id FROM subscription_periods sp JOIN subscriptions s ON s.id = sp.subscription_id
+				 WHERE r.source = $3 AND sp.id = r.source_id)
+			)
+	`
+
+	event := domain.RefundIssuedEvent{RefundID: refundID, RazorpayRefundID: razorpayRefundID}
+	err := q.QueryRow(ctx, query, refundID, razorpayRefundID, domain.RefundSourceSubscriptionPeriod).Scan(
+		&event.OrderID,
+		&event.Source,
+		&event.SourceID,
+		&event.Amount,
+		&event.RazorpayPaymentID,
+		&event.UserID,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to mark refund processed: %w", err)
+	}
+
+	return insertEvent(ctx, q, domain.EventRefundIssued, refundID, event)
+}
+
+// ConsumeResult is what one Consume call did for a consumer
+type ConsumeResult struct {
+	Fetched  int                 // Events read after the offset
+	Handled  int                 // Events the offset moved past, including a parked one
+	Failures int                 // Failed attempts at the event the consumer stopped at
+	Parked   *domain.OutboxEvent // Event given up on and moved to the dead letters
+}
+
+// Consume delivers the next events after a consumer's offset and moves the
+// offset past the ones deliver reports as handled, in order. Events are read
+// only once every older transaction has finished, so an event committed late
+// is never skipped. A consumer seen for the first time starts with the
+// transactions still in flight. Returns ErrConsumerBusy if another instance
+// holds the consumer.
+//
+// deliver returns how many events it handled and, if it stopped early, why.
+// Failures are counted per consumer and event; once an event has failed
+// maxAttempts times it is copied to outbox_dead_letters and skipped. A
+// maxAttempts of 0 retries forever.
+func (r *OutboxRepository) Consume(ctx context.Context, consumer string, limit, maxAttempts int, deliver func(events []domain.OutboxEvent) (int, error)) (*ConsumeResult, error) {
+	result := &ConsumeResult{}
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		register := `
+			INSERT INTO outbox_offsets (consumer, tx_id, event_id)
+			VALUES ($1, pg_snapshot_xmin(pg_current_snapshot())::text::bigint, 0)
+			ON CONFLICT (consumer) DO NOTHING
+		`
+		if _, err := tx.Exec(ctx, register, consumer); err != nil {
+			return fmt.Errorf("failed to register outbox consumer: %w", err)
+		}
+
+		// Held until the offset is saved: one instance delivers per consumer
+		var txID, eventID int64
+		lock := `SELECT tx_id, event_id FROM outbox_offsets WHERE consumer = $1 FOR UPDATE SKIP LOCKED`
+		if err := tx.QueryRow(ctx, lock, consumer).Scan(&txID, &eventID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrConsumerBusy
+			}
+			return fmt.Errorf("failed to lock outbox consumer: %w", err)
+		}
+
+		query := `
+			SELECT id, tx_id, event_type, aggregate_id, payload, created_at
+			FROM outbox_events
+			WHERE (tx_id, id) > ($1, $2)
+				AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+			ORDER BY tx_id, id
+			LIMIT $3
+		`
+
+		rows, err := tx.Query(ctx, query, txID, eventID, limit)
+		if err != nil {
+			return fmt.Errorf("failed to query outbox events: %w", err)
+		}
+
+		var events []domain.OutboxEvent
+		var txIDs []int64
+		for rows.Next() {
+			var event domain.OutboxEvent
+			var eventTxID int64
+			if err := rows.Scan(&event.ID, &eventTxID, &event.Type, &event.AggregateID, &event.Payload, &event.CreatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan outbox event: %w", err)
+			}
+			events = append(events, event)
+			txIDs = append(txIDs, eventTxID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating outbox events: %w", err)
+		}
+
+		result.Fetched = len(events)
+		if len(events) == 0 {
+			return nil
+		}
+
+		handled, deliverErr := deliver(events)
+		if handled < len(events) && deliverErr != nil {
+			failed := events[handled]
+			failures, err := recordDeliveryFailure(ctx, tx, consumer, failed.ID, deliverErr)
+			if err != nil {
+				return err
+			}
+			result.Failures = failures
+
+			if maxAttempts > 0 && failures >= maxAttempts {
+				if err := insertDeadLetter(ctx, tx, consumer, &failed, failures, deliverErr); err != nil {
+					return err
+				}
+				result.Parked = &failed
+				handled++
+			}
+		}
+
+		result.Handled = handled
+		if handled == 0 {
+			return nil
+		}
+
+		last := handled - 1
+		save := `
+			UPDATE outbox_offsets
+			SET tx_id = $2, event_id = $3, failed_event_id = NULL, failures = 0, last_error = ''
+			WHERE consumer = $1
+		`
+		if handled < len(events) && result.Parked == nil && deliverErr != nil {
+			// Keep the failure just recorded for the event the consumer stopped at
+			save = `UPDATE outbox_offsets SET tx_id = $2, event_id = $3 WHERE consumer = $1`
+		}
+		if _, err := tx.Exec(ctx, save, consumer, txIDs[last], events[last].ID); err != nil {
+			return fmt.Errorf("failed to save outbox offset: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// recordDeliveryFailure counts a failed attempt at an event for a consumer,
+// starting over when the consumer fails on a different event. Returns the
+// failures so far.
+func recordDeliveryFailure(ctx context.Context, tx pgx.Tx, consumer string, eventID int64, cause error) (int, error) {
+	query := `
+		UPDATE outbox_offsets
+		SET failures = CASE WHEN failed_event_id = $2 THEN failures + 1 ELSE 1 END,
+			failed_event_id = $2,
+			last_error = $3
+		WHERE consumer = $1
+		RETURNING failures
+	`
+
+	var failures int
+	if err := tx.QueryRow(ctx, query, consumer, eventID, cause.Error()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record outbox delivery failure: %w", err)
+	}
+	return failures, nil
+}
+
+// insertDeadLetter parks an event a consumer gave up on, with a copy of the
+// event so it survives pruning
+func insertDeadLetter(ctx context.Context, tx pgx.Tx, consumer string, event *domain.OutboxEvent, attempts int, cause error) error {
+	query := `
+		INSERT INTO outbox_dead_letters (consumer, event_id, event_type, aggregate_id, payload, event_created_at, attempts, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (consumer, event_id) DO NOTHING
+	`
+	_, err := tx.Exec(ctx, query, consumer, event.ID, event.Type, event.AggregateID, event.Payload, event.CreatedAt, attempts, cause.Error())
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox dead letter: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes the events created before the given time that every
+// consumer has handled. An event a consumer is still stuck on is kept until
+// it is handled or parked as a dead letter.
+func (r *OutboxRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM outbox_events e
+		WHERE e.created_at < $1
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_offsets o WHERE (e.tx_id, e.id) > (o.tx_id, o.event_id)
+			)
+	`
+	result, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox events: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,196 @@
+// Package repository implements refund data access
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// RefundRepository handles gateway refund records
+type RefundRepository struct {
+	db *database.Pool
+}
+
+// NewRefundRepository creates a new refund repository
+func NewRefundRepository(db *database.Pool) *RefundRepository {
+	return &RefundRepository{db: db}
+}
+
+// refundColumns is the column list scanned by collectRefunds
+const refundColumns = `id, order_id, source, source_id, razorpay_payment_id, razorpay_refund_id, amount,
+	status, reason, last_error, attempts, created_at, updated_at, processed_at`
+
+// bookedRefundsSQL is an SQL condition on refunds that holds for processed
+// refunds of orders that reverse a booked sale. Sales book an order's final
+// total once, so returning money paid on top of it is not a reversal: the
+// surplus of an edit or an edit that was not applied, the shares of a
+// voided split, and payments refused because the order sold out.
+const bookedRefundsSQL = `status = 'PROCESSED' AND order_id IS NOT NULL AND source NOT IN ('` +
+	domain.RefundSourceOrderModification + `', '` + domain.RefundSourceBillShare + `', '` + domain.RefundSourceOutOfStock + `')`
+
+// insertRefund records a pending refund inside the caller's transaction.
+// A refund already recorded for the same source and payment is left
+// untouched, so the cause of a refund can never pay out twice.
+func insertRefund(ctx context.Context, q database.Querier, refund *domain.Refund) error {
+	query := `
+		INSERT INTO refunds (id, order_id, source, source_id, razorpay_payment_id, amount, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (source, source_id, razorpay_payment_id) DO NOTHING
+	`
+
+	refund.ID = uuid.New()
+	refund.Status = domain.RefundPending
+	_, err := q.Exec(ctx, query,
+		refund.ID,
+		refund.OrderID,
+		refund.Source,
+		refund.SourceID,
+		refund.RazorpayPaymentID,
+		refund.Amount,
+		refund.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert refund: %w", err)
+	}
+
+	return nil
+}
+
+// GetUnprocessedBySources retrieves the refunds for the given causes that still
+// have to go through the gateway
+func (r *RefundRepository) GetUnprocessedBySources(ctx context.Context, source string, sourceIDs []uuid.UUID) ([]domain.Refund, error) {
+	query := `
+		SELECT ` + refundColumns + `
+		FROM refunds
+		WHERE source = $1 AND source_id = ANY($2) AND status <> 'PROCESSED'
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, source, sourceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refunds: %w", err)
+	}
+
+	return collectRefunds(rows)
+}
+
+// GetByOrderID retrieves all refunds related to an order, oldest first
+func (r *RefundRepository) GetByOrderID(ctx context.Context, orderID uuid.UUID) ([]domain.Refund, error) {
+	query := `
+		SELECT ` + refundColumns + `
+		FROM refunds
+		WHERE order_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refunds: %w", err)
+	}
+
+	return collectRefunds(rows)
+}
+
+// MarkProcessed records the gateway refund ID of a successful refund and
+// publishes RefundIssued
+func (r *RefundRepository) MarkProcessed(ctx context.Context, refundID uuid.UUID, razorpayRefundID string) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		return completeRefund(ctx, tx, refundID, razorpayRefundID)
+	})
+}
+
+// MarkFailed records a failed gateway attempt; the refund is retried later
+func (r *RefundRepository) MarkFailed(ctx context.Context, refundID uuid.UUID, lastError string) error {
+	query := `
+		UPDATE refunds
+		SET status = 'FAILED', last_error = $2, attempts = attempts + 1
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, refundID, lastError); err != nil {
+		return fmt.Errorf("failed to mark refund failed: %w", err)
+	}
+
+	return nil
+}
+
+// GetDailyRefunds totals the refunds of booked sales processed in the range
+// per day in timezone
+func (r *RefundRepository) GetDailyRefunds(ctx context.Context, from, to time.Time, timezone string) ([]domain.DailyAmount, error) {
+	query := `
+		SELECT date_trunc('day', processed_at AT TIME ZONE $3), COUNT(*), SUM(amount)
+		FROM refunds
+		WHERE ` + bookedRefundsSQL + ` AND processed_at >= $1 AND processed_at < $2
+		GROUP BY 1
+		ORDER BY 1
+	`
+
+	rows, err := r.db.Query(ctx, query, from, to, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var days []domain.DailyAmount
+	for rows.Next() {
+		var d domain.DailyAmount
+		if err := rows.Scan(&d.Day, &d.Count, &d.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan daily refunds: %w", err)
+		}
+		days = append(days, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily refunds: %w", err)
+	}
+
+	return days, nil
+}
+
+func collectRefunds(rows pgx.Rows) ([]domain.Refund, error) {
+	defer rows.Close()
+
+	var refunds []domain.Refund
+	for rows.Next() {
+		var refund domain.Refund
+		var razorpayRefundID *string
+
+		err := rows.Scan(
+			&refund.ID,
+			&refund.OrderID,
+			&refund.Source,
+			&refund.SourceID,
+			&refund.RazorpayPaymentID,
+			&razorpayRefundID,
+			&refund.Amount,
+			&refund.Status,
+			&refund.Reason,
+			&refund.LastError,
+			&refund.Attempts,
+			&refund.CreatedAt,
+			&refund.UpdatedAt,
+			&refund.ProcessedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+
+		if razorpayRefundID != nil {
+			refund.RazorpayRefundID = *razorpayRefundID
+		}
+		refunds = append(refunds, refund)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating refunds: %w", err)
+	}
+
+	return refunds, nil
+}
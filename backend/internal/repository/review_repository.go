@@ -0,0 +1,543 @@
+// Package repository implements review data access
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// ErrAlreadyReviewed is returned when an order already has a review
+var ErrAlreadyReviewed = errors.New("order has already been reviewed")
+
+// ReviewRepository handles order and item reviews and keeps the menu rating
+// aggregates (menu_items.rating_sum/rating_count) in step with them
+type ReviewRepository struct {
+	db *database.Pool
+}
+
+// NewReviewRepository creates a new review repository
+func NewReviewRepository(db *database.Pool) *ReviewRepository {
+	return &ReviewRepository{db: db}
+}
+
+// orderReviewColumns is the column list scanned by scanOrderReview
+const orderReviewColumns = `id, order_id, user_id, food_rating, delivery_rating, comment, photo_urls,
+	status, moderation_note, moderated_by, moderated_at, created_at, updated_at`
+
+// itemReviewColumns is the column list scanned by scanItemReview
+const itemReviewColumns = `ir.id, ir.review_id, ir.order_item_id, ir.menu_item_id, ir.rating, ir.comment, ir.photo_urls,
+	ir.status, ir.moderation_note, ir.moderated_by, ir.moderated_at, ir.created_at, ir.updated_at`
+
+// ReviewCursor is a keyset position in a newest-first review listing
+type ReviewCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode serialises the cursor into an opaque URL-safe token
+func (c ReviewCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeReviewCursor parses a token produced by ReviewCursor.Encode
+func DecodeReviewCursor(token string) (*ReviewCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &ReviewCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// ItemReviewPage is one page of a menu item's reviews
+type ItemReviewPage struct {
+	Reviews    []domain.ItemReview `json:"reviews"`
+	NextCursor string              `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// OrderReviewPage is one page of the moderation listing
+type OrderReviewPage struct {
+	Reviews    []domain.OrderReview `json:"reviews"`
+	NextCursor string               `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// Create records a review with its item reviews and adds the item ratings to
+// the menu aggregates in the same transaction
+func (r *ReviewRepository) Create(ctx context.Context, review *domain.OrderReview) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now()
+		review.ID = uuid.New()
+		review.Status = domain.ReviewVisible
+		review.CreatedAt = now
+		review.UpdatedAt = now
+
+		query := `
+			INSERT INTO order_reviews (id, order_id, user_id, food_rating, delivery_rating, comment, photo_urls,
+				status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		_, err := tx.Exec(ctx, query,
+			review.ID,
+			review.OrderID,
+			review.UserID,
+			review.FoodRating,
+			review.DeliveryRating,
+			review.Comment,
+			review.PhotoURLs,
+			review.Status,
+			review.CreatedAt,
+			review.UpdatedAt,
+		)
+		if err != nil {
+			if isDuplicateKeyError(err) {
+				return ErrAlreadyReviewed
+			}
+			return fmt.Errorf("failed to insert order review: %w", err)
+		}
+
+		itemQuery := `
+			INSERT INTO item_reviews (id, review_id, order_item_id, menu_item_id, rating, comment, photo_urls,
+				status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		for i := range review.Items {
+			item := &review.Items[i]
+			item.ID = uuid.New()
+			item.ReviewID = review.ID
+			item.Status = domain.ReviewVisible
+			item.CreatedAt = now
+			item.UpdatedAt = now
+
+			_, err := tx.Exec(ctx, itemQuery,
+				item.ID,
+				item.ReviewID,
+				item.OrderItemID,
+				item.MenuItemID,
+				item.Rating,
+				item.Comment,
+				item.PhotoURLs,
+				item.Status,
+				item.CreatedAt,
+				item.UpdatedAt,
+			)
+			if err != nil {
+				if isDuplicateKeyError(err) {
+					return ErrAlreadyReviewed
+				}
+				return fmt.Errorf("failed to insert item review: %w", err)
+			}
+
+			if err := adjustMenuRating(ctx, tx, item.MenuItemID, item.Rating, 1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// adjustMenuRating adds (sign 1) or removes (sign -1) one rating from a menu item's aggregate
+func adjustMenuRating(ctx context.Context, tx pgx.Tx, menuItemID uuid.UUID, rating, sign int) error {
+	query := `
+		UPDATE menu_items
+		SET rating_sum = rating_sum + $2, rating_count = rating_count + $3
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, query, menuItemID, rating*sign, sign); err != nil {
+		return fmt.Errorf("failed to update menu rating: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves a review with its item reviews
+func (r *ReviewRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.OrderReview, error) {
+	query := `SELECT ` + orderReviewColumns + ` FROM order_reviews WHERE id = $1`
+	return r.get(ctx, query, id)
+}
+
+// GetByOrderID retrieves the review of an order with its item reviews
+func (r *ReviewRepository) GetByOrderID(ctx context.Context, orderID uuid.UUID) (*domain.OrderReview, error) {
+	query := `SELECT ` + orderReviewColumns + ` FROM order_reviews WHERE order_id = $1`
+	return r.get(ctx, query, orderID)
+}
+
+func (r *ReviewRepository) get(ctx context.Context, query string, arg uuid.UUID) (*domain.OrderReview, error) {
+	review, err := scanOrderReview(r.db.QueryRow(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get review: %w", err)
+	}
+
+	if err := r.loadItems(ctx, []*domain.OrderReview{review}); err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// loadItems fills the item reviews of the given reviews
+func (r *ReviewRepository) loadItems(ctx context.Context, reviews []*domain.OrderReview) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(reviews))
+	byID := make(map[uuid.UUID]*domain.OrderReview, len(reviews))
+	for i, review := range reviews {
+		ids[i] = review.ID
+		review.Items = []domain.ItemReview{}
+		byID[review.ID] = review
+	}
+
+	query := `
+		SELECT ` + itemReviewColumns + `
+		FROM item_reviews ir
+		WHERE ir.review_id = ANY($1)
+		ORDER BY ir.created_at, ir.id
+	`
+	rows, err := r.db.Query(ctx, query, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query item reviews: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanItemReview(rows, false)
+		if err != nil {
+			return fmt.Errorf("failed to scan item review: %w", err)
+		}
+		review := byID[item.ReviewID]
+		review.Items = append(review.Items, *item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating item reviews: %w", err)
+	}
+
+	return nil
+}
+
+// ListByMenuItem retrieves a page of the shown reviews of a menu item, newest first
+func (r *ReviewRepository) ListByMenuItem(ctx context.Context, menuItemID uuid.UUID, cursor *ReviewCursor, limit int) (*ItemReviewPage, error) {
+	args := []interface{}{menuItemID, limit + 1}
+	cursorCond := ""
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		cursorCond = "AND (ir.created_at, ir.id) < ($3, $4)"
+	}
+
+	query := `
+		SELECT ` + itemReviewColumns + `, u.name
+		FROM item_reviews ir
+		JOIN order_reviews orv ON orv.id = ir.review_id
+		JOIN users u ON u.id = orv.user_id
+		WHERE ir.menu_item_id = $1
+			AND ir.status <> 'HIDDEN' AND orv.status <> 'HIDDEN'
+			` + cursorCond + `
+		ORDER BY ir.created_at DESC, ir.id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query menu item reviews: %w", err)
+	}
+	defer rows.Close()
+
+	page := &ItemReviewPage{Reviews: []domain.ItemReview{}}
+	for rows.Next() {
+		item, err := scanItemReview(rows, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item review: %w", err)
+		}
+		page.Reviews = append(page.Reviews, *item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating item reviews: %w", err)
+	}
+
+	if len(page.Reviews) > limit {
+		page.Reviews = page.Reviews[:limit]
+		last := page.Reviews[limit-1]
+		page.NextCursor = ReviewCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// List retrieves a page of reviews for moderation, newest first.
+// An empty statuses list returns reviews in any state.
+func (r *ReviewRepository) List(ctx context.Context, statuses []domain.ReviewStatus, cursor *ReviewCursor, limit int) (*OrderReviewPage, error) {
+	conds := []string{"TRUE"}
+	args := []interface{}{limit + 1}
+	if len(statuses) > 0 {
+		values := make([]string, len(statuses))
+		for i, status := range statuses {
+			values[i] = string(status)
+		}
+		args = append(args, values)
+		conds = append(conds, fmt.Sprintf("status = ANY($%d::text[]::review_status[])", len(args)))
+	}
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		conds = append(conds, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `
+		SELECT ` + orderReviewColumns + `
+		FROM order_reviews
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []*domain.OrderReview
+	for rows.Next() {
+		review, err := scanOrderReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reviews: %w", err)
+	}
+	rows.Close()
+
+	page := &OrderReviewPage{Reviews: []domain.OrderReview{}}
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+		last := reviews[limit-1]
+		page.NextCursor = ReviewCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	if err := r.loadItems(ctx, reviews); err != nil {
+		return nil, err
+	}
+	for _, review := range reviews {
+		page.Reviews = append(page.Reviews, *review)
+	}
+
+	return page, nil
+}
+
+// Moderation records an admin's decision on a review
+type Moderation struct {
+	Status  domain.ReviewStatus
+	Note    string
+	AdminID uuid.UUID
+}
+
+// counted reports whether an item rating is part of its menu item's aggregate
+func counted(reviewStatus, itemStatus domain.ReviewStatus) bool {
+	return reviewStatus != domain.ReviewHidden && itemStatus != domain.ReviewHidden
+}
+
+// Moderate changes the status of a whole review. Hiding it takes all of its
+// item ratings out of the menu aggregates; showing it again puts back those
+// not hidden on their own.
+func (r *ReviewRepository) Moderate(ctx context.Context, reviewID uuid.UUID, m Moderation) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		var current domain.ReviewStatus
+		err := tx.QueryRow(ctx, `SELECT status FROM order_reviews WHERE id = $1 FOR UPDATE`, reviewID).Scan(&current)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock review: %w", err)
+		}
+
+		query := `
+			UPDATE order_reviews
+			SET status = $2, moderation_note = $3, moderated_by = $4, moderated_at = NOW()
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, reviewID, m.Status, nullableString(m.Note), m.AdminID); err != nil {
+			return fmt.Errorf("failed to moderate review: %w", err)
+		}
+
+		rows, err := tx.Query(ctx, `SELECT menu_item_id, rating, status FROM item_reviews WHERE review_id = $1 FOR UPDATE`, reviewID)
+		if err != nil {
+			return fmt.Errorf("failed to query item reviews: %w", err)
+		}
+		type itemRating struct {
+			menuItemID uuid.UUID
+			rating     int
+			status     domain.ReviewStatus
+		}
+		var items []itemRating
+		for rows.Next() {
+			var item itemRating
+			if err := rows.Scan(&item.menuItemID, &item.rating, &item.status); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan item review: %w", err)
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating item reviews: %w", err)
+		}
+
+		for _, item := range items {
+			before, after := counted(current, item.status), counted(m.Status, item.status)
+			if before == after {
+				continue
+			}
+			sign := 1
+			if before {
+				sign = -1
+			}
+			if err := adjustMenuRating(ctx, tx, item.menuItemID, item.rating, sign); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ModerateItem changes the status of a single item review and updates the
+// menu aggregate if the rating starts or stops counting
+func (r *ReviewRepository) ModerateItem(ctx context.Context, itemReviewID uuid.UUID, m Moderation) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		var menuItemID uuid.UUID
+		var rating int
+		var current, reviewStatus domain.ReviewStatus
+
+		lockQuery := `
+			SELECT ir.menu_item_id, ir.rating, ir.status, orv.status
+			FROM item_reviews ir
+			JOIN order_reviews orv ON orv.id = ir.review_id
+			WHERE ir.id = $1
+			FOR UPDATE OF ir, orv
+		`
+		err := tx.QueryRow(ctx, lockQuery, itemReviewID).Scan(&menuItemID, &rating, &current, &reviewStatus)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock item review: %w", err)
+		}
+
+		query := `
+			UPDATE item_reviews
+			SET status = $2, moderation_note = $3, moderated_by = $4, moderated_at = NOW()
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, itemReviewID, m.Status, nullableString(m.Note), m.AdminID); err != nil {
+			return fmt.Errorf("failed to moderate item review: %w", err)
+		}
+
+		before, after := counted(reviewStatus, current), counted(reviewStatus, m.Status)
+		if before == after {
+			return nil
+		}
+		sign := 1
+		if before {
+			sign = -1
+		}
+		return adjustMenuRating(ctx, tx, menuItemID, rating, sign)
+	})
+}
+
+// scanOrderReview scans a row selected with orderReviewColumns
+func scanOrderReview(row pgx.Row) (*domain.OrderReview, error) {
+	review := &domain.OrderReview{}
+	var moderationNote *string
+
+	err := row.Scan(
+		&review.ID,
+		&review.OrderID,
+		&review.UserID,
+		&review.FoodRating,
+		&review.DeliveryRating,
+		&review.Comment,
+		&review.PhotoURLs,
+		&review.Status,
+		&moderationNote,
+		&review.ModeratedBy,
+		&review.ModeratedAt,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if moderationNote != nil {
+		review.ModerationNote = *moderationNote
+	}
+
+	return review, nil
+}
+
+// scanItemReview scans a row selected with itemReviewColumns, followed by the
+// reviewer's name if withName is set
+func scanItemReview(row pgx.Row, withName bool) (*domain.ItemReview, error) {
+	item := &domain.ItemReview{}
+	var moderationNote *string
+
+	dest := []interface{}{
+		&item.ID,
+		&item.ReviewID,
+		&item.OrderItemID,
+		&item.MenuItemID,
+		&item.Rating,
+		&item.Comment,
+		&item.PhotoURLs,
+		&item.Status,
+		&moderationNote,
+		&item.ModeratedBy,
+		&item.ModeratedAt,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+	}
+	if withName {
+		dest = append(dest, &item.ReviewerName)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	if moderationNote != nil {
+		item.ModerationNote = *moderationNote
+	}
+
+	return item, nil
+}
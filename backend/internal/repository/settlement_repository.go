@@ -0,0 +1,308 @@
+// Package repository implements settlement report storage and reconciliation
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// SettlementRepository stores imported gateway settlement lines and matches
+// them against orders by Razorpay payment ID
+type SettlementRepository struct {
+	db *database.Pool
+}
+
+// NewSettlementRepository creates a new settlement repository
+func NewSettlementRepository(db *database.Pool) *SettlementRepository {
+	return &SettlementRepository{db: db}
+}
+
+// otherPaymentExists is an SQL condition that holds when the Razorpay
+// payment ID in column paid for something other than an order: a table tab,
+// a split bill share, an order edit or a tiffin plan period, or it was
+// refused and refunded because its order sold out
+func otherPaymentExists(column string) string {
+	return `(
+		EXISTS (SELECT 1 FROM table_sessions t WHERE t.razorpay_payment_id = ` + column + `)
+		OR EXISTS (SELECT 1 FROM bill_shares b WHERE b.razorpay_payment_id = ` + column + `)
+		OR EXISTS (SELECT 1 FROM order_modifications m WHERE m.razorpay_payment_id = ` + column + `)
+		OR EXISTS (SELECT 1 FROM subscription_periods p WHERE p.razorpay_payment_id = ` + column + `)
+		OR EXISTS (SELECT 1 FROM refunds r WHERE r.source = '` + domain.RefundSourceOutOfStock + `' AND r.razorpay_payment_id = ` + column + `)
+	)`
+}
+
+// Import stores the lines of one settlement report. Lines already imported
+// from an earlier report are updated, so overlapping reports can be imported
+// again. Sets imp.ID, imp.New and imp.CreatedAt.
+func (r *SettlementRepository) Import(ctx context.Context, imp *domain.SettlementImport, lines []domain.SettlementLine) error {
+	imp.ID = uuid.New()
+	imp.CreatedAt = time.Now()
+	imp.New = 0
+
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO settlement_imports (id, file_name, imported_by, lines, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, imp.ID, imp.FileName, imp.ImportedBy, imp.Lines, imp.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert settlement import: %w", err)
+		}
+
+		query := `
+			INSERT INTO settlement_lines (entity_id, type, payment_id, razorpay_order_id, amount, fee, tax, net,
+				settlement_id, settlement_utr, settled_at, import_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (entity_id) DO UPDATE SET
+				type = EXCLUDED.type,
+				payment_id = EXCLUDED.payment_id,
+				razorpay_order_id = EXCLUDED.razorpay_order_id,
+				amount = EXCLUDED.amount,
+				fee = EXCLUDED.fee,
+				tax = EXCLUDED.tax,
+				net = EXCLUDED.net,
+				settlement_id = EXCLUDED.settlement_id,
+				settlement_utr = EXCLUDED.settlement_utr,
+				settled_at = EXCLUDED.settled_at,
+				import_id = EXCLUDED.import_id
+			RETURNING xmax = 0
+		`
+
+		for i := range lines {
+			l := &lines[i]
+			var inserted bool
+			err := tx.QueryRow(ctx, query,
+				l.EntityID,
+				l.Type,
+				l.PaymentID,
+				l.RazorpayOrderID,
+				l.Amount,
+				l.Fee,
+				l.Tax,
+				l.Net,
+				l.SettlementID,
+				l.SettlementUTR,
+				l.SettledAt,
+				imp.ID,
+			).Scan(&inserted)
+			if err != nil {
+				return fmt.Errorf("failed to store settlement line %s: %w", l.EntityID, err)
+			}
+			if inserted {
+				imp.New++
+			}
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE settlement_imports SET new_lines = $2 WHERE id = $1`, imp.ID, imp.New); err != nil {
+			return fmt.Errorf("failed to update settlement import: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetReconciliation compares the orders paid in [from, to) with the
+// settlement lines settled in it. Orders paid before settleBy that have no
+// settlement are missing; later ones are pending. Lists hold at most limit
+// entries each, oldest first.
+func (r *SettlementRepository) GetReconciliation(ctx context.Context, from, to, settleBy time.Time, limit int) (*domain.ReconciliationReport, error) {
+	report := &domain.ReconciliationReport{From: from, To: to}
+
+	err := r.db.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE type = 'payment'),
+			COALESCE(SUM(amount) FILTER (WHERE type = 'payment'), 0),
+			COALESCE(SUM(fee), 0),
+			COALESCE(SUM(tax), 0),
+			COALESCE(SUM(-net) FILTER (WHERE type = 'refund'), 0),
+			COALESCE(SUM(net) FILTER (WHERE type NOT IN ('payment', 'refund')), 0),
+			COALESCE(SUM(net), 0)
+		FROM settlement_lines
+		WHERE settled_at >= $1 AND settled_at < $2
+	`, from, to).Scan(
+		&report.SettledPayments,
+		&report.SettledAmount,
+		&report.Fees,
+		&report.Tax,
+		&report.Refunds,
+		&report.Adjustments,
+		&report.Net,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum settlements: %w", err)
+	}
+
+	// An edited order's payment captured its first revision's total; edits
+	// are paid and refunded separately
+	paidOrders := `
+		FROM orders o
+		LEFT JOIN order_revisions r1 ON r1.order_id = o.id AND r1.revision = 1
+		LEFT JOIN settlement_lines l ON l.type = 'payment' AND l.payment_id = o.razorpay_payment_id
+		WHERE o.paid_at >= $1 AND o.paid_at < $2 AND o.razorpay_payment_id IS NOT NULL
+	`
+
+	err = r.db.QueryRow(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(l.entity_id),
+			COUNT(*) FILTER (WHERE l.entity_id IS NULL AND o.paid_at >= $3),
+			COUNT(*) FILTER (WHERE l.entity_id IS NULL AND o.paid_at < $3),
+			COUNT(*) FILTER (WHERE l.amount <> COALESCE(r1.total_amount, o.total_amount))
+	`+paidOrders, from, to, settleBy).Scan(
+		&report.PaidOrders,
+		&report.SettledOrders,
+		&report.PendingOrders,
+		&report.MissingCount,
+		&report.MismatchCount,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count settled orders: %w", err)
+	}
+
+	err = r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE NOT other), COUNT(*) FILTER (WHERE other)
+		FROM (
+			SELECT `+otherPaymentExists("l.payment_id")+` AS other
+			FROM settlement_lines l
+			WHERE l.type = 'payment' AND l.settled_at >= $1 AND l.settled_at < $2
+				AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.razorpay_payment_id = l.payment_id)
+		) unmatched
+	`, from, to).Scan(&report.UnmatchedCount, &report.OtherPayments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unmatched settlements: %w", err)
+	}
+
+	if report.MissingSettlements, err = r.getUnsettledOrders(ctx, paidOrders, from, to, settleBy, limit); err != nil {
+		return nil, err
+	}
+	if report.AmountMismatches, err = r.getMismatches(ctx, paidOrders, from, to, limit); err != nil {
+		return nil, err
+	}
+	if report.UnmatchedPayments, err = r.getUnmatchedLines(ctx, from, to, limit); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (r *SettlementRepository) getUnsettledOrders(ctx context.Context, paidOrders string, from, to, settleBy time.Time, limit int) ([]domain.UnsettledOrder, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT o.id, o.razorpay_payment_id, o.total_amount, o.paid_at
+	`+paidOrders+`
+			AND l.entity_id IS NULL AND o.paid_at < $3
+		ORDER BY o.paid_at
+		LIMIT $4
+	`, from, to, settleBy, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unsettled orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []domain.UnsettledOrder{}
+	for rows.Next() {
+		var o domain.UnsettledOrder
+		if err := rows.Scan(&o.OrderID, &o.RazorpayPaymentID, &o.TotalAmount, &o.PaidAt); err != nil {
+			return nil, fmt.Errorf("failed to scan unsettled order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unsettled orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (r *SettlementRepository) getMismatches(ctx context.Context, paidOrders string, from, to time.Time, limit int) ([]domain.SettlementMismatch, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT o.id, o.razorpay_payment_id, COALESCE(r1.total_amount, o.total_amount), l.amount, l.fee, l.tax, l.settlement_id, l.settled_at
+	`+paidOrders+`
+			AND l.amount <> COALESCE(r1.total_amount, o.total_amount)
+		ORDER BY o.paid_at
+		LIMIT $3
+	`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settlement mismatches: %w", err)
+	}
+	defer rows.Close()
+
+	mismatches := []domain.SettlementMismatch{}
+	for rows.Next() {
+		var m domain.SettlementMismatch
+		err := rows.Scan(
+			&m.OrderID,
+			&m.RazorpayPaymentID,
+			&m.OrderAmount,
+			&m.SettledAmount,
+			&m.Fee,
+			&m.Tax,
+			&m.SettlementID,
+			&m.SettledAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan settlement mismatch: %w", err)
+		}
+		m.Difference = m.SettledAmount - m.OrderAmount
+		mismatches = append(mismatches, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating settlement mismatches: %w", err)
+	}
+
+	return mismatches, nil
+}
+
+// getUnmatchedLines lists settled payments that match no order and no other
+// kind of payment
+func (r *SettlementRepository) getUnmatchedLines(ctx context.Context, from, to time.Time, limit int) ([]domain.SettlementLine, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT l.entity_id, l.type, l.payment_id, l.razorpay_order_id, l.amount, l.fee, l.tax, l.net,
+			l.settlement_id, l.settlement_utr, l.settled_at
+		FROM settlement_lines l
+		WHERE l.type = 'payment' AND l.settled_at >= $1 AND l.settled_at < $2
+			AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.razorpay_payment_id = l.payment_id)
+			AND NOT `+otherPaymentExists("l.payment_id")+`
+		ORDER BY l.settled_at, l.entity_id
+		LIMIT $3
+	`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unmatched settlements: %w", err)
+	}
+	defer rows.Close()
+
+	lines := []domain.SettlementLine{}
+	for rows.Next() {
+		var l domain.SettlementLine
+		err := rows.Scan(
+			&l.EntityID,
+			&l.Type,
+			&l.PaymentID,
+			&l.RazorpayOrderID,
+			&l.Amount,
+			&l.Fee,
+			&l.Tax,
+			&l.Net,
+			&l.SettlementID,
+			&l.SettlementUTR,
+			&l.SettledAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan settlement line: %w", err)
+		}
+		lines = append(lines, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unmatched settlements: %w", err)
+	}
+
+	return lines, nil
+}
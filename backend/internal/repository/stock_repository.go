@@ -0,0 +1,685 @@
+// Package repository implements daily stock counts and the stock orders take
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// ErrOutOfStock is returned when an order wants more plates of an item than
+// are left today
+var ErrOutOfStock = errors.New("not enough stock left")
+
+// StockRepository handles daily stock counts. Orders take and give back
+// stock through the package functions below, inside their own transactions.
+type StockRepository struct {
+	db *database.Pool
+}
+
+// NewStockRepository creates a new stock repository
+func NewStockRepository(db *database.Pool) *StockRepository {
+	return &StockRepository{db: db}
+}
+
+// reserveStock takes the plates a new order needs from the counted items,
+// inside the caller's transaction, and records them against the order with
+// the given status. Rows are locked in menu item order so concurrent orders
+// cannot deadlock. Callers run it under READ COMMITTED rather than
+// Serializable: an order waiting for the last plate re-checks the count once
+// the first commits, so it gets ErrOutOfStock instead of a serialization
+// failure or an oversell.
+func reserveStock(ctx context.Context, q database.Querier, orderID uuid.UUID, items []domain.OrderItem, status domain.StockReservationStatus) error {
+	quantities := domain.StockQuantities(items)
+	ids := make([]uuid.UUID, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT menu_item_id FROM menu_item_stock WHERE menu_item_id = ANY($1) ORDER BY menu_item_id
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query stock: %w", err)
+	}
+	var counted []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stock: %w", err)
+		}
+		counted = append(counted, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating stock: %w", err)
+	}
+
+	for _, id := range counted {
+		var remaining int
+		err := q.QueryRow(ctx, `
+			UPDATE menu_item_stock SET remaining = remaining - $2
+			WHERE menu_item_id = $1 AND remaining >= $2
+			RETURNING remaining
+		`, id, quantities[id]).Scan(&remaining)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrOutOfStock
+			}
+			return fmt.Errorf("failed to reserve stock: %w", err)
+		}
+
+		_, err = q.Exec(ctx, `
+			INSERT INTO stock_reservations (id, order_id, menu_item_id, quantity, status)
+			VALUES ($1, $2, $3, $4, $5)
+		`, uuid.New(), orderID, id, quantities[id], status)
+		if err != nil {
+			return fmt.Errorf("failed to insert stock reservation: %w", err)
+		}
+
+		if err := syncAvailability(ctx, q, id, remaining); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitStock marks the stock held by an order as sold once it is paid,
+// inside the caller's transaction, which must hold the order's row lock.
+// Stock given back after a failed or abandoned payment is taken again; if
+// an item no longer has enough left, nothing is changed and ErrOutOfStock is
+// returned, so the count never goes below zero.
+func commitStock(ctx context.Context, q database.Querier, orderID uuid.UUID) error {
+	type released struct {
+		id         uuid.UUID
+		menuItemID uuid.UUID
+		quantity   int
+		counted    bool
+	}
+	rows, err := q.Query(ctx, `
+		SELECT id, menu_item_id, quantity FROM stock_reservations
+		WHERE order_id = $1 AND status = $2
+		ORDER BY menu_item_id
+	`, orderID, domain.StockReleased)
+	if err != nil {
+		return fmt.Errorf("failed to query released stock: %w", err)
+	}
+	var retake []released
+	for rows.Next() {
+		var r released
+		if err := rows.Scan(&r.id, &r.menuItemID, &r.quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan released stock: %w", err)
+		}
+		retake = append(retake, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating released stock: %w", err)
+	}
+
+	// Lock every count first, in menu item order, and check them all before
+	// taking any stock
+	for i := range retake {
+		var remaining int
+		err := q.QueryRow(ctx, `
+			SELECT remaining FROM menu_item_stock WHERE menu_item_id = $1 FOR UPDATE
+		`, retake[i].menuItemID).Scan(&remaining)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue // No longer counted
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock stock: %w", err)
+		}
+		if remaining < retake[i].quantity {
+			return ErrOutOfStock
+		}
+		retake[i].counted = true
+	}
+
+	_, err = q.Exec(ctx, `
+		UPDATE stock_reservations SET status = $2 WHERE order_id = $1 AND status IN ($3, $4)
+	`, orderID, domain.StockCommitted, domain.StockReserved, domain.StockReleased)
+	if err != nil {
+		return fmt.Errorf("failed to commit stock: %w", err)
+	}
+
+	for _, r := range retake {
+		if !r.counted {
+			continue
+		}
+
+		var remaining int
+		err := q.QueryRow(ctx, `
+			UPDATE menu_item_stock SET remaining = remaining - $2
+			WHERE menu_item_id = $1
+			RETURNING remaining
+		`, r.menuItemID, r.quantity).Scan(&remaining)
+		if err != nil {
+			return fmt.Errorf("failed to retake stock: %w", err)
+		}
+		if err := syncAvailability(ctx, q, r.menuItemID, remaining); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refuseOrderPayment records, inside the caller's transaction, that an
+// order's payment arrived after the stock it had given back was sold. The
+// order is marked PAYMENT_FAILED so it is never cooked, and a captured
+// payment is queued for a full refund.
+func refuseOrderPayment(ctx context.Context, q database.Querier, orderID uuid.UUID, paymentID string) error {
+	var status domain.OrderStatus
+	var userID uuid.UUID
+	var total int64
+	err := q.QueryRow(ctx, `
+		SELECT status, user_id, total_amount FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&status, &userID, &total)
+	if err != nil {
+		return fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	if status != domain.OrderStatusPaymentFailed {
+		_, err := q.Exec(ctx, `
+			UPDATE orders SET status = $2, version = version + 1, updated_at = NOW() WHERE id = $1
+		`, orderID, domain.OrderStatusPaymentFailed)
+		if err != nil {
+			return fmt.Errorf("failed to refuse order payment: %w", err)
+		}
+		if err := insertStatusChanged(ctx, q, orderID, userID, status, domain.OrderStatusPaymentFailed); err != nil {
+			return err
+		}
+	}
+
+	if paymentID == "" {
+		return nil
+	}
+
+	return insertRefund(ctx, q, &domain.Refund{
+		OrderID:           &orderID,
+		Source:            domain.RefundSourceOutOfStock,
+		SourceID:          orderID,
+		RazorpayPaymentID: paymentID,
+		Amount:            total,
+		Reason:            "sold out before the payment arrived",
+	})
+}
+
+// releaseStock gives back the stock held by an unpaid order, inside the
+// caller's transaction. Stock reserved before the last daily reset is not
+// given back, since the reset already restored the count.
+func releaseStock(ctx context.Context, q database.Querier, orderID uuid.UUID) error {
+	type held struct {
+		menuItemID uuid.UUID
+		quantity   int
+		createdAt  time.Time
+	}
+	rows, err := q.Query(ctx, `
+		UPDATE stock_reservations SET status = $2
+		WHERE order_id = $1 AND status = $3
+		RETURNING menu_item_id, quantity, created_at
+	`, orderID, domain.StockReleased, domain.StockReserved)
+	if err != nil {
+		return fmt.Errorf("failed to release stock: %w", err)
+	}
+	var released []held
+	for rows.Next() {
+		var h held
+		if err := rows.Scan(&h.menuItemID, &h.quantity, &h.createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan released stock: %w", err)
+		}
+		released = append(released, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to release stock: %w", err)
+	}
+
+	// Same lock order as reserveStock
+	sort.Slice(released, func(i, j int) bool {
+		return released[i].menuItemID.String() < released[j].menuItemID.String()
+	})
+
+	for _, h := range released {
+		var remaining int
+		err := q.QueryRow(ctx, `
+			UPDATE menu_item_stock SET remaining = remaining + $2
+			WHERE menu_item_id = $1 AND reset_at <= $3
+			RETURNING remaining
+		`, h.menuItemID, h.quantity, h.createdAt).Scan(&remaining)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore stock: %w", err)
+		}
+
+		if err := syncAvailability(ctx, q, h.menuItemID, remaining); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adjustStock brings the stock sold to a paid order in line with its edited
+// lines, inside the caller's transaction. Extra plates are taken from the
+// counts and plates no longer ordered are given back, unless they were sold
+// before the last daily reset. If an item does not have enough left, nothing
+// is changed and ErrOutOfStock is returned.
+func adjustStock(ctx context.Context, q database.Querier, orderID uuid.UUID, items []domain.OrderItem) error {
+	type sold struct {
+		quantity  int
+		createdAt time.Time
+	}
+	rows, err := q.Query(ctx, `
+		SELECT menu_item_id, quantity, created_at FROM stock_reservations
+		WHERE order_id = $1 AND status = $2
+	`, orderID, domain.StockCommitted)
+	if err != nil {
+		return fmt.Errorf("failed to query sold stock: %w", err)
+	}
+	held := make(map[uuid.UUID]sold)
+	for rows.Next() {
+		var id uuid.UUID
+		var s sold
+		if err := rows.Scan(&id, &s.quantity, &s.createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan sold stock: %w", err)
+		}
+		held[id] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating sold stock: %w", err)
+	}
+
+	quantities := domain.StockQuantities(items)
+	var changed []uuid.UUID
+	for id, quantity := range quantities {
+		if quantity != held[id].quantity {
+			changed = append(changed, id)
+		}
+	}
+	for id := range held {
+		if _, ok := quantities[id]; !ok {
+			changed = append(changed, id)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	// Lock every changed count first, in the same order as reserveStock, and
+	// check them all before changing any, so a refused edit leaves no trace
+	rows, err = q.Query(ctx, `
+		SELECT menu_item_id, remaining, reset_at FROM menu_item_stock
+		WHERE menu_item_id = ANY($1)
+		ORDER BY menu_item_id
+		FOR UPDATE
+	`, changed)
+	if err != nil {
+		return fmt.Errorf("failed to lock stock: %w", err)
+	}
+	type adjustment struct {
+		menuItemID uuid.UUID
+		diff       int  // Plates to take, or to give back if negative
+		apply      bool // Changes today's count
+	}
+	var adjustments []adjustment
+	for rows.Next() {
+		var a adjustment
+		var remaining int
+		var resetAt time.Time
+		if err := rows.Scan(&a.menuItemID, &remaining, &resetAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stock: %w", err)
+		}
+		a.diff = quantities[a.menuItemID] - held[a.menuItemID].quantity
+		if a.diff > remaining {
+			rows.Close()
+			return ErrOutOfStock
+		}
+		// Plates sold before the last reset were already restored by it
+		a.apply = a.diff > 0 || !resetAt.After(held[a.menuItemID].createdAt)
+		adjustments = append(adjustments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating stock: %w", err)
+	}
+
+	for _, a := range adjustments {
+		quantity := quantities[a.menuItemID]
+		switch {
+		case quantity == 0:
+			_, err = q.Exec(ctx, `DELETE FROM stock_reservations WHERE order_id = $1 AND menu_item_id = $2`, orderID, a.menuItemID)
+		case held[a.menuItemID].quantity > 0:
+			_, err = q.Exec(ctx, `
+				UPDATE stock_reservations SET quantity = $3 WHERE order_id = $1 AND menu_item_id = $2
+			`, orderID, a.menuItemID, quantity)
+		default:
+			_, err = q.Exec(ctx, `
+				INSERT INTO stock_reservations (id, order_id, menu_item_id, quantity, status)
+				VALUES ($1, $2, $3, $4, $5)
+			`, uuid.New(), orderID, a.menuItemID, quantity, domain.StockCommitted)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update stock reservation: %w", err)
+		}
+
+		if !a.apply {
+			continue
+		}
+
+		var remaining int
+		err := q.QueryRow(ctx, `
+			UPDATE menu_item_stock SET remaining = remaining - $2
+			WHERE menu_item_id = $1
+			RETURNING remaining
+		`, a.menuItemID, a.diff).Scan(&remaining)
+		if err != nil {
+			return fmt.Errorf("failed to adjust stock: %w", err)
+		}
+		if err := syncAvailability(ctx, q, a.menuItemID, remaining); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncAvailability makes a counted item unavailable when it runs out and
+// available again when stock comes back, unless it was switched off by hand.
+// Each switch writes MenuAvailabilityChanged so the menu cache is dropped.
+func syncAvailability(ctx context.Context, q database.Querier, menuItemID uuid.UUID, remaining int) error {
+	query := `
+		WITH item AS (
+			UPDATE menu_items SET is_available = FALSE
+			WHERE id = $1 AND is_available
+			RETURNING id
+		)
+		UPDATE menu_item_stock s SET sold_out = TRUE
+		FROM item WHERE s.menu_item_id = item.id
+		RETURNING s.menu_item_id
+	`
+	if remaining > 0 {
+		query = `
+			WITH stock AS (
+				UPDATE menu_item_stock SET sold_out = FALSE
+				WHERE menu_item_id = $1 AND sold_out
+				RETURNING menu_item_id
+			)
+			UPDATE menu_items m SET is_available = TRUE
+			FROM stock WHERE m.id = stock.menu_item_id
+			RETURNING m.id
+		`
+	}
+
+	var id uuid.UUID
+	err := q.QueryRow(ctx, query, menuItemID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update availability: %w", err)
+	}
+
+	return insertEvent(ctx, q, domain.EventMenuAvailabilityChanged, menuItemID, domain.MenuAvailabilityChangedEvent{
+		MenuItemID:  menuItemID,
+		IsAvailable: remaining > 0,
+		Remaining:   remaining,
+	})
+}
+
+// stockColumns selects a stock count in scanStock order, for stock s joined
+// to menu items m
+const stockColumns = `s.menu_item_id, m.name, s.daily_stock, s.remaining,
+	COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.menu_item_id = s.menu_item_id AND r.status = 'RESERVED'), 0),
+	s.sold_out, m.is_available, s.reset_at, s.updated_at`
+
+// scanStock scans a row selected with stockColumns
+func scanStock(row pgx.Row) (*domain.MenuItemStock, error) {
+	stock := &domain.MenuItemStock{}
+	err := row.Scan(
+		&stock.MenuItemID,
+		&stock.Name,
+		&stock.DailyStock,
+		&stock.Remaining,
+		&stock.Reserved,
+		&stock.SoldOut,
+		&stock.IsAvailable,
+		&stock.ResetAt,
+		&stock.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+// List returns the stock counts of every counted item, by name
+func (r *StockRepository) List(ctx context.Context) ([]domain.MenuItemStock, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+stockColumns+`
+		FROM menu_item_stock s
+		JOIN menu_items m ON m.id = s.menu_item_id
+		ORDER BY m.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stock: %w", err)
+	}
+	defer rows.Close()
+
+	stocks := []domain.MenuItemStock{}
+	for rows.Next() {
+		stock, err := scanStock(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stock: %w", err)
+		}
+		stocks = append(stocks, *stock)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock: %w", err)
+	}
+
+	return stocks, nil
+}
+
+// Set starts counting a menu item or changes its daily stock. remaining sets
+// today's count; when nil a new count starts full and an existing one keeps
+// what is left, capped at the new daily stock. Returns ErrNotFound if the
+// item does not exist.
+func (r *StockRepository) Set(ctx context.Context, menuItemID uuid.UUID, dailyStock int, remaining *int) (*domain.MenuItemStock, error) {
+	var stock *domain.MenuItemStock
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		var left int
+		err := tx.QueryRow(ctx, `
+			INSERT INTO menu_item_stock (menu_item_id, daily_stock, remaining)
+			SELECT id, $2, COALESCE($3, $2) FROM menu_items WHERE id = $1
+			ON CONFLICT (menu_item_id) DO UPDATE
+			SET daily_stock = EXCLUDED.daily_stock,
+				remaining = COALESCE($3, LEAST(menu_item_stock.remaining, EXCLUDED.daily_stock))
+			RETURNING remaining
+		`, menuItemID, dailyStock, remaining).Scan(&left)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to set stock: %w", err)
+		}
+
+		if err := syncAvailability(ctx, tx, menuItemID, left); err != nil {
+			return err
+		}
+
+		stock, err = scanStock(tx.QueryRow(ctx, `
+			SELECT `+stockColumns+`
+			FROM menu_item_stock s
+			JOIN menu_items m ON m.id = s.menu_item_id
+			WHERE s.menu_item_id = $1
+		`, menuItemID))
+		if err != nil {
+			return fmt.Errorf("failed to load stock: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stock, nil
+}
+
+// Delete stops counting a menu item. An item that had sold out is made
+// available again.
+func (r *StockRepository) Delete(ctx context.Context, menuItemID uuid.UUID) error {
+	return r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		var soldOut bool
+		err := tx.QueryRow(ctx, `
+			DELETE FROM menu_item_stock WHERE menu_item_id = $1 RETURNING sold_out
+		`, menuItemID).Scan(&soldOut)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to delete stock: %w", err)
+		}
+		if !soldOut {
+			return nil
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE menu_items SET is_available = TRUE WHERE id = $1`, menuItemID); err != nil {
+			return fmt.Errorf("failed to update availability: %w", err)
+		}
+
+		return insertEvent(ctx, tx, domain.EventMenuAvailabilityChanged, menuItemID, domain.MenuAvailabilityChangedEvent{
+			MenuItemID:  menuItemID,
+			IsAvailable: true,
+		})
+	})
+}
+
+// ResetDaily fills every count back up to its daily stock for the business
+// day and makes items that had sold out available again. Returns ErrNotFound
+// if the day was already reset, so only one instance resets each day.
+// Returns how many counts were reset.
+func (r *StockRepository) ResetDaily(ctx context.Context, day time.Time) (int, error) {
+	var reset int
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			INSERT INTO stock_resets (reset_date) VALUES ($1) ON CONFLICT DO NOTHING
+		`, day)
+		if err != nil {
+			return fmt.Errorf("failed to claim stock reset: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		type count struct {
+			menuItemID uuid.UUID
+			remaining  int
+		}
+		rows, err := tx.Query(ctx, `
+			UPDATE menu_item_stock SET remaining = daily_stock, reset_at = NOW()
+			RETURNING menu_item_id, remaining
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to reset stock: %w", err)
+		}
+		var counts []count
+		for rows.Next() {
+			var c count
+			if err := rows.Scan(&c.menuItemID, &c.remaining); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan reset stock: %w", err)
+			}
+			counts = append(counts, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to reset stock: %w", err)
+		}
+
+		for _, c := range counts {
+			if err := syncAvailability(ctx, tx, c.menuItemID, c.remaining); err != nil {
+				return err
+			}
+		}
+		reset = len(counts)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return reset, nil
+}
+
+// ReleaseExpired gives back the stock of orders still unpaid after reserving
+// it before heldBefore, at most limit orders per call. The orders stay open:
+// a payment that arrives later takes the stock again if any is left, or is
+// refused and refunded in full.
+// Returns how many orders had their stock released.
+func (r *StockRepository) ReleaseExpired(ctx context.Context, heldBefore time.Time, limit int) (int, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT DISTINCT order_id FROM stock_reservations
+		WHERE status = 'RESERVED' AND created_at < $1
+		LIMIT $2
+	`, heldBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired stock: %w", err)
+	}
+	var orderIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired stock: %w", err)
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating expired stock: %w", err)
+	}
+
+	released := 0
+	for _, orderID := range orderIDs {
+		err := r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+			// Locking the order waits out a payment being recorded for it
+			var paid bool
+			err := tx.QueryRow(ctx, `
+				SELECT paid_at IS NOT NULL FROM orders WHERE id = $1 FOR UPDATE
+			`, orderID).Scan(&paid)
+			if err != nil || paid {
+				return err
+			}
+			return releaseStock(ctx, tx, orderID)
+		})
+		if err != nil {
+			return released, fmt.Errorf("failed to release stock of order %s: %w", orderID, err)
+		}
+		released++
+	}
+
+	return released, nil
+}
@@ -0,0 +1,1001 @@
+// Package repository implements tiffin plan and subscription data access
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// Subscription errors
+var (
+	ErrSubscriptionClosed = errors.New("subscription has been cancelled")
+	ErrNotDue             = errors.New("subscription is not due on this day")
+	ErrPeriodNotPending   = errors.New("billing period is no longer awaiting payment")
+)
+
+// SubscriptionRepository handles meal plans, subscriptions, their billing
+// periods and the daily orders materialised for them
+type SubscriptionRepository struct {
+	db *database.Pool
+}
+
+// NewSubscriptionRepository creates a new subscription repository
+func NewSubscriptionRepository(db *database.Pool) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+// ============================================================================
+// MEAL PLANS
+// ============================================================================
+
+// CreatePlan inserts a meal plan with its weekday menus
+func (r *SubscriptionRepository) CreatePlan(ctx context.Context, plan *domain.MealPlan) error {
+	now := time.Now()
+	plan.ID = uuid.New()
+	plan.CreatedAt = now
+	plan.UpdatedAt = now
+
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			INSERT INTO meal_plans (id, name, description, meals, price, is_active, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+		_, err := tx.Exec(ctx, query,
+			plan.ID,
+			plan.Name,
+			plan.Description,
+			plan.Meals,
+			plan.Price,
+			plan.IsActive,
+			plan.CreatedAt,
+			plan.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert meal plan: %w", err)
+		}
+
+		return insertPlanDays(ctx, tx, plan)
+	})
+}
+
+// UpdatePlan replaces a meal plan's details and weekday menus
+func (r *SubscriptionRepository) UpdatePlan(ctx context.Context, plan *domain.MealPlan) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			UPDATE meal_plans
+			SET name = $2, description = $3, meals = $4, price = $5, is_active = $6
+			WHERE id = $1
+			RETURNING created_at, updated_at
+		`
+		err := tx.QueryRow(ctx, query,
+			plan.ID,
+			plan.Name,
+			plan.Description,
+			plan.Meals,
+			plan.Price,
+			plan.IsActive,
+		).Scan(&plan.CreatedAt, &plan.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to update meal plan: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM meal_plan_days WHERE plan_id = $1`, plan.ID); err != nil {
+			return fmt.Errorf("failed to clear meal plan days: %w", err)
+		}
+
+		return insertPlanDays(ctx, tx, plan)
+	})
+}
+
+func insertPlanDays(ctx context.Context, q database.Querier, plan *domain.MealPlan) error {
+	query := `
+		INSERT INTO meal_plan_days (plan_id, weekday, items)
+		VALUES ($1, $2, $3)
+	`
+
+	for _, day := range plan.Days {
+		items, err := json.Marshal(day.Items)
+		if err != nil {
+			return fmt.Errorf("failed to encode meal plan items: %w", err)
+		}
+		if _, err := q.Exec(ctx, query, plan.ID, int(day.Weekday), items); err != nil {
+			return fmt.Errorf("failed to insert meal plan day: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetPlan retrieves a meal plan with its weekday menus
+func (r *SubscriptionRepository) GetPlan(ctx context.Context, id uuid.UUID) (*domain.MealPlan, error) {
+	query := `
+		SELECT id, name, description, meals, price, is_active, created_at, updated_at
+		FROM meal_plans
+		WHERE id = $1
+	`
+
+	rows, err := r.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meal plan: %w", err)
+	}
+
+	plans, err := r.collectPlans(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &plans[0], nil
+}
+
+// ListPlans retrieves meal plans by name, optionally only those open for subscription
+func (r *SubscriptionRepository) ListPlans(ctx context.Context, activeOnly bool) ([]domain.MealPlan, error) {
+	query := `
+		SELECT id, name, description, meals, price, is_active, created_at, updated_at
+		FROM meal_plans
+		WHERE is_active OR NOT $1
+		ORDER BY name
+	`
+
+	rows, err := r.db.Query(ctx, query, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query meal plans: %w", err)
+	}
+
+	return r.collectPlans(ctx, rows)
+}
+
+// collectPlans scans and closes a result set of plans, then loads their days
+func (r *SubscriptionRepository) collectPlans(ctx context.Context, rows pgx.Rows) ([]domain.MealPlan, error) {
+	plans := []domain.MealPlan{}
+	index := make(map[uuid.UUID]int)
+
+	for rows.Next() {
+		var plan domain.MealPlan
+		err := rows.Scan(
+			&plan.ID,
+			&plan.Name,
+			&plan.Description,
+			&plan.Meals,
+			&plan.Price,
+			&plan.IsActive,
+			&plan.CreatedAt,
+			&plan.UpdatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan meal plan: %w", err)
+		}
+		plan.Days = []domain.MealPlanDay{}
+		index[plan.ID] = len(plans)
+		plans = append(plans, plan)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating meal plans: %w", err)
+	}
+
+	if len(plans) == 0 {
+		return plans, nil
+	}
+
+	ids := make([]uuid.UUID, len(plans))
+	for i := range plans {
+		ids[i] = plans[i].ID
+	}
+
+	dayRows, err := r.db.Query(ctx, `
+		SELECT plan_id, weekday, items
+		FROM meal_plan_days
+		WHERE plan_id = ANY($1)
+		ORDER BY plan_id, weekday
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query meal plan days: %w", err)
+	}
+	defer dayRows.Close()
+
+	for dayRows.Next() {
+		var planID uuid.UUID
+		var weekday int
+		var items []byte
+		if err := dayRows.Scan(&planID, &weekday, &items); err != nil {
+			return nil, fmt.Errorf("failed to scan meal plan day: %w", err)
+		}
+
+		day := domain.MealPlanDay{Weekday: time.Weekday(weekday)}
+		if err := json.Unmarshal(items, &day.Items); err != nil {
+			return nil, fmt.Errorf("failed to decode meal plan items: %w", err)
+		}
+
+		i := index[planID]
+		plans[i].Days = append(plans[i].Days, day)
+	}
+
+	if err := dayRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating meal plan days: %w", err)
+	}
+
+	return plans, nil
+}
+
+// ============================================================================
+// SUBSCRIPTIONS
+// ============================================================================
+
+// subscriptionColumns is the column list scanned by scanSubscription;
+// meals_left counts the paid meals not yet delivered
+const subscriptionColumns = `s.id, s.user_id, s.plan_id, p.name, s.status, s.start_date, s.paused_from, s.paused_until,
+	s.delivery_address, s.notes, s.version, s.created_at, s.updated_at, s.cancelled_at,
+	(SELECT COALESCE(SUM(sp.meals - sp.meals_used), 0) FROM subscription_periods sp
+	 WHERE sp.subscription_id = s.id AND sp.status = 'PAID')`
+
+// subscriptionFrom joins the plan name for subscriptionColumns
+const subscriptionFrom = `
+	FROM subscriptions s
+	JOIN meal_plans p ON p.id = s.plan_id
+`
+
+// Create inserts a subscription awaiting payment together with its first
+// billing period
+func (r *SubscriptionRepository) Create(ctx context.Context, sub *domain.Subscription, startDate time.Time, period *domain.SubscriptionPeriod) error {
+	now := time.Now()
+	sub.ID = uuid.New()
+	sub.Status = domain.SubscriptionPendingPayment
+	sub.Version = 1
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			INSERT INTO subscriptions (id, user_id, plan_id, status, start_date, delivery_address, notes,
+				version, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		_, err := tx.Exec(ctx, query,
+			sub.ID,
+			sub.UserID,
+			sub.PlanID,
+			sub.Status,
+			startDate,
+			sub.DeliveryAddress,
+			sub.Notes,
+			sub.Version,
+			sub.CreatedAt,
+			sub.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert subscription: %w", err)
+		}
+
+		period.SubscriptionID = sub.ID
+		period.Number = 1
+		return insertPeriod(ctx, tx, period)
+	})
+}
+
+// GetByID retrieves a subscription
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + subscriptionFrom + `WHERE s.id = $1`
+
+	sub, err := scanSubscription(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// GetByUserID retrieves a customer's subscriptions, newest first
+func (r *SubscriptionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + subscriptionFrom + `
+		WHERE s.user_id = $1
+		ORDER BY s.created_at DESC
+		LIMIT 50
+	`
+
+	return r.list(ctx, query, userID)
+}
+
+// GetByStatuses retrieves subscriptions in any of the given statuses (admin)
+func (r *SubscriptionRepository) GetByStatuses(ctx context.Context, statuses []domain.SubscriptionStatus) ([]domain.Subscription, error) {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	query := `SELECT ` + subscriptionColumns + subscriptionFrom + `
+		WHERE s.status = ANY($1::text[]::subscription_status[])
+		ORDER BY s.created_at DESC
+		LIMIT 500
+	`
+
+	return r.list(ctx, query, names)
+}
+
+func (r *SubscriptionRepository) list(ctx context.Context, query string, arg interface{}) ([]domain.Subscription, error) {
+	rows, err := r.db.Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []domain.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		subs = append(subs, *sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// lockSubscription locks a subscription that has not been cancelled,
+// checking the expected version unless it is 0
+func lockSubscription(ctx context.Context, tx pgx.Tx, id uuid.UUID, expectedVersion int) (*domain.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + subscriptionFrom + `WHERE s.id = $1 FOR UPDATE OF s`
+
+	sub, err := scanSubscription(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to lock subscription: %w", err)
+	}
+
+	if sub.Status == domain.SubscriptionCancelled {
+		return nil, ErrSubscriptionClosed
+	}
+	if expectedVersion != 0 && sub.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	return sub, nil
+}
+
+// UpdateDetails changes the delivery address and notes of future tiffins
+func (r *SubscriptionRepository) UpdateDetails(ctx context.Context, id uuid.UUID, expectedVersion int, address, notes string) error {
+	return r.update(ctx, id, expectedVersion, `delivery_address = $2, notes = $3`, address, notes)
+}
+
+// SetPause pauses deliveries from a day until another (inclusive, nil for
+// open-ended), or clears the pause when from is nil
+func (r *SubscriptionRepository) SetPause(ctx context.Context, id uuid.UUID, expectedVersion int, from, until *time.Time) error {
+	return r.update(ctx, id, expectedVersion, `paused_from = $2, paused_until = $3`, from, until)
+}
+
+// update applies a change to a subscription that has not been cancelled
+func (r *SubscriptionRepository) update(ctx context.Context, id uuid.UUID, expectedVersion int, set string, args ...interface{}) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockSubscription(ctx, tx, id, expectedVersion); err != nil {
+			return err
+		}
+
+		query := `UPDATE subscriptions SET ` + set + `, version = version + 1 WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, append([]interface{}{id}, args...)...); err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// AddSkip skips the tiffin of one day; skipping a day twice is a no-op
+func (r *SubscriptionRepository) AddSkip(ctx context.Context, id uuid.UUID, day time.Time) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockSubscription(ctx, tx, id, 0); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO subscription_skips (subscription_id, skip_date)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.Exec(ctx, query, id, day); err != nil {
+			return fmt.Errorf("failed to skip day: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// RemoveSkip restores the tiffin of a skipped day
+func (r *SubscriptionRepository) RemoveSkip(ctx context.Context, id uuid.UUID, day time.Time) error {
+	result, err := r.db.Exec(ctx, `DELETE FROM subscription_skips WHERE subscription_id = $1 AND skip_date = $2`, id, day)
+	if err != nil {
+		return fmt.Errorf("failed to remove skip: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetSkips retrieves the days skipped from a day on
+func (r *SubscriptionRepository) GetSkips(ctx context.Context, id uuid.UUID, from time.Time) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT skip_date
+		FROM subscription_skips
+		WHERE subscription_id = $1 AND skip_date >= $2
+		ORDER BY skip_date
+	`, id, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query skips: %w", err)
+	}
+	defer rows.Close()
+
+	skips := []string{}
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("failed to scan skip: %w", err)
+		}
+		skips = append(skips, day.Format("2006-01-02"))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating skips: %w", err)
+	}
+
+	return skips, nil
+}
+
+// ============================================================================
+// BILLING PERIODS
+// ============================================================================
+
+// periodColumns is the column list scanned by scanPeriod
+const periodColumns = `id, subscription_id, number, status, amount, meals, meals_used,
+	razorpay_order_id, razorpay_payment_id, paid_at, created_at`
+
+func insertPeriod(ctx context.Context, q database.Querier, period *domain.SubscriptionPeriod) error {
+	query := `
+		INSERT INTO subscription_periods (id, subscription_id, number, status, amount, meals, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	period.ID = uuid.New()
+	period.Status = domain.PeriodPending
+	period.CreatedAt = time.Now()
+
+	_, err := q.Exec(ctx, query,
+		period.ID,
+		period.SubscriptionID,
+		period.Number,
+		period.Status,
+		period.Amount,
+		period.Meals,
+		period.CreatedAt,
+	)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			// Another period is already awaiting payment
+			return ErrDuplicateKey
+		}
+		return fmt.Errorf("failed to insert billing period: %w", err)
+	}
+
+	return nil
+}
+
+// CreateRenewal adds the next billing period, awaiting payment.
+// Returns ErrDuplicateKey if one is already awaiting payment.
+func (r *SubscriptionRepository) CreateRenewal(ctx context.Context, period *domain.SubscriptionPeriod) error {
+	return r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockSubscription(ctx, tx, period.SubscriptionID, 0); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(MAX(number), 0) + 1 FROM subscription_periods WHERE subscription_id = $1
+		`, period.SubscriptionID).Scan(&period.Number)
+		if err != nil {
+			return fmt.Errorf("failed to number billing period: %w", err)
+		}
+
+		return insertPeriod(ctx, tx, period)
+	})
+}
+
+// GetPeriods retrieves the billing periods of a subscription, oldest first
+func (r *SubscriptionRepository) GetPeriods(ctx context.Context, subscriptionID uuid.UUID) ([]domain.SubscriptionPeriod, error) {
+	query := `SELECT ` + periodColumns + ` FROM subscription_periods WHERE subscription_id = $1 ORDER BY number`
+
+	rows, err := r.db.Query(ctx, query, subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query billing periods: %w", err)
+	}
+	defer rows.Close()
+
+	periods := []domain.SubscriptionPeriod{}
+	for rows.Next() {
+		period, err := scanPeriod(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan billing period: %w", err)
+		}
+		periods = append(periods, *period)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating billing periods: %w", err)
+	}
+
+	return periods, nil
+}
+
+// GetPendingPeriod retrieves the period of a subscription awaiting payment
+func (r *SubscriptionRepository) GetPendingPeriod(ctx context.Context, subscriptionID uuid.UUID) (*domain.SubscriptionPeriod, error) {
+	query := `SELECT ` + periodColumns + ` FROM subscription_periods WHERE subscription_id = $1 AND status = 'PENDING'`
+
+	return r.getPeriod(ctx, query, subscriptionID)
+}
+
+// GetPeriodByRazorpayOrderID retrieves a period by its gateway order
+func (r *SubscriptionRepository) GetPeriodByRazorpayOrderID(ctx context.Context, razorpayOrderID string) (*domain.SubscriptionPeriod, error) {
+	query := `SELECT ` + periodColumns + ` FROM subscription_periods WHERE razorpay_order_id = $1`
+
+	return r.getPeriod(ctx, query, razorpayOrderID)
+}
+
+func (r *SubscriptionRepository) getPeriod(ctx context.Context, query string, arg interface{}) (*domain.SubscriptionPeriod, error) {
+	period, err := scanPeriod(r.db.QueryRow(ctx, query, arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get billing period: %w", err)
+	}
+
+	return period, nil
+}
+
+// SetPeriodGatewayOrder records the gateway order of a pending period.
+// Returns ErrVersionConflict if another gateway order was recorded first.
+func (r *SubscriptionRepository) SetPeriodGatewayOrder(ctx context.Context, periodID uuid.UUID, razorpayOrderID string) error {
+	query := `
+		UPDATE subscription_periods
+		SET razorpay_order_id = $2
+		WHERE id = $1 AND status = 'PENDING' AND razorpay_order_id IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, periodID, razorpayOrderID)
+	if err != nil {
+		return fmt.Errorf("failed to set gateway order: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// PeriodCaptureResult describes what recording a period payment did
+type PeriodCaptureResult struct {
+	AlreadyProcessed bool
+	Refund           *domain.Refund // Set when the subscription was cancelled before the payment arrived
+}
+
+// CapturePeriod records the payment of a billing period and (re)activates
+// the subscription. A payment for a cancelled subscription is refunded.
+func (r *SubscriptionRepository) CapturePeriod(ctx context.Context, periodID uuid.UUID, paymentID string) (*PeriodCaptureResult, error) {
+	result := &PeriodCaptureResult{}
+
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		query := `SELECT ` + periodColumns + ` FROM subscription_periods WHERE id = $1 FOR UPDATE`
+		period, err := scanPeriod(tx.QueryRow(ctx, query, periodID))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock billing period: %w", err)
+		}
+
+		if period.RazorpayPaymentID != "" {
+			result.AlreadyProcessed = true
+			return nil
+		}
+
+		_, err = lockSubscription(ctx, tx, period.SubscriptionID, 0)
+		if err != nil && !errors.Is(err, ErrSubscriptionClosed) {
+			return err
+		}
+
+		if errors.Is(err, ErrSubscriptionClosed) || period.Status == domain.PeriodCancelled {
+			_, err := tx.Exec(ctx, `
+				UPDATE subscription_periods
+				SET status = 'CANCELLED', razorpay_payment_id = $2, paid_at = NOW()
+				WHERE id = $1
+			`, periodID, paymentID)
+			if err != nil {
+				return fmt.Errorf("failed to record billing period payment: %w", err)
+			}
+
+			result.Refund = &domain.Refund{
+				Source:            domain.RefundSourceSubscriptionPeriod,
+				SourceID:          periodID,
+				RazorpayPaymentID: paymentID,
+				Amount:            period.Amount,
+				Reason:            "Subscription was cancelled before the payment arrived",
+			}
+			return insertRefund(ctx, tx, result.Refund)
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE subscription_periods
+			SET status = 'PAID', razorpay_payment_id = $2, paid_at = NOW()
+			WHERE id = $1
+		`, periodID, paymentID)
+		if err != nil {
+			return fmt.Errorf("failed to record billing period payment: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE subscriptions
+			SET status = 'ACTIVE', version = version + 1
+			WHERE id = $1 AND status IN ('PENDING_PAYMENT', 'EXPIRED')
+		`, period.SubscriptionID)
+		if err != nil {
+			return fmt.Errorf("failed to activate subscription: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Cancel cancels a subscription, drops periods awaiting payment and records
+// refunds for the meals not yet delivered
+func (r *SubscriptionRepository) Cancel(ctx context.Context, id uuid.UUID, expectedVersion int) ([]domain.Refund, error) {
+	var refunds []domain.Refund
+
+	err := r.db.ExecTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockSubscription(ctx, tx, id, expectedVersion); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			UPDATE subscriptions
+			SET status = 'CANCELLED', cancelled_at = NOW(), version = version + 1
+			WHERE id = $1
+		`, id)
+		if err != nil {
+			return fmt.Errorf("failed to cancel subscription: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE subscription_periods SET status = 'CANCELLED'
+			WHERE subscription_id = $1 AND status = 'PENDING'
+		`, id)
+		if err != nil {
+			return fmt.Errorf("failed to cancel pending billing periods: %w", err)
+		}
+
+		query := `SELECT ` + periodColumns + `
+			FROM subscription_periods
+			WHERE subscription_id = $1 AND status = 'PAID' AND meals_used < meals
+			FOR UPDATE
+		`
+		rows, err := tx.Query(ctx, query, id)
+		if err != nil {
+			return fmt.Errorf("failed to query billing periods: %w", err)
+		}
+		var unused []domain.SubscriptionPeriod
+		for rows.Next() {
+			period, err := scanPeriod(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan billing period: %w", err)
+			}
+			unused = append(unused, *period)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating billing periods: %w", err)
+		}
+
+		for i := range unused {
+			refund := domain.Refund{
+				Source:            domain.RefundSourceSubscriptionPeriod,
+				SourceID:          unused[i].ID,
+				RazorpayPaymentID: unused[i].RazorpayPaymentID,
+				Amount:            unused[i].Unused(),
+				Reason:            fmt.Sprintf("%d undelivered meals", unused[i].Meals-unused[i].MealsUsed),
+			}
+			if err := insertRefund(ctx, tx, &refund); err != nil {
+				return err
+			}
+			refunds = append(refunds, refund)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// GetPeriodIDs retrieves the IDs of all billing periods of a subscription
+func (r *SubscriptionRepository) GetPeriodIDs(ctx context.Context, subscriptionID uuid.UUID) ([]uuid.UUID, error) {
+	periods, err := r.GetPeriods(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(periods))
+	for i := range periods {
+		ids[i] = periods[i].ID
+	}
+	return ids, nil
+}
+
+// ============================================================================
+// DAILY ORDERS
+// ============================================================================
+
+// dueCondition selects active subscriptions (alias s) to deliver on day $1:
+// started, not paused or skipped, and not yet delivered that day
+const dueCondition = `
+	s.status = 'ACTIVE'
+	AND s.start_date <= $1
+	AND NOT (s.paused_from IS NOT NULL AND s.paused_from <= $1 AND (s.paused_until IS NULL OR s.paused_until >= $1))
+	AND NOT EXISTS (SELECT 1 FROM subscription_skips k WHERE k.subscription_id = s.id AND k.skip_date = $1)
+	AND NOT EXISTS (SELECT 1 FROM subscription_deliveries d WHERE d.subscription_id = s.id AND d.delivery_date = $1)
+`
+
+// GetDue retrieves the subscriptions that still need a tiffin on a day
+func (r *SubscriptionRepository) GetDue(ctx context.Context, day time.Time) ([]uuid.UUID, error) {
+	query := `
+		SELECT s.id
+		FROM subscriptions s
+		JOIN meal_plan_days pd ON pd.plan_id = s.plan_id AND pd.weekday = $2
+		WHERE ` + dueCondition + `
+		ORDER BY s.created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, day, int(day.Weekday()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan due subscription: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating due subscriptions: %w", err)
+	}
+
+	return ids, nil
+}
+
+// MaterializeResult describes the tiffin order placed for a subscription
+type MaterializeResult struct {
+	Order         *domain.Order // Nil if no paid meal was left
+	MealsLeft     int
+	Expired       bool // The last paid meal was used; the subscription expired
+	RemindRenewal bool // Few meals left and no reminder sent for the current period yet
+}
+
+// Materialize places the day's tiffin order for a subscription, paid with a
+// meal of its oldest period that has meals left. The order's total is that
+// meal's share of the period amount. Returns ErrOutOfStock, placing nothing,
+// if a counted dish does not have enough left.
+func (r *SubscriptionRepository) Materialize(ctx context.Context, id uuid.UUID, day time.Time, order *domain.Order) (*MaterializeResult, error) {
+	result := &MaterializeResult{}
+
+	err := r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		if _, err := lockSubscription(ctx, tx, id, 0); err != nil {
+			return err
+		}
+
+		// Re-check under the lock: the customer may have skipped or paused meanwhile
+		var due bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM subscriptions s WHERE s.id = $2 AND `+dueCondition+`)`, day, id).Scan(&due)
+		if err != nil {
+			return fmt.Errorf("failed to check subscription: %w", err)
+		}
+		if !due {
+			return ErrNotDue
+		}
+
+		query := `SELECT ` + periodColumns + `
+			FROM subscription_periods
+			WHERE subscription_id = $1 AND status = 'PAID' AND meals_used < meals
+			ORDER BY number
+			LIMIT 1
+			FOR UPDATE
+		`
+		period, err := scanPeriod(tx.QueryRow(ctx, query, id))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to lock billing period: %w", err)
+		}
+
+		if period != nil {
+			now := time.Now()
+			order.SubscriptionID = &id
+			order.TotalAmount = period.MealPrice(period.MealsUsed + 1)
+			order.PaidAt = &now
+			if err := insertOrder(ctx, tx, order); err != nil {
+				return err
+			}
+			// The meal is prepaid and goes to the kitchen today, so its stock is sold
+			if err := reserveStock(ctx, tx, order.ID, order.Items, domain.StockCommitted); err != nil {
+				return err
+			}
+			result.Order = order
+
+			if _, err := tx.Exec(ctx, `UPDATE subscription_periods SET meals_used = meals_used + 1 WHERE id = $1`, period.ID); err != nil {
+				return fmt.Errorf("failed to use meal: %w", err)
+			}
+
+			_, err = tx.Exec(ctx, `
+				INSERT INTO subscription_deliveries (subscription_id, delivery_date, period_id, order_id)
+				VALUES ($1, $2, $3, $4)
+			`, id, day, period.ID, order.ID)
+			if err != nil {
+				return fmt.Errorf("failed to record delivery: %w", err)
+			}
+		}
+
+		err = tx.QueryRow(ctx, `
+			SELECT COALESCE(SUM(meals - meals_used), 0)
+			FROM subscription_periods
+			WHERE subscription_id = $1 AND status = 'PAID'
+		`, id).Scan(&result.MealsLeft)
+		if err != nil {
+			return fmt.Errorf("failed to count meals left: %w", err)
+		}
+
+		if result.MealsLeft == 0 {
+			_, err := tx.Exec(ctx, `UPDATE subscriptions SET status = 'EXPIRED', version = version + 1 WHERE id = $1`, id)
+			if err != nil {
+				return fmt.Errorf("failed to expire subscription: %w", err)
+			}
+			result.Expired = true
+			return nil
+		}
+
+		if result.MealsLeft <= domain.RenewalReminderMeals {
+			// Remind once per last paid period, and not while a renewal is being paid
+			reminder, err := tx.Exec(ctx, `
+				UPDATE subscription_periods SET renewal_notified_at = NOW()
+				WHERE id = (
+					SELECT id FROM subscription_periods
+					WHERE subscription_id = $1 AND status = 'PAID'
+					ORDER BY number DESC
+					LIMIT 1
+				)
+				AND renewal_notified_at IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM subscription_periods
+					WHERE subscription_id = $1 AND status = 'PENDING' AND razorpay_order_id IS NOT NULL
+				)
+			`, id)
+			if err != nil {
+				return fmt.Errorf("failed to record renewal reminder: %w", err)
+			}
+			result.RemindRenewal = reminder.RowsAffected() == 1
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// scanSubscription scans a row selected with subscriptionColumns
+func scanSubscription(row pgx.Row) (*domain.Subscription, error) {
+	sub := &domain.Subscription{}
+	var startDate time.Time
+	var pausedFrom, pausedUntil *time.Time
+
+	err := row.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.PlanID,
+		&sub.PlanName,
+		&sub.Status,
+		&startDate,
+		&pausedFrom,
+		&pausedUntil,
+		&sub.DeliveryAddress,
+		&sub.Notes,
+		&sub.Version,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+		&sub.CancelledAt,
+		&sub.MealsLeft,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.StartDate = startDate.Format("2006-01-02")
+	sub.PausedFrom = formatDate(pausedFrom)
+	sub.PausedUntil = formatDate(pausedUntil)
+
+	return sub, nil
+}
+
+// formatDate formats an optional DATE column as YYYY-MM-DD
+func formatDate(day *time.Time) *string {
+	if day == nil {
+		return nil
+	}
+	s := day.Format("2006-01-02")
+	return &s
+}
+
+// scanPeriod scans a row selected with periodColumns
+func scanPeriod(row pgx.Row) (*domain.SubscriptionPeriod, error) {
+	period := &domain.SubscriptionPeriod{}
+	var razorpayOrderID, razorpayPaymentID *string
+
+	err := row.Scan(
+		&period.ID,
+		&period.SubscriptionID,
+		&period.Number,
+		&period.Status,
+		&period.Amount,
+		&period.Meals,
+		&period.MealsUsed,
+		&razorpayOrderID,
+		&razorpayPaymentID,
+		&period.PaidAt,
+		&period.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if razorpayOrderID != nil {
+		period.RazorpayOrderID = *razorpayOrderID
+	}
+	if razorpayPaymentID != nil {
+		period.RazorpayPaymentID = *razorpayPaymentID
+	}
+
+	return period, nil
+}
@@ -0,0 +1,495 @@
+// Package repository implements dining table and table tab data access
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/pkg/database"
+)
+
+// Table tab errors
+var (
+	ErrTabClosed      = errors.New("table tab is not open for new orders")
+	ErrNotTableMember = errors.New("user has not joined this table tab")
+)
+
+// TableRepository handles dining tables and table sessions (tabs)
+type TableRepository struct {
+	db *database.Pool
+}
+
+// NewTableRepository creates a new table repository
+func NewTableRepository(db *database.Pool) *TableRepository {
+	return &TableRepository{db: db}
+}
+
+// tableColumns is the column list scanned by scanTable
+const tableColumns = `id, number, label, qr_version, is_active, created_at, updated_at`
+
+// sessionSelect selects a session with its table number and running total,
+// as scanned by scanSession
+const sessionSelect = `
+	SELECT s.id, s.table_id, t.number, s.status, s.bill_amount, s.settlement_method,
+		s.razorpay_order_id, s.razorpay_payment_id, s.settled_by, s.version,
+		s.opened_at, s.bill_requested_at, s.settled_at, s.updated_at,
+		(SELECT COALESCE(SUM(o.total_amount), 0) FROM orders o WHERE o.table_session_id = s.id)
+	FROM table_sessions s
+	JOIN dining_tables t ON t.id = s.table_id
+`
+
+// ListTables retrieves all tables ordered by number
+func (r *TableRepository) ListTables(ctx context.Context) ([]domain.DiningTable, error) {
+	query := `
+		SELECT ` + tableColumns + `
+		FROM dining_tables
+		ORDER BY number
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []domain.DiningTable
+	for rows.Next() {
+		table, err := scanTable(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, *table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tables: %w", err)
+	}
+
+	return tables, nil
+}
+
+// GetTable retrieves a table by ID
+func (r *TableRepository) GetTable(ctx context.Context, id uuid.UUID) (*domain.DiningTable, error) {
+	query := `
+		SELECT ` + tableColumns + `
+		FROM dining_tables
+		WHERE id = $1
+	`
+
+	table, err := scanTable(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get table: %w", err)
+	}
+
+	return table, nil
+}
+
+// CreateTable inserts a new table. Table numbers are unique.
+func (r *TableRepository) CreateTable(ctx context.Context, table *domain.DiningTable) error {
+	query := `
+		INSERT INTO dining_tables (id, number, label, is_active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING qr_version, created_at, updated_at
+	`
+
+	table.ID = uuid.New()
+	err := r.db.QueryRow(ctx, query, table.ID, table.Number, table.Label, table.IsActive).
+		Scan(&table.QRVersion, &table.CreatedAt, &table.UpdatedAt)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return ErrDuplicateKey
+		}
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTable updates a table's label and active flag
+func (r *TableRepository) UpdateTable(ctx context.Context, table *domain.DiningTable) error {
+	query := `
+		UPDATE dining_tables
+		SET label = $2, is_active = $3
+		WHERE id = $1
+		RETURNING number, qr_version, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query, table.ID, table.Label, table.IsActive).
+		Scan(&table.Number, &table.QRVersion, &table.CreatedAt, &table.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to update table: %w", err)
+	}
+
+	return nil
+}
+
+// RotateQR bumps the table's QR version, invalidating previously printed codes
+func (r *TableRepository) RotateQR(ctx context.Context, id uuid.UUID) (*domain.DiningTable, error) {
+	query := `
+		UPDATE dining_tables
+		SET qr_version = qr_version + 1
+		WHERE id = $1
+		RETURNING ` + tableColumns
+
+	table, err := scanTable(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to rotate table QR: %w", err)
+	}
+
+	return table, nil
+}
+
+// OpenSession returns the table's running tab, opening a new one if there is
+// none, and adds the user to its guests. The partial unique index guarantees
+// one unsettled tab per table, so guests scanning at the same time all land
+// on the same tab.
+func (r *TableRepository) OpenSession(ctx context.Context, tableID, userID uuid.UUID) (*domain.TableSession, error) {
+	insertQuery := `
+		INSERT INTO table_sessions (id, table_id)
+		VALUES ($1, $2)
+		ON CONFLICT (table_id) WHERE status <> 'SETTLED' DO NOTHING
+	`
+
+	if _, err := r.db.Exec(ctx, insertQuery, uuid.New(), tableID); err != nil {
+		return nil, fmt.Errorf("failed to open table session: %w", err)
+	}
+
+	query := sessionSelect + `
+		WHERE s.table_id = $1 AND s.status <> 'SETTLED'
+	`
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, tableID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Settled between the insert and the select; the guest can scan again
+			return nil, ErrTabClosed
+		}
+		return nil, fmt.Errorf("failed to get open table session: %w", err)
+	}
+
+	memberQuery := `
+		INSERT INTO table_session_members (session_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := r.db.Exec(ctx, memberQuery, session.ID, userID); err != nil {
+		return nil, fmt.Errorf("failed to join table session: %w", err)
+	}
+
+	return session, nil
+}
+
+// CheckMember returns ErrNotTableMember unless the user joined the tab
+func (r *TableRepository) CheckMember(ctx context.Context, sessionID, userID uuid.UUID) error {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM table_session_members WHERE session_id = $1 AND user_id = $2)`
+	if err := r.db.QueryRow(ctx, query, sessionID, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check table tab membership: %w", err)
+	}
+	if !exists {
+		return ErrNotTableMember
+	}
+	return nil
+}
+
+// GetSession retrieves a table session with its running total
+func (r *TableRepository) GetSession(ctx context.Context, id uuid.UUID) (*domain.TableSession, error) {
+	query := sessionSelect + `
+		WHERE s.id = $1
+	`
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get table session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSessionByRazorpayOrderID retrieves the tab being paid with the given gateway order
+func (r *TableRepository) GetSessionByRazorpayOrderID(ctx context.Context, razorpayOrderID string) (*domain.TableSession, error) {
+	query := sessionSelect + `
+		WHERE s.razorpay_order_id = $1
+	`
+
+	session, err := scanSession(r.db.QueryRow(ctx, query, razorpayOrderID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get table session by razorpay order ID: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListSessions retrieves tabs in the given states (all when empty), oldest first
+func (r *TableRepository) ListSessions(ctx context.Context, statuses []domain.TableSessionStatus) ([]domain.TableSession, error) {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	query := sessionSelect + `
+		WHERE cardinality($1::text[]) = 0 OR s.status = ANY($1::text[]::table_session_status[])
+		ORDER BY s.opened_at ASC
+	`
+
+	rows, err := r.db.Query(ctx, query, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []domain.TableSession
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table session: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating table sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// AddRound inserts a dine-in order on the tab. The tab row is locked so a
+// round cannot slip in after the bill has been requested.
+func (r *TableRepository) AddRound(ctx context.Context, sessionID uuid.UUID, order *domain.Order) error {
+	return r.db.ExecTxWithIsolation(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		var status domain.TableSessionStatus
+		err := tx.QueryRow(ctx, `SELECT status FROM table_sessions WHERE id = $1 FOR UPDATE`, sessionID).Scan(&status)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to lock table session: %w", err)
+		}
+
+		if status != domain.TableSessionOpen {
+			return ErrTabClosed
+		}
+
+		order.TableSessionID = &sessionID
+		if err := insertOrder(ctx, tx, order); err != nil {
+			return err
+		}
+
+		// Rounds go to the kitchen straight away, so their stock is sold
+		return reserveStock(ctx, tx, order.ID, order.Items, domain.StockCommitted)
+	})
+}
+
+// RequestBill closes the tab for new rounds. Requesting twice is a no-op.
+func (r *TableRepository) RequestBill(ctx context.Context, sessionID uuid.UUID) error {
+	query := `
+		UPDATE table_sessions
+		SET status = 'BILL_REQUESTED', bill_requested_at = NOW(), version = version + 1
+		WHERE id = $1 AND status = 'OPEN'
+	`
+
+	result, err := r.db.Exec(ctx, query, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to request bill: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		session, err := r.GetSession(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		if session.Status == domain.TableSessionSettled {
+			return ErrTabClosed
+		}
+	}
+
+	return nil
+}
+
+// StartGatewayPayment records the gateway order created for the tab and fixes
+// the bill amount. Also requests the bill so no rounds can be added while paying.
+func (r *TableRepository) StartGatewayPayment(ctx context.Context, sessionID uuid.UUID, razorpayOrderID string, amount int64, expectedVersion int) error {
+	query := `
+		UPDATE table_sessions
+		SET status = 'BILL_REQUESTED',
+			bill_requested_at = COALESCE(bill_requested_at, NOW()),
+			bill_amount = $2,
+			razorpay_order_id = $3,
+			version = version + 1
+		WHERE id = $1 AND version = $4 AND status <> 'SETTLED'
+	`
+
+	result, err := r.db.Exec(ctx, query, sessionID, amount, razorpayOrderID, expectedVersion)
+	if err != nil {
+		return fmt.Errorf("failed to start tab payment: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// Settle marks the tab paid and stamps paid_at on all of its rounds in one
+// transaction. Returns ErrTabClosed if the tab was already settled.
+func (r *TableRepository) Settle(ctx context.Context, sessionID uuid.UUID, method domain.SettlementMethod, amount int64, paymentID string, settledBy *uuid.UUID) error {
+	return r.db.ExecTxWithIsolation(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		return settleTableSession(ctx, tx, sessionID, method, amount, paymentID, settledBy)
+	})
+}
+
+// settleTableSession settles a tab inside the caller's transaction. A tab
+// paid some other way than its split bill voids that bill, so the shares
+// already paid are refunded.
+func settleTableSession(ctx context.Context, tx pgx.Tx, sessionID uuid.UUID, method domain.SettlementMethod, amount int64, paymentID string, settledBy *uuid.UUID) error {
+	var status domain.TableSessionStatus
+	err := tx.QueryRow(ctx, `SELECT status FROM table_sessions WHERE id = $1 FOR UPDATE`, sessionID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to lock table session: %w", err)
+	}
+
+	if status == domain.TableSessionSettled {
+		return ErrTabClosed
+	}
+
+	sessionQuery := `
+		UPDATE table_sessions
+		SET status = 'SETTLED',
+			bill_requested_at = COALESCE(bill_requested_at, NOW()),
+			settled_at = NOW(),
+			settlement_method = $2,
+			bill_amount = $3,
+			razorpay_payment_id = $4,
+			settled_by = $5,
+			version = version + 1
+		WHERE id = $1
+	`
+
+	_, err = tx.Exec(ctx, sessionQuery, sessionID, method, amount, nullableString(paymentID), settledBy)
+	if err != nil {
+		return fmt.Errorf("failed to settle table session: %w", err)
+	}
+
+	if method != domain.SettlementSplit {
+		if err := voidOpenBill(ctx, tx, domain.BillSourceTableSession, sessionID); err != nil {
+			return err
+		}
+	}
+
+	ordersQuery := `
+		UPDATE orders
+		SET paid_at = NOW(), version = version + 1, updated_at = NOW()
+		WHERE table_session_id = $1 AND paid_at IS NULL
+		RETURNING id, user_id, total_amount, paid_at
+	`
+
+	rows, err := tx.Query(ctx, ordersQuery, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to mark tab orders paid: %w", err)
+	}
+
+	var paid []domain.OrderPaidEvent
+	for rows.Next() {
+		event := domain.OrderPaidEvent{RazorpayPaymentID: paymentID, TableSessionID: &sessionID}
+		if err := rows.Scan(&event.OrderID, &event.UserID, &event.Amount, &event.PaidAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan paid tab order: %w", err)
+		}
+		paid = append(paid, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating paid tab orders: %w", err)
+	}
+
+	// Rounds stay ON_TAB; only the payment is published
+	for _, event := range paid {
+		if err := insertEvent(ctx, tx, domain.EventOrderPaid, event.OrderID, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanTable scans a row selected with tableColumns
+func scanTable(row pgx.Row) (*domain.DiningTable, error) {
+	table := &domain.DiningTable{}
+	err := row.Scan(
+		&table.ID,
+		&table.Number,
+		&table.Label,
+		&table.QRVersion,
+		&table.IsActive,
+		&table.CreatedAt,
+		&table.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// scanSession scans a row selected with sessionSelect
+func scanSession(row pgx.Row) (*domain.TableSession, error) {
+	session := &domain.TableSession{}
+	var method, razorpayOrderID, razorpayPaymentID *string
+
+	err := row.Scan(
+		&session.ID,
+		&session.TableID,
+		&session.TableNumber,
+		&session.Status,
+		&session.BillAmount,
+		&method,
+		&razorpayOrderID,
+		&razorpayPaymentID,
+		&session.SettledBy,
+		&session.Version,
+		&session.OpenedAt,
+		&session.BillRequestedAt,
+		&session.SettledAt,
+		&session.UpdatedAt,
+		&session.TotalAmount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if method != nil {
+		session.SettlementMethod = domain.SettlementMethod(*method)
+	}
+	if razorpayOrderID != nil {
+		session.RazorpayOrderID = *razorpayOrderID
+	}
+	if razorpayPaymentID != nil {
+		session.RazorpayPaymentID = *razorpayPaymentID
+	}
+
+	return session, nil
+}
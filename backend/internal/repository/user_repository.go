@@ -19,6 +19,7 @@ var (
 	ErrNotFound      = errors.New("record not found")
 	ErrDuplicateKey  = errors.New("duplicate key violation")
 	ErrVersionConflict = errors.New("version conflict - record was modified")
+	ErrInvalidCursor   = errors.New("invalid pagination cursor")
 )
 
 // UserRepository handles user data persistence
@@ -34,8 +35,8 @@ func NewUserRepository(db *database.Pool) *UserRepository {
 // Create inserts a new user into the database
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	query := `
-		INSERT INTO users (id, phone_number, name, email, password_hash, email_verified, is_admin, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO users (id, phone_number, name, email, password_hash, email_verified, is_admin, language, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	user.ID = uuid.New()
@@ -47,6 +48,7 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 		user.PasswordHash,
 		user.EmailVerified,
 		user.IsAdmin,
+		user.Language,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -64,7 +66,7 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 // GetByID retrieves a user by their UUID
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	query := `
-		SELECT id, phone_number, name, email, password_hash, email_verified, is_admin, created_at, updated_at
+		SELECT id, phone_number, name, email, password_hash, email_verified, is_admin, language, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -78,6 +80,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Use
 		&user.PasswordHash,
 		&user.EmailVerified,
 		&user.IsAdmin,
+		&user.Language,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -95,7 +98,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Use
 // GetByPhoneNumber retrieves a user by phone number
 func (r *UserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*domain.User, error) {
 	query := `
-		SELECT id, phone_number, name, email, password_hash, email_verified, is_admin, created_at, updated_at
+		SELECT id, phone_number, name, email, password_hash, email_verified, is_admin, language, created_at, updated_at
 		FROM users
 		WHERE phone_number = $1
 	`
@@ -109,6 +112,7 @@ func (r *UserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber strin
 		&user.PasswordHash,
 		&user.EmailVerified,
 		&user.IsAdmin,
+		&user.Language,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -126,7 +130,7 @@ func (r *UserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber strin
 // GetByEmail retrieves a user by email address
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	query := `
-		SELECT id, phone_number, name, email, password_hash, email_verified, is_admin, created_at, updated_at
+		SELECT id, phone_number, name, email, password_hash, email_verified, is_admin, language, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -140,6 +144,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.
 		&user.PasswordHash,
 		&user.EmailVerified,
 		&user.IsAdmin,
+		&user.Language,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -158,7 +163,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.
 func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 	query := `
 		UPDATE users
-		SET name = $2, email = $3, is_admin = $4, updated_at = NOW()
+		SET name = $2, email = $3, is_admin = $4, language = $5, updated_at = NOW()
 		WHERE id = $1
 	`
 
@@ -167,6 +172,7 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 		user.Name,
 		user.Email,
 		user.IsAdmin,
+		user.Language,
 	)
 
 	if err != nil {
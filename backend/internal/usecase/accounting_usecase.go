@@ -0,0 +1,235 @@
+// Package usecase implements the Tally accounting export
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+	"fooddelivery/pkg/tally"
+)
+
+// Tally voucher types; these are predefined in every Tally company
+const (
+	tallySalesVoucher      = "Sales"
+	tallyCreditNoteVoucher = "Credit Note"
+	tallyJournalVoucher    = "Journal"
+)
+
+// DefaultTallyLedgers are the ledgers used for roles TALLY_LEDGERS does not set
+var DefaultTallyLedgers = map[domain.LedgerRole]string{
+	domain.LedgerParty:       "Razorpay",
+	domain.LedgerSales:       "Sales",
+	domain.LedgerDelivery:    "", // Booked as sales
+	domain.LedgerCGST:        "Output CGST",
+	domain.LedgerSGST:        "Output SGST",
+	domain.LedgerGatewayFees: "Payment Gateway Charges",
+	domain.LedgerGatewayTax:  "Input IGST",
+}
+
+// ParseTallyLedgers applies TALLY_LEDGERS overrides ("role=ledger;...") to
+// the default ledgers. Only the delivery ledger may be left empty.
+func ParseTallyLedgers(value string) (map[domain.LedgerRole]string, error) {
+	ledgers := make(map[domain.LedgerRole]string, len(DefaultTallyLedgers))
+	for role, ledger := range DefaultTallyLedgers {
+		ledgers[role] = ledger
+	}
+
+	for _, rule := range strings.Split(value, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		name, ledger, ok := strings.Cut(rule, "=")
+		role := domain.LedgerRole(strings.TrimSpace(name))
+		if _, known := DefaultTallyLedgers[role]; !ok || !known {
+			return nil, fmt.Errorf("invalid tally ledger mapping %q", rule)
+		}
+		ledgers[role] = strings.TrimSpace(ledger)
+	}
+
+	for role, ledger := range ledgers {
+		if ledger == "" && role != domain.LedgerDelivery {
+			return nil, fmt.Errorf("tally ledger for %s must not be empty", role)
+		}
+	}
+
+	return ledgers, nil
+}
+
+// AccountingUsecase turns sales, refunds and gateway fees into Tally
+// vouchers, one of each per day in the business timezone:
+//   - a sales voucher for the orders paid that day, with the GST included in
+//     the prices split into CGST and SGST
+//   - a credit note for the order refunds processed that day, reversing GST
+//   - a journal voucher for the gateway fees charged that day
+type AccountingUsecase struct {
+	orderRepo  *repository.OrderRepository
+	refundRepo *repository.RefundRepository
+	ledgers    map[domain.LedgerRole]string
+	company    string
+	taxRate    int64 // Basis points of GST included in prices
+	location   *time.Location
+	log        *logger.Logger
+}
+
+// NewAccountingUsecase creates a new accounting usecase
+func NewAccountingUsecase(
+	orderRepo *repository.OrderRepository,
+	refundRepo *repository.RefundRepository,
+	ledgers map[domain.LedgerRole]string,
+	company string,
+	taxRate int64,
+	location *time.Location,
+	log *logger.Logger,
+) *AccountingUsecase {
+	return &AccountingUsecase{
+		orderRepo:  orderRepo,
+		refundRepo: refundRepo,
+		ledgers:    ledgers,
+		company:    company,
+		taxRate:    taxRate,
+		location:   location,
+		log:        log,
+	}
+}
+
+// ExportTally writes the vouchers of a range as a Tally XML import file and
+// returns its file name. Vouchers carry a stable ID per day and kind, so
+// importing an overlapping range again, e.g. once today is over, replaces
+// vouchers instead of booking them twice.
+func (u *AccountingUsecase) ExportTally(ctx context.Context, r AnalyticsRange, w io.Writer) (string, error) {
+	from, to, err := resolveDateRange(r, u.location, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	tz := u.location.String()
+	sales, err := u.orderRepo.GetDailySales(ctx, from, to, tz)
+	if err != nil {
+		return "", err
+	}
+	refunds, err := u.refundRepo.GetDailyRefunds(ctx, from, to, tz)
+	if err != nil {
+		return "", err
+	}
+	fees, err := u.orderRepo.GetDailyGatewayFees(ctx, from, to, tz)
+	if err != nil {
+		return "", err
+	}
+
+	var vouchers []tally.Voucher
+	for _, d := range sales {
+		vouchers = append(vouchers, u.salesVoucher(d))
+	}
+	for _, d := range refunds {
+		vouchers = append(vouchers, u.creditNote(d))
+	}
+	for _, d := range fees {
+		vouchers = append(vouchers, u.gatewayFeeJournal(d))
+	}
+
+	if err := tally.Write(w, u.company, vouchers); err != nil {
+		return "", err
+	}
+
+	last := to.Add(-time.Nanosecond).In(u.location)
+	return fmt.Sprintf("tally_%s_%s.xml", from.In(u.location).Format("2006-01-02"), last.Format("2006-01-02")), nil
+}
+
+// salesVoucher books a day's paid orders: the party is debited with what
+// customers paid and sales, delivery and GST are credited
+func (u *AccountingUsecase) salesVoucher(d domain.DailyAmount) tally.Voucher {
+	day := u.localDay(d.Day)
+	tax := includedTax(d.Amount, u.taxRate)
+
+	var entries []tally.Entry
+	entries = addEntry(entries, u.ledgers[domain.LedgerParty], d.Amount)
+	if delivery := u.ledgers[domain.LedgerDelivery]; delivery != "" {
+		deliveryTax := includedTax(d.Fees, u.taxRate)
+		entries = addEntry(entries, u.ledgers[domain.LedgerSales], -(d.Amount - d.Fees - (tax - deliveryTax)))
+		entries = addEntry(entries, delivery, -(d.Fees - deliveryTax))
+	} else {
+		entries = addEntry(entries, u.ledgers[domain.LedgerSales], -(d.Amount - tax))
+	}
+	entries = addEntry(entries, u.ledgers[domain.LedgerCGST], -(tax / 2))
+	entries = addEntry(entries, u.ledgers[domain.LedgerSGST], -(tax - tax/2))
+
+	return tally.Voucher{
+		RemoteID:  "fooddelivery-sales-" + day.Format("2006-01-02"),
+		Type:      tallySalesVoucher,
+		Number:    "S-" + day.Format("20060102"),
+		Date:      day,
+		Party:     u.ledgers[domain.LedgerParty],
+		Narration: fmt.Sprintf("Sales of %d paid orders on %s", d.Count, day.Format("02 Jan 2006")),
+		Entries:   entries,
+	}
+}
+
+// creditNote books a day's order refunds, reversing sales and GST. Refunds
+// are not split between food and delivery.
+func (u *AccountingUsecase) creditNote(d domain.DailyAmount) tally.Voucher {
+	day := u.localDay(d.Day)
+	tax := includedTax(d.Amount, u.taxRate)
+
+	var entries []tally.Entry
+	entries = addEntry(entries, u.ledgers[domain.LedgerSales], d.Amount-tax)
+	entries = addEntry(entries, u.ledgers[domain.LedgerCGST], tax/2)
+	entries = addEntry(entries, u.ledgers[domain.LedgerSGST], tax-tax/2)
+	entries = addEntry(entries, u.ledgers[domain.LedgerParty], -d.Amount)
+
+	return tally.Voucher{
+		RemoteID:  "fooddelivery-refunds-" + day.Format("2006-01-02"),
+		Type:      tallyCreditNoteVoucher,
+		Number:    "CN-" + day.Format("20060102"),
+		Date:      day,
+		Party:     u.ledgers[domain.LedgerParty],
+		Narration: fmt.Sprintf("Refunds of %d orders processed on %s", d.Count, day.Format("02 Jan 2006")),
+		Entries:   entries,
+	}
+}
+
+// gatewayFeeJournal books the fees the gateway kept from a day's payments
+// as an expense, with the GST on them as input credit
+func (u *AccountingUsecase) gatewayFeeJournal(d domain.DailyAmount) tally.Voucher {
+	day := u.localDay(d.Day)
+
+	var entries []tally.Entry
+	entries = addEntry(entries, u.ledgers[domain.LedgerGatewayFees], d.Amount-d.Tax)
+	entries = addEntry(entries, u.ledgers[domain.LedgerGatewayTax], d.Tax)
+	entries = addEntry(entries, u.ledgers[domain.LedgerParty], -d.Amount)
+
+	return tally.Voucher{
+		RemoteID:  "fooddelivery-gateway-fees-" + day.Format("2006-01-02"),
+		Type:      tallyJournalVoucher,
+		Number:    "GF-" + day.Format("20060102"),
+		Date:      day,
+		Narration: fmt.Sprintf("Gateway fees on %d payments captured on %s", d.Count, day.Format("02 Jan 2006")),
+		Entries:   entries,
+	}
+}
+
+// localDay turns a day returned as a local wall-clock time into local midnight
+func (u *AccountingUsecase) localDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, u.location)
+}
+
+// includedTax is the GST contained in a GST-inclusive amount, rounded to the
+// nearest paisa as in checkout quotes
+func includedTax(amount, rate int64) int64 {
+	return (amount*rate + (10000+rate)/2) / (10000 + rate)
+}
+
+// addEntry appends a ledger entry, leaving out zero amounts
+func addEntry(entries []tally.Entry, ledger string, amount int64) []tally.Entry {
+	if amount == 0 {
+		return entries
+	}
+	return append(entries, tally.Entry{Ledger: ledger, Amount: amount})
+}
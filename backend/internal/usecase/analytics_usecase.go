@@ -0,0 +1,262 @@
+// Package usecase implements sales analytics for the admin dashboard
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Analytics limits
+const (
+	defaultAnalyticsDays = 30  // Range when none is given, ending today
+	maxAnalyticsDays     = 366 // Longest range of any report
+	maxRevenueBuckets    = 400 // Longest revenue series
+	defaultTopItems      = 10
+	maxTopItems          = 100
+)
+
+// AnalyticsRange is a date range filter. From and To are YYYY-MM-DD days in
+// the business timezone (To inclusive) or RFC3339 timestamps.
+type AnalyticsRange struct {
+	From string
+	To   string
+}
+
+// AnalyticsUsecase reports sales for the admin dashboard. Days, weeks and
+// hours start in the business timezone.
+type AnalyticsUsecase struct {
+	analyticsRepo *repository.AnalyticsRepository
+	location      *time.Location
+	log           *logger.Logger
+}
+
+// NewAnalyticsUsecase creates a new analytics usecase
+func NewAnalyticsUsecase(analyticsRepo *repository.AnalyticsRepository, location *time.Location, log *logger.Logger) *AnalyticsUsecase {
+	return &AnalyticsUsecase{
+		analyticsRepo: analyticsRepo,
+		location:      location,
+		log:           log,
+	}
+}
+
+// resolveRange validates a range; the default is the last 30 days including today
+func (u *AnalyticsUsecase) resolveRange(r AnalyticsRange, now time.Time) (time.Time, time.Time, error) {
+	return resolveDateRange(r, u.location, now)
+}
+
+// resolveDateRange validates a report range in loc and returns it as
+// [from, to); the default is the last 30 days including today
+func resolveDateRange(r AnalyticsRange, loc *time.Location, now time.Time) (time.Time, time.Time, error) {
+	local := now.In(loc)
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	if r.To != "" {
+		t, err := parseDateBoundary(r.To, loc, true)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid to date", ErrInvalidFilter)
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -defaultAnalyticsDays)
+	if r.From != "" {
+		f, err := parseDateBoundary(r.From, loc, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid from date", ErrInvalidFilter)
+		}
+		from = f
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+	if to.Sub(from) > maxAnalyticsDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: range must not exceed %d days", ErrInvalidFilter, maxAnalyticsDays)
+	}
+
+	return from, to, nil
+}
+
+// GetSummary reports order counts by status, revenue, average order value,
+// the repeat-customer rate and the payment failure rate for a range
+func (u *AnalyticsUsecase) GetSummary(ctx context.Context, r AnalyticsRange) (*domain.SalesSummary, error) {
+	from, to, err := u.resolveRange(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := u.analyticsRepo.GetSummary(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.NetRevenue = summary.Revenue - summary.Refunds
+	if summary.PaidOrders > 0 {
+		summary.AverageOrderValue = summary.Revenue / summary.PaidOrders
+	}
+	summary.RepeatCustomerRate = ratio(summary.RepeatCustomers, summary.Customers)
+	summary.PaymentFailureRate = ratio(summary.PaymentsFailed, summary.PaymentsCaptured+summary.PaymentsFailed)
+
+	return summary, nil
+}
+
+// GetRevenue reports revenue per day, week or month, with a zero point for
+// every bucket without sales
+func (u *AnalyticsUsecase) GetRevenue(ctx context.Context, r AnalyticsRange, interval domain.AnalyticsInterval) ([]domain.RevenuePoint, error) {
+	if interval == "" {
+		interval = domain.IntervalDay
+	}
+	if !interval.IsValid() {
+		return nil, fmt.Errorf("%w: interval must be day, week or month", ErrInvalidFilter)
+	}
+
+	from, to, err := u.resolveRange(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := u.analyticsRepo.GetRevenueSeries(ctx, from, to, interval, u.location.String())
+	if err != nil {
+		return nil, err
+	}
+
+	byStart := make(map[time.Time]domain.RevenuePoint, len(points))
+	for _, p := range points {
+		// Buckets come back as local wall-clock times
+		p.Start = time.Date(p.Start.Year(), p.Start.Month(), p.Start.Day(), 0, 0, 0, 0, u.location)
+		byStart[p.Start] = p
+	}
+
+	var series []domain.RevenuePoint
+	for start := u.bucketStart(from, interval); start.Before(to); start = nextBucket(start, interval) {
+		if len(series) == maxRevenueBuckets {
+			return nil, fmt.Errorf("%w: too many %ss in range, use a longer interval", ErrInvalidFilter, interval)
+		}
+
+		p, ok := byStart[start]
+		if !ok {
+			p = domain.RevenuePoint{Start: start}
+		}
+		p.NetRevenue = p.Revenue - p.Refunds
+		if p.Orders > 0 {
+			p.AverageOrderValue = p.Revenue / p.Orders
+		}
+		series = append(series, p)
+	}
+
+	return series, nil
+}
+
+// bucketStart returns the local midnight starting the bucket that contains t
+func (u *AnalyticsUsecase) bucketStart(t time.Time, interval domain.AnalyticsInterval) time.Time {
+	t = t.In(u.location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, u.location)
+
+	switch interval {
+	case domain.IntervalWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // Days since Monday
+		return day.AddDate(0, 0, -offset)
+	case domain.IntervalMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, u.location)
+	}
+	return day
+}
+
+func nextBucket(start time.Time, interval domain.AnalyticsInterval) time.Time {
+	switch interval {
+	case domain.IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case domain.IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// GetTopItems ranks the best-selling menu items by quantity (default) or revenue
+func (u *AnalyticsUsecase) GetTopItems(ctx context.Context, r AnalyticsRange, sortBy string, limit int) ([]domain.ItemSales, error) {
+	sort := repository.ItemSalesSort(sortBy)
+	if sort == "" {
+		sort = repository.ItemSalesByQuantity
+	}
+	if sort != repository.ItemSalesByQuantity && sort != repository.ItemSalesByRevenue {
+		return nil, fmt.Errorf("%w: sort must be quantity or revenue", ErrInvalidFilter)
+	}
+	if limit <= 0 {
+		limit = defaultTopItems
+	}
+	if limit > maxTopItems {
+		limit = maxTopItems
+	}
+
+	from, to, err := u.resolveRange(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := u.analyticsRepo.GetTopItems(ctx, from, to, sort, limit)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []domain.ItemSales{}
+	}
+
+	return items, nil
+}
+
+// GetTopCategories reports sales per menu category, best-selling first
+func (u *AnalyticsUsecase) GetTopCategories(ctx context.Context, r AnalyticsRange) ([]domain.CategorySales, error) {
+	from, to, err := u.resolveRange(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := u.analyticsRepo.GetCategorySales(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if categories == nil {
+		categories = []domain.CategorySales{}
+	}
+
+	return categories, nil
+}
+
+// GetPeakHours reports paid orders for every weekday and hour, Monday 00:00
+// first, so the dashboard can draw the full 7x24 heatmap
+func (u *AnalyticsUsecase) GetPeakHours(ctx context.Context, r AnalyticsRange) ([]domain.HeatmapCell, error) {
+	from, to, err := u.resolveRange(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	counted, err := u.analyticsRepo.GetOrderHeatmap(ctx, from, to, u.location.String())
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make([]domain.HeatmapCell, 7*24)
+	for i := range cells {
+		cells[i] = domain.HeatmapCell{Weekday: i/24 + 1, Hour: i % 24}
+	}
+	for _, c := range counted {
+		if c.Weekday >= 1 && c.Weekday <= 7 && c.Hour >= 0 && c.Hour < 24 {
+			cells[(c.Weekday-1)*24+c.Hour] = c
+		}
+	}
+
+	return cells, nil
+}
+
+// ratio returns part/whole rounded to four decimals, or 0 for an empty whole
+func ratio(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 10000
+}
@@ -0,0 +1,615 @@
+// Package usecase implements split bills for dine-in tabs and group orders
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Split bill errors
+var (
+	ErrInvalidSplit         = errors.New("invalid bill split")
+	ErrInvalidBillSource    = errors.New("this cannot be split")
+	ErrBillAccessDenied     = errors.New("bill can only be voided by the guest who split it")
+	ErrShareNotFound        = errors.New("bill share not found")
+	ErrShareAlreadyPaid     = errors.New("bill share is already paid")
+	ErrSharePaymentMismatch = errors.New("payment does not match the bill share")
+	ErrBillInProgress       = errors.New("a split bill is in progress for this tab")
+)
+
+// BillUsecase splits a tab or an unpaid order into separately paid shares
+type BillUsecase struct {
+	billRepo       *repository.BillRepository
+	refundRepo     *repository.RefundRepository
+	tableRepo      *repository.TableRepository
+	orderRepo      *repository.OrderRepository
+	paymentUsecase *PaymentUsecase
+	log            *logger.Logger
+}
+
+// NewBillUsecase creates a new bill usecase
+func NewBillUsecase(
+	billRepo *repository.BillRepository,
+	refundRepo *repository.RefundRepository,
+	tableRepo *repository.TableRepository,
+	orderRepo *repository.OrderRepository,
+	paymentUsecase *PaymentUsecase,
+	log *logger.Logger,
+) *BillUsecase {
+	return &BillUsecase{
+		billRepo:       billRepo,
+		refundRepo:     refundRepo,
+		tableRepo:      tableRepo,
+		orderRepo:      orderRepo,
+		paymentUsecase: paymentUsecase,
+		log:            log,
+	}
+}
+
+// ShareItemRequest assigns units of an order line to a share
+type ShareItemRequest struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Quantity    int       `json:"quantity"`
+}
+
+// ShareRequest describes one share of a split
+type ShareRequest struct {
+	Label  string             `json:"label"`
+	Amount int64              `json:"amount"` // Custom split only, paisa
+	Items  []ShareItemRequest `json:"items"`  // Split by items only
+}
+
+// CreateBillRequest contains the data needed to split a tab or order.
+// Equal splits only need the shares' labels (or Count shares without labels).
+type CreateBillRequest struct {
+	UserID     uuid.UUID             `json:"user_id"`
+	SourceType domain.BillSourceType `json:"source_type"`
+	SourceID   uuid.UUID             `json:"source_id"`
+	Mode       domain.SplitMode      `json:"mode"`
+	Count      int                   `json:"count"`
+	Shares     []ShareRequest        `json:"shares"`
+}
+
+// CreateBill splits a tab or an unpaid order. Splitting a tab also requests
+// its bill, so no more rounds can be added while the shares are being paid.
+func (u *BillUsecase) CreateBill(ctx context.Context, req CreateBillRequest) (*domain.Bill, error) {
+	orders, err := u.loadSource(ctx, req.UserID, req.SourceType, req.SourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var total, fees int64
+	items := make(map[uuid.UUID]domain.OrderItem)
+	for _, order := range orders {
+		total += order.TotalAmount
+		fees += order.DeliveryFee
+		for _, item := range order.Items {
+			items[item.ID] = item
+		}
+	}
+	if total <= 0 {
+		return nil, ErrTabEmpty
+	}
+
+	var shares []domain.BillShare
+	switch req.Mode {
+	case domain.SplitEqual:
+		shares, err = splitEqually(total, req.Count, req.Shares)
+	case domain.SplitByItems:
+		shares, err = splitByItems(items, fees, req.Shares)
+	case domain.SplitCustom:
+		shares, err = splitCustom(total, req.Shares)
+	default:
+		return nil, fmt.Errorf("%w: unknown split mode %q", ErrInvalidSplit, req.Mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bill := &domain.Bill{
+		SourceType:  req.SourceType,
+		SourceID:    req.SourceID,
+		Mode:        req.Mode,
+		TotalAmount: total,
+		CreatedBy:   req.UserID,
+		Shares:      shares,
+	}
+
+	if err := u.billRepo.Create(ctx, bill); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Bill split",
+		"bill_id", bill.ID.String(),
+		"source_type", bill.SourceType,
+		"source_id", bill.SourceID.String(),
+		"mode", bill.Mode,
+		"shares", len(bill.Shares),
+		"total", bill.TotalAmount,
+	)
+
+	return u.billRepo.GetByID(ctx, bill.ID)
+}
+
+// loadSource loads the orders covered by a split and checks they can still be split
+func (u *BillUsecase) loadSource(ctx context.Context, userID uuid.UUID, sourceType domain.BillSourceType, sourceID uuid.UUID) ([]domain.Order, error) {
+	switch sourceType {
+	case domain.BillSourceTableSession:
+		if err := u.tableRepo.CheckMember(ctx, sourceID, userID); err != nil {
+			return nil, err
+		}
+		session, err := u.tableRepo.GetSession(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		if session.Status == domain.TableSessionSettled {
+			return nil, repository.ErrBillSourcePaid
+		}
+		if session.RazorpayOrderID != "" {
+			return nil, repository.ErrTabPaymentOpen
+		}
+		return u.orderRepo.GetByTableSession(ctx, sourceID)
+
+	case domain.BillSourceOrder:
+		order, err := u.orderRepo.GetByID(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		if order.UserID != userID {
+			return nil, ErrOrderAccessDenied
+		}
+		if order.TableSessionID != nil {
+			return nil, ErrInvalidBillSource // Dine-in rounds are split with the whole tab
+		}
+		if order.Status.IsPaid() {
+			return nil, repository.ErrBillSourcePaid
+		}
+		return []domain.Order{*order}, nil
+	}
+
+	return nil, ErrInvalidBillSource
+}
+
+// checkShareCount validates how many ways a bill is split
+func checkShareCount(n int) error {
+	if n < 2 || n > domain.MaxBillShares {
+		return fmt.Errorf("%w: a bill is split between 2 and %d shares", ErrInvalidSplit, domain.MaxBillShares)
+	}
+	return nil
+}
+
+// divide splits amount into n parts, giving the remainder paisa to the first parts
+func divide(amount int64, n int) []int64 {
+	parts := make([]int64, n)
+	for i := range parts {
+		parts[i] = amount / int64(n)
+		if int64(i) < amount%int64(n) {
+			parts[i]++
+		}
+	}
+	return parts
+}
+
+func splitEqually(total int64, count int, requested []ShareRequest) ([]domain.BillShare, error) {
+	if len(requested) > 0 {
+		count = len(requested)
+	}
+	if err := checkShareCount(count); err != nil {
+		return nil, err
+	}
+	if total < int64(count) {
+		return nil, fmt.Errorf("%w: total is too small to split %d ways", ErrInvalidSplit, count)
+	}
+
+	shares := make([]domain.BillShare, count)
+	for i, amount := range divide(total, count) {
+		shares[i].Amount = amount
+		if i < len(requested) {
+			shares[i].Label = requested[i].Label
+		}
+	}
+	return shares, nil
+}
+
+// splitByItems prices each share from the order lines assigned to it. Every
+// unit must be assigned exactly once; delivery fees are shared equally.
+func splitByItems(items map[uuid.UUID]domain.OrderItem, fees int64, requested []ShareRequest) ([]domain.BillShare, error) {
+	if err := checkShareCount(len(requested)); err != nil {
+		return nil, err
+	}
+
+	assigned := make(map[uuid.UUID]int)
+	feeParts := divide(fees, len(requested))
+	shares := make([]domain.BillShare, len(requested))
+
+	for i, req := range requested {
+		shares[i].Label = req.Label
+		shares[i].Amount = feeParts[i]
+
+		seen := make(map[uuid.UUID]bool)
+		for _, line := range req.Items {
+			item, ok := items[line.OrderItemID]
+			if !ok {
+				return nil, fmt.Errorf("%w: item %s is not on this bill", ErrInvalidSplit, line.OrderItemID)
+			}
+			if line.Quantity <= 0 || seen[line.OrderItemID] {
+				return nil, fmt.Errorf("%w: invalid assignment of %s", ErrInvalidSplit, item.Name)
+			}
+			seen[line.OrderItemID] = true
+			assigned[line.OrderItemID] += line.Quantity
+
+			amount := item.Price * int64(line.Quantity)
+			shares[i].Amount += amount
+			shares[i].Items = append(shares[i].Items, domain.BillShareItem{
+				OrderItemID: item.ID,
+				Name:        item.DisplayName(),
+				Quantity:    line.Quantity,
+				Amount:      amount,
+			})
+		}
+
+		if shares[i].Amount <= 0 {
+			return nil, fmt.Errorf("%w: share %d has nothing to pay", ErrInvalidSplit, i+1)
+		}
+	}
+
+	for id, item := range items {
+		if assigned[id] != item.Quantity {
+			return nil, fmt.Errorf("%w: %d of %d %s assigned", ErrInvalidSplit, assigned[id], item.Quantity, item.Name)
+		}
+	}
+
+	return shares, nil
+}
+
+func splitCustom(total int64, requested []ShareRequest) ([]domain.BillShare, error) {
+	if err := checkShareCount(len(requested)); err != nil {
+		return nil, err
+	}
+
+	var sum int64
+	shares := make([]domain.BillShare, len(requested))
+	for i, req := range requested {
+		if req.Amount <= 0 {
+			return nil, fmt.Errorf("%w: share %d must be positive", ErrInvalidSplit, i+1)
+		}
+		sum += req.Amount
+		shares[i].Label = req.Label
+		shares[i].Amount = req.Amount
+	}
+
+	if sum != total {
+		return nil, fmt.Errorf("%w: shares add up to %d paisa, bill is %d paisa", ErrInvalidSplit, sum, total)
+	}
+
+	return shares, nil
+}
+
+// checkAccess allows only the tab's guests to see and pay the split of a
+// table tab. The split of an order can be shared with anyone by its link.
+func (u *BillUsecase) checkAccess(ctx context.Context, sourceType domain.BillSourceType, sourceID, userID uuid.UUID) error {
+	if sourceType != domain.BillSourceTableSession {
+		return nil
+	}
+	return u.tableRepo.CheckMember(ctx, sourceID, userID)
+}
+
+// GetBill retrieves a bill with its shares
+func (u *BillUsecase) GetBill(ctx context.Context, billID, userID uuid.UUID) (*domain.Bill, error) {
+	bill, err := u.billRepo.GetByID(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.checkAccess(ctx, bill.SourceType, bill.SourceID, userID); err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+// GetActiveBill retrieves the open or paid split bill of a tab or order
+func (u *BillUsecase) GetActiveBill(ctx context.Context, sourceType domain.BillSourceType, sourceID, userID uuid.UUID) (*domain.Bill, error) {
+	if err := u.checkAccess(ctx, sourceType, sourceID, userID); err != nil {
+		return nil, err
+	}
+
+	return u.billRepo.GetActiveBySource(ctx, sourceType, sourceID)
+}
+
+// findShare returns the share of a bill by ID
+func findShare(bill *domain.Bill, shareID uuid.UUID) (*domain.BillShare, error) {
+	for i := range bill.Shares {
+		if bill.Shares[i].ID == shareID {
+			return &bill.Shares[i], nil
+		}
+	}
+	return nil, ErrShareNotFound
+}
+
+// PayShare creates (or reuses) the gateway order for one share. Any guest
+// who can see the bill can pay any unpaid share.
+func (u *BillUsecase) PayShare(ctx context.Context, billID, shareID, userID uuid.UUID) (*InitiateOrderResponse, error) {
+	bill, err := u.GetBill(ctx, billID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	share, err := findShare(bill, shareID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bill.Status != domain.BillOpen {
+		return nil, repository.ErrBillNotOpen
+	}
+	if share.IsSettled() {
+		return nil, ErrShareAlreadyPaid
+	}
+
+	razorpayOrderID := share.RazorpayOrderID
+	if razorpayOrderID == "" {
+		razorpayOrderID, err = u.paymentUsecase.CreateGatewayOrder(share.Amount, share.ID.String(), map[string]interface{}{
+			"bill_id":  bill.ID.String(),
+			"share_id": share.ID.String(),
+		})
+		if err != nil {
+			u.log.Error("Failed to create Razorpay order for bill share", "error", err, "share_id", share.ID.String())
+			return nil, fmt.Errorf("failed to create payment order: %w", err)
+		}
+
+		err = u.billRepo.SetShareGatewayOrder(ctx, share.ID, razorpayOrderID)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Another guest started paying this share at the same time; use their order
+			return u.PayShare(ctx, billID, shareID, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &InitiateOrderResponse{
+		ID:              share.ID,
+		RazorpayOrderID: razorpayOrderID,
+		KeyID:           u.paymentUsecase.KeyID(),
+		Amount:          share.Amount,
+		Currency:        "INR",
+		Receipt:         share.ID.String(),
+		Name:            "Food Delivery",
+		Description:     fmt.Sprintf("Share %d of %d", share.Position, len(bill.Shares)),
+	}, nil
+}
+
+// VerifyShare records a share payment after the client's checkout success
+// callback. The webhook records it as well; whichever arrives first wins.
+func (u *BillUsecase) VerifyShare(ctx context.Context, billID, shareID, userID uuid.UUID, razorpayOrderID, paymentID, signature string) (*domain.Bill, error) {
+	bill, err := u.GetBill(ctx, billID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	share, err := findShare(bill, shareID)
+	if err != nil {
+		return nil, err
+	}
+
+	if razorpayOrderID == "" || razorpayOrderID != share.RazorpayOrderID {
+		return nil, ErrSharePaymentMismatch
+	}
+	if !u.paymentUsecase.VerifySignature(razorpayOrderID, paymentID, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	if err := u.capture(ctx, share.ID, paymentID); err != nil {
+		return nil, err
+	}
+
+	return u.billRepo.GetByID(ctx, billID)
+}
+
+// capture records a captured share payment and refunds it straight away if
+// the bill no longer needs it
+func (u *BillUsecase) capture(ctx context.Context, shareID uuid.UUID, paymentID string) error {
+	result, err := u.billRepo.CaptureShare(ctx, shareID, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to record share payment: %w", err)
+	}
+
+	if result.AlreadyProcessed {
+		return nil
+	}
+
+	log := u.log.WithFields(map[string]interface{}{
+		"bill_id":  result.BillID.String(),
+		"share_id": shareID.String(),
+	})
+
+	if result.SourceSettled {
+		// Tab or order was paid another way: the whole split is moot
+		log.Warn("Share paid after its tab or order was settled, voiding bill")
+		if err := u.billRepo.Void(ctx, result.BillID); err != nil && !errors.Is(err, repository.ErrBillNotOpen) {
+			return fmt.Errorf("failed to void bill: %w", err)
+		}
+	}
+
+	if result.Refund != nil {
+		log.Warn("Share paid for a bill that no longer needs it, refunding", "reason", result.Refund.Reason)
+		u.processRefunds(ctx, result.BillID)
+		return nil
+	}
+
+	if result.SoldOut {
+		log.Warn("Order sold out before its last share was paid, refunding all shares")
+		u.processRefunds(ctx, result.BillID)
+		return nil
+	}
+
+	log.Info("Bill share paid", "bill_paid", result.BillPaid)
+
+	return nil
+}
+
+// VoidBill cancels a bill and refunds the shares already paid. Only the guest
+// who split the bill or an admin may void it. Voiding again retries any
+// refund the gateway rejected.
+func (u *BillUsecase) VoidBill(ctx context.Context, billID, userID uuid.UUID, isAdmin bool) (*domain.Bill, error) {
+	bill, err := u.billRepo.GetByID(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && bill.CreatedBy != userID {
+		return nil, ErrBillAccessDenied
+	}
+
+	if err := u.billRepo.Void(ctx, billID); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Bill voided", "bill_id", billID.String(), "by", userID.String())
+
+	u.processRefunds(ctx, billID)
+
+	return u.billRepo.GetByID(ctx, billID)
+}
+
+// processRefunds sends the pending refunds of a bill's shares to the gateway.
+// Failures are recorded on the refund and retried on the next void.
+func (u *BillUsecase) processRefunds(ctx context.Context, billID uuid.UUID) {
+	bill, err := u.billRepo.GetByID(ctx, billID)
+	if err != nil {
+		u.log.Error("Failed to load bill for refunds", "error", err, "bill_id", billID.String())
+		return
+	}
+
+	shareIDs := make([]uuid.UUID, 0, len(bill.Shares))
+	for _, share := range bill.Shares {
+		if share.Status == domain.ShareStatusRefundPending {
+			shareIDs = append(shareIDs, share.ID)
+		}
+	}
+	if len(shareIDs) == 0 {
+		return
+	}
+
+	refunds, err := u.refundRepo.GetUnprocessedBySources(ctx, domain.RefundSourceBillShare, shareIDs)
+	if err != nil {
+		u.log.Error("Failed to load pending refunds", "error", err, "bill_id", billID.String())
+		return
+	}
+
+	for _, refund := range refunds {
+		log := u.log.WithFields(map[string]interface{}{
+			"bill_id":   billID.String(),
+			"share_id":  refund.SourceID.String(),
+			"refund_id": refund.ID.String(),
+		})
+
+		razorpayRefundID, err := u.paymentUsecase.RefundPayment(refund.RazorpayPaymentID, refund.Amount, map[string]interface{}{
+			"bill_id":  billID.String(),
+			"share_id": refund.SourceID.String(),
+			"reason":   refund.Reason,
+		})
+		if err != nil {
+			log.Error("Refund failed", "error", err)
+			if markErr := u.refundRepo.MarkFailed(ctx, refund.ID, err.Error()); markErr != nil {
+				log.Error("Failed to record refund failure", "error", markErr)
+			}
+			continue
+		}
+
+		if err := u.billRepo.CompleteShareRefund(ctx, refund.ID, refund.SourceID, razorpayRefundID); err != nil {
+			log.Error("Failed to record refund", "error", err, "razorpay_refund_id", razorpayRefundID)
+			continue
+		}
+
+		log.Info("Share refunded", "amount", refund.Amount, "razorpay_refund_id", razorpayRefundID)
+	}
+}
+
+// HandleEvent sends the refunds of the shares already paid when a tab or
+// order being split is paid some other way; the payment voided its bill.
+// Refunds already sent are skipped, so redelivered events are harmless.
+func (u *BillUsecase) HandleEvent(ctx context.Context, event domain.OutboxEvent) error {
+	if event.Type != domain.EventOrderPaid {
+		return nil
+	}
+
+	var paid domain.OrderPaidEvent
+	if err := json.Unmarshal(event.Payload, &paid); err != nil {
+		u.log.Error("Skipping unreadable event", "event_id", event.ID, "event_type", string(event.Type), "error", err)
+		return nil
+	}
+
+	// Table rounds are split and paid with their whole tab
+	sourceType, sourceID := domain.BillSourceOrder, event.AggregateID
+	if paid.TableSessionID != nil {
+		sourceType, sourceID = domain.BillSourceTableSession, *paid.TableSessionID
+	}
+
+	billIDs, err := u.billRepo.GetWithPendingRefunds(ctx, sourceType, sourceID)
+	if err != nil {
+		return err
+	}
+
+	for _, billID := range billIDs {
+		u.log.Warn("Paid while being split, refunding paid shares",
+			"source_type", sourceType,
+			"source_id", sourceID.String(),
+			"bill_id", billID.String(),
+		)
+		u.processRefunds(ctx, billID)
+	}
+
+	return nil
+}
+
+// OnPaymentCaptured records a share paid through the gateway (webhook)
+func (u *BillUsecase) OnPaymentCaptured(ctx context.Context, payment GatewayPayment) (bool, error) {
+	share, err := u.billRepo.GetShareByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	if payment.Amount != share.Amount {
+		u.log.Error("Captured amount does not match bill share",
+			"share_id", share.ID.String(),
+			"captured", payment.Amount,
+			"share_amount", share.Amount,
+		)
+		return true, ErrSharePaymentMismatch
+	}
+
+	return true, u.capture(ctx, share.ID, payment.ID)
+}
+
+// OnPaymentFailed marks the share as failed so it can be paid again
+func (u *BillUsecase) OnPaymentFailed(ctx context.Context, payment GatewayPayment) (bool, error) {
+	share, err := u.billRepo.GetShareByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	u.log.Warn("Bill share payment failed",
+		"share_id", share.ID.String(),
+		"bill_id", share.BillID.String(),
+		"error_code", payment.ErrorCode,
+		"error_desc", payment.ErrorDesc,
+	)
+
+	return true, u.billRepo.MarkShareFailed(ctx, share.ID)
+}
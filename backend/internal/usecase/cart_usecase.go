@@ -0,0 +1,233 @@
+// Package usecase implements the server-side shopping cart
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+	"fooddelivery/pkg/redis"
+)
+
+// Cart errors
+var (
+	ErrCartFull         = errors.New("cart is full")
+	ErrCartLineNotFound = errors.New("cart item not found")
+	ErrCartEmpty        = errors.New("cart is empty")
+)
+
+// CartUsecase keeps each user's cart in Redis so web and mobile share it
+type CartUsecase struct {
+	paymentUsecase *PaymentUsecase
+	redisClient    *redis.Client
+	log            *logger.Logger
+}
+
+// NewCartUsecase creates a new cart usecase
+func NewCartUsecase(paymentUsecase *PaymentUsecase, redisClient *redis.Client, log *logger.Logger) *CartUsecase {
+	return &CartUsecase{
+		paymentUsecase: paymentUsecase,
+		redisClient:    redisClient,
+		log:            log,
+	}
+}
+
+func cartKey(userID uuid.UUID) string {
+	return redis.CartPrefix + userID.String()
+}
+
+// GetCart retrieves the user's cart; every read keeps it alive for another CartTTL
+func (u *CartUsecase) GetCart(ctx context.Context, userID uuid.UUID) (*domain.Cart, error) {
+	cart := &domain.Cart{}
+	found, err := u.redisClient.GetAndExtendTTL(ctx, cartKey(userID), cart, redis.CartTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cart: %w", err)
+	}
+
+	if !found {
+		cart.UserID = userID
+	}
+	if cart.Items == nil {
+		cart.Items = []domain.CartLine{}
+	}
+
+	return cart, nil
+}
+
+// update applies change to the stored cart atomically and bumps its version
+func (u *CartUsecase) update(ctx context.Context, userID uuid.UUID, change func(cart *domain.Cart) error) (*domain.Cart, error) {
+	cart := &domain.Cart{}
+	err := u.redisClient.UpdateJSON(ctx, cartKey(userID), cart, redis.CartTTL, func(found bool) error {
+		cart.UserID = userID
+		if err := change(cart); err != nil {
+			return err
+		}
+		cart.Version++
+		cart.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cart.Items == nil {
+		cart.Items = []domain.CartLine{}
+	}
+	return cart, nil
+}
+
+// AddItem adds a line to the cart. A line for the same item, variant,
+// modifiers and bundle choices with the same notes is merged into the existing one.
+func (u *CartUsecase) AddItem(ctx context.Context, userID uuid.UUID, item domain.CartItem) (*domain.Cart, error) {
+	// Same validation and availability checks as checkout
+	items, _, err := validateCart([]domain.CartItem{item}, "")
+	if err != nil {
+		return nil, err
+	}
+	priced, _, err := u.paymentUsecase.priceCart(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	item = items[0]
+
+	return u.update(ctx, userID, func(cart *domain.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].MenuItemID == item.MenuItemID && cart.Items[i].Notes == item.Notes &&
+				variantKey(cart.Items[i].VariantID) == variantKey(item.VariantID) &&
+				modifierKey(cart.Items[i].ModifierIDs) == modifierKey(item.ModifierIDs) &&
+				bundleKey(cart.Items[i].BundleChoices) == bundleKey(item.BundleChoices) {
+				cart.Items[i].Quantity += item.Quantity
+				return nil
+			}
+		}
+
+		if len(cart.Items) >= domain.MaxCartLines {
+			return ErrCartFull
+		}
+
+		cart.Items = append(cart.Items, domain.CartLine{
+			ID:       uuid.New(),
+			CartItem: item,
+			Name:     priced[0].Name,
+		})
+		return nil
+	})
+}
+
+// UpdateItem changes the quantity and notes of a cart line
+func (u *CartUsecase) UpdateItem(ctx context.Context, userID, lineID uuid.UUID, quantity int, rawNotes string) (*domain.Cart, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidCart
+	}
+
+	notes, err := sanitizeNotes(rawNotes, domain.MaxItemNotesLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.update(ctx, userID, func(cart *domain.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].ID == lineID {
+				cart.Items[i].Quantity = quantity
+				cart.Items[i].Notes = notes
+				return nil
+			}
+		}
+		return ErrCartLineNotFound
+	})
+}
+
+// RemoveItem removes a line from the cart
+func (u *CartUsecase) RemoveItem(ctx context.Context, userID, lineID uuid.UUID) (*domain.Cart, error) {
+	return u.update(ctx, userID, func(cart *domain.Cart) error {
+		for i := range cart.Items {
+			if cart.Items[i].ID == lineID {
+				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				return nil
+			}
+		}
+		return ErrCartLineNotFound
+	})
+}
+
+// Clear empties the cart
+func (u *CartUsecase) Clear(ctx context.Context, userID uuid.UUID) (*domain.Cart, error) {
+	return u.update(ctx, userID, func(cart *domain.Cart) error {
+		cart.Items = []domain.CartLine{}
+		return nil
+	})
+}
+
+// Quote prices the stored cart without creating an order
+func (u *CartUsecase) Quote(ctx context.Context, userID uuid.UUID, fulfillment domain.FulfillmentType) (*domain.Quote, error) {
+	cart, err := u.GetCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.paymentUsecase.QuoteCart(ctx, cart.Items, fulfillment)
+}
+
+// CartCheckoutRequest contains the order details for checking out the stored cart
+type CartCheckoutRequest struct {
+	UserID          uuid.UUID              `json:"-"`
+	Version         int                    `json:"version"` // Cart version the user reviewed, 0 to skip the check
+	Notes           string                 `json:"notes"`
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"`
+	DeliveryAddress string                 `json:"delivery_address"`
+}
+
+// Checkout creates an order from the stored cart and empties the cart.
+// If the cart changed on another device since the user reviewed it
+// (Version), checkout fails with ErrVersionConflict instead of ordering
+// something the user has not seen.
+func (u *CartUsecase) Checkout(ctx context.Context, req CartCheckoutRequest) (*InitiateOrderResponse, error) {
+	cart, err := u.GetCart(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Version != 0 && req.Version != cart.Version {
+		return nil, repository.ErrVersionConflict
+	}
+	if len(cart.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	items := make([]domain.CartItem, len(cart.Items))
+	for i, line := range cart.Items {
+		items[i] = line.CartItem
+	}
+
+	response, err := u.paymentUsecase.InitiateOrder(ctx, InitiateOrderRequest{
+		UserID:          req.UserID,
+		Items:           items,
+		Notes:           req.Notes,
+		FulfillmentType: req.FulfillmentType,
+		DeliveryAddress: req.DeliveryAddress,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only empty the cart if it still holds what was ordered
+	_, err = u.update(ctx, req.UserID, func(current *domain.Cart) error {
+		if current.Version != cart.Version {
+			return repository.ErrVersionConflict
+		}
+		current.Items = []domain.CartLine{}
+		return nil
+	})
+	if err != nil {
+		// The order exists; a cart that could not be cleared is not worth failing checkout for
+		u.log.Warn("Cart not cleared after checkout", "error", err, "user_id", req.UserID.String(), "order_id", response.ID.String())
+	}
+
+	return response, nil
+}
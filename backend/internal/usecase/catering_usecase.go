@@ -0,0 +1,468 @@
+// Package usecase implements catering and bulk order quotes
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Catering errors
+var (
+	ErrInvalidCateringRequest = errors.New("invalid catering request")
+	ErrInvalidQuote           = errors.New("invalid catering quote")
+	ErrCateringAccessDenied   = errors.New("catering request does not belong to user")
+	ErrQuoteVersionRequired   = errors.New("version of the quote being accepted is required")
+)
+
+// CateringUsecase runs the quote workflow for event orders. The food is
+// recorded on the request; the advance and the balance are collected as
+// item-less orders paid through the usual order payment flow.
+type CateringUsecase struct {
+	cateringRepo   *repository.CateringRepository
+	orderRepo      *repository.OrderRepository
+	menuRepo       *repository.MenuRepository
+	paymentUsecase *PaymentUsecase
+	location       *time.Location
+	log            *logger.Logger
+}
+
+// NewCateringUsecase creates a new catering usecase
+func NewCateringUsecase(
+	cateringRepo *repository.CateringRepository,
+	orderRepo *repository.OrderRepository,
+	menuRepo *repository.MenuRepository,
+	paymentUsecase *PaymentUsecase,
+	location *time.Location,
+	log *logger.Logger,
+) *CateringUsecase {
+	return &CateringUsecase{
+		cateringRepo:   cateringRepo,
+		orderRepo:      orderRepo,
+		menuRepo:       menuRepo,
+		paymentUsecase: paymentUsecase,
+		location:       location,
+		log:            log,
+	}
+}
+
+// SubmitCateringRequest contains what the customer asks to be quoted
+type SubmitCateringRequest struct {
+	UserID    uuid.UUID         `json:"-"`
+	EventDate string            `json:"event_date"` // YYYY-MM-DD
+	Headcount int               `json:"headcount"`
+	Venue     string            `json:"venue"`
+	Notes     string            `json:"notes"`
+	Items     []domain.CartItem `json:"items"`
+}
+
+// SubmitRequest records a catering request for the kitchen to quote.
+// Items are priced at today's menu prices as a starting point for the quote.
+func (u *CateringUsecase) SubmitRequest(ctx context.Context, req SubmitCateringRequest) (*domain.CateringRequest, error) {
+	eventDate, err := time.ParseInLocation("2006-01-02", req.EventDate, u.location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: event_date must be YYYY-MM-DD", ErrInvalidCateringRequest)
+	}
+
+	now := time.Now().In(u.location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, u.location)
+	if eventDate.Before(today.AddDate(0, 0, domain.CateringLeadDays)) {
+		return nil, fmt.Errorf("%w: events must be at least %d days away", ErrInvalidCateringRequest, domain.CateringLeadDays)
+	}
+
+	if req.Headcount < domain.MinCateringHeadcount || req.Headcount > domain.MaxCateringHeadcount {
+		return nil, fmt.Errorf("%w: headcount must be between %d and %d",
+			ErrInvalidCateringRequest, domain.MinCateringHeadcount, domain.MaxCateringHeadcount)
+	}
+
+	venue, err := sanitizeNotes(req.Venue, domain.MaxDeliveryAddressLength)
+	if err != nil || venue == "" {
+		return nil, fmt.Errorf("%w: a venue of up to %d characters is required", ErrInvalidCateringRequest, domain.MaxDeliveryAddressLength)
+	}
+
+	if len(req.Items) > domain.MaxCartLines {
+		return nil, fmt.Errorf("%w: at most %d items", ErrInvalidCateringRequest, domain.MaxCartLines)
+	}
+	items, notes, err := validateCart(req.Items, req.Notes)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Quantity > domain.MaxCateringQuantity {
+			return nil, fmt.Errorf("%w: at most %d of an item", ErrInvalidCateringRequest, domain.MaxCateringQuantity)
+		}
+	}
+
+	orderItems, _, err := u.paymentUsecase.priceCart(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &domain.CateringRequest{
+		UserID:    req.UserID,
+		EventDate: req.EventDate,
+		Headcount: req.Headcount,
+		Venue:     venue,
+		Notes:     notes,
+		Items:     orderItems,
+	}
+
+	if err := u.cateringRepo.Create(ctx, request, eventDate); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Catering request submitted",
+		"catering_request_id", request.ID.String(),
+		"event_date", request.EventDate,
+		"headcount", request.Headcount,
+	)
+
+	return request, nil
+}
+
+// GetRequest returns a catering request to its owner or an admin
+func (u *CateringUsecase) GetRequest(ctx context.Context, userID, requestID uuid.UUID, isAdmin bool) (*domain.CateringRequest, error) {
+	request, err := u.cateringRepo.GetByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && request.UserID != userID {
+		return nil, ErrCateringAccessDenied
+	}
+
+	return request, nil
+}
+
+// GetUserRequests returns a customer's catering requests
+func (u *CateringUsecase) GetUserRequests(ctx context.Context, userID uuid.UUID) ([]domain.CateringRequest, error) {
+	return u.cateringRepo.GetByUserID(ctx, userID)
+}
+
+// ListRequests returns requests by status for the admin; by default the
+// ones still needing attention (to quote, awaiting the customer, or accepted)
+func (u *CateringUsecase) ListRequests(ctx context.Context, statuses []string) ([]domain.CateringRequest, error) {
+	filter := []domain.CateringStatus{domain.CateringRequested, domain.CateringQuoted, domain.CateringAccepted}
+	if len(statuses) > 0 {
+		filter = make([]domain.CateringStatus, 0, len(statuses))
+		for _, s := range statuses {
+			status := domain.CateringStatus(s)
+			if !status.IsValid() {
+				return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, s)
+			}
+			filter = append(filter, status)
+		}
+	}
+
+	return u.cateringRepo.GetByStatuses(ctx, filter)
+}
+
+// QuoteLineRequest is one line of an admin quote
+type QuoteLineRequest struct {
+	MenuItemID uuid.UUID `json:"menu_item_id"`
+	Quantity   int       `json:"quantity"`
+	UnitPrice  int64     `json:"unit_price"` // Paisa; 0 keeps the menu price
+	Notes      string    `json:"notes"`
+}
+
+// QuoteCateringRequest contains the admin's quote
+type QuoteCateringRequest struct {
+	Version        int                `json:"version"`
+	Lines          []QuoteLineRequest `json:"lines"`           // Empty quotes the requested items as they are
+	AdvancePercent int                `json:"advance_percent"` // Defaults to domain.DefaultCateringAdvance
+	ValidDays      int                `json:"valid_days"`      // Defaults to domain.CateringQuoteValidity
+	Note           string             `json:"note"`
+}
+
+// QuoteRequest prices a request by hand. Quoting again replaces the previous
+// quote until the customer accepts.
+func (u *CateringUsecase) QuoteRequest(ctx context.Context, adminID, requestID uuid.UUID, req QuoteCateringRequest) (*domain.CateringRequest, error) {
+	request, err := u.cateringRepo.GetByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := request.Items
+	if len(req.Lines) > 0 {
+		lines, err = u.priceQuoteLines(ctx, req.Lines)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var total int64
+	for _, line := range lines {
+		total += line.Subtotal()
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%w: the quote total must be positive", ErrInvalidQuote)
+	}
+
+	percent := req.AdvancePercent
+	if percent == 0 {
+		percent = domain.DefaultCateringAdvance
+	}
+	if percent < 1 || percent > 100 {
+		return nil, fmt.Errorf("%w: advance_percent must be between 1 and 100", ErrInvalidQuote)
+	}
+
+	validity := domain.CateringQuoteValidity
+	if req.ValidDays < 0 {
+		return nil, fmt.Errorf("%w: valid_days cannot be negative", ErrInvalidQuote)
+	}
+	if req.ValidDays > 0 {
+		validity = time.Duration(req.ValidDays) * 24 * time.Hour
+	}
+	validUntil := time.Now().Add(validity)
+
+	note, err := sanitizeNotes(req.Note, domain.MaxOrderNotesLength)
+	if err != nil {
+		return nil, fmt.Errorf("%w: note is too long", ErrInvalidQuote)
+	}
+
+	version := req.Version
+	if version == 0 {
+		version = request.Version
+	}
+
+	quote := &domain.CateringRequest{
+		ID:              request.ID,
+		QuoteLines:      lines,
+		QuoteTotal:      total,
+		AdvancePercent:  percent,
+		AdvanceAmount:   domain.AdvanceFor(total, percent),
+		QuoteNote:       note,
+		QuoteValidUntil: &validUntil,
+		QuotedBy:        &adminID,
+	}
+	if err := u.cateringRepo.Quote(ctx, quote, version); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Catering request quoted",
+		"catering_request_id", request.ID.String(),
+		"admin_id", adminID.String(),
+		"total", total,
+		"advance", quote.AdvanceAmount,
+	)
+
+	return u.cateringRepo.GetByID(ctx, requestID)
+}
+
+// priceQuoteLines builds quote lines from the admin's lines. Unlike the cart,
+// items that are sold out today can be quoted for a later event.
+func (u *CateringUsecase) priceQuoteLines(ctx context.Context, requested []QuoteLineRequest) ([]domain.OrderItem, error) {
+	if len(requested) > domain.MaxCartLines {
+		return nil, fmt.Errorf("%w: at most %d lines", ErrInvalidQuote, domain.MaxCartLines)
+	}
+
+	ids := make([]uuid.UUID, 0, len(requested))
+	seen := make(map[uuid.UUID]struct{}, len(requested))
+	for _, line := range requested {
+		if line.Quantity <= 0 || line.Quantity > domain.MaxCateringQuantity || line.UnitPrice < 0 || line.MenuItemID == uuid.Nil {
+			return nil, fmt.Errorf("%w: each line needs a menu item, a quantity up to %d and a non-negative price",
+				ErrInvalidQuote, domain.MaxCateringQuantity)
+		}
+		if _, ok := seen[line.MenuItemID]; !ok {
+			seen[line.MenuItemID] = struct{}{}
+			ids = append(ids, line.MenuItemID)
+		}
+	}
+
+	menuItems, err := u.menuRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch menu items: %w", err)
+	}
+	if len(menuItems) != len(ids) {
+		return nil, fmt.Errorf("%w: unknown menu item", ErrInvalidQuote)
+	}
+	menuByID := make(map[uuid.UUID]domain.MenuItem, len(menuItems))
+	for _, menuItem := range menuItems {
+		menuByID[menuItem.ID] = menuItem
+	}
+
+	lines := make([]domain.OrderItem, 0, len(requested))
+	for _, line := range requested {
+		notes, err := sanitizeNotes(line.Notes, domain.MaxItemNotesLength)
+		if err != nil {
+			return nil, err
+		}
+
+		menuItem := menuByID[line.MenuItemID]
+		price := menuItem.Price
+		if line.UnitPrice > 0 {
+			price = line.UnitPrice
+		}
+
+		lines = append(lines, domain.OrderItem{
+			MenuItemID: menuItem.ID,
+			Name:       menuItem.Name,
+			Price:      price,
+			Quantity:   line.Quantity,
+			Notes:      notes,
+		})
+	}
+
+	return lines, nil
+}
+
+// AcceptQuote accepts the current quote and creates the advance order.
+// Version is the request version the customer saw, so a quote revised in
+// the meantime is never accepted unseen.
+func (u *CateringUsecase) AcceptQuote(ctx context.Context, userID, requestID uuid.UUID, version int) (*domain.CateringRequest, error) {
+	if version <= 0 {
+		return nil, ErrQuoteVersionRequired
+	}
+
+	request, err := u.GetRequest(ctx, userID, requestID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	advance := u.paymentOrder(request, request.AdvanceAmount, "advance")
+	if err := u.cateringRepo.Accept(ctx, requestID, version, advance); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Catering quote accepted",
+		"catering_request_id", requestID.String(),
+		"advance_order_id", advance.ID.String(),
+	)
+
+	return u.cateringRepo.GetByID(ctx, requestID)
+}
+
+// paymentOrder builds an item-less order collecting part of a quote
+func (u *CateringUsecase) paymentOrder(request *domain.CateringRequest, amount int64, part string) *domain.Order {
+	return &domain.Order{
+		UserID:          request.UserID,
+		Status:          domain.OrderStatusPending,
+		TotalAmount:     amount,
+		FulfillmentType: domain.FulfillmentDelivery,
+		DeliveryAddress: request.Venue,
+		Notes:           fmt.Sprintf("Catering %s for %s (%d guests)", part, request.EventDate, request.Headcount),
+		Items:           []domain.OrderItem{},
+	}
+}
+
+// DeclineQuote declines the current quote, closing the request
+func (u *CateringUsecase) DeclineQuote(ctx context.Context, userID, requestID uuid.UUID, version int) (*domain.CateringRequest, error) {
+	if _, err := u.GetRequest(ctx, userID, requestID, false); err != nil {
+		return nil, err
+	}
+
+	return u.close(ctx, requestID, version, domain.CateringDeclined)
+}
+
+// CancelRequest cancels a request that has not been accepted yet. Once a
+// quote is accepted the advance order exists and the event is arranged with
+// the kitchen directly.
+func (u *CateringUsecase) CancelRequest(ctx context.Context, userID, requestID uuid.UUID, version int, isAdmin bool) (*domain.CateringRequest, error) {
+	if _, err := u.GetRequest(ctx, userID, requestID, isAdmin); err != nil {
+		return nil, err
+	}
+
+	return u.close(ctx, requestID, version, domain.CateringCancelled)
+}
+
+func (u *CateringUsecase) close(ctx context.Context, requestID uuid.UUID, version int, to domain.CateringStatus) (*domain.CateringRequest, error) {
+	if err := u.cateringRepo.Close(ctx, requestID, version, to); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Catering request closed", "catering_request_id", requestID.String(), "status", string(to))
+
+	return u.cateringRepo.GetByID(ctx, requestID)
+}
+
+// Pay starts the payment of whatever is due next on an accepted request: the
+// advance, then the balance. The returned order is verified with
+// POST /orders/verify like any other order.
+func (u *CateringUsecase) Pay(ctx context.Context, userID, requestID uuid.UUID) (*InitiateOrderResponse, error) {
+	request, err := u.GetRequest(ctx, userID, requestID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Status != domain.CateringAccepted {
+		return nil, repository.ErrCateringClosed
+	}
+
+	var orderID uuid.UUID
+	part := "advance"
+	switch {
+	case request.Payment == domain.CateringFullyPaid:
+		return nil, repository.ErrNothingToCollect
+	case request.Payment == domain.CateringUnpaid:
+		orderID = *request.AdvanceOrderID
+	case request.BalanceOrderID != nil:
+		orderID = *request.BalanceOrderID
+		part = "balance"
+	default:
+		balance := u.paymentOrder(request, request.BalanceAmount(), "balance")
+		err := u.cateringRepo.CreateBalanceOrder(ctx, requestID, balance)
+		if errors.Is(err, repository.ErrNothingToCollect) || errors.Is(err, repository.ErrVersionConflict) {
+			// Created concurrently; pick it up
+			return u.Pay(ctx, userID, requestID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		orderID = balance.ID
+		part = "balance"
+	}
+
+	return u.initiatePayment(ctx, orderID, part)
+}
+
+// initiatePayment creates (or reuses) the gateway order of a catering order
+func (u *CateringUsecase) initiatePayment(ctx context.Context, orderID uuid.UUID, part string) (*InitiateOrderResponse, error) {
+	order, err := u.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status.IsPaid() {
+		return nil, ErrOrderAlreadyPaid
+	}
+
+	razorpayOrderID := order.RazorpayOrderID
+	if razorpayOrderID == "" {
+		razorpayOrderID, err = u.paymentUsecase.CreateGatewayOrder(order.TotalAmount, order.ID.String(), map[string]interface{}{
+			"order_id":            order.ID.String(),
+			"user_id":             order.UserID.String(),
+			"catering_request_id": order.CateringRequestID.String(),
+		})
+		if err != nil {
+			u.log.Error("Failed to create Razorpay order for catering payment", "error", err, "order_id", order.ID.String())
+			return nil, fmt.Errorf("failed to create payment order: %w", err)
+		}
+
+		err = u.orderRepo.SetRazorpayOrderID(ctx, order.ID, razorpayOrderID, order.Version)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Paid for from another tab at the same time; use that gateway order
+			return u.initiatePayment(ctx, orderID, part)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &InitiateOrderResponse{
+		ID:              order.ID,
+		RazorpayOrderID: razorpayOrderID,
+		KeyID:           u.paymentUsecase.KeyID(),
+		Amount:          order.TotalAmount,
+		Currency:        "INR",
+		Receipt:         order.ID.String(),
+		Name:            "Food Delivery",
+		Description:     fmt.Sprintf("Catering %s #%s", part, order.ID.String()[:8]),
+		FulfillmentType: order.FulfillmentType,
+	}, nil
+}
@@ -0,0 +1,447 @@
+// Package usecase implements CSV and XLSX report exports
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/export"
+	"fooddelivery/pkg/logger"
+)
+
+// Export errors
+var (
+	ErrInvalidExport  = errors.New("invalid export")
+	ErrExportNotReady = errors.New("export is not ready")
+)
+
+// Export worker settings
+const (
+	exportWorkerInterval = 30 * time.Second
+	exportJobLease       = 30 * time.Minute // A running job is taken over after this
+	exportCleanInterval  = time.Hour
+	defaultExportJobs    = 20
+	maxExportJobs        = 100
+)
+
+// ExportRequest selects a report. Large reports, or any report with Async
+// set, are written in the background.
+type ExportRequest struct {
+	Kind   domain.ExportKind
+	Format export.Format
+	Range  AnalyticsRange
+	Async  bool
+}
+
+// ExportStream is a report small enough to stream in the response
+type ExportStream struct {
+	FileName    string
+	ContentType string
+	Rows        int64
+
+	write func(ctx context.Context, w io.Writer) (int64, error)
+}
+
+// WriteTo writes the report to w. Returns the rows written.
+func (s *ExportStream) WriteTo(ctx context.Context, w io.Writer) (int64, error) {
+	return s.write(ctx, w)
+}
+
+// ExportUsecase writes orders, item sales and payment logs as CSV or XLSX.
+// Rows are streamed from the database to the output, so memory use does not
+// grow with the report. Timestamps are written in the business timezone.
+type ExportUsecase struct {
+	exportRepo *repository.ExportRepository
+	config     config.ExportConfig
+	location   *time.Location
+	wake       chan struct{}
+	log        *logger.Logger
+}
+
+// NewExportUsecase creates a new export usecase
+func NewExportUsecase(exportRepo *repository.ExportRepository, cfg config.ExportConfig, location *time.Location, log *logger.Logger) *ExportUsecase {
+	return &ExportUsecase{
+		exportRepo: exportRepo,
+		config:     cfg,
+		location:   location,
+		wake:       make(chan struct{}, 1),
+		log:        log,
+	}
+}
+
+// Export validates a request and either returns the report to stream, or
+// queues a background job for it when it has more than EXPORT_SYNC_MAX_ROWS
+// rows or is asked to run async. Exactly one of the results is non-nil.
+func (u *ExportUsecase) Export(ctx context.Context, req ExportRequest, requestedBy uuid.UUID) (*ExportStream, *domain.ExportJob, error) {
+	if !req.Kind.IsValid() {
+		return nil, nil, fmt.Errorf("%w: report must be orders, items or payments", ErrInvalidExport)
+	}
+	if req.Format == "" {
+		req.Format = export.FormatCSV
+	}
+	if !req.Format.IsValid() {
+		return nil, nil, fmt.Errorf("%w: format must be csv or xlsx", ErrInvalidExport)
+	}
+
+	from, to, err := resolveDateRange(req.Range, u.location, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !req.Async {
+		rows, err := u.exportRepo.CountRows(ctx, req.Kind, from, to, u.location.String())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if rows <= u.config.SyncMaxRows {
+			kind, format := req.Kind, req.Format
+			return &ExportStream{
+				FileName:    u.fileName(kind, format, from, to),
+				ContentType: format.ContentType(),
+				Rows:        rows,
+				write: func(ctx context.Context, w io.Writer) (int64, error) {
+					return u.write(ctx, kind, format, from, to, w)
+				},
+			}, nil, nil
+		}
+	}
+
+	job := &domain.ExportJob{
+		RequestedBy: requestedBy,
+		Kind:        req.Kind,
+		Format:      string(req.Format),
+		From:        from,
+		To:          to,
+	}
+	if err := u.exportRepo.CreateJob(ctx, job); err != nil {
+		return nil, nil, err
+	}
+	job.FileName = u.fileName(job.Kind, req.Format, from, to)
+
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+
+	return nil, job, nil
+}
+
+// GetJob retrieves a background export
+func (u *ExportUsecase) GetJob(ctx context.Context, id uuid.UUID) (*domain.ExportJob, error) {
+	job, err := u.exportRepo.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	job.FileName = u.fileName(job.Kind, export.Format(job.Format), job.From, job.To)
+	return job, nil
+}
+
+// ListJobs lists the newest background exports
+func (u *ExportUsecase) ListJobs(ctx context.Context, limit int) ([]domain.ExportJob, error) {
+	if limit <= 0 {
+		limit = defaultExportJobs
+	}
+	if limit > maxExportJobs {
+		limit = maxExportJobs
+	}
+
+	jobs, err := u.exportRepo.ListJobs(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	if jobs == nil {
+		jobs = []domain.ExportJob{}
+	}
+	for i := range jobs {
+		jobs[i].FileName = u.fileName(jobs[i].Kind, export.Format(jobs[i].Format), jobs[i].From, jobs[i].To)
+	}
+
+	return jobs, nil
+}
+
+// GetDownload returns a finished export with the path of its file
+func (u *ExportUsecase) GetDownload(ctx context.Context, id uuid.UUID) (*domain.ExportJob, error) {
+	job, err := u.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != domain.ExportDone {
+		return nil, fmt.Errorf("%w: export is %s", ErrExportNotReady, job.Status)
+	}
+	if job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt) {
+		return nil, repository.ErrNotFound
+	}
+	if _, err := os.Stat(job.FilePath); err != nil {
+		// Another instance wrote it to storage this one cannot see
+		return nil, fmt.Errorf("export file of job %s is missing: %w", job.ID, err)
+	}
+
+	return job, nil
+}
+
+// fileName is the download name of a report, e.g. orders_2024-05-01_2024-05-31.csv
+func (u *ExportUsecase) fileName(kind domain.ExportKind, format export.Format, from, to time.Time) string {
+	last := to.Add(-time.Nanosecond).In(u.location)
+	return fmt.Sprintf("%s_%s_%s.%s", kind, from.In(u.location).Format("2006-01-02"), last.Format("2006-01-02"), format)
+}
+
+// write streams a report to w. Returns the data rows written.
+func (u *ExportUsecase) write(ctx context.Context, kind domain.ExportKind, format export.Format, from, to time.Time, w io.Writer) (int64, error) {
+	var rows int64
+
+	switch kind {
+	case domain.ExportOrders:
+		out, err := export.NewWriter(format, w, "Orders")
+		if err != nil {
+			return 0, err
+		}
+		if err := out.WriteHeader("Order ID", "Placed At", "Paid At", "Status", "Fulfillment", "Customer", "Phone", "Email",
+			"Razorpay Order ID", "Razorpay Payment ID", "Order Total", "Delivery Fee", "Item", "Quantity", "Unit Price", "Line Total"); err != nil {
+			return 0, err
+		}
+
+		err = u.exportRepo.StreamOrderLines(ctx, from, to, func(l *domain.OrderExportLine) error {
+			var paidAt time.Time
+			if l.PaidAt != nil {
+				paidAt = *l.PaidAt
+			}
+			rows++
+			return out.WriteRow(
+				export.String(l.OrderID.String()),
+				export.Time(l.CreatedAt, u.location),
+				export.Time(paidAt, u.location),
+				export.String(string(l.Status)),
+				export.String(string(l.FulfillmentType)),
+				export.String(l.CustomerName),
+				export.String(l.CustomerPhone),
+				export.String(l.CustomerEmail),
+				export.String(l.RazorpayOrderID),
+				export.String(l.RazorpayPaymentID),
+				export.Money(l.TotalAmount),
+				export.Money(l.DeliveryFee),
+				export.String(l.ItemName),
+				export.Int(l.Quantity),
+				export.Money(l.UnitPrice),
+				export.Money(l.UnitPrice*l.Quantity),
+			)
+		})
+		if err != nil {
+			return rows, err
+		}
+		return rows, out.Close()
+
+	case domain.ExportItems:
+		out, err := export.NewWriter(format, w, "Item Sales")
+		if err != nil {
+			return 0, err
+		}
+		if err := out.WriteHeader("Day", "Menu Item ID", "Item", "Category", "Quantity", "Revenue", "Orders"); err != nil {
+			return 0, err
+		}
+
+		err = u.exportRepo.StreamItemSales(ctx, from, to, u.location.String(), func(s *domain.ItemSalesExportRow) error {
+			rows++
+			return out.WriteRow(
+				// Days come back as local wall-clock times
+				export.String(s.Day.Format("2006-01-02")),
+				export.String(s.MenuItemID.String()),
+				export.String(s.Name),
+				export.String(s.Category),
+				export.Int(s.Quantity),
+				export.Money(s.Revenue),
+				export.Int(s.Orders),
+			)
+		})
+		if err != nil {
+			return rows, err
+		}
+		return rows, out.Close()
+
+	case domain.ExportPayments:
+		out, err := export.NewWriter(format, w, "Payments")
+		if err != nil {
+			return 0, err
+		}
+		if err := out.WriteHeader("Received At", "Source", "Event", "Razorpay Payment ID", "Razorpay Order ID", "Amount", "Method",
+			"Payment Status", "Error Code", "Error Description", "Signature Valid", "Processed", "Processing Error", "Order ID"); err != nil {
+			return 0, err
+		}
+
+		err = u.exportRepo.StreamPaymentLogs(ctx, from, to, func(p *domain.PaymentLogExportRow) error {
+			orderID := ""
+			if p.OrderID != nil {
+				orderID = p.OrderID.String()
+			}
+			rows++
+			return out.WriteRow(
+				export.Time(p.ReceivedAt, u.location),
+				export.String(p.Source),
+				export.String(p.EventType),
+				export.String(p.RazorpayPaymentID),
+				export.String(p.RazorpayOrderID),
+				export.Money(p.Amount),
+				export.String(p.Method),
+				export.String(p.PaymentStatus),
+				export.String(p.ErrorCode),
+				export.String(p.ErrorDescription),
+				export.Bool(p.SignatureValid),
+				export.Bool(p.Processed),
+				export.String(p.ProcessingError),
+				export.String(orderID),
+			)
+		})
+		if err != nil {
+			return rows, err
+		}
+		return rows, out.Close()
+	}
+
+	return 0, fmt.Errorf("unknown export kind %q", kind)
+}
+
+// ============================================================================
+// BACKGROUND JOBS
+// ============================================================================
+
+// RunWorker writes queued exports and deletes expired files until ctx is
+// cancelled. Running it on several instances is safe: each job is claimed by
+// one worker.
+func (u *ExportUsecase) RunWorker(ctx context.Context) {
+	ticker := time.NewTicker(exportWorkerInterval)
+	defer ticker.Stop()
+
+	var lastClean time.Time
+	for {
+		for ctx.Err() == nil && u.RunNext(ctx) {
+		}
+
+		if time.Since(lastClean) >= exportCleanInterval {
+			lastClean = time.Now()
+			u.deleteExpired(ctx, lastClean)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-u.wake:
+		}
+	}
+}
+
+// RunNext writes the next queued export. Returns false if there was none.
+func (u *ExportUsecase) RunNext(ctx context.Context) bool {
+	job, err := u.exportRepo.ClaimJob(ctx, exportJobLease)
+	if err != nil {
+		u.log.Error("Failed to claim export job", "error", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, exportJobLease)
+	defer cancel()
+
+	if err := u.runJob(jobCtx, job); err != nil {
+		u.log.WithFields(map[string]interface{}{
+			"job_id": job.ID,
+			"kind":   job.Kind,
+		}).Error("Export job failed", "error", err)
+
+		if err := u.exportRepo.FailJob(ctx, job, err.Error()); err != nil {
+			u.log.Error("Failed to record export failure", "error", err, "job_id", job.ID)
+		}
+	}
+
+	return true
+}
+
+// runJob writes a job's report to a temporary file and renames it into
+// place once complete, so a download never sees a partial file
+func (u *ExportUsecase) runJob(ctx context.Context, job *domain.ExportJob) error {
+	if err := os.MkdirAll(u.config.Dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(u.config.Dir, "export-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	buf := bufio.NewWriterSize(tmp, 64*1024)
+	rows, err := u.write(ctx, job.Kind, export.Format(job.Format), job.From, job.To, buf)
+	if err == nil {
+		err = buf.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("failed to stat export file: %w", err)
+	}
+
+	path := filepath.Join(u.config.Dir, job.ID.String()+"."+job.Format)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move export file: %w", err)
+	}
+
+	expiresAt := time.Now().Add(u.config.Retention)
+	job.Rows = rows
+	job.Size = info.Size()
+	job.FilePath = path
+	job.ExpiresAt = &expiresAt
+
+	if err := u.exportRepo.CompleteJob(ctx, job); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Taken over as stale; the other worker writes its own file
+			u.log.Warn("Export job was taken over", "job_id", job.ID)
+			return nil
+		}
+		os.Remove(path)
+		return err
+	}
+
+	u.log.WithFields(map[string]interface{}{
+		"job_id": job.ID,
+		"kind":   job.Kind,
+		"rows":   rows,
+		"bytes":  job.Size,
+	}).Info("Export job done")
+
+	return nil
+}
+
+// deleteExpired deletes expired exports and their files. Failed jobs are kept
+// for the same retention so admins can see why they failed.
+func (u *ExportUsecase) deleteExpired(ctx context.Context, now time.Time) {
+	paths, err := u.exportRepo.DeleteExpiredJobs(ctx, now.Add(-u.config.Retention))
+	if err != nil {
+		u.log.Error("Failed to delete expired exports", "error", err)
+		return
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			u.log.Warn("Failed to delete export file", "error", err, "path", path)
+		}
+	}
+}
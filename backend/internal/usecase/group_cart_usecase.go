@@ -0,0 +1,344 @@
+// Package usecase implements shared group carts checked out as one order
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Group cart errors
+var (
+	ErrNotGroupHost       = errors.New("only the host can do this")
+	ErrGroupCartNotLocked = errors.New("group cart must be locked before checkout")
+)
+
+// inviteCodeLength is the length of the code shared in group cart invite links
+const inviteCodeLength = 8
+
+// GroupCartUsecase handles group carts: invites, member items, lock and checkout
+type GroupCartUsecase struct {
+	groupCartRepo  *repository.GroupCartRepository
+	userRepo       *repository.UserRepository
+	orderRepo      *repository.OrderRepository
+	paymentUsecase *PaymentUsecase
+	log            *logger.Logger
+}
+
+// NewGroupCartUsecase creates a new group cart usecase
+func NewGroupCartUsecase(
+	groupCartRepo *repository.GroupCartRepository,
+	userRepo *repository.UserRepository,
+	orderRepo *repository.OrderRepository,
+	paymentUsecase *PaymentUsecase,
+	log *logger.Logger,
+) *GroupCartUsecase {
+	return &GroupCartUsecase{
+		groupCartRepo:  groupCartRepo,
+		userRepo:       userRepo,
+		orderRepo:      orderRepo,
+		paymentUsecase: paymentUsecase,
+		log:            log,
+	}
+}
+
+// CreateGroupCart opens a group cart hosted by the user
+func (u *GroupCartUsecase) CreateGroupCart(ctx context.Context, hostID uuid.UUID, rawNotes string) (*domain.GroupCart, error) {
+	notes, err := sanitizeNotes(rawNotes, domain.MaxOrderNotesLength)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := u.userRepo.GetByID(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart := &domain.GroupCart{
+		HostID: hostID,
+		Notes:  notes,
+	}
+
+	// Invite codes are random; retry the rare collision
+	for attempt := 0; attempt < 3; attempt++ {
+		cart.InviteCode, err = randomCode(inviteCodeLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate invite code: %w", err)
+		}
+
+		err = u.groupCartRepo.Create(ctx, cart, host.Name)
+		if !errors.Is(err, repository.ErrDuplicateKey) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Group cart created", "group_cart_id", cart.ID.String(), "host_id", hostID.String())
+
+	return u.view(ctx, cart.ID)
+}
+
+// JoinGroupCart adds the user to the cart behind an invite code
+func (u *GroupCartUsecase) JoinGroupCart(ctx context.Context, userID uuid.UUID, inviteCode string) (*domain.GroupCart, error) {
+	cartID, err := u.groupCartRepo.GetIDByInviteCode(ctx, normalizePickupCode(inviteCode))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.groupCartRepo.AddMember(ctx, cartID, userID, user.Name); err != nil {
+		return nil, err
+	}
+
+	return u.view(ctx, cartID)
+}
+
+// GetGroupCart retrieves a cart for one of its members
+func (u *GroupCartUsecase) GetGroupCart(ctx context.Context, cartID, userID uuid.UUID) (*domain.GroupCart, error) {
+	cart, err := u.view(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cart.IsMember(userID) {
+		return nil, repository.ErrNotGroupMember
+	}
+
+	return cart, nil
+}
+
+// view loads a cart with its per-member breakdown. Until checkout the
+// breakdown uses current menu prices; afterwards it comes from the order.
+func (u *GroupCartUsecase) view(ctx context.Context, cartID uuid.UUID) (*domain.GroupCart, error) {
+	cart, err := u.groupCartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []domain.OrderItem
+	if cart.OrderID != nil {
+		order, err := u.orderRepo.GetByID(ctx, *cart.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load group order: %w", err)
+		}
+		items = order.Items
+	} else {
+		items = make([]domain.OrderItem, len(cart.Items))
+		for i, item := range cart.Items {
+			userID := item.UserID
+			items[i] = domain.OrderItem{
+				MenuItemID:  item.MenuItemID,
+				Name:        item.Name,
+				VariantID:   item.VariantID,
+				VariantName: item.VariantName,
+				Price:       item.Price,
+				Quantity:    item.Quantity,
+				AddedBy:     &userID,
+			}
+		}
+	}
+
+	names := make(map[uuid.UUID]string, len(cart.Members))
+	for _, member := range cart.Members {
+		names[member.UserID] = member.Name
+	}
+
+	cart.Breakdown = domain.BreakdownByMember(items)
+	cart.Subtotal = 0
+	for i := range cart.Breakdown {
+		cart.Breakdown[i].Name = names[cart.Breakdown[i].UserID]
+		cart.Subtotal += cart.Breakdown[i].Subtotal
+	}
+	if cart.Breakdown == nil {
+		cart.Breakdown = []domain.MemberBreakdown{}
+	}
+
+	return cart, nil
+}
+
+// AddItem adds a line to the cart on behalf of the member
+func (u *GroupCartUsecase) AddItem(ctx context.Context, cartID, userID uuid.UUID, item domain.CartItem) (*domain.GroupCart, error) {
+	// Same validation and availability checks as a normal checkout
+	items, _, err := validateCart([]domain.CartItem{item}, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := u.paymentUsecase.priceCart(ctx, items); err != nil {
+		return nil, err
+	}
+
+	line := &domain.GroupCartItem{
+		UserID:        userID,
+		MenuItemID:    items[0].MenuItemID,
+		VariantID:     items[0].VariantID,
+		ModifierIDs:   items[0].ModifierIDs,
+		BundleChoices: items[0].BundleChoices,
+		Quantity:      items[0].Quantity,
+		Notes:         items[0].Notes,
+	}
+	if err := u.groupCartRepo.AddItem(ctx, cartID, line); err != nil {
+		return nil, err
+	}
+
+	return u.view(ctx, cartID)
+}
+
+// UpdateItem changes the quantity and notes of the member's own line
+func (u *GroupCartUsecase) UpdateItem(ctx context.Context, cartID, itemID, userID uuid.UUID, quantity int, rawNotes string) (*domain.GroupCart, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidCart
+	}
+
+	notes, err := sanitizeNotes(rawNotes, domain.MaxItemNotesLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.groupCartRepo.UpdateItem(ctx, cartID, itemID, userID, quantity, notes); err != nil {
+		return nil, err
+	}
+
+	return u.view(ctx, cartID)
+}
+
+// RemoveItem removes a line. The host may remove anyone's line.
+func (u *GroupCartUsecase) RemoveItem(ctx context.Context, cartID, itemID, userID uuid.UUID) (*domain.GroupCart, error) {
+	cart, err := u.groupCartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.groupCartRepo.RemoveItem(ctx, cartID, itemID, userID, cart.HostID == userID); err != nil {
+		return nil, err
+	}
+
+	return u.view(ctx, cartID)
+}
+
+// Lock stops members from changing the cart so the host can check out.
+// version is the cart version the host reviewed; if members changed the cart
+// since, locking fails with ErrVersionConflict.
+func (u *GroupCartUsecase) Lock(ctx context.Context, cartID, hostID uuid.UUID, version int) (*domain.GroupCart, error) {
+	return u.transition(ctx, cartID, hostID, []domain.GroupCartStatus{domain.GroupCartOpen}, domain.GroupCartLocked, version)
+}
+
+// Unlock lets members change the cart again
+func (u *GroupCartUsecase) Unlock(ctx context.Context, cartID, hostID uuid.UUID) (*domain.GroupCart, error) {
+	return u.transition(ctx, cartID, hostID, []domain.GroupCartStatus{domain.GroupCartLocked}, domain.GroupCartOpen, 0)
+}
+
+// Cancel abandons the cart
+func (u *GroupCartUsecase) Cancel(ctx context.Context, cartID, hostID uuid.UUID) (*domain.GroupCart, error) {
+	return u.transition(ctx, cartID, hostID, []domain.GroupCartStatus{domain.GroupCartOpen, domain.GroupCartLocked}, domain.GroupCartCancelled, 0)
+}
+
+func (u *GroupCartUsecase) transition(ctx context.Context, cartID, hostID uuid.UUID, from []domain.GroupCartStatus, to domain.GroupCartStatus, version int) (*domain.GroupCart, error) {
+	cart, err := u.groupCartRepo.GetByID(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if cart.HostID != hostID {
+		return nil, ErrNotGroupHost
+	}
+
+	if err := u.groupCartRepo.UpdateStatus(ctx, cartID, from, to, version); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Group cart status changed", "group_cart_id", cartID.String(), "status", to)
+
+	return u.view(ctx, cartID)
+}
+
+// GroupCheckoutRequest contains the host's delivery choices for a group cart
+type GroupCheckoutRequest struct {
+	CartID          uuid.UUID              `json:"-"`
+	HostID          uuid.UUID              `json:"-"`
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"`
+	DeliveryAddress string                 `json:"delivery_address"`
+}
+
+// GroupCheckoutResponse is the payment to complete and the checked out cart
+type GroupCheckoutResponse struct {
+	Payment *InitiateOrderResponse `json:"payment"`
+	Cart    *domain.GroupCart      `json:"cart"`
+}
+
+// Checkout places one order for everything in a locked cart, paid by the host.
+// Lines keep the member who added them, giving the per-member breakdown.
+// Pricing, validation and idempotency are those of a normal order.
+func (u *GroupCartUsecase) Checkout(ctx context.Context, req GroupCheckoutRequest) (*GroupCheckoutResponse, error) {
+	cart, err := u.groupCartRepo.GetByID(ctx, req.CartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cart.HostID != req.HostID {
+		return nil, ErrNotGroupHost
+	}
+	switch cart.Status {
+	case domain.GroupCartLocked:
+	case domain.GroupCartOpen:
+		return nil, ErrGroupCartNotLocked
+	default:
+		return nil, repository.ErrGroupCartClosed
+	}
+
+	items := make([]domain.CartItem, len(cart.Items))
+	for i, item := range cart.Items {
+		addedBy := item.UserID
+		items[i] = domain.CartItem{
+			MenuItemID:    item.MenuItemID,
+			VariantID:     item.VariantID,
+			ModifierIDs:   item.ModifierIDs,
+			BundleChoices: item.BundleChoices,
+			Quantity:      item.Quantity,
+			Notes:         item.Notes,
+			AddedBy:       &addedBy,
+		}
+	}
+
+	payment, err := u.paymentUsecase.InitiateOrder(ctx, InitiateOrderRequest{
+		UserID:          cart.HostID,
+		Items:           items,
+		Notes:           cart.Notes,
+		FulfillmentType: req.FulfillmentType,
+		DeliveryAddress: req.DeliveryAddress,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.groupCartRepo.MarkCheckedOut(ctx, cart.ID, payment.ID); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Group cart checked out",
+		"group_cart_id", cart.ID.String(),
+		"order_id", payment.ID.String(),
+		"members", len(cart.Members),
+		"amount", payment.Amount,
+	)
+
+	view, err := u.view(ctx, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GroupCheckoutResponse{
+		Payment: payment,
+		Cart:    view,
+	}, nil
+}
@@ -0,0 +1,237 @@
+// Package usecase implements the nightly order and payment consistency checks
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Integrity check limits
+const (
+	// integritySchedulerInterval is how often the scheduler looks for a nightly run to start
+	integritySchedulerInterval = 10 * time.Minute
+	// integrityWebhookGrace is how long a payment may wait for its webhook, and
+	// a webhook for its payment to be recorded, before either is reported
+	integrityWebhookGrace = time.Hour
+	// maxFindingsPerCheck caps what one check stores per run; a check that
+	// hits it resolves nothing, since it did not see everything
+	maxFindingsPerCheck = 1000
+
+	defaultIntegrityListed = 100
+	maxIntegrityListed     = 1000
+	maxIntegrityRunsListed = 100
+)
+
+// stuckOrderLimits is how long an order may stay in a status. Unpaid
+// checkouts are abandoned rather than stuck and are not checked.
+var stuckOrderLimits = map[domain.OrderStatus]time.Duration{
+	domain.OrderStatusPaid:           time.Hour,
+	domain.OrderStatusAccepted:       4 * time.Hour,
+	domain.OrderStatusOutForDelivery: 3 * time.Hour,
+	domain.OrderStatusReadyForPickup: 12 * time.Hour,
+	domain.OrderStatusOnTab:          12 * time.Hour,
+}
+
+// IntegrityUsecase checks every night that orders and payments agree with
+// each other and keeps the violations found for admins to investigate
+type IntegrityUsecase struct {
+	integrityRepo *repository.IntegrityRepository
+	config        config.IntegrityConfig
+	location      *time.Location
+	log           *logger.Logger
+
+	lastNightly time.Time // Business day of the last nightly run this instance saw
+}
+
+// NewIntegrityUsecase creates a new integrity usecase
+func NewIntegrityUsecase(integrityRepo *repository.IntegrityRepository, cfg config.IntegrityConfig, location *time.Location, log *logger.Logger) *IntegrityUsecase {
+	return &IntegrityUsecase{
+		integrityRepo: integrityRepo,
+		config:        cfg,
+		location:      location,
+		log:           log,
+	}
+}
+
+// RunScheduler starts the nightly run once the check hour of each business
+// day has passed, until ctx is cancelled. Running it on several instances is
+// safe: each night's run is claimed by one of them.
+func (u *IntegrityUsecase) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(integritySchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		u.runNightly(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNightly starts today's nightly run if it is due and no instance has
+// started it yet
+func (u *IntegrityUsecase) runNightly(ctx context.Context, now time.Time) {
+	now = now.In(u.location)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, u.location)
+	if now.Before(day.Add(time.Duration(u.config.CheckHour)*time.Hour)) || day.Equal(u.lastNightly) {
+		return
+	}
+
+	run, err := u.integrityRepo.StartRun(ctx, &day)
+	if errors.Is(err, repository.ErrNotFound) {
+		u.lastNightly = day
+		return
+	}
+	if err != nil {
+		u.log.Error("Failed to start nightly integrity run", "error", err)
+		return
+	}
+	u.lastNightly = day
+
+	u.check(ctx, run)
+}
+
+// Run runs every check now. It runs to the end even if the caller goes
+// away, so the run is always recorded as finished.
+func (u *IntegrityUsecase) Run(ctx context.Context) (*domain.IntegrityRun, error) {
+	ctx = context.WithoutCancel(ctx)
+
+	run, err := u.integrityRepo.StartRun(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.check(ctx, run); err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// check runs every check of a run and records what they find. A failing
+// check is noted on the run and leaves its earlier findings open.
+func (u *IntegrityUsecase) check(ctx context.Context, run *domain.IntegrityRun) error {
+	since := run.StartedAt.Add(-u.config.Lookback)
+	webhookBy := run.StartedAt.Add(-integrityWebhookGrace)
+
+	var failed []string
+	for _, check := range domain.IntegrityChecks {
+		findings, err := u.find(ctx, check, since, webhookBy)
+		if err == nil {
+			var created, resolved int64
+			created, resolved, err = u.integrityRepo.RecordFindings(ctx, run, check, findings, len(findings) < maxFindingsPerCheck)
+			run.New += created
+			run.Resolved += resolved
+		}
+		if err != nil {
+			u.log.Error("Integrity check failed", "error", err, "check", string(check))
+			failed = append(failed, string(check))
+			continue
+		}
+		if len(findings) >= maxFindingsPerCheck {
+			u.log.Warn("Integrity check hit the findings limit", "check", string(check), "limit", maxFindingsPerCheck)
+		}
+	}
+	if len(failed) > 0 {
+		run.Error = "failed checks: " + strings.Join(failed, ", ")
+	}
+
+	if err := u.integrityRepo.FinishRun(ctx, run); err != nil {
+		u.log.Error("Failed to finish integrity run", "error", err, "run_id", run.ID.String())
+		return err
+	}
+
+	u.log.WithFields(map[string]interface{}{
+		"run_id":    run.ID,
+		"scheduled": run.Scheduled,
+		"findings":  run.Findings,
+		"new":       run.New,
+		"resolved":  run.Resolved,
+	}).Info("Integrity run finished")
+
+	return nil
+}
+
+// find runs one check
+func (u *IntegrityUsecase) find(ctx context.Context, check domain.IntegrityCheck, since, webhookBy time.Time) ([]domain.IntegrityFinding, error) {
+	switch check {
+	case domain.CheckOrderTotal:
+		return u.integrityRepo.FindOrderTotalMismatches(ctx, since, maxFindingsPerCheck)
+	case domain.CheckPaidWithoutCapture:
+		return u.integrityRepo.FindPaidWithoutCapture(ctx, since, webhookBy, maxFindingsPerCheck)
+	case domain.CheckStatusPayment:
+		return u.integrityRepo.FindStatusPaymentMismatches(ctx, since, maxFindingsPerCheck)
+	case domain.CheckOrphanedWebhook:
+		return u.integrityRepo.FindOrphanedWebhooks(ctx, since, webhookBy, maxFindingsPerCheck)
+	case domain.CheckStuckOrder:
+		return u.integrityRepo.FindStuckOrders(ctx, since, stuckOrderLimits, maxFindingsPerCheck)
+	default:
+		return nil, fmt.Errorf("unknown integrity check %s", check)
+	}
+}
+
+// GetFindings lists findings, most recently seen first. status is "open"
+// (the default), "resolved" or "all"; check and orderID are optional.
+func (u *IntegrityUsecase) GetFindings(ctx context.Context, status, check string, orderID *uuid.UUID, limit int) ([]domain.IntegrityFinding, error) {
+	filter := repository.IntegrityFindingFilter{
+		Check:   domain.IntegrityCheck(check),
+		OrderID: orderID,
+		Limit:   limit,
+	}
+	if check != "" && !filter.Check.IsValid() {
+		return nil, fmt.Errorf("%w: unknown check %s", ErrInvalidFilter, check)
+	}
+
+	switch status {
+	case "", "open":
+		open := true
+		filter.Open = &open
+	case "resolved":
+		open := false
+		filter.Open = &open
+	case "all":
+	default:
+		return nil, fmt.Errorf("%w: status must be open, resolved or all", ErrInvalidFilter)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultIntegrityListed
+	}
+	if filter.Limit > maxIntegrityListed {
+		filter.Limit = maxIntegrityListed
+	}
+
+	findings, err := u.integrityRepo.ListFindings(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range findings {
+		if findings[i].OrderID != nil {
+			findings[i].OrderURL = "/api/v1/orders/" + findings[i].OrderID.String()
+		}
+	}
+
+	return findings, nil
+}
+
+// GetRuns lists the newest runs
+func (u *IntegrityUsecase) GetRuns(ctx context.Context, limit int) ([]domain.IntegrityRun, error) {
+	if limit <= 0 || limit > maxIntegrityRunsListed {
+		limit = maxIntegrityRunsListed
+	}
+	return u.integrityRepo.ListRuns(ctx, limit)
+}
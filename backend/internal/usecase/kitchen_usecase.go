@@ -0,0 +1,201 @@
+// Package usecase implements kitchen-facing order views
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// kitchenStatuses are the order states the kitchen still has to act on.
+// Dine-in rounds are cooked before the tab is paid.
+var kitchenStatuses = []domain.OrderStatus{
+	domain.OrderStatusPaid,
+	domain.OrderStatusOnTab,
+	domain.OrderStatusAccepted,
+}
+
+// ticketWidth is the line width of a kitchen ticket (80mm thermal printer)
+const ticketWidth = 42
+
+// KitchenUsecase builds the kitchen queue and printable kitchen tickets
+type KitchenUsecase struct {
+	orderRepo *repository.OrderRepository
+	tableRepo *repository.TableRepository
+	location  *time.Location
+	log       *logger.Logger
+}
+
+// NewKitchenUsecase creates a new kitchen usecase.
+// Ticket times are printed in the given business timezone.
+func NewKitchenUsecase(orderRepo *repository.OrderRepository, tableRepo *repository.TableRepository, location *time.Location, log *logger.Logger) *KitchenUsecase {
+	return &KitchenUsecase{
+		orderRepo: orderRepo,
+		tableRepo: tableRepo,
+		location:  location,
+		log:       log,
+	}
+}
+
+// KitchenTicket is a kitchen view of an order: what to cook and how
+type KitchenTicket struct {
+	OrderID  uuid.UUID          `json:"order_id"`
+	Number   string             `json:"number"` // Short order number shown to staff
+	Status   domain.OrderStatus `json:"status"`
+	Items    []domain.OrderItem `json:"items"`
+	Notes    string             `json:"notes,omitempty"`
+	PlacedAt time.Time          `json:"placed_at"`
+	Text     string             `json:"text"` // Pre-rendered ticket for thermal printers
+
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"`
+	PickupCode      string                 `json:"pickup_code,omitempty"`
+	TableNumber     int                    `json:"table_number,omitempty"` // Dine-in only
+}
+
+// GetQueue returns tickets for every order the kitchen still has to prepare,
+// oldest first
+func (u *KitchenUsecase) GetQueue(ctx context.Context) ([]KitchenTicket, error) {
+	orders, err := u.orderRepo.GetByStatuses(ctx, kitchenStatuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch kitchen queue: %w", err)
+	}
+
+	tables := make(map[uuid.UUID]int)
+	tickets := make([]KitchenTicket, 0, len(orders))
+	for i := range orders {
+		tableNumber, err := u.tableNumber(ctx, &orders[i], tables)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, u.BuildTicket(&orders[i], tableNumber))
+	}
+
+	return tickets, nil
+}
+
+// GetTicket returns the kitchen ticket for a single order
+func (u *KitchenUsecase) GetTicket(ctx context.Context, orderID uuid.UUID) (*KitchenTicket, error) {
+	order, err := u.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	tableNumber, err := u.tableNumber(ctx, order, make(map[uuid.UUID]int))
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := u.BuildTicket(order, tableNumber)
+	return &ticket, nil
+}
+
+// tableNumber resolves the table a dine-in round is served to, caching per tab.
+// Returns 0 for other orders.
+func (u *KitchenUsecase) tableNumber(ctx context.Context, order *domain.Order, cache map[uuid.UUID]int) (int, error) {
+	if order.TableSessionID == nil {
+		return 0, nil
+	}
+	if number, ok := cache[*order.TableSessionID]; ok {
+		return number, nil
+	}
+
+	session, err := u.tableRepo.GetSession(ctx, *order.TableSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch table for order %s: %w", order.ID, err)
+	}
+	cache[session.ID] = session.TableNumber
+	return session.TableNumber, nil
+}
+
+// BuildTicket converts an order (with items loaded) into a kitchen ticket.
+// tableNumber is the table a dine-in round goes to, 0 otherwise.
+func (u *KitchenUsecase) BuildTicket(order *domain.Order, tableNumber int) KitchenTicket {
+	ticket := KitchenTicket{
+		OrderID:  order.ID,
+		Number:   shortOrderNumber(order.ID),
+		Status:   order.Status,
+		Items:    order.Items,
+		Notes:    order.Notes,
+		PlacedAt: order.CreatedAt,
+
+		FulfillmentType: order.FulfillmentType,
+		PickupCode:      order.PickupCode,
+		TableNumber:     tableNumber,
+	}
+	ticket.Text = u.renderTicket(order, tableNumber)
+	return ticket
+}
+
+// renderTicket renders a plain-text ticket. Special instructions are printed
+// under the line they belong to so they cannot be missed at the pass.
+func (u *KitchenUsecase) renderTicket(order *domain.Order, tableNumber int) string {
+	var sb strings.Builder
+	rule := strings.Repeat("-", ticketWidth)
+
+	placedAt := order.CreatedAt.In(u.location).Format("02 Jan 15:04")
+	header := "ORDER #" + shortOrderNumber(order.ID)
+	sb.WriteString(fmt.Sprintf("%-*s%s\n", ticketWidth-len(placedAt), header, placedAt))
+	sb.WriteString(fmt.Sprintf("Status: %s\n", order.Status))
+	switch order.FulfillmentType {
+	case domain.FulfillmentPickup:
+		sb.WriteString(fmt.Sprintf("PICKUP  Code: %s\n", order.PickupCode))
+	case domain.FulfillmentDineIn:
+		sb.WriteString(fmt.Sprintf("DINE-IN  Table: %d\n", tableNumber))
+	default:
+		sb.WriteString("DELIVERY\n")
+	}
+	sb.WriteString(rule + "\n")
+
+	for _, item := range order.Items {
+		sb.WriteString(fmt.Sprintf("%d x %s\n", item.Quantity, item.DisplayName()))
+		for _, modifier := range item.Modifiers {
+			writeWrapped(&sb, "   + "+modifier.Name, "     ")
+		}
+		for _, component := range item.Components {
+			writeWrapped(&sb, fmt.Sprintf("   - %d x %s", item.Quantity*component.Quantity, component.Name), "     ")
+		}
+		if item.Notes != "" {
+			writeWrapped(&sb, ">> "+item.Notes, "   ")
+		}
+	}
+
+	if order.Notes != "" {
+		sb.WriteString(rule + "\n")
+		writeWrapped(&sb, "NOTE: "+order.Notes, "      ")
+	}
+	sb.WriteString(rule + "\n")
+
+	return sb.String()
+}
+
+// writeWrapped writes text wrapped at ticketWidth; continuation lines are indented
+func writeWrapped(sb *strings.Builder, text, indent string) {
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > ticketWidth {
+			sb.WriteString(line + "\n")
+			line = indent + word
+			continue
+		}
+		if line == "" {
+			line = word
+		} else {
+			line += " " + word
+		}
+	}
+	if line != "" {
+		sb.WriteString(line + "\n")
+	}
+}
+
+// shortOrderNumber is the 8-character prefix used for orders in the UI and receipts
+func shortOrderNumber(id uuid.UUID) string {
+	return strings.ToUpper(id.String()[:8])
+}
@@ -3,7 +3,10 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 
@@ -13,6 +16,17 @@ import (
 	"fooddelivery/pkg/redis"
 )
 
+// ErrInvalidVariant is returned for a menu variant without a name or price
+var ErrInvalidVariant = errors.New("variant needs a name of at most 50 characters and a positive price")
+
+// ErrInvalidModifierGroup is returned for a modifier group that breaks the
+// naming, option or selection rules
+var ErrInvalidModifierGroup = errors.New("invalid modifier group")
+
+// ErrInvalidBundleSlot is returned for a bundle slot that breaks the naming,
+// quantity or option rules
+var ErrInvalidBundleSlot = errors.New("invalid bundle slot")
+
 // MenuUsecase handles menu-related business logic
 type MenuUsecase struct {
 	menuRepo    *repository.MenuRepository
@@ -139,6 +153,223 @@ func (u *MenuUsecase) DeleteMenuItem(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// CreateVariant adds a size or portion to a menu item (admin only)
+func (u *MenuUsecase) CreateVariant(ctx context.Context, v *domain.MenuVariant) error {
+	if err := validateVariant(v); err != nil {
+		return err
+	}
+
+	if err := u.menuRepo.CreateVariant(ctx, v); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// UpdateVariant changes the name, price, availability or position of a
+// variant (admin only)
+func (u *MenuUsecase) UpdateVariant(ctx context.Context, v *domain.MenuVariant) error {
+	if err := validateVariant(v); err != nil {
+		return err
+	}
+
+	if err := u.menuRepo.UpdateVariant(ctx, v); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// DeleteVariant removes a variant from a menu item (admin only)
+func (u *MenuUsecase) DeleteVariant(ctx context.Context, menuItemID, variantID uuid.UUID) error {
+	if err := u.menuRepo.DeleteVariant(ctx, menuItemID, variantID); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// validateVariant trims the variant name and checks it and the price
+func validateVariant(v *domain.MenuVariant) error {
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" || utf8.RuneCountInString(v.Name) > domain.MaxVariantNameLength || v.Price <= 0 {
+		return ErrInvalidVariant
+	}
+	return nil
+}
+
+// CreateModifierGroup adds a modifier group with its options to a menu item
+// (admin only)
+func (u *MenuUsecase) CreateModifierGroup(ctx context.Context, g *domain.ModifierGroup) error {
+	if err := validateModifierGroup(g); err != nil {
+		return err
+	}
+
+	if err := u.menuRepo.CreateModifierGroup(ctx, g); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// UpdateModifierGroup changes a modifier group and replaces its options
+// (admin only)
+func (u *MenuUsecase) UpdateModifierGroup(ctx context.Context, g *domain.ModifierGroup) error {
+	if err := validateModifierGroup(g); err != nil {
+		return err
+	}
+
+	if err := u.menuRepo.UpdateModifierGroup(ctx, g); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// DeleteModifierGroup removes a modifier group from a menu item (admin only)
+func (u *MenuUsecase) DeleteModifierGroup(ctx context.Context, menuItemID, groupID uuid.UUID) error {
+	if err := u.menuRepo.DeleteModifierGroup(ctx, menuItemID, groupID); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// validateModifierGroup trims the group and option names and checks them,
+// the selection limits and the option prices
+func validateModifierGroup(g *domain.ModifierGroup) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" || utf8.RuneCountInString(g.Name) > domain.MaxModifierNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidModifierGroup, domain.MaxModifierNameLength)
+	}
+	if len(g.Options) == 0 || len(g.Options) > domain.MaxModifierOptions {
+		return fmt.Errorf("%w: a group needs 1 to %d options", ErrInvalidModifierGroup, domain.MaxModifierOptions)
+	}
+	if g.MinSelect < 0 || g.MaxSelect < 1 || g.MaxSelect > domain.MaxModifierSelectPerGroup || g.MinSelect > g.MaxSelect {
+		return fmt.Errorf("%w: selections must satisfy 0 <= min_select <= max_select <= %d and max_select >= 1", ErrInvalidModifierGroup, domain.MaxModifierSelectPerGroup)
+	}
+	if g.MinSelect > len(g.Options) {
+		return fmt.Errorf("%w: min_select is more than the number of options", ErrInvalidModifierGroup)
+	}
+	g.Required = g.MinSelect > 0
+
+	names := make(map[string]bool, len(g.Options))
+	for i := range g.Options {
+		o := &g.Options[i]
+		o.Name = strings.TrimSpace(o.Name)
+		if o.Name == "" || utf8.RuneCountInString(o.Name) > domain.MaxModifierNameLength {
+			return fmt.Errorf("%w: option names must be 1 to %d characters", ErrInvalidModifierGroup, domain.MaxModifierNameLength)
+		}
+		if o.Price < 0 {
+			return fmt.Errorf("%w: option %s has a negative price", ErrInvalidModifierGroup, o.Name)
+		}
+		key := strings.ToLower(o.Name)
+		if names[key] {
+			return fmt.Errorf("%w: option %s is listed twice", ErrInvalidModifierGroup, o.Name)
+		}
+		names[key] = true
+	}
+
+	return nil
+}
+
+// CreateBundleSlot adds a slot to a menu item, making it a bundle (admin only)
+func (u *MenuUsecase) CreateBundleSlot(ctx context.Context, slot *domain.BundleSlot) error {
+	if err := validateBundleSlot(slot); err != nil {
+		return err
+	}
+
+	bundle, err := u.menuRepo.GetByID(ctx, slot.BundleID)
+	if err != nil {
+		return err
+	}
+	if len(bundle.BundleSlots) >= domain.MaxBundleSlots {
+		return fmt.Errorf("%w: a bundle has at most %d slots", ErrInvalidBundleSlot, domain.MaxBundleSlots)
+	}
+
+	if err := u.menuRepo.CreateBundleSlot(ctx, slot); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// UpdateBundleSlot changes a bundle slot and replaces its options (admin only)
+func (u *MenuUsecase) UpdateBundleSlot(ctx context.Context, slot *domain.BundleSlot) error {
+	if err := validateBundleSlot(slot); err != nil {
+		return err
+	}
+
+	if err := u.menuRepo.UpdateBundleSlot(ctx, slot); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// DeleteBundleSlot removes a slot from a bundle (admin only)
+func (u *MenuUsecase) DeleteBundleSlot(ctx context.Context, bundleID, slotID uuid.UUID) error {
+	if err := u.menuRepo.DeleteBundleSlot(ctx, bundleID, slotID); err != nil {
+		return err
+	}
+
+	u.invalidateCache(ctx)
+
+	return nil
+}
+
+// validateBundleSlot trims the slot name and checks it, the quantity and the
+// options
+func validateBundleSlot(slot *domain.BundleSlot) error {
+	slot.Name = strings.TrimSpace(slot.Name)
+	if slot.Name == "" || utf8.RuneCountInString(slot.Name) > domain.MaxBundleSlotNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidBundleSlot, domain.MaxBundleSlotNameLength)
+	}
+	if slot.Quantity == 0 {
+		slot.Quantity = 1
+	}
+	if slot.Quantity < 1 || slot.Quantity > domain.MaxBundleSlotQuantity {
+		return fmt.Errorf("%w: quantity must be 1 to %d", ErrInvalidBundleSlot, domain.MaxBundleSlotQuantity)
+	}
+	if len(slot.Options) == 0 || len(slot.Options) > domain.MaxBundleSlotOptions {
+		return fmt.Errorf("%w: a slot needs 1 to %d options", ErrInvalidBundleSlot, domain.MaxBundleSlotOptions)
+	}
+
+	seen := make(map[string]bool, len(slot.Options))
+	for i := range slot.Options {
+		o := &slot.Options[i]
+		if o.MenuItemID == uuid.Nil {
+			return fmt.Errorf("%w: every option needs a menu item", ErrInvalidBundleSlot)
+		}
+		if o.VariantID != nil && *o.VariantID == uuid.Nil {
+			o.VariantID = nil
+		}
+		key := o.MenuItemID.String() + "/" + variantKey(o.VariantID)
+		if seen[key] {
+			return fmt.Errorf("%w: an item is listed twice", ErrInvalidBundleSlot)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
 // InvalidateMenuCache explicitly invalidates the menu cache.
 // Called by admin endpoint POST /admin/menu/invalidate-cache
 func (u *MenuUsecase) InvalidateMenuCache(ctx context.Context) error {
@@ -146,6 +377,20 @@ func (u *MenuUsecase) InvalidateMenuCache(ctx context.Context) error {
 	return nil
 }
 
+// HandleEvent drops the cached menu when stock flips an item's availability,
+// so the menu does not list a sold-out item. Deleting the key again is
+// harmless, so a redelivered event needs no dedup.
+func (u *MenuUsecase) HandleEvent(ctx context.Context, event domain.OutboxEvent) error {
+	if event.Type != domain.EventMenuAvailabilityChanged || u.redisClient == nil {
+		return nil
+	}
+
+	if err := u.redisClient.DeleteKey(ctx, redis.MenuCacheKey); err != nil {
+		return fmt.Errorf("failed to invalidate menu cache: %w", err)
+	}
+	return nil
+}
+
 // invalidateCache removes the menu cache from Redis
 func (u *MenuUsecase) invalidateCache(ctx context.Context) {
 	if u.redisClient == nil {
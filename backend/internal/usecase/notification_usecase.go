@@ -0,0 +1,1082 @@
+// Package usecase implements SMS, email and push notifications
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+	"fooddelivery/pkg/notify"
+)
+
+// Notification errors
+var (
+	ErrInvalidDevice      = errors.New("invalid push device")
+	ErrInvalidPreferences = errors.New("invalid notification preferences")
+	ErrInvalidPromotion   = errors.New("invalid promotion")
+)
+
+// Notification worker settings
+const (
+	notificationWorkerInterval = 15 * time.Second
+	notificationBatchSize      = 50
+	notificationLease          = 2 * time.Minute // Claimed messages are retried after this if the worker dies mid-send
+	notificationSendTimeout    = 30 * time.Second
+	notificationBaseBackoff    = 30 * time.Second // Doubles with every failed attempt
+	notificationMaxBackoff     = time.Hour
+	maxPushDevices             = 5 // Newest devices of a user that get push notifications
+	promotionAudiencePage      = 500
+)
+
+// Promotional SMS and push go out only between these times of day in the
+// business timezone, as the TRAI commercial communication rules require for
+// promotional SMS
+const (
+	promotionWindowStart = 9 * time.Hour
+	promotionWindowEnd   = 21 * time.Hour
+)
+
+// quietHoursExempt are order updates sent during quiet hours anyway, because
+// they are only useful right away
+var quietHoursExempt = map[domain.NotificationEvent]bool{
+	domain.NotifyOutForDelivery: true,
+}
+
+// DefaultNotificationRules are the channels each event is sent on unless
+// NOTIFY_RULES overrides them
+var DefaultNotificationRules = map[domain.NotificationEvent][]domain.NotificationChannel{
+	domain.NotifyOTP:                 {domain.ChannelSMS},
+	domain.NotifyOrderPaid:           {domain.ChannelPush, domain.ChannelEmail},
+	domain.NotifyOutForDelivery:      {domain.ChannelPush, domain.ChannelSMS},
+	domain.NotifyDelivered:           {domain.ChannelPush},
+	domain.NotifyRefund:              {domain.ChannelPush, domain.ChannelSMS, domain.ChannelEmail},
+	domain.NotifySubscriptionRenewal: {domain.ChannelPush, domain.ChannelSMS},
+	domain.NotifySubscriptionExpired: {domain.ChannelPush, domain.ChannelEmail},
+	domain.NotifyPromotion:           {domain.ChannelPush, domain.ChannelEmail, domain.ChannelSMS},
+}
+
+// ParseNotificationRules applies NOTIFY_RULES overrides ("event=channel,channel;...")
+// to the default rules. An event with no channels ("delivered=") is not sent.
+func ParseNotificationRules(value string) (map[domain.NotificationEvent][]domain.NotificationChannel, error) {
+	rules := make(map[domain.NotificationEvent][]domain.NotificationChannel, len(DefaultNotificationRules))
+	for event, channels := range DefaultNotificationRules {
+		rules[event] = channels
+	}
+
+	for _, rule := range strings.Split(value, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		name, list, ok := strings.Cut(rule, "=")
+		event := domain.NotificationEvent(strings.TrimSpace(name))
+		if _, known := DefaultNotificationRules[event]; !ok || !known {
+			return nil, fmt.Errorf("invalid notification rule %q", rule)
+		}
+
+		var channels []domain.NotificationChannel
+		for _, c := range strings.Split(list, ",") {
+			channel := domain.NotificationChannel(strings.TrimSpace(c))
+			if channel == "" {
+				continue
+			}
+			if channel != domain.ChannelSMS && channel != domain.ChannelEmail && channel != domain.ChannelPush {
+				return nil, fmt.Errorf("unknown notification channel %q in rule %q", channel, rule)
+			}
+			channels = append(channels, channel)
+		}
+		rules[event] = channels
+	}
+
+	return rules, nil
+}
+
+// NewNotificationSenders sets up the configured provider of every channel.
+// Channels set to "none" are left out and never sent on.
+func NewNotificationSenders(cfg config.NotificationConfig) (map[domain.NotificationChannel]notify.Sender, error) {
+	providers := map[domain.NotificationChannel]string{
+		domain.ChannelSMS:   cfg.SMSProvider,
+		domain.ChannelEmail: cfg.EmailProvider,
+		domain.ChannelPush:  cfg.PushProvider,
+	}
+
+	senders := make(map[domain.NotificationChannel]notify.Sender)
+	for _, channel := range domain.NotificationChannels {
+		var sender notify.Sender
+		var err error
+
+		switch provider := providers[channel]; {
+		case provider == "none":
+			continue
+		case provider == "dev":
+			sender, err = notify.NewDevSender(string(channel), cfg.DevOutput)
+		case channel == domain.ChannelSMS && provider == "twilio":
+			sender, err = notify.NewTwilioSMS(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFrom)
+		case channel == domain.ChannelEmail && provider == "smtp":
+			sender, err = notify.NewSMTPEmail(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+		case channel == domain.ChannelPush && provider == "fcm":
+			sender, err = notify.NewFCMPush(cfg.FCMCredentialsFile)
+		default:
+			return nil, fmt.Errorf("unknown %s provider %q", channel, provider)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up %s provider: %w", channel, err)
+		}
+		senders[channel] = sender
+	}
+
+	return senders, nil
+}
+
+// ============================================================================
+// TEMPLATES
+// ============================================================================
+
+// notificationData fills in the templates
+type notificationData struct {
+	Name      string
+	OTP       string
+	Minutes   int    // OTP validity
+	OrderRef  string // Short order number shown to customers
+	Amount    string // Formatted rupees
+	PlanName  string
+	MealsLeft int
+	Title     string // Promotion text written by the admin
+	Message   string
+}
+
+// notificationText is the subject (email subject, push title) and body of an
+// event in one language. SMS bodies must match the templates registered
+// for DLT with the telecom operators.
+type notificationText struct {
+	Subject string
+	Body    string
+}
+
+var notificationTexts = map[domain.NotificationEvent]map[domain.Language]notificationText{
+	domain.NotifyOTP: {
+		domain.LanguageEnglish: {
+			Subject: "Your login code",
+			Body:    "{{.OTP}} is your Food Delivery login code. It is valid for {{.Minutes}} minutes. Do not share it with anyone.",
+		},
+		domain.LanguageTelugu: {
+			Subject: "మీ లాగిన్ కోడ్",
+			Body:    "{{.OTP}} మీ Food Delivery లాగిన్ కోడ్. ఇది {{.Minutes}} నిమిషాల పాటు చెల్లుతుంది. దీన్ని ఎవరితోనూ పంచుకోవద్దు.",
+		},
+	},
+	domain.NotifyOrderPaid: {
+		domain.LanguageEnglish: {
+			Subject: "Order #{{.OrderRef}} confirmed",
+			Body:    "Hi {{.Name}}, we received {{.Amount}} for order #{{.OrderRef}}. The kitchen will start on it shortly.",
+		},
+		domain.LanguageTelugu: {
+			Subject: "ఆర్డర్ #{{.OrderRef}} నిర్ధారించబడింది",
+			Body:    "నమస్తే {{.Name}}, ఆర్డర్ #{{.OrderRef}} కోసం {{.Amount}} అందింది. వంటగది త్వరలో మొదలుపెడుతుంది.",
+		},
+	},
+	domain.NotifyOutForDelivery: {
+		domain.LanguageEnglish: {
+			Subject: "Your order is on the way",
+			Body:    "Order #{{.OrderRef}} is out for delivery and will reach you soon.",
+		},
+		domain.LanguageTelugu: {
+			Subject: "మీ ఆర్డర్ దారిలో ఉంది",
+			Body:    "ఆర్డర్ #{{.OrderRef}} డెలివరీకి బయలుదేరింది, త్వరలో మీకు చేరుతుంది.",
+		},
+	},
+	domain.NotifyDelivered: {
+		domain.LanguageEnglish: {
+			Subject: "Order delivered",
+			Body:    "Order #{{.OrderRef}} has been delivered. Enjoy your meal, and rate it in the app!",
+		},
+		domain.LanguageTelugu: {
+			Subject: "ఆర్డర్ డెలివరీ అయింది",
+			Body:    "ఆర్డర్ #{{.OrderRef}} డెలివరీ అయింది. భోజనాన్ని ఆస్వాదించండి, యాప్‌లో రేటింగ్ ఇవ్వండి!",
+		},
+	},
+	domain.NotifyRefund: {
+		domain.LanguageEnglish: {
+			Subject: "Refund of {{.Amount}} issued",
+			Body:    "We have refunded {{.Amount}}{{if .OrderRef}} for order #{{.OrderRef}}{{end}}. It reaches your account in 5-7 working days.",
+		},
+		domain.LanguageTelugu: {
+			Subject: "{{.Amount}} రీఫండ్ జారీ చేయబడింది",
+			Body:    "{{if .OrderRef}}ఆర్డర్ #{{.OrderRef}} కోసం {{end}}{{.Amount}} రీఫండ్ చేశాము. ఇది 5-7 పని దినాల్లో మీ ఖాతాకు చేరుతుంది.",
+		},
+	},
+	domain.NotifySubscriptionRenewal: {
+		domain.LanguageEnglish: {
+			Subject: "Renew your tiffin plan",
+			Body:    "Only {{.MealsLeft}} meals left on your {{.PlanName}} plan. Renew in the app to keep your tiffins coming.",
+		},
+		domain.LanguageTelugu: {
+			Subject: "మీ టిఫిన్ ప్లాన్ పునరుద్ధరించండి",
+			Body:    "మీ {{.PlanName}} ప్లాన్‌లో ఇంకా {{.MealsLeft}} భోజనాలు మాత్రమే మిగిలి ఉన్నాయి. టిఫిన్లు కొనసాగాలంటే యాప్‌లో పునరుద్ధరించండి.",
+		},
+	},
+	domain.NotifySubscriptionExpired: {
+		domain.LanguageEnglish: {
+			Subject: "Your tiffin plan has ended",
+			Body:    "Your {{.PlanName}} plan has used its last meal. Renew in the app to restart your tiffins.",
+		},
+		domain.LanguageTelugu: {
+			Subject: "మీ టిఫిన్ ప్లాన్ ముగిసింది",
+			Body:    "మీ {{.PlanName}} ప్లాన్‌లోని చివరి భోజనం పూర్తయింది. టిఫిన్లు మళ్లీ ప్రారంభించడానికి యాప్‌లో పునరుద్ధరించండి.",
+		},
+	},
+	domain.NotifyPromotion: {
+		// Written by the admin; other languages fall back to this
+		domain.LanguageEnglish: {
+			Subject: "{{.Title}}",
+			Body:    "{{.Message}}",
+		},
+	},
+}
+
+// notificationTemplates are notificationTexts parsed once at startup
+var notificationTemplates = parseNotificationTemplates()
+
+func parseNotificationTemplates() map[domain.NotificationEvent]map[domain.Language][2]*template.Template {
+	parsed := make(map[domain.NotificationEvent]map[domain.Language][2]*template.Template)
+	for event, languages := range notificationTexts {
+		parsed[event] = make(map[domain.Language][2]*template.Template)
+		for language, text := range languages {
+			name := string(event) + "." + string(language)
+			parsed[event][language] = [2]*template.Template{
+				template.Must(template.New(name + ".subject").Parse(text.Subject)),
+				template.Must(template.New(name + ".body").Parse(text.Body)),
+			}
+		}
+	}
+	return parsed
+}
+
+// render fills in the subject and body of an event in the user's language,
+// falling back to English
+func render(event domain.NotificationEvent, language domain.Language, data notificationData) (string, string, error) {
+	templates, ok := notificationTemplates[event][language]
+	if !ok {
+		templates = notificationTemplates[event][domain.LanguageEnglish]
+	}
+
+	var subject, body bytes.Buffer
+	if err := templates[0].Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s subject: %w", event, err)
+	}
+	if err := templates[1].Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s body: %w", event, err)
+	}
+
+	return subject.String(), body.String(), nil
+}
+
+// formatRupees formats paisa for customers, e.g. ₹149.50
+func formatRupees(paisa int64) string {
+	return fmt.Sprintf("₹%d.%02d", paisa/100, paisa%100)
+}
+
+// orderRef is the short order number shown to customers
+func orderRef(orderID uuid.UUID) string {
+	return strings.ToUpper(orderID.String()[:8])
+}
+
+// ============================================================================
+// NOTIFICATION USECASE
+// ============================================================================
+
+// NotificationUsecase queues notifications on the channels the rules give
+// each event, and a worker sends them with retries and backoff
+type NotificationUsecase struct {
+	notificationRepo *repository.NotificationRepository
+	userRepo         *repository.UserRepository
+	orderRepo        *repository.OrderRepository
+	senders          map[domain.NotificationChannel]notify.Sender
+	rules            map[domain.NotificationEvent][]domain.NotificationChannel
+	maxAttempts      int
+	location         *time.Location // Quiet hours and the promotion window are in this timezone
+	wake             chan struct{}
+	log              *logger.Logger
+}
+
+// NewNotificationUsecase creates a new notification usecase
+func NewNotificationUsecase(
+	notificationRepo *repository.NotificationRepository,
+	userRepo *repository.UserRepository,
+	orderRepo *repository.OrderRepository,
+	senders map[domain.NotificationChannel]notify.Sender,
+	rules map[domain.NotificationEvent][]domain.NotificationChannel,
+	maxAttempts int,
+	location *time.Location,
+	log *logger.Logger,
+) *NotificationUsecase {
+	return &NotificationUsecase{
+		notificationRepo: notificationRepo,
+		userRepo:         userRepo,
+		orderRepo:        orderRepo,
+		senders:          senders,
+		rules:            rules,
+		maxAttempts:      maxAttempts,
+		location:         location,
+		wake:             make(chan struct{}, 1),
+		log:              log,
+	}
+}
+
+// notifyUser loads the user and queues the event for them
+func (u *NotificationUsecase) notifyUser(ctx context.Context, event domain.NotificationEvent, userID uuid.UUID, data notificationData, push map[string]string, dedupKey string) error {
+	user, err := u.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			u.log.Warn("Skipping notification for unknown user", "event", string(event), "user_id", userID.String())
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return u.queue(ctx, event, user, data, push, dedupKey, nil)
+}
+
+// queue renders an event for a user and queues one notification per channel
+// and recipient the user has not turned off. dedupKey identifies the cause,
+// so queueing the same cause again is a no-op.
+func (u *NotificationUsecase) queue(ctx context.Context, event domain.NotificationEvent, user *domain.User, data notificationData, push map[string]string, dedupKey string, expiresAt *time.Time) error {
+	if data.Name == "" {
+		data.Name = user.Name
+	}
+	subject, body, err := render(event, user.Language, data)
+	if err != nil {
+		return err
+	}
+
+	var prefs *domain.NotificationPreferences
+	if event.Category() != domain.CategoryAccount {
+		prefs, err = u.notificationRepo.GetPreferences(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var batch []domain.Notification
+	add := func(channel domain.NotificationChannel, recipient string, payload map[string]string) {
+		batch = append(batch, domain.Notification{
+			UserID:    &user.ID,
+			Event:     event,
+			Channel:   channel,
+			Recipient: recipient,
+			Subject:   subject,
+			Body:      body,
+			Data:      payload,
+			ExpiresAt: expiresAt,
+			DedupKey:  dedupKey + ":" + string(channel) + ":" + recipient,
+		})
+	}
+
+	for _, channel := range u.rules[event] {
+		if _, ok := u.senders[channel]; !ok {
+			continue
+		}
+		if prefs != nil && !prefs.Allows(event, channel) {
+			continue
+		}
+
+		switch channel {
+		case domain.ChannelSMS:
+			add(channel, user.PhoneNumber, nil)
+		case domain.ChannelEmail:
+			if user.Email != "" {
+				add(channel, user.Email, nil)
+			}
+		case domain.ChannelPush:
+			devices, err := u.notificationRepo.GetDevices(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			if len(devices) > maxPushDevices {
+				devices = devices[:maxPushDevices]
+			}
+			for _, device := range devices {
+				payload := map[string]string{"event": string(event)}
+				for k, v := range push {
+					payload[k] = v
+				}
+				add(channel, device.Token, payload)
+			}
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	queued, err := u.notificationRepo.Enqueue(ctx, batch)
+	if err != nil {
+		return err
+	}
+	if len(queued) > 0 {
+		u.wakeWorker()
+	}
+
+	return nil
+}
+
+// SendOTP queues a login code for the user. It is not sent once it has expired.
+func (u *NotificationUsecase) SendOTP(ctx context.Context, user *domain.User, code string, validity time.Duration) error {
+	expiresAt := time.Now().Add(validity)
+	data := notificationData{OTP: code, Minutes: int(validity.Minutes())}
+	return u.queue(ctx, domain.NotifyOTP, user, data, nil, "otp:"+uuid.NewString(), &expiresAt)
+}
+
+// ============================================================================
+// DOMAIN EVENTS
+// ============================================================================
+
+// HandleEvent turns order and refund events from the outbox into
+// notifications. Events are delivered at least once; the dedup key makes a
+// redelivered event queue nothing.
+func (u *NotificationUsecase) HandleEvent(ctx context.Context, event domain.OutboxEvent) error {
+	dedupKey := fmt.Sprintf("event:%d", event.ID)
+
+	switch event.Type {
+	case domain.EventOrderPaid:
+		var paid domain.OrderPaidEvent
+		if !u.decode(event, &paid) {
+			return nil
+		}
+
+		order, err := u.getOrder(ctx, paid.OrderID)
+		if err != nil || order == nil {
+			return err
+		}
+		// Tiffins are paid with the plan and dine-in rounds at the table
+		if order.SubscriptionID != nil || order.FulfillmentType == domain.FulfillmentDineIn {
+			return nil
+		}
+
+		data := notificationData{OrderRef: orderRef(order.ID), Amount: formatRupees(paid.Amount)}
+		return u.notifyUser(ctx, domain.NotifyOrderPaid, paid.UserID, data, orderPush(order.ID), dedupKey)
+
+	case domain.EventOrderStatusChanged:
+		var changed domain.OrderStatusChangedEvent
+		if !u.decode(event, &changed) {
+			return nil
+		}
+
+		var notification domain.NotificationEvent
+		switch changed.To {
+		case domain.OrderStatusOutForDelivery:
+			notification = domain.NotifyOutForDelivery
+		case domain.OrderStatusDelivered:
+			notification = domain.NotifyDelivered
+		default:
+			return nil
+		}
+
+		if notification == domain.NotifyDelivered {
+			// Dine-in rounds are marked delivered when served at the table
+			order, err := u.getOrder(ctx, changed.OrderID)
+			if err != nil || order == nil || order.FulfillmentType == domain.FulfillmentDineIn {
+				return err
+			}
+		}
+
+		data := notificationData{OrderRef: orderRef(changed.OrderID)}
+		return u.notifyUser(ctx, notification, changed.UserID, data, orderPush(changed.OrderID), dedupKey)
+
+	case domain.EventRefundIssued:
+		var refund domain.RefundIssuedEvent
+		if !u.decode(event, &refund) || refund.UserID == nil {
+			return nil
+		}
+
+		data := notificationData{Amount: formatRupees(refund.Amount)}
+		var push map[string]string
+		if refund.OrderID != nil {
+			data.OrderRef = orderRef(*refund.OrderID)
+			push = orderPush(*refund.OrderID)
+		}
+		return u.notifyUser(ctx, domain.NotifyRefund, *refund.UserID, data, push, dedupKey)
+	}
+
+	return nil
+}
+
+// decode unmarshals an event payload. A payload that cannot be read will not
+// improve on retry, so it is logged and skipped.
+func (u *NotificationUsecase) decode(event domain.OutboxEvent, payload interface{}) bool {
+	if err := json.Unmarshal(event.Payload, payload); err != nil {
+		u.log.Error("Skipping unreadable event", "event_id", event.ID, "event_type", string(event.Type), "error", err)
+		return false
+	}
+	return true
+}
+
+// getOrder loads an order for an event; nil if it no longer exists
+func (u *NotificationUsecase) getOrder(ctx context.Context, orderID uuid.UUID) (*domain.Order, error) {
+	order, err := u.orderRepo.GetByID(ctx, orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return order, err
+}
+
+// orderPush is the push payload that opens an order in the app
+func orderPush(orderID uuid.UUID) map[string]string {
+	return map[string]string{"order_id": orderID.String()}
+}
+
+// RenewalDue tells the customer their tiffin plan is running out.
+// Implements SubscriptionNotifier; the scheduler sends it once per period.
+func (u *NotificationUsecase) RenewalDue(ctx context.Context, sub *domain.Subscription, mealsLeft int) {
+	data := notificationData{PlanName: sub.PlanName, MealsLeft: mealsLeft}
+	push := map[string]string{"subscription_id": sub.ID.String()}
+	if err := u.notifyUser(ctx, domain.NotifySubscriptionRenewal, sub.UserID, data, push, "subscription:"+uuid.NewString()); err != nil {
+		u.log.Error("Failed to queue renewal reminder", "subscription_id", sub.ID.String(), "error", err)
+	}
+}
+
+// Expired tells the customer their last paid tiffin has been used.
+// Implements SubscriptionNotifier.
+func (u *NotificationUsecase) Expired(ctx context.Context, sub *domain.Subscription) {
+	data := notificationData{PlanName: sub.PlanName}
+	push := map[string]string{"subscription_id": sub.ID.String()}
+	if err := u.notifyUser(ctx, domain.NotifySubscriptionExpired, sub.UserID, data, push, "subscription:"+uuid.NewString()); err != nil {
+		u.log.Error("Failed to queue expiry notice", "subscription_id", sub.ID.String(), "error", err)
+	}
+}
+
+// ============================================================================
+// DEVICES
+// ============================================================================
+
+// RegisterDeviceRequest registers the app install for push notifications
+type RegisterDeviceRequest struct {
+	Token    string                `json:"token"`
+	Platform domain.DevicePlatform `json:"platform"`
+}
+
+// RegisterDevice registers a push token for the user
+func (u *NotificationUsecase) RegisterDevice(ctx context.Context, userID uuid.UUID, req RegisterDeviceRequest) (*domain.Device, error) {
+	token := strings.TrimSpace(req.Token)
+	if token == "" || len(token) > 512 {
+		return nil, fmt.Errorf("%w: token must be 1-512 characters", ErrInvalidDevice)
+	}
+	if !req.Platform.IsValid() {
+		return nil, fmt.Errorf("%w: platform must be android, ios or web", ErrInvalidDevice)
+	}
+
+	device := &domain.Device{Token: token, UserID: userID, Platform: req.Platform}
+	if err := u.notificationRepo.SaveDevice(ctx, device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// UnregisterDevice stops push notifications to a device, e.g. on sign-out
+func (u *NotificationUsecase) UnregisterDevice(ctx context.Context, userID uuid.UUID, token string) error {
+	return u.notificationRepo.DeleteDevice(ctx, userID, token)
+}
+
+// GetNotifications lists recent notifications for support, optionally of some
+// statuses or one user only
+func (u *NotificationUsecase) GetNotifications(ctx context.Context, statuses []string, userID *uuid.UUID, limit int) ([]domain.Notification, error) {
+	filter := make([]domain.NotificationStatus, 0, len(statuses))
+	for _, s := range statuses {
+		status := domain.NotificationStatus(s)
+		if status != domain.NotificationPending && status != domain.NotificationSent && status != domain.NotificationFailed {
+			return nil, fmt.Errorf("%w: unknown status %s", ErrInvalidFilter, s)
+		}
+		filter = append(filter, status)
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	return u.notificationRepo.GetRecent(ctx, filter, userID, limit)
+}
+
+// ============================================================================
+// PREFERENCES
+// ============================================================================
+
+// UpdatePreferencesRequest changes notification preferences; fields left out
+// are kept
+type UpdatePreferencesRequest struct {
+	Language       *domain.Language                                             `json:"language"`
+	MarketingOptIn *bool                                                        `json:"marketing_opt_in"`
+	Channels       map[domain.NotificationCategory][]domain.NotificationChannel `json:"channels"` // Only the categories given are changed
+	QuietHours     *domain.QuietHours                                           `json:"quiet_hours"`
+}
+
+// ConsentActor is who changed preferences, and from where, for the consent log
+type ConsentActor struct {
+	UserID    uuid.UUID
+	Source    domain.ConsentSource
+	IPAddress string
+	UserAgent string
+}
+
+// GetPreferences retrieves a user's notification preferences, with the
+// default channels filled in for categories they have not chosen
+func (u *NotificationUsecase) GetPreferences(ctx context.Context, userID uuid.UUID) (*domain.NotificationPreferences, error) {
+	prefs, err := u.notificationRepo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return withDefaultChannels(prefs), nil
+}
+
+// UpdatePreferences changes a user's notification preferences and records
+// every change in the consent log. Messages already queued follow the new
+// preferences when they are sent.
+func (u *NotificationUsecase) UpdatePreferences(ctx context.Context, userID uuid.UUID, req UpdatePreferencesRequest, actor ConsentActor) (*domain.NotificationPreferences, error) {
+	if req.Language != nil && !req.Language.IsValid() {
+		return nil, fmt.Errorf("%w: language must be en or te", ErrInvalidPreferences)
+	}
+
+	channels := make(map[domain.NotificationCategory][]domain.NotificationChannel, len(req.Channels))
+	for category, list := range req.Channels {
+		if _, ok := domain.DefaultNotificationChannels[category]; !ok {
+			return nil, fmt.Errorf("%w: unknown category %s", ErrInvalidPreferences, category)
+		}
+		normalized, err := normalizeChannels(list)
+		if err != nil {
+			return nil, err
+		}
+		channels[category] = normalized
+	}
+
+	if req.QuietHours != nil {
+		if err := validateQuietHours(req.QuietHours); err != nil {
+			return nil, err
+		}
+	}
+
+	prefs, err := u.notificationRepo.UpdatePreferences(ctx, userID, func(prefs *domain.NotificationPreferences) ([]domain.ConsentChange, error) {
+		var changes []domain.ConsentChange
+		record := func(setting, oldValue, newValue string) {
+			if oldValue != newValue {
+				changes = append(changes, domain.ConsentChange{
+					Setting:   setting,
+					OldValue:  oldValue,
+					NewValue:  newValue,
+					Source:    actor.Source,
+					ChangedBy: actor.UserID,
+					IPAddress: actor.IPAddress,
+					UserAgent: actor.UserAgent,
+				})
+			}
+		}
+
+		if req.Language != nil {
+			record("language", string(prefs.Language), string(*req.Language))
+			prefs.Language = *req.Language
+		}
+
+		if req.MarketingOptIn != nil {
+			record("marketing_opt_in", strconv.FormatBool(prefs.MarketingOptIn), strconv.FormatBool(*req.MarketingOptIn))
+			prefs.MarketingOptIn = *req.MarketingOptIn
+		}
+
+		for _, category := range []domain.NotificationCategory{domain.CategoryOrderUpdates, domain.CategoryPromotions} {
+			list, ok := channels[category]
+			if !ok {
+				continue
+			}
+			record("channels."+string(category), joinChannels(prefs.ChannelsFor(category)), joinChannels(list))
+			if prefs.Channels == nil {
+				prefs.Channels = make(map[domain.NotificationCategory][]domain.NotificationChannel)
+			}
+			prefs.Channels[category] = list
+		}
+
+		if req.QuietHours != nil {
+			quiet := *req.QuietHours
+			if !quiet.Enabled {
+				quiet = domain.QuietHours{}
+			}
+			record("quiet_hours", formatQuietHours(prefs.QuietHours), formatQuietHours(quiet))
+			prefs.QuietHours = quiet
+		}
+
+		return changes, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Notification preferences updated", "user_id", userID.String(), "changed_by", actor.UserID.String(), "source", string(actor.Source))
+
+	return withDefaultChannels(prefs), nil
+}
+
+// GetConsentChanges retrieves a user's consent log, newest first
+func (u *NotificationUsecase) GetConsentChanges(ctx context.Context, userID uuid.UUID, limit int) ([]domain.ConsentChange, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return u.notificationRepo.GetConsentChanges(ctx, userID, limit)
+}
+
+// withDefaultChannels fills in the channels of categories the user has not
+// chosen, so clients show the channels actually used
+func withDefaultChannels(prefs *domain.NotificationPreferences) *domain.NotificationPreferences {
+	channels := make(map[domain.NotificationCategory][]domain.NotificationChannel, len(domain.DefaultNotificationChannels))
+	for category := range domain.DefaultNotificationChannels {
+		channels[category] = prefs.ChannelsFor(category)
+	}
+	prefs.Channels = channels
+	return prefs
+}
+
+// normalizeChannels validates a channel list and puts it in the standard
+// order without duplicates
+func normalizeChannels(list []domain.NotificationChannel) ([]domain.NotificationChannel, error) {
+	chosen := make(map[domain.NotificationChannel]bool, len(list))
+	for _, channel := range list {
+		if channel != domain.ChannelSMS && channel != domain.ChannelEmail && channel != domain.ChannelPush {
+			return nil, fmt.Errorf("%w: unknown channel %s", ErrInvalidPreferences, channel)
+		}
+		chosen[channel] = true
+	}
+
+	normalized := []domain.NotificationChannel{}
+	for _, channel := range domain.NotificationChannels {
+		if chosen[channel] {
+			normalized = append(normalized, channel)
+		}
+	}
+	return normalized, nil
+}
+
+// joinChannels formats channels for the consent log; empty means none
+func joinChannels(channels []domain.NotificationChannel) string {
+	names := make([]string, len(channels))
+	for i, c := range channels {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ",")
+}
+
+func formatQuietHours(quiet domain.QuietHours) string {
+	if !quiet.Enabled {
+		return "off"
+	}
+	return quiet.Start + "-" + quiet.End
+}
+
+func validateQuietHours(quiet *domain.QuietHours) error {
+	if !quiet.Enabled {
+		return nil
+	}
+
+	start, err := parseClock(quiet.Start)
+	if err != nil {
+		return fmt.Errorf("%w: quiet hours start must be HH:MM", ErrInvalidPreferences)
+	}
+	end, err := parseClock(quiet.End)
+	if err != nil {
+		return fmt.Errorf("%w: quiet hours end must be HH:MM", ErrInvalidPreferences)
+	}
+	if start == end {
+		return fmt.Errorf("%w: quiet hours must not start and end at the same time", ErrInvalidPreferences)
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into the time since midnight
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// holdUntil returns when an SMS or push message may be sent if now is in the
+// user's quiet hours or, for promotions, outside the promotion window. Zero
+// means it can be sent now.
+func (u *NotificationUsecase) holdUntil(prefs *domain.NotificationPreferences, event domain.NotificationEvent, channel domain.NotificationChannel, now time.Time) time.Time {
+	if channel == domain.ChannelEmail {
+		return time.Time{}
+	}
+
+	var quietStart, quietEnd time.Duration
+	quiet := prefs.QuietHours.Enabled && !quietHoursExempt[event]
+	if quiet {
+		var errStart, errEnd error
+		quietStart, errStart = parseClock(prefs.QuietHours.Start)
+		quietEnd, errEnd = parseClock(prefs.QuietHours.End)
+		quiet = errStart == nil && errEnd == nil
+	}
+
+	// Moving out of one window can land in the other, so repeat until neither applies
+	t := now
+	for i := 0; i < 3; i++ {
+		moved := false
+		if event == domain.NotifyPromotion {
+			if until, ok := u.outsideWindow(t, promotionWindowStart, promotionWindowEnd); ok {
+				t, moved = until, true
+			}
+		}
+		if quiet {
+			if until, ok := u.insideWindow(t, quietStart, quietEnd); ok {
+				t, moved = until, true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+
+	if t.Equal(now) {
+		return time.Time{}
+	}
+	return t
+}
+
+// insideWindow checks if t is in the daily window from start to end (which
+// may span midnight) and returns when the window ends
+func (u *NotificationUsecase) insideWindow(t time.Time, start, end time.Duration) (time.Time, bool) {
+	local := t.In(u.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, u.location)
+	offset := local.Sub(midnight)
+
+	switch {
+	case start < end && offset >= start && offset < end:
+		return midnight.Add(end), true
+	case start > end && offset >= start:
+		return midnight.AddDate(0, 0, 1).Add(end), true
+	case start > end && offset < end:
+		return midnight.Add(end), true
+	}
+	return time.Time{}, false
+}
+
+// outsideWindow checks if t is outside the daily window from start to end and
+// returns when the window next opens
+func (u *NotificationUsecase) outsideWindow(t time.Time, start, end time.Duration) (time.Time, bool) {
+	return u.insideWindow(t, end, start)
+}
+
+// ============================================================================
+// PROMOTIONS
+// ============================================================================
+
+// PromotionRequest is a marketing message to every user who opted in. SMS
+// text must match a promotional template registered for DLT.
+type PromotionRequest struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// SendPromotion queues a promotion for every user who opted in to marketing,
+// on the channels each chose for promotions. Returns the number of users.
+func (u *NotificationUsecase) SendPromotion(ctx context.Context, req PromotionRequest) (int, error) {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Title == "" || len(req.Title) > 100 {
+		return 0, fmt.Errorf("%w: title must be 1-100 characters", ErrInvalidPromotion)
+	}
+	if req.Message == "" || len(req.Message) > 1000 {
+		return 0, fmt.Errorf("%w: message must be 1-1000 characters", ErrInvalidPromotion)
+	}
+
+	promotionID := uuid.NewString()
+	data := notificationData{Title: req.Title, Message: req.Message}
+	push := map[string]string{"promotion_id": promotionID}
+
+	users := 0
+	after := uuid.Nil
+	for {
+		ids, err := u.notificationRepo.GetMarketingAudience(ctx, after, promotionAudiencePage)
+		if err != nil {
+			return users, err
+		}
+
+		for _, id := range ids {
+			if err := u.notifyUser(ctx, domain.NotifyPromotion, id, data, push, "promotion:"+promotionID); err != nil {
+				return users, err
+			}
+			users++
+		}
+
+		if len(ids) < promotionAudiencePage {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+
+	u.log.Info("Promotion queued", "promotion_id", promotionID, "users", users)
+
+	return users, nil
+}
+
+// ============================================================================
+// WORKER
+// ============================================================================
+
+// wakeWorker makes the worker send right away instead of at its next tick
+func (u *NotificationUsecase) wakeWorker() {
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunWorker sends due notifications as they are queued, and retries failed
+// ones, until ctx is cancelled. Running it on several instances is safe.
+func (u *NotificationUsecase) RunWorker(ctx context.Context) {
+	ticker := time.NewTicker(notificationWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		u.SendDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-u.wake:
+		}
+	}
+}
+
+// SendDue sends every notification whose next attempt is due. Returns how
+// many were attempted.
+func (u *NotificationUsecase) SendDue(ctx context.Context) int {
+	attempted := 0
+	for ctx.Err() == nil {
+		batch, err := u.notificationRepo.ClaimDue(ctx, notificationBatchSize, notificationLease)
+		if err != nil {
+			u.log.Error("Failed to claim notifications", "error", err)
+			return attempted
+		}
+
+		for i := range batch {
+			u.send(ctx, &batch[i])
+		}
+		attempted += len(batch)
+
+		if len(batch) < notificationBatchSize {
+			break
+		}
+	}
+	return attempted
+}
+
+// send makes one attempt and records the outcome: sent, retried after a
+// backoff, or given up
+func (u *NotificationUsecase) send(ctx context.Context, n *domain.Notification) {
+	log := u.log.WithFields(map[string]interface{}{
+		"notification_id": n.ID.String(),
+		"event":           string(n.Event),
+		"channel":         string(n.Channel),
+		"attempt":         n.Attempts,
+	})
+
+	if n.ExpiresAt != nil && time.Now().After(*n.ExpiresAt) {
+		u.finish(ctx, log, n, "expired before it could be sent")
+		return
+	}
+
+	sender, ok := u.senders[n.Channel]
+	if !ok {
+		u.finish(ctx, log, n, "channel is disabled")
+		return
+	}
+
+	// Preferences may have changed since the message was queued
+	if n.UserID != nil && n.Event.Category() != domain.CategoryAccount {
+		prefs, err := u.notificationRepo.GetPreferences(ctx, *n.UserID)
+		if err != nil {
+			log.Error("Failed to get notification preferences", "error", err)
+			u.retry(ctx, log, n, err)
+			return
+		}
+		if !prefs.Allows(n.Event, n.Channel) {
+			u.finish(ctx, log, n, "turned off by the user")
+			return
+		}
+		if until := u.holdUntil(prefs, n.Event, n.Channel, time.Now()); !until.IsZero() {
+			if err := u.notificationRepo.Hold(ctx, n.ID, until); err != nil {
+				log.Error("Failed to hold notification", "error", err)
+			}
+			return
+		}
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, notificationSendTimeout)
+	err := sender.Send(sendCtx, notify.Message{
+		To:      n.Recipient,
+		Subject: n.Subject,
+		Body:    n.Body,
+		Data:    n.Data,
+	})
+	cancel()
+
+	if err == nil {
+		if err := u.notificationRepo.MarkSent(ctx, n.ID); err != nil {
+			log.Error("Failed to record sent notification", "error", err)
+		}
+		return
+	}
+
+	switch {
+	case errors.Is(err, notify.ErrInvalidRecipient):
+		if n.Channel == domain.ChannelPush {
+			if err := u.notificationRepo.DeleteDeviceToken(ctx, n.Recipient); err != nil {
+				log.Error("Failed to forget push device", "error", err)
+			}
+		}
+		u.finish(ctx, log, n, err.Error())
+	case errors.Is(err, notify.ErrPermanent), n.Attempts >= u.maxAttempts:
+		u.finish(ctx, log, n, err.Error())
+	default:
+		u.retry(ctx, log, n, err)
+	}
+}
+
+// retry schedules the next attempt after a backoff
+func (u *NotificationUsecase) retry(ctx context.Context, log *logger.Logger, n *domain.Notification, cause error) {
+	next := time.Now().Add(notificationBackoff(n.Attempts))
+	log.Warn("Notification failed, will retry", "error", cause, "next_attempt_at", next)
+	if err := u.notificationRepo.MarkRetry(ctx, n.ID, cause.Error(), next); err != nil {
+		log.Error("Failed to reschedule notification", "error", err)
+	}
+}
+
+// finish gives up on a notification
+func (u *NotificationUsecase) finish(ctx context.Context, log *logger.Logger, n *domain.Notification, reason string) {
+	log.Warn("Notification not sent", "reason", reason)
+	if err := u.notificationRepo.MarkFailed(ctx, n.ID, reason); err != nil {
+		log.Error("Failed to record failed notification", "error", err)
+	}
+}
+
+// notificationBackoff is the wait after the given failed attempt: 30s, 1m,
+// 2m, ... up to an hour
+func notificationBackoff(attempt int) time.Duration {
+	backoff := notificationBaseBackoff
+	for i := 1; i < attempt && backoff < notificationMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > notificationMaxBackoff {
+		backoff = notificationMaxBackoff
+	}
+	return backoff
+}
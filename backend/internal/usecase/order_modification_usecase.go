@@ -0,0 +1,395 @@
+// Package usecase implements edits of paid orders before the kitchen accepts them
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Order modification errors
+var (
+	ErrNoOrderChange               = errors.New("order contents are unchanged")
+	ErrModificationNotFound        = errors.New("order modification not found")
+	ErrModificationPaymentMismatch = errors.New("payment does not match the order modification")
+)
+
+// OrderModificationUsecase lets customers add or remove items on a paid order
+// until the kitchen accepts it. Extra cost is collected through a separate
+// gateway order; a cheaper order is refunded the difference.
+type OrderModificationUsecase struct {
+	modificationRepo *repository.OrderModificationRepository
+	orderRepo        *repository.OrderRepository
+	refundRepo       *repository.RefundRepository
+	paymentUsecase   *PaymentUsecase
+	log              *logger.Logger
+}
+
+// NewOrderModificationUsecase creates a new order modification usecase
+func NewOrderModificationUsecase(
+	modificationRepo *repository.OrderModificationRepository,
+	orderRepo *repository.OrderRepository,
+	refundRepo *repository.RefundRepository,
+	paymentUsecase *PaymentUsecase,
+	log *logger.Logger,
+) *OrderModificationUsecase {
+	return &OrderModificationUsecase{
+		modificationRepo: modificationRepo,
+		orderRepo:        orderRepo,
+		refundRepo:       refundRepo,
+		paymentUsecase:   paymentUsecase,
+		log:              log,
+	}
+}
+
+// ModifyOrderRequest contains the complete new contents of an order
+type ModifyOrderRequest struct {
+	UserID  uuid.UUID         `json:"-"`
+	OrderID uuid.UUID         `json:"-"`
+	Items   []domain.CartItem `json:"items"`
+	Version int               `json:"version"` // Order version the customer edited
+}
+
+// ModifyOrderResponse describes the outcome of an edit. Payment is set when
+// the edit costs more and waits for the difference to be paid.
+type ModifyOrderResponse struct {
+	Modification *domain.OrderModification `json:"modification"`
+	Order        *domain.Order             `json:"order,omitempty"`
+	Payment      *InitiateOrderResponse    `json:"payment,omitempty"`
+	RefundAmount int64                     `json:"refund_amount,omitempty"` // Paisa
+}
+
+// ModifyOrder replaces the contents of a paid order. Prices are recomputed
+// from the menu; the delivery fee stays what was charged. If the kitchen
+// accepted the order (or it changed otherwise) since the customer loaded
+// Version, the edit fails with ErrVersionConflict.
+func (u *OrderModificationUsecase) ModifyOrder(ctx context.Context, req ModifyOrderRequest) (*ModifyOrderResponse, error) {
+	order, err := u.orderRepo.GetByID(ctx, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != req.UserID {
+		return nil, ErrOrderAccessDenied
+	}
+	if order.Status != domain.OrderStatusPaid || order.RazorpayPaymentID == "" || order.TableSessionID != nil || order.CateringRequestID != nil {
+		return nil, repository.ErrOrderNotEditable
+	}
+	if req.Version != order.Version {
+		return nil, repository.ErrVersionConflict
+	}
+
+	items, _, err := validateCart(req.Items, "")
+	if err != nil {
+		return nil, err
+	}
+
+	orderItems, subtotal, err := u.paymentUsecase.priceCart(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	keepAddedBy(order.Items, orderItems, req.UserID)
+
+	if sameContents(order.Items, orderItems) {
+		return nil, ErrNoOrderChange
+	}
+
+	mod := &domain.OrderModification{
+		OrderID:     order.ID,
+		BaseVersion: order.Version,
+		Items:       orderItems,
+		OldTotal:    order.TotalAmount,
+		NewTotal:    subtotal + order.DeliveryFee,
+		CreatedBy:   req.UserID,
+	}
+
+	log := u.log.WithFields(map[string]interface{}{
+		"order_id": order.ID.String(),
+		"user_id":  req.UserID.String(),
+	})
+
+	if mod.Delta() > 0 {
+		return u.createPending(ctx, mod, log)
+	}
+
+	refunds, err := u.modificationRepo.Apply(ctx, mod)
+	if err != nil {
+		if errors.Is(err, repository.ErrOutOfStock) {
+			return nil, ErrItemNotAvailable
+		}
+		return nil, err
+	}
+
+	log.Info("Order modified", "old_total", mod.OldTotal, "new_total", mod.NewTotal)
+
+	response := &ModifyOrderResponse{Modification: mod}
+	for i := range refunds {
+		u.processRefund(ctx, &refunds[i])
+		response.RefundAmount += refunds[i].Amount
+	}
+
+	response.Order, err = u.orderRepo.GetByID(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// createPending records an edit that costs more and opens a gateway order for the difference
+func (u *OrderModificationUsecase) createPending(ctx context.Context, mod *domain.OrderModification, log *logger.Logger) (*ModifyOrderResponse, error) {
+	if err := u.modificationRepo.CreatePending(ctx, mod); err != nil {
+		return nil, err
+	}
+
+	razorpayOrderID, err := u.paymentUsecase.CreateGatewayOrder(mod.Delta(), mod.ID.String(), map[string]interface{}{
+		"order_id":        mod.OrderID.String(),
+		"modification_id": mod.ID.String(),
+	})
+	if err != nil {
+		log.Error("Failed to create Razorpay order for order modification", "error", err, "modification_id", mod.ID.String())
+		return nil, fmt.Errorf("failed to create payment order: %w", err)
+	}
+
+	if err := u.modificationRepo.SetGatewayOrder(ctx, mod.ID, razorpayOrderID); err != nil {
+		return nil, err
+	}
+	mod.RazorpayOrderID = razorpayOrderID
+
+	log.Info("Order modification awaiting payment", "modification_id", mod.ID.String(), "amount", mod.Delta())
+
+	return &ModifyOrderResponse{
+		Modification: mod,
+		Payment: &InitiateOrderResponse{
+			ID:              mod.ID,
+			RazorpayOrderID: razorpayOrderID,
+			KeyID:           u.paymentUsecase.KeyID(),
+			Amount:          mod.Delta(),
+			Currency:        "INR",
+			Receipt:         mod.ID.String(),
+			Name:            "Food Delivery",
+			Description:     "Order changes",
+		},
+	}, nil
+}
+
+// keepAddedBy credits the edited lines of a group order to the members who
+// added them, so the per-member breakdown survives the edit. An edited line
+// takes the member of an unused current line with the same item, variant,
+// modifiers and bundle choices, preferring one with the same quantity and
+// notes; lines matching none are credited to the editor.
+func keepAddedBy(current, edited []domain.OrderItem, editorID uuid.UUID) {
+	group := false
+	for i := range current {
+		if current[i].AddedBy != nil {
+			group = true
+			break
+		}
+	}
+	if !group {
+		return
+	}
+
+	lineKey := func(item *domain.OrderItem) string {
+		return item.MenuItemID.String() + "/" + variantKey(item.VariantID) + "/" +
+			modifierKey(modifierOptionIDs(item.Modifiers)) + "/" + bundleKey(componentChoices(item.Components))
+	}
+
+	used := make([]bool, len(current))
+	match := func(edited *domain.OrderItem, exact bool) bool {
+		for i := range current {
+			if used[i] || current[i].AddedBy == nil || lineKey(&current[i]) != lineKey(edited) {
+				continue
+			}
+			if exact && (current[i].Quantity != edited.Quantity || current[i].Notes != edited.Notes) {
+				continue
+			}
+			used[i] = true
+			addedBy := *current[i].AddedBy
+			edited.AddedBy = &addedBy
+			return true
+		}
+		return false
+	}
+
+	for i := range edited {
+		match(&edited[i], true)
+	}
+	for i := range edited {
+		if edited[i].AddedBy == nil && !match(&edited[i], false) {
+			editor := editorID
+			edited[i].AddedBy = &editor
+		}
+	}
+}
+
+// sameContents reports whether an edit leaves the order lines as they are
+func sameContents(current, edited []domain.OrderItem) bool {
+	if len(current) != len(edited) {
+		return false
+	}
+	for i := range current {
+		if current[i].MenuItemID != edited[i].MenuItemID ||
+			variantKey(current[i].VariantID) != variantKey(edited[i].VariantID) ||
+			modifierKey(modifierOptionIDs(current[i].Modifiers)) != modifierKey(modifierOptionIDs(edited[i].Modifiers)) ||
+			bundleKey(componentChoices(current[i].Components)) != bundleKey(componentChoices(edited[i].Components)) ||
+			variantKey(current[i].AddedBy) != variantKey(edited[i].AddedBy) ||
+			current[i].Quantity != edited[i].Quantity ||
+			current[i].Notes != edited[i].Notes ||
+			current[i].Price != edited[i].Price {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyModification records the difference payment after the client's
+// checkout success callback. The webhook records it as well; whichever
+// arrives first wins.
+func (u *OrderModificationUsecase) VerifyModification(ctx context.Context, userID, orderID uuid.UUID, razorpayOrderID, paymentID, signature string) (*domain.OrderModification, error) {
+	if razorpayOrderID == "" {
+		return nil, ErrModificationPaymentMismatch
+	}
+
+	mod, err := u.modificationRepo.GetByRazorpayOrderID(ctx, razorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrModificationNotFound
+		}
+		return nil, err
+	}
+
+	if mod.OrderID != orderID {
+		return nil, ErrModificationPaymentMismatch
+	}
+	if mod.CreatedBy != userID {
+		return nil, ErrOrderAccessDenied
+	}
+	if !u.paymentUsecase.VerifySignature(razorpayOrderID, paymentID, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	if err := u.capture(ctx, mod.ID, paymentID); err != nil {
+		return nil, err
+	}
+
+	return u.modificationRepo.GetByID(ctx, mod.ID)
+}
+
+// capture applies a paid edit, or refunds the payment if the order moved on
+// or an added item sold out
+func (u *OrderModificationUsecase) capture(ctx context.Context, modID uuid.UUID, paymentID string) error {
+	result, err := u.modificationRepo.CapturePayment(ctx, modID, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to record modification payment: %w", err)
+	}
+
+	if result.AlreadyProcessed {
+		return nil
+	}
+
+	log := u.log.WithFields(map[string]interface{}{
+		"modification_id": modID.String(),
+	})
+
+	if result.Refund != nil {
+		log.Warn("Modification could not be applied after payment, refunding", "amount", result.Refund.Amount, "reason", result.Refund.Reason)
+		u.processRefund(ctx, result.Refund)
+		return nil
+	}
+
+	log.Info("Order modification paid and applied")
+
+	return nil
+}
+
+// processRefund sends a recorded refund to the gateway. A refund the gateway
+// rejects stays recorded as failed for an admin to retry.
+func (u *OrderModificationUsecase) processRefund(ctx context.Context, refund *domain.Refund) {
+	log := u.log.WithFields(map[string]interface{}{
+		"modification_id": refund.SourceID.String(),
+		"refund_id":       refund.ID.String(),
+	})
+
+	razorpayRefundID, err := u.paymentUsecase.RefundPayment(refund.RazorpayPaymentID, refund.Amount, map[string]interface{}{
+		"modification_id": refund.SourceID.String(),
+		"reason":          refund.Reason,
+	})
+	if err != nil {
+		log.Error("Refund failed", "error", err)
+		if markErr := u.refundRepo.MarkFailed(ctx, refund.ID, err.Error()); markErr != nil {
+			log.Error("Failed to record refund failure", "error", markErr)
+		}
+		return
+	}
+
+	if err := u.refundRepo.MarkProcessed(ctx, refund.ID, razorpayRefundID); err != nil {
+		log.Error("Failed to record refund", "error", err, "razorpay_refund_id", razorpayRefundID)
+		return
+	}
+
+	log.Info("Order modification refunded", "amount", refund.Amount, "razorpay_refund_id", razorpayRefundID)
+}
+
+// GetRevisions retrieves the content history of one of the user's orders
+func (u *OrderModificationUsecase) GetRevisions(ctx context.Context, userID, orderID uuid.UUID, isAdmin bool) ([]domain.OrderRevision, error) {
+	order, err := u.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && order.UserID != userID {
+		return nil, ErrOrderAccessDenied
+	}
+
+	return u.modificationRepo.ListRevisions(ctx, orderID)
+}
+
+// OnPaymentCaptured records a difference paid through the gateway (webhook)
+func (u *OrderModificationUsecase) OnPaymentCaptured(ctx context.Context, payment GatewayPayment) (bool, error) {
+	mod, err := u.modificationRepo.GetByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	if payment.Amount != mod.Delta() {
+		u.log.Error("Captured amount does not match order modification",
+			"modification_id", mod.ID.String(),
+			"captured", payment.Amount,
+			"delta", mod.Delta(),
+		)
+		return true, ErrModificationPaymentMismatch
+	}
+
+	return true, u.capture(ctx, mod.ID, payment.ID)
+}
+
+// OnPaymentFailed leaves the edit pending so the customer can retry paying
+func (u *OrderModificationUsecase) OnPaymentFailed(ctx context.Context, payment GatewayPayment) (bool, error) {
+	mod, err := u.modificationRepo.GetByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	u.log.Warn("Order modification payment failed",
+		"modification_id", mod.ID.String(),
+		"order_id", mod.OrderID.String(),
+		"error_code", payment.ErrorCode,
+		"error_desc", payment.ErrorDesc,
+	)
+
+	return true, nil
+}
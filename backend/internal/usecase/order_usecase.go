@@ -3,7 +3,10 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -12,18 +15,32 @@ import (
 	"fooddelivery/pkg/logger"
 )
 
+// Order-related errors
+var (
+	ErrOrderAccessDenied = errors.New("order does not belong to user")
+	ErrNothingToReorder  = errors.New("none of the items in this order are available")
+	ErrPartialReorder    = errors.New("some items in this order are no longer available")
+	ErrInvalidFilter     = errors.New("invalid order filter")
+	ErrNotReadyToCollect = errors.New("order is not ready for pickup")
+)
+
 // OrderUsecase handles order-related business logic
 type OrderUsecase struct {
 	orderRepo      *repository.OrderRepository
+	menuRepo       *repository.MenuRepository
 	paymentUsecase *PaymentUsecase
+	location       *time.Location
 	log            *logger.Logger
 }
 
 // NewOrderUsecase creates a new order usecase
-func NewOrderUsecase(orderRepo *repository.OrderRepository, paymentUsecase *PaymentUsecase, log *logger.Logger) *OrderUsecase {
+// Date-only filters are interpreted in the given business timezone.
+func NewOrderUsecase(orderRepo *repository.OrderRepository, menuRepo *repository.MenuRepository, paymentUsecase *PaymentUsecase, location *time.Location, log *logger.Logger) *OrderUsecase {
 	return &OrderUsecase{
 		orderRepo:      orderRepo,
+		menuRepo:       menuRepo,
 		paymentUsecase: paymentUsecase,
+		location:       location,
 		log:            log,
 	}
 }
@@ -34,36 +51,385 @@ func (u *OrderUsecase) GetOrder(ctx context.Context, orderID uuid.UUID) (*domain
 	if err != nil {
 		return nil, err
 	}
+	order.MemberBreakdown = domain.BreakdownByMember(order.Items)
 	return order, nil
 }
 
-// GetUserOrders retrieves all orders for a user
-func (u *OrderUsecase) GetUserOrders(ctx context.Context, userID uuid.UUID) ([]domain.Order, error) {
-	orders, err := u.orderRepo.GetByUserID(ctx, userID)
+// OrderHistoryQuery is a customer order history request
+type OrderHistoryQuery struct {
+	Statuses []string
+	Cursor   string
+	Limit    int
+	Summary  bool // Item counts and preview instead of full line items
+}
+
+// GetUserOrders retrieves a page of a user's orders, newest first
+func (u *OrderUsecase) GetUserOrders(ctx context.Context, userID uuid.UUID, query OrderHistoryQuery) (*repository.OrderPage, error) {
+	filter, err := u.buildOrderFilter(OrderSearchQuery{
+		Statuses: query.Statuses,
+		Cursor:   query.Cursor,
+		Limit:    query.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := u.orderRepo.GetByUserID(ctx, userID, *filter, query.Summary)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return nil, fmt.Errorf("%w: cursor does not match the requested sort", ErrInvalidFilter)
+		}
 		return nil, fmt.Errorf("failed to fetch user orders: %w", err)
 	}
-	return orders, nil
+	return page, nil
 }
 
-// GetAllOrders retrieves all orders (admin only)
-func (u *OrderUsecase) GetAllOrders(ctx context.Context, limit, offset int) ([]domain.Order, error) {
-	if limit <= 0 {
-		limit = 50
-	}
-	if limit > 100 {
-		limit = 100
+// OrderSearchQuery is an admin order search as received from the API.
+// Dates accept RFC3339 timestamps or YYYY-MM-DD days in the business
+// timezone; a day in To is inclusive.
+type OrderSearchQuery struct {
+	Statuses        []string
+	From            string
+	To              string
+	UserPhone       string
+	UserEmail       string
+	MinAmount       *int64 // Paisa
+	MaxAmount       *int64 // Paisa
+	PaymentID       string
+	RazorpayOrderID string
+	SortBy          string // created_at (default) or updated_at
+	Order           string // desc (default) or asc
+	Cursor          string
+	Limit           int
+}
+
+// GetAllOrders searches all orders (admin only)
+func (u *OrderUsecase) GetAllOrders(ctx context.Context, query OrderSearchQuery) (*repository.OrderPage, error) {
+	filter, err := u.buildOrderFilter(query)
+	if err != nil {
+		return nil, err
 	}
 
-	orders, err := u.orderRepo.GetAllOrders(ctx, limit, offset)
+	page, err := u.orderRepo.GetAllOrders(ctx, *filter)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return nil, fmt.Errorf("%w: cursor does not match the requested sort", ErrInvalidFilter)
+		}
 		return nil, fmt.Errorf("failed to fetch all orders: %w", err)
 	}
-	return orders, nil
+	return page, nil
+}
+
+// buildOrderFilter validates a search query and converts it to a repository filter
+func (u *OrderUsecase) buildOrderFilter(query OrderSearchQuery) (*repository.OrderFilter, error) {
+	filter := &repository.OrderFilter{
+		UserPhone:       strings.TrimSpace(query.UserPhone),
+		UserEmail:       strings.TrimSpace(query.UserEmail),
+		MinAmount:       query.MinAmount,
+		MaxAmount:       query.MaxAmount,
+		PaymentID:       strings.TrimSpace(query.PaymentID),
+		RazorpayOrderID: strings.TrimSpace(query.RazorpayOrderID),
+		Limit:           query.Limit,
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Limit > 100 {
+		filter.Limit = 100
+	}
+
+	for _, raw := range query.Statuses {
+		status := domain.OrderStatus(strings.ToUpper(strings.TrimSpace(raw)))
+		if !isKnownStatus(status) {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, raw)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	if query.From != "" {
+		from, err := parseDateBoundary(query.From, u.location, false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid from date", ErrInvalidFilter)
+		}
+		filter.CreatedFrom = &from
+	}
+	if query.To != "" {
+		to, err := parseDateBoundary(query.To, u.location, true)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid to date", ErrInvalidFilter)
+		}
+		filter.CreatedTo = &to
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return nil, fmt.Errorf("%w: min_amount must not exceed max_amount", ErrInvalidFilter)
+	}
+
+	switch query.SortBy {
+	case "", string(repository.OrderSortCreatedAt):
+		filter.SortBy = repository.OrderSortCreatedAt
+	case string(repository.OrderSortUpdatedAt):
+		filter.SortBy = repository.OrderSortUpdatedAt
+	default:
+		return nil, fmt.Errorf("%w: sort must be created_at or updated_at", ErrInvalidFilter)
+	}
+
+	switch strings.ToLower(query.Order) {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidFilter)
+	}
+
+	if query.Cursor != "" {
+		cursor, err := repository.DecodeOrderCursor(query.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidFilter)
+		}
+		filter.Cursor = cursor
+	}
+
+	return filter, nil
+}
+
+// parseDateBoundary parses an RFC3339 timestamp or a YYYY-MM-DD day in loc.
+// For an inclusive end day the start of the following day is returned.
+func parseDateBoundary(value string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// isKnownStatus reports whether status is part of the order state machine
+func isKnownStatus(status domain.OrderStatus) bool {
+	switch status {
+	case domain.OrderStatusPending,
+		domain.OrderStatusAwaitingPayment,
+		domain.OrderStatusPaymentFailed,
+		domain.OrderStatusPaid,
+		domain.OrderStatusAccepted,
+		domain.OrderStatusOutForDelivery,
+		domain.OrderStatusDelivered,
+		domain.OrderStatusReadyForPickup,
+		domain.OrderStatusCollected,
+		domain.OrderStatusOnTab:
+		return true
+	}
+	return false
+}
+
+// ReorderRequest controls what Reorder does with the rebuilt cart
+type ReorderRequest struct {
+	// Checkout places the new order immediately instead of returning a preview
+	Checkout bool `json:"checkout"`
+	// AllowPartial lets checkout proceed when some items are no longer available
+	AllowPartial bool `json:"allow_partial"`
+	// FulfillmentType and DeliveryAddress override the past order's, e.g. to
+	// collect instead of having it delivered
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"`
+	DeliveryAddress string                 `json:"delivery_address"`
+}
+
+// ReorderLine describes how a line of the past order maps to the current menu
+type ReorderLine struct {
+	MenuItemID    uuid.UUID                   `json:"menu_item_id"`
+	Name          string                      `json:"name"`
+	VariantID     *uuid.UUID                  `json:"variant_id,omitempty"`
+	VariantName   string                      `json:"variant_name,omitempty"`
+	Modifiers     []domain.OrderItemModifier  `json:"modifiers,omitempty"`
+	Components    []domain.OrderItemComponent `json:"components,omitempty"`
+	Quantity      int                         `json:"quantity"`
+	Notes         string                      `json:"notes,omitempty"`
+	PreviousPrice int64                       `json:"previous_price"`          // Price paid last time (in paisa)
+	CurrentPrice  int64                       `json:"current_price,omitempty"` // Current menu price (in paisa), 0 if unavailable
+	Available     bool                        `json:"available"`
+	PriceChanged  bool                        `json:"price_changed"`
+}
+
+// ReorderResponse contains the cart preview and, when checked out, the new order
+type ReorderResponse struct {
+	SourceOrderID    uuid.UUID              `json:"source_order_id"`
+	Notes            string                 `json:"notes,omitempty"` // Order-level notes carried over
+	Lines            []ReorderLine          `json:"lines"`
+	Items            []domain.CartItem      `json:"items"` // Cart of the items that can be ordered now
+	UnavailableItems []ReorderLine          `json:"unavailable_items"`
+	RepricedItems    []ReorderLine          `json:"repriced_items"`
+	PreviousTotal    int64                  `json:"previous_total"` // Total of the past order (in paisa)
+	CurrentTotal     int64                  `json:"current_total"`  // Total of Items at current prices (in paisa)
+	Order            *InitiateOrderResponse `json:"order,omitempty"`
+}
+
+// Reorder rebuilds the cart of a past order against the current menu.
+// Unavailable and re-priced items are reported back. With Checkout set, the
+// rebuilt cart goes through InitiateOrder exactly like a regular cart, so
+// pricing and idempotency rules are the same. Checkout of a cart that lost
+// items returns the preview with ErrPartialReorder unless AllowPartial is set.
+func (u *OrderUsecase) Reorder(ctx context.Context, userID, orderID uuid.UUID, req ReorderRequest) (*ReorderResponse, error) {
+	order, err := u.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != userID {
+		return nil, ErrOrderAccessDenied
+	}
+
+	// Merge duplicate lines so each item/variant/modifiers/bundle/instructions
+	// combination appears once in the new cart
+	type lineKey struct {
+		menuItemID uuid.UUID
+		variant    string
+		modifiers  string
+		bundle     string
+		notes      string
+	}
+	lines := make([]ReorderLine, 0, len(order.Items))
+	lineIndex := make(map[lineKey]int)
+	for _, item := range order.Items {
+		key := lineKey{item.MenuItemID, variantKey(item.VariantID), modifierKey(modifierOptionIDs(item.Modifiers)), bundleKey(componentChoices(item.Components)), item.Notes}
+		if i, ok := lineIndex[key]; ok {
+			lines[i].Quantity += item.Quantity
+			continue
+		}
+		lineIndex[key] = len(lines)
+		lines = append(lines, ReorderLine{
+			MenuItemID:    item.MenuItemID,
+			Name:          item.Name,
+			VariantID:     item.VariantID,
+			VariantName:   item.VariantName,
+			Modifiers:     item.Modifiers,
+			Components:    item.Components,
+			Quantity:      item.Quantity,
+			Notes:         item.Notes,
+			PreviousPrice: item.Price,
+		})
+	}
+
+	menuItemIDs := make([]uuid.UUID, 0, len(lines))
+	for _, line := range lines {
+		menuItemIDs = append(menuItemIDs, line.MenuItemID)
+	}
+
+	// GetByIDs only returns available items, anything missing is unavailable
+	menuItems, err := u.menuRepo.GetByIDs(ctx, menuItemIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch menu items: %w", err)
+	}
+
+	current := make(map[uuid.UUID]domain.MenuItem, len(menuItems))
+	for _, menuItem := range menuItems {
+		current[menuItem.ID] = menuItem
+	}
+
+	resp := &ReorderResponse{
+		SourceOrderID:    order.ID,
+		Notes:            order.Notes,
+		Items:            []domain.CartItem{},
+		UnavailableItems: []ReorderLine{},
+		RepricedItems:    []ReorderLine{},
+		PreviousTotal:    order.TotalAmount,
+	}
+
+	for i := range lines {
+		line := &lines[i]
+		item := domain.CartItem{
+			MenuItemID:    line.MenuItemID,
+			VariantID:     line.VariantID,
+			ModifierIDs:   sortedModifierIDs(modifierOptionIDs(line.Modifiers)),
+			BundleChoices: componentChoices(line.Components),
+			Quantity:      line.Quantity,
+			Notes:         line.Notes,
+		}
+
+		// A variant, modifier or bundle option that was removed, or an item
+		// that gained or lost variants, required modifiers or bundle slots
+		// since, cannot be ordered the same way again
+		menuItem, ok := current[line.MenuItemID]
+		if !ok {
+			resp.UnavailableItems = append(resp.UnavailableItems, *line)
+			continue
+		}
+		priced, err := priceLine(&menuItem, item)
+		if err != nil {
+			resp.UnavailableItems = append(resp.UnavailableItems, *line)
+			continue
+		}
+
+		line.Available = true
+		line.Name = menuItem.Name
+		line.VariantName = priced.VariantName
+		line.Modifiers = priced.Modifiers
+		line.Components = priced.Components
+		line.CurrentPrice = priced.Price
+		line.PriceChanged = priced.Price != line.PreviousPrice
+		if line.PriceChanged {
+			resp.RepricedItems = append(resp.RepricedItems, *line)
+		}
+
+		resp.CurrentTotal += priced.Subtotal()
+		resp.Items = append(resp.Items, item)
+	}
+	resp.Lines = lines
+
+	if len(resp.Items) == 0 {
+		return resp, ErrNothingToReorder
+	}
+
+	if !req.Checkout {
+		return resp, nil
+	}
+	// Checkout blocked until the user accepts a partial cart
+	if len(resp.UnavailableItems) > 0 && !req.AllowPartial {
+		return resp, ErrPartialReorder
+	}
+
+	fulfillment, address := order.FulfillmentType, order.DeliveryAddress
+	if req.FulfillmentType != "" {
+		fulfillment, address = req.FulfillmentType, req.DeliveryAddress
+	} else if fulfillment == domain.FulfillmentDineIn {
+		// Dine-in rounds can only be placed from the table
+		fulfillment = domain.FulfillmentDelivery
+	}
+
+	orderResp, err := u.paymentUsecase.InitiateOrder(ctx, InitiateOrderRequest{
+		UserID:          userID,
+		Items:           resp.Items,
+		Notes:           order.Notes,
+		FulfillmentType: fulfillment,
+		DeliveryAddress: address,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Order = orderResp
+
+	u.log.Info("Order placed from past order",
+		"source_order_id", order.ID.String(),
+		"order_id", orderResp.ID.String(),
+		"unavailable", len(resp.UnavailableItems),
+		"repriced", len(resp.RepricedItems),
+	)
+
+	return resp, nil
 }
 
 // UpdateOrderStatus updates order status (admin only)
-// Valid transitions: PAID -> ACCEPTED -> DELIVERED
+// Valid transitions: PAID -> ACCEPTED -> (OUT_FOR_DELIVERY ->) DELIVERED, or for pickup orders
+// PAID -> ACCEPTED -> READY_FOR_PICKUP -> COLLECTED, or for dine-in rounds
+// ON_TAB -> ACCEPTED -> DELIVERED (served)
 func (u *OrderUsecase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, newStatus domain.OrderStatus) error {
 	order, err := u.orderRepo.GetByID(ctx, orderID)
 	if err != nil {
@@ -71,7 +437,7 @@ func (u *OrderUsecase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID,
 	}
 
 	// Validate state transition
-	if !isValidStatusTransition(order.Status, newStatus) {
+	if !isValidStatusTransition(order.FulfillmentType, order.Status, newStatus) {
 		return fmt.Errorf("invalid status transition from %s to %s", order.Status, newStatus)
 	}
 
@@ -88,8 +454,10 @@ func (u *OrderUsecase) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID,
 	return nil
 }
 
-// isValidStatusTransition checks if status transition is allowed
-func isValidStatusTransition(current, next domain.OrderStatus) bool {
+// isValidStatusTransition checks if status transition is allowed.
+// Once accepted, pickup orders follow their own path instead of delivery.
+// Dine-in rounds reach the kitchen unpaid, straight from ON_TAB.
+func isValidStatusTransition(fulfillment domain.FulfillmentType, current, next domain.OrderStatus) bool {
 	validTransitions := map[domain.OrderStatus][]domain.OrderStatus{
 		domain.OrderStatusPending:         {domain.OrderStatusAwaitingPayment, domain.OrderStatusPaymentFailed},
 		domain.OrderStatusAwaitingPayment: {domain.OrderStatusPaid, domain.OrderStatusPaymentFailed},
@@ -97,6 +465,18 @@ func isValidStatusTransition(current, next domain.OrderStatus) bool {
 		domain.OrderStatusPaid:            {domain.OrderStatusAccepted},
 		domain.OrderStatusAccepted:        {domain.OrderStatusDelivered},
 	}
+	if fulfillment == domain.FulfillmentDelivery {
+		// Marking the rider's departure is optional
+		validTransitions[domain.OrderStatusAccepted] = []domain.OrderStatus{domain.OrderStatusOutForDelivery, domain.OrderStatusDelivered}
+		validTransitions[domain.OrderStatusOutForDelivery] = []domain.OrderStatus{domain.OrderStatusDelivered}
+	}
+	if fulfillment == domain.FulfillmentPickup {
+		validTransitions[domain.OrderStatusAccepted] = []domain.OrderStatus{domain.OrderStatusReadyForPickup}
+		validTransitions[domain.OrderStatusReadyForPickup] = []domain.OrderStatus{domain.OrderStatusCollected}
+	}
+	if fulfillment == domain.FulfillmentDineIn {
+		validTransitions[domain.OrderStatusOnTab] = []domain.OrderStatus{domain.OrderStatusAccepted}
+	}
 
 	allowedNext, ok := validTransitions[current]
 	if !ok {
@@ -110,3 +490,39 @@ func isValidStatusTransition(current, next domain.OrderStatus) bool {
 	}
 	return false
 }
+
+// GetOrderByPickupCode finds the active pickup order for a code quoted at the counter
+func (u *OrderUsecase) GetOrderByPickupCode(ctx context.Context, code string) (*domain.Order, error) {
+	return u.orderRepo.GetByPickupCode(ctx, normalizePickupCode(code))
+}
+
+// CollectPickup marks the pickup order with the given code as collected.
+// Only orders the kitchen has marked READY_FOR_PICKUP can be handed over.
+func (u *OrderUsecase) CollectPickup(ctx context.Context, code string) (*domain.Order, error) {
+	order, err := u.orderRepo.GetByPickupCode(ctx, normalizePickupCode(code))
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != domain.OrderStatusReadyForPickup {
+		return order, ErrNotReadyToCollect
+	}
+
+	if err := u.orderRepo.UpdateStatus(ctx, order.ID, domain.OrderStatusCollected, order.Version); err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	u.log.Info("Pickup order collected",
+		"order_id", order.ID.String(),
+		"pickup_code", order.PickupCode,
+	)
+
+	order.Status = domain.OrderStatusCollected
+	order.Version++
+	return order, nil
+}
+
+// normalizePickupCode makes counter lookups forgiving of case and spacing
+func normalizePickupCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
@@ -0,0 +1,209 @@
+// Package usecase implements the relay of domain events from the outbox
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+	"fooddelivery/pkg/redis"
+)
+
+// EventHandler handles one domain event for an in-process subscriber.
+// Returning an error stops delivery to that subscriber; the event is retried
+// on the next poll, so handlers must be idempotent. After
+// OUTBOX_MAX_ATTEMPTS failures the event is parked as a dead letter and the
+// subscriber moves on.
+type EventHandler func(ctx context.Context, event domain.OutboxEvent) error
+
+// Outbox consumers are named in outbox_offsets; the names must stay stable
+// across deployments or the consumer starts over from the newest events
+const (
+	streamConsumer   = "redis-stream"
+	subscriberPrefix = "subscriber:"
+)
+
+// outboxPruneInterval is how often events past the retention are deleted
+const outboxPruneInterval = time.Hour
+
+// eventSubscriber is an in-process consumer of domain events
+type eventSubscriber struct {
+	name    string
+	types   map[domain.EventType]bool // nil receives every event
+	handler EventHandler
+}
+
+// OutboxUsecase relays domain events written to the outbox with the order and
+// refund changes they describe. Every consumer - the Redis stream and each
+// in-process subscriber - has its own offset and gets every event at least
+// once, in commit order.
+type OutboxUsecase struct {
+	outboxRepo  *repository.OutboxRepository
+	redisClient *redis.Client
+	config      config.OutboxConfig
+	subscribers []eventSubscriber
+	log         *logger.Logger
+}
+
+// NewOutboxUsecase creates a new outbox relay
+func NewOutboxUsecase(
+	outboxRepo *repository.OutboxRepository,
+	redisClient *redis.Client,
+	cfg config.OutboxConfig,
+	log *logger.Logger,
+) *OutboxUsecase {
+	return &OutboxUsecase{
+		outboxRepo:  outboxRepo,
+		redisClient: redisClient,
+		config:      cfg,
+		log:         log,
+	}
+}
+
+// Subscribe registers an in-process subscriber for the given event types, or
+// for every event if none are given. Must be called before RunRelay. A new
+// subscriber starts with the events committed after it first runs.
+func (u *OutboxUsecase) Subscribe(name string, handler EventHandler, types ...domain.EventType) {
+	sub := eventSubscriber{name: name, handler: handler}
+	if len(types) > 0 {
+		sub.types = make(map[domain.EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	u.subscribers = append(u.subscribers, sub)
+}
+
+// RunRelay delivers new events every poll interval and prunes old ones until
+// ctx is cancelled. Running it on several instances is safe: each consumer is
+// delivered to by one instance at a time.
+func (u *OutboxUsecase) RunRelay(ctx context.Context) {
+	ticker := time.NewTicker(u.config.PollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		u.Relay(ctx)
+
+		if time.Since(lastPrune) >= outboxPruneInterval {
+			lastPrune = time.Now()
+			if _, err := u.outboxRepo.Prune(ctx, lastPrune.Add(-u.config.Retention)); err != nil {
+				u.log.Error("Failed to prune outbox", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay delivers the pending events to every consumer until each has caught
+// up or fails
+func (u *OutboxUsecase) Relay(ctx context.Context) {
+	// Publishing only fails while Redis is unreachable, so the stream is
+	// retried until it is back instead of parking events
+	if u.config.StreamMaxLen > 0 {
+		u.drain(ctx, streamConsumer, 0, u.publishToStream)
+	}
+
+	for _, sub := range u.subscribers {
+		u.drain(ctx, subscriberPrefix+sub.name, u.config.MaxAttempts, u.deliverTo(sub))
+	}
+}
+
+// drain consumes batches for one consumer until it has caught up, another
+// instance holds it, or an event fails. An event that failed maxAttempts
+// times is parked and draining goes on after it.
+func (u *OutboxUsecase) drain(ctx context.Context, consumer string, maxAttempts int, deliver func(ctx context.Context, events []domain.OutboxEvent) (int, error)) {
+	for ctx.Err() == nil {
+		result, err := u.outboxRepo.Consume(ctx, consumer, u.config.BatchSize, maxAttempts, func(events []domain.OutboxEvent) (int, error) {
+			return deliver(ctx, events)
+		})
+		if errors.Is(err, repository.ErrConsumerBusy) {
+			return
+		}
+		if err != nil {
+			u.log.Error("Failed to relay outbox events", "consumer", consumer, "error", err)
+			return
+		}
+		if result.Parked != nil {
+			u.log.Error("Giving up on outbox event, moved to dead letters",
+				"consumer", consumer,
+				"event_id", result.Parked.ID,
+				"event_type", string(result.Parked.Type),
+				"attempts", result.Failures,
+			)
+			continue
+		}
+		if result.Fetched < u.config.BatchSize || result.Handled < result.Fetched {
+			return
+		}
+	}
+}
+
+// deliverTo hands events to a subscriber in order, stopping at the first
+// failure. Events of other types count as handled.
+func (u *OutboxUsecase) deliverTo(sub eventSubscriber) func(ctx context.Context, events []domain.OutboxEvent) (int, error) {
+	return func(ctx context.Context, events []domain.OutboxEvent) (int, error) {
+		for i, event := range events {
+			if sub.types != nil && !sub.types[event.Type] {
+				continue
+			}
+			if err := handleEvent(ctx, sub.handler, event); err != nil {
+				u.log.WithFields(map[string]interface{}{
+					"subscriber": sub.name,
+					"event_id":   event.ID,
+					"event_type": string(event.Type),
+				}).Warn("Event handler failed, will retry", "error", err)
+				return i, err
+			}
+		}
+		return len(events), nil
+	}
+}
+
+// handleEvent runs a handler, turning a panic into an error so one bad event
+// cannot take the relay down
+func handleEvent(ctx context.Context, handler EventHandler, event domain.OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+// publishToStream appends events to the Redis stream. Stream readers use
+// consumer groups for their own offsets and deduplicate on event_id, since an
+// event is published again if the relay stops before saving its offset.
+func (u *OutboxUsecase) publishToStream(ctx context.Context, events []domain.OutboxEvent) (int, error) {
+	for i, event := range events {
+		err := u.redisClient.XAdd(ctx, &goredis.XAddArgs{
+			Stream: redis.EventStreamKey,
+			MaxLen: u.config.StreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"event_id":     event.ID,
+				"type":         string(event.Type),
+				"aggregate_id": event.AggregateID.String(),
+				"payload":      string(event.Payload),
+				"created_at":   event.CreatedAt.Format(time.RFC3339Nano),
+			},
+		}).Err()
+		if err != nil {
+			u.log.Warn("Failed to publish event to stream, will retry", "event_id", event.ID, "error", err)
+			return i, err
+		}
+	}
+	return len(events), nil
+}
@@ -5,6 +5,7 @@ package usecase
 import (
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -12,6 +13,8 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	razorpay "github.com/razorpay/razorpay-go"
@@ -31,18 +34,52 @@ var (
 	ErrInvalidSignature   = errors.New("invalid webhook signature")
 	ErrOrderAlreadyPaid   = errors.New("order has already been paid")
 	ErrDuplicateRequest   = errors.New("duplicate request detected")
+	ErrNotesTooLong       = errors.New("special instructions are too long")
+	ErrInvalidFulfillment = errors.New("invalid fulfillment type")
+	ErrAddressTooLong     = errors.New("delivery address is too long")
+	ErrInvalidSelection   = errors.New("invalid item selection")
+	ErrPaymentMismatch    = errors.New("payment does not belong to this order")
+	ErrSoldOutRefunded    = errors.New("items sold out before the payment arrived, the payment is refunded")
+)
+
+// pickupCodeAlphabet leaves out characters that are easily confused
+// when read out at the counter (0/O, 1/I/L)
+const (
+	pickupCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	pickupCodeLength   = 6
 )
 
 // PaymentUsecase handles all payment-related business logic
 type PaymentUsecase struct {
 	orderRepo   *repository.OrderRepository
 	menuRepo    *repository.MenuRepository
+	refundRepo  *repository.RefundRepository
 	razorpay    *razorpay.Client
 	redisClient *redis.Client
 	config      config.RazorpayConfig
+	orderConfig config.OrderConfig
+	targets     []PaymentTarget
 	log         *logger.Logger
 }
 
+// GatewayPayment is a payment reported by a Razorpay webhook
+type GatewayPayment struct {
+	ID              string
+	RazorpayOrderID string
+	Amount          int64 // Paisa
+	ErrorCode       string
+	ErrorDesc       string
+}
+
+// PaymentTarget settles gateway payments for things that are not orders
+// (e.g. table tabs). Webhooks whose Razorpay order does not belong to an order
+// are offered to each registered target in turn; a target returns
+// handled=false when the Razorpay order is not one of its own.
+type PaymentTarget interface {
+	OnPaymentCaptured(ctx context.Context, payment GatewayPayment) (handled bool, err error)
+	OnPaymentFailed(ctx context.Context, payment GatewayPayment) (handled bool, err error)
+}
+
 // NewPaymentUsecase creates a new payment usecase
 func NewPaymentUsecase(
 	orderRepo *repository.OrderRepository,
@@ -67,10 +104,83 @@ func (u *PaymentUsecase) SetRedisClient(client *redis.Client) {
 	u.redisClient = client
 }
 
+// SetOrderConfig sets order pricing settings such as the delivery fee
+func (u *PaymentUsecase) SetOrderConfig(cfg config.OrderConfig) {
+	u.orderConfig = cfg
+}
+
+// SetRefundRepository sets the refund repository (for refusing payments
+// that arrive after an order's stock sold out)
+func (u *PaymentUsecase) SetRefundRepository(refundRepo *repository.RefundRepository) {
+	u.refundRepo = refundRepo
+}
+
+// RegisterPaymentTarget adds a target for webhooks that do not match an order
+func (u *PaymentUsecase) RegisterPaymentTarget(target PaymentTarget) {
+	u.targets = append(u.targets, target)
+}
+
+// KeyID returns the public Razorpay key the client needs for checkout
+func (u *PaymentUsecase) KeyID() string {
+	return u.config.KeyID
+}
+
+// CreateGatewayOrder creates an auto-captured INR Razorpay order and returns its ID
+func (u *PaymentUsecase) CreateGatewayOrder(amount int64, receipt string, notes map[string]interface{}) (string, error) {
+	razorpayData := map[string]interface{}{
+		"amount":          amount, // Already in paisa
+		"currency":        "INR",
+		"receipt":         receipt,
+		"payment_capture": 1, // Auto-capture payment
+		"notes":           notes,
+	}
+
+	razorpayOrder, err := u.razorpay.Order.Create(razorpayData, nil)
+	if err != nil {
+		return "", err
+	}
+
+	razorpayOrderID, ok := razorpayOrder["id"].(string)
+	if !ok || razorpayOrderID == "" {
+		return "", errors.New("razorpay order response has no id")
+	}
+
+	return razorpayOrderID, nil
+}
+
+// VerifySignature checks the checkout signature returned to the client
+// Signature = HMAC_SHA256(razorpay_order_id + "|" + razorpay_payment_id, key_secret)
+func (u *PaymentUsecase) VerifySignature(razorpayOrderID, paymentID, signature string) bool {
+	expectedSignature := u.generateHMAC(razorpayOrderID+"|"+paymentID, u.config.KeySecret)
+	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+}
+
+// RefundPayment refunds part or all of a captured payment and returns the Razorpay refund ID
+func (u *PaymentUsecase) RefundPayment(paymentID string, amount int64, notes map[string]interface{}) (string, error) {
+	data := map[string]interface{}{
+		"notes": notes,
+	}
+
+	refund, err := u.razorpay.Payment.Refund(paymentID, int(amount), data, nil)
+	if err != nil {
+		return "", err
+	}
+
+	refundID, ok := refund["id"].(string)
+	if !ok || refundID == "" {
+		return "", errors.New("razorpay refund response has no id")
+	}
+
+	return refundID, nil
+}
+
 // InitiateOrderRequest contains the data needed to create an order
 type InitiateOrderRequest struct {
-	UserID uuid.UUID            `json:"user_id"`
-	Items  []domain.CartItem    `json:"items"`
+	UserID          uuid.UUID              `json:"user_id"`
+	Items           []domain.CartItem      `json:"items"`
+	Notes           string                 `json:"notes"`            // Order-level special instructions
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"` // Defaults to delivery
+	DeliveryAddress string                 `json:"delivery_address"` // Delivery only
 }
 
 // InitiateOrderResponse contains the Razorpay order details for client
@@ -83,6 +193,10 @@ type InitiateOrderResponse struct {
 	Receipt         string    `json:"receipt"`
 	Name            string    `json:"name"`
 	Description     string    `json:"description"`
+
+	FulfillmentType domain.FulfillmentType `json:"fulfillment_type"`
+	DeliveryFee     int64                  `json:"delivery_fee"`          // Included in Amount
+	PickupCode      string                 `json:"pickup_code,omitempty"` // Quote at the counter
 }
 
 // InitiateOrder creates a new order and Razorpay payment order.
@@ -92,20 +206,21 @@ func (u *PaymentUsecase) InitiateOrder(ctx context.Context, req InitiateOrderReq
 		"user_id": req.UserID.String(),
 	})
 
-	// Validate cart
-	if len(req.Items) == 0 {
-		return nil, ErrInvalidCart
+	// Validate cart and normalise special instructions before hashing,
+	// so cosmetic differences (extra spaces) do not produce a new order
+	items, notes, err := validateCart(req.Items, req.Notes)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, item := range req.Items {
-		if item.Quantity <= 0 {
-			return nil, ErrInvalidCart
-		}
+	fulfillment, address, err := validateFulfillment(req.FulfillmentType, req.DeliveryAddress)
+	if err != nil {
+		return nil, err
 	}
 
 	// Generate cart hash for idempotency check
-	// Same cart contents within 1 minute = same order
-	cartHash := u.generateCartHash(req.UserID, req.Items)
+	// Same cart contents (including notes and fulfillment) within 1 minute = same order
+	cartHash := u.generateCartHash(req.UserID, items, notes, fulfillment, address)
 	idempotencyKey := redis.IdempotencyPrefix + cartHash
 
 	// Check for existing order with same cart (idempotency)
@@ -121,55 +236,36 @@ func (u *PaymentUsecase) InitiateOrder(ctx context.Context, req InitiateOrderReq
 		}
 	}
 
-	// Extract menu item IDs
-	menuItemIDs := make([]uuid.UUID, len(req.Items))
-	quantityMap := make(map[uuid.UUID]int)
-	for i, item := range req.Items {
-		menuItemIDs[i] = item.MenuItemID
-		quantityMap[item.MenuItemID] = item.Quantity
-	}
-
-	// Fetch menu items from database (NEVER trust client prices)
-	menuItems, err := u.menuRepo.GetByIDs(ctx, menuItemIDs)
+	// Calculate total server-side (critical for security)
+	orderItems, totalAmount, err := u.priceCart(ctx, items)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch menu items: %w", err)
+		return nil, err
 	}
 
-	// Validate all items exist and are available
-	if len(menuItems) != len(req.Items) {
-		return nil, ErrItemNotAvailable
+	// Create order in database with PENDING status
+	order := &domain.Order{
+		UserID:          req.UserID,
+		Status:          domain.OrderStatusPending,
+		FulfillmentType: fulfillment,
+		DeliveryAddress: address,
+		Notes:           notes,
+		Items:           orderItems,
 	}
 
-	// Calculate total server-side (critical for security)
-	var totalAmount int64
-	orderItems := make([]domain.OrderItem, 0, len(menuItems))
-
-	for _, menuItem := range menuItems {
-		if !menuItem.IsAvailable {
-			return nil, ErrItemNotAvailable
+	order.DeliveryFee = u.deliveryFee(fulfillment)
+	if fulfillment == domain.FulfillmentPickup {
+		order.PickupCode, err = generatePickupCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate pickup code: %w", err)
 		}
-
-		quantity := quantityMap[menuItem.ID]
-		itemTotal := menuItem.Price * int64(quantity)
-		totalAmount += itemTotal
-
-		orderItems = append(orderItems, domain.OrderItem{
-			MenuItemID: menuItem.ID,
-			Name:       menuItem.Name,
-			Price:      menuItem.Price,
-			Quantity:   quantity,
-		})
-	}
-
-	// Create order in database with PENDING status
-	order := &domain.Order{
-		UserID:      req.UserID,
-		Status:      domain.OrderStatusPending,
-		TotalAmount: totalAmount,
-		Items:       orderItems,
 	}
+	totalAmount += order.DeliveryFee
+	order.TotalAmount = totalAmount
 
 	if err := u.orderRepo.Create(ctx, order); err != nil {
+		if errors.Is(err, repository.ErrOutOfStock) {
+			return nil, ErrItemNotAvailable
+		}
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
@@ -179,18 +275,10 @@ func (u *PaymentUsecase) InitiateOrder(ctx context.Context, req InitiateOrderReq
 	})
 
 	// Create Razorpay order
-	razorpayData := map[string]interface{}{
-		"amount":          totalAmount, // Already in paisa
-		"currency":        "INR",
-		"receipt":         order.ID.String(),
-		"payment_capture": 1, // Auto-capture payment
-		"notes": map[string]interface{}{
-			"order_id": order.ID.String(),
-			"user_id":  req.UserID.String(),
-		},
-	}
-
-	razorpayOrder, err := u.razorpay.Order.Create(razorpayData, nil)
+	razorpayOrderID, err := u.CreateGatewayOrder(totalAmount, order.ID.String(), map[string]interface{}{
+		"order_id": order.ID.String(),
+		"user_id":  req.UserID.String(),
+	})
 	if err != nil {
 		log.Error("Failed to create Razorpay order", "error", err)
 		// Mark order as failed
@@ -198,8 +286,6 @@ func (u *PaymentUsecase) InitiateOrder(ctx context.Context, req InitiateOrderReq
 		return nil, fmt.Errorf("failed to create payment order: %w", err)
 	}
 
-	razorpayOrderID := razorpayOrder["id"].(string)
-
 	// Update order with Razorpay order ID
 	if err := u.orderRepo.SetRazorpayOrderID(ctx, order.ID, razorpayOrderID, order.Version); err != nil {
 		log.Error("Failed to update order with Razorpay ID", "error", err)
@@ -217,6 +303,9 @@ func (u *PaymentUsecase) InitiateOrder(ctx context.Context, req InitiateOrderReq
 		Receipt:         order.ID.String(),
 		Name:            "Food Delivery",
 		Description:     fmt.Sprintf("Order #%s", order.ID.String()[:8]),
+		FulfillmentType: fulfillment,
+		DeliveryFee:     order.DeliveryFee,
+		PickupCode:      order.PickupCode,
 	}
 
 	// Cache response for idempotency (1 minute TTL)
@@ -230,6 +319,389 @@ func (u *PaymentUsecase) InitiateOrder(ctx context.Context, req InitiateOrderReq
 	return response, nil
 }
 
+// deliveryFee is the fee charged on top of the items for a fulfillment type
+func (u *PaymentUsecase) deliveryFee(fulfillment domain.FulfillmentType) int64 {
+	if fulfillment == domain.FulfillmentDelivery {
+		return u.orderConfig.DeliveryFee
+	}
+	return 0
+}
+
+// QuoteCart prices cart lines at current menu prices without creating an
+// order. Unlike checkout it does not fail on unavailable items or variants:
+// they are flagged and left out of the total.
+func (u *PaymentUsecase) QuoteCart(ctx context.Context, lines []domain.CartLine, fulfillment domain.FulfillmentType) (*domain.Quote, error) {
+	fulfillment, _, err := validateFulfillment(fulfillment, "")
+	if err != nil {
+		return nil, err
+	}
+
+	menuItemIDs := make([]uuid.UUID, 0, len(lines))
+	for _, line := range lines {
+		menuItemIDs = append(menuItemIDs, line.MenuItemID)
+	}
+
+	// Only returns items that are currently available
+	menuItems, err := u.menuRepo.GetByIDs(ctx, menuItemIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch menu items: %w", err)
+	}
+
+	menuByID := make(map[uuid.UUID]domain.MenuItem, len(menuItems))
+	for _, menuItem := range menuItems {
+		menuByID[menuItem.ID] = menuItem
+	}
+
+	quote := &domain.Quote{
+		FulfillmentType: fulfillment,
+		Lines:           make([]domain.QuoteLine, 0, len(lines)),
+		TaxRate:         u.orderConfig.TaxRate,
+		Available:       len(lines) > 0,
+	}
+
+	for _, line := range lines {
+		quoteLine := domain.QuoteLine{
+			ID:         line.ID,
+			MenuItemID: line.MenuItemID,
+			Name:       line.Name,
+			Quantity:   line.Quantity,
+			Notes:      line.Notes,
+		}
+
+		if menuItem, ok := menuByID[line.MenuItemID]; ok {
+			quoteLine.Name = menuItem.Name
+			if priced, err := priceLine(&menuItem, line.CartItem); err == nil {
+				quoteLine.VariantID = priced.VariantID
+				quoteLine.VariantName = priced.VariantName
+				quoteLine.Modifiers = priced.Modifiers
+				quoteLine.Components = priced.Components
+				quoteLine.Price = priced.Price
+				quoteLine.Subtotal = priced.Subtotal()
+				quoteLine.Available = true
+				quote.Subtotal += quoteLine.Subtotal
+			}
+		}
+		if !quoteLine.Available {
+			quote.Available = false
+		}
+
+		quote.Lines = append(quote.Lines, quoteLine)
+	}
+
+	if quote.Subtotal > 0 {
+		quote.DeliveryFee = u.deliveryFee(fulfillment)
+	}
+	quote.Total = quote.Subtotal + quote.DeliveryFee
+
+	// Prices include GST: tax = total * rate / (100% + rate), rounded to the nearest paisa
+	quote.TaxIncluded = includedTax(quote.Total, quote.TaxRate)
+
+	return quote, nil
+}
+
+// validateCart checks quantities and sanitises order and line notes.
+// Returns a copy of the items so the caller's slice is left untouched.
+func validateCart(items []domain.CartItem, orderNotes string) ([]domain.CartItem, string, error) {
+	if len(items) == 0 {
+		return nil, "", ErrInvalidCart
+	}
+
+	notes, err := sanitizeNotes(orderNotes, domain.MaxOrderNotesLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	validated := make([]domain.CartItem, len(items))
+	for i, item := range items {
+		if item.Quantity <= 0 || item.MenuItemID == uuid.Nil {
+			return nil, "", ErrInvalidCart
+		}
+		if item.VariantID != nil && *item.VariantID == uuid.Nil {
+			item.VariantID = nil
+		}
+		if len(item.ModifierIDs) > domain.MaxModifiersPerLine {
+			return nil, "", ErrInvalidCart
+		}
+		item.ModifierIDs = sortedModifierIDs(item.ModifierIDs)
+		if len(item.BundleChoices) > domain.MaxBundleSlots {
+			return nil, "", ErrInvalidCart
+		}
+		if len(item.BundleChoices) == 0 {
+			item.BundleChoices = nil
+		}
+
+		item.Notes, err = sanitizeNotes(item.Notes, domain.MaxItemNotesLength)
+		if err != nil {
+			return nil, "", err
+		}
+		validated[i] = item
+	}
+
+	return validated, notes, nil
+}
+
+// validateFulfillment defaults to delivery and sanitises the delivery address.
+// The address stays optional so older clients can keep ordering without one.
+// Dine-in orders are placed through table sessions, never directly.
+// Pickup orders carry no address.
+func validateFulfillment(fulfillment domain.FulfillmentType, rawAddress string) (domain.FulfillmentType, string, error) {
+	if fulfillment == "" {
+		fulfillment = domain.FulfillmentDelivery
+	}
+
+	switch fulfillment {
+	case domain.FulfillmentPickup:
+		return fulfillment, "", nil
+	case domain.FulfillmentDelivery:
+		address, err := sanitizeNotes(rawAddress, domain.MaxDeliveryAddressLength)
+		if err != nil {
+			return "", "", ErrAddressTooLong
+		}
+		return fulfillment, address, nil
+	default:
+		return "", "", ErrInvalidFulfillment
+	}
+}
+
+// generatePickupCode returns a random code the customer quotes at the counter
+func generatePickupCode() (string, error) {
+	return randomCode(pickupCodeLength)
+}
+
+// randomCode returns n random characters that are easy to read out and type
+func randomCode(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, n)
+	for i, b := range buf {
+		code[i] = pickupCodeAlphabet[int(b)%len(pickupCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// priceCart turns validated cart lines into order items using current menu prices.
+// Prices always come from the database, never from the client.
+func (u *PaymentUsecase) priceCart(ctx context.Context, items []domain.CartItem) ([]domain.OrderItem, int64, error) {
+	// The same menu item may appear on several lines (with different notes)
+	menuItemIDs := make([]uuid.UUID, 0, len(items))
+	seen := make(map[uuid.UUID]struct{}, len(items))
+	for _, item := range items {
+		if _, ok := seen[item.MenuItemID]; ok {
+			continue
+		}
+		seen[item.MenuItemID] = struct{}{}
+		menuItemIDs = append(menuItemIDs, item.MenuItemID)
+	}
+
+	// Fetch menu items from database (NEVER trust client prices)
+	menuItems, err := u.menuRepo.GetByIDs(ctx, menuItemIDs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch menu items: %w", err)
+	}
+
+	// Validate all items exist and are available
+	if len(menuItems) != len(menuItemIDs) {
+		return nil, 0, ErrItemNotAvailable
+	}
+
+	menuByID := make(map[uuid.UUID]domain.MenuItem, len(menuItems))
+	for _, menuItem := range menuItems {
+		if !menuItem.IsAvailable {
+			return nil, 0, ErrItemNotAvailable
+		}
+		menuByID[menuItem.ID] = menuItem
+	}
+
+	var totalAmount int64
+	orderItems := make([]domain.OrderItem, 0, len(items))
+
+	for _, item := range items {
+		menuItem := menuByID[item.MenuItemID]
+		orderItem, err := priceLine(&menuItem, item)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		totalAmount += orderItem.Subtotal()
+		orderItems = append(orderItems, orderItem)
+	}
+
+	return orderItems, totalAmount, nil
+}
+
+// priceLine prices one cart line of a menu item, at the chosen variant's
+// price if the item has variants. An item with variants needs one of them
+// chosen; an item without variants takes none.
+func priceLine(menuItem *domain.MenuItem, item domain.CartItem) (domain.OrderItem, error) {
+	orderItem := domain.OrderItem{
+		MenuItemID: menuItem.ID,
+		Name:       menuItem.Name,
+		Price:      menuItem.Price,
+		Quantity:   item.Quantity,
+		Notes:      item.Notes,
+		AddedBy:    item.AddedBy,
+	}
+
+	switch {
+	case item.VariantID == nil && len(menuItem.Variants) > 0:
+		return orderItem, fmt.Errorf("%w: choose a variant of %s", ErrInvalidSelection, menuItem.Name)
+	case item.VariantID != nil:
+		variant := menuItem.Variant(*item.VariantID)
+		if variant == nil {
+			return orderItem, fmt.Errorf("%w: %s has no variant %s", ErrInvalidSelection, menuItem.Name, item.VariantID)
+		}
+		if !variant.IsAvailable {
+			return orderItem, ErrItemNotAvailable
+		}
+
+		orderItem.VariantID = &variant.ID
+		orderItem.VariantName = variant.Name
+		orderItem.Price = variant.Price
+	}
+
+	if err := applyModifiers(menuItem, item.ModifierIDs, &orderItem); err != nil {
+		return orderItem, err
+	}
+
+	if err := applyBundleChoices(menuItem, item.BundleChoices, &orderItem); err != nil {
+		return orderItem, err
+	}
+
+	return orderItem, nil
+}
+
+// applyBundleChoices fills every slot of a bundle with the chosen option, or
+// the only one of a fixed slot, and adds them to the order item as its
+// components. The bundle is sold at its own price, whatever its components
+// cost on their own.
+func applyBundleChoices(menuItem *domain.MenuItem, choices map[uuid.UUID]uuid.UUID, orderItem *domain.OrderItem) error {
+	if !menuItem.IsBundle() {
+		if len(choices) > 0 {
+			return fmt.Errorf("%w: %s is not a bundle", ErrInvalidSelection, menuItem.Name)
+		}
+		return nil
+	}
+
+	chosen := len(choices)
+	for i := range menuItem.BundleSlots {
+		slot := &menuItem.BundleSlots[i]
+
+		optionID, ok := choices[slot.ID]
+		if ok {
+			chosen--
+		} else if slot.IsFixed() {
+			optionID = slot.Options[0].ID
+		} else {
+			return fmt.Errorf("%w: choose a %s for %s", ErrInvalidSelection, slot.Name, menuItem.Name)
+		}
+
+		option := slot.Option(optionID)
+		if option == nil {
+			return fmt.Errorf("%w: %s of %s has no option %s", ErrInvalidSelection, slot.Name, menuItem.Name, optionID)
+		}
+		if !option.IsAvailable {
+			return ErrItemNotAvailable
+		}
+
+		orderItem.Components = append(orderItem.Components, domain.OrderItemComponent{
+			SlotID:     slot.ID,
+			Slot:       slot.Name,
+			OptionID:   option.ID,
+			MenuItemID: option.MenuItemID,
+			VariantID:  option.VariantID,
+			Name:       option.Name,
+			Quantity:   slot.Quantity,
+		})
+	}
+
+	if chosen > 0 {
+		return fmt.Errorf("%w: %s has no such slot", ErrInvalidSelection, menuItem.Name)
+	}
+
+	return nil
+}
+
+// applyModifiers checks the chosen modifier options against the item's
+// groups and adds them, and their prices, to the order item. Every group
+// must have between its minimum and maximum options chosen.
+func applyModifiers(menuItem *domain.MenuItem, optionIDs []uuid.UUID, orderItem *domain.OrderItem) error {
+	if len(optionIDs) > domain.MaxModifiersPerLine {
+		return fmt.Errorf("%w: at most %d modifiers per item", ErrInvalidSelection, domain.MaxModifiersPerLine)
+	}
+
+	chosen := make(map[uuid.UUID]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		if chosen[id] {
+			return fmt.Errorf("%w: modifier %s chosen twice for %s", ErrInvalidSelection, id, menuItem.Name)
+		}
+		chosen[id] = true
+	}
+
+	for _, group := range menuItem.ModifierGroups {
+		selected := 0
+		for _, option := range group.Options {
+			if !chosen[option.ID] {
+				continue
+			}
+			if !option.IsAvailable {
+				return ErrItemNotAvailable
+			}
+			delete(chosen, option.ID)
+			selected++
+
+			orderItem.Modifiers = append(orderItem.Modifiers, domain.OrderItemModifier{
+				OptionID: option.ID,
+				Group:    group.Name,
+				Name:     option.Name,
+				Price:    option.Price,
+			})
+			orderItem.Price += option.Price
+		}
+
+		if selected < group.MinSelect {
+			return fmt.Errorf("%w: choose at least %d %s for %s", ErrInvalidSelection, group.MinSelect, group.Name, menuItem.Name)
+		}
+		if selected > group.MaxSelect {
+			return fmt.Errorf("%w: choose at most %d %s for %s", ErrInvalidSelection, group.MaxSelect, group.Name, menuItem.Name)
+		}
+	}
+
+	for id := range chosen {
+		return fmt.Errorf("%w: %s has no modifier %s", ErrInvalidSelection, menuItem.Name, id)
+	}
+
+	return nil
+}
+
+// sanitizeNotes normalises free-text special instructions: control characters,
+// invalid UTF-8 and markup brackets are dropped, whitespace is collapsed, and
+// the result must fit in maxLen characters.
+func sanitizeNotes(raw string, maxLen int) (string, error) {
+	var sb strings.Builder
+	for _, r := range raw {
+		switch {
+		case r == utf8.RuneError, r == '<', r == '>':
+			continue
+		case unicode.IsSpace(r):
+			sb.WriteRune(' ')
+		case unicode.IsControl(r):
+			continue
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	notes := strings.Join(strings.Fields(sb.String()), " ")
+	if utf8.RuneCountInString(notes) > maxLen {
+		return "", ErrNotesTooLong
+	}
+
+	return notes, nil
+}
+
 // VerifyPaymentRequest contains the payment verification data from client
 type VerifyPaymentRequest struct {
 	OrderID           uuid.UUID `json:"order_id"`
@@ -266,7 +738,7 @@ func (u *PaymentUsecase) VerifyPayment(ctx context.Context, req VerifyPaymentReq
 	}
 
 	// Check if already paid (idempotent success)
-	if order.Status == domain.OrderStatusPaid || order.Status == domain.OrderStatusAccepted || order.Status == domain.OrderStatusDelivered {
+	if order.Status.IsPaid() {
 		log.Info("Order already paid, returning success")
 		return &VerifyPaymentResponse{
 			Success: true,
@@ -277,11 +749,7 @@ func (u *PaymentUsecase) VerifyPayment(ctx context.Context, req VerifyPaymentReq
 	}
 
 	// Verify Razorpay signature
-	// Signature = HMAC_SHA256(razorpay_order_id + "|" + razorpay_payment_id, key_secret)
-	data := req.RazorpayOrderID + "|" + req.RazorpayPaymentID
-	expectedSignature := u.generateHMAC(data, u.config.KeySecret)
-
-	if !hmac.Equal([]byte(req.RazorpaySignature), []byte(expectedSignature)) {
+	if !u.VerifySignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature) {
 		log.Warn("Invalid payment signature")
 		return &VerifyPaymentResponse{
 			Success: false,
@@ -291,8 +759,21 @@ func (u *PaymentUsecase) VerifyPayment(ctx context.Context, req VerifyPaymentReq
 		}, ErrInvalidSignature
 	}
 
+	// A valid signature only proves the gateway order was paid; it must be
+	// this order's, or a payment for a cheaper one (a bill share, a
+	// modification difference) could mark any order paid
+	if order.RazorpayOrderID == "" || req.RazorpayOrderID != order.RazorpayOrderID {
+		log.Warn("Payment is for another gateway order", "expected_razorpay_order_id", order.RazorpayOrderID)
+		return nil, ErrPaymentMismatch
+	}
+
 	// Update order status to PAID
 	err = u.orderRepo.UpdatePaymentStatus(ctx, order.ID, domain.OrderStatusPaid, req.RazorpayPaymentID, order.Version)
+	if errors.Is(err, repository.ErrOutOfStock) {
+		log.Warn("Order sold out before its payment arrived, refunding")
+		u.refundRefusedPayment(ctx, order.ID)
+		return nil, ErrSoldOutRefunded
+	}
 	if err != nil {
 		if errors.Is(err, repository.ErrVersionConflict) {
 			// Concurrent update - fetch latest status
@@ -320,6 +801,47 @@ func (u *PaymentUsecase) VerifyPayment(ctx context.Context, req VerifyPaymentReq
 	}, nil
 }
 
+// refundRefusedPayment sends the refund of a payment refused because the
+// order sold out. A refund the gateway rejects is retried the next time the
+// payment is reported.
+func (u *PaymentUsecase) refundRefusedPayment(ctx context.Context, orderID uuid.UUID) {
+	log := u.log.WithFields(map[string]interface{}{
+		"order_id": orderID.String(),
+	})
+
+	if u.refundRepo == nil {
+		log.Error("No refund repository set, refused payment is not refunded")
+		return
+	}
+
+	refunds, err := u.refundRepo.GetUnprocessedBySources(ctx, domain.RefundSourceOutOfStock, []uuid.UUID{orderID})
+	if err != nil {
+		log.Error("Failed to load refused payment refund", "error", err)
+		return
+	}
+
+	for _, refund := range refunds {
+		razorpayRefundID, err := u.RefundPayment(refund.RazorpayPaymentID, refund.Amount, map[string]interface{}{
+			"order_id": orderID.String(),
+			"reason":   refund.Reason,
+		})
+		if err != nil {
+			log.Error("Refund failed", "error", err, "refund_id", refund.ID.String())
+			if markErr := u.refundRepo.MarkFailed(ctx, refund.ID, err.Error()); markErr != nil {
+				log.Error("Failed to record refund failure", "error", markErr)
+			}
+			continue
+		}
+
+		if err := u.refundRepo.MarkProcessed(ctx, refund.ID, razorpayRefundID); err != nil {
+			log.Error("Failed to record refund", "error", err, "razorpay_refund_id", razorpayRefundID)
+			continue
+		}
+
+		log.Info("Refused payment refunded", "amount", refund.Amount, "razorpay_refund_id", razorpayRefundID)
+	}
+}
+
 // WebhookPayload represents the Razorpay webhook payload structure
 type WebhookPayload struct {
 	Entity    string          `json:"entity"`
@@ -330,20 +852,23 @@ type WebhookPayload struct {
 	CreatedAt int64           `json:"created_at"`
 }
 
+// paymentEntityData is the payment entity inside a webhook payload
+type paymentEntityData struct {
+	ID        string `json:"id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+	OrderID   string `json:"order_id"`
+	Method    string `json:"method"`
+	Captured  bool   `json:"captured"`
+	ErrorCode string `json:"error_code,omitempty"`
+	ErrorDesc string `json:"error_description,omitempty"`
+}
+
 // PaymentEntity represents the payment data in webhook
 type PaymentEntity struct {
 	Payment struct {
-		Entity struct {
-			ID            string `json:"id"`
-			Amount        int64  `json:"amount"`
-			Currency      string `json:"currency"`
-			Status        string `json:"status"`
-			OrderID       string `json:"order_id"`
-			Method        string `json:"method"`
-			Captured      bool   `json:"captured"`
-			ErrorCode     string `json:"error_code,omitempty"`
-			ErrorDesc     string `json:"error_description,omitempty"`
-		} `json:"entity"`
+		Entity paymentEntityData `json:"entity"`
 	} `json:"payment"`
 }
 
@@ -421,6 +946,9 @@ func (u *PaymentUsecase) handlePaymentCaptured(ctx context.Context, webhookData
 	order, err := u.orderRepo.GetByRazorpayOrderID(ctx, payment.OrderID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
+			if handled, err := u.dispatchToTargets(ctx, webhookData, payload, payment, true, log); handled {
+				return err
+			}
 			log.Warn("Order not found for webhook")
 			_ = u.orderRepo.LogWebhook(ctx, "razorpay", webhookData.Event, payload, true, nil, "order not found")
 			return nil // Don't return error - might be from different system
@@ -436,6 +964,12 @@ func (u *PaymentUsecase) handlePaymentCaptured(ctx context.Context, webhookData
 
 	// Update order status using serializable transaction
 	err = u.orderRepo.UpdatePaymentStatus(ctx, order.ID, domain.OrderStatusPaid, payment.ID, order.Version)
+	if errors.Is(err, repository.ErrOutOfStock) {
+		log.Warn("Order sold out before its payment arrived, refunding")
+		u.refundRefusedPayment(ctx, order.ID)
+		_ = u.orderRepo.LogWebhook(ctx, "razorpay", webhookData.Event, payload, true, &order.ID, "")
+		return nil
+	}
 	if err != nil {
 		if errors.Is(err, repository.ErrVersionConflict) {
 			// Already processed by another request (client verification)
@@ -475,6 +1009,9 @@ func (u *PaymentUsecase) handlePaymentFailed(ctx context.Context, webhookData We
 	order, err := u.orderRepo.GetByRazorpayOrderID(ctx, payment.OrderID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
+			if handled, err := u.dispatchToTargets(ctx, webhookData, payload, payment, false, log); handled {
+				return err
+			}
 			log.Warn("Order not found for failed payment webhook")
 			_ = u.orderRepo.LogWebhook(ctx, "razorpay", webhookData.Event, payload, true, nil, "order not found")
 			return nil
@@ -496,21 +1033,78 @@ func (u *PaymentUsecase) handlePaymentFailed(ctx context.Context, webhookData We
 	return nil
 }
 
+// dispatchToTargets offers a webhook payment that matched no order to the
+// registered payment targets and logs the outcome when one handles it
+func (u *PaymentUsecase) dispatchToTargets(ctx context.Context, webhookData WebhookPayload, payload []byte, entity paymentEntityData, captured bool, log *logger.Logger) (bool, error) {
+	payment := GatewayPayment{
+		ID:              entity.ID,
+		RazorpayOrderID: entity.OrderID,
+		Amount:          entity.Amount,
+		ErrorCode:       entity.ErrorCode,
+		ErrorDesc:       entity.ErrorDesc,
+	}
+
+	for _, target := range u.targets {
+		var handled bool
+		var err error
+		if captured {
+			handled, err = target.OnPaymentCaptured(ctx, payment)
+		} else {
+			handled, err = target.OnPaymentFailed(ctx, payment)
+		}
+		if !handled {
+			continue
+		}
+
+		processingError := ""
+		if err != nil {
+			log.Error("Payment target failed to process webhook", "error", err)
+			processingError = err.Error()
+		}
+		_ = u.orderRepo.LogWebhook(ctx, "razorpay", webhookData.Event, payload, true, nil, processingError)
+		return true, err
+	}
+
+	return false, nil
+}
+
 // generateCartHash creates a deterministic hash for cart contents
-// Used for idempotency detection
-func (u *PaymentUsecase) generateCartHash(userID uuid.UUID, items []domain.CartItem) string {
-	// Sort items by ID for deterministic ordering
+// Used for idempotency detection. Variants, modifiers, bundle choices, notes and fulfillment are part of the hash
+// so the same items with different instructions or a different address are
+// treated as different orders.
+func (u *PaymentUsecase) generateCartHash(userID uuid.UUID, items []domain.CartItem, notes string, fulfillment domain.FulfillmentType, address string) string {
+	// Sort items by ID (then variant, modifiers, bundle choices and notes) for deterministic ordering
 	sortedItems := make([]domain.CartItem, len(items))
 	copy(sortedItems, items)
 	sort.Slice(sortedItems, func(i, j int) bool {
-		return sortedItems[i].MenuItemID.String() < sortedItems[j].MenuItemID.String()
+		if sortedItems[i].MenuItemID != sortedItems[j].MenuItemID {
+			return sortedItems[i].MenuItemID.String() < sortedItems[j].MenuItemID.String()
+		}
+		if vi, vj := variantKey(sortedItems[i].VariantID), variantKey(sortedItems[j].VariantID); vi != vj {
+			return vi < vj
+		}
+		if mi, mj := modifierKey(sortedItems[i].ModifierIDs), modifierKey(sortedItems[j].ModifierIDs); mi != mj {
+			return mi < mj
+		}
+		if bi, bj := bundleKey(sortedItems[i].BundleChoices), bundleKey(sortedItems[j].BundleChoices); bi != bj {
+			return bi < bj
+		}
+		if sortedItems[i].Notes != sortedItems[j].Notes {
+			return sortedItems[i].Notes < sortedItems[j].Notes
+		}
+		return sortedItems[i].Quantity < sortedItems[j].Quantity
 	})
 
-	// Build hash input
+	// Build hash input. Notes are quoted so their content cannot be
+	// confused with the separators.
 	var sb strings.Builder
 	sb.WriteString(userID.String())
+	sb.WriteString(fmt.Sprintf("|%q|%s|%q", notes, fulfillment, address))
 	for _, item := range sortedItems {
-		sb.WriteString(fmt.Sprintf(":%s:%d", item.MenuItemID.String(), item.Quantity))
+		sb.WriteString(fmt.Sprintf(":%s/%s/%s/%s:%d:%q", item.MenuItemID.String(), variantKey(item.VariantID), modifierKey(item.ModifierIDs), bundleKey(item.BundleChoices), item.Quantity, item.Notes))
+		if item.AddedBy != nil {
+			sb.WriteString(":" + item.AddedBy.String())
+		}
 	}
 
 	// Generate SHA256 hash
@@ -518,6 +1112,71 @@ func (u *PaymentUsecase) generateCartHash(userID uuid.UUID, items []domain.CartI
 	return hex.EncodeToString(hash[:])
 }
 
+// variantKey is a comparable form of an optional variant ID, empty for none
+func variantKey(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// modifierKey is a comparable form of a set of modifier option IDs,
+// independent of their order, empty for none
+func modifierKey(ids []uuid.UUID) string {
+	sorted := sortedModifierIDs(ids)
+	keys := make([]string, len(sorted))
+	for i, id := range sorted {
+		keys[i] = id.String()
+	}
+	return strings.Join(keys, ",")
+}
+
+// bundleKey is a comparable form of the slot choices of a bundle line,
+// empty for none
+func bundleKey(choices map[uuid.UUID]uuid.UUID) string {
+	keys := make([]string, 0, len(choices))
+	for slotID, optionID := range choices {
+		keys = append(keys, slotID.String()+"="+optionID.String())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// componentChoices returns the slot choices that make up the components of
+// a bundle order line, nil for none
+func componentChoices(components []domain.OrderItemComponent) map[uuid.UUID]uuid.UUID {
+	if len(components) == 0 {
+		return nil
+	}
+	choices := make(map[uuid.UUID]uuid.UUID, len(components))
+	for _, c := range components {
+		choices[c.SlotID] = c.OptionID
+	}
+	return choices
+}
+
+// modifierOptionIDs returns the option IDs of the modifiers on an order line
+func modifierOptionIDs(modifiers []domain.OrderItemModifier) []uuid.UUID {
+	ids := make([]uuid.UUID, len(modifiers))
+	for i, m := range modifiers {
+		ids[i] = m.OptionID
+	}
+	return ids
+}
+
+// sortedModifierIDs returns a sorted copy of modifier option IDs, nil for none
+func sortedModifierIDs(ids []uuid.UUID) []uuid.UUID {
+	if len(ids) == 0 {
+		return nil
+	}
+	sorted := make([]uuid.UUID, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	return sorted
+}
+
 // generateHMAC creates HMAC SHA256 signature
 func (u *PaymentUsecase) generateHMAC(data, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))
@@ -0,0 +1,328 @@
+// Package usecase implements ratings and reviews of delivered orders
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Review errors
+var (
+	ErrInvalidReview      = errors.New("invalid review")
+	ErrOrderNotReviewable = errors.New("only delivered orders can be reviewed")
+)
+
+// ReviewUsecase collects customer ratings and lets admins moderate them.
+// Item ratings feed the rating shown on each menu item.
+type ReviewUsecase struct {
+	reviewRepo  *repository.ReviewRepository
+	orderRepo   *repository.OrderRepository
+	menuUsecase *MenuUsecase
+	log         *logger.Logger
+}
+
+// NewReviewUsecase creates a new review usecase
+func NewReviewUsecase(reviewRepo *repository.ReviewRepository, orderRepo *repository.OrderRepository, menuUsecase *MenuUsecase, log *logger.Logger) *ReviewUsecase {
+	return &ReviewUsecase{
+		reviewRepo:  reviewRepo,
+		orderRepo:   orderRepo,
+		menuUsecase: menuUsecase,
+		log:         log,
+	}
+}
+
+// ItemReviewRequest rates one line of the order
+type ItemReviewRequest struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Rating      int       `json:"rating"`
+	Comment     string    `json:"comment"`
+	PhotoURLs   []string  `json:"photo_urls"`
+}
+
+// SubmitReviewRequest contains a customer's review of an order
+type SubmitReviewRequest struct {
+	UserID         uuid.UUID           `json:"-"`
+	OrderID        uuid.UUID           `json:"-"`
+	FoodRating     int                 `json:"food_rating"`
+	DeliveryRating *int                `json:"delivery_rating"` // Delivery orders only
+	Comment        string              `json:"comment"`
+	PhotoURLs      []string            `json:"photo_urls"`
+	Items          []ItemReviewRequest `json:"items"` // Optional, at most one per order line
+}
+
+// SubmitReview records the review of a delivered (or collected) order.
+// Each order can be reviewed once.
+func (u *ReviewUsecase) SubmitReview(ctx context.Context, req SubmitReviewRequest) (*domain.OrderReview, error) {
+	order, err := u.orderRepo.GetByID(ctx, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != req.UserID {
+		return nil, ErrOrderAccessDenied
+	}
+	if order.Status != domain.OrderStatusDelivered && order.Status != domain.OrderStatusCollected {
+		return nil, ErrOrderNotReviewable
+	}
+
+	if err := checkRating(req.FoodRating); err != nil {
+		return nil, err
+	}
+	if req.DeliveryRating != nil {
+		if order.FulfillmentType != domain.FulfillmentDelivery {
+			return nil, fmt.Errorf("%w: only delivery orders have a delivery rating", ErrInvalidReview)
+		}
+		if err := checkRating(*req.DeliveryRating); err != nil {
+			return nil, err
+		}
+	}
+
+	review := &domain.OrderReview{
+		OrderID:        order.ID,
+		UserID:         req.UserID,
+		FoodRating:     req.FoodRating,
+		DeliveryRating: req.DeliveryRating,
+		Items:          make([]domain.ItemReview, 0, len(req.Items)),
+	}
+
+	review.Comment, review.PhotoURLs, err = validateReviewContent(req.Comment, req.PhotoURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[uuid.UUID]domain.OrderItem, len(order.Items))
+	for _, line := range order.Items {
+		lines[line.ID] = line
+	}
+
+	for _, itemReq := range req.Items {
+		line, ok := lines[itemReq.OrderItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: item is not part of this order or rated twice", ErrInvalidReview)
+		}
+		delete(lines, itemReq.OrderItemID)
+
+		if err := checkRating(itemReq.Rating); err != nil {
+			return nil, err
+		}
+
+		item := domain.ItemReview{
+			OrderItemID: line.ID,
+			MenuItemID:  line.MenuItemID,
+			Rating:      itemReq.Rating,
+		}
+		item.Comment, item.PhotoURLs, err = validateReviewContent(itemReq.Comment, itemReq.PhotoURLs)
+		if err != nil {
+			return nil, err
+		}
+		review.Items = append(review.Items, item)
+	}
+
+	if err := u.reviewRepo.Create(ctx, review); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Order reviewed",
+		"order_id", order.ID.String(),
+		"review_id", review.ID.String(),
+		"food_rating", review.FoodRating,
+		"items", len(review.Items),
+	)
+
+	if len(review.Items) > 0 {
+		// Cached menu carries the item ratings
+		u.menuUsecase.invalidateCache(ctx)
+	}
+
+	return review, nil
+}
+
+func checkRating(rating int) error {
+	if rating < domain.MinRating || rating > domain.MaxRating {
+		return fmt.Errorf("%w: ratings go from %d to %d", ErrInvalidReview, domain.MinRating, domain.MaxRating)
+	}
+	return nil
+}
+
+// validateReviewContent sanitises a review comment and checks its photo links.
+// Photos are uploaded by the client beforehand; only https links are kept.
+func validateReviewContent(rawComment string, rawPhotos []string) (string, []string, error) {
+	comment, err := sanitizeNotes(rawComment, domain.MaxReviewCommentLength)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: comment is longer than %d characters", ErrInvalidReview, domain.MaxReviewCommentLength)
+	}
+
+	if len(rawPhotos) > domain.MaxReviewPhotos {
+		return "", nil, fmt.Errorf("%w: at most %d photos", ErrInvalidReview, domain.MaxReviewPhotos)
+	}
+
+	photos := make([]string, 0, len(rawPhotos))
+	for _, raw := range rawPhotos {
+		raw = strings.TrimSpace(raw)
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" || len(raw) > domain.MaxReviewPhotoURL {
+			return "", nil, fmt.Errorf("%w: photos must be https links", ErrInvalidReview)
+		}
+		photos = append(photos, raw)
+	}
+
+	return comment, photos, nil
+}
+
+// GetOrderReview retrieves the review of an order for its customer or an admin
+func (u *ReviewUsecase) GetOrderReview(ctx context.Context, userID, orderID uuid.UUID, isAdmin bool) (*domain.OrderReview, error) {
+	review, err := u.reviewRepo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && review.UserID != userID {
+		return nil, ErrOrderAccessDenied
+	}
+
+	return review, nil
+}
+
+// GetMenuItemReviews retrieves a page of the public reviews of a menu item.
+// Reviewers are shown by first name only and moderation details are left out.
+func (u *ReviewUsecase) GetMenuItemReviews(ctx context.Context, menuItemID uuid.UUID, cursorToken string, limit int) (*repository.ItemReviewPage, error) {
+	cursor, limit, err := parseReviewPaging(cursorToken, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := u.reviewRepo.ListByMenuItem(ctx, menuItemID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch menu item reviews: %w", err)
+	}
+
+	for i := range page.Reviews {
+		review := &page.Reviews[i]
+		if fields := strings.Fields(review.ReviewerName); len(fields) > 0 {
+			review.ReviewerName = fields[0]
+		}
+		review.Status = ""
+		review.ModerationNote = ""
+		review.ModeratedBy = nil
+		review.ModeratedAt = nil
+	}
+
+	return page, nil
+}
+
+// ListReviews retrieves reviews for moderation (admin only), optionally by status
+func (u *ReviewUsecase) ListReviews(ctx context.Context, rawStatuses []string, cursorToken string, limit int) (*repository.OrderReviewPage, error) {
+	cursor, limit, err := parseReviewPaging(cursorToken, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]domain.ReviewStatus, 0, len(rawStatuses))
+	for _, raw := range rawStatuses {
+		status := domain.ReviewStatus(strings.ToUpper(raw))
+		if !status.IsValid() {
+			return nil, fmt.Errorf("%w: unknown review status %q", ErrInvalidFilter, raw)
+		}
+		statuses = append(statuses, status)
+	}
+
+	page, err := u.reviewRepo.List(ctx, statuses, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reviews: %w", err)
+	}
+	return page, nil
+}
+
+func parseReviewPaging(cursorToken string, limit int) (*repository.ReviewCursor, int, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if cursorToken == "" {
+		return nil, limit, nil
+	}
+
+	cursor, err := repository.DecodeReviewCursor(cursorToken)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: invalid cursor", ErrInvalidFilter)
+	}
+	return cursor, limit, nil
+}
+
+// ModerateReviewRequest is an admin's decision on a review or item review
+type ModerateReviewRequest struct {
+	Status domain.ReviewStatus `json:"status"`
+	Note   string              `json:"note"`
+}
+
+// ModerateReview sets the status of a whole review (admin only) and returns it
+func (u *ReviewUsecase) ModerateReview(ctx context.Context, adminID, reviewID uuid.UUID, req ModerateReviewRequest) (*domain.OrderReview, error) {
+	moderation, err := buildModeration(adminID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.reviewRepo.Moderate(ctx, reviewID, moderation); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Review moderated", "review_id", reviewID.String(), "status", moderation.Status, "admin_id", adminID.String())
+	u.menuUsecase.invalidateCache(ctx)
+
+	return u.reviewRepo.GetByID(ctx, reviewID)
+}
+
+// ModerateItemReview sets the status of one item review (admin only) and
+// returns the review it belongs to
+func (u *ReviewUsecase) ModerateItemReview(ctx context.Context, adminID, reviewID, itemReviewID uuid.UUID, req ModerateReviewRequest) (*domain.OrderReview, error) {
+	moderation, err := buildModeration(adminID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := u.reviewRepo.GetByID(ctx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, item := range review.Items {
+		if item.ID == itemReviewID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, repository.ErrNotFound
+	}
+
+	if err := u.reviewRepo.ModerateItem(ctx, itemReviewID, moderation); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Item review moderated", "item_review_id", itemReviewID.String(), "status", moderation.Status, "admin_id", adminID.String())
+	u.menuUsecase.invalidateCache(ctx)
+
+	return u.reviewRepo.GetByID(ctx, reviewID)
+}
+
+func buildModeration(adminID uuid.UUID, req ModerateReviewRequest) (repository.Moderation, error) {
+	status := domain.ReviewStatus(strings.ToUpper(string(req.Status)))
+	if !status.IsValid() {
+		return repository.Moderation{}, fmt.Errorf("%w: status must be VISIBLE, FLAGGED or HIDDEN", ErrInvalidReview)
+	}
+
+	note, err := sanitizeNotes(req.Note, domain.MaxReviewCommentLength)
+	if err != nil {
+		return repository.Moderation{}, fmt.Errorf("%w: note is too long", ErrInvalidReview)
+	}
+
+	return repository.Moderation{Status: status, Note: note, AdminID: adminID}, nil
+}
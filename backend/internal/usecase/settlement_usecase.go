@@ -0,0 +1,332 @@
+// Package usecase implements gateway settlement reconciliation
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// ErrInvalidSettlementReport is returned for a settlement file that cannot be read
+var ErrInvalidSettlementReport = errors.New("invalid settlement report")
+
+// Settlement limits
+const (
+	maxSettlementLines          = 200000
+	maxSettlementGraceDays      = 30
+	defaultReconciliationListed = 200
+	maxReconciliationListed     = 1000
+)
+
+// Columns of the settlement report; every other column is ignored
+var requiredSettlementColumns = []string{"entity_id", "type", "amount", "fee", "tax", "settlement_id", "settled_at"}
+
+// SettlementUsecase imports the gateway's settlement reports and reconciles
+// them with paid orders, so admins can see which payments reached the bank
+type SettlementUsecase struct {
+	settlementRepo *repository.SettlementRepository
+	location       *time.Location
+	log            *logger.Logger
+}
+
+// NewSettlementUsecase creates a new settlement usecase
+func NewSettlementUsecase(settlementRepo *repository.SettlementRepository, location *time.Location, log *logger.Logger) *SettlementUsecase {
+	return &SettlementUsecase{
+		settlementRepo: settlementRepo,
+		location:       location,
+		log:            log,
+	}
+}
+
+// Import reads a settlement report and stores its settled lines. Importing a
+// report again, or one overlapping an earlier one, updates the lines instead
+// of counting them twice.
+func (u *SettlementUsecase) Import(ctx context.Context, fileName string, r io.Reader, importedBy uuid.UUID) (*domain.SettlementImport, error) {
+	lines, skipped, err := ParseSettlementReport(r, u.location)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no settled lines", ErrInvalidSettlementReport)
+	}
+
+	imp := &domain.SettlementImport{
+		FileName:   fileName,
+		ImportedBy: importedBy,
+		Lines:      int64(len(lines)),
+		Skipped:    skipped,
+	}
+	for _, l := range lines {
+		switch l.Type {
+		case domain.SettlementPayment:
+			imp.Payments++
+			imp.Amount += l.Amount
+		case domain.SettlementRefund:
+			imp.Refunds++
+		default:
+			imp.Adjustments++
+		}
+		imp.Fees += l.Fee
+		imp.Tax += l.Tax
+		imp.Net += l.Net
+	}
+
+	if err := u.settlementRepo.Import(ctx, imp, lines); err != nil {
+		return nil, err
+	}
+
+	u.log.WithFields(map[string]interface{}{
+		"import_id": imp.ID,
+		"file":      fileName,
+		"lines":     imp.Lines,
+		"new":       imp.New,
+	}).Info("Settlement report imported")
+
+	return imp, nil
+}
+
+// GetReconciliation reports settlements against orders paid in a range.
+// Orders paid within graceDays of now are pending rather than missing;
+// Razorpay settles T+2 working days, so a few days covers weekends.
+func (u *SettlementUsecase) GetReconciliation(ctx context.Context, r AnalyticsRange, graceDays, limit int) (*domain.ReconciliationReport, error) {
+	if graceDays < 0 || graceDays > maxSettlementGraceDays {
+		return nil, fmt.Errorf("%w: grace_days must be between 0 and %d", ErrInvalidFilter, maxSettlementGraceDays)
+	}
+	if limit <= 0 {
+		limit = defaultReconciliationListed
+	}
+	if limit > maxReconciliationListed {
+		limit = maxReconciliationListed
+	}
+
+	now := time.Now()
+	from, to, err := resolveDateRange(r, u.location, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.settlementRepo.GetReconciliation(ctx, from, to, now.AddDate(0, 0, -graceDays), limit)
+}
+
+// ParseSettlementReport reads the gateway's settlement report CSV, as
+// downloaded from the Razorpay dashboard. Columns are found by their header,
+// amounts are in rupees and times without a zone are in loc. Lines that are
+// not settled yet are skipped and counted.
+func ParseSettlementReport(r io.Reader, loc *time.Location) ([]domain.SettlementLine, int64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: cannot read header: %v", ErrInvalidSettlementReport, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\uFEFF")
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		columns[name] = i
+	}
+	for _, name := range requiredSettlementColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, 0, fmt.Errorf("%w: missing column %s", ErrInvalidSettlementReport, name)
+		}
+	}
+
+	var lines []domain.SettlementLine
+	var skipped int64
+	seen := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrInvalidSettlementReport, err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		l, settled, err := parseSettlementLine(field, loc)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: line %d: %v", ErrInvalidSettlementReport, line, err)
+		}
+		if !settled {
+			skipped++
+			continue
+		}
+		if seen[l.EntityID] {
+			return nil, 0, fmt.Errorf("%w: line %d: %s is listed twice", ErrInvalidSettlementReport, line, l.EntityID)
+		}
+		seen[l.EntityID] = true
+
+		if len(lines) == maxSettlementLines {
+			return nil, 0, fmt.Errorf("%w: more than %d lines, import it in parts", ErrInvalidSettlementReport, maxSettlementLines)
+		}
+		lines = append(lines, *l)
+	}
+
+	return lines, skipped, nil
+}
+
+// parseSettlementLine reads one line. Returns false for a line that is not
+// settled yet.
+func parseSettlementLine(field func(string) string, loc *time.Location) (*domain.SettlementLine, bool, error) {
+	switch strings.ToLower(field("settled")) {
+	case "0", "false", "no":
+		return nil, false, nil
+	}
+	if field("settled_at") == "" || field("settlement_id") == "" {
+		return nil, false, nil
+	}
+
+	l := &domain.SettlementLine{
+		EntityID:        field("entity_id"),
+		Type:            strings.ToLower(field("type")),
+		PaymentID:       field("payment_id"),
+		RazorpayOrderID: field("order_id"),
+		SettlementID:    field("settlement_id"),
+		SettlementUTR:   field("settlement_utr"),
+	}
+	if l.EntityID == "" || l.Type == "" {
+		return nil, false, errors.New("entity_id and type are required")
+	}
+	if l.Type == domain.SettlementPayment && l.PaymentID == "" {
+		l.PaymentID = l.EntityID
+	}
+	if currency := field("currency"); currency != "" && !strings.EqualFold(currency, "INR") {
+		return nil, false, fmt.Errorf("unsupported currency %s", currency)
+	}
+
+	var err error
+	if l.SettledAt, err = parseSettlementTime(field("settled_at"), loc); err != nil {
+		return nil, false, fmt.Errorf("invalid settled_at: %v", err)
+	}
+
+	amounts := []struct {
+		name  string
+		value *int64
+	}{
+		{"amount", &l.Amount},
+		{"fee", &l.Fee},
+		{"tax", &l.Tax},
+	}
+	for _, a := range amounts {
+		if *a.value, err = parseRupees(field(a.name)); err != nil {
+			return nil, false, fmt.Errorf("invalid %s: %v", a.name, err)
+		}
+	}
+	if l.Amount < 0 || l.Fee < 0 || l.Tax < 0 || l.Tax > l.Fee {
+		return nil, false, errors.New("amount, fee and tax must not be negative and tax must not exceed the fee")
+	}
+
+	// The report's credit and debit columns are what moved in the payout;
+	// without them they follow from the line type
+	credit, debit := field("credit"), field("debit")
+	if credit != "" || debit != "" {
+		c, err := parseRupees(credit)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid credit: %v", err)
+		}
+		d, err := parseRupees(debit)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid debit: %v", err)
+		}
+		l.Net = c - d
+	} else {
+		switch l.Type {
+		case domain.SettlementPayment:
+			l.Net = l.Amount - l.Fee
+		case domain.SettlementRefund:
+			l.Net = -(l.Amount + l.Fee)
+		default:
+			l.Net = l.Amount
+		}
+	}
+
+	return l, true, nil
+}
+
+// parseRupees parses an amount in rupees, such as "1,249.50", into paisa.
+// Empty is zero.
+func parseRupees(value string) (int64, error) {
+	value = strings.NewReplacer(",", "", "₹", "", " ", "").Replace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("%q has more than two decimals", value)
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	rupees, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an amount", value)
+	}
+	paisa, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil || paisa < 0 {
+		return 0, fmt.Errorf("%q is not an amount", value)
+	}
+
+	total := rupees*100 + paisa
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
+
+// settlementTimeLayouts are the time formats found in settlement reports;
+// layouts without a zone are read in the business timezone
+var settlementTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+}
+
+// parseSettlementTime parses a report time, either in one of the layouts or
+// as Unix seconds
+func parseSettlementTime(value string, loc *time.Location) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	for _, layout := range settlementTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", value)
+}
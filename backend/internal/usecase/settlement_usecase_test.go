@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseSettlementReport(t *testing.T) {
+	loc := time.FixedZone("IST", 5*60*60+30*60)
+
+	f, err := os.Open("../../testdata/settlements/razorpay_settlement_report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines, skipped, err := ParseSettlementReport(f, loc)
+	if err != nil {
+		t.Fatalf("ParseSettlementReport: %v", err)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	if skipped != 1 {
+		t.Errorf("got %d skipped, want 1", skipped)
+	}
+
+	tests := []struct {
+		entityID  string
+		paymentID string
+		amount    int64
+		fee       int64
+		net       int64
+	}{
+		{"pay_NzQ1bTEsT01", "pay_NzQ1bTEsT01", 125000, 2926, 122074},
+		{"pay_NzQ2cHLmV02", "pay_NzQ2cHLmV02", 45000, 1042, 43958},
+		{"pay_NzQ3dKrTn03", "pay_NzQ3dKrTn03", 79900, 1858, 78042},
+		{"rfnd_NzR4eLsUo04", "pay_NzQ1bTEsT01", 25000, 0, -25000},
+	}
+	for i, tt := range tests {
+		l := lines[i]
+		if l.EntityID != tt.entityID || l.PaymentID != tt.paymentID {
+			t.Errorf("line %d: got %s for %s, want %s for %s", i, l.EntityID, l.PaymentID, tt.entityID, tt.paymentID)
+		}
+		if l.Amount != tt.amount || l.Fee != tt.fee || l.Net != tt.net {
+			t.Errorf("%s: got amount %d fee %d net %d, want %d %d %d",
+				tt.entityID, l.Amount, l.Fee, l.Net, tt.amount, tt.fee, tt.net)
+		}
+	}
+
+	settledAt := time.Date(2024, 5, 15, 9, 2, 11, 0, loc)
+	if !lines[0].SettledAt.Equal(settledAt) {
+		t.Errorf("got settled_at %s, want %s", lines[0].SettledAt, settledAt)
+	}
+}
+
+func TestParseRupees(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"1,249.50", 124950, false},
+		{"1250", 125000, false},
+		{"0.5", 50, false},
+		{".75", 75, false},
+		{"₹ 99.99", 9999, false},
+		{"", 0, false},
+		{"-", 0, false},
+		{"-250.00", -25000, false},
+		{"-1,000.5", -100050, false},
+		{"12.345", 0, true},
+		{"abc", 0, true},
+		{"12.-5", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRupees(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRupees(%q): got error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRupees(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
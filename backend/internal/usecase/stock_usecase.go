@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// ErrInvalidStock is returned for a negative daily stock or a remaining
+// count outside 0 to the daily stock
+var ErrInvalidStock = errors.New("daily stock must not be negative and remaining must be between 0 and the daily stock")
+
+// Stock scheduler limits
+const (
+	// stockSchedulerInterval is how often the scheduler releases expired
+	// holds and looks for a daily reset to run
+	stockSchedulerInterval = time.Minute
+	// maxStockReleasesPerRun caps the orders released per tick
+	maxStockReleasesPerRun = 500
+)
+
+// StockUsecase manages the daily stock counts of menu items: admins set
+// them, and the scheduler releases expired holds and resets them each day
+type StockUsecase struct {
+	stockRepo *repository.StockRepository
+	config    config.StockConfig
+	location  *time.Location
+	log       *logger.Logger
+
+	lastReset time.Time // Business day of the last reset this instance saw
+}
+
+// NewStockUsecase creates a new stock usecase
+func NewStockUsecase(stockRepo *repository.StockRepository, cfg config.StockConfig, location *time.Location, log *logger.Logger) *StockUsecase {
+	return &StockUsecase{
+		stockRepo: stockRepo,
+		config:    cfg,
+		location:  location,
+		log:       log,
+	}
+}
+
+// RunScheduler releases the stock held by orders left unpaid for longer
+// than the hold, and resets the counts once the reset hour of each business
+// day has passed, until ctx is cancelled. Running it on several instances is
+// safe: each day's reset is claimed by one of them.
+func (u *StockUsecase) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(stockSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		u.resetDaily(ctx, time.Now())
+		u.releaseExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resetDaily resets today's counts if it is due and no instance has reset
+// them yet
+func (u *StockUsecase) resetDaily(ctx context.Context, now time.Time) {
+	now = now.In(u.location)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, u.location)
+	if now.Before(day.Add(time.Duration(u.config.ResetHour)*time.Hour)) || day.Equal(u.lastReset) {
+		return
+	}
+
+	reset, err := u.stockRepo.ResetDaily(ctx, day)
+	if errors.Is(err, repository.ErrNotFound) {
+		u.lastReset = day
+		return
+	}
+	if err != nil {
+		u.log.Error("Failed to reset daily stock", "error", err)
+		return
+	}
+	u.lastReset = day
+
+	u.log.Info("Daily stock reset", "day", day.Format("2006-01-02"), "items", reset)
+}
+
+// releaseExpired gives back the stock held by unpaid orders past the hold
+func (u *StockUsecase) releaseExpired(ctx context.Context) {
+	released, err := u.stockRepo.ReleaseExpired(ctx, time.Now().Add(-u.config.Hold), maxStockReleasesPerRun)
+	if err != nil {
+		u.log.Error("Failed to release expired stock", "error", err, "released", released)
+		return
+	}
+	if released > 0 {
+		u.log.Info("Released stock of unpaid orders", "orders", released)
+	}
+}
+
+// ListStock returns the stock counts of every counted item
+func (u *StockUsecase) ListStock(ctx context.Context) ([]domain.MenuItemStock, error) {
+	return u.stockRepo.List(ctx)
+}
+
+// SetStock starts counting a menu item or changes its daily stock.
+// remaining optionally sets today's count.
+func (u *StockUsecase) SetStock(ctx context.Context, menuItemID uuid.UUID, dailyStock int, remaining *int) (*domain.MenuItemStock, error) {
+	if dailyStock < 0 || (remaining != nil && (*remaining < 0 || *remaining > dailyStock)) {
+		return nil, ErrInvalidStock
+	}
+	return u.stockRepo.Set(ctx, menuItemID, dailyStock, remaining)
+}
+
+// DeleteStock stops counting a menu item
+func (u *StockUsecase) DeleteStock(ctx context.Context, menuItemID uuid.UUID) error {
+	return u.stockRepo.Delete(ctx, menuItemID)
+}
@@ -0,0 +1,1002 @@
+// Package usecase implements tiffin meal-plan subscriptions
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/config"
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+)
+
+// Subscription errors
+var (
+	ErrInvalidPlan                 = errors.New("invalid meal plan")
+	ErrInvalidSubscription         = errors.New("invalid subscription request")
+	ErrPlanUnavailable             = errors.New("meal plan is not open for subscription")
+	ErrSubscriptionAccessDenied    = errors.New("subscription does not belong to user")
+	ErrSubscriptionNotPaused       = errors.New("subscription is not paused")
+	ErrSubscriptionNotRenewable    = errors.New("subscription cannot be renewed")
+	ErrSubscriptionPaymentMismatch = errors.New("payment does not match the billing period")
+)
+
+// subscriptionSchedulerInterval is how often the scheduler looks for tiffins to place
+const subscriptionSchedulerInterval = 5 * time.Minute
+
+// SubscriptionNotifier tells customers about their subscription running out
+type SubscriptionNotifier interface {
+	// RenewalDue is sent once per billing period when few paid meals are left
+	RenewalDue(ctx context.Context, sub *domain.Subscription, mealsLeft int)
+	// Expired is sent when the last paid meal has been used
+	Expired(ctx context.Context, sub *domain.Subscription)
+}
+
+// logSubscriptionNotifier only logs; used until a real channel is configured
+type logSubscriptionNotifier struct {
+	log *logger.Logger
+}
+
+func (n logSubscriptionNotifier) RenewalDue(ctx context.Context, sub *domain.Subscription, mealsLeft int) {
+	n.log.Info("Subscription renewal due", "subscription_id", sub.ID.String(), "user_id", sub.UserID.String(), "meals_left", mealsLeft)
+}
+
+func (n logSubscriptionNotifier) Expired(ctx context.Context, sub *domain.Subscription) {
+	n.log.Info("Subscription expired", "subscription_id", sub.ID.String(), "user_id", sub.UserID.String())
+}
+
+// SubscriptionUsecase runs tiffin plans: prepaid billing periods of meals,
+// customer pauses and skips, and the daily orders placed by the scheduler
+type SubscriptionUsecase struct {
+	subscriptionRepo *repository.SubscriptionRepository
+	menuRepo         *repository.MenuRepository
+	refundRepo       *repository.RefundRepository
+	paymentUsecase   *PaymentUsecase
+	config           config.SubscriptionConfig
+	location         *time.Location
+	notifier         SubscriptionNotifier
+	log              *logger.Logger
+}
+
+// NewSubscriptionUsecase creates a new subscription usecase
+func NewSubscriptionUsecase(
+	subscriptionRepo *repository.SubscriptionRepository,
+	menuRepo *repository.MenuRepository,
+	refundRepo *repository.RefundRepository,
+	paymentUsecase *PaymentUsecase,
+	cfg config.SubscriptionConfig,
+	location *time.Location,
+	log *logger.Logger,
+) *SubscriptionUsecase {
+	return &SubscriptionUsecase{
+		subscriptionRepo: subscriptionRepo,
+		menuRepo:         menuRepo,
+		refundRepo:       refundRepo,
+		paymentUsecase:   paymentUsecase,
+		config:           cfg,
+		location:         location,
+		notifier:         logSubscriptionNotifier{log: log},
+		log:              log,
+	}
+}
+
+// SetNotifier sets where renewal and expiry notices are sent
+func (u *SubscriptionUsecase) SetNotifier(notifier SubscriptionNotifier) {
+	u.notifier = notifier
+}
+
+// ============================================================================
+// DAYS
+// ============================================================================
+
+// today returns the start of the current day in the business timezone
+func (u *SubscriptionUsecase) today(now time.Time) time.Time {
+	now = now.In(u.location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, u.location)
+}
+
+// lockTime is when a day's tiffins are ordered; changes for the day close then
+func (u *SubscriptionUsecase) lockTime(day time.Time) time.Time {
+	return day.Add(u.config.KitchenCutoff - u.config.OrderLead)
+}
+
+// firstOpenDay is the earliest day whose tiffin can still be changed
+func (u *SubscriptionUsecase) firstOpenDay(now time.Time) time.Time {
+	day := u.today(now)
+	if !now.Before(u.lockTime(day)) {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// parseOpenDay parses a YYYY-MM-DD day that can still be changed and is not
+// too far ahead
+func (u *SubscriptionUsecase) parseOpenDay(value, field string) (time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", value, u.location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be YYYY-MM-DD", ErrInvalidSubscription, field)
+	}
+
+	now := time.Now()
+	first := u.firstOpenDay(now)
+	if day.Before(first) {
+		return time.Time{}, fmt.Errorf("%w: %s must be %s or later", ErrInvalidSubscription, field, first.Format("2006-01-02"))
+	}
+	if day.After(u.today(now).AddDate(0, 0, domain.MaxScheduleAheadDays)) {
+		return time.Time{}, fmt.Errorf("%w: %s must be within %d days", ErrInvalidSubscription, field, domain.MaxScheduleAheadDays)
+	}
+
+	return day, nil
+}
+
+// ============================================================================
+// MEAL PLANS
+// ============================================================================
+
+// MealPlanRequest contains the data needed to create or replace a meal plan
+type MealPlanRequest struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Meals       int                  `json:"meals"`
+	Price       int64                `json:"price"` // Paisa per billing period
+	IsActive    *bool                `json:"is_active"`
+	Days        []domain.MealPlanDay `json:"days"` // Item names are filled in from the menu
+}
+
+// CreatePlan creates a meal plan (admin)
+func (u *SubscriptionUsecase) CreatePlan(ctx context.Context, req MealPlanRequest) (*domain.MealPlan, error) {
+	plan, err := u.buildPlan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	plan.IsActive = req.IsActive == nil || *req.IsActive
+
+	if err := u.subscriptionRepo.CreatePlan(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Meal plan created", "plan_id", plan.ID.String(), "name", plan.Name)
+
+	return plan, nil
+}
+
+// UpdatePlan replaces a meal plan (admin). Meals and price apply to billing
+// periods created from now on; the weekday menus to tomorrow's tiffins.
+func (u *SubscriptionUsecase) UpdatePlan(ctx context.Context, planID uuid.UUID, req MealPlanRequest) (*domain.MealPlan, error) {
+	current, err := u.subscriptionRepo.GetPlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := u.buildPlan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	plan.ID = planID
+	plan.IsActive = current.IsActive
+	if req.IsActive != nil {
+		plan.IsActive = *req.IsActive
+	}
+
+	if err := u.subscriptionRepo.UpdatePlan(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Meal plan updated", "plan_id", plan.ID.String())
+
+	return plan, nil
+}
+
+// buildPlan validates a plan request and names its dishes from the menu
+func (u *SubscriptionUsecase) buildPlan(ctx context.Context, req MealPlanRequest) (*domain.MealPlan, error) {
+	name, err := sanitizeNotes(req.Name, 100)
+	if err != nil || name == "" {
+		return nil, fmt.Errorf("%w: a name of up to 100 characters is required", ErrInvalidPlan)
+	}
+	description, err := sanitizeNotes(req.Description, 500)
+	if err != nil {
+		return nil, fmt.Errorf("%w: description is too long", ErrInvalidPlan)
+	}
+
+	if req.Meals < 1 || req.Meals > domain.MaxPlanMeals {
+		return nil, fmt.Errorf("%w: meals must be between 1 and %d", ErrInvalidPlan, domain.MaxPlanMeals)
+	}
+	if req.Price < int64(req.Meals) {
+		return nil, fmt.Errorf("%w: price must cover at least one paisa per meal", ErrInvalidPlan)
+	}
+	if len(req.Days) == 0 || len(req.Days) > 7 {
+		return nil, fmt.Errorf("%w: between one and seven weekday menus are required", ErrInvalidPlan)
+	}
+
+	seenDays := make(map[time.Weekday]bool, len(req.Days))
+	var ids []uuid.UUID
+	seenItems := make(map[uuid.UUID]bool)
+	for _, day := range req.Days {
+		if day.Weekday < time.Sunday || day.Weekday > time.Saturday || seenDays[day.Weekday] {
+			return nil, fmt.Errorf("%w: weekdays must be distinct, 0 (Sunday) to 6", ErrInvalidPlan)
+		}
+		seenDays[day.Weekday] = true
+
+		if len(day.Items) == 0 || len(day.Items) > domain.MaxCartLines {
+			return nil, fmt.Errorf("%w: every weekday needs between 1 and %d dishes", ErrInvalidPlan, domain.MaxCartLines)
+		}
+		for _, item := range day.Items {
+			if item.MenuItemID == uuid.Nil || item.Quantity <= 0 || item.Quantity > 20 {
+				return nil, fmt.Errorf("%w: every dish needs a menu item and a quantity up to 20", ErrInvalidPlan)
+			}
+			if !seenItems[item.MenuItemID] {
+				seenItems[item.MenuItemID] = true
+				ids = append(ids, item.MenuItemID)
+			}
+		}
+	}
+
+	menuItems, err := u.menuRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch menu items: %w", err)
+	}
+	if len(menuItems) != len(ids) {
+		return nil, fmt.Errorf("%w: unknown menu item", ErrInvalidPlan)
+	}
+	names := make(map[uuid.UUID]string, len(menuItems))
+	for _, menuItem := range menuItems {
+		names[menuItem.ID] = menuItem.Name
+	}
+
+	days := make([]domain.MealPlanDay, len(req.Days))
+	for i, day := range req.Days {
+		items := make([]domain.MealPlanItem, len(day.Items))
+		for j, item := range day.Items {
+			items[j] = domain.MealPlanItem{
+				MenuItemID: item.MenuItemID,
+				Name:       names[item.MenuItemID],
+				Quantity:   item.Quantity,
+			}
+		}
+		days[i] = domain.MealPlanDay{Weekday: day.Weekday, Items: items}
+	}
+
+	return &domain.MealPlan{
+		Name:        name,
+		Description: description,
+		Meals:       req.Meals,
+		Price:       req.Price,
+		Days:        days,
+	}, nil
+}
+
+// GetPlans returns the plans open for subscription, or every plan for admins
+func (u *SubscriptionUsecase) GetPlans(ctx context.Context, all bool) ([]domain.MealPlan, error) {
+	return u.subscriptionRepo.ListPlans(ctx, !all)
+}
+
+// GetPlan returns a meal plan
+func (u *SubscriptionUsecase) GetPlan(ctx context.Context, planID uuid.UUID) (*domain.MealPlan, error) {
+	return u.subscriptionRepo.GetPlan(ctx, planID)
+}
+
+// ============================================================================
+// SUBSCRIPTIONS
+// ============================================================================
+
+// SubscribeRequest contains the data needed to subscribe to a meal plan
+type SubscribeRequest struct {
+	UserID          uuid.UUID `json:"-"`
+	PlanID          uuid.UUID `json:"plan_id"`
+	StartDate       string    `json:"start_date"` // YYYY-MM-DD; defaults to the first day that can still be ordered
+	DeliveryAddress string    `json:"delivery_address"`
+	Notes           string    `json:"notes"`
+}
+
+// SubscriptionPaymentResponse is a subscription with the payment for a billing period
+type SubscriptionPaymentResponse struct {
+	Subscription *domain.Subscription   `json:"subscription"`
+	Payment      *InitiateOrderResponse `json:"payment"`
+}
+
+// Subscribe creates a subscription and the payment for its first billing
+// period. Tiffins start once the period is paid.
+func (u *SubscriptionUsecase) Subscribe(ctx context.Context, req SubscribeRequest) (*SubscriptionPaymentResponse, error) {
+	plan, err := u.subscriptionRepo.GetPlan(ctx, req.PlanID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrPlanUnavailable
+		}
+		return nil, err
+	}
+	if !plan.IsActive {
+		return nil, ErrPlanUnavailable
+	}
+
+	startDate := u.firstOpenDay(time.Now())
+	if req.StartDate != "" {
+		startDate, err = u.parseOpenDay(req.StartDate, "start_date")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	address, notes, err := u.sanitizeDetails(req.DeliveryAddress, req.Notes)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &domain.Subscription{
+		UserID:          req.UserID,
+		PlanID:          plan.ID,
+		PlanName:        plan.Name,
+		StartDate:       startDate.Format("2006-01-02"),
+		DeliveryAddress: address,
+		Notes:           notes,
+	}
+	period := &domain.SubscriptionPeriod{
+		Amount: plan.Price,
+		Meals:  plan.Meals,
+	}
+
+	if err := u.subscriptionRepo.Create(ctx, sub, startDate, period); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Subscription created",
+		"subscription_id", sub.ID.String(),
+		"plan_id", plan.ID.String(),
+		"start_date", sub.StartDate,
+	)
+
+	payment, err := u.payPeriod(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubscriptionPaymentResponse{Subscription: sub, Payment: payment}, nil
+}
+
+// sanitizeDetails checks the delivery address and notes of a subscription
+func (u *SubscriptionUsecase) sanitizeDetails(rawAddress, rawNotes string) (string, string, error) {
+	address, err := sanitizeNotes(rawAddress, domain.MaxDeliveryAddressLength)
+	if err != nil || address == "" {
+		return "", "", fmt.Errorf("%w: a delivery address of up to %d characters is required",
+			ErrInvalidSubscription, domain.MaxDeliveryAddressLength)
+	}
+
+	notes, err := sanitizeNotes(rawNotes, domain.MaxOrderNotesLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	return address, notes, nil
+}
+
+// payPeriod creates (or reuses) the gateway order for a billing period
+func (u *SubscriptionUsecase) payPeriod(ctx context.Context, period *domain.SubscriptionPeriod) (*InitiateOrderResponse, error) {
+	razorpayOrderID := period.RazorpayOrderID
+	if razorpayOrderID == "" {
+		var err error
+		razorpayOrderID, err = u.paymentUsecase.CreateGatewayOrder(period.Amount, period.ID.String(), map[string]interface{}{
+			"subscription_id": period.SubscriptionID.String(),
+			"period_id":       period.ID.String(),
+		})
+		if err != nil {
+			u.log.Error("Failed to create Razorpay order for billing period", "error", err, "period_id", period.ID.String())
+			return nil, fmt.Errorf("failed to create payment order: %w", err)
+		}
+
+		err = u.subscriptionRepo.SetPeriodGatewayOrder(ctx, period.ID, razorpayOrderID)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Renewal started twice at the same time; use the order recorded first
+			current, err := u.subscriptionRepo.GetPendingPeriod(ctx, period.SubscriptionID)
+			if err != nil {
+				return nil, err
+			}
+			return u.payPeriod(ctx, current)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &InitiateOrderResponse{
+		ID:              period.ID,
+		RazorpayOrderID: razorpayOrderID,
+		KeyID:           u.paymentUsecase.KeyID(),
+		Amount:          period.Amount,
+		Currency:        "INR",
+		Receipt:         period.ID.String(),
+		Name:            "Food Delivery",
+		Description:     fmt.Sprintf("Tiffin plan, %d meals", period.Meals),
+	}, nil
+}
+
+// Renew returns the payment for the next billing period at the plan's
+// current price, creating the period unless one is already awaiting payment
+func (u *SubscriptionUsecase) Renew(ctx context.Context, userID, subscriptionID uuid.UUID) (*SubscriptionPaymentResponse, error) {
+	sub, err := u.getOwned(ctx, userID, subscriptionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == domain.SubscriptionCancelled {
+		return nil, ErrSubscriptionNotRenewable
+	}
+
+	period, err := u.subscriptionRepo.GetPendingPeriod(ctx, subscriptionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		plan, planErr := u.subscriptionRepo.GetPlan(ctx, sub.PlanID)
+		if planErr != nil {
+			return nil, planErr
+		}
+		if !plan.IsActive {
+			return nil, ErrPlanUnavailable
+		}
+
+		period = &domain.SubscriptionPeriod{
+			SubscriptionID: subscriptionID,
+			Amount:         plan.Price,
+			Meals:          plan.Meals,
+		}
+		err = u.subscriptionRepo.CreateRenewal(ctx, period)
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			// Created concurrently; pay that one
+			period, err = u.subscriptionRepo.GetPendingPeriod(ctx, subscriptionID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := u.payPeriod(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubscriptionPaymentResponse{Subscription: sub, Payment: payment}, nil
+}
+
+// VerifyPayment records a billing period payment after the client's checkout
+// success callback. The webhook records it as well; whichever arrives first wins.
+func (u *SubscriptionUsecase) VerifyPayment(ctx context.Context, userID, subscriptionID uuid.UUID, razorpayOrderID, paymentID, signature string) (*domain.Subscription, error) {
+	if _, err := u.getOwned(ctx, userID, subscriptionID, false); err != nil {
+		return nil, err
+	}
+
+	period, err := u.subscriptionRepo.GetPeriodByRazorpayOrderID(ctx, razorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSubscriptionPaymentMismatch
+		}
+		return nil, err
+	}
+	if period.SubscriptionID != subscriptionID {
+		return nil, ErrSubscriptionPaymentMismatch
+	}
+
+	if !u.paymentUsecase.VerifySignature(razorpayOrderID, paymentID, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	if err := u.capture(ctx, period, paymentID); err != nil {
+		return nil, err
+	}
+
+	return u.GetSubscription(ctx, userID, subscriptionID, false)
+}
+
+// capture records a billing period payment, refunding it straight away if
+// the subscription was cancelled in the meantime
+func (u *SubscriptionUsecase) capture(ctx context.Context, period *domain.SubscriptionPeriod, paymentID string) error {
+	result, err := u.subscriptionRepo.CapturePeriod(ctx, period.ID, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to record billing period payment: %w", err)
+	}
+
+	if result.AlreadyProcessed {
+		return nil
+	}
+
+	log := u.log.WithFields(map[string]interface{}{
+		"subscription_id": period.SubscriptionID.String(),
+		"period_id":       period.ID.String(),
+	})
+
+	if result.Refund != nil {
+		log.Warn("Billing period paid after the subscription was cancelled, refunding")
+		u.processRefunds(ctx, period.SubscriptionID)
+		return nil
+	}
+
+	log.Info("Billing period paid", "number", period.Number, "meals", period.Meals)
+
+	return nil
+}
+
+// processRefunds sends the pending refunds of a subscription's periods to the
+// gateway. Failures are recorded on the refund and retried on the next cancel.
+func (u *SubscriptionUsecase) processRefunds(ctx context.Context, subscriptionID uuid.UUID) {
+	periodIDs, err := u.subscriptionRepo.GetPeriodIDs(ctx, subscriptionID)
+	if err != nil {
+		u.log.Error("Failed to load billing periods for refunds", "error", err, "subscription_id", subscriptionID.String())
+		return
+	}
+
+	refunds, err := u.refundRepo.GetUnprocessedBySources(ctx, domain.RefundSourceSubscriptionPeriod, periodIDs)
+	if err != nil {
+		u.log.Error("Failed to load pending refunds", "error", err, "subscription_id", subscriptionID.String())
+		return
+	}
+
+	for _, refund := range refunds {
+		log := u.log.WithFields(map[string]interface{}{
+			"subscription_id": subscriptionID.String(),
+			"period_id":       refund.SourceID.String(),
+			"refund_id":       refund.ID.String(),
+		})
+
+		razorpayRefundID, err := u.paymentUsecase.RefundPayment(refund.RazorpayPaymentID, refund.Amount, map[string]interface{}{
+			"subscription_id": subscriptionID.String(),
+			"period_id":       refund.SourceID.String(),
+			"reason":          refund.Reason,
+		})
+		if err != nil {
+			log.Error("Refund failed", "error", err)
+			if markErr := u.refundRepo.MarkFailed(ctx, refund.ID, err.Error()); markErr != nil {
+				log.Error("Failed to record refund failure", "error", markErr)
+			}
+			continue
+		}
+
+		if err := u.refundRepo.MarkProcessed(ctx, refund.ID, razorpayRefundID); err != nil {
+			log.Error("Failed to record refund", "error", err, "razorpay_refund_id", razorpayRefundID)
+			continue
+		}
+
+		log.Info("Billing period refunded", "amount", refund.Amount, "razorpay_refund_id", razorpayRefundID)
+	}
+}
+
+// getOwned loads a subscription its owner (or an admin) may act on
+func (u *SubscriptionUsecase) getOwned(ctx context.Context, userID, subscriptionID uuid.UUID, isAdmin bool) (*domain.Subscription, error) {
+	sub, err := u.subscriptionRepo.GetByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && sub.UserID != userID {
+		return nil, ErrSubscriptionAccessDenied
+	}
+
+	return sub, nil
+}
+
+// GetSubscription returns a subscription with its billing periods and
+// upcoming skipped days
+func (u *SubscriptionUsecase) GetSubscription(ctx context.Context, userID, subscriptionID uuid.UUID, isAdmin bool) (*domain.Subscription, error) {
+	sub, err := u.getOwned(ctx, userID, subscriptionID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.Periods, err = u.subscriptionRepo.GetPeriods(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.Skips, err = u.subscriptionRepo.GetSkips(ctx, subscriptionID, u.today(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// GetUserSubscriptions returns a customer's subscriptions
+func (u *SubscriptionUsecase) GetUserSubscriptions(ctx context.Context, userID uuid.UUID) ([]domain.Subscription, error) {
+	return u.subscriptionRepo.GetByUserID(ctx, userID)
+}
+
+// ListSubscriptions returns subscriptions by status (admin); active ones by default
+func (u *SubscriptionUsecase) ListSubscriptions(ctx context.Context, statuses []string) ([]domain.Subscription, error) {
+	filter := []domain.SubscriptionStatus{domain.SubscriptionActive}
+	if len(statuses) > 0 {
+		filter = make([]domain.SubscriptionStatus, 0, len(statuses))
+		for _, s := range statuses {
+			status := domain.SubscriptionStatus(s)
+			if !status.IsValid() {
+				return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, s)
+			}
+			filter = append(filter, status)
+		}
+	}
+
+	return u.subscriptionRepo.GetByStatuses(ctx, filter)
+}
+
+// UpdateSubscriptionRequest changes where and how future tiffins are delivered
+type UpdateSubscriptionRequest struct {
+	Version         int    `json:"version"`
+	DeliveryAddress string `json:"delivery_address"`
+	Notes           string `json:"notes"`
+}
+
+// UpdateSubscription changes the delivery address and notes. Tiffins already
+// ordered keep the old ones.
+func (u *SubscriptionUsecase) UpdateSubscription(ctx context.Context, userID, subscriptionID uuid.UUID, req UpdateSubscriptionRequest) (*domain.Subscription, error) {
+	if _, err := u.getOwned(ctx, userID, subscriptionID, false); err != nil {
+		return nil, err
+	}
+
+	address, notes, err := u.sanitizeDetails(req.DeliveryAddress, req.Notes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.subscriptionRepo.UpdateDetails(ctx, subscriptionID, req.Version, address, notes); err != nil {
+		return nil, err
+	}
+
+	return u.GetSubscription(ctx, userID, subscriptionID, false)
+}
+
+// PauseRequest pauses deliveries between two days
+type PauseRequest struct {
+	Version int    `json:"version"`
+	From    string `json:"from"`  // YYYY-MM-DD; defaults to the first day that can still be changed
+	Until   string `json:"until"` // YYYY-MM-DD, inclusive; empty pauses until resumed
+}
+
+// Pause stops tiffins from a day until another, or until resumed. Paused
+// days do not use meals. A new pause replaces the previous one.
+func (u *SubscriptionUsecase) Pause(ctx context.Context, userID, subscriptionID uuid.UUID, req PauseRequest) (*domain.Subscription, error) {
+	if _, err := u.getOwned(ctx, userID, subscriptionID, false); err != nil {
+		return nil, err
+	}
+
+	from := u.firstOpenDay(time.Now())
+	var err error
+	if req.From != "" {
+		from, err = u.parseOpenDay(req.From, "from")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var until *time.Time
+	if req.Until != "" {
+		day, err := u.parseOpenDay(req.Until, "until")
+		if err != nil {
+			return nil, err
+		}
+		if day.Before(from) {
+			return nil, fmt.Errorf("%w: until must not be before from", ErrInvalidSubscription)
+		}
+		until = &day
+	}
+
+	if err := u.subscriptionRepo.SetPause(ctx, subscriptionID, req.Version, &from, until); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Subscription paused", "subscription_id", subscriptionID.String(), "from", from.Format("2006-01-02"))
+
+	return u.GetSubscription(ctx, userID, subscriptionID, false)
+}
+
+// Resume ends a pause from the first day that can still be changed
+func (u *SubscriptionUsecase) Resume(ctx context.Context, userID, subscriptionID uuid.UUID, version int) (*domain.Subscription, error) {
+	sub, err := u.getOwned(ctx, userID, subscriptionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if sub.PausedFrom == nil {
+		return nil, ErrSubscriptionNotPaused
+	}
+
+	pausedFrom, err := time.ParseInLocation("2006-01-02", *sub.PausedFrom, u.location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pause: %w", err)
+	}
+
+	first := u.firstOpenDay(time.Now())
+	var from, until *time.Time
+	if pausedFrom.Before(first) {
+		// Days already ordered (or not) stay as they were
+		lastLocked := first.AddDate(0, 0, -1)
+		from, until = &pausedFrom, &lastLocked
+	}
+
+	if err := u.subscriptionRepo.SetPause(ctx, subscriptionID, version, from, until); err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Subscription resumed", "subscription_id", subscriptionID.String())
+
+	return u.GetSubscription(ctx, userID, subscriptionID, false)
+}
+
+// SkipDay skips the tiffin of one delivery day
+func (u *SubscriptionUsecase) SkipDay(ctx context.Context, userID, subscriptionID uuid.UUID, date string) (*domain.Subscription, error) {
+	sub, err := u.getOwned(ctx, userID, subscriptionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	day, err := u.parseOpenDay(date, "date")
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := u.subscriptionRepo.GetPlan(ctx, sub.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Day(day.Weekday()) == nil {
+		return nil, fmt.Errorf("%w: there is no tiffin on %s", ErrInvalidSubscription, day.Weekday())
+	}
+
+	if err := u.subscriptionRepo.AddSkip(ctx, subscriptionID, day); err != nil {
+		return nil, err
+	}
+
+	return u.GetSubscription(ctx, userID, subscriptionID, false)
+}
+
+// UnskipDay restores the tiffin of a skipped day
+func (u *SubscriptionUsecase) UnskipDay(ctx context.Context, userID, subscriptionID uuid.UUID, date string) (*domain.Subscription, error) {
+	if _, err := u.getOwned(ctx, userID, subscriptionID, false); err != nil {
+		return nil, err
+	}
+
+	day, err := u.parseOpenDay(date, "date")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.subscriptionRepo.RemoveSkip(ctx, subscriptionID, day); err != nil {
+		return nil, err
+	}
+
+	return u.GetSubscription(ctx, userID, subscriptionID, false)
+}
+
+// Cancel stops a subscription and refunds the meals not yet delivered.
+// Cancelling again retries any refund the gateway rejected.
+func (u *SubscriptionUsecase) Cancel(ctx context.Context, userID, subscriptionID uuid.UUID, version int, isAdmin bool) (*domain.Subscription, error) {
+	sub, err := u.getOwned(ctx, userID, subscriptionID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if sub.Status != domain.SubscriptionCancelled {
+		refunds, err := u.subscriptionRepo.Cancel(ctx, subscriptionID, version)
+		if err != nil && !errors.Is(err, repository.ErrSubscriptionClosed) {
+			return nil, err
+		}
+
+		u.log.Info("Subscription cancelled",
+			"subscription_id", subscriptionID.String(),
+			"by", userID.String(),
+			"refunds", len(refunds),
+		)
+	}
+
+	u.processRefunds(ctx, subscriptionID)
+
+	return u.GetSubscription(ctx, userID, subscriptionID, isAdmin)
+}
+
+// ============================================================================
+// PAYMENT TARGET
+// ============================================================================
+
+// OnPaymentCaptured records a billing period paid through the gateway (webhook)
+func (u *SubscriptionUsecase) OnPaymentCaptured(ctx context.Context, payment GatewayPayment) (bool, error) {
+	period, err := u.subscriptionRepo.GetPeriodByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	if payment.Amount != period.Amount {
+		u.log.Error("Captured amount does not match billing period",
+			"period_id", period.ID.String(),
+			"captured", payment.Amount,
+			"amount", period.Amount,
+		)
+		return true, ErrSubscriptionPaymentMismatch
+	}
+
+	return true, u.capture(ctx, period, payment.ID)
+}
+
+// OnPaymentFailed leaves the period awaiting payment so the customer can retry
+func (u *SubscriptionUsecase) OnPaymentFailed(ctx context.Context, payment GatewayPayment) (bool, error) {
+	period, err := u.subscriptionRepo.GetPeriodByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	u.log.Warn("Billing period payment failed",
+		"period_id", period.ID.String(),
+		"subscription_id", period.SubscriptionID.String(),
+		"error_code", payment.ErrorCode,
+		"error_desc", payment.ErrorDesc,
+	)
+
+	return true, nil
+}
+
+// ============================================================================
+// SCHEDULER
+// ============================================================================
+
+// RunScheduler places the day's tiffin orders once their lock time has
+// passed, checking every few minutes until ctx is cancelled. Running it on
+// several instances is safe: each subscription gets one order per day.
+func (u *SubscriptionUsecase) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(subscriptionSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := u.MaterializeDue(ctx, time.Now()); err != nil {
+			u.log.Error("Subscription scheduler run failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaterializeDue places today's tiffin order for every subscription due,
+// once today's lock time has passed. Returns how many orders were placed.
+func (u *SubscriptionUsecase) MaterializeDue(ctx context.Context, now time.Time) (int, error) {
+	day := u.today(now)
+	if now.Before(u.lockTime(day)) {
+		return 0, nil
+	}
+
+	ids, err := u.subscriptionRepo.GetDue(ctx, day)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if now.After(day.Add(u.config.KitchenCutoff)) {
+		u.log.Warn("Placing tiffin orders after the kitchen cutoff", "date", day.Format("2006-01-02"), "count", len(ids))
+	}
+
+	menus := make(map[uuid.UUID][]domain.OrderItem) // Today's lines per plan
+	placed := 0
+	for _, id := range ids {
+		ok, err := u.materialize(ctx, id, day, menus)
+		if err != nil {
+			u.log.Error("Failed to place tiffin order", "error", err, "subscription_id", id.String())
+			continue
+		}
+		if ok {
+			placed++
+		}
+	}
+
+	u.log.Info("Tiffin orders placed", "date", day.Format("2006-01-02"), "count", placed)
+
+	return placed, nil
+}
+
+// materialize places one subscription's tiffin order for a day
+func (u *SubscriptionUsecase) materialize(ctx context.Context, id uuid.UUID, day time.Time, menus map[uuid.UUID][]domain.OrderItem) (bool, error) {
+	sub, err := u.subscriptionRepo.GetByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	lines, ok := menus[sub.PlanID]
+	if !ok {
+		lines, err = u.dayMenu(ctx, sub.PlanID, day.Weekday())
+		if err != nil {
+			return false, err
+		}
+		menus[sub.PlanID] = lines
+	}
+	if len(lines) == 0 {
+		return false, fmt.Errorf("plan %s has no dishes on %s", sub.PlanID, day.Weekday())
+	}
+
+	items := make([]domain.OrderItem, len(lines))
+	copy(items, lines)
+
+	notes := sub.Notes
+	if utf8.RuneCountInString(notes) > domain.MaxOrderNotesLength {
+		notes = string([]rune(notes)[:domain.MaxOrderNotesLength])
+	}
+
+	order := &domain.Order{
+		UserID:          sub.UserID,
+		Status:          domain.OrderStatusPaid,
+		FulfillmentType: domain.FulfillmentDelivery,
+		DeliveryAddress: sub.DeliveryAddress,
+		Notes:           notes,
+		Items:           items,
+	}
+
+	result, err := u.subscriptionRepo.Materialize(ctx, id, day, order)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotDue) || errors.Is(err, repository.ErrSubscriptionClosed) {
+			return false, nil
+		}
+		if errors.Is(err, repository.ErrOutOfStock) {
+			// Tried again on the next run, once stock is given back or topped up
+			u.log.Warn("Not enough stock for tiffin order", "subscription_id", id.String())
+			return false, nil
+		}
+		return false, err
+	}
+
+	if result.RemindRenewal {
+		u.notifier.RenewalDue(ctx, sub, result.MealsLeft)
+	}
+	if result.Expired {
+		u.notifier.Expired(ctx, sub)
+	}
+
+	return result.Order != nil, nil
+}
+
+// dayMenu prices a plan's dishes for a weekday at today's menu prices. The
+// order is prepaid, so its total is the meal's share of the period instead.
+func (u *SubscriptionUsecase) dayMenu(ctx context.Context, planID uuid.UUID, weekday time.Weekday) ([]domain.OrderItem, error) {
+	plan, err := u.subscriptionRepo.GetPlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	day := plan.Day(weekday)
+	if day == nil {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, len(day.Items))
+	for i, item := range day.Items {
+		ids[i] = item.MenuItemID
+	}
+	menuItems, err := u.menuRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch menu items: %w", err)
+	}
+	menuByID := make(map[uuid.UUID]domain.MenuItem, len(menuItems))
+	for _, menuItem := range menuItems {
+		menuByID[menuItem.ID] = menuItem
+	}
+
+	lines := make([]domain.OrderItem, 0, len(day.Items))
+	for _, item := range day.Items {
+		menuItem, ok := menuByID[item.MenuItemID]
+		if !ok {
+			u.log.Warn("Tiffin dish is no longer on the menu", "plan_id", planID.String(), "menu_item_id", item.MenuItemID.String())
+			continue
+		}
+		lines = append(lines, domain.OrderItem{
+			MenuItemID: menuItem.ID,
+			Name:       menuItem.Name,
+			Price:      menuItem.Price,
+			Quantity:   item.Quantity,
+		})
+	}
+
+	return lines, nil
+}
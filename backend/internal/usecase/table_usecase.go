@@ -0,0 +1,528 @@
+// Package usecase implements dine-in table ordering with running tabs
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"fooddelivery/internal/domain"
+	"fooddelivery/internal/repository"
+	"fooddelivery/pkg/logger"
+	"fooddelivery/pkg/redis"
+)
+
+// Table-related errors
+var (
+	ErrInvalidTableToken  = errors.New("invalid or expired table QR code")
+	ErrTableInactive      = errors.New("table is not taking orders")
+	ErrInvalidTableNumber = errors.New("table number must be positive")
+	ErrTabEmpty           = errors.New("table tab has no orders")
+	ErrTabSettled         = errors.New("table tab is already settled")
+	ErrTabPaymentMismatch = errors.New("payment does not match the table tab")
+)
+
+// TableUsecase handles dine-in QR ordering: tables, tabs, rounds and settlement
+type TableUsecase struct {
+	tableRepo      *repository.TableRepository
+	orderRepo      *repository.OrderRepository
+	billRepo       *repository.BillRepository
+	paymentUsecase *PaymentUsecase
+	redisClient    *redis.Client
+	qrSecret       []byte
+	log            *logger.Logger
+}
+
+// NewTableUsecase creates a new table usecase.
+// QR tokens are signed with qrSecret.
+func NewTableUsecase(
+	tableRepo *repository.TableRepository,
+	orderRepo *repository.OrderRepository,
+	billRepo *repository.BillRepository,
+	paymentUsecase *PaymentUsecase,
+	qrSecret string,
+	log *logger.Logger,
+) *TableUsecase {
+	return &TableUsecase{
+		tableRepo:      tableRepo,
+		orderRepo:      orderRepo,
+		billRepo:       billRepo,
+		paymentUsecase: paymentUsecase,
+		qrSecret:       []byte(qrSecret),
+		log:            log,
+	}
+}
+
+// SetRedisClient sets the Redis client (for round idempotency)
+func (u *TableUsecase) SetRedisClient(client *redis.Client) {
+	u.redisClient = client
+}
+
+// TableWithQR is the admin view of a table including the token to print as QR
+type TableWithQR struct {
+	domain.DiningTable
+	QRToken string `json:"qr_token"`
+}
+
+// ListTables returns all tables with their current QR tokens (admin)
+func (u *TableUsecase) ListTables(ctx context.Context) ([]TableWithQR, error) {
+	tables, err := u.tableRepo.ListTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]TableWithQR, 0, len(tables))
+	for _, table := range tables {
+		result = append(result, TableWithQR{DiningTable: table, QRToken: u.qrToken(&table)})
+	}
+	return result, nil
+}
+
+// CreateTable adds a table (admin)
+func (u *TableUsecase) CreateTable(ctx context.Context, number int, label string) (*TableWithQR, error) {
+	if number <= 0 {
+		return nil, ErrInvalidTableNumber
+	}
+	if label == "" {
+		label = fmt.Sprintf("Table %d", number)
+	}
+
+	table := &domain.DiningTable{Number: number, Label: label, IsActive: true}
+	if err := u.tableRepo.CreateTable(ctx, table); err != nil {
+		return nil, err
+	}
+
+	return &TableWithQR{DiningTable: *table, QRToken: u.qrToken(table)}, nil
+}
+
+// UpdateTable changes a table's label or takes it out of service (admin)
+func (u *TableUsecase) UpdateTable(ctx context.Context, id uuid.UUID, label string, isActive bool) (*TableWithQR, error) {
+	table := &domain.DiningTable{ID: id, Label: label, IsActive: isActive}
+	if err := u.tableRepo.UpdateTable(ctx, table); err != nil {
+		return nil, err
+	}
+
+	return &TableWithQR{DiningTable: *table, QRToken: u.qrToken(table)}, nil
+}
+
+// RotateQR invalidates the printed QR code of a table and returns the new token (admin)
+func (u *TableUsecase) RotateQR(ctx context.Context, id uuid.UUID) (*TableWithQR, error) {
+	table, err := u.tableRepo.RotateQR(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Table QR rotated", "table_id", id.String(), "qr_version", table.QRVersion)
+
+	return &TableWithQR{DiningTable: *table, QRToken: u.qrToken(table)}, nil
+}
+
+// qrToken signs "<table id>.<qr version>" so guests cannot forge a token
+// for another table. Format: base64url(payload) "." base64url(HMAC-SHA256).
+func (u *TableUsecase) qrToken(table *domain.DiningTable) string {
+	payload := table.ID.String() + "." + strconv.Itoa(table.QRVersion)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(u.qrSignature(payload))
+}
+
+func (u *TableUsecase) qrSignature(payload string) []byte {
+	mac := hmac.New(sha256.New, u.qrSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// parseQRToken verifies a QR token and returns the table ID and QR version
+func (u *TableUsecase) parseQRToken(token string) (uuid.UUID, int, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, u.qrSignature(string(payload))) {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+
+	idPart, versionPart, ok := strings.Cut(string(payload), ".")
+	if !ok {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+	tableID, err := uuid.Parse(idPart)
+	if err != nil {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+	version, err := strconv.Atoi(versionPart)
+	if err != nil {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+
+	return tableID, version, nil
+}
+
+// JoinTable validates a scanned QR token and returns the table's running tab,
+// opening one if the table has none. Everyone at the table shares the tab,
+// and only guests who joined it can see, order on or pay it.
+func (u *TableUsecase) JoinTable(ctx context.Context, token string, userID uuid.UUID) (*domain.TableSession, error) {
+	tableID, version, err := u.parseQRToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := u.tableRepo.GetTable(ctx, tableID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidTableToken
+		}
+		return nil, err
+	}
+
+	// Rotated QR codes stop working immediately
+	if table.QRVersion != version {
+		return nil, ErrInvalidTableToken
+	}
+	if !table.IsActive {
+		return nil, ErrTableInactive
+	}
+
+	session, err := u.tableRepo.OpenSession(ctx, table.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.loadOrders(ctx, session)
+}
+
+// GetSession returns a tab the user joined with all of its rounds
+func (u *TableUsecase) GetSession(ctx context.Context, sessionID, userID uuid.UUID) (*domain.TableSession, error) {
+	if err := u.tableRepo.CheckMember(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+
+	return u.loadSession(ctx, sessionID)
+}
+
+// loadSession returns a tab with all of its rounds
+func (u *TableUsecase) loadSession(ctx context.Context, sessionID uuid.UUID) (*domain.TableSession, error) {
+	session, err := u.tableRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.loadOrders(ctx, session)
+}
+
+// ListSessions returns tabs in the given states for the floor view (admin)
+func (u *TableUsecase) ListSessions(ctx context.Context, statuses []string) ([]domain.TableSession, error) {
+	filter := make([]domain.TableSessionStatus, 0, len(statuses))
+	for _, raw := range statuses {
+		status := domain.TableSessionStatus(strings.ToUpper(raw))
+		switch status {
+		case domain.TableSessionOpen, domain.TableSessionBillRequested, domain.TableSessionSettled:
+			filter = append(filter, status)
+		default:
+			return nil, fmt.Errorf("%w: unknown tab status %q", ErrInvalidFilter, raw)
+		}
+	}
+
+	return u.tableRepo.ListSessions(ctx, filter)
+}
+
+func (u *TableUsecase) loadOrders(ctx context.Context, session *domain.TableSession) (*domain.TableSession, error) {
+	orders, err := u.orderRepo.GetByTableSession(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	session.Orders = orders
+	return session, nil
+}
+
+// PlaceRoundRequest is a round of dishes ordered from the table
+type PlaceRoundRequest struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Items     []domain.CartItem
+	Notes     string
+}
+
+// PlaceRound adds a round to the tab. The cart is validated and priced exactly
+// like InitiateOrder, but the order goes straight to the kitchen (ON_TAB) and
+// is paid when the tab is settled.
+func (u *TableUsecase) PlaceRound(ctx context.Context, req PlaceRoundRequest) (*domain.Order, error) {
+	log := u.log.WithFields(map[string]interface{}{
+		"user_id":          req.UserID.String(),
+		"table_session_id": req.SessionID.String(),
+	})
+
+	if err := u.tableRepo.CheckMember(ctx, req.SessionID, req.UserID); err != nil {
+		return nil, err
+	}
+
+	items, notes, err := validateCart(req.Items, req.Notes)
+	if err != nil {
+		return nil, err
+	}
+
+	// A double tap on "send to kitchen" must not cook the round twice
+	cartHash := u.paymentUsecase.generateCartHash(req.UserID, items, notes, domain.FulfillmentDineIn, req.SessionID.String())
+	idempotencyKey := redis.IdempotencyPrefix + cartHash
+
+	if u.redisClient != nil {
+		var existing domain.Order
+		found, err := u.redisClient.GetJSON(ctx, idempotencyKey, &existing)
+		if err != nil {
+			log.Warn("Failed to check idempotency cache", "error", err)
+		} else if found {
+			log.Info("Returning cached round (idempotent request)", "order_id", existing.ID.String())
+			return &existing, nil
+		}
+	}
+
+	orderItems, totalAmount, err := u.paymentUsecase.priceCart(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &domain.Order{
+		UserID:          req.UserID,
+		Status:          domain.OrderStatusOnTab,
+		TotalAmount:     totalAmount,
+		FulfillmentType: domain.FulfillmentDineIn,
+		Notes:           notes,
+		Items:           orderItems,
+	}
+
+	if err := u.tableRepo.AddRound(ctx, req.SessionID, order); err != nil {
+		if errors.Is(err, repository.ErrOutOfStock) {
+			return nil, ErrItemNotAvailable
+		}
+		return nil, err
+	}
+
+	log.Info("Round added to table tab", "order_id", order.ID.String(), "amount", totalAmount)
+
+	if u.redisClient != nil {
+		if err := u.redisClient.SetJSON(ctx, idempotencyKey, order, redis.IdempotencyTTL); err != nil {
+			log.Warn("Failed to cache round for idempotency", "error", err)
+		}
+	}
+
+	return order, nil
+}
+
+// RequestBill stops new rounds and flags the tab for the floor staff
+func (u *TableUsecase) RequestBill(ctx context.Context, sessionID, userID uuid.UUID) (*domain.TableSession, error) {
+	if err := u.tableRepo.CheckMember(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := u.tableRepo.RequestBill(ctx, sessionID); err != nil {
+		if errors.Is(err, repository.ErrTabClosed) {
+			return nil, ErrTabSettled
+		}
+		return nil, err
+	}
+
+	u.log.Info("Bill requested", "table_session_id", sessionID.String())
+
+	return u.loadSession(ctx, sessionID)
+}
+
+// StartPayment creates a gateway order for the whole tab. Calling it again
+// for an unchanged tab returns the same gateway order so the guest can retry.
+func (u *TableUsecase) StartPayment(ctx context.Context, sessionID, userID uuid.UUID) (*InitiateOrderResponse, error) {
+	if err := u.tableRepo.CheckMember(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+
+	session, err := u.tableRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Status == domain.TableSessionSettled {
+		return nil, ErrTabSettled
+	}
+	if session.TotalAmount <= 0 {
+		return nil, ErrTabEmpty
+	}
+	if err := u.checkNoSplitBill(ctx, session.ID); err != nil {
+		return nil, err
+	}
+
+	razorpayOrderID := session.RazorpayOrderID
+	if razorpayOrderID == "" || session.BillAmount != session.TotalAmount {
+		razorpayOrderID, err = u.paymentUsecase.CreateGatewayOrder(session.TotalAmount, session.ID.String(), map[string]interface{}{
+			"table_session_id": session.ID.String(),
+			"table_number":     session.TableNumber,
+		})
+		if err != nil {
+			u.log.Error("Failed to create Razorpay order for table tab", "error", err, "table_session_id", session.ID.String())
+			return nil, fmt.Errorf("failed to create payment order: %w", err)
+		}
+
+		if err := u.tableRepo.StartGatewayPayment(ctx, session.ID, razorpayOrderID, session.TotalAmount, session.Version); err != nil {
+			return nil, err
+		}
+
+		u.log.Info("Table tab payment started",
+			"table_session_id", session.ID.String(),
+			"razorpay_order_id", razorpayOrderID,
+			"amount", session.TotalAmount,
+		)
+	}
+
+	return &InitiateOrderResponse{
+		ID:              session.ID,
+		RazorpayOrderID: razorpayOrderID,
+		KeyID:           u.paymentUsecase.KeyID(),
+		Amount:          session.TotalAmount,
+		Currency:        "INR",
+		Receipt:         session.ID.String(),
+		Name:            "Food Delivery",
+		Description:     fmt.Sprintf("Table %d bill", session.TableNumber),
+		FulfillmentType: domain.FulfillmentDineIn,
+	}, nil
+}
+
+// VerifyPayment settles the tab after the client's checkout success callback.
+// The webhook settles it as well; whichever arrives first wins.
+func (u *TableUsecase) VerifyPayment(ctx context.Context, sessionID, userID uuid.UUID, razorpayOrderID, paymentID, signature string) (*domain.TableSession, error) {
+	if err := u.tableRepo.CheckMember(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+
+	session, err := u.tableRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Status == domain.TableSessionSettled {
+		return u.loadOrders(ctx, session)
+	}
+
+	if razorpayOrderID == "" || razorpayOrderID != session.RazorpayOrderID {
+		return nil, ErrTabPaymentMismatch
+	}
+	if !u.paymentUsecase.VerifySignature(razorpayOrderID, paymentID, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	if err := u.settle(ctx, session, domain.SettlementGateway, session.BillAmount, paymentID, nil); err != nil {
+		return nil, err
+	}
+
+	return u.loadSession(ctx, sessionID)
+}
+
+// SettleAtCounter marks the tab as paid at the till (admin)
+func (u *TableUsecase) SettleAtCounter(ctx context.Context, sessionID, staffID uuid.UUID) (*domain.TableSession, error) {
+	session, err := u.tableRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Status == domain.TableSessionSettled {
+		return nil, ErrTabSettled
+	}
+	if err := u.checkNoSplitBill(ctx, session.ID); err != nil {
+		return nil, err
+	}
+
+	if err := u.settle(ctx, session, domain.SettlementCounter, session.TotalAmount, "", &staffID); err != nil {
+		return nil, err
+	}
+
+	return u.loadSession(ctx, sessionID)
+}
+
+// checkNoSplitBill refuses whole-tab payment while guests are paying a split bill;
+// the split has to be voided (refunding paid shares) first
+func (u *TableUsecase) checkNoSplitBill(ctx context.Context, sessionID uuid.UUID) error {
+	_, err := u.billRepo.GetActiveBySource(ctx, domain.BillSourceTableSession, sessionID)
+	if err == nil {
+		return ErrBillInProgress
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (u *TableUsecase) settle(ctx context.Context, session *domain.TableSession, method domain.SettlementMethod, amount int64, paymentID string, staffID *uuid.UUID) error {
+	if err := u.tableRepo.Settle(ctx, session.ID, method, amount, paymentID, staffID); err != nil {
+		if errors.Is(err, repository.ErrTabClosed) {
+			return ErrTabSettled
+		}
+		return fmt.Errorf("failed to settle table tab: %w", err)
+	}
+
+	u.log.Info("Table tab settled",
+		"table_session_id", session.ID.String(),
+		"table_number", session.TableNumber,
+		"method", method,
+		"amount", amount,
+	)
+
+	return nil
+}
+
+// OnPaymentCaptured settles the tab paid through the gateway (webhook)
+func (u *TableUsecase) OnPaymentCaptured(ctx context.Context, payment GatewayPayment) (bool, error) {
+	session, err := u.tableRepo.GetSessionByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	if session.Status == domain.TableSessionSettled {
+		return true, nil // Already settled by client verification
+	}
+
+	if payment.Amount != session.BillAmount {
+		u.log.Error("Captured amount does not match table bill",
+			"table_session_id", session.ID.String(),
+			"captured", payment.Amount,
+			"bill_amount", session.BillAmount,
+		)
+		return true, ErrTabPaymentMismatch
+	}
+
+	err = u.settle(ctx, session, domain.SettlementGateway, payment.Amount, payment.ID, nil)
+	if errors.Is(err, ErrTabSettled) {
+		return true, nil
+	}
+	return true, err
+}
+
+// OnPaymentFailed records a failed tab payment. The tab stays open for
+// payment so the guest can retry or pay at the counter.
+func (u *TableUsecase) OnPaymentFailed(ctx context.Context, payment GatewayPayment) (bool, error) {
+	session, err := u.tableRepo.GetSessionByRazorpayOrderID(ctx, payment.RazorpayOrderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return true, err
+	}
+
+	u.log.Warn("Table tab payment failed",
+		"table_session_id", session.ID.String(),
+		"error_code", payment.ErrorCode,
+		"error_desc", payment.ErrorDesc,
+	)
+
+	return true, nil
+}
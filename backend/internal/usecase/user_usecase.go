@@ -27,14 +27,19 @@ var (
 	ErrInvalidPassword  = errors.New("invalid password")
 	ErrWeakPassword     = errors.New("password must be at least 8 characters")
 	ErrInvalidEmail     = errors.New("invalid email address")
+	ErrInvalidLanguage  = errors.New("language must be en or te")
 )
 
+// otpValidity is how long a login code can be used
+const otpValidity = 10 * time.Minute
+
 // UserUsecase handles user-related business logic
 type UserUsecase struct {
-	userRepo  *repository.UserRepository
-	jwtSecret string
-	jwtExpiry time.Duration
-	log       *logger.Logger
+	userRepo      *repository.UserRepository
+	notifications *NotificationUsecase
+	jwtSecret     string
+	jwtExpiry     time.Duration
+	log           *logger.Logger
 }
 
 // NewUserUsecase creates a new user usecase
@@ -53,12 +58,19 @@ func (u *UserUsecase) SetJWTConfig(secret string, expiryHours int) {
 	u.jwtExpiry = time.Duration(expiryHours) * time.Hour
 }
 
+// SetNotifications enables sending login codes by SMS. Without it codes are
+// only logged, for local development.
+func (u *UserUsecase) SetNotifications(notifications *NotificationUsecase) {
+	u.notifications = notifications
+}
+
 // RegisterRequest contains registration data
 type RegisterRequest struct {
 	PhoneNumber string `json:"phone_number"`
 	Name        string `json:"name"`
 	Email       string `json:"email"`
 	Password    string `json:"password"`
+	Language    string `json:"language"` // Notification language, en (default) or te
 }
 
 // RegisterResponse contains registration result
@@ -78,6 +90,14 @@ func (u *UserUsecase) Register(ctx context.Context, req RegisterRequest) (*Regis
 		return nil, ErrWeakPassword
 	}
 
+	language := domain.LanguageEnglish
+	if req.Language != "" {
+		language = domain.Language(req.Language)
+		if !language.IsValid() {
+			return nil, ErrInvalidLanguage
+		}
+	}
+
 	// Check if user with email exists
 	existingEmail, err := u.userRepo.GetByEmail(ctx, req.Email)
 	if err == nil && existingEmail != nil {
@@ -108,6 +128,7 @@ func (u *UserUsecase) Register(ctx context.Context, req RegisterRequest) (*Regis
 		Name:          req.Name,
 		Email:         req.Email,
 		PasswordHash:  string(passwordHash),
+		Language:      language,
 		EmailVerified: false,
 		IsAdmin:       false,
 		CreatedAt:     now,
@@ -374,7 +395,7 @@ func (u *UserUsecase) SendOTP(ctx context.Context, req PhoneLoginRequest) (*Send
 		PhoneNumber: &req.PhoneNumber,
 		OTPCode:     otpCode,
 		Purpose:     domain.OTPPurposeLogin,
-		ExpiresAt:   time.Now().Add(10 * time.Minute),
+		ExpiresAt:   time.Now().Add(otpValidity),
 		IsVerified:  false,
 		Attempts:    0,
 		CreatedAt:   time.Now(),
@@ -384,8 +405,11 @@ func (u *UserUsecase) SendOTP(ctx context.Context, req PhoneLoginRequest) (*Send
 		return nil, fmt.Errorf("failed to store OTP: %w", err)
 	}
 
-	// In production: Send OTP via SMS service (Twilio, AWS SNS, etc.)
-	u.log.Info("OTP generated", "user_id", user.ID.String(), "phone", req.PhoneNumber, "otp", otpCode)
+	if u.notifications == nil {
+		u.log.Info("OTP generated", "user_id", user.ID.String(), "phone", req.PhoneNumber, "otp", otpCode)
+	} else if err := u.notifications.SendOTP(ctx, user, otpCode, otpValidity); err != nil {
+		return nil, fmt.Errorf("failed to send OTP: %w", err)
+	}
 
 	return &SendOTPResponse{
 		Message: "OTP sent to your phone number",
@@ -0,0 +1,15 @@
+-- Migration: 004_order_notes
+-- Description: Free-text special instructions on orders and order items
+-- Date: 2024-02-05
+
+-- Order-level instructions (e.g. "ring the bell, don't knock")
+-- Sanitised and length-limited by the application; CHECK is a safety net
+ALTER TABLE orders ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD CONSTRAINT orders_notes_length CHECK (char_length(notes) <= 500);
+
+-- Line-level instructions (e.g. "less spicy, no onion")
+ALTER TABLE order_items ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD CONSTRAINT order_items_notes_length CHECK (char_length(notes) <= 200);
+
+COMMENT ON COLUMN orders.notes IS 'Customer special instructions for the whole order (max 500 chars)';
+COMMENT ON COLUMN order_items.notes IS 'Customer special instructions for this line (max 200 chars)';
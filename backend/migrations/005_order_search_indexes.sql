@@ -0,0 +1,16 @@
+-- Migration: 005_order_search_indexes
+-- Description: Indexes for admin order search with keyset pagination
+-- Date: 2024-02-12
+
+-- Keyset pagination walks (sort column, id) in both directions
+CREATE INDEX idx_orders_created_at_id ON orders(created_at, id);
+CREATE INDEX idx_orders_updated_at_id ON orders(updated_at, id);
+
+-- Status tab + newest first is the default admin view
+CREATE INDEX idx_orders_status_created_at ON orders(status, created_at, id);
+
+-- Amount range filters
+CREATE INDEX idx_orders_total_amount ON orders(total_amount);
+
+-- Customer lookup by email is case-insensitive
+CREATE INDEX idx_users_email_lower ON users(LOWER(email));
@@ -0,0 +1,6 @@
+-- Migration: 006_order_history_index
+-- Description: Index for cursor-paginated customer order history
+-- Date: 2024-02-14
+
+-- Customer history pages newest first by (created_at, id) within a user
+CREATE INDEX idx_orders_user_created_at_id ON orders(user_id, created_at DESC, id DESC);
@@ -0,0 +1,31 @@
+-- Migration: 007_fulfillment
+-- Description: Fulfillment types (delivery, pickup, dine-in) and the pickup status path
+-- Date: 2024-02-19
+
+CREATE TYPE fulfillment_type AS ENUM ('delivery', 'pickup', 'dine_in');
+
+-- Pickup orders go PAID -> ACCEPTED -> READY_FOR_PICKUP -> COLLECTED
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'READY_FOR_PICKUP';
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'COLLECTED';
+
+ALTER TABLE orders ADD COLUMN fulfillment_type fulfillment_type NOT NULL DEFAULT 'delivery';
+ALTER TABLE orders ADD COLUMN delivery_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN delivery_fee INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN pickup_code VARCHAR(8);
+
+ALTER TABLE orders ADD CONSTRAINT orders_delivery_fee_non_negative CHECK (delivery_fee >= 0);
+ALTER TABLE orders ADD CONSTRAINT orders_delivery_address_length CHECK (char_length(delivery_address) <= 500);
+ALTER TABLE orders ADD CONSTRAINT orders_pickup_code_required
+    CHECK (fulfillment_type <> 'pickup' OR pickup_code IS NOT NULL);
+
+-- Counter lookup by pickup code; codes are short so they are only unique among active orders
+CREATE INDEX idx_orders_pickup_code ON orders(pickup_code) WHERE pickup_code IS NOT NULL;
+
+-- Orders are created before the gateway order exists; store NULL rather than ''
+-- so the UNIQUE constraint on razorpay_order_id does not collide
+UPDATE orders SET razorpay_order_id = NULL WHERE razorpay_order_id = '';
+
+COMMENT ON COLUMN orders.fulfillment_type IS 'How the order reaches the customer: delivery, pickup or dine_in';
+COMMENT ON COLUMN orders.delivery_address IS 'Delivery address snapshot (delivery orders only)';
+COMMENT ON COLUMN orders.delivery_fee IS 'Delivery fee in paisa, included in total_amount';
+COMMENT ON COLUMN orders.pickup_code IS 'Short code the customer quotes at the counter (pickup orders only)';
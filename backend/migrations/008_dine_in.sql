@@ -0,0 +1,97 @@
+-- Migration: 008_dine_in
+-- Description: Dine-in QR table ordering with running table tabs
+-- Date: 2024-02-26
+
+-- Dine-in rounds go to the kitchen unpaid; the whole tab is settled at the end
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'ON_TAB';
+
+CREATE TYPE table_session_status AS ENUM ('OPEN', 'BILL_REQUESTED', 'SETTLED');
+
+-- ============================================================================
+-- DINING TABLES
+-- ============================================================================
+
+CREATE TABLE dining_tables (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    number INTEGER NOT NULL,
+    label VARCHAR(50) NOT NULL DEFAULT '',
+
+    -- Part of the signed QR token; bumping it invalidates printed QR codes
+    qr_version INTEGER NOT NULL DEFAULT 1,
+
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT dining_tables_number_positive CHECK (number > 0),
+    CONSTRAINT dining_tables_number_unique UNIQUE (number)
+);
+
+CREATE TRIGGER trigger_dining_tables_updated_at
+    BEFORE UPDATE ON dining_tables
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- TABLE SESSIONS (one running tab per seating)
+-- ============================================================================
+
+CREATE TABLE table_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    table_id UUID NOT NULL REFERENCES dining_tables(id) ON DELETE RESTRICT,
+    status table_session_status NOT NULL DEFAULT 'OPEN',
+
+    -- Tab total in PAISA, fixed when online payment starts or the tab is settled
+    bill_amount INTEGER NOT NULL DEFAULT 0,
+
+    -- How the tab was settled: 'gateway' (Razorpay) or 'counter' (cash/card at the till)
+    settlement_method VARCHAR(20),
+    razorpay_order_id VARCHAR(50),
+    razorpay_payment_id VARCHAR(50),
+    settled_by UUID REFERENCES users(id) ON DELETE SET NULL,
+
+    version INTEGER NOT NULL DEFAULT 1,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    bill_requested_at TIMESTAMP WITH TIME ZONE,
+    settled_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT table_sessions_bill_amount_non_negative CHECK (bill_amount >= 0),
+    CONSTRAINT table_sessions_settlement_method CHECK (settlement_method IN ('gateway', 'counter')),
+    CONSTRAINT table_sessions_razorpay_order_id_unique UNIQUE (razorpay_order_id)
+);
+
+-- At most one running tab per table
+CREATE UNIQUE INDEX idx_table_sessions_one_open ON table_sessions(table_id) WHERE status <> 'SETTLED';
+
+CREATE INDEX idx_table_sessions_status ON table_sessions(status);
+
+CREATE TRIGGER trigger_table_sessions_updated_at
+    BEFORE UPDATE ON table_sessions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- ORDERS
+-- ============================================================================
+
+ALTER TABLE orders ADD COLUMN table_session_id UUID REFERENCES table_sessions(id) ON DELETE RESTRICT;
+ALTER TABLE orders ADD CONSTRAINT orders_dine_in_session
+    CHECK (fulfillment_type <> 'dine_in' OR table_session_id IS NOT NULL);
+
+CREATE INDEX idx_orders_table_session_id ON orders(table_session_id) WHERE table_session_id IS NOT NULL;
+
+-- When the order was paid for: on capture for regular orders, on settlement for dine-in rounds
+ALTER TABLE orders ADD COLUMN paid_at TIMESTAMP WITH TIME ZONE;
+UPDATE orders SET paid_at = updated_at
+WHERE paid_at IS NULL AND status IN ('PAID', 'ACCEPTED', 'DELIVERED', 'READY_FOR_PICKUP', 'COLLECTED');
+
+-- Eight tables on the floor
+INSERT INTO dining_tables (number, label)
+SELECT n, 'Table ' || n FROM generate_series(1, 8) AS n
+ON CONFLICT (number) DO NOTHING;
+
+COMMENT ON TABLE dining_tables IS 'Restaurant tables; guests order by scanning a signed QR code';
+COMMENT ON TABLE table_sessions IS 'Running tab grouping all dine-in orders of one seating';
+COMMENT ON COLUMN orders.table_session_id IS 'Table tab this dine-in round belongs to';
+COMMENT ON COLUMN orders.paid_at IS 'When payment was captured or the table tab was settled';
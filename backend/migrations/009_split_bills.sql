@@ -0,0 +1,133 @@
+-- Migration: 009_split_bills
+-- Description: Split settlement of table tabs and orders into separately paid shares, and refunds
+-- Date: 2024-03-04
+
+CREATE TYPE bill_status AS ENUM ('OPEN', 'PAID', 'VOIDED');
+CREATE TYPE bill_share_status AS ENUM ('PENDING', 'PAID', 'FAILED', 'REFUND_PENDING', 'REFUNDED', 'CANCELLED');
+CREATE TYPE refund_status AS ENUM ('PENDING', 'PROCESSED', 'FAILED');
+
+-- ============================================================================
+-- BILLS (one logical bill split into shares)
+-- ============================================================================
+
+CREATE TABLE bills (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+
+    -- What is being paid: a table tab or a single (group) order
+    source_type VARCHAR(20) NOT NULL,
+    source_id UUID NOT NULL,
+
+    split_mode VARCHAR(10) NOT NULL,
+    total_amount INTEGER NOT NULL,
+    status bill_status NOT NULL DEFAULT 'OPEN',
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    paid_at TIMESTAMP WITH TIME ZONE,
+    voided_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT bills_source_type CHECK (source_type IN ('table_session', 'order')),
+    CONSTRAINT bills_split_mode CHECK (split_mode IN ('equal', 'items', 'custom')),
+    CONSTRAINT bills_total_amount_positive CHECK (total_amount > 0)
+);
+
+-- One live split per tab or order; voided bills are kept for the audit trail
+CREATE UNIQUE INDEX idx_bills_one_active ON bills(source_type, source_id) WHERE status <> 'VOIDED';
+
+CREATE TRIGGER trigger_bills_updated_at
+    BEFORE UPDATE ON bills
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- BILL SHARES (each paid through its own Razorpay order)
+-- ============================================================================
+
+CREATE TABLE bill_shares (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    bill_id UUID NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    label VARCHAR(50) NOT NULL DEFAULT '',
+    amount INTEGER NOT NULL,
+    status bill_share_status NOT NULL DEFAULT 'PENDING',
+    razorpay_order_id VARCHAR(50),
+    razorpay_payment_id VARCHAR(50),
+    paid_at TIMESTAMP WITH TIME ZONE,
+    refunded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT bill_shares_amount_positive CHECK (amount > 0),
+    CONSTRAINT bill_shares_position_unique UNIQUE (bill_id, position),
+    CONSTRAINT bill_shares_razorpay_order_id_unique UNIQUE (razorpay_order_id),
+    CONSTRAINT bill_shares_razorpay_payment_id_unique UNIQUE (razorpay_payment_id)
+);
+
+CREATE INDEX idx_bill_shares_bill_id ON bill_shares(bill_id);
+
+CREATE TRIGGER trigger_bill_shares_updated_at
+    BEFORE UPDATE ON bill_shares
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Items a share pays for when splitting by items
+CREATE TABLE bill_share_items (
+    share_id UUID NOT NULL REFERENCES bill_shares(id) ON DELETE CASCADE,
+    order_item_id UUID NOT NULL REFERENCES order_items(id) ON DELETE RESTRICT,
+    quantity INTEGER NOT NULL,
+    amount INTEGER NOT NULL,
+
+    PRIMARY KEY (share_id, order_item_id),
+    CONSTRAINT bill_share_items_quantity_positive CHECK (quantity > 0)
+);
+
+-- ============================================================================
+-- REFUNDS (any money returned through the gateway)
+-- ============================================================================
+
+CREATE TABLE refunds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+
+    -- Order the money relates to, if any
+    order_id UUID REFERENCES orders(id) ON DELETE RESTRICT,
+
+    -- What caused the refund, e.g. 'bill_share' with the share ID
+    source VARCHAR(30) NOT NULL,
+    source_id UUID NOT NULL,
+
+    razorpay_payment_id VARCHAR(50) NOT NULL,
+    razorpay_refund_id VARCHAR(50),
+    amount INTEGER NOT NULL,
+    status refund_status NOT NULL DEFAULT 'PENDING',
+    reason TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT refunds_amount_positive CHECK (amount > 0),
+    CONSTRAINT refunds_razorpay_refund_id_unique UNIQUE (razorpay_refund_id),
+    -- A payment is refunded at most once per cause
+    CONSTRAINT refunds_source_unique UNIQUE (source, source_id)
+);
+
+CREATE INDEX idx_refunds_order_id ON refunds(order_id) WHERE order_id IS NOT NULL;
+CREATE INDEX idx_refunds_status ON refunds(status) WHERE status <> 'PROCESSED';
+
+CREATE TRIGGER trigger_refunds_updated_at
+    BEFORE UPDATE ON refunds
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Tabs paid through a split bill
+ALTER TABLE table_sessions DROP CONSTRAINT table_sessions_settlement_method;
+ALTER TABLE table_sessions ADD CONSTRAINT table_sessions_settlement_method
+    CHECK (settlement_method IN ('gateway', 'counter', 'split'));
+
+COMMENT ON TABLE bills IS 'A table tab or order settled in several separately paid shares';
+COMMENT ON TABLE bill_shares IS 'One guest''s part of a split bill, paid through its own Razorpay order';
+COMMENT ON TABLE refunds IS 'Gateway refunds with their cause; retried until processed';
@@ -0,0 +1,76 @@
+-- Migration: 010_group_carts
+-- Description: Shared group carts filled by several users and checked out by the host
+-- Date: 2024-03-11
+
+CREATE TYPE group_cart_status AS ENUM ('OPEN', 'LOCKED', 'CHECKED_OUT', 'CANCELLED');
+
+-- ============================================================================
+-- GROUP CARTS
+-- ============================================================================
+
+CREATE TABLE group_carts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    host_id UUID NOT NULL REFERENCES users(id),
+
+    -- Shared in the invite link
+    invite_code VARCHAR(16) NOT NULL,
+
+    status group_cart_status NOT NULL DEFAULT 'OPEN',
+    notes TEXT NOT NULL DEFAULT '',
+
+    -- Order placed at checkout
+    order_id UUID REFERENCES orders(id),
+
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    CONSTRAINT group_carts_invite_code_unique UNIQUE (invite_code),
+    CONSTRAINT group_carts_notes_length CHECK (char_length(notes) <= 500)
+);
+
+CREATE INDEX idx_group_carts_host ON group_carts(host_id, created_at DESC);
+
+CREATE TRIGGER trigger_group_carts_updated_at
+    BEFORE UPDATE ON group_carts
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE group_cart_members (
+    cart_id UUID NOT NULL REFERENCES group_carts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (cart_id, user_id)
+);
+
+-- Each line belongs to the member who added it
+CREATE TABLE group_cart_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    cart_id UUID NOT NULL REFERENCES group_carts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    menu_item_id UUID NOT NULL REFERENCES menu_items(id),
+    quantity INTEGER NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT group_cart_items_quantity_positive CHECK (quantity > 0),
+    CONSTRAINT group_cart_items_notes_length CHECK (char_length(notes) <= 200)
+);
+
+CREATE INDEX idx_group_cart_items_cart ON group_cart_items(cart_id, created_at);
+
+CREATE TRIGGER trigger_group_cart_items_updated_at
+    BEFORE UPDATE ON group_cart_items
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Who added each line of an order placed from a group cart
+ALTER TABLE order_items ADD COLUMN added_by UUID REFERENCES users(id);
+
+COMMENT ON TABLE group_carts IS 'Shared carts: members add items, the host locks the cart and checks out';
+COMMENT ON COLUMN order_items.added_by IS 'Group cart member who added the line, NULL for normal orders';
@@ -0,0 +1,72 @@
+-- Migration: 011_order_modifications
+-- Description: Customer edits of paid orders before the kitchen accepts them, with order content history
+-- Date: 2024-03-18
+
+CREATE TYPE order_modification_status AS ENUM ('PENDING_PAYMENT', 'APPLIED', 'CANCELLED', 'REJECTED');
+
+-- ============================================================================
+-- ORDER MODIFICATIONS (one edit of a paid order)
+-- ============================================================================
+
+CREATE TABLE order_modifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+
+    -- orders.version the edit was made against; the edit is only applied
+    -- if the order has not changed since (e.g. accepted by the kitchen)
+    base_version INTEGER NOT NULL,
+
+    status order_modification_status NOT NULL,
+
+    -- New contents: priced order lines as JSON
+    items JSONB NOT NULL,
+    old_total INTEGER NOT NULL,
+    new_total INTEGER NOT NULL,
+
+    -- Difference collected through a separate gateway order
+    razorpay_order_id VARCHAR(50),
+    razorpay_payment_id VARCHAR(50),
+
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    applied_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT order_modifications_new_total_positive CHECK (new_total > 0),
+    CONSTRAINT order_modifications_razorpay_order_unique UNIQUE (razorpay_order_id)
+);
+
+CREATE INDEX idx_order_modifications_order ON order_modifications(order_id, created_at);
+
+-- At most one edit waiting for payment per order
+CREATE UNIQUE INDEX idx_order_modifications_one_pending
+    ON order_modifications(order_id)
+    WHERE status = 'PENDING_PAYMENT';
+
+CREATE TRIGGER trigger_order_modifications_updated_at
+    BEFORE UPDATE ON order_modifications
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- ORDER REVISIONS (versioned history of order contents)
+-- ============================================================================
+
+CREATE TABLE order_revisions (
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+
+    items JSONB NOT NULL,
+    total_amount INTEGER NOT NULL,
+
+    -- Edit that produced this revision; NULL for the original contents
+    modification_id UUID REFERENCES order_modifications(id),
+
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (order_id, revision)
+);
+
+COMMENT ON TABLE order_modifications IS 'Customer edits of paid orders, applied only while the order is still PAID';
+COMMENT ON TABLE order_revisions IS 'Snapshot of order contents after every applied edit, revision 1 being the original';
@@ -0,0 +1,94 @@
+-- Migration: 012_reviews
+-- Description: Ratings and reviews for delivered orders and their items, with moderation and menu rating aggregates
+-- Date: 2024-03-25
+
+CREATE TYPE review_status AS ENUM ('VISIBLE', 'FLAGGED', 'HIDDEN');
+
+-- ============================================================================
+-- MENU RATING AGGREGATES
+-- ============================================================================
+
+-- Maintained incrementally with every review and moderation change, so the
+-- menu never has to aggregate reviews when it is read
+ALTER TABLE menu_items
+    ADD COLUMN rating_sum BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN rating_count INTEGER NOT NULL DEFAULT 0,
+    ADD CONSTRAINT menu_items_rating_count_non_negative CHECK (rating_count >= 0);
+
+-- ============================================================================
+-- ORDER REVIEWS (one per order)
+-- ============================================================================
+
+CREATE TABLE order_reviews (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+
+    food_rating SMALLINT NOT NULL,
+    -- Delivery orders only
+    delivery_rating SMALLINT,
+    comment TEXT NOT NULL DEFAULT '',
+    photo_urls TEXT[] NOT NULL DEFAULT '{}',
+
+    -- HIDDEN reviews are not shown and not counted; FLAGGED ones await a look
+    status review_status NOT NULL DEFAULT 'VISIBLE',
+    moderation_note TEXT,
+    moderated_by UUID REFERENCES users(id),
+    moderated_at TIMESTAMP WITH TIME ZONE,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT order_reviews_order_unique UNIQUE (order_id),
+    CONSTRAINT order_reviews_food_rating_range CHECK (food_rating BETWEEN 1 AND 5),
+    CONSTRAINT order_reviews_delivery_rating_range CHECK (delivery_rating IS NULL OR delivery_rating BETWEEN 1 AND 5)
+);
+
+-- Moderation queue
+CREATE INDEX idx_order_reviews_status ON order_reviews(status, created_at DESC);
+
+CREATE TRIGGER trigger_order_reviews_updated_at
+    BEFORE UPDATE ON order_reviews
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- ITEM REVIEWS (one per order line)
+-- ============================================================================
+
+CREATE TABLE item_reviews (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    review_id UUID NOT NULL REFERENCES order_reviews(id) ON DELETE CASCADE,
+    order_item_id UUID NOT NULL REFERENCES order_items(id) ON DELETE RESTRICT,
+    menu_item_id UUID NOT NULL REFERENCES menu_items(id) ON DELETE RESTRICT,
+
+    rating SMALLINT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    photo_urls TEXT[] NOT NULL DEFAULT '{}',
+
+    -- Counted in the menu item's rating unless this or its order review is HIDDEN
+    status review_status NOT NULL DEFAULT 'VISIBLE',
+    moderation_note TEXT,
+    moderated_by UUID REFERENCES users(id),
+    moderated_at TIMESTAMP WITH TIME ZONE,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT item_reviews_order_item_unique UNIQUE (order_item_id),
+    CONSTRAINT item_reviews_rating_range CHECK (rating BETWEEN 1 AND 5)
+);
+
+CREATE INDEX idx_item_reviews_review ON item_reviews(review_id);
+
+-- Public reviews of a menu item, newest first
+CREATE INDEX idx_item_reviews_menu_item ON item_reviews(menu_item_id, created_at DESC, id DESC)
+    WHERE status <> 'HIDDEN';
+
+CREATE TRIGGER trigger_item_reviews_updated_at
+    BEFORE UPDATE ON item_reviews
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE order_reviews IS 'Customer rating of a delivered order; hidden reviews stay for the record';
+COMMENT ON TABLE item_reviews IS 'Customer rating of one order line, aggregated into menu_items.rating_sum/rating_count';
@@ -0,0 +1,76 @@
+-- Migration: 013_catering
+-- Description: Catering and bulk order requests with admin quotes, an advance and a later balance paid as linked orders
+-- Date: 2024-04-01
+
+CREATE TYPE catering_status AS ENUM ('REQUESTED', 'QUOTED', 'ACCEPTED', 'DECLINED', 'CANCELLED');
+
+-- ============================================================================
+-- CATERING REQUESTS
+-- ============================================================================
+
+CREATE TABLE catering_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+
+    -- What the customer asked for
+    event_date DATE NOT NULL,
+    headcount INTEGER NOT NULL,
+    venue TEXT NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    items JSONB NOT NULL, -- Requested lines priced at the menu price of the day
+
+    status catering_status NOT NULL DEFAULT 'REQUESTED',
+
+    -- Admin's quote: lines with overridden prices and the share paid up front
+    quote_lines JSONB,
+    quote_total INTEGER,
+    advance_percent SMALLINT,
+    advance_amount INTEGER,
+    quote_note TEXT NOT NULL DEFAULT '',
+    quote_valid_until TIMESTAMP WITH TIME ZONE,
+    quoted_by UUID REFERENCES users(id),
+    quoted_at TIMESTAMP WITH TIME ZONE,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+
+    -- Orders collecting the advance and the balance (see orders.catering_request_id)
+    advance_order_id UUID,
+    balance_order_id UUID,
+
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT catering_requests_headcount_positive CHECK (headcount > 0),
+    CONSTRAINT catering_requests_notes_length CHECK (char_length(notes) <= 500),
+    CONSTRAINT catering_requests_venue_length CHECK (char_length(venue) <= 500),
+    CONSTRAINT catering_requests_quote_total_positive CHECK (quote_total IS NULL OR quote_total > 0),
+    CONSTRAINT catering_requests_advance_percent_range CHECK (advance_percent IS NULL OR advance_percent BETWEEN 1 AND 100),
+    CONSTRAINT catering_requests_quoted CHECK (
+        status NOT IN ('QUOTED', 'ACCEPTED') OR (quote_total IS NOT NULL AND advance_amount IS NOT NULL)
+    )
+);
+
+CREATE INDEX idx_catering_requests_user ON catering_requests(user_id, created_at DESC);
+CREATE INDEX idx_catering_requests_status ON catering_requests(status, event_date);
+
+CREATE TRIGGER trigger_catering_requests_updated_at
+    BEFORE UPDATE ON catering_requests
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- ORDERS
+-- ============================================================================
+
+-- Advance and balance payments are regular orders without lines, paid through
+-- the usual order payment flow; the food is on the catering request
+ALTER TABLE orders ADD COLUMN catering_request_id UUID REFERENCES catering_requests(id) ON DELETE RESTRICT;
+
+CREATE INDEX idx_orders_catering_request_id ON orders(catering_request_id) WHERE catering_request_id IS NOT NULL;
+
+ALTER TABLE catering_requests
+    ADD CONSTRAINT catering_requests_advance_order_fk FOREIGN KEY (advance_order_id) REFERENCES orders(id),
+    ADD CONSTRAINT catering_requests_balance_order_fk FOREIGN KEY (balance_order_id) REFERENCES orders(id);
+
+COMMENT ON TABLE catering_requests IS 'Event orders quoted by hand; paid as an advance order and a balance order';
+COMMENT ON COLUMN orders.catering_request_id IS 'Catering request this advance or balance payment belongs to';
@@ -0,0 +1,151 @@
+-- Migration: 014_subscriptions
+-- Description: Tiffin meal plans with prepaid billing periods, pauses, skips and daily scheduled orders
+-- Date: 2024-04-08
+
+CREATE TYPE subscription_status AS ENUM ('PENDING_PAYMENT', 'ACTIVE', 'EXPIRED', 'CANCELLED');
+CREATE TYPE subscription_period_status AS ENUM ('PENDING', 'PAID', 'CANCELLED');
+
+-- ============================================================================
+-- MEAL PLANS
+-- ============================================================================
+
+CREATE TABLE meal_plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+
+    -- One billing period: this many meals for this price
+    meals INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT meal_plans_name_not_empty CHECK (LENGTH(TRIM(name)) > 0),
+    CONSTRAINT meal_plans_meals_positive CHECK (meals > 0),
+    CONSTRAINT meal_plans_price_covers_meals CHECK (price >= meals)
+);
+
+CREATE TRIGGER trigger_meal_plans_updated_at
+    BEFORE UPDATE ON meal_plans
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Menu of a plan per weekday; weekdays without a row are not delivered
+CREATE TABLE meal_plan_days (
+    plan_id UUID NOT NULL REFERENCES meal_plans(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL, -- 0 = Sunday
+    items JSONB NOT NULL,      -- [{menu_item_id, name, quantity}]
+
+    PRIMARY KEY (plan_id, weekday),
+    CONSTRAINT meal_plan_days_weekday_range CHECK (weekday BETWEEN 0 AND 6)
+);
+
+-- ============================================================================
+-- SUBSCRIPTIONS
+-- ============================================================================
+
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    plan_id UUID NOT NULL REFERENCES meal_plans(id) ON DELETE RESTRICT,
+
+    status subscription_status NOT NULL DEFAULT 'PENDING_PAYMENT',
+    start_date DATE NOT NULL,
+
+    -- Pause: no deliveries from paused_from, until paused_until (inclusive) or resumed
+    paused_from DATE,
+    paused_until DATE,
+
+    delivery_address TEXT NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT subscriptions_delivery_address_length CHECK (char_length(delivery_address) BETWEEN 1 AND 500),
+    CONSTRAINT subscriptions_notes_length CHECK (char_length(notes) <= 500),
+    CONSTRAINT subscriptions_pause_range CHECK (
+        paused_until IS NULL OR (paused_from IS NOT NULL AND paused_until >= paused_from)
+    )
+);
+
+CREATE INDEX idx_subscriptions_user ON subscriptions(user_id, created_at DESC);
+CREATE INDEX idx_subscriptions_active ON subscriptions(plan_id) WHERE status = 'ACTIVE';
+
+CREATE TRIGGER trigger_subscriptions_updated_at
+    BEFORE UPDATE ON subscriptions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Prepaid billing periods: meal credits paid through the gateway, used oldest first
+CREATE TABLE subscription_periods (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE RESTRICT,
+    number INTEGER NOT NULL,
+
+    status subscription_period_status NOT NULL DEFAULT 'PENDING',
+    amount INTEGER NOT NULL,
+    meals INTEGER NOT NULL,
+    meals_used INTEGER NOT NULL DEFAULT 0,
+
+    razorpay_order_id VARCHAR(50),
+    razorpay_payment_id VARCHAR(50),
+    paid_at TIMESTAMP WITH TIME ZONE,
+
+    -- Renewal reminder sent while this was the last paid period
+    renewal_notified_at TIMESTAMP WITH TIME ZONE,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT subscription_periods_number_unique UNIQUE (subscription_id, number),
+    CONSTRAINT subscription_periods_razorpay_order_unique UNIQUE (razorpay_order_id),
+    CONSTRAINT subscription_periods_amount_covers_meals CHECK (amount >= meals AND meals > 0),
+    CONSTRAINT subscription_periods_meals_used_range CHECK (meals_used BETWEEN 0 AND meals)
+);
+
+-- At most one period waiting for payment per subscription
+CREATE UNIQUE INDEX idx_subscription_periods_one_pending
+    ON subscription_periods(subscription_id)
+    WHERE status = 'PENDING';
+
+CREATE TRIGGER trigger_subscription_periods_updated_at
+    BEFORE UPDATE ON subscription_periods
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Single days the customer does not want a tiffin
+CREATE TABLE subscription_skips (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    skip_date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (subscription_id, skip_date)
+);
+
+-- ============================================================================
+-- DAILY ORDERS
+-- ============================================================================
+
+ALTER TABLE orders ADD COLUMN subscription_id UUID REFERENCES subscriptions(id) ON DELETE RESTRICT;
+
+-- One tiffin per subscription and day; the meal is taken from period_id
+CREATE TABLE subscription_deliveries (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE RESTRICT,
+    delivery_date DATE NOT NULL,
+    period_id UUID NOT NULL REFERENCES subscription_periods(id) ON DELETE RESTRICT,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (subscription_id, delivery_date)
+);
+
+CREATE INDEX idx_orders_subscription_id ON orders(subscription_id) WHERE subscription_id IS NOT NULL;
+
+COMMENT ON TABLE subscription_periods IS 'Prepaid meal credits of a subscription; renewals add periods';
+COMMENT ON TABLE subscription_deliveries IS 'Orders materialised by the scheduler, one per subscription and day';
+COMMENT ON COLUMN orders.subscription_id IS 'Subscription this prepaid tiffin order was materialised for';
@@ -0,0 +1,42 @@
+-- Migration: 015_outbox
+-- Description: Transactional outbox of domain events and relay consumer offsets
+-- Date: 2024-04-15
+
+-- ============================================================================
+-- OUTBOX
+-- ============================================================================
+
+-- Events are inserted in the same transaction as the change they describe, so
+-- an event exists if and only if its change was committed
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- Transaction that wrote the event. Events are relayed in (tx_id, id) order,
+    -- and only once every older transaction has finished, so an event committed
+    -- late by a slow transaction is never skipped
+    tx_id BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint,
+
+    event_type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL, -- Order or refund the event is about
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_outbox_events_position ON outbox_events(tx_id, id);
+CREATE INDEX idx_outbox_events_created_at ON outbox_events(created_at);
+
+-- Position of every relay consumer: the last event it has handled
+CREATE TABLE outbox_offsets (
+    consumer VARCHAR(100) PRIMARY KEY,
+    tx_id BIGINT NOT NULL,
+    event_id BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER trigger_outbox_offsets_updated_at
+    BEFORE UPDATE ON outbox_offsets
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE outbox_events IS 'Domain events written with the order and refund changes they describe';
+COMMENT ON TABLE outbox_offsets IS 'Delivery position of each outbox consumer; events are delivered at least once';
@@ -0,0 +1,76 @@
+-- Migration: 016_notifications
+-- Description: Notification queue with retries, push devices, user language and the out-for-delivery status
+-- Date: 2024-04-22
+
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'OUT_FOR_DELIVERY';
+
+ALTER TABLE users ADD COLUMN language VARCHAR(5) NOT NULL DEFAULT 'en';
+ALTER TABLE users ADD CONSTRAINT users_language_valid CHECK (language IN ('en', 'te'));
+
+-- ============================================================================
+-- PUSH DEVICES
+-- ============================================================================
+
+-- A token belongs to the user last signed in on the device
+CREATE TABLE devices (
+    token VARCHAR(512) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT devices_platform_valid CHECK (platform IN ('android', 'ios', 'web'))
+);
+
+CREATE INDEX idx_devices_user ON devices(user_id);
+
+CREATE TRIGGER trigger_devices_updated_at
+    BEFORE UPDATE ON devices
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================================================
+-- NOTIFICATIONS
+-- ============================================================================
+
+CREATE TYPE notification_status AS ENUM ('PENDING', 'SENT', 'FAILED');
+
+-- One message to one recipient on one channel, retried until sent
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event VARCHAR(30) NOT NULL,
+    channel VARCHAR(10) NOT NULL,
+    recipient VARCHAR(512) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}', -- Push payload, e.g. the order to open
+
+    status notification_status NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    sent_at TIMESTAMP WITH TIME ZONE,
+
+    -- Same cause, channel and recipient are queued once, e.g. a redelivered event
+    dedup_key VARCHAR(700) NOT NULL,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT notifications_dedup_key_unique UNIQUE (dedup_key),
+    CONSTRAINT notifications_channel_valid CHECK (channel IN ('sms', 'email', 'push'))
+);
+
+CREATE INDEX idx_notifications_due ON notifications(next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX idx_notifications_user ON notifications(user_id, created_at DESC);
+CREATE INDEX idx_notifications_status ON notifications(status, created_at DESC);
+
+CREATE TRIGGER trigger_notifications_updated_at
+    BEFORE UPDATE ON notifications
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE notifications IS 'Outgoing SMS, email and push messages with their delivery attempts';
+COMMENT ON COLUMN users.language IS 'Language of notifications: en or te';
@@ -0,0 +1,54 @@
+-- Migration: 017_notification_preferences
+-- Description: Notification channels per category, marketing opt-in, quiet hours and the consent log
+-- Date: 2024-04-29
+
+-- Categories missing from notification_channels use the defaults
+ALTER TABLE users ADD COLUMN notification_channels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN marketing_opt_in BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN quiet_hours_start TIME;
+ALTER TABLE users ADD COLUMN quiet_hours_end TIME;
+ALTER TABLE users ADD CONSTRAINT users_quiet_hours_complete
+    CHECK ((quiet_hours_start IS NULL) = (quiet_hours_end IS NULL));
+
+-- Audience of promotions
+CREATE INDEX idx_users_marketing_opt_in ON users(id) WHERE marketing_opt_in;
+
+-- ============================================================================
+-- CONSENT LOG
+-- ============================================================================
+
+-- Every change to a user's notification preferences, kept as proof of consent
+CREATE TABLE consent_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    setting VARCHAR(50) NOT NULL,
+    old_value TEXT NOT NULL,
+    new_value TEXT NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    changed_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT consent_changes_source_valid CHECK (source IN ('app', 'admin'))
+);
+
+CREATE INDEX idx_consent_changes_user ON consent_changes(user_id, created_at DESC);
+
+-- The log is append-only
+CREATE OR REPLACE FUNCTION reject_consent_change_edit()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'consent_changes is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_consent_changes_append_only
+    BEFORE UPDATE OR DELETE ON consent_changes
+    FOR EACH ROW
+    EXECUTE FUNCTION reject_consent_change_edit();
+
+COMMENT ON TABLE consent_changes IS 'Append-only log of notification preference and marketing consent changes';
+COMMENT ON COLUMN users.notification_channels IS 'Channels per notification category, e.g. {"promotions": ["push"]}';
+COMMENT ON COLUMN users.marketing_opt_in IS 'Consent to promotional notifications';
+COMMENT ON COLUMN users.quiet_hours_start IS 'Start of the daily window without SMS and push, in the business timezone';
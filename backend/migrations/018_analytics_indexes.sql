@@ -0,0 +1,15 @@
+-- Migration: 018_analytics_indexes
+-- Description: Indexes for the admin sales analytics
+-- Date: 2024-05-06
+
+-- Revenue is bucketed by when orders were paid
+CREATE INDEX idx_orders_paid_at ON orders(paid_at) INCLUDE (total_amount) WHERE paid_at IS NOT NULL;
+
+-- Repeat customers count each customer's paid orders up to the end of the range
+CREATE INDEX idx_orders_user_paid_at ON orders(user_id, paid_at) WHERE paid_at IS NOT NULL;
+
+-- Refunds are netted off when processed
+CREATE INDEX idx_refunds_processed_at ON refunds(processed_at) WHERE status = 'PROCESSED';
+
+-- Payment failure rate counts captured and failed payment webhooks
+CREATE INDEX idx_webhook_logs_event_created_at ON webhook_logs(event_type, created_at);
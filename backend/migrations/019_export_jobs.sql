@@ -0,0 +1,42 @@
+-- Migration: 019_export_jobs
+-- Description: Background CSV/XLSX report exports
+-- Date: 2024-05-13
+
+CREATE TYPE export_job_status AS ENUM ('PENDING', 'RUNNING', 'DONE', 'FAILED');
+
+CREATE TABLE export_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    requested_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    kind VARCHAR(20) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    range_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    range_to TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    status export_job_status NOT NULL DEFAULT 'PENDING',
+    rows_written BIGINT NOT NULL DEFAULT 0,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    -- Path of the finished file in EXPORT_DIR
+    file_path TEXT NOT NULL DEFAULT '',
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT export_jobs_kind_valid CHECK (kind IN ('orders', 'items', 'payments')),
+    CONSTRAINT export_jobs_format_valid CHECK (format IN ('csv', 'xlsx')),
+    CONSTRAINT export_jobs_range_valid CHECK (range_from < range_to)
+);
+
+CREATE INDEX idx_export_jobs_created_at ON export_jobs(created_at DESC);
+CREATE INDEX idx_export_jobs_queue ON export_jobs(created_at) WHERE status IN ('PENDING', 'RUNNING');
+CREATE INDEX idx_export_jobs_expires_at ON export_jobs(expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TRIGGER trigger_export_jobs_updated_at
+    BEFORE UPDATE ON export_jobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE export_jobs IS 'Report exports too large to stream in the request, written in the background';
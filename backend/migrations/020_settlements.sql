@@ -0,0 +1,46 @@
+-- Migration: 020_settlements
+-- Description: Imported gateway settlement reports for reconciliation
+-- Date: 2024-05-20
+
+CREATE TABLE settlement_imports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    imported_by UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    lines INTEGER NOT NULL DEFAULT 0,
+    new_lines INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- One row per gateway entity; importing an overlapping report updates the
+-- lines it already has
+CREATE TABLE settlement_lines (
+    entity_id VARCHAR(50) PRIMARY KEY,
+    type VARCHAR(30) NOT NULL,
+    payment_id VARCHAR(50) NOT NULL DEFAULT '',
+    razorpay_order_id VARCHAR(50) NOT NULL DEFAULT '',
+    -- Paisa; fee includes tax
+    amount BIGINT NOT NULL,
+    fee BIGINT NOT NULL DEFAULT 0,
+    tax BIGINT NOT NULL DEFAULT 0,
+    net BIGINT NOT NULL,
+    settlement_id VARCHAR(50) NOT NULL,
+    settlement_utr VARCHAR(50) NOT NULL DEFAULT '',
+    settled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    import_id UUID NOT NULL REFERENCES settlement_imports(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT settlement_lines_type_not_empty CHECK (type <> ''),
+    CONSTRAINT settlement_lines_fee_valid CHECK (fee >= 0 AND tax >= 0 AND tax <= fee)
+);
+
+CREATE INDEX idx_settlement_lines_payment_id ON settlement_lines(payment_id) WHERE payment_id <> '';
+CREATE INDEX idx_settlement_lines_settled_at ON settlement_lines(settled_at);
+
+CREATE TRIGGER trigger_settlement_lines_updated_at
+    BEFORE UPDATE ON settlement_lines
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE settlement_imports IS 'Settlement report files imported by admins';
+COMMENT ON TABLE settlement_lines IS 'Payments, refunds and adjustments paid out by the gateway, from imported settlement reports';
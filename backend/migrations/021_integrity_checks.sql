@@ -0,0 +1,43 @@
+-- Migration: 021_integrity_checks
+-- Description: Nightly consistency checks of orders and payments
+-- Date: 2024-05-27
+
+CREATE TABLE integrity_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- Business day of a nightly run; NULL for runs started by an admin.
+    -- Unique so only one instance runs each night.
+    run_date DATE UNIQUE,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE,
+    findings INTEGER NOT NULL DEFAULT 0,
+    new_findings INTEGER NOT NULL DEFAULT 0,
+    resolved_findings INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_integrity_runs_started_at ON integrity_runs(started_at DESC);
+
+CREATE TABLE integrity_findings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    check_name VARCHAR(30) NOT NULL,
+    -- What the finding is about: an order ID, or a payment ID for webhooks
+    subject VARCHAR(100) NOT NULL,
+    order_id UUID REFERENCES orders(id) ON DELETE CASCADE,
+    details TEXT NOT NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    last_run_id UUID NOT NULL REFERENCES integrity_runs(id) ON DELETE CASCADE,
+
+    CONSTRAINT integrity_findings_unique UNIQUE (check_name, subject)
+);
+
+CREATE INDEX idx_integrity_findings_open ON integrity_findings(check_name, last_seen_at) WHERE resolved_at IS NULL;
+CREATE INDEX idx_integrity_findings_last_seen ON integrity_findings(last_seen_at DESC);
+
+-- Captured payments are looked up by payment ID
+CREATE INDEX idx_webhook_logs_captured_payment ON webhook_logs ((payload->'payload'->'payment'->'entity'->>'id'))
+    WHERE event_type = 'payment.captured';
+
+COMMENT ON TABLE integrity_runs IS 'Runs of the order and payment consistency checker';
+COMMENT ON TABLE integrity_findings IS 'Violations found by the consistency checker; resolved once a later run no longer finds them';
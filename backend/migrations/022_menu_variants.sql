@@ -0,0 +1,34 @@
+-- Migration: 022_menu_variants
+-- Description: Sizes and portions of menu items with their own prices
+-- Date: 2024-06-03
+
+CREATE TABLE menu_item_variants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    menu_item_id UUID NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    -- Price in PAISA, charged instead of the item's price
+    price INTEGER NOT NULL,
+    is_available BOOLEAN NOT NULL DEFAULT TRUE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT menu_item_variants_name_unique UNIQUE (menu_item_id, name),
+    CONSTRAINT menu_item_variants_name_not_empty CHECK (name <> ''),
+    CONSTRAINT menu_item_variants_price_positive CHECK (price > 0)
+);
+
+CREATE TRIGGER trigger_menu_item_variants_updated_at
+    BEFORE UPDATE ON menu_item_variants
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Variant chosen for an order line, snapshotted like the item name and price
+ALTER TABLE order_items ADD COLUMN variant_id UUID REFERENCES menu_item_variants(id) ON DELETE SET NULL;
+ALTER TABLE order_items ADD COLUMN variant_name VARCHAR(50) NOT NULL DEFAULT '';
+
+-- Group cart lines are priced at checkout, so a deleted variant drops the line
+ALTER TABLE group_cart_items ADD COLUMN variant_id UUID REFERENCES menu_item_variants(id) ON DELETE CASCADE;
+
+COMMENT ON TABLE menu_item_variants IS 'Sizes and portions of a menu item (half/full plate), each with its own price and availability';
+COMMENT ON COLUMN order_items.variant_name IS 'Name of the chosen variant at time of order; empty for items without variants';
@@ -0,0 +1,57 @@
+-- Migration: 023_modifier_groups
+-- Description: Add-on and choice modifiers on menu items
+-- Date: 2024-06-10
+
+CREATE TABLE modifier_groups (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    menu_item_id UUID NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    -- Options a customer must and may choose; a minimum makes the group required
+    min_select INTEGER NOT NULL DEFAULT 0,
+    max_select INTEGER NOT NULL DEFAULT 1,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT modifier_groups_name_unique UNIQUE (menu_item_id, name),
+    CONSTRAINT modifier_groups_name_not_empty CHECK (name <> ''),
+    CONSTRAINT modifier_groups_select_valid CHECK (min_select >= 0 AND max_select >= 1 AND min_select <= max_select)
+);
+
+CREATE TABLE modifier_options (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    group_id UUID NOT NULL REFERENCES modifier_groups(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    -- Price in PAISA added per unit of the item; 0 for a free choice
+    price INTEGER NOT NULL DEFAULT 0,
+    is_available BOOLEAN NOT NULL DEFAULT TRUE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT modifier_options_name_unique UNIQUE (group_id, name),
+    CONSTRAINT modifier_options_name_not_empty CHECK (name <> ''),
+    CONSTRAINT modifier_options_price_non_negative CHECK (price >= 0)
+);
+
+CREATE TRIGGER trigger_modifier_groups_updated_at
+    BEFORE UPDATE ON modifier_groups
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER trigger_modifier_options_updated_at
+    BEFORE UPDATE ON modifier_options
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Options chosen for an order line, snapshotted with their group name and
+-- price: [{"option_id", "group", "name", "price"}]. The line price includes them.
+ALTER TABLE order_items ADD COLUMN modifiers JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE order_items ADD CONSTRAINT order_items_modifiers_array CHECK (jsonb_typeof(modifiers) = 'array');
+
+-- Options chosen for a group cart line, priced at checkout
+ALTER TABLE group_cart_items ADD COLUMN modifier_option_ids UUID[] NOT NULL DEFAULT '{}';
+
+COMMENT ON TABLE modifier_groups IS 'Add-on and choice groups of a menu item with how many options may be chosen';
+COMMENT ON TABLE modifier_options IS 'Options of a modifier group with the price they add';
+COMMENT ON COLUMN order_items.modifiers IS 'Modifier options chosen, at time of order; included in price';
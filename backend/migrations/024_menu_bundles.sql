@@ -0,0 +1,55 @@
+-- Migration: 024_menu_bundles
+-- Description: Combo menu items made of fixed and choose-one slots
+-- Date: 2024-06-17
+
+-- A menu item with slots is a bundle sold at its own price. A slot with a
+-- single option is fixed; with several the customer chooses one.
+CREATE TABLE bundle_slots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    bundle_id UUID NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    -- Units of the chosen item per bundle, e.g. 2 rotis
+    quantity INTEGER NOT NULL DEFAULT 1,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT bundle_slots_name_unique UNIQUE (bundle_id, name),
+    CONSTRAINT bundle_slots_name_not_empty CHECK (name <> ''),
+    CONSTRAINT bundle_slots_quantity_positive CHECK (quantity > 0)
+);
+
+CREATE TABLE bundle_slot_options (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    slot_id UUID NOT NULL REFERENCES bundle_slots(id) ON DELETE CASCADE,
+    menu_item_id UUID NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES menu_item_variants(id) ON DELETE CASCADE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_bundle_slot_options_slot ON bundle_slot_options(slot_id);
+CREATE INDEX idx_bundle_slot_options_menu_item ON bundle_slot_options(menu_item_id);
+
+CREATE TRIGGER trigger_bundle_slots_updated_at
+    BEFORE UPDATE ON bundle_slots
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER trigger_bundle_slot_options_updated_at
+    BEFORE UPDATE ON bundle_slot_options
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Components of a bundle line, snapshotted at time of order:
+-- [{"slot_id", "slot", "option_id", "menu_item_id", "variant_id", "name", "quantity"}]
+ALTER TABLE order_items ADD COLUMN components JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE order_items ADD CONSTRAINT order_items_components_array CHECK (jsonb_typeof(components) = 'array');
+
+-- Slot choices of a group cart line as {"slot_id": "option_id"}, checked at checkout
+ALTER TABLE group_cart_items ADD COLUMN bundle_choices JSONB NOT NULL DEFAULT '{}';
+
+COMMENT ON TABLE bundle_slots IS 'Slots of a bundle menu item, each filled by one of its options';
+COMMENT ON TABLE bundle_slot_options IS 'Menu items, optionally at a variant, that can fill a bundle slot';
+COMMENT ON COLUMN order_items.components IS 'Bundle components chosen, at time of order';
@@ -0,0 +1,63 @@
+-- Migration: 025_menu_stock
+-- Description: Daily stock counts of menu items with per-order reservations
+-- Date: 2024-06-24
+
+-- Only items with a row here are counted; the others are limited by
+-- is_available alone
+CREATE TABLE menu_item_stock (
+    menu_item_id UUID PRIMARY KEY REFERENCES menu_items(id) ON DELETE CASCADE,
+    -- Plates available each day; remaining goes back to it on the daily reset
+    daily_stock INTEGER NOT NULL,
+    remaining INTEGER NOT NULL,
+    -- Set when running out made the item unavailable, so it is made available
+    -- again when stock comes back but an item switched off by hand is not
+    sold_out BOOLEAN NOT NULL DEFAULT FALSE,
+    reset_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT menu_item_stock_daily_non_negative CHECK (daily_stock >= 0),
+    -- Last line of defence against overselling
+    CONSTRAINT menu_item_stock_remaining_non_negative CHECK (remaining >= 0)
+);
+
+CREATE TRIGGER trigger_menu_item_stock_updated_at
+    BEFORE UPDATE ON menu_item_stock
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Stock taken by an order: RESERVED when the order is placed, COMMITTED once
+-- it is paid (dine-in rounds straight away), RELEASED if payment fails or the
+-- hold expires
+CREATE TYPE stock_reservation_status AS ENUM ('RESERVED', 'COMMITTED', 'RELEASED');
+
+CREATE TABLE stock_reservations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    menu_item_id UUID NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL,
+    status stock_reservation_status NOT NULL DEFAULT 'RESERVED',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT stock_reservations_unique UNIQUE (order_id, menu_item_id),
+    CONSTRAINT stock_reservations_quantity_positive CHECK (quantity > 0)
+);
+
+CREATE INDEX idx_stock_reservations_held ON stock_reservations(created_at) WHERE status = 'RESERVED';
+CREATE INDEX idx_stock_reservations_menu_item ON stock_reservations(menu_item_id) WHERE status = 'RESERVED';
+
+CREATE TRIGGER trigger_stock_reservations_updated_at
+    BEFORE UPDATE ON stock_reservations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Business days whose stock was reset; the primary key lets one instance claim each reset
+CREATE TABLE stock_resets (
+    reset_date DATE PRIMARY KEY,
+    reset_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE menu_item_stock IS 'Daily stock counts of menu items that are sold out automatically';
+COMMENT ON TABLE stock_reservations IS 'Stock taken by each order and whether it was paid for';
+COMMENT ON TABLE stock_resets IS 'Daily stock resets already done';
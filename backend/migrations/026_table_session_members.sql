@@ -0,0 +1,22 @@
+-- Migration: 026_table_session_members
+-- Description: Guests who joined a table tab by scanning its QR code
+-- Date: 2024-07-01
+
+CREATE TABLE table_session_members (
+    session_id UUID NOT NULL REFERENCES table_sessions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (session_id, user_id)
+);
+
+-- Guests who already ordered on a running tab keep access to it
+INSERT INTO table_session_members (session_id, user_id, joined_at)
+SELECT o.table_session_id, o.user_id, MIN(o.created_at)
+FROM orders o
+JOIN table_sessions s ON s.id = o.table_session_id
+WHERE s.status <> 'SETTLED'
+GROUP BY o.table_session_id, o.user_id
+ON CONFLICT DO NOTHING;
+
+COMMENT ON TABLE table_session_members IS 'Guests allowed to view, order on and pay a table tab';
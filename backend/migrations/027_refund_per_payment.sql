@@ -0,0 +1,10 @@
+-- Migration: 027_refund_per_payment
+-- Description: Let one cause refund several payments, e.g. an edit's surplus across an order's payments
+-- Date: 2024-07-08
+
+ALTER TABLE refunds DROP CONSTRAINT refunds_source_unique;
+
+-- A payment is refunded at most once per cause
+ALTER TABLE refunds ADD CONSTRAINT refunds_source_unique UNIQUE (source, source_id, razorpay_payment_id);
+
+CREATE INDEX idx_refunds_razorpay_payment_id ON refunds(razorpay_payment_id);
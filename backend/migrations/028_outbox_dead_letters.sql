@@ -0,0 +1,29 @@
+-- Migration: 028_outbox_dead_letters
+-- Description: Count failed deliveries per consumer and park events a subscriber keeps failing on
+-- Date: 2024-07-15
+
+-- The event a consumer is stuck on, if any, and how often handling it failed
+ALTER TABLE outbox_offsets
+    ADD COLUMN failed_event_id BIGINT,
+    ADD COLUMN failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+
+-- Events a subscriber gave up on after OUTBOX_MAX_ATTEMPTS failures. The
+-- event is copied, so it outlives the outbox retention
+CREATE TABLE outbox_dead_letters (
+    consumer VARCHAR(100) NOT NULL,
+    event_id BIGINT NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    event_created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (consumer, event_id)
+);
+
+CREATE INDEX idx_outbox_dead_letters_created_at ON outbox_dead_letters(created_at);
+
+COMMENT ON TABLE outbox_dead_letters IS 'Events a subscriber failed to handle OUTBOX_MAX_ATTEMPTS times and skipped';
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// csvWriter writes RFC 4180 CSV with a UTF-8 byte order mark, which Excel
+// needs to read Telugu and the rupee sign correctly
+type csvWriter struct {
+	w      *csv.Writer
+	bomErr error
+	record []string
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	_, err := io.WriteString(w, "\uFEFF")
+	return &csvWriter{w: csv.NewWriter(w), bomErr: err}
+}
+
+func (c *csvWriter) WriteHeader(columns ...string) error {
+	if c.bomErr != nil {
+		return c.bomErr
+	}
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(cells ...Cell) error {
+	c.record = c.record[:0]
+	for _, cell := range cells {
+		value := cell.formatted()
+		if cell.kind == kindString {
+			value = neutralizeFormula(value)
+		}
+		c.record = append(c.record, value)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// neutralizeFormula stops spreadsheets from running text that looks like a
+// formula, e.g. a customer name starting with "=", by prefixing a quote
+func neutralizeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,115 @@
+// Package export writes tabular reports as CSV or XLSX one row at a time, so
+// reports of any size are streamed without being held in memory.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Format is a report file format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// IsValid checks if the format is supported
+func (f Format) IsValid() bool {
+	return f == FormatCSV || f == FormatXLSX
+}
+
+// ContentType is the MIME type of files in the format
+func (f Format) ContentType() string {
+	if f == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// cellKind is how a cell is written
+type cellKind int
+
+const (
+	kindString cellKind = iota
+	kindInt
+	kindMoney
+)
+
+// Cell is one value of a row
+type Cell struct {
+	kind  cellKind
+	text  string
+	value int64
+}
+
+// String is a text cell
+func String(s string) Cell {
+	return Cell{kind: kindString, text: s}
+}
+
+// Int is a whole number cell
+func Int(n int64) Cell {
+	return Cell{kind: kindInt, value: n}
+}
+
+// Money is an amount in paisa, written in rupees with two decimals
+func Money(paisa int64) Cell {
+	return Cell{kind: kindMoney, value: paisa}
+}
+
+// Time is a timestamp written as text in the given timezone; the zero time
+// is an empty cell
+func Time(t time.Time, loc *time.Location) Cell {
+	if t.IsZero() {
+		return String("")
+	}
+	return String(t.In(loc).Format("2006-01-02 15:04:05"))
+}
+
+// Bool is written as yes or no
+func Bool(b bool) Cell {
+	if b {
+		return String("yes")
+	}
+	return String("no")
+}
+
+// formatted returns the cell as text, as written to CSV
+func (c Cell) formatted() string {
+	switch c.kind {
+	case kindInt:
+		return strconv.FormatInt(c.value, 10)
+	case kindMoney:
+		sign := ""
+		value := c.value
+		if value < 0 {
+			sign, value = "-", -value
+		}
+		return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+	}
+	return c.text
+}
+
+// Writer writes a header row and then data rows. Close must be called to
+// finish the file; it does not close the underlying writer.
+type Writer interface {
+	WriteHeader(columns ...string) error
+	WriteRow(cells ...Cell) error
+	Close() error
+}
+
+// NewWriter starts a report in the given format. sheet names the XLSX
+// worksheet.
+func NewWriter(format Format, w io.Writer, sheet string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DevSender writes messages as JSON lines instead of sending them, so OTPs and
+// order notifications can be read locally without any live service
+type DevSender struct {
+	channel string
+	mu      sync.Mutex
+	out     io.Writer
+}
+
+// NewDevSender writes messages of a channel to a file, appending, or to
+// stdout if path is "stdout" or empty
+func NewDevSender(channel, path string) (*DevSender, error) {
+	if path == "" || path == "stdout" {
+		return &DevSender{channel: channel, out: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notification file: %w", err)
+	}
+	return &DevSender{channel: channel, out: file}, nil
+}
+
+// Send writes the message
+func (s *DevSender) Send(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(map[string]interface{}{
+		"time":    time.Now().Format(time.RFC3339),
+		"channel": s.channel,
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+		"data":    msg.Data,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fcmScope is the OAuth scope needed to send through FCM
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// serviceAccount is the part of a Google service account key file FCM needs
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCMPush sends push notifications through the Firebase Cloud Messaging HTTP
+// v1 API, authenticating with a service account
+type FCMPush struct {
+	account serviceAccount
+	client  *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMPush creates an FCM sender from a service account key file
+func NewFCMPush(credentialsFile string) (*FCMPush, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+	}
+
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("invalid FCM credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("FCM credentials need project_id, client_email and private_key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	return &FCMPush{account: account, client: newHTTPClient()}, nil
+}
+
+// Send pushes msg to the device registration token in msg.To
+func (s *FCMPush) Send(ctx context.Context, msg Message) error {
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": msg.To,
+			"notification": map[string]string{
+				"title": msg.Subject,
+				"body":  msg.Body,
+			},
+			"data": msg.Data,
+		},
+	})
+	if err != nil {
+		return permanent(err)
+	}
+
+	endpoint := fmt.Sprintf("https://fcm.googleapis.com/v1/projects/%s/messages:send", url.PathEscape(s.account.ProjectID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fcm request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	// The app was uninstalled or the token rotated
+	if resp.StatusCode == http.StatusNotFound || strings.Contains(string(body), "UNREGISTERED") {
+		return fmt.Errorf("%w: %s", ErrInvalidRecipient, body)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.mu.Lock()
+		s.accessToken = ""
+		s.mu.Unlock()
+		return fmt.Errorf("fcm rejected the access token")
+	}
+	return statusError("fcm", resp.StatusCode, body)
+}
+
+// token returns a cached OAuth access token, exchanging a signed service
+// account assertion for a new one shortly before the old one expires
+func (s *FCMPush) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(s.account.PrivateKey))
+	if err != nil {
+		return "", permanent(fmt.Errorf("invalid FCM private key: %w", err))
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(key)
+	if err != nil {
+		return "", permanent(fmt.Errorf("failed to sign FCM assertion: %w", err))
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fcm token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return "", statusError("google oauth", resp.StatusCode, body)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.AccessToken == "" {
+		return "", fmt.Errorf("invalid fcm token response")
+	}
+
+	s.accessToken = result.AccessToken
+	// Renew a minute early so a token never expires mid-request
+	s.expiresAt = now.Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return s.accessToken, nil
+}
@@ -0,0 +1,61 @@
+// Package notify provides the SMS, email and push providers used to send
+// notifications, plus a development provider that writes messages to a file
+// or stdout instead of a live service.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Message is one notification to one recipient
+type Message struct {
+	To      string            // Phone number, email address or device token
+	Subject string            // Email subject or push title; unused for SMS
+	Body    string            // Plain text
+	Data    map[string]string // Extra push payload, e.g. the order ID to open
+}
+
+// Sender delivers messages over one channel
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Provider errors
+var (
+	// ErrPermanent marks failures that will not succeed on retry, such as a
+	// malformed recipient or rejected credentials
+	ErrPermanent = errors.New("permanent delivery failure")
+	// ErrInvalidRecipient marks a recipient that no longer exists, such as an
+	// expired push token; it is also permanent
+	ErrInvalidRecipient = errors.New("recipient is no longer valid")
+)
+
+// permanent wraps err so errors.Is(err, ErrPermanent) holds
+func permanent(err error) error {
+	return fmt.Errorf("%w: %v", ErrPermanent, err)
+}
+
+// httpTimeout bounds every provider API call
+const httpTimeout = 10 * time.Second
+
+// newHTTPClient returns the client used for provider APIs
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: httpTimeout}
+}
+
+// statusError turns an unsuccessful API response into an error. Client errors
+// other than rate limiting are permanent; server errors are retried.
+func statusError(provider string, status int, body []byte) error {
+	if len(body) > 500 {
+		body = body[:500]
+	}
+	err := fmt.Errorf("%s returned %d: %s", provider, status, body)
+	if status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+		return permanent(err)
+	}
+	return err
+}
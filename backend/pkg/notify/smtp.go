@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// SMTPEmail sends plain text email through an SMTP server, upgrading to TLS
+// with STARTTLS when the server offers it
+type SMTPEmail struct {
+	addr string
+	auth smtp.Auth
+	from mail.Address
+}
+
+// NewSMTPEmail creates an SMTP email sender. Username may be empty for
+// servers that do not require authentication.
+func NewSMTPEmail(host string, port int, username, password, from string) (*SMTPEmail, error) {
+	if host == "" || from == "" {
+		return nil, fmt.Errorf("SMTP host and sender address are required")
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	s := &SMTPEmail{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: *sender,
+	}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s, nil
+}
+
+// Send sends the message to the address in msg.To
+func (s *SMTPEmail) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+	}
+
+	// net/smtp has no context support; give up at the caller's deadline
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, s.build(to, msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			// 5xx replies (unknown mailbox, rejected sender) will not change on retry
+			var reply *textproto.Error
+			if errors.As(err, &reply) && reply.Code >= 500 {
+				return permanent(err)
+			}
+			return fmt.Errorf("smtp send failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// build renders the message as UTF-8 text, base64 encoded so Telugu survives
+// any relay
+func (s *SMTPEmail) build(to *mail.Address, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+
+	return buf.Bytes()
+}
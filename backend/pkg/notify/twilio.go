@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TwilioSMS sends SMS through the Twilio Messages API
+type TwilioSMS struct {
+	accountSID string
+	authToken  string
+	from       string // Sender number or messaging service SID (MG...)
+	client     *http.Client
+}
+
+// NewTwilioSMS creates a Twilio SMS sender
+func NewTwilioSMS(accountSID, authToken, from string) (*TwilioSMS, error) {
+	if accountSID == "" || authToken == "" || from == "" {
+		return nil, fmt.Errorf("twilio account SID, auth token and sender are required")
+	}
+	return &TwilioSMS{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		client:     newHTTPClient(),
+	}, nil
+}
+
+// Send sends msg.Body to the phone number in msg.To
+func (s *TwilioSMS) Send(ctx context.Context, msg Message) error {
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("Body", msg.Body)
+	if strings.HasPrefix(s.from, "MG") {
+		form.Set("MessagingServiceSid", s.from)
+	} else {
+		form.Set("From", s.from)
+	}
+
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", url.PathEscape(s.accountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return permanent(err)
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("twilio request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return statusError("twilio", resp.StatusCode, body)
+	}
+	return nil
+}
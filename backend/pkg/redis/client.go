@@ -5,7 +5,9 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -62,8 +64,16 @@ const (
 	IdempotencyTTL     = 1 * time.Minute
 	SessionPrefix      = "app:session:"
 	SessionTTL         = 24 * time.Hour
+	CartPrefix         = "app:cart:"
+	CartTTL            = 7 * 24 * time.Hour
 )
 
+// EventStreamKey is the stream domain events are relayed to from the outbox
+const EventStreamKey = "app:events"
+
+// ErrConcurrentUpdate is returned by UpdateJSON when the key kept changing under it
+var ErrConcurrentUpdate = errors.New("value was modified concurrently")
+
 // GetJSON retrieves a JSON value from Redis and unmarshals it into the target.
 // Returns false if key doesn't exist.
 func (c *Client) GetJSON(ctx context.Context, key string, target interface{}) (bool, error) {
@@ -150,3 +160,52 @@ func (c *Client) GetAndExtendTTL(ctx context.Context, key string, target interfa
 
 	return true, nil
 }
+
+// UpdateJSON performs an optimistic read-modify-write of a JSON value.
+// The key is WATCHed while update mutates target (a pointer; found reports whether the
+// key existed); the result is written back with ttl only if nobody changed
+// the key in between, otherwise the update is retried a few times.
+// Returning an error from update aborts without writing.
+func (c *Client) UpdateJSON(ctx context.Context, key string, target interface{}, ttl time.Duration, update func(found bool) error) error {
+	const maxAttempts = 5
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err := c.Watch(ctx, func(tx *redis.Tx) error {
+			// Start every attempt from a zero value, not the previous attempt's result
+			zero := reflect.ValueOf(target).Elem()
+			zero.Set(reflect.Zero(zero.Type()))
+
+			found := true
+			val, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				found = false
+			} else if err != nil {
+				return fmt.Errorf("redis get failed: %w", err)
+			} else if err := json.Unmarshal(val, target); err != nil {
+				return fmt.Errorf("failed to unmarshal cached value: %w", err)
+			}
+
+			if err := update(found); err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(target)
+			if err != nil {
+				return fmt.Errorf("failed to marshal value: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, ttl)
+				return nil
+			})
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			continue // Key changed while we were updating it; retry on fresh data
+		}
+		return err
+	}
+
+	return ErrConcurrentUpdate
+}
@@ -0,0 +1,151 @@
+// Package tally writes vouchers as a Tally XML import file, which can be
+// imported in Tally through Import Data > Vouchers.
+package tally
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Entry is one ledger line of a voucher. Amounts are in paisa: positive
+// debits the ledger, negative credits it.
+type Entry struct {
+	Ledger string
+	Amount int64
+}
+
+// Voucher is one accounting voucher. The entries of a voucher must sum to
+// zero.
+type Voucher struct {
+	// RemoteID identifies the voucher across imports: importing a voucher
+	// again replaces it instead of booking it twice
+	RemoteID  string
+	Type      string // Voucher type, e.g. Sales, Credit Note or Journal
+	Number    string
+	Date      time.Time
+	Party     string // Party ledger, for Sales and Credit Note vouchers
+	Narration string
+	Entries   []Entry
+}
+
+// Validate checks that the voucher balances and names its ledgers
+func (v *Voucher) Validate() error {
+	var sum int64
+	for _, e := range v.Entries {
+		if e.Ledger == "" {
+			return fmt.Errorf("voucher %s has an entry without a ledger", v.Number)
+		}
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("voucher %s does not balance: off by %d paisa", v.Number, sum)
+	}
+	return nil
+}
+
+type envelope struct {
+	XMLName xml.Name `xml:"ENVELOPE"`
+	Header  header   `xml:"HEADER"`
+	Body    body     `xml:"BODY"`
+}
+
+type header struct {
+	TallyRequest string `xml:"TALLYREQUEST"`
+}
+
+type body struct {
+	ReportName string         `xml:"IMPORTDATA>REQUESTDESC>REPORTNAME"`
+	Company    string         `xml:"IMPORTDATA>REQUESTDESC>STATICVARIABLES>SVCURRENTCOMPANY,omitempty"`
+	Messages   []tallyMessage `xml:"IMPORTDATA>REQUESTDATA>TALLYMESSAGE"`
+}
+
+type tallyMessage struct {
+	Voucher voucherXML `xml:"VOUCHER"`
+}
+
+type voucherXML struct {
+	RemoteID   string     `xml:"REMOTEID,attr"`
+	VchType    string     `xml:"VCHTYPE,attr"`
+	Action     string     `xml:"ACTION,attr"`
+	Date       string     `xml:"DATE"`
+	TypeName   string     `xml:"VOUCHERTYPENAME"`
+	Number     string     `xml:"VOUCHERNUMBER"`
+	PartyName  string     `xml:"PARTYLEDGERNAME,omitempty"`
+	Narration  string     `xml:"NARRATION,omitempty"`
+	IsInvoice  string     `xml:"ISINVOICE"`
+	EntryLists []entryXML `xml:"ALLLEDGERENTRIES.LIST"`
+}
+
+type entryXML struct {
+	Ledger           string `xml:"LEDGERNAME"`
+	IsDeemedPositive string `xml:"ISDEEMEDPOSITIVE"`
+	IsPartyLedger    string `xml:"ISPARTYLEDGER"`
+	Amount           string `xml:"AMOUNT"`
+}
+
+// Write writes the vouchers as an import file for company; an empty company
+// imports into the one open in Tally. Every voucher is validated first, so
+// nothing is written for an unbalanced set.
+func Write(w io.Writer, company string, vouchers []Voucher) error {
+	env := envelope{
+		Header: header{TallyRequest: "Import Data"},
+		Body:   body{ReportName: "Vouchers", Company: company},
+	}
+
+	for i := range vouchers {
+		v := &vouchers[i]
+		if err := v.Validate(); err != nil {
+			return err
+		}
+
+		vx := voucherXML{
+			RemoteID:  v.RemoteID,
+			VchType:   v.Type,
+			Action:    "Create",
+			Date:      v.Date.Format("20060102"),
+			TypeName:  v.Type,
+			Number:    v.Number,
+			PartyName: v.Party,
+			Narration: v.Narration,
+			IsInvoice: "No",
+		}
+		for _, e := range v.Entries {
+			vx.EntryLists = append(vx.EntryLists, entryXML{
+				Ledger:           e.Ledger,
+				IsDeemedPositive: yesNo(e.Amount > 0),
+				IsPartyLedger:    yesNo(e.Ledger == v.Party),
+				Amount:           amount(e.Amount),
+			})
+		}
+		env.Body.Messages = append(env.Body.Messages, tallyMessage{Voucher: vx})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(env); err != nil {
+		return fmt.Errorf("failed to encode tally vouchers: %w", err)
+	}
+	return enc.Close()
+}
+
+// amount formats paisa in Tally's sign convention, where debits are negative
+func amount(paisa int64) string {
+	value := -paisa
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
@@ -5,6 +5,7 @@ import 'screens/menu_screen.dart';
 import 'screens/cart_screen.dart';
 import 'screens/checkout_screen.dart';
 import 'screens/order_confirmation_screen.dart';
+import 'screens/order_history_screen.dart';
 import 'screens/login_screen.dart';
 import 'screens/signup_screen.dart';
 import 'providers/auth_provider.dart';
@@ -97,6 +98,11 @@ class FoodDeliveryApp extends ConsumerWidget {
               builder: (context) => const OrderConfirmationScreen(),
               settings: settings,
             );
+          case '/orders':
+            return MaterialPageRoute(
+              builder: (context) => const OrderHistoryScreen(),
+              settings: settings,
+            );
           default:
             LoggerService.warning('[Router] Unknown route: ${settings.name}');
             return MaterialPageRoute(
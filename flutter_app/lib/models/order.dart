@@ -5,7 +5,11 @@ enum OrderStatus {
   paymentFailed('PAYMENT_FAILED'),
   paid('PAID'),
   accepted('ACCEPTED'),
-  delivered('DELIVERED');
+  outForDelivery('OUT_FOR_DELIVERY'),
+  delivered('DELIVERED'),
+  readyForPickup('READY_FOR_PICKUP'),
+  collected('COLLECTED'),
+  onTab('ON_TAB');
 
   final String value;
   const OrderStatus(this.value);
@@ -27,6 +31,8 @@ class Order {
   final String? razorpayOrderId;
   final String? razorpayPaymentId;
   final List<OrderItem> items;
+  final int itemCount; // Set in summary listings instead of items
+  final String? itemPreview;
   final DateTime createdAt;
   final DateTime updatedAt;
 
@@ -38,6 +44,8 @@ class Order {
     this.razorpayOrderId,
     this.razorpayPaymentId,
     this.items = const [],
+    this.itemCount = 0,
+    this.itemPreview,
     required this.createdAt,
     required this.updatedAt,
   });
@@ -57,12 +65,40 @@ class Order {
               ?.map((e) => OrderItem.fromJson(e as Map<String, dynamic>))
               .toList() ??
           [],
+      itemCount: json['item_count'] as int? ?? 0,
+      itemPreview: json['item_preview'] as String?,
       createdAt: DateTime.parse(json['created_at'] as String),
       updatedAt: DateTime.parse(json['updated_at'] as String),
     );
   }
 }
 
+/// One page of the customer's order history
+class OrderHistoryPage {
+  final List<Order> orders;
+  final String? nextCursor; // Null on the last page
+  final int totalCount;
+
+  const OrderHistoryPage({
+    required this.orders,
+    this.nextCursor,
+    required this.totalCount,
+  });
+
+  bool get hasMore => nextCursor != null;
+
+  factory OrderHistoryPage.fromJson(Map<String, dynamic> json) {
+    return OrderHistoryPage(
+      orders: (json['orders'] as List<dynamic>?)
+              ?.map((e) => Order.fromJson(e as Map<String, dynamic>))
+              .toList() ??
+          [],
+      nextCursor: json['next_cursor'] as String?,
+      totalCount: json['total_count'] as int? ?? 0,
+    );
+  }
+}
+
 /// Order item model
 class OrderItem {
   final String id;
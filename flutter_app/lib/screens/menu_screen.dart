@@ -68,7 +68,9 @@ class MenuScreen extends ConsumerWidget {
                          ),
                        ),
                        onSelected: (value) {
-                         if (value == 'logout') {
+                         if (value == 'orders') {
+                           Navigator.pushNamed(context, '/orders');
+                         } else if (value == 'logout') {
                            ref.read(authProvider.notifier).logout();
                          }
                        },
@@ -96,6 +98,16 @@ class MenuScreen extends ConsumerWidget {
                            ),
                          ),
                          const PopupMenuDivider(),
+                         const PopupMenuItem(
+                           value: 'orders',
+                           child: Row(
+                             children: [
+                               Icon(Icons.receipt_long_outlined, size: 20),
+                               SizedBox(width: 8),
+                               Text('My Orders'),
+                             ],
+                           ),
+                         ),
                          const PopupMenuItem(
                            value: 'logout',
                            child: Row(
@@ -0,0 +1,264 @@
+import 'package:flutter/material.dart';
+import 'package:flutter_riverpod/flutter_riverpod.dart';
+import '../models/order.dart';
+import '../providers/auth_provider.dart';
+import '../services/api_service.dart';
+
+/// Order history screen listing the user's past orders, newest first.
+/// Loads one page at a time and fetches the next as the list is scrolled.
+class OrderHistoryScreen extends ConsumerStatefulWidget {
+  const OrderHistoryScreen({super.key});
+
+  @override
+  ConsumerState<OrderHistoryScreen> createState() => _OrderHistoryScreenState();
+}
+
+class _OrderHistoryScreenState extends ConsumerState<OrderHistoryScreen> {
+  final List<Order> _orders = [];
+  String? _nextCursor;
+  bool _hasMore = true;
+  bool _isLoading = false;
+  String? _error;
+
+  @override
+  void initState() {
+    super.initState();
+    _loadMore();
+  }
+
+  /// Load the next page of orders
+  Future<void> _loadMore() async {
+    if (_isLoading || !_hasMore) return;
+
+    setState(() {
+      _isLoading = true;
+      _error = null;
+    });
+
+    try {
+      final apiService = ref.read(apiServiceProvider);
+      final page = await apiService.getUserOrders(
+        cursor: _nextCursor,
+        summary: true,
+      );
+
+      if (!mounted) return;
+      setState(() {
+        _orders.addAll(page.orders);
+        _nextCursor = page.nextCursor;
+        _hasMore = page.hasMore;
+      });
+    } on ApiException catch (e) {
+      if (!mounted) return;
+      setState(() => _error = e.message);
+    } catch (e) {
+      if (!mounted) return;
+      setState(() => _error = 'Failed to load orders');
+    } finally {
+      if (mounted) {
+        setState(() => _isLoading = false);
+      }
+    }
+  }
+
+  /// Start again from the newest order
+  Future<void> _refresh() async {
+    setState(() {
+      _orders.clear();
+      _nextCursor = null;
+      _hasMore = true;
+    });
+    await _loadMore();
+  }
+
+  @override
+  Widget build(BuildContext context) {
+    return Scaffold(
+      appBar: AppBar(
+        title: const Text('Your Orders'),
+        backgroundColor: Colors.black,
+        foregroundColor: Colors.white,
+      ),
+      body: RefreshIndicator(
+        color: Colors.orange,
+        onRefresh: _refresh,
+        child: _buildBody(),
+      ),
+    );
+  }
+
+  Widget _buildBody() {
+    if (_orders.isEmpty && _isLoading) {
+      return const Center(
+        child: CircularProgressIndicator(color: Colors.orange),
+      );
+    }
+
+    if (_orders.isEmpty && _error != null) {
+      return ListView(
+        children: [
+          const SizedBox(height: 120),
+          const Icon(Icons.error_outline, size: 48, color: Colors.red),
+          const SizedBox(height: 16),
+          Text(_error!, textAlign: TextAlign.center),
+          const SizedBox(height: 16),
+          Center(
+            child: TextButton(
+              onPressed: _loadMore,
+              child: const Text('Retry', style: TextStyle(color: Colors.orange)),
+            ),
+          ),
+        ],
+      );
+    }
+
+    if (_orders.isEmpty) {
+      return ListView(
+        children: const [
+          SizedBox(height: 120),
+          Icon(Icons.receipt_long_outlined, size: 64, color: Colors.grey),
+          SizedBox(height: 16),
+          Text(
+            'No orders yet',
+            textAlign: TextAlign.center,
+            style: TextStyle(fontSize: 18, color: Colors.grey),
+          ),
+        ],
+      );
+    }
+
+    return NotificationListener<ScrollNotification>(
+      onNotification: (notification) {
+        if (notification.metrics.extentAfter < 300) {
+          _loadMore();
+        }
+        return false;
+      },
+      child: ListView.separated(
+        padding: const EdgeInsets.all(16),
+        itemCount: _orders.length + (_hasMore || _error != null ? 1 : 0),
+        separatorBuilder: (context, index) => const SizedBox(height: 12),
+        itemBuilder: (context, index) {
+          if (index == _orders.length) {
+            return _buildFooter();
+          }
+          return _OrderCard(order: _orders[index]);
+        },
+      ),
+    );
+  }
+
+  /// Spinner while the next page loads, or a retry button if it failed
+  Widget _buildFooter() {
+    if (_error != null) {
+      return Center(
+        child: TextButton(
+          onPressed: _loadMore,
+          child: const Text('Retry', style: TextStyle(color: Colors.orange)),
+        ),
+      );
+    }
+    return const Padding(
+      padding: EdgeInsets.all(16),
+      child: Center(
+        child: CircularProgressIndicator(color: Colors.orange),
+      ),
+    );
+  }
+}
+
+/// One order in the history list
+class _OrderCard extends StatelessWidget {
+  final Order order;
+
+  const _OrderCard({required this.order});
+
+  @override
+  Widget build(BuildContext context) {
+    final created = order.createdAt.toLocal();
+    final date = '${created.day.toString().padLeft(2, '0')}/'
+        '${created.month.toString().padLeft(2, '0')}/${created.year}';
+
+    return Card(
+      child: Padding(
+        padding: const EdgeInsets.all(16),
+        child: Column(
+          crossAxisAlignment: CrossAxisAlignment.start,
+          children: [
+            Row(
+              mainAxisAlignment: MainAxisAlignment.spaceBetween,
+              children: [
+                Text(
+                  '#${order.id.substring(0, 8).toUpperCase()}',
+                  style: const TextStyle(fontWeight: FontWeight.bold, fontSize: 16),
+                ),
+                Text(
+                  _statusLabel(order.status),
+                  style: TextStyle(color: _statusColor(order.status), fontWeight: FontWeight.w600),
+                ),
+              ],
+            ),
+            const SizedBox(height: 8),
+            if (order.itemPreview != null)
+              Text(
+                order.itemPreview!,
+                maxLines: 2,
+                overflow: TextOverflow.ellipsis,
+                style: const TextStyle(color: Colors.grey),
+              ),
+            const SizedBox(height: 8),
+            Row(
+              mainAxisAlignment: MainAxisAlignment.spaceBetween,
+              children: [
+                Text(
+                  '$date · ${order.itemCount} ${order.itemCount == 1 ? 'item' : 'items'}',
+                  style: const TextStyle(color: Colors.grey, fontSize: 12),
+                ),
+                Text(
+                  order.formattedTotal,
+                  style: const TextStyle(color: Colors.orange, fontWeight: FontWeight.bold),
+                ),
+              ],
+            ),
+          ],
+        ),
+      ),
+    );
+  }
+
+  static String _statusLabel(OrderStatus status) {
+    switch (status) {
+      case OrderStatus.pending:
+      case OrderStatus.awaitingPayment:
+        return 'Awaiting payment';
+      case OrderStatus.paymentFailed:
+        return 'Payment failed';
+      case OrderStatus.paid:
+        return 'Paid';
+      case OrderStatus.accepted:
+        return 'Preparing';
+      case OrderStatus.outForDelivery:
+        return 'Out for delivery';
+      case OrderStatus.delivered:
+        return 'Delivered';
+      case OrderStatus.readyForPickup:
+        return 'Ready for pickup';
+      case OrderStatus.collected:
+        return 'Collected';
+      case OrderStatus.onTab:
+        return 'On tab';
+    }
+  }
+
+  static Color _statusColor(OrderStatus status) {
+    switch (status) {
+      case OrderStatus.paymentFailed:
+        return Colors.red;
+      case OrderStatus.delivered:
+      case OrderStatus.collected:
+        return Colors.green;
+      default:
+        return Colors.orange;
+    }
+  }
+}
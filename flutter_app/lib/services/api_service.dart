@@ -123,20 +123,32 @@ class ApiService {
     }
   }
 
-  /// Fetch user's order history
-  Future<List<Order>> getUserOrders() async {
+  /// Fetch a page of the user's order history, newest first.
+  /// Pass [cursor] from the previous page to load more.
+  Future<OrderHistoryPage> getUserOrders({
+    String? cursor,
+    int limit = 20,
+    List<OrderStatus>? statuses,
+    bool summary = false,
+  }) async {
+    // The limit asks for the paged response; without it the server answers
+    // with a plain list for older app versions
+    final query = <String, String>{
+      'limit': '$limit',
+      if (cursor != null) 'cursor': cursor,
+      if (statuses != null && statuses.isNotEmpty)
+        'status': statuses.map((s) => s.value).join(','),
+      if (summary) 'view': 'summary',
+    };
+
     final response = await http.get(
-      Uri.parse('$baseUrl/api/v1/orders'),
+      Uri.parse('$baseUrl/api/v1/orders').replace(queryParameters: query),
       headers: _headers,
     );
 
     if (response.statusCode == 200) {
       final data = jsonDecode(response.body) as Map<String, dynamic>;
-      final orders = (data['data'] as List<dynamic>?)
-              ?.map((e) => Order.fromJson(e as Map<String, dynamic>))
-              .toList() ??
-          [];
-      return orders;
+      return OrderHistoryPage.fromJson(data['data'] as Map<String, dynamic>);
     } else {
       throw ApiException('Failed to fetch orders', response.statusCode);
     }